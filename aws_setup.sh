@@ -7,6 +7,7 @@ CLOUDSWEEPER_POLICY='{
     "Version": "2012-10-17",
     "Statement": [
         {
+            "Sid": "CloudsweeperV2",
             "Effect": "Allow",
             "Action": [
                 "ec2:DescribeInstances",
@@ -19,6 +20,11 @@ CLOUDSWEEPER_POLICY='{
                 "ec2:DescribeVolumeAttribute",
                 "ec2:DescribeImages",
                 "ec2:DescribeSnapshotAttribute",
+                "ec2:DescribeSecurityGroups",
+                "ec2:DescribeRegions",
+                "ec2:DescribeAddresses",
+                "ec2:DescribeSpotPriceHistory",
+                "iam:ListAccountAliases",
                 "ec2:DeregisterImage",
                 "ec2:DeleteSnapshot",
                 "ec2:DeleteTags",
@@ -27,15 +33,101 @@ CLOUDSWEEPER_POLICY='{
                 "ec2:TerminateInstances",
                 "ec2:CreateTags",
                 "ec2:StopInstances",
+                "ec2:RevokeSecurityGroupIngress",
+                "ec2:CreateSnapshot",
+                "ec2:CopySnapshot",
+                "ec2:ModifySnapshotTier",
+                "ec2:DeleteNetworkInterface",
+                "ec2:DisassociateAddress",
+                "ec2:ReleaseAddress",
+                "elasticfilesystem:DescribeFileSystems",
+                "elasticfilesystem:DescribeMountTargets",
+                "elasticfilesystem:DeleteFileSystem",
+                "elasticfilesystem:DeleteMountTarget",
+                "elasticfilesystem:TagResource",
+                "elasticfilesystem:UntagResource",
+                "fsx:DescribeFileSystems",
+                "fsx:DeleteFileSystem",
+                "fsx:CreateBackup",
+                "fsx:TagResource",
+                "fsx:UntagResource",
+                "cloudtrail:LookupEvents",
                 "s3:GetBucketTagging",
                 "s3:ListBucket",
                 "s3:GetObject",
                 "s3:ListAllMyBuckets",
                 "s3:GetBucketLocation",
+                "s3:GetBucketLogging",
+                "s3:ListBucketMultipartUploads",
+                "s3:ListBucketVersions",
+                "s3:ListMultipartUploadParts",
                 "s3:PutBucketTagging",
                 "s3:DeleteObject",
                 "s3:DeleteBucket",
-                "cloudwatch:GetMetricStatistics"
+                "s3:AbortMultipartUpload",
+                "s3:DeleteObjectVersion",
+                "cloudwatch:GetMetricStatistics",
+                "cloudwatch:DescribeAlarms",
+                "cloudwatch:DeleteAlarms",
+                "cloudwatch:ListDashboards",
+                "cloudwatch:DeleteDashboards",
+                "ec2:DescribeVpcs",
+                "servicequotas:GetServiceQuota",
+                "servicequotas:GetAWSDefaultServiceQuota",
+                "ec2:DescribeNetworkInterfaces",
+                "ec2:DescribeInternetGateways",
+                "ec2:DescribeSubnets",
+                "ec2:DescribeRouteTables",
+                "ec2:DescribeNetworkAcls",
+                "ec2:DetachInternetGateway",
+                "ec2:DeleteInternetGateway",
+                "ec2:DeleteSubnet",
+                "ec2:DeleteRouteTable",
+                "ec2:DeleteNetworkAcl",
+                "ec2:RevokeSecurityGroupEgress",
+                "ec2:DeleteSecurityGroup",
+                "ec2:DeleteVpc",
+                "ec2:DescribeClientVpnEndpoints",
+                "ec2:DescribeClientVpnTargetNetworks",
+                "ec2:DescribeVpnConnections",
+                "ec2:DisassociateClientVpnTargetNetwork",
+                "ec2:DeleteClientVpnEndpoint",
+                "ec2:DeleteVpnConnection",
+                "ec2:DescribeTransitGateways",
+                "ec2:DescribeTransitGatewayAttachments",
+                "ec2:DescribeTransitGatewayRouteTables",
+                "ec2:SearchTransitGatewayRoutes",
+                "ec2:DeleteTransitGatewayVpcAttachment",
+                "ec2:DeleteTransitGatewayRoute",
+                "sagemaker:ListNotebookInstances",
+                "sagemaker:ListEndpoints",
+                "sagemaker:DescribeEndpoint",
+                "sagemaker:DescribeEndpointConfig",
+                "sagemaker:ListApps",
+                "sagemaker:DescribeApp",
+                "sagemaker:ListTags",
+                "sagemaker:AddTags",
+                "sagemaker:DeleteTags",
+                "sagemaker:StopNotebookInstance",
+                "sagemaker:DescribeNotebookInstance",
+                "sagemaker:DeleteNotebookInstance",
+                "sagemaker:DeleteEndpoint",
+                "sagemaker:DeleteApp",
+                "elasticmapreduce:ListClusters",
+                "elasticmapreduce:DescribeCluster",
+                "elasticmapreduce:ListInstances",
+                "elasticmapreduce:ListSteps",
+                "elasticmapreduce:AddTags",
+                "elasticmapreduce:RemoveTags",
+                "elasticmapreduce:TerminateJobFlows",
+                "imagebuilder:ListImages",
+                "imagebuilder:ListImageBuildVersions",
+                "dlm:GetLifecyclePolicies",
+                "dlm:GetLifecyclePolicy",
+                "iam:ListAttachedRolePolicies",
+                "iam:GetPolicy",
+                "iam:GetPolicyVersion",
+                "iam:SimulatePrincipalPolicy"
             ],
             "Resource": [
                 "*"
@@ -0,0 +1,158 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// awsMaxSimulatedActions is the largest number of actions simulated in
+// one request
+const awsMaxSimulatedActions = 100
+
+// RoleAccess is what the role Cloudsweeper assumes in an account is
+// allowed to do
+type RoleAccess struct {
+	Account string
+	// StatementIDs are the IDs (Sid) of the statements in the policies
+	// attached to the role, which tell what template they were made from
+	StatementIDs []string
+	// Denied are the actions checked which the role isn't allowed
+	Denied []string
+	// Err is why the role could not be checked, if it couldn't
+	Err error
+}
+
+// AWSRoleAccess checks the Cloudsweeper role in every AWS account. The
+// policies attached to the role are read, and the specified actions are
+// simulated to find the ones which are denied. Inline policies are
+// included in the simulation, but their statements aren't read. At most
+// parallelism accounts are checked at the same time, unless it's zero
+// or less.
+func AWSRoleAccess(accounts []string, actions []string, parallelism int) map[string]*RoleAccess {
+	result := make(map[string]*RoleAccess)
+	var resultMutex sync.Mutex
+	sess := NewAWSSession()
+	forEachAccount(accounts, parallelism, sess, func(account string, cred *credentials.Credentials) {
+		client := iam.New(sess, &aws.Config{
+			Credentials: cred,
+			Region:      aws.String(defaultAWSRegion),
+			MaxRetries:  aws.Int(awsMaxRequestRetries),
+		})
+		access := &RoleAccess{Account: account}
+		roleARN := fmt.Sprintf(assumeRoleARNTemplate, account)
+		// The name of the role is the last part of its ARN
+		roleName := roleARN[strings.LastIndex(roleARN, "/")+1:]
+		access.StatementIDs, access.Err = awsRoleStatementIDs(client, roleName)
+		if access.Err == nil {
+			access.Denied, access.Err = awsDeniedActions(client, roleARN, actions)
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = access
+	})
+	return result
+}
+
+// awsRoleStatementIDs returns the IDs of the statements in the default
+// version of every policy attached to a role
+func awsRoleStatementIDs(client *iam.IAM, roleName string) ([]string, error) {
+	ids := []string{}
+	attached, err := client.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the policies of role %s: %s", roleName, err)
+	}
+	for _, attachedPolicy := range attached.AttachedPolicies {
+		policy, err := client.GetPolicy(&iam.GetPolicyInput{PolicyArn: attachedPolicy.PolicyArn})
+		if err != nil {
+			return nil, fmt.Errorf("Could not read policy %s: %s", aws.StringValue(attachedPolicy.PolicyName), err)
+		}
+		version, err := client.GetPolicyVersion(&iam.GetPolicyVersionInput{
+			PolicyArn: attachedPolicy.PolicyArn,
+			VersionId: policy.Policy.DefaultVersionId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not read policy %s: %s", aws.StringValue(attachedPolicy.PolicyName), err)
+		}
+		policyIDs, err := policyStatementIDs(aws.StringValue(version.PolicyVersion.Document))
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse policy %s: %s", aws.StringValue(attachedPolicy.PolicyName), err)
+		}
+		ids = append(ids, policyIDs...)
+	}
+	return ids, nil
+}
+
+// policyStatementIDs returns the IDs of the statements of a URL-encoded
+// policy document, where the statement can be a single statement or a
+// list of them
+func policyStatementIDs(encoded string) ([]string, error) {
+	raw, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return nil, err
+	}
+	type statement struct {
+		Sid string
+	}
+	document := struct {
+		Statement json.RawMessage
+	}{}
+	if err := json.Unmarshal([]byte(raw), &document); err != nil {
+		return nil, err
+	}
+	statements := []statement{}
+	if err := json.Unmarshal(document.Statement, &statements); err != nil {
+		single := statement{}
+		if err := json.Unmarshal(document.Statement, &single); err != nil {
+			return nil, err
+		}
+		statements = append(statements, single)
+	}
+	ids := []string{}
+	for _, s := range statements {
+		if s.Sid != "" {
+			ids = append(ids, s.Sid)
+		}
+	}
+	return ids, nil
+}
+
+// awsDeniedActions simulates the specified actions as the role, and
+// returns the ones which are denied, sorted
+func awsDeniedActions(client *iam.IAM, roleARN string, actions []string) ([]string, error) {
+	denied := []string{}
+	for start := 0; start < len(actions); start += awsMaxSimulatedActions {
+		end := start + awsMaxSimulatedActions
+		if end > len(actions) {
+			end = len(actions)
+		}
+		err := client.SimulatePrincipalPolicyPages(&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(roleARN),
+			ActionNames:     aws.StringSlice(actions[start:end]),
+		}, func(page *iam.SimulatePolicyResponse, lastPage bool) bool {
+			for _, result := range page.EvaluationResults {
+				if aws.StringValue(result.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+					denied = append(denied, aws.StringValue(result.EvalActionName))
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not simulate the permissions of %s: %s", roleARN, err)
+		}
+	}
+	sort.Strings(denied)
+	return denied, nil
+}
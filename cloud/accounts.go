@@ -0,0 +1,108 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// accountNames holds the friendly names of accounts/projects
+var (
+	accountNames      = make(map[string]string)
+	accountNamesMutex sync.RWMutex
+)
+
+// awsAliases caches the aliases of AWS accounts, including accounts
+// without an alias, so every account is only looked up once
+var (
+	awsAliases      = make(map[string]string)
+	awsAliasesMutex sync.Mutex
+)
+
+// SetAccountNames sets the friendly names of accounts/projects, such as
+// the names in the organization or AWS account aliases, which are used
+// when accounts are displayed. Empty names are ignored.
+func SetAccountNames(names map[string]string) {
+	accountNamesMutex.Lock()
+	defer accountNamesMutex.Unlock()
+	for account, name := range names {
+		if name != "" {
+			accountNames[account] = name
+		}
+	}
+}
+
+// AccountName returns the friendly name of an account/project, or an
+// empty string if it has none
+func AccountName(account string) string {
+	accountNamesMutex.RLock()
+	defer accountNamesMutex.RUnlock()
+	return accountNames[account]
+}
+
+// AccountDisplayName returns an account/project the way it's shown to
+// people, e.g. "dev-sandbox (164337164081)", or only the ID if it has no
+// friendly name
+func AccountDisplayName(account string) string {
+	name := AccountName(account)
+	if name == "" || name == account {
+		return account
+	}
+	return fmt.Sprintf("%s (%s)", name, account)
+}
+
+// AWSAccountAliases returns the alias of every AWS account which has
+// one. Every account is only looked up once, later calls use the cached
+// alias. At most parallelism accounts are looked up at the same time,
+// unless it's zero or less.
+func AWSAccountAliases(accounts []string, parallelism int) map[string]string {
+	result := make(map[string]string)
+	var resultMutex sync.Mutex
+	uncached := []string{}
+	awsAliasesMutex.Lock()
+	for _, account := range accounts {
+		if alias, exist := awsAliases[account]; exist {
+			if alias != "" {
+				result[account] = alias
+			}
+		} else {
+			uncached = append(uncached, account)
+		}
+	}
+	awsAliasesMutex.Unlock()
+
+	sess := NewAWSSession()
+	forEachAccount(uncached, parallelism, sess, func(account string, cred *credentials.Credentials) {
+		client := iam.New(sess, &aws.Config{
+			Credentials: cred,
+			Region:      aws.String(defaultAWSRegion),
+			MaxRetries:  aws.Int(awsMaxRequestRetries),
+		})
+		output, err := client.ListAccountAliases(&iam.ListAccountAliasesInput{})
+		if err != nil {
+			status.Warnf("Could not look up the alias of AWS account %s: %s", account, err)
+			return
+		}
+		// An account can have at most one alias
+		alias := ""
+		if len(output.AccountAliases) > 0 {
+			alias = aws.StringValue(output.AccountAliases[0])
+		}
+		awsAliasesMutex.Lock()
+		awsAliases[account] = alias
+		awsAliasesMutex.Unlock()
+		if alias != "" {
+			resultMutex.Lock()
+			result[account] = alias
+			resultMutex.Unlock()
+		}
+	})
+	return result
+}
@@ -4,14 +4,18 @@
 package cloud
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/agaridata/cloudsweeper/status"
+
 	"github.com/aws/aws-sdk-go/service/sts"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -24,7 +28,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 const (
@@ -36,7 +39,15 @@ const (
 // awsResourceManager uses the AWS Go SDK. Docs can be found at:
 // https://docs.aws.amazon.com/sdk-for-go/api/service/ec2/
 type awsResourceManager struct {
-	accounts []string
+	accounts    []string
+	parallelism int
+	inventory   *awsConfigInventory
+	usage       *awsUsageLookup
+	tagging     *awsTagLookup
+	// bucketReadDays is how many days of access logs are searched for the
+	// last read of a bucket, zero or less means they are not searched
+	bucketReadDays int
+	types          *resourceTypeSwitches
 }
 
 func (m *awsResourceManager) Owners() []string {
@@ -56,6 +67,14 @@ const (
 	awsMaxRequestRetries = 6
 )
 
+// awsUseOwnCredentials is set if the default credentials are used to
+// access accounts, instead of assuming the Cloudsweeper role in them
+var awsUseOwnCredentials bool
+
+// awsRegionParallelism is the maximum number of regions of an account
+// processed at the same time, zero or less means no limit
+var awsRegionParallelism int
+
 var (
 	instanceStateFilterName = "instance-state-name"
 	instanceStateRunning    = ec2.InstanceStateNameRunning
@@ -73,13 +92,21 @@ var awsS3StorageTypes = []string{
 	"OneZoneIAStorage",
 	"ReducedRedundancyStorage",
 	"GlacierStorage",
+	"GlacierInstantRetrievalStorage",
+	"DeepArchiveStorage",
 }
 
 func (m *awsResourceManager) InstancesPerAccount() map[string][]Instance {
 	log.Println("Getting instances in all accounts")
 	resultMap := make(map[string][]Instance)
+	accounts := m.types.owners(m.accounts, ResourceTypeInstances)
+	for _, account := range accounts {
+		if instances, ok := m.inventory.accountInstances(account); ok && len(instances) > 0 {
+			resultMap[account] = instances
+		}
+	}
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
+	getAllEC2Resources(m.inventory.uncoveredInstances(accounts), m.parallelism, func(client *awsEC2Client, account string) {
 		instances, err := getAWSInstances(account, client)
 		if err != nil {
 			handleAWSAccessDenied(account, err)
@@ -96,8 +123,9 @@ func (m *awsResourceManager) ImagesPerAccount() map[string][]Image {
 	log.Println("Getting images in all accounts")
 	resultMap := make(map[string][]Image)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
+	getAllEC2Resources(m.types.owners(m.accounts, ResourceTypeImages), m.parallelism, func(client *awsEC2Client, account string) {
 		images, err := getAWSImages(account, client)
+		m.usage.enrichImages(account, client, images)
 		if err != nil {
 			handleAWSAccessDenied(account, err)
 		} else if len(images) > 0 {
@@ -112,8 +140,14 @@ func (m *awsResourceManager) ImagesPerAccount() map[string][]Image {
 func (m *awsResourceManager) VolumesPerAccount() map[string][]Volume {
 	log.Println("Getting volumes in all accounts")
 	resultMap := make(map[string][]Volume)
+	accounts := m.types.owners(m.accounts, ResourceTypeVolumes)
+	for _, account := range accounts {
+		if volumes, ok := m.inventory.accountVolumes(account); ok && len(volumes) > 0 {
+			resultMap[account] = volumes
+		}
+	}
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
+	getAllEC2Resources(m.inventory.uncoveredVolumes(accounts), m.parallelism, func(client *awsEC2Client, account string) {
 		volumes, err := getAWSVolumes(account, client)
 		if err != nil {
 			handleAWSAccessDenied(account, err)
@@ -130,8 +164,9 @@ func (m *awsResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
 	log.Println("Getting snapshots in all accounts")
 	resultMap := make(map[string][]Snapshot)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
+	getAllEC2Resources(m.types.owners(m.accounts, ResourceTypeSnapshots), m.parallelism, func(client *awsEC2Client, account string) {
 		snapshots, err := getAWSSnapshots(account, client)
+		m.usage.enrichSnapshots(account, client, snapshots)
 		if err != nil {
 			handleAWSAccessDenied(account, err)
 		} else if len(snapshots) > 0 {
@@ -147,53 +182,10 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	log.Println("Getting all resources in all accounts")
 	resultMap := make(map[string]*ResourceCollection)
 	var resultMutext sync.Mutex
-	for i := range m.accounts {
-		resultMap[m.accounts[i]] = new(ResourceCollection)
-	}
-	// TODO: Smarter error handling. If one request get access denied, then might as
-	// well abort. The rest are going to fail too.
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
-		result := resultMap[account]
-		result.Owner = account
-		var wg sync.WaitGroup
-		wg.Add(4)
-		go func() {
-			snapshots, err := getAWSSnapshots(account, client)
-			if err != nil {
-				log.Printf("Snapshot error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
-			}
-			result.Snapshots = append(result.Snapshots, snapshots...)
-			wg.Done()
-		}()
-		go func() {
-			instances, err := getAWSInstances(account, client)
-			if err != nil {
-				log.Printf("Instance error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
-			}
-			result.Instances = append(result.Instances, instances...)
-			wg.Done()
-		}()
-		go func() {
-			images, err := getAWSImages(account, client)
-			if err != nil {
-				log.Printf("Image error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
-			}
-			result.Images = append(result.Images, images...)
-			wg.Done()
-		}()
-		go func() {
-			volumes, err := getAWSVolumes(account, client)
-			if err != nil {
-				log.Printf("Volume error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
-			}
-			result.Volumes = append(result.Volumes, volumes...)
-			wg.Done()
-		}()
-		wg.Wait()
+	sess := NewAWSSession()
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		result := getAWSAccountResources(sess, account, cred, m.inventory, m.usage, m.types)
+		m.tagging.enrich(account, cred, result, nil)
 		resultMutext.Lock()
 		resultMap[account] = result
 		resultMutext.Unlock()
@@ -203,206 +195,162 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 
 func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 	log.Println("Getting all buckets in all accounts")
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	resultMap := make(map[string][]Bucket)
 	var resultMutext sync.Mutex
-	forEachAccount(m.accounts, sess, func(account string, cred *credentials.Credentials) {
-		s3Client := s3.New(sess, &aws.Config{
-			Credentials: cred,
-			Region:      aws.String(defaultAWSRegion),
+	forEachAccount(m.types.owners(m.accounts, ResourceTypeBuckets), m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		buckets := getAWSBuckets(sess, account, cred, m.bucketReadDays)
+		if len(buckets) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = buckets
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
+}
+
+func (m *awsResourceManager) ForEachAccountResources(f func(*AllResourceCollection)) {
+	log.Println("Going through all resources in all accounts")
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		compute := getAWSAccountResources(sess, account, cred, m.inventory, m.usage, m.types)
+		buckets := []Bucket{}
+		if m.types.enabled(account, ResourceTypeBuckets) {
+			buckets = getAWSBuckets(sess, account, cred, m.bucketReadDays)
+		}
+		m.tagging.enrich(account, cred, compute, buckets)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(&AllResourceCollection{
+			Owner:     account,
+			Instances: compute.Instances,
+			Images:    compute.Images,
+			Volumes:   compute.Volumes,
+			Snapshots: compute.Snapshots,
+			Buckets:   buckets,
 		})
-		awsBuckets, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
+	})
+}
+
+func (m *awsResourceManager) ForEachInstance(f func(Instance)) {
+	accounts := m.types.owners(m.accounts, ResourceTypeInstances)
+	for _, account := range accounts {
+		instances, _ := m.inventory.accountInstances(account)
+		for i := range instances {
+			f(instances[i])
+		}
+	}
+	var funcMutex sync.Mutex // f must never be called concurrently
+	getAllEC2Resources(m.inventory.uncoveredInstances(accounts), m.parallelism, func(client *awsEC2Client, account string) {
+		instances, err := getAWSInstances(account, client)
 		if err != nil {
-			log.Printf("Bucket error when getting buckets in %s", account)
 			handleAWSAccessDenied(account, err)
-		} else if len(awsBuckets.Buckets) > 0 {
-			bucketCount := len(awsBuckets.Buckets)
-			buckChan := make(chan *awsBucket)
-			for _, bu := range awsBuckets.Buckets {
-				go func(bu *s3.Bucket, resChan chan *awsBucket) {
-					region, err := s3manager.GetBucketRegion(context.Background(), sess, *bu.Name, defaultAWSRegion)
-					if err != nil {
-						bucketCount--
-						log.Printf("Couldn't determine bucket region in %s for bucket %s", account, *bu.Name)
-						handleAWSAccessDenied(account, err)
-						buckChan <- nil
-						return
-					}
-					bucketClient := s3.New(sess, &aws.Config{
-						Credentials: cred,
-						Region:      aws.String(region),
-					})
-					buTags, err := bucketClient.GetBucketTagging(&s3.GetBucketTaggingInput{
-						Bucket: bu.Name,
-					})
-					// check for errors from tag call
-					if err != nil {
-						// if the error is an AWS type, handle based on type, otherwise panic as unknown type
-						if awsErr, ok := err.(awserr.Error); ok {
-							switch awsErr.Code() {
-							// S3 returns an error for "no tags found", log and continue
-							case "NoSuchTagSet":
-								log.Printf("No Tags for Bucket %s", *bu.Name)
-							// Any other AWS Error should cause a panic
-							default:
-								panic(fmt.Sprintf("AWS Error getting tags %+v", awsErr))
-							}
-						} else {
-							// Error isn't from AWS
-							panic(fmt.Sprintf("Unknown Error getting tags %+v", err))
-						}
-					}
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range instances {
+			f(instances[i])
+		}
+	})
+}
 
-					tags := convertAWSS3Tags(buTags.TagSet)
-
-					cw := cloudwatch.New(sess, &aws.Config{
-						Credentials: cred,
-						Region:      aws.String(region)})
-					storageTypeSizesGB := make(map[string]float64)
-					numberOfObjects := int64(0)
-
-					var input cloudwatch.GetMetricStatisticsInput
-					input.Namespace = aws.String("AWS/S3")
-					input.MetricName = aws.String("BucketSizeBytes")
-					input.StartTime = aws.Time(time.Now().Add(time.Duration(-48*60) * time.Minute))
-					input.EndTime = aws.Time(time.Now())
-					input.Period = aws.Int64(24 * 60 * 60)
-					input.Statistics = []*string{aws.String("Average")}
-					input.Unit = aws.String("Bytes")
-					dimensionNameFilter := cloudwatch.Dimension{
-						Name:  aws.String("BucketName"),
-						Value: bu.Name,
-					}
+func (m *awsResourceManager) ForEachImage(f func(Image)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	getAllEC2Resources(m.types.owners(m.accounts, ResourceTypeImages), m.parallelism, func(client *awsEC2Client, account string) {
+		images, err := getAWSImages(account, client)
+		m.usage.enrichImages(account, client, images)
+		if err != nil {
+			handleAWSAccessDenied(account, err)
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range images {
+			f(images[i])
+		}
+	})
+}
 
-					// Get sizes for all storage types
-					numBucketSizeDatapoints := 0
-					for _, storageType := range awsS3StorageTypes {
-						dimensionBucketSizeFilter := cloudwatch.Dimension{
-							Name:  aws.String("StorageType"),
-							Value: aws.String(storageType),
-						}
-						input.Dimensions = []*cloudwatch.Dimension{
-							&dimensionNameFilter, &dimensionBucketSizeFilter,
-						}
-						bucketSizeMetrics, err := cw.GetMetricStatistics(&input)
-						if err != nil {
-							fmt.Println("Error", err)
-						}
-						if bucketSizeMetrics != nil {
-							var minimumTimeDifference float64
-							var timeDifference float64
-							var averageValue *float64
-							minimumTimeDifference = -1
-							for _, datapoint := range bucketSizeMetrics.Datapoints {
-								timeDifference = time.Since(*datapoint.Timestamp).Seconds()
-								if minimumTimeDifference == -1 {
-									minimumTimeDifference = timeDifference
-									averageValue = datapoint.Average
-								} else if timeDifference < minimumTimeDifference {
-									minimumTimeDifference = timeDifference
-									averageValue = datapoint.Average
-								}
-							}
-							if averageValue != nil {
-								storageTypeSizesGB[storageType] = float64(*averageValue) / gbDivider
-							}
-							numBucketSizeDatapoints += len(bucketSizeMetrics.Datapoints)
-						}
-					}
+func (m *awsResourceManager) ForEachVolume(f func(Volume)) {
+	accounts := m.types.owners(m.accounts, ResourceTypeVolumes)
+	for _, account := range accounts {
+		volumes, _ := m.inventory.accountVolumes(account)
+		for i := range volumes {
+			f(volumes[i])
+		}
+	}
+	var funcMutex sync.Mutex // f must never be called concurrently
+	getAllEC2Resources(m.inventory.uncoveredVolumes(accounts), m.parallelism, func(client *awsEC2Client, account string) {
+		volumes, err := getAWSVolumes(account, client)
+		if err != nil {
+			handleAWSAccessDenied(account, err)
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range volumes {
+			f(volumes[i])
+		}
+	})
+}
 
-					// Update input to get numberOfObjects instead
-					input.MetricName = aws.String("NumberOfObjects")
-					dimensionNumberOfObjectsFilter := cloudwatch.Dimension{
-						Name:  aws.String("StorageType"),
-						Value: aws.String("AllStorageTypes"),
-					}
-					input.Dimensions = []*cloudwatch.Dimension{
-						&dimensionNameFilter, &dimensionNumberOfObjectsFilter,
-					}
-					input.Unit = aws.String("Count")
-					numberOfObjectsMetrics, err := cw.GetMetricStatistics(&input)
-					if err != nil {
-						fmt.Println("Error", err)
-					}
-					if numBucketSizeDatapoints == 0 && len(numberOfObjectsMetrics.Datapoints) != 0 {
-						fmt.Println("Warning: Got 0 datapoints from: ", *bu.Name)
-					}
-					if numberOfObjectsMetrics != nil {
-						var minimumTimeDifference float64
-						var timeDifference float64
-						var averageValue *float64
-						minimumTimeDifference = -1
-						for _, datapoint := range numberOfObjectsMetrics.Datapoints {
-							timeDifference = time.Since(*datapoint.Timestamp).Seconds()
-							if minimumTimeDifference == -1 {
-								minimumTimeDifference = timeDifference
-								averageValue = datapoint.Average
-							} else if timeDifference < minimumTimeDifference {
-								minimumTimeDifference = timeDifference
-								averageValue = datapoint.Average
-							}
-						}
-						if averageValue != nil {
-							numberOfObjects = int64(*averageValue)
-						}
-					}
+func (m *awsResourceManager) ForEachSnapshot(f func(Snapshot)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	getAllEC2Resources(m.types.owners(m.accounts, ResourceTypeSnapshots), m.parallelism, func(client *awsEC2Client, account string) {
+		snapshots, err := getAWSSnapshots(account, client)
+		m.usage.enrichSnapshots(account, client, snapshots)
+		if err != nil {
+			handleAWSAccessDenied(account, err)
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range snapshots {
+			f(snapshots[i])
+		}
+	})
+}
 
-					// TODO: this should be configurable instead of hardcoded to 6 + 1 months
-					lastMod := time.Now().AddDate(0, -7, 0)
-					err = bucketClient.ListObjectsV2Pages(&s3.ListObjectsV2Input{
-						Bucket: bu.Name, EncodingType: aws.String("url"),
-					}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
-						for _, object := range output.Contents {
-							// if object has been modified in the last 6 months
-							if time.Now().Before(object.LastModified.AddDate(0, 6, 0)) {
-								lastMod = time.Now().AddDate(0, -5, 0)
-								// exit early
-								return false
-							}
-						}
-						return !lastPage
-					})
-					if err != nil {
-						bucketCount--
-						log.Printf("Failed to list contents in bucket %s, account %s", *bu.Name, account)
-						handleAWSAccessDenied(account, err)
-						buckChan <- nil
-						return
-					}
+func (m *awsResourceManager) ForEachBucket(f func(Bucket)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	sess := NewAWSSession()
+	forEachAccount(m.types.owners(m.accounts, ResourceTypeBuckets), m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		buckets := getAWSBuckets(sess, account, cred, m.bucketReadDays)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range buckets {
+			f(buckets[i])
+		}
+	})
+}
 
-					totalSizeGB := 0.0
-					for _, size := range storageTypeSizesGB {
-						totalSizeGB += size
-					}
+func (m *awsResourceManager) ForEachResource(f func(Resource)) {
+	log.Println("Going through all resources in all accounts")
+	forEachResource(m, f)
+}
 
-					buck := awsBucket{baseBucket{
-						baseResource: baseResource{
-							csp:          AWS,
-							owner:        account,
-							location:     region,
-							id:           *bu.Name,
-							creationTime: *bu.CreationDate,
-							tags:         tags,
-						},
-						lastModified:       lastMod,
-						objectCount:        numberOfObjects,
-						totalSizeGB:        totalSizeGB,
-						storageTypeSizesGB: storageTypeSizesGB,
-					}}
-					buckChan <- &buck
-				}(bu, buckChan)
-			}
-			for i := 0; i < bucketCount; i++ {
-				buck := <-buckChan
-				if buck != nil {
-					resultMutext.Lock()
-					resultMap[account] = append(resultMap[account], buck)
-					resultMutext.Unlock()
-				}
+func (m *awsResourceManager) ForEachAccountSecurityGroups(f func(string, []SecurityGroup)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		groups := []SecurityGroup{}
+		var groupsMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			regionGroups, err := getAWSSecurityGroups(account, client)
+			if err != nil {
+				handleAWSAccessDenied(account, err)
+				return
 			}
-		}
+			groupsMutex.Lock()
+			defer groupsMutex.Unlock()
+			groups = append(groups, regionGroups...)
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, groups)
 	})
-	return resultMap
 }
 
 func (m *awsResourceManager) CleanupInstances(instances []Instance) error {
@@ -427,7 +375,7 @@ func (m *awsResourceManager) CleanupBuckets(buckets []Bucket) error {
 
 // getAWSInstances will get all running instances using an already
 // set-up client for a specific credential and region.
-func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
+func getAWSInstances(account string, client *awsEC2Client) ([]Instance, error) {
 	// We're only interested in running instances
 	input := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{{
@@ -441,25 +389,30 @@ func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
 	result := []Instance{}
 	for _, reservation := range awsReservations.Reservations {
 		for _, instance := range reservation.Instances {
-			inst := awsInstance{baseInstance{
+			inst := awsInstance{baseInstance: baseInstance{
 				baseResource: baseResource{
 					csp:          AWS,
 					owner:        account,
 					id:           *instance.InstanceId,
-					location:     *client.Config.Region,
+					location:     client.region,
 					creationTime: *instance.LaunchTime,
 					public:       instance.PublicIpAddress != nil,
 					tags:         convertAWSTags(instance.Tags)},
 				instanceType: *instance.InstanceType,
+				imageID:      aws.StringValue(instance.ImageId),
+				platform:     awsInstancePlatform(aws.StringValue(instance.Platform)),
+				tenancy:      awsInstanceTenancy(awsPlacementTenancy(instance.Placement)),
+				lifecycle:    awsInstanceLifecycle(aws.StringValue(instance.InstanceLifecycle)),
 			}}
 			result = append(result, &inst)
 		}
 	}
+	recordResources(AWS, ResourceTypeInstances, len(result))
 	return result, nil
 }
 
 // getAWSImages will get all AMIs owned by the current account
-func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
+func getAWSImages(account string, client *awsEC2Client) ([]Image, error) {
 	input := &ec2.DescribeImagesInput{
 		Owners: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
@@ -473,12 +426,12 @@ func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
 		if err != nil {
 			return nil, err
 		}
-		img := awsImage{baseImage{
+		img := awsImage{baseImage: baseImage{
 			baseResource: baseResource{
 				csp:          AWS,
 				owner:        account,
 				id:           *ami.ImageId,
-				location:     *client.Config.Region,
+				location:     client.region,
 				creationTime: ti,
 				public:       *ami.Public,
 				tags:         convertAWSTags(ami.Tags),
@@ -489,15 +442,20 @@ func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
 			if mapping != nil && (*mapping).Ebs != nil && (*(*mapping).Ebs).VolumeSize != nil {
 				img.baseImage.sizeGB += *mapping.Ebs.VolumeSize
 			}
+			if mapping != nil && mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+				img.snapshotIDs = append(img.snapshotIDs, *mapping.Ebs.SnapshotId)
+			}
 		}
+		img.sourceID, img.sourceRegion = parseAWSImageCopy(aws.StringValue(ami.Description))
 		result = append(result, &img)
 	}
+	recordResources(AWS, ResourceTypeImages, len(result))
 	return result, nil
 }
 
 // getAWSVolumes will get all volumes (both attached and un-attached)
 // in the current account
-func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
+func getAWSVolumes(account string, client *awsEC2Client) ([]Volume, error) {
 	input := new(ec2.DescribeVolumesInput)
 	awsVolumes, err := client.DescribeVolumes(input)
 	if err != nil {
@@ -506,12 +464,12 @@ func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
 	result := []Volume{}
 	for _, volume := range awsVolumes.Volumes {
 		inUse := len(volume.Attachments) > 0 || *volume.State == awsStateInUse
-		vol := awsVolume{baseVolume{
+		vol := awsVolume{baseVolume: baseVolume{
 			baseResource: baseResource{
 				csp:          AWS,
 				owner:        account,
 				id:           *volume.VolumeId,
-				location:     *client.Config.Region,
+				location:     client.region,
 				creationTime: *volume.CreateTime,
 				public:       false,
 				tags:         convertAWSTags(volume.Tags),
@@ -521,14 +479,20 @@ func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
 			encrypted:  *volume.Encrypted,
 			volumeType: *volume.VolumeType,
 		}}
+		for _, attachment := range volume.Attachments {
+			if id := aws.StringValue(attachment.InstanceId); id != "" {
+				vol.instanceIDs = append(vol.instanceIDs, id)
+			}
+		}
 		result = append(result, &vol)
 	}
+	recordResources(AWS, ResourceTypeVolumes, len(result))
 	return result, nil
 }
 
 // getAWSSnapshots will get all snapshots in AWS owned
 // by the current account
-func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
+func getAWSSnapshots(account string, client *awsEC2Client) ([]Snapshot, error) {
 	input := &ec2.DescribeSnapshotsInput{
 		OwnerIds: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
@@ -537,15 +501,18 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 		return nil, err
 	}
 	result := []Snapshot{}
-	snapshotsInUse := getSnapshotsInUse(client)
+	snapshotsInUse, err := getSnapshotsInUse(client)
+	if err != nil {
+		return nil, err
+	}
 	for _, snapshot := range awsSnapshots.Snapshots {
 		_, inUse := snapshotsInUse[*snapshot.SnapshotId]
-		snap := awsSnapshot{baseSnapshot{
+		snap := awsSnapshot{baseSnapshot: baseSnapshot{
 			baseResource: baseResource{
 				csp:          AWS,
 				owner:        account,
 				id:           *snapshot.SnapshotId,
-				location:     *client.Config.Region,
+				location:     client.region,
 				creationTime: *snapshot.StartTime,
 				public:       false,
 				tags:         convertAWSTags(snapshot.Tags),
@@ -553,21 +520,367 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 			sizeGB:    *snapshot.VolumeSize,
 			encrypted: *snapshot.Encrypted,
 			inUse:     inUse,
-		}}
+		}, volumeID: aws.StringValue(snapshot.VolumeId)}
 		result = append(result, &snap)
 	}
+	recordResources(AWS, ResourceTypeSnapshots, len(result))
 	return result, nil
 }
 
-func getSnapshotsInUse(client *ec2.EC2) map[string]struct{} {
+// getAWSSecurityGroups will get all security groups, and their
+// ingress rules, in the current account
+func getAWSSecurityGroups(account string, client *awsEC2Client) ([]SecurityGroup, error) {
+	result := []SecurityGroup{}
+	err := client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{}, func(page *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+		for _, group := range page.SecurityGroups {
+			rules := []IngressRule{}
+			for _, permission := range group.IpPermissions {
+				rule := IngressRule{
+					Protocol: aws.StringValue(permission.IpProtocol),
+					FromPort: aws.Int64Value(permission.FromPort),
+					ToPort:   aws.Int64Value(permission.ToPort),
+				}
+				for _, ipRange := range permission.IpRanges {
+					rule.CIDR = aws.StringValue(ipRange.CidrIp)
+					rules = append(rules, rule)
+				}
+				for _, ipRange := range permission.Ipv6Ranges {
+					rule.CIDR = aws.StringValue(ipRange.CidrIpv6)
+					rules = append(rules, rule)
+				}
+			}
+			result = append(result, &awsSecurityGroup{baseSecurityGroup{
+				baseResource: baseResource{
+					csp:      AWS,
+					owner:    account,
+					id:       *group.GroupId,
+					location: client.region,
+					public:   false,
+					tags:     convertAWSTags(group.Tags)},
+				name:         aws.StringValue(group.GroupName),
+				ingressRules: rules,
+			}})
+		}
+		return true
+	})
+	return result, err
+}
+
+// getAWSAccountResources will get all compute resources, in all
+// regions, of a single account. Resource types which are disabled in the
+// account are skipped.
+func getAWSAccountResources(sess *session.Session, account string, cred *credentials.Credentials, inventory *awsConfigInventory, usage *awsUsageLookup, types *resourceTypeSwitches) *ResourceCollection {
+	result := &ResourceCollection{Owner: account}
+	instancesEnabled := types.enabled(account, ResourceTypeInstances)
+	imagesEnabled := types.enabled(account, ResourceTypeImages)
+	volumesEnabled := types.enabled(account, ResourceTypeVolumes)
+	snapshotsEnabled := types.enabled(account, ResourceTypeSnapshots)
+	if !instancesEnabled && !imagesEnabled && !volumesEnabled && !snapshotsEnabled {
+		return result
+	}
+	instancesFromConfig, volumesFromConfig := false, false
+	if instancesEnabled {
+		var instances []Instance
+		instances, instancesFromConfig = inventory.accountInstances(account)
+		result.Instances = append(result.Instances, instances...)
+	}
+	if volumesEnabled {
+		var volumes []Volume
+		volumes, volumesFromConfig = inventory.accountVolumes(account)
+		result.Volumes = append(result.Volumes, volumes...)
+	}
+	var resultMutex sync.Mutex // Regions are processed in parallel
+	// TODO: Smarter error handling. If one request get access denied, then might as
+	// well abort. The rest are going to fail too.
+	forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+		var wg sync.WaitGroup
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			if !snapshotsEnabled {
+				return
+			}
+			snapshots, err := getAWSSnapshots(account, client)
+			usage.enrichSnapshots(account, client, snapshots)
+			if err != nil {
+				log.Printf("Snapshot error when getting all resources in %s", AccountDisplayName(account))
+				handleAWSAccessDenied(account, err)
+			}
+			resultMutex.Lock()
+			result.Snapshots = append(result.Snapshots, snapshots...)
+			resultMutex.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			if !instancesEnabled || instancesFromConfig {
+				return
+			}
+			instances, err := getAWSInstances(account, client)
+			if err != nil {
+				log.Printf("Instance error when getting all resources in %s", AccountDisplayName(account))
+				handleAWSAccessDenied(account, err)
+			}
+			resultMutex.Lock()
+			result.Instances = append(result.Instances, instances...)
+			resultMutex.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			if !imagesEnabled {
+				return
+			}
+			images, err := getAWSImages(account, client)
+			usage.enrichImages(account, client, images)
+			if err != nil {
+				log.Printf("Image error when getting all resources in %s", AccountDisplayName(account))
+				handleAWSAccessDenied(account, err)
+			}
+			resultMutex.Lock()
+			result.Images = append(result.Images, images...)
+			resultMutex.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			if !volumesEnabled || volumesFromConfig {
+				return
+			}
+			volumes, err := getAWSVolumes(account, client)
+			if err != nil {
+				log.Printf("Volume error when getting all resources in %s", AccountDisplayName(account))
+				handleAWSAccessDenied(account, err)
+			}
+			resultMutex.Lock()
+			result.Volumes = append(result.Volumes, volumes...)
+			resultMutex.Unlock()
+		}()
+		wg.Wait()
+	})
+	return result
+}
+
+// getAWSBuckets will get all S3 buckets of a single account. If readDays
+// is positive, the access logs of that many days are searched to find when
+// every bucket was last read.
+func getAWSBuckets(sess *session.Session, account string, cred *credentials.Credentials, readDays int) []Bucket {
+	result := []Bucket{}
+	s3Client := awsClients.S3(sess, cred, defaultAWSRegion)
+	awsBuckets, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		log.Printf("Bucket error when getting buckets in %s", AccountDisplayName(account))
+		handleAWSAccessDenied(account, err)
+	} else if len(awsBuckets.Buckets) > 0 {
+		bucketCount := len(awsBuckets.Buckets)
+		buckChan := make(chan *awsBucket)
+		for _, bu := range awsBuckets.Buckets {
+			go func(bu *s3.Bucket, resChan chan *awsBucket) {
+				region, err := AWSBucketRegion(*bu.Name)
+				if err != nil {
+					status.Warnf("Couldn't determine bucket region in %s for bucket %s", AccountDisplayName(account), *bu.Name)
+					handleAWSAccessDenied(account, err)
+					buckChan <- nil
+					return
+				}
+				bucketClient := awsClients.S3(sess, cred, region)
+				buTags, err := bucketClient.GetBucketTagging(&s3.GetBucketTaggingInput{
+					Bucket: bu.Name,
+				})
+				// check for errors from tag call
+				if err != nil {
+					if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchTagSet" {
+						// S3 returns an error for "no tags found", log and continue
+						log.Printf("No Tags for Bucket %s", *bu.Name)
+					} else {
+						// The bucket is skipped, rather than crashing every
+						// other scope, e.g. if its account timed out
+						status.Warnf("Failed to get the tags of bucket %s, account %s", *bu.Name, AccountDisplayName(account))
+						handleAWSAccessDenied(account, err)
+						buckChan <- nil
+						return
+					}
+				}
+
+				tags := convertAWSS3Tags(buTags.TagSet)
+
+				cw := cloudwatch.New(sess, &aws.Config{
+					Credentials: cred,
+					Region:      aws.String(region)})
+				storageTypeSizesGB := make(map[string]float64)
+				numberOfObjects := int64(0)
+
+				var input cloudwatch.GetMetricStatisticsInput
+				input.Namespace = aws.String("AWS/S3")
+				input.MetricName = aws.String("BucketSizeBytes")
+				input.StartTime = aws.Time(time.Now().Add(time.Duration(-48*60) * time.Minute))
+				input.EndTime = aws.Time(time.Now())
+				input.Period = aws.Int64(24 * 60 * 60)
+				input.Statistics = []*string{aws.String("Average")}
+				input.Unit = aws.String("Bytes")
+				dimensionNameFilter := cloudwatch.Dimension{
+					Name:  aws.String("BucketName"),
+					Value: bu.Name,
+				}
+
+				// Get sizes for all storage types
+				numBucketSizeDatapoints := 0
+				for _, storageType := range awsS3StorageTypes {
+					dimensionBucketSizeFilter := cloudwatch.Dimension{
+						Name:  aws.String("StorageType"),
+						Value: aws.String(storageType),
+					}
+					input.Dimensions = []*cloudwatch.Dimension{
+						&dimensionNameFilter, &dimensionBucketSizeFilter,
+					}
+					bucketSizeMetrics, err := cw.GetMetricStatistics(&input)
+					if err != nil {
+						fmt.Println("Error", err)
+					}
+					if bucketSizeMetrics != nil {
+						var minimumTimeDifference float64
+						var timeDifference float64
+						var averageValue *float64
+						minimumTimeDifference = -1
+						for _, datapoint := range bucketSizeMetrics.Datapoints {
+							timeDifference = time.Since(*datapoint.Timestamp).Seconds()
+							if minimumTimeDifference == -1 {
+								minimumTimeDifference = timeDifference
+								averageValue = datapoint.Average
+							} else if timeDifference < minimumTimeDifference {
+								minimumTimeDifference = timeDifference
+								averageValue = datapoint.Average
+							}
+						}
+						if averageValue != nil {
+							storageTypeSizesGB[storageType] = float64(*averageValue) / gbDivider
+						}
+						numBucketSizeDatapoints += len(bucketSizeMetrics.Datapoints)
+					}
+				}
+
+				// Update input to get numberOfObjects instead
+				input.MetricName = aws.String("NumberOfObjects")
+				dimensionNumberOfObjectsFilter := cloudwatch.Dimension{
+					Name:  aws.String("StorageType"),
+					Value: aws.String("AllStorageTypes"),
+				}
+				input.Dimensions = []*cloudwatch.Dimension{
+					&dimensionNameFilter, &dimensionNumberOfObjectsFilter,
+				}
+				input.Unit = aws.String("Count")
+				numberOfObjectsMetrics, err := cw.GetMetricStatistics(&input)
+				if err != nil {
+					fmt.Println("Error", err)
+				}
+				if numBucketSizeDatapoints == 0 && len(numberOfObjectsMetrics.Datapoints) != 0 {
+					fmt.Println("Warning: Got 0 datapoints from: ", *bu.Name)
+				}
+				if numberOfObjectsMetrics != nil {
+					var minimumTimeDifference float64
+					var timeDifference float64
+					var averageValue *float64
+					minimumTimeDifference = -1
+					for _, datapoint := range numberOfObjectsMetrics.Datapoints {
+						timeDifference = time.Since(*datapoint.Timestamp).Seconds()
+						if minimumTimeDifference == -1 {
+							minimumTimeDifference = timeDifference
+							averageValue = datapoint.Average
+						} else if timeDifference < minimumTimeDifference {
+							minimumTimeDifference = timeDifference
+							averageValue = datapoint.Average
+						}
+					}
+					if averageValue != nil {
+						numberOfObjects = int64(*averageValue)
+					}
+				}
+
+				// TODO: this should be configurable instead of hardcoded to 6 + 1 months
+				lastMod := time.Now().AddDate(0, -7, 0)
+				empty := true
+				err = bucketClient.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+					Bucket: bu.Name, EncodingType: aws.String("url"),
+				}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+					if len(output.Contents) > 0 {
+						empty = false
+					}
+					for _, object := range output.Contents {
+						// if object has been modified in the last 6 months
+						if time.Now().Before(object.LastModified.AddDate(0, 6, 0)) {
+							lastMod = time.Now().AddDate(0, -5, 0)
+							// exit early
+							return false
+						}
+					}
+					return !lastPage
+				})
+				if err != nil {
+					status.Warnf("Failed to list contents in bucket %s, account %s", *bu.Name, AccountDisplayName(account))
+					handleAWSAccessDenied(account, err)
+					buckChan <- nil
+					return
+				}
+
+				if empty {
+					empty, err = awsBucketHasNoVersions(bucketClient, *bu.Name)
+					if err != nil {
+						status.Warnf("Failed to list versions in bucket %s, account %s: %s", *bu.Name, AccountDisplayName(account), err)
+					}
+				}
+
+				lastRead := time.Time{}
+				if readDays > 0 {
+					lastRead, err = getAWSBucketLastRead(bucketClient, account, region, *bu.Name, time.Now().AddDate(0, 0, -readDays))
+					if err != nil {
+						status.Warnf("Failed to read access logs of bucket %s, account %s: %s", *bu.Name, AccountDisplayName(account), err)
+					}
+				}
+
+				totalSizeGB := 0.0
+				for _, size := range storageTypeSizesGB {
+					totalSizeGB += size
+				}
+
+				buck := awsBucket{baseBucket{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						location:     region,
+						id:           *bu.Name,
+						creationTime: *bu.CreationDate,
+						tags:         tags,
+					},
+					lastModified:       lastMod,
+					lastRead:           lastRead,
+					objectCount:        numberOfObjects,
+					totalSizeGB:        totalSizeGB,
+					storageTypeSizesGB: storageTypeSizesGB,
+					empty:              empty,
+				}}
+				buckChan <- &buck
+			}(bu, buckChan)
+		}
+		for i := 0; i < bucketCount; i++ {
+			buck := <-buckChan
+			if buck != nil {
+				result = append(result, buck)
+			}
+		}
+	}
+	recordResources(AWS, ResourceTypeBuckets, len(result))
+	return result
+}
+
+func getSnapshotsInUse(client *awsEC2Client) (map[string]struct{}, error) {
 	result := make(map[string]struct{})
 	input := &ec2.DescribeImagesInput{
 		Owners: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
 	images, err := client.DescribeImages(input)
-	if err != nil {
-		log.Printf("Could not determine snapshots in use:\n%s\n", err)
-		return result
+	if isAWSScopeTimeout(err) {
+		// Every snapshot would look unused
+		return nil, err
+	} else if err != nil {
+		status.Warnf("Could not determine snapshots in use:\n%s\n", err)
+		return result, nil
 	}
 	for _, imgs := range images.Images {
 		for _, mapping := range imgs.BlockDeviceMappings {
@@ -576,70 +889,177 @@ func getSnapshotsInUse(client *ec2.EC2) map[string]struct{} {
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
-func getAllEC2Resources(accounts []string, funcToRun func(client *ec2.EC2, account string)) {
-	sess := session.Must(session.NewSession())
-	forEachAccount(accounts, sess, func(account string, cred *credentials.Credentials) {
-		log.Println("Accessing account", account)
-		forEachAWSRegion(func(region string) {
+func getAllEC2Resources(accounts []string, parallelism int, funcToRun func(client *awsEC2Client, account string)) {
+	sess := NewAWSSession()
+	forEachAccount(accounts, parallelism, sess, func(account string, cred *credentials.Credentials) {
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			funcToRun(client, account)
+		})
+	})
+}
+
+// forEachEC2Client is a higher order function that will, for every
+// enabled region, create an EC2 client for the specified account and
+// call the specified function with that client
+func forEachEC2Client(sess *session.Session, account string, cred *credentials.Credentials, funcToRun func(client *awsEC2Client)) {
+	log.Println("Accessing account", AccountDisplayName(account))
+	regions, err := awsEnabledRegions(sess, cred)
+	if err != nil {
+		status.Warnf("Could not list the enabled regions in %s, checking every region instead: %s", AccountDisplayName(account), err)
+		regions = probeAWSRegions(sess, cred)
+	}
+	forEachAWSRegion(orderAWSRegions(account, regions), func(region string) {
+		awsTimeouts.runRegion(cred, region, AccountDisplayName(account), func() {
+			funcToRun(newAWSEC2Client(sess, cred, region))
+		})
+	})
+}
+
+// awsEnabledRegions returns the regions enabled in an account, which are
+// the regions that don't require opting in, and the opt-in regions, such
+// as me-south-1, that the account has opted in to
+func awsEnabledRegions(sess *session.Session, cred *credentials.Credentials) ([]string, error) {
+	client := awsClients.EC2(sess, cred, defaultAWSRegion)
+	output, err := client.DescribeRegions(&ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)})
+	if err != nil {
+		return nil, err
+	}
+	regions := []string{}
+	for _, region := range output.Regions {
+		regions = append(regions, aws.StringValue(region.RegionName))
+	}
+	return regions, nil
+}
+
+// probeAWSRegions returns the regions enabled in an account by making a
+// call in every known region, which fails in disabled regions
+func probeAWSRegions(sess *session.Session, cred *credentials.Credentials) []string {
+	known, exists := endpoints.RegionsForService(endpoints.DefaultPartitions(), endpoints.AwsPartitionID, endpoints.Ec2ServiceID)
+	if !exists {
+		panic("The regions for EC2 in the standard partition should exist")
+	}
+	regions := []string{}
+	var regionsMutex sync.Mutex
+	var wg sync.WaitGroup
+	for regionID := range known {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
 			// Check if region is enabled by making a call that we should always have permissions for
-			stsClient := sts.New(sess, &aws.Config{
-				Credentials: cred,
-				Region:      aws.String(region),
-			})
+			stsClient := awsClients.STS(sess, cred, region)
 			_, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
-			if err != nil {
+			if isAWSScopeTimeout(err) {
+				return
+			} else if err != nil {
 				// Ensure that we can make the default call, otherwise we have other problems
-				stsClient = sts.New(sess, &aws.Config{
-					Credentials: cred,
-				})
+				stsClient = awsClients.STS(sess, cred, "")
 				_, err = stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 				if err == nil {
 					log.Printf("Region %s is disabled, skipping it!", region)
 					return
 				}
-				log.Fatalf("Unknown AWS error %s", err)
-
+				status.DiscoveryFatalf("Unknown AWS error %s", err)
 			}
-			client := ec2.New(sess, &aws.Config{
-				Credentials: cred,
-				Region:      aws.String(region),
-			})
-			funcToRun(client, account)
-		})
-	})
+			regionsMutex.Lock()
+			defer regionsMutex.Unlock()
+			regions = append(regions, region)
+		}(regionID)
+	}
+	wg.Wait()
+	return regions
+}
+
+// orderAWSRegions sorts the regions, and rotates them by an offset
+// derived from the account. Accounts processed at the same time then
+// start in different regions, which spreads their requests over the
+// regional endpoints and makes throttling less likely when the number of
+// regions processed at the same time is limited.
+func orderAWSRegions(account string, regions []string) []string {
+	if len(regions) == 0 {
+		return regions
+	}
+	sorted := append([]string{}, regions...)
+	sort.Strings(sorted)
+	hash := fnv.New32a()
+	hash.Write([]byte(account))
+	offset := int(hash.Sum32() % uint32(len(sorted)))
+	return append(sorted[offset:], sorted[:offset]...)
 }
 
 // forEachAccount is a higher order function that will, for
 // every account, create credentials and call the specified
-// function with those creds
-func forEachAccount(accounts []string, sess *session.Session, funcToRun func(account string, cred *credentials.Credentials)) {
+// function with those creds. At most parallelism accounts are
+// processed at the same time, unless it's zero or less. Requests
+// made with the creds are canceled if the account times out.
+func forEachAccount(accounts []string, parallelism int, sess *session.Session, funcToRun func(account string, cred *credentials.Credentials)) {
 	var wg sync.WaitGroup
+	limit := newLimiter(parallelism)
+	addAWSScopeHandler(sess)
 	for i := range accounts {
 		wg.Add(1)
+		limit.acquire()
 		go func(x int) {
-			creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, accounts[x]))
-			funcToRun(accounts[x], creds)
+			creds := awsAccountCredentials(sess, accounts[x])
+			awsTimeouts.runAccount(creds, AccountDisplayName(accounts[x]), func() {
+				funcToRun(accounts[x], creds)
+			})
+			limit.release()
 			wg.Done()
 		}(i)
 	}
 	wg.Wait()
 }
 
-// forEachAWSRegion is a higher order function that will, for
-// every available AWS region, run the specified function
-func forEachAWSRegion(funcToRun func(region string)) {
-	regions, exists := endpoints.RegionsForService(endpoints.DefaultPartitions(), endpoints.AwsPartitionID, endpoints.Ec2ServiceID)
-	if !exists {
-		panic("The regions for EC2 in the standard partition should exist")
+// awsAccountCredentials returns the credentials used to access an
+// account, which assume the Cloudsweeper role in the account unless
+// the default credentials should be used. Every account gets credentials
+// of its own, since the timeouts of accounts are tracked by them.
+func awsAccountCredentials(sess *session.Session, account string) *credentials.Credentials {
+	if awsUseOwnCredentials {
+		return credentials.NewCredentials(&awsSharedCredentials{sess.Config.Credentials})
+	}
+	return stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, account))
+}
+
+// awsSharedCredentials provides the values of credentials shared by
+// several accounts
+type awsSharedCredentials struct {
+	shared *credentials.Credentials
+}
+
+func (c *awsSharedCredentials) Retrieve() (credentials.Value, error) {
+	return c.shared.Get()
+}
+
+func (c *awsSharedCredentials) IsExpired() bool {
+	return c.shared.IsExpired()
+}
+
+// AWSCallerAccount returns the ID of the account which the default AWS
+// credentials, such as the ones of the user running Cloudsweeper, belong to
+func AWSCallerAccount() (string, error) {
+	identity, err := awsClients.STS(NewAWSSession(), nil, "").GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
 	}
+	return aws.StringValue(identity.Account), nil
+}
+
+// forEachAWSRegion is a higher order function that will, in order, run
+// the specified function for every region. At most awsRegionParallelism
+// regions are processed at the same time, unless it's zero or less.
+func forEachAWSRegion(regions []string, funcToRun func(region string)) {
 	var wg sync.WaitGroup
-	for regionID := range regions {
+	limit := newLimiter(awsRegionParallelism)
+	for _, regionID := range regions {
 		wg.Add(1)
+		limit.acquire()
 		go func(x string) {
 			funcToRun(x)
+			limit.release()
 			wg.Done()
 		}(regionID)
 	}
@@ -647,21 +1067,25 @@ func forEachAWSRegion(funcToRun func(region string)) {
 }
 
 func handleAWSAccessDenied(account string, err error) {
+	if isAWSScopeTimeout(err) {
+		// Recorded once the account or region is given up on
+		return
+	}
 	// Cast err to awserr.Error to handle specific AWS errors
 	aerr, ok := err.(awserr.Error)
 	if ok && aerr.Code() == accessDeniedErrorCode {
 		// The account does not have the role setup correctly
-		log.Printf("The account '%s' denied access\n", account)
+		status.DiscoveryFailedf("The account '%s' denied access\n", AccountDisplayName(account))
 	} else if ok && aerr.Code() == unauthorizedErrorCode {
-		log.Printf("Unauthorized to assume '%s'\n", account)
+		status.DiscoveryFailedf("Unauthorized to assume '%s'\n", AccountDisplayName(account))
 	} else if ok && aerr.Code() == notFoundErrorOcde {
-		log.Printf("Resource was not found in account %s", account)
+		status.Warnf("Resource was not found in account %s", AccountDisplayName(account))
 	} else if ok {
 		// Some other AWS error occured
-		log.Fatalf("Got AWS error in account %s: %s", account, aerr)
+		status.DiscoveryFatalf("Got AWS error in account %s: %s", AccountDisplayName(account), aerr)
 	} else {
 		//Some other non-AWS error occured
-		log.Fatalf("Got error in account %s: %s", account, err)
+		status.DiscoveryFatalf("Got error in account %s: %s", AccountDisplayName(account), err)
 	}
 }
 
@@ -681,16 +1105,47 @@ func convertAWSS3Tags(tags []*s3.Tag) map[string]string {
 	return result
 }
 
-func clientForAWSResource(res Resource) *ec2.EC2 {
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, res.Owner()))
-	return ec2.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(res.Location()),
-	})
+// copyAWSSnapshotEncrypted copies a snapshot within its region with
+// encryption enabled, using the default EBS key of the account
+func copyAWSSnapshotEncrypted(client *awsEC2Client, snapshotID, description string, tags map[string]string) (string, error) {
+	input := &ec2.CopySnapshotInput{
+		Description:      aws.String(description),
+		Encrypted:        aws.Bool(true),
+		SourceRegion:     aws.String(client.region),
+		SourceSnapshotId: aws.String(snapshotID),
+	}
+	if ec2Tags := convertToAWSTags(tags); len(ec2Tags) > 0 {
+		input.TagSpecifications = []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+			Tags:         ec2Tags,
+		}}
+	}
+	output, err := client.CopySnapshot(input)
+	if err != nil {
+		return "", err
+	}
+	return *output.SnapshotId, nil
+}
+
+// convertToAWSTags converts tags to EC2 tags, skipping keys reserved by AWS
+func convertToAWSTags(tags map[string]string) []*ec2.Tag {
+	result := []*ec2.Tag{}
+	for key, value := range tags {
+		if strings.HasPrefix(key, "aws:") {
+			continue
+		}
+		result = append(result, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return result
+}
+
+func clientForAWSResource(res Resource) *awsEC2Client {
+	sess := NewAWSSession()
+	return newAWSEC2Client(sess, awsAccountCredentials(sess, res.Owner()), res.Location())
 }
 
 func addAWSTag(r Resource, key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
 	_, exist := r.Tags()[key]
 	if exist && !overwrite {
 		return fmt.Errorf("Key %s already exist on %s", key, r.ID())
@@ -708,10 +1163,11 @@ func addAWSTag(r Resource, key, value string, overwrite bool) error {
 }
 
 func removeAWSTag(r Resource, key string) error {
-	val, exist := r.Tags()[key]
+	key, exist := Tags(r.Tags()).Key(key)
 	if !exist {
 		return nil
 	}
+	val := r.Tags()[key]
 	client := clientForAWSResource(r)
 	input := &ec2.DeleteTagsInput{
 		Resources: aws.StringSlice([]string{r.ID()}),
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// AWSClients builds the EC2, S3 and STS clients used to access a region
+// of an account. The session is the one of the manager, and the
+// credentials are the ones of the account. Tests can build clients which
+// simulate throttling, denied access or failures of some of the calls,
+// by embedding the interfaces of the API and overriding the calls made.
+type AWSClients interface {
+	EC2(sess *session.Session, cred *credentials.Credentials, region string) ec2iface.EC2API
+	S3(sess *session.Session, cred *credentials.Credentials, region string) s3iface.S3API
+	// STS builds an STS client for the region, or the global endpoint if
+	// the region is empty
+	STS(sess *session.Session, cred *credentials.Credentials, region string) stsiface.STSAPI
+}
+
+// awsSDKClients builds the clients of the AWS SDK
+type awsSDKClients struct{}
+
+func (awsSDKClients) EC2(sess *session.Session, cred *credentials.Credentials, region string) ec2iface.EC2API {
+	return ec2.New(sess, &aws.Config{
+		Credentials: cred,
+		Region:      aws.String(region),
+		MaxRetries:  aws.Int(awsMaxRequestRetries),
+	})
+}
+
+func (awsSDKClients) S3(sess *session.Session, cred *credentials.Credentials, region string) s3iface.S3API {
+	return s3.New(sess, &aws.Config{
+		Credentials: cred,
+		Region:      aws.String(region),
+	})
+}
+
+func (awsSDKClients) STS(sess *session.Session, cred *credentials.Credentials, region string) stsiface.STSAPI {
+	config := &aws.Config{Credentials: cred}
+	if region != "" {
+		config.Region = aws.String(region)
+	}
+	return sts.New(sess, config)
+}
+
+// awsClients builds every EC2, S3 and STS client used by the AWS manager
+// and its resources
+var awsClients AWSClients = awsSDKClients{}
+
+// awsEC2Client is an EC2 client for a region of an account, which knows
+// the region and credentials it was built with
+type awsEC2Client struct {
+	ec2iface.EC2API
+	region string
+	cred   *credentials.Credentials
+}
+
+func newAWSEC2Client(sess *session.Session, cred *credentials.Credentials, region string) *awsEC2Client {
+	return &awsEC2Client{
+		EC2API: awsClients.EC2(sess, cred, region),
+		region: region,
+		cred:   cred,
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+const testAccount = "123456789012"
+
+// testEC2 simulates the EC2 API in a region. Calls which aren't
+// overridden panic, since the embedded interface is nil.
+type testEC2 struct {
+	ec2iface.EC2API
+	region  string
+	clients *testAWSClients
+}
+
+func (c *testEC2) DescribeRegions(*ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+	output := &ec2.DescribeRegionsOutput{}
+	for _, region := range c.clients.regions {
+		output.Regions = append(output.Regions, &ec2.Region{RegionName: aws.String(region)})
+	}
+	return output, nil
+}
+
+func (c *testEC2) DescribeInstances(*ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	if err, failing := c.clients.failures[c.region]; failing {
+		return nil, err
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{
+		Instances: []*ec2.Instance{{
+			InstanceId:   aws.String("i-" + c.region),
+			InstanceType: aws.String("t3.micro"),
+			LaunchTime:   aws.Time(time.Now()),
+		}},
+	}}}, nil
+}
+
+func (c *testEC2) DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error) {
+	c.clients.mutex.Lock()
+	defer c.clients.mutex.Unlock()
+	c.clients.deleteCalls++
+	if c.clients.deleteCalls <= c.clients.throttledDeletes {
+		return nil, awserr.New(requestLimitErrorCode, "Request limit exceeded", nil)
+	}
+	if err, failing := c.clients.failures[c.region]; failing {
+		return nil, err
+	}
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+// testS3 simulates the S3 API in a region, listing the buckets of the
+// clients. Calls which aren't overridden panic.
+type testS3 struct {
+	s3iface.S3API
+	region  string
+	clients *testAWSClients
+}
+
+func (c *testS3) ListBuckets(*s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	output := &s3.ListBucketsOutput{}
+	for _, bucket := range c.clients.buckets {
+		output.Buckets = append(output.Buckets, &s3.Bucket{Name: aws.String(bucket), CreationDate: aws.Time(time.Now())})
+	}
+	return output, nil
+}
+
+func (c *testS3) GetBucketTagging(*s3.GetBucketTaggingInput) (*s3.GetBucketTaggingOutput, error) {
+	if err, failing := c.clients.failures[c.region]; failing {
+		return nil, err
+	}
+	return &s3.GetBucketTaggingOutput{}, nil
+}
+
+// testAWSClients builds EC2 and S3 clients which fail every call in some
+// regions, and throttle the first deletes
+type testAWSClients struct {
+	regions          []string
+	buckets          []string
+	failures         map[string]error
+	throttledDeletes int
+
+	mutex       sync.Mutex
+	deleteCalls int
+}
+
+func (c *testAWSClients) EC2(sess *session.Session, cred *credentials.Credentials, region string) ec2iface.EC2API {
+	return &testEC2{region: region, clients: c}
+}
+
+func (c *testAWSClients) S3(sess *session.Session, cred *credentials.Credentials, region string) s3iface.S3API {
+	return &testS3{region: region, clients: c}
+}
+
+func (c *testAWSClients) STS(sess *session.Session, cred *credentials.Credentials, region string) stsiface.STSAPI {
+	return nil
+}
+
+// newTestAWSManager returns a manager using the clients. The globals the
+// manager sets are restored when the test is done, so later tests don't
+// use the clients.
+func newTestAWSManager(t *testing.T, clients *testAWSClients) ResourceManager {
+	ownCredentials, regionParallelism, releaseElasticIPs := awsUseOwnCredentials, awsRegionParallelism, awsReleaseElasticIPs
+	previousClients, timeouts := awsClients, awsTimeouts
+	t.Cleanup(func() {
+		awsUseOwnCredentials, awsRegionParallelism, awsReleaseElasticIPs = ownCredentials, regionParallelism, releaseElasticIPs
+		awsClients, awsTimeouts = previousClients, timeouts
+	})
+	mngr, err := NewManagerWithConfig(AWS, &ManagerConfig{AWSClients: clients}, testAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mngr
+}
+
+func TestAWSPartialDiscoveryFailure(t *testing.T) {
+	status.Reset()
+	defer status.Reset()
+
+	mngr := newTestAWSManager(t, &testAWSClients{
+		regions: []string{"us-east-1", "eu-west-1", "ap-south-1"},
+		failures: map[string]error{
+			"eu-west-1":  awserr.New(accessDeniedErrorCode, "Access denied", nil),
+			"ap-south-1": awserr.New(requestLimitErrorCode, "Request limit exceeded", nil),
+		},
+	})
+	instances := mngr.InstancesPerAccount()[testAccount]
+	if len(instances) != 1 || instances[0].Location() != "us-east-1" {
+		t.Fatalf("Expected only the instance in us-east-1, got %d instances", len(instances))
+	}
+	if count := status.Count(status.DiscoveryFailure); count != 2 {
+		t.Errorf("Expected 2 discovery failures, got %d", count)
+	}
+}
+
+func TestAWSThrottledCleanup(t *testing.T) {
+	clients := &testAWSClients{throttledDeletes: 1}
+	mngr := newTestAWSManager(t, clients)
+	vol := &awsVolume{baseVolume: baseVolume{baseResource: baseResource{csp: AWS, owner: testAccount, id: "vol-1", location: "us-east-1"}}}
+	if err := mngr.CleanupVolumes([]Volume{vol}); err != nil {
+		t.Errorf("Expected the throttled delete to be retried, got %s", err)
+	}
+	if clients.deleteCalls != 2 {
+		t.Errorf("Expected the volume to be deleted on the second try, got %d calls", clients.deleteCalls)
+	}
+}
+
+func TestAWSDeniedCleanup(t *testing.T) {
+	mngr := newTestAWSManager(t, &testAWSClients{
+		failures: map[string]error{"us-east-1": awserr.New(unauthorizedErrorCode, "Unauthorized", nil)},
+	})
+	vol := &awsVolume{baseVolume: baseVolume{baseResource: baseResource{csp: AWS, owner: testAccount, id: "vol-1", location: "us-east-1"}}}
+	if err := mngr.CleanupVolumes([]Volume{vol}); err == nil {
+		t.Error("Expected the denied delete to fail")
+	}
+}
+
+func TestAWSCanceledBucketDiscovery(t *testing.T) {
+	status.Reset()
+	defer status.Reset()
+
+	newTestAWSManager(t, &testAWSClients{
+		buckets:  []string{"canceled-bucket"},
+		failures: map[string]error{"eu-west-1": awserr.New(request.CanceledErrorCode, "Request canceled", nil)},
+	})
+	bucketRegionsMutex.Lock()
+	bucketRegions["canceled-bucket"] = "eu-west-1"
+	bucketRegionsMutex.Unlock()
+	defer func() {
+		bucketRegionsMutex.Lock()
+		delete(bucketRegions, "canceled-bucket")
+		bucketRegionsMutex.Unlock()
+	}()
+
+	buckets := getAWSBuckets(NewAWSSession(), testAccount, nil, 0)
+	if len(buckets) != 0 {
+		t.Errorf("Expected the bucket whose request was canceled to be skipped, got %d buckets", len(buckets))
+	}
+	// The timeout of the scope is recorded once it's given up on
+	if count := status.Count(status.DiscoveryFailure); count != 0 {
+		t.Errorf("Expected the canceled request not to be recorded on its own, got %d discovery failures", count)
+	}
+}
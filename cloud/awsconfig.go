@@ -0,0 +1,340 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/configservice"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	awsConfigPageSize = 100
+
+	awsConfigAccountsQuery = "SELECT accountId, resourceType, COUNT(*) WHERE resourceType IN ('AWS::EC2::Instance', 'AWS::EC2::Volume') GROUP BY accountId, resourceType"
+	awsConfigInstanceType  = "AWS::EC2::Instance"
+	awsConfigVolumeType    = "AWS::EC2::Volume"
+
+	awsConfigInstancesQuery = "SELECT accountId, awsRegion, resourceId, tags, configuration.instanceType, configuration.imageId, configuration.platform, configuration.placement.tenancy, configuration.instanceLifecycle, configuration.launchTime, configuration.publicIpAddress WHERE resourceType = 'AWS::EC2::Instance' AND configuration.state.name = 'running'"
+	awsConfigVolumesQuery   = "SELECT accountId, awsRegion, resourceId, tags, configuration.size, configuration.volumeType, configuration.encrypted, configuration.state, configuration.attachments, configuration.createTime WHERE resourceType = 'AWS::EC2::Volume'"
+)
+
+// awsConfigInventory reads instances and volumes of all accounts from
+// an AWS Config aggregator in the master account. Config doesn't record
+// AMIs or snapshots, and S3 sizes need CloudWatch anyway, so those are
+// always fetched using the EC2 and S3 APIs. The instances or volumes of
+// accounts which haven't recorded any of them in the aggregator are
+// fetched using the APIs too. The aggregator can be hours behind, so the
+// tags of resources read from it are read again before they are deleted.
+type awsConfigInventory struct {
+	client     *configservice.ConfigService
+	aggregator string
+
+	once   sync.Once
+	loaded bool
+	// recorded are the resource types recorded in the aggregator for
+	// every account
+	recorded  map[string]map[string]bool
+	instances map[string][]Instance
+	volumes   map[string][]Volume
+}
+
+type awsConfigTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type awsConfigResource struct {
+	AccountID    string         `json:"accountId"`
+	AWSRegion    string         `json:"awsRegion"`
+	ResourceID   string         `json:"resourceId"`
+	ResourceType string         `json:"resourceType"`
+	Tags         []awsConfigTag `json:"tags"`
+}
+
+type awsConfigInstance struct {
+	awsConfigResource
+	Configuration struct {
+		InstanceType      string    `json:"instanceType"`
+		ImageID           string    `json:"imageId"`
+		Platform          string    `json:"platform"`
+		InstanceLifecycle string    `json:"instanceLifecycle"`
+		LaunchTime        time.Time `json:"launchTime"`
+		PublicIPAddress   string    `json:"publicIpAddress"`
+		Placement         struct {
+			Tenancy string `json:"tenancy"`
+		} `json:"placement"`
+	} `json:"configuration"`
+}
+
+type awsConfigAttachment struct {
+	InstanceID string `json:"instanceId"`
+}
+
+type awsConfigVolume struct {
+	awsConfigResource
+	Configuration struct {
+		Size        int64                 `json:"size"`
+		VolumeType  string                `json:"volumeType"`
+		Encrypted   bool                  `json:"encrypted"`
+		State       string                `json:"state"`
+		Attachments []awsConfigAttachment `json:"attachments"`
+		CreateTime  time.Time             `json:"createTime"`
+	} `json:"configuration"`
+}
+
+func newAWSConfigInventory(aggregator, region string) *awsConfigInventory {
+	if aggregator == "" {
+		return nil
+	}
+	if region == "" {
+		region = defaultAWSRegion
+	}
+	sess := NewAWSSession()
+	return &awsConfigInventory{
+		client:     configservice.New(sess, &aws.Config{Region: aws.String(region)}),
+		aggregator: aggregator,
+	}
+}
+
+// load queries the aggregator once. If any query fails, nothing from
+// the aggregator is used, and all accounts fall back to the APIs.
+func (inv *awsConfigInventory) load() {
+	inv.once.Do(func() {
+		log.Printf("Reading inventory from AWS Config aggregator %s", inv.aggregator)
+		recorded := make(map[string]map[string]bool)
+		err := inv.query(awsConfigAccountsQuery, func(raw []byte) error {
+			var res awsConfigResource
+			if err := json.Unmarshal(raw, &res); err != nil {
+				return err
+			}
+			if recorded[res.AccountID] == nil {
+				recorded[res.AccountID] = make(map[string]bool)
+			}
+			recorded[res.AccountID][res.ResourceType] = true
+			return nil
+		})
+		if err != nil {
+			status.Warnf("Could not list accounts in aggregator %s, using EC2 APIs instead: %s", inv.aggregator, err)
+			return
+		}
+
+		instances := make(map[string][]Instance)
+		err = inv.query(awsConfigInstancesQuery, func(raw []byte) error {
+			var res awsConfigInstance
+			if err := json.Unmarshal(raw, &res); err != nil {
+				return err
+			}
+			instances[res.AccountID] = append(instances[res.AccountID], &awsInstance{baseInstance: baseInstance{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        res.AccountID,
+					id:           res.ResourceID,
+					location:     res.AWSRegion,
+					creationTime: res.Configuration.LaunchTime,
+					public:       res.Configuration.PublicIPAddress != "",
+					tags:         convertAWSConfigTags(res.Tags),
+				},
+				instanceType: res.Configuration.InstanceType,
+				imageID:      res.Configuration.ImageID,
+				platform:     awsInstancePlatform(res.Configuration.Platform),
+				tenancy:      awsInstanceTenancy(res.Configuration.Placement.Tenancy),
+				lifecycle:    awsInstanceLifecycle(res.Configuration.InstanceLifecycle),
+			}, staleTags: true})
+			return nil
+		})
+		if err != nil {
+			status.Warnf("Could not read instances from aggregator %s, using EC2 APIs instead: %s", inv.aggregator, err)
+			return
+		}
+
+		volumes := make(map[string][]Volume)
+		err = inv.query(awsConfigVolumesQuery, func(raw []byte) error {
+			var res awsConfigVolume
+			if err := json.Unmarshal(raw, &res); err != nil {
+				return err
+			}
+			vol := &awsVolume{baseVolume: baseVolume{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        res.AccountID,
+					id:           res.ResourceID,
+					location:     res.AWSRegion,
+					creationTime: res.Configuration.CreateTime,
+					public:       false,
+					tags:         convertAWSConfigTags(res.Tags),
+				},
+				sizeGB:     res.Configuration.Size,
+				attached:   len(res.Configuration.Attachments) > 0 || res.Configuration.State == awsStateInUse,
+				encrypted:  res.Configuration.Encrypted,
+				volumeType: res.Configuration.VolumeType,
+			}, staleTags: true}
+			for _, attachment := range res.Configuration.Attachments {
+				if attachment.InstanceID != "" {
+					vol.instanceIDs = append(vol.instanceIDs, attachment.InstanceID)
+				}
+			}
+			volumes[res.AccountID] = append(volumes[res.AccountID], vol)
+			return nil
+		})
+		if err != nil {
+			status.Warnf("Could not read volumes from aggregator %s, using EC2 APIs instead: %s", inv.aggregator, err)
+			return
+		}
+
+		log.Printf("Found %d accounts in AWS Config aggregator %s", len(recorded), inv.aggregator)
+		inv.recorded = recorded
+		inv.instances = instances
+		inv.volumes = volumes
+		inv.loaded = true
+	})
+}
+
+// query runs an advanced query against the aggregator, and calls the
+// specified function with every result
+func (inv *awsConfigInventory) query(expression string, f func(raw []byte) error) error {
+	input := &configservice.SelectAggregateResourceConfigInput{
+		ConfigurationAggregatorName: aws.String(inv.aggregator),
+		Expression:                  aws.String(expression),
+		Limit:                       aws.Int64(awsConfigPageSize),
+	}
+	for {
+		output, err := inv.client.SelectAggregateResourceConfig(input)
+		if err != nil {
+			return err
+		}
+		for _, result := range output.Results {
+			if result == nil {
+				continue
+			}
+			if err := f([]byte(*result)); err != nil {
+				return fmt.Errorf("Could not parse result: %s", err)
+			}
+		}
+		if output.NextToken == nil || *output.NextToken == "" {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// covers returns true if the inventory can be used for a resource type
+// of the account, which it must have recorded in the aggregator
+func (inv *awsConfigInventory) covers(account, resourceType string) bool {
+	if inv == nil {
+		return false
+	}
+	inv.load()
+	return inv.loaded && inv.recorded[account][resourceType]
+}
+
+// accountInstances returns the instances of an account, and false if
+// they must be fetched using the EC2 APIs instead
+func (inv *awsConfigInventory) accountInstances(account string) ([]Instance, bool) {
+	if !inv.covers(account, awsConfigInstanceType) {
+		return nil, false
+	}
+	recordResources(AWS, ResourceTypeInstances, len(inv.instances[account]))
+	return inv.instances[account], true
+}
+
+// accountVolumes returns the volumes of an account, and false if they
+// must be fetched using the EC2 APIs instead
+func (inv *awsConfigInventory) accountVolumes(account string) ([]Volume, bool) {
+	if !inv.covers(account, awsConfigVolumeType) {
+		return nil, false
+	}
+	recordResources(AWS, ResourceTypeVolumes, len(inv.volumes[account]))
+	return inv.volumes[account], true
+}
+
+// uncoveredInstances returns the accounts whose instances aren't covered
+// by the inventory
+func (inv *awsConfigInventory) uncoveredInstances(accounts []string) []string {
+	return inv.uncovered(accounts, awsConfigInstanceType)
+}
+
+// uncoveredVolumes returns the accounts whose volumes aren't covered by
+// the inventory
+func (inv *awsConfigInventory) uncoveredVolumes(accounts []string) []string {
+	return inv.uncovered(accounts, awsConfigVolumeType)
+}
+
+func (inv *awsConfigInventory) uncovered(accounts []string, resourceType string) []string {
+	result := []string{}
+	for _, account := range accounts {
+		if !inv.covers(account, resourceType) {
+			result = append(result, account)
+		}
+	}
+	return result
+}
+
+// TagRefresher is implemented by resources whose tags may be out of date,
+// such as AWS instances and volumes read from an AWS Config aggregator.
+// Use a type assertion on the Resource to check for support.
+type TagRefresher interface {
+	// RefreshTags reads the tags of the resource again from the CSP, if
+	// they may be out of date
+	RefreshTags() error
+}
+
+func (i *awsInstance) RefreshTags() error {
+	if !i.staleTags {
+		return nil
+	}
+	tags, err := getAWSTags(i)
+	if err != nil {
+		return err
+	}
+	i.tags, i.staleTags = tags, false
+	return nil
+}
+
+func (v *awsVolume) RefreshTags() error {
+	if !v.staleTags {
+		return nil
+	}
+	tags, err := getAWSTags(v)
+	if err != nil {
+		return err
+	}
+	v.tags, v.staleTags = tags, false
+	return nil
+}
+
+// getAWSTags reads the current tags of an EC2 resource
+func getAWSTags(r Resource) (map[string]string, error) {
+	client := clientForAWSResource(r)
+	input := &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("resource-id"),
+			Values: aws.StringSlice([]string{r.ID()}),
+		}},
+	}
+	tags := make(map[string]string)
+	err := client.DescribeTagsPages(input, func(output *ec2.DescribeTagsOutput, lastPage bool) bool {
+		for _, tag := range output.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		return true
+	})
+	return tags, err
+}
+
+func convertAWSConfigTags(tags []awsConfigTag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		result[tag.Key] = tag.Value
+	}
+	return result
+}
@@ -17,20 +17,24 @@ import (
 	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/status"
 
 	"github.com/aws/aws-sdk-go/aws"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 const (
 	awsCSVDateFormat         = "2006-01-02"
+	awsCSVUsageDateFormat    = "2006-01-02 15:04:05"
 	awsCSVNameFormat         = "%s-aws-billing-detailed-line-items-%d-%02d.csv.zip"
 	awsCSVNameFormatWithTags = "%s-aws-billing-detailed-line-items-with-resources-and-tags-%d-%02d.csv.zip"
 )
 
+// awsCommitmentMarkers are found in the description of upfront fees
+var awsCommitmentMarkers = []string{"sign up charge", "upfront fee"}
+
 type awsReporter struct {
 	csp                 cloud.CSP
 	billingAccount      string
@@ -40,29 +44,41 @@ type awsReporter struct {
 }
 
 func (r *awsReporter) GenerateReport(start time.Time) Report {
+	return r.GeneratePeriodReport(MonthPeriod(start))
+}
+
+// GeneratePeriodReport reads the CSV of every month in the period, and
+// counts the line items whose usage started in the period. Line items
+// without a usage date, such as taxes and monthly fees, are counted in
+// periods which include the first day of their month.
+func (r *awsReporter) GeneratePeriodReport(period Period) Report {
 	report := Report{}
 	report.CSP = r.csp
+	report.Period = period
 
-	var name string
-	if r.sortByTag == "" {
-		name = fmt.Sprintf(awsCSVNameFormat, r.billingAccount, start.Year(), start.Month())
-	} else {
-		name = fmt.Sprintf(awsCSVNameFormatWithTags, r.billingAccount, start.Year(), start.Month())
-	}
+	for _, month := range period.Months() {
+		var name string
+		if r.sortByTag == "" {
+			name = fmt.Sprintf(awsCSVNameFormat, r.billingAccount, month.Year(), month.Month())
+		} else {
+			name = fmt.Sprintf(awsCSVNameFormatWithTags, r.billingAccount, month.Year(), month.Month())
+		}
 
-	csvFile, err := r.getCSVFromS3(name)
-	if err != nil {
-		log.Println("Failed to get", name, ":", err)
-	}
-	err = r.processAwsCsv(&report, csvFile, true)
-	if err != nil {
-		log.Println("Failed to process CSV", name)
+		csvFile, err := r.getCSVFromS3(name)
+		if err != nil {
+			status.ActionFailedf("Failed to get %s: %s", name, err)
+			continue
+		}
+		err = r.processAwsCsv(&report, csvFile, period, month, true)
+		if err != nil {
+			status.ActionFailedf("Failed to process CSV %s", name)
+		}
 	}
 
 	return report
 }
 
-func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFailed bool) error {
+func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, period Period, month time.Time, allowFailed bool) error {
 	csvHeaders := make(map[string]int)
 	line := 0
 	for {
@@ -87,6 +103,10 @@ func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFa
 			line++
 			continue
 		}
+		if !awsInPeriod(record, csvHeaders, period, month) {
+			line++
+			continue
+		}
 
 		reportItem := ReportItem{}
 		reportItem.Owner = record[csvHeaders["LinkedAccountId"]]
@@ -102,6 +122,15 @@ func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFa
 			}
 		}
 		reportItem.Cost = costNumber
+		reportItem.BlendedCost = costNumber
+		if idx, exist := csvHeaders["BlendedCost"]; exist {
+			blended := strings.Replace(record[idx], ",", "", -1)
+			if blendedNumber, err := strconv.ParseFloat(blended, 64); err == nil {
+				reportItem.BlendedCost = blendedNumber
+			}
+		}
+		reportItem.Kind = awsItemKind(reportItem.Description, costNumber)
+		reportItem.billed = month
 		if r.sortByTag != "" {
 			if idx, exist := csvHeaders[fmt.Sprintf("user:%s", r.sortByTag)]; exist {
 				reportItem.sortTagValue = record[idx]
@@ -116,6 +145,37 @@ func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFa
 	}
 }
 
+// awsInPeriod returns true if the usage of a line item in the CSV of the
+// month started in the period. Line items without a usage date are in
+// the period if the first day of the month is.
+func awsInPeriod(record []string, csvHeaders map[string]int, period Period, month time.Time) bool {
+	idx, exist := csvHeaders["UsageStartDate"]
+	if !exist || record[idx] == "" {
+		return period.Contains(month)
+	}
+	usageStart, err := time.ParseInLocation(awsCSVUsageDateFormat, record[idx], period.Start.Location())
+	if err != nil {
+		return period.Contains(month)
+	}
+	return period.Contains(usageStart)
+}
+
+// awsItemKind returns the kind of a line item. Upfront fees for reserved
+// instances and savings plans are commitments, and anything with a
+// negative cost is a credit or refund.
+func awsItemKind(description string, cost float64) ItemKind {
+	lowerDescription := strings.ToLower(description)
+	for _, marker := range awsCommitmentMarkers {
+		if strings.Contains(lowerDescription, marker) {
+			return CommitmentItem
+		}
+	}
+	if cost < 0 {
+		return CreditItem
+	}
+	return UsageItem
+}
+
 func (r *awsReporter) getCSVFromS3(name string) (*csv.Reader, error) {
 	tmpZip := filepath.Join(os.TempDir(), name)
 	f, err := os.Create(tmpZip)
@@ -123,7 +183,7 @@ func (r *awsReporter) getCSVFromS3(name string) (*csv.Reader, error) {
 		log.Println("Could not create file in temp directory")
 		return nil, err
 	}
-	sess := session.Must(session.NewSession())
+	sess := cloud.NewAWSSession()
 	sess.Config.Region = aws.String(r.billingBucketRegion)
 	downloader := s3manager.NewDownloader(sess)
 	input := &s3.GetObjectInput{
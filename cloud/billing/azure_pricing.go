@@ -0,0 +1,177 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+const (
+	azureRetailPricesURL = "https://prices.azure.com/api/retail/prices"
+	azureDefaultRegion   = "eastus"
+	azureSnapshotKey     = "snapshot"
+)
+
+// Azure managed disks are billed per provisioned tier, not per GB. A disk
+// is billed as the smallest tier that fits it, e.g. a 100 GB premium disk
+// is billed as a P10 (128 GB).
+var azureDiskTiers = []struct {
+	SizeGB int64
+	Tier   string
+}{
+	{4, "1"}, {8, "2"}, {16, "3"}, {32, "4"}, {64, "6"}, {128, "10"},
+	{256, "15"}, {512, "20"}, {1024, "30"}, {2048, "40"}, {4096, "50"},
+	{8192, "60"}, {16384, "70"}, {32767, "80"},
+}
+
+var azureDiskTierPrefix = map[string]string{
+	"Premium_LRS":     "P",
+	"StandardSSD_LRS": "E",
+	"Standard_LRS":    "S",
+}
+
+// Fallback storage cost per GB per month, used if the Azure Retail
+// Prices API can't be reached. These are list prices in East US.
+var azureStorageCostGBMonthMap = map[string]float64{
+	"Premium_LRS":     0.135,
+	"StandardSSD_LRS": 0.075,
+	"Standard_LRS":    0.045,
+	azureSnapshotKey:  0.05,
+	"Hot":             0.0184,
+	"Cool":            0.01,
+	"Archive":         0.00099,
+}
+
+type azurePriceKey struct {
+	Region, SKU, Meter string
+}
+
+// azurePrice is a cached price, or why it couldn't be found
+type azurePrice struct {
+	price float64
+	err   error
+}
+
+var (
+	azurePrices      = make(map[azurePriceKey]azurePrice)
+	azurePricesMutex sync.Mutex
+	azureHTTPClient  = &http.Client{Timeout: 30 * time.Second}
+)
+
+// azureVolumeCostPerDay returns the daily cost in USD for an Azure
+// managed disk, using the price of the tier the disk is billed as.
+func azureVolumeCostPerDay(volume cloud.Volume) float64 {
+	prefix, ok := azureDiskTierPrefix[volume.VolumeType()]
+	if !ok {
+		warnUnknownVolumeType(cloud.Azure, volume.VolumeType())
+		return 0.0
+	}
+	tier := azureDiskTiers[len(azureDiskTiers)-1].Tier
+	for _, t := range azureDiskTiers {
+		if volume.SizeGB() <= t.SizeGB {
+			tier = t.Tier
+			break
+		}
+	}
+	sku := fmt.Sprintf("%s%s LRS", prefix, tier)
+	price, err := azureRetailPrice(volume.Location(), sku, sku+" Disk")
+	if err != nil {
+		log.Printf("Could not get Azure price for %s, using estimate: %s", sku, err)
+		return azureStorageCostGBMonthMap[volume.VolumeType()] * float64(volume.SizeGB()) / 30.0
+	}
+	return price / 30.0
+}
+
+// azureSnapshotCostPerDay returns the daily cost in USD for an Azure
+// managed snapshot or image of the specified size.
+func azureSnapshotCostPerDay(location string, sizeGB int64) float64 {
+	price, err := azureRetailPrice(location, "Snapshots LRS", "LRS Snapshots")
+	if err != nil {
+		log.Printf("Could not get Azure snapshot price, using estimate: %s", err)
+		price = azureStorageCostGBMonthMap[azureSnapshotKey]
+	}
+	return price * float64(sizeGB) / 30.0
+}
+
+// azureBlobPricePerMonth returns the monthly price in USD for an Azure
+// blob container, based on the size stored in each access tier.
+func azureBlobPricePerMonth(bucket cloud.Bucket) float64 {
+	total := 0.0
+	for tier, size := range bucket.StorageTypeSizesGB() {
+		sku := tier + " LRS"
+		price, err := azureRetailPrice(bucket.Location(), sku, sku+" Data Stored")
+		if err != nil {
+			log.Printf("Could not get Azure price for %s blob storage, using estimate: %s", tier, err)
+			price = azureStorageCostGBMonthMap[tier]
+		}
+		total += price * size
+	}
+	return total
+}
+
+// azureRetailPrice will return the retail price in USD for the specified
+// storage SKU and meter in a region. Prices are cached, so the Azure
+// Retail Prices API is only queried once for every SKU and region. Prices
+// which couldn't be found are cached too, so they aren't retried for every
+// resource.
+func azureRetailPrice(region, sku, meter string) (float64, error) {
+	if region == "" {
+		region = azureDefaultRegion
+	}
+	key := azurePriceKey{region, sku, meter}
+	azurePricesMutex.Lock()
+	cached, exist := azurePrices[key]
+	azurePricesMutex.Unlock()
+	if exist {
+		return cached.price, cached.err
+	}
+	price, err := fetchAzureRetailPrice(region, sku, meter)
+	azurePricesMutex.Lock()
+	azurePrices[key] = azurePrice{price, err}
+	azurePricesMutex.Unlock()
+	return price, err
+}
+
+// fetchAzureRetailPrice queries the Azure Retail Prices API for the retail
+// price in USD of a storage SKU and meter in a region
+func fetchAzureRetailPrice(region, sku, meter string) (float64, error) {
+	filter := fmt.Sprintf("serviceName eq 'Storage' and priceType eq 'Consumption' and armRegionName eq '%s' and skuName eq '%s' and meterName eq '%s'", region, sku, meter)
+	query := url.Values{}
+	query.Set("$filter", filter)
+	resp, err := azureHTTPClient.Get(azureRetailPricesURL + "?" + query.Encode())
+	if err != nil {
+		return 0.0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0.0, fmt.Errorf("Azure Retail Prices API returned %s", resp.Status)
+	}
+	var result rawAzurePrices
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0.0, err
+	}
+	for _, item := range result.Items {
+		if item.CurrencyCode != "USD" {
+			continue
+		}
+		return item.RetailPrice, nil
+	}
+	return 0.0, fmt.Errorf("no price found for %s (%s) in %s", sku, meter, region)
+}
+
+// Helper struct for parsing the JSON from the Azure Retail Prices API
+type rawAzurePrices struct {
+	Items []struct {
+		CurrencyCode string  `json:"currencyCode"`
+		RetailPrice  float64 `json:"retailPrice"`
+	} `json:"Items"`
+}
@@ -1,12 +1,18 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+// Package billing estimates what resources cost, and builds reports of
+// the actual cost of every account from the billing data of the CSPs.
+// Resources whose price can't be found are estimated or counted as free,
+// and recorded as warnings with the status package.
 package billing
 
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
@@ -20,43 +26,97 @@ const (
 	MinimumCost = 5.0
 )
 
+// ItemKind describes what kind of cost a report item is
+type ItemKind string
+
+const (
+	// UsageItem is the cost of using a service
+	UsageItem ItemKind = "usage"
+	// CreditItem is a credit or refund, which has a negative cost
+	CreditItem ItemKind = "credit"
+	// CommitmentItem is an upfront fee for a commitment, such as a
+	// reserved instance or savings plan
+	CommitmentItem ItemKind = "commitment"
+)
+
 // ReportItem represent a single item in a report. This is usually
 // the cost for a specific service for a certain user in a certain
-// account/project.
+// account/project. Cost is the unblended cost, BlendedCost is the
+// cost averaged over all accounts of a consolidated bill. CSPs without
+// blended rates have the same value for both.
 type ReportItem struct {
 	Owner        string
 	Description  string
 	Cost         float64
+	BlendedCost  float64
+	Kind         ItemKind
 	sortTagValue string
+	// billed is the first day of the month the item was billed in, if
+	// known. Amortized commitment fees are spread over the term from it.
+	billed time.Time
+}
+
+// ReportOptions controls how credits and commitments are counted in a
+// report. The zero value counts everything as it was billed.
+type ReportOptions struct {
+	// ExcludeCredits removes all credits and refunds from the report
+	ExcludeCredits bool
+	// AmortizeCommitments spreads upfront commitment fees evenly over the
+	// months of the commitment term, and only counts the share of the
+	// period. Use GenerateReportWithOptions to include the share of fees
+	// paid in the months before the period.
+	AmortizeCommitments bool
+	// CommitmentTermMonths is the length of commitments when amortizing.
+	// Defaults to 12.
+	CommitmentTermMonths int
 }
 
 // User represents an User and it's TotalCost
 // plus a CostList of all associated DetailedCosts
 type User struct {
-	Name          string
-	TotalCost     float64
-	DetailedCosts CostList
+	Name             string
+	TotalCost        float64
+	TotalBlendedCost float64
+	DetailedCosts    CostList
 }
 
 // UserList respresents a list of Users
 type UserList []User
 
-func (l UserList) Len() int           { return len(l) }
-func (l UserList) Less(i, j int) bool { return l[i].TotalCost < l[j].TotalCost }
-func (l UserList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l UserList) Len() int      { return len(l) }
+func (l UserList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// Less orders users by cost, and users with the same cost by name in
+// reverse, so that reversing the order gives a stable report
+func (l UserList) Less(i, j int) bool {
+	if l[i].TotalCost != l[j].TotalCost {
+		return l[i].TotalCost < l[j].TotalCost
+	}
+	return l[i].Name > l[j].Name
+}
 
 // DetailedCost represents a Cost and Description for a Users expense
 type DetailedCost struct {
 	Cost        float64
+	BlendedCost float64
 	Description string
 }
 
 // CostList respresents a list of Costs
 type CostList []DetailedCost
 
-func (l CostList) Len() int           { return len(l) }
-func (l CostList) Less(i, j int) bool { return l[i].Cost < l[j].Cost }
-func (l CostList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l CostList) Len() int      { return len(l) }
+func (l CostList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// Less orders costs by amount, and costs with the same amount by
+// description in reverse, so that reversing the order gives a stable
+// report
+func (l CostList) Less(i, j int) bool {
+	if l[i].Cost != l[j].Cost {
+		return l[i].Cost < l[j].Cost
+	}
+	return l[i].Description > l[j].Description
+}
 
 // Reporter is a general interface that can be implemented
 // for both AWS and GCP to generate expense reports.
@@ -64,6 +124,13 @@ type Reporter interface {
 	GenerateReport(start time.Time) Report
 }
 
+// PeriodReporter is implemented by reporters which can report the costs
+// of any period, rather than only of a month. Use a type assertion on
+// the Reporter to check for support.
+type PeriodReporter interface {
+	GeneratePeriodReport(period Period) Report
+}
+
 // NewReporterAWS will initialize a new Reporter for the AWS cloud. This
 // requires specifying the account which holds the billing information,
 // the bucket where the billing CSVs can be found as well as which region
@@ -102,8 +169,76 @@ func NewReporterGCP(bucket, csvPrefix string) Reporter {
 // span. The report struct also has methods to help work with
 // all the items.
 type Report struct {
-	CSP   cloud.CSP
-	Items []ReportItem
+	CSP cloud.CSP
+	// Period is the days the costs of the report were incurred
+	Period Period
+	Items  []ReportItem
+	// Currency is the currency costs are formatted in. All costs
+	// are kept in US dollars, and only converted when formatted.
+	Currency string
+	rate     float64
+}
+
+// InCurrency sets the currency that costs in the report are formatted in
+func (r *Report) InCurrency(currency string, rates CurrencyRates) error {
+	rate, err := rates.Convert(1.0, currency)
+	if err != nil {
+		return err
+	}
+	r.Currency = strings.ToUpper(currency)
+	r.rate = rate
+	return nil
+}
+
+// Convert converts a cost in US dollars to the currency of the report
+func (r *Report) Convert(usd float64) float64 {
+	if r.rate == 0 {
+		return usd
+	}
+	return usd * r.rate
+}
+
+// FormatCost formats a cost in US dollars in the currency of the report
+func (r *Report) FormatCost(usd float64) string {
+	if r.currencyLabel() == "$" {
+		return fmt.Sprintf("$%.2f", usd)
+	}
+	return fmt.Sprintf("%.2f %s", r.Convert(usd), r.Currency)
+}
+
+// FormatChange formats the change from a cost of the previous period to
+// a cost in US dollars, in the currency of the report and in percent,
+// e.g. "+$12.30 (+5.2%)"
+func (r *Report) FormatChange(cost, previous float64) string {
+	delta := cost - previous
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+	}
+	amount := sign + r.FormatCost(math.Abs(delta))
+	if percent, ok := PercentChange(cost, previous); ok {
+		return fmt.Sprintf("%s (%s%.1f%%)", amount, sign, math.Abs(percent))
+	}
+	if cost == 0 {
+		return r.FormatCost(0)
+	}
+	return amount + " (new)"
+}
+
+// PercentChange returns the change from a cost of the previous period to
+// a cost in percent, or false if there was no cost in the previous period
+func PercentChange(cost, previous float64) (float64, bool) {
+	if previous == 0 {
+		return 0, false
+	}
+	return (cost - previous) / math.Abs(previous) * 100, true
+}
+
+func (r *Report) currencyLabel() string {
+	if r.Currency == "" || r.Currency == DefaultCurrency {
+		return "$"
+	}
+	return r.Currency
 }
 
 // TotalCost returns the total cost for all items
@@ -115,90 +250,197 @@ func (r *Report) TotalCost() float64 {
 	return total
 }
 
-// SortedUsersByTotalCost returns a sorted list of Users by TotalCost
-func (r *Report) SortedUsersByTotalCost() UserList {
-	type tempUser struct {
-		name          string
-		totalCost     float64
-		detailedCosts map[string]float64
+// TotalBlendedCost returns the total blended cost for all items
+func (r *Report) TotalBlendedCost() float64 {
+	total := 0.0
+	for i := range r.Items {
+		total += r.Items[i].BlendedCost
 	}
-	userMap := make(map[string]*tempUser)
-	// Go through all ReportItems
+	return total
+}
+
+// HasBlendedCosts returns true if the blended cost differs from the
+// unblended cost for any item, in which case both should be shown
+func (r *Report) HasBlendedCosts() bool {
+	for i := range r.Items {
+		if r.Items[i].BlendedCost != r.Items[i].Cost {
+			return true
+		}
+	}
+	return false
+}
+
+// termMonths returns the length of commitments when amortizing
+func (opts ReportOptions) termMonths() int {
+	if opts.CommitmentTermMonths <= 0 {
+		return 12
+	}
+	return opts.CommitmentTermMonths
+}
+
+// WithOptions returns a copy of the report where credits and
+// commitments are counted as specified by the options. An amortized
+// commitment fee is counted with the share of its term that is in the
+// period, where the term starts in the month the fee was billed, or the
+// first month of the period if that isn't known.
+func (r *Report) WithOptions(opts ReportOptions) Report {
+	termMonths := opts.termMonths()
+	result := Report{CSP: r.CSP, Period: r.Period, Currency: r.Currency, rate: r.rate}
 	for _, item := range r.Items {
-		// Group by AccountId
-		if user, ok := userMap[item.Owner]; ok {
-			user.totalCost += item.Cost
-			// Group by Description
-			if cost, ok := user.detailedCosts[item.Description]; ok {
-				user.detailedCosts[item.Description] = cost + item.Cost
-			} else {
-				user.detailedCosts[item.Description] = item.Cost
+		if item.Kind == CreditItem && opts.ExcludeCredits {
+			continue
+		}
+		if item.Kind == CommitmentItem && opts.AmortizeCommitments {
+			billed := item.billed
+			if billed.IsZero() {
+				billed = time.Date(r.Period.Start.Year(), r.Period.Start.Month(), 1, 0, 0, 0, 0, r.Period.Start.Location())
 			}
-		} else {
-			costs := make(map[string]float64)
-			costs[item.Description] = item.Cost
-			userMap[item.Owner] = &tempUser{item.Owner, item.Cost, costs}
+			share := termShare(r.Period, billed, termMonths)
+			if share == 0 {
+				continue
+			}
+			item.Cost *= share
+			item.BlendedCost *= share
+			item.Description = fmt.Sprintf("%s (amortized over %d months)", item.Description, termMonths)
 		}
+		result.Items = append(result.Items, item)
 	}
+	return result
+}
 
-	userList := make(UserList, 0, len(userMap))
-	for _, user := range userMap {
-		// omit users with low TotalCost
-		if user.totalCost < MinimumTotalCost {
-			continue
+// termShare returns the share of a term of months, starting in the month
+// of billed, that is in the period. Every month of the term has an even
+// share, which is split evenly over its days.
+func termShare(period Period, billed time.Time, termMonths int) float64 {
+	share := 0.0
+	for i := 0; i < termMonths; i++ {
+		monthStart := billed.AddDate(0, i, 0)
+		monthEnd := billed.AddDate(0, i+1, 0)
+		start, end := monthStart, monthEnd
+		if period.Start.After(start) {
+			start = period.Start
+		}
+		if period.End.Before(end) {
+			end = period.End
+		}
+		if start.Before(end) {
+			share += end.Sub(start).Hours() / monthEnd.Sub(monthStart).Hours() / float64(termMonths)
 		}
-		// convert detailedCosts into sorted CostLists
-		detailedCostList := convertCostMapToSortedList(user.detailedCosts)
-		// add generated User to userList
-		userList = append(userList, User{user.name, user.totalCost, detailedCostList})
 	}
+	return share
+}
 
-	sort.Sort(sort.Reverse(userList))
-	return userList
+// SortedUsersByTotalCost returns a sorted list of Users by TotalCost
+func (r *Report) SortedUsersByTotalCost() UserList {
+	// Group by AccountId
+	return r.sortedGroupsByTotalCost(func(item ReportItem) string { return item.Owner })
 }
 
 // SortedTagsByTotalCost returns a sorted list of grouped sort tag values,
 // sorted by their total cost.
 func (r *Report) SortedTagsByTotalCost() UserList {
-	type tempTag struct {
+	// Group by sort tag value
+	return r.sortedGroupsByTotalCost(func(item ReportItem) string { return item.sortTagValue })
+}
+
+// SortedAccountGroupsByTotalCost returns a sorted list of costs grouped by
+// the group of their account, such as its cost center or project, sorted
+// by their total cost. Costs of accounts without a group have an empty
+// name.
+func (r *Report) SortedAccountGroupsByTotalCost(accountGroups map[string]string) UserList {
+	return r.sortedGroupsByTotalCost(func(item ReportItem) string { return accountGroups[item.Owner] })
+}
+
+// TotalCostsByUser maps every account/project to its total cost, the same
+// as SortedUsersByTotalCost, or every sort tag value if byTags is set.
+// Groups with a low total cost are included, e.g. to compare with.
+func (r *Report) TotalCostsByUser(byTags bool) map[string]float64 {
+	if byTags {
+		return r.totalCostsBy(func(item ReportItem) string { return item.sortTagValue })
+	}
+	return r.totalCostsBy(func(item ReportItem) string { return item.Owner })
+}
+
+// TotalCostsByAccountGroup maps every group of accounts to its total
+// cost, the same as SortedAccountGroupsByTotalCost, including groups with
+// a low total cost
+func (r *Report) TotalCostsByAccountGroup(accountGroups map[string]string) map[string]float64 {
+	return r.totalCostsBy(func(item ReportItem) string { return accountGroups[item.Owner] })
+}
+
+func (r *Report) totalCostsBy(groupOf func(ReportItem) string) map[string]float64 {
+	costs := make(map[string]float64)
+	for _, item := range r.Items {
+		costs[groupOf(item)] += item.Cost
+	}
+	return costs
+}
+
+func (r *Report) sortedGroupsByTotalCost(groupOf func(ReportItem) string) UserList {
+	type tempGroup struct {
 		name          string
 		totalCost     float64
-		detailedCosts map[string]float64
+		totalBlended  float64
+		detailedCosts map[string]*DetailedCost
 	}
-	tagMap := make(map[string]*tempTag)
-	// Iterate through all report items
+	groupMap := make(map[string]*tempGroup)
+	// Go through all ReportItems
 	for _, item := range r.Items {
-		// Group by sort tag value
-		if tag, ok := tagMap[item.sortTagValue]; ok {
-			tag.totalCost += item.Cost
-			// Group by Description
-			if cost, ok := tag.detailedCosts[item.Description]; ok {
-				tag.detailedCosts[item.Description] = cost + item.Cost
-			} else {
-				tag.detailedCosts[item.Description] = item.Cost
-			}
-		} else {
-			costs := make(map[string]float64)
-			costs[item.Description] = item.Cost
-			tagMap[item.sortTagValue] = &tempTag{item.sortTagValue, item.Cost, costs}
+		name := groupOf(item)
+		group, ok := groupMap[name]
+		if !ok {
+			group = &tempGroup{name: name, detailedCosts: make(map[string]*DetailedCost)}
+			groupMap[name] = group
 		}
+		group.totalCost += item.Cost
+		group.totalBlended += item.BlendedCost
+		// Group by Description
+		addDetailedCost(group.detailedCosts, item)
 	}
 
-	tagList := make(UserList, 0, len(tagMap))
-	for _, tag := range tagMap {
-		// Omit tags with low total cost
-		if tag.totalCost < MinimumTotalCost {
+	groupList := make(UserList, 0, len(groupMap))
+	for _, group := range groupMap {
+		// omit groups with low TotalCost
+		if group.totalCost < MinimumTotalCost {
 			continue
 		}
-
-		// Convert detailed costs into sorted cost lists
-		detailedCostList := convertCostMapToSortedList(tag.detailedCosts)
-		// Add generated tag to tag list
-		tagList = append(tagList, User{tag.name, tag.totalCost, detailedCostList})
+		// convert detailedCosts into sorted CostLists
+		detailedCostList := convertCostMapToSortedList(group.detailedCosts)
+		groupList = append(groupList, User{group.name, group.totalCost, group.totalBlended, detailedCostList})
 	}
 
-	sort.Sort(sort.Reverse(tagList))
-	return tagList
+	sort.Sort(sort.Reverse(groupList))
+	return groupList
+}
+
+// FormatAccountGroupReport returns the total cost of every group of
+// accounts, such as cost centers, for finance. The title names the kind
+// of group.
+func (r *Report) FormatAccountGroupReport(title string, accountGroups map[string]string) string {
+	b := new(bytes.Buffer)
+	blended := r.HasBlendedCosts()
+	label := r.currencyLabel()
+
+	fmt.Fprintf(b, "\n\nCosts per %s:\n", strings.ToLower(title))
+	if blended {
+		fmt.Fprintf(b, "%-20s | Cost (%s) | Blended (%s)\n", title, label, label)
+		fmt.Fprintln(b, "------------------------------------------------")
+	} else {
+		fmt.Fprintf(b, "%-20s | Cost (%s)\n", title, label)
+		fmt.Fprintln(b, "------------------------------------")
+	}
+	for _, group := range r.SortedAccountGroupsByTotalCost(accountGroups) {
+		name := group.Name
+		if name == "" {
+			name = "<unattributed>"
+		}
+		if blended {
+			fmt.Fprintf(b, "%-20s | %8.2f | %11.2f\n", name, r.Convert(group.TotalCost), r.Convert(group.TotalBlendedCost))
+		} else {
+			fmt.Fprintf(b, "%-20s | %8.2f\n", name, r.Convert(group.TotalCost))
+		}
+	}
+	return b.String()
 }
 
 // FormatReport returns a simple version of the Month-to-date billing report. It
@@ -213,9 +455,17 @@ func (r *Report) FormatReport(accountToUserMapping map[string]string, sortedByTa
 		sorted = r.SortedUsersByTotalCost()
 	}
 
+	blended := r.HasBlendedCosts()
+	label := r.currencyLabel()
+
 	fmt.Fprintln(b, "\n\nSummary:")
-	fmt.Fprintln(b, "Name      | Cost ($)")
-	fmt.Fprintln(b, "----------------------------")
+	if blended {
+		fmt.Fprintf(b, "Name         | Cost (%s) | Blended (%s)\n", label, label)
+		fmt.Fprintln(b, "----------------------------------------")
+	} else {
+		fmt.Fprintf(b, "Name      | Cost (%s)\n", label)
+		fmt.Fprintln(b, "----------------------------")
+	}
 	for _, user := range sorted {
 		name := user.Name
 		if realName, exist := accountToUserMapping[name]; exist {
@@ -228,9 +478,15 @@ func (r *Report) FormatReport(accountToUserMapping map[string]string, sortedByTa
 				} else {
 					name = "Support"
 				}
+			} else if !sortedByTags {
+				name = cloud.AccountDisplayName(name)
 			}
 		}
-		fmt.Fprintf(b, "%-12s | %8.2f\n", name, user.TotalCost)
+		if blended {
+			fmt.Fprintf(b, "%-12s | %8.2f | %11.2f\n", name, r.Convert(user.TotalCost), r.Convert(user.TotalBlendedCost))
+		} else {
+			fmt.Fprintf(b, "%-12s | %8.2f\n", name, r.Convert(user.TotalCost))
+		}
 	}
 
 	fmt.Fprintf(b, "\nDetails:")
@@ -246,13 +502,24 @@ func (r *Report) FormatReport(accountToUserMapping map[string]string, sortedByTa
 				} else {
 					name = "support"
 				}
+			} else if !sortedByTags {
+				name = cloud.AccountDisplayName(name)
 			}
 		}
 		fmt.Fprintf(b, "\n%s's costs:\n", name)
-		fmt.Fprintln(b, "Cost ($) | Description")
-		fmt.Fprintln(b, "---------------------------")
+		if blended {
+			fmt.Fprintf(b, "Cost (%s) | Blended (%s) | Description\n", label, label)
+			fmt.Fprintln(b, "-----------------------------------------")
+		} else {
+			fmt.Fprintf(b, "Cost (%s) | Description\n", label)
+			fmt.Fprintln(b, "---------------------------")
+		}
 		for _, cost := range user.DetailedCosts {
-			fmt.Fprintf(b, "%-8.2f | %s\n", cost.Cost, cost.Description)
+			if blended {
+				fmt.Fprintf(b, "%-8.2f | %-11.2f | %s\n", r.Convert(cost.Cost), r.Convert(cost.BlendedCost), cost.Description)
+			} else {
+				fmt.Fprintf(b, "%-8.2f | %s\n", r.Convert(cost.Cost), cost.Description)
+			}
 		}
 	}
 	return b.String()
@@ -262,14 +529,77 @@ func (r *Report) FormatReport(accountToUserMapping map[string]string, sortedByTa
 func GenerateReport(reporter Reporter) Report {
 	today := time.Now()
 	start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
-	return reporter.GenerateReport(start)
+	report := reporter.GenerateReport(start)
+	report.Period, _ = PresetPeriod(PeriodMonth, today)
+	return report
+}
+
+// GeneratePeriodReport generates a billing report of the period. An
+// error is returned if the reporter only reports on whole months, and
+// the period isn't one.
+func GeneratePeriodReport(reporter Reporter, period Period) (Report, error) {
+	if periodReporter, ok := reporter.(PeriodReporter); ok {
+		return periodReporter.GeneratePeriodReport(period), nil
+	}
+	if period.Start.Day() != 1 || !period.End.Equal(period.Start.AddDate(0, 1, 0)) {
+		return Report{}, fmt.Errorf("The billing reporter only reports on whole months, not %s", period.Dates())
+	}
+	report := reporter.GenerateReport(period.Start)
+	report.Period = period
+	return report, nil
+}
+
+// GenerateReportWithOptions generates a billing report of the period,
+// where credits and commitments are counted as specified by the options.
+// When amortizing, the commitment fees of every month of the term up to
+// the end of the period are read, so that fees paid before the period
+// are counted with their share as well.
+func GenerateReportWithOptions(reporter Reporter, period Period, opts ReportOptions) (Report, error) {
+	report, err := GeneratePeriodReport(reporter, period)
+	if err != nil || !opts.AmortizeCommitments {
+		return report.WithOptions(opts), err
+	}
+	// Fees of the months in the period are read again below, whether or
+	// not their line items are in the period
+	items := report.Items[:0]
+	for _, item := range report.Items {
+		if item.Kind != CommitmentItem {
+			items = append(items, item)
+		}
+	}
+	report.Items = items
+	first := time.Date(period.Start.Year(), period.Start.Month(), 1, 0, 0, 0, 0, period.Start.Location())
+	fees := Period{Start: first.AddDate(0, 1-opts.termMonths(), 0), End: period.End}
+	for _, month := range fees.Months() {
+		monthReport, err := GeneratePeriodReport(reporter, MonthPeriod(month))
+		if err != nil {
+			return report, err
+		}
+		for _, item := range monthReport.Items {
+			if item.Kind == CommitmentItem {
+				item.billed = month
+				report.Items = append(report.Items, item)
+			}
+		}
+	}
+	return report.WithOptions(opts), nil
+}
+
+func addDetailedCost(costMap map[string]*DetailedCost, item ReportItem) {
+	cost, ok := costMap[item.Description]
+	if !ok {
+		cost = &DetailedCost{Description: item.Description}
+		costMap[item.Description] = cost
+	}
+	cost.Cost += item.Cost
+	cost.BlendedCost += item.BlendedCost
 }
 
-func convertCostMapToSortedList(costMap map[string]float64) CostList {
+func convertCostMapToSortedList(costMap map[string]*DetailedCost) CostList {
 	costList := make(CostList, 0, len(costMap))
-	for desc, cost := range costMap {
-		if cost > MinimumCost {
-			costList = append(costList, DetailedCost{Description: desc, Cost: cost})
+	for _, cost := range costMap {
+		if cost.Cost > MinimumCost {
+			costList = append(costList, *cost)
 		}
 	}
 	sort.Sort(sort.Reverse(costList))
@@ -0,0 +1,100 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCurrency is the currency all costs are calculated in
+	DefaultCurrency = "USD"
+
+	ecbRatesURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+)
+
+// CurrencyRates maps a currency code, such as JPY, to how many units of
+// that currency one US dollar is worth
+type CurrencyRates map[string]float64
+
+// LoadCurrencyRates reads a static rate table from a JSON file, mapping
+// currency codes to how many units of the currency one US dollar is worth
+func LoadCurrencyRates(path string) (CurrencyRates, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rates := CurrencyRates{}
+	if err := json.Unmarshal(raw, &rates); err != nil {
+		return nil, err
+	}
+	return normalizeRates(rates), nil
+}
+
+type ecbEnvelope struct {
+	Rates []struct {
+		Currency string  `xml:"currency,attr"`
+		Rate     float64 `xml:"rate,attr"`
+	} `xml:"Cube>Cube>Cube"`
+}
+
+// FetchECBRates gets the daily reference rates from the European Central
+// Bank. The ECB rates are relative to the euro, so they are converted to
+// be relative to the US dollar.
+func FetchECBRates() (CurrencyRates, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(ecbRatesURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ECB rates returned status %d", resp.StatusCode)
+	}
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	eurRates := map[string]float64{"EUR": 1.0}
+	for _, rate := range envelope.Rates {
+		eurRates[rate.Currency] = rate.Rate
+	}
+	usdRate, exist := eurRates[DefaultCurrency]
+	if !exist || usdRate == 0 {
+		return nil, errors.New("ECB rates do not include USD")
+	}
+	rates := CurrencyRates{}
+	for currency, rate := range eurRates {
+		rates[currency] = rate / usdRate
+	}
+	return normalizeRates(rates), nil
+}
+
+// Convert converts an amount in US dollars to the specified currency
+func (r CurrencyRates) Convert(usd float64, currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == DefaultCurrency {
+		return usd, nil
+	}
+	rate, exist := r[currency]
+	if !exist {
+		return 0, fmt.Errorf("No exchange rate for %s", currency)
+	}
+	return usd * rate, nil
+}
+
+func normalizeRates(rates CurrencyRates) CurrencyRates {
+	result := CurrencyRates{DefaultCurrency: 1.0}
+	for currency, rate := range rates {
+		result[strings.ToUpper(currency)] = rate
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// AccountColumn is an extra column in an exported report, with a value
+// per account, such as the cost center of the account
+type AccountColumn struct {
+	Title  string
+	Values map[string]string
+}
+
+// WriteCSV writes the cost of every service in every account as CSV, so
+// that the report can be sorted and pivoted in a spreadsheet. Unlike the
+// formatted report, no costs are left out for being small. Costs are in
+// the currency of the report.
+func (r *Report) WriteCSV(w io.Writer, accountToUserMapping map[string]string, columns ...AccountColumn) error {
+	type row struct {
+		account     string
+		description string
+		kind        ItemKind
+		cost        float64
+		blended     float64
+	}
+	rows := make(map[string]*row)
+	for _, item := range r.Items {
+		key := item.Owner + "\x00" + item.Description + "\x00" + string(item.Kind)
+		if _, exist := rows[key]; !exist {
+			rows[key] = &row{account: item.Owner, description: item.Description, kind: item.Kind}
+		}
+		rows[key].cost += item.Cost
+		rows[key].blended += item.BlendedCost
+	}
+	sorted := make([]*row, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.account != b.account {
+			return a.account < b.account
+		}
+		if a.cost != b.cost {
+			return a.cost > b.cost
+		}
+		return a.description < b.description
+	})
+
+	out := csv.NewWriter(w)
+	label := r.currencyLabel()
+	header := []string{"Account", "Account name", "Owner"}
+	for _, column := range columns {
+		header = append(header, column.Title)
+	}
+	header = append(header, "Service", "Kind", fmt.Sprintf("Cost (%s)", label))
+	if r.HasBlendedCosts() {
+		header = append(header, fmt.Sprintf("Blended (%s)", label))
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, row := range sorted {
+		record := []string{row.account, cloud.AccountName(row.account), accountToUserMapping[row.account]}
+		for _, column := range columns {
+			record = append(record, column.Values[row.account])
+		}
+		record = append(record, row.description, string(row.kind), fmt.Sprintf("%.2f", r.Convert(row.cost)))
+		if r.HasBlendedCosts() {
+			record = append(record, fmt.Sprintf("%.2f", r.Convert(row.blended)))
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
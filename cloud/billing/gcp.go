@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/status"
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/option"
@@ -30,26 +31,35 @@ type gcpReporter struct {
 }
 
 func (r *gcpReporter) GenerateReport(start time.Time) Report {
+	return r.GeneratePeriodReport(MonthPeriod(start))
+}
+
+// GeneratePeriodReport reads the CSV of every day in the period, until
+// one is missing
+func (r *gcpReporter) GeneratePeriodReport(period Period) Report {
 	report := Report{}
 	report.CSP = r.csp
+	report.Period = period
 
 	ctx := context.Background()
 	credsFilePath, exist := os.LookupEnv(cloud.GcpCredentialsFileKey)
 	if !exist {
-		log.Fatalln("No GCP credentials specified!")
+		status.ActionFailedf("No GCP credentials specified!")
+		return report
 	}
 	if _, err := os.Stat(credsFilePath); os.IsNotExist(err) {
-		log.Fatalln(credsFilePath, "is not a file!")
+		status.ActionFailedf("%s is not a file!", credsFilePath)
+		return report
 	}
 	opt := option.WithServiceAccountFile(credsFilePath)
 	client, err := storage.NewClient(ctx, opt)
 	if err != nil {
-		log.Printf("Could not initialize storage service:\n%s\n", err)
+		status.ActionFailedf("Could not initialize storage service:\n%s\n", err)
 		return report
 	}
 
-	for d := start; d.Month() == start.Month(); d = d.AddDate(0, 0, 1) {
-		name := fmt.Sprintf(gcpCSVNameFormat, r.csvNamePrefix, start.Year(), start.Month(), d.Day())
+	for d := period.Start; d.Before(period.End); d = d.AddDate(0, 0, 1) {
+		name := fmt.Sprintf(gcpCSVNameFormat, r.csvNamePrefix, d.Year(), d.Month(), d.Day())
 		log.Println("Getting", name)
 		obj := client.Bucket(r.bucket).Object(name)
 		if err := processObjectHandle(ctx, obj, &report, true); err != nil {
@@ -100,7 +110,38 @@ func processObjectHandle(ctx context.Context, obj *storage.ObjectHandle, report
 			}
 		}
 		reportItem.Cost = costNumber
+		reportItem.BlendedCost = costNumber
+		reportItem.Kind = UsageItem
 		report.Items = append(report.Items, reportItem)
+		report.Items = append(report.Items, gcpCredits(record, csvHeaders, reportItem.Owner)...)
 		i++
 	}
 }
+
+// gcpCredits returns the credits of a line item, which are listed in the
+// columns "Credit1", "Credit1 Amount", "Credit2" etc. Credit amounts are
+// negative.
+func gcpCredits(record []string, csvHeaders map[string]int, owner string) []ReportItem {
+	credits := []ReportItem{}
+	for n := 1; ; n++ {
+		amountIdx, exist := csvHeaders[fmt.Sprintf("Credit%d Amount", n)]
+		if !exist || amountIdx >= len(record) {
+			return credits
+		}
+		amount, err := strconv.ParseFloat(record[amountIdx], 64)
+		if err != nil || amount == 0 {
+			continue
+		}
+		description := "Credits"
+		if nameIdx, exist := csvHeaders[fmt.Sprintf("Credit%d", n)]; exist && record[nameIdx] != "" {
+			description = record[nameIdx]
+		}
+		credits = append(credits, ReportItem{
+			Owner:       owner,
+			Description: description,
+			Cost:        amount,
+			BlendedCost: amount,
+			Kind:        CreditItem,
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+const gcpStandardStorageClass = "STANDARD"
+
+// Storage cost per GB per month of every Cloud Storage class, in regions
+// and in multi-regions. These are list prices in us-central1 and US, and
+// dual-regions are priced as multi-regions.
+var (
+	gcpBucketRegionalGBMonthMap = map[string]float64{
+		"STANDARD": 0.020,
+		"NEARLINE": 0.010,
+		"COLDLINE": 0.004,
+		"ARCHIVE":  0.0012,
+	}
+	gcpBucketMultiRegionalGBMonthMap = map[string]float64{
+		"STANDARD": 0.026,
+		"NEARLINE": 0.010,
+		"COLDLINE": 0.007,
+		"ARCHIVE":  0.0024,
+	}
+)
+
+// gcpLegacyStorageClasses are the storage classes which can no longer be
+// set on new objects, and the class they're billed as
+var gcpLegacyStorageClasses = map[string]string{
+	"MULTI_REGIONAL":               gcpStandardStorageClass,
+	"REGIONAL":                     gcpStandardStorageClass,
+	"DURABLE_REDUCED_AVAILABILITY": gcpStandardStorageClass,
+}
+
+// gcpMinimumStorageDays is how many days objects are billed for at least
+// in the storage classes with early deletion fees
+var gcpMinimumStorageDays = map[string]int{
+	"NEARLINE": 30,
+	"COLDLINE": 90,
+	"ARCHIVE":  365,
+}
+
+// Snapshot storage cost per GB per month, in a region or a multi-region
+const (
+	gcpSnapshotRegionalGBMonth      = 0.05
+	gcpSnapshotMultiRegionalGBMonth = 0.065
+)
+
+// gcpRegionPriceFactors is how much more storage costs in the regions
+// which are more expensive than us-central1. The same factor is used for
+// every storage class and for snapshots.
+var gcpRegionPriceFactors = map[string]float64{
+	"us-west2":                1.15,
+	"us-west3":                1.15,
+	"us-west4":                1.15,
+	"northamerica-northeast1": 1.15,
+	"southamerica-east1":      1.75,
+	"europe-west2":            1.15,
+	"europe-west3":            1.15,
+	"europe-west6":            1.25,
+	"asia-east2":              1.25,
+	"asia-northeast1":         1.15,
+	"asia-northeast2":         1.15,
+	"asia-northeast3":         1.15,
+	"asia-south1":             1.15,
+	"asia-southeast2":         1.15,
+	"australia-southeast1":    1.15,
+}
+
+// gcpIsRegion returns true if a location is a single region, such as
+// us-central1, rather than a multi-region or dual-region, such as US or
+// NAM4
+func gcpIsRegion(location string) bool {
+	return strings.Contains(location, "-")
+}
+
+// gcpRegionPriceFactor returns how much more storage costs in a location
+// than in us-central1, which is 1 for multi-regions and unknown regions
+func gcpRegionPriceFactor(location string) float64 {
+	if factor, exist := gcpRegionPriceFactors[strings.ToLower(location)]; exist {
+		return factor
+	}
+	return 1.0
+}
+
+// gcpStorageClass returns the storage class an object of the class is
+// billed as, which is STANDARD for legacy and unknown classes
+func gcpStorageClass(class string) string {
+	class = strings.ToUpper(class)
+	if billedAs, legacy := gcpLegacyStorageClasses[class]; legacy {
+		return billedAs
+	}
+	if _, exist := gcpBucketRegionalGBMonthMap[class]; !exist {
+		return gcpStandardStorageClass
+	}
+	return class
+}
+
+// gcpStoragePricePerGBMonth returns the monthly price in USD of a GB in a
+// storage class of a bucket in the location
+func gcpStoragePricePerGBMonth(class, location string) float64 {
+	class = gcpStorageClass(class)
+	if gcpIsRegion(location) {
+		return gcpBucketRegionalGBMonthMap[class] * gcpRegionPriceFactor(location)
+	}
+	return gcpBucketMultiRegionalGBMonthMap[class]
+}
+
+// gcpStorageClassSizesGB returns the size of the objects in a bucket per
+// storage class. Buckets without sizes per class, such as ones read from
+// an old inventory, are counted as standard storage.
+func gcpStorageClassSizesGB(bucket cloud.Bucket) map[string]float64 {
+	sizes := bucket.StorageTypeSizesGB()
+	if len(sizes) == 0 && bucket.TotalSizeGB() > 0 {
+		sizes = map[string]float64{gcpStandardStorageClass: bucket.TotalSizeGB()}
+	}
+	return sizes
+}
+
+// gcpBucketPricePerMonth returns the monthly price in USD of the objects
+// in a Cloud Storage bucket, from their storage classes and the location
+// of the bucket
+func gcpBucketPricePerMonth(bucket cloud.Bucket) float64 {
+	price := 0.0
+	for class, size := range gcpStorageClassSizesGB(bucket) {
+		price += gcpStoragePricePerGBMonth(class, bucket.Location()) * size
+	}
+	return price
+}
+
+// gcpBucketEarlyDeletionFee returns the estimated fee in USD for deleting
+// the objects in a bucket. In GCP the minimum storage duration counts from
+// when an object was created, even if it was moved to another storage class
+// since, so the fee is an upper bound based on when the bucket was last
+// modified, which no object is newer than.
+func gcpBucketEarlyDeletionFee(bucket cloud.Bucket) float64 {
+	ageDays := time.Since(bucket.LastModified()).Hours() / 24
+	fee := 0.0
+	for class, size := range gcpStorageClassSizesGB(bucket) {
+		minimumDays, exist := gcpMinimumStorageDays[gcpStorageClass(class)]
+		if !exist || ageDays >= float64(minimumDays) {
+			continue
+		}
+		fee += gcpStoragePricePerGBMonth(class, bucket.Location()) * size * (float64(minimumDays) - ageDays) / 30.0
+	}
+	return fee
+}
+
+// gcpSnapshotCostPerDay returns the daily cost in USD of a snapshot in the
+// location, which is where its data is stored. Snapshots without a known
+// location are priced as multi-regional, which is the default.
+func gcpSnapshotCostPerDay(location string, sizeGB int64) float64 {
+	price := gcpSnapshotMultiRegionalGBMonth
+	if gcpIsRegion(location) {
+		price = gcpSnapshotRegionalGBMonth * gcpRegionPriceFactor(location)
+	}
+	return price / 30.0 * float64(sizeGB)
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// awsLargePricePerHour is the on-demand price in USD per hour of the
+// large size, with 2 vCPUs, of every current generation AWS instance
+// family, for Linux in us-east-1. It's used when the pricing API has no
+// price for an instance type, such as a brand new one. Other regions are
+// usually within 20% of these prices.
+var awsLargePricePerHour = map[string]float64{
+	// General purpose
+	"m5": 0.096, "m5a": 0.086, "m5d": 0.113, "m5n": 0.119,
+	"m6i": 0.096, "m6a": 0.0864, "m6id": 0.1187, "m6in": 0.1392,
+	"m6g": 0.077, "m6gd": 0.0904,
+	"m7i": 0.1008, "m7i-flex": 0.0958, "m7a": 0.1159,
+	"m7g": 0.0816, "m7gd": 0.1068,
+	"m8g": 0.0898,
+	"t3":  0.0832, "t3a": 0.0752, "t4g": 0.0672,
+
+	// Compute optimized
+	"c5": 0.085, "c5a": 0.077, "c5d": 0.096, "c5n": 0.108,
+	"c6i": 0.085, "c6a": 0.0765, "c6id": 0.1008, "c6in": 0.1134,
+	"c6g": 0.068, "c6gd": 0.0768, "c6gn": 0.0864,
+	"c7i": 0.0893, "c7i-flex": 0.0848, "c7a": 0.1026,
+	"c7g": 0.0725, "c7gd": 0.0907, "c7gn": 0.0998,
+	"c8g": 0.0798,
+
+	// Memory optimized
+	"r5": 0.126, "r5a": 0.113, "r5d": 0.144, "r5n": 0.149,
+	"r6i": 0.126, "r6a": 0.1134, "r6id": 0.1512, "r6in": 0.1743,
+	"r6g": 0.1008, "r6gd": 0.1152,
+	"r7i": 0.1323, "r7a": 0.1522,
+	"r7g": 0.1071, "r7gd": 0.1361,
+	"r8g": 0.1178,
+
+	// Storage optimized
+	"i3": 0.156, "i4i": 0.172, "i4g": 0.1544, "im4gn": 0.1819, "is4gen": 0.2302,
+
+	// Accelerated computing, which have no large size, so the price of
+	// the smallest size is scaled down. Larger sizes have more GPUs, and
+	// cost roughly as much per vCPU.
+	"g4dn": 0.263, "g4ad": 0.1895, "g5": 0.503, "g6": 0.4024,
+	"p3": 0.765, "p4d": 0.6827,
+}
+
+// awsVCPUPricePerHour is the typical price in USD per hour of a vCPU of
+// an unknown instance family, by the letter of its class, used when the
+// family isn't in awsLargePricePerHour either
+var awsVCPUPricePerHour = map[byte]float64{
+	'm': 0.048,
+	'c': 0.0425,
+	'r': 0.063,
+	't': 0.0416,
+	'x': 0.0835,
+	'i': 0.086,
+	'z': 0.093,
+	'g': 0.25,
+	'p': 0.38,
+}
+
+const (
+	// awsDefaultVCPUPricePerHour is used for unknown classes of instances
+	awsDefaultVCPUPricePerHour = 0.05
+	// awsGravitonDiscount is how much cheaper Graviton instances usually
+	// are than the Intel instances of the same generation
+	awsGravitonDiscount = 0.8
+)
+
+// gcpVCPUPricePerHour is the on-demand price in USD per hour of a vCPU
+// of the machine types in GCP series which aren't in the table of every
+// machine type, including the ones with Arm CPUs, by series and class
+var gcpVCPUPricePerHour = map[string]float64{
+	"n1-standard":  0.0475,
+	"n1-highmem":   0.0592,
+	"n1-highcpu":   0.03545,
+	"n2-standard":  0.0486,
+	"n2-highmem":   0.0655,
+	"n2-highcpu":   0.0359,
+	"n2d-standard": 0.0423,
+	"n2d-highmem":  0.0570,
+	"n2d-highcpu":  0.0312,
+	"e2-standard":  0.0335,
+	"e2-highmem":   0.0452,
+	"e2-highcpu":   0.0247,
+	"t2a-standard": 0.0385,
+	"t2d-standard": 0.0422,
+	"c2-standard":  0.0522,
+	"c2d-standard": 0.0454,
+	"c2d-highmem":  0.0614,
+	"c2d-highcpu":  0.0391,
+	"c3-standard":  0.0524,
+	"c3-highmem":   0.0687,
+	"c3-highcpu":   0.0437,
+	"c4-standard":  0.0597,
+	"c4a-standard": 0.0449,
+	"n4-standard":  0.0474,
+}
+
+// gcpDefaultVCPUPricePerHour is used for unknown GCP machine types
+const gcpDefaultVCPUPricePerHour = 0.05
+
+// Unknown instance types are only warned about once per run
+var (
+	unknownInstanceTypes      = make(map[string]bool)
+	unknownInstanceTypesMutex sync.Mutex
+)
+
+// warnUnknownInstanceType records a warning the first time the price of
+// an instance type has to be estimated
+func warnUnknownInstanceType(instanceType string, estimate float64) {
+	unknownInstanceTypesMutex.Lock()
+	defer unknownInstanceTypesMutex.Unlock()
+	if unknownInstanceTypes[instanceType] {
+		return
+	}
+	unknownInstanceTypes[instanceType] = true
+	status.Warnf("Unknown instance type %s, estimating its price at $%.4f per hour", instanceType, estimate)
+}
+
+// awsEstimatedPricePerHour estimates the on-demand Linux price of an
+// AWS instance type from its family and size. Prices within a family
+// scale with the size, which is the number of vCPUs apart from the
+// smallest sizes. Families which aren't known are priced by the class of
+// the family, with a discount for Graviton families.
+func awsEstimatedPricePerHour(instanceType string) float64 {
+	family, size := instanceType, ""
+	if i := strings.Index(instanceType, "."); i > 0 {
+		family, size = instanceType[:i], instanceType[i+1:]
+	}
+	vCPUs := awsSizeVCPUs(size)
+	if price, exist := awsLargePricePerHour[family]; exist {
+		return price * vCPUs / 2
+	}
+	price := awsDefaultVCPUPricePerHour
+	if family != "" {
+		if classPrice, exist := awsVCPUPricePerHour[family[0]]; exist {
+			price = classPrice
+		}
+	}
+	if isAWSGravitonFamily(family) {
+		price *= awsGravitonDiscount
+	}
+	return price * vCPUs
+}
+
+// awsSizeVCPUs returns the number of vCPUs the price of a size scales
+// with, which is the number of vCPUs apart from the smallest sizes, e.g.
+// 2 for large and 8 for 4xlarge. Metal is usually the largest size of a
+// family, and unknown sizes are taken to be large.
+func awsSizeVCPUs(size string) float64 {
+	switch size {
+	case "nano":
+		return 0.125
+	case "micro":
+		return 0.25
+	case "small":
+		return 0.5
+	case "medium":
+		return 1
+	case "xlarge":
+		return 4
+	case "metal":
+		return 64
+	}
+	if strings.HasSuffix(size, "xlarge") {
+		n, err := strconv.Atoi(strings.TrimSuffix(size, "xlarge"))
+		if err == nil && n > 0 {
+			return float64(4 * n)
+		}
+	}
+	return 2
+}
+
+// awsSizes are the sizes of AWS instance types, from the smallest, apart
+// from metal. Not every family has every size.
+var awsSizes = []string{"nano", "micro", "small", "medium", "large", "xlarge", "2xlarge", "4xlarge", "8xlarge", "12xlarge", "16xlarge", "24xlarge", "32xlarge", "48xlarge"}
+
+// SmallerAWSInstanceType returns the next smaller size of an AWS instance
+// type in the same family, e.g. m5.large for m5.xlarge, or false if it's
+// the smallest size, or the size isn't known. Only burstable families
+// have sizes below medium, and only they and Graviton families have
+// medium.
+func SmallerAWSInstanceType(instanceType string) (string, bool) {
+	i := strings.Index(instanceType, ".")
+	if i <= 0 {
+		return "", false
+	}
+	family, size := instanceType[:i], instanceType[i+1:]
+	index := indexOf(awsSizes, size)
+	if index <= 0 {
+		return "", false
+	}
+	smaller := awsSizes[index-1]
+	burstable := strings.HasPrefix(family, "t")
+	switch {
+	case smaller == "medium" && !burstable && !isAWSGravitonFamily(family):
+		return "", false
+	case index-1 < indexOf(awsSizes, "medium") && !burstable:
+		return "", false
+	}
+	return family + "." + smaller, true
+}
+
+// isAWSGravitonFamily returns true if the family has the g attribute,
+// e.g. m7g or c6gn, which means it has Graviton CPUs
+func isAWSGravitonFamily(family string) bool {
+	i := strings.IndexAny(family, "0123456789")
+	if i < 0 {
+		return false
+	}
+	return strings.HasPrefix(family[i+1:], "g")
+}
+
+// gcpEstimatedPricePerHour estimates the price of a GCP machine type
+// from its series, class and number of vCPUs, e.g. t2a-standard-4. Custom
+// machine types, e.g. n2-custom-4-8192, are priced like standard ones.
+// The returned bool is false if the series isn't known, and the price is
+// only a rough estimate.
+func gcpEstimatedPricePerHour(machineType string) (float64, bool) {
+	parts := strings.Split(machineType, "-")
+	series, vCPUs := "", 1
+	if i := indexOf(parts, "custom"); i >= 0 && i+1 < len(parts) {
+		series = strings.Join(append(parts[:i:i], "standard"), "-")
+		if i == 0 {
+			series = "n1-standard"
+		}
+		if n, err := strconv.Atoi(parts[i+1]); err == nil && n > 0 {
+			vCPUs = n
+		}
+	} else if len(parts) > 1 {
+		series = strings.Join(parts[:len(parts)-1], "-")
+		if n, err := strconv.Atoi(parts[len(parts)-1]); err == nil && n > 0 {
+			vCPUs = n
+		}
+	}
+	if price, exist := gcpVCPUPricePerHour[series]; exist {
+		return price * float64(vCPUs), true
+	}
+	return gcpDefaultVCPUPricePerHour * float64(vCPUs), false
+}
+
+func indexOf(values []string, value string) int {
+	for i := range values {
+		if values[i] == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"fmt"
+	"time"
+)
+
+// The presets of billing periods
+const (
+	// PeriodMonth is the current month, up to and including today
+	PeriodMonth = "month"
+	// PeriodLastMonth is the whole previous month
+	PeriodLastMonth = "last-month"
+	// PeriodWeek is the current week, from Monday up to and including today
+	PeriodWeek = "week"
+	// PeriodLastWeek is the whole previous week, from Monday to Sunday
+	PeriodLastWeek = "last-week"
+	// PeriodQuarter is the current quarter, up to and including today
+	PeriodQuarter = "quarter"
+	// PeriodLastQuarter is the whole previous quarter
+	PeriodLastQuarter = "last-quarter"
+)
+
+// PeriodPresets are the presets PresetPeriod accepts
+var PeriodPresets = []string{PeriodMonth, PeriodLastMonth, PeriodWeek, PeriodLastWeek, PeriodQuarter, PeriodLastQuarter}
+
+// Period is the days a billing report covers, from the start up to, but
+// not including, the end. Both are midnight.
+type Period struct {
+	Start time.Time
+	End   time.Time
+	// Name describes the period in titles, e.g. "Month-to-date"
+	Name string
+	// The previous equivalent period is this many months, or days if
+	// months is zero, before this one
+	months int
+	days   int
+}
+
+// PresetPeriod returns the period of a preset as of the day of now
+func PresetPeriod(preset string, now time.Time) (Period, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	// Weeks start on Monday
+	week := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	quarter := time.Date(today.Year(), today.Month()-(today.Month()-1)%3, 1, 0, 0, 0, 0, today.Location())
+	switch preset {
+	case PeriodMonth:
+		return Period{Start: month, End: tomorrow, Name: "Month-to-date", months: 1}, nil
+	case PeriodLastMonth:
+		return Period{Start: month.AddDate(0, -1, 0), End: month, Name: "Last month", months: 1}, nil
+	case PeriodWeek:
+		return Period{Start: week, End: tomorrow, Name: "Week-to-date", days: 7}, nil
+	case PeriodLastWeek:
+		return Period{Start: week.AddDate(0, 0, -7), End: week, Name: "Last week", days: 7}, nil
+	case PeriodQuarter:
+		return Period{Start: quarter, End: tomorrow, Name: "Quarter-to-date", months: 3}, nil
+	case PeriodLastQuarter:
+		return Period{Start: quarter.AddDate(0, -3, 0), End: quarter, Name: "Last quarter", months: 3}, nil
+	}
+	return Period{}, fmt.Errorf("Invalid billing period '%s', must be one of %v", preset, PeriodPresets)
+}
+
+// MonthPeriod returns the whole month starting at the first day of month
+func MonthPeriod(month time.Time) Period {
+	return Period{Start: month, End: month.AddDate(0, 1, 0), Name: month.Format("January 2006"), months: 1}
+}
+
+// DateRangePeriod returns the period from the first to, and including,
+// the last day. The previous equivalent period of whole months is the
+// same number of months before it, and of other periods the same number
+// of days.
+func DateRangePeriod(first, last time.Time) (Period, error) {
+	start := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, first.Location())
+	end := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, first.Location()).AddDate(0, 0, 1)
+	if !start.Before(end) {
+		return Period{}, fmt.Errorf("The billing period can't end on %s, before it starts on %s", last.Format(dateFormatLayout), first.Format(dateFormatLayout))
+	}
+	period := Period{Start: start, End: end}
+	period.Name = period.Dates()
+	if start.Day() == 1 && end.Day() == 1 {
+		period.months = (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	} else {
+		period.days = int(end.Sub(start).Hours()/24 + 0.5)
+	}
+	return period, nil
+}
+
+// Previous returns the previous equivalent period, e.g. the same days of
+// last month for the month to date, to compare costs with
+func (p Period) Previous() Period {
+	previous := p
+	previous.Name = "Previous period"
+	if p.months > 0 {
+		previous.Start, previous.End = p.Start.AddDate(0, -p.months, 0), p.End.AddDate(0, -p.months, 0)
+		// The same days of a shorter month end with the month, e.g. the
+		// previous period of March 1 to 30 is all of February
+		if monthsLater := previous.Start.AddDate(0, p.months, 0); previous.End.After(monthsLater) {
+			previous.End = monthsLater
+		}
+	} else {
+		previous.Start, previous.End = p.Start.AddDate(0, 0, -p.days), p.End.AddDate(0, 0, -p.days)
+	}
+	return previous
+}
+
+// Contains returns true if the time is within the period
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// LastDay returns the last day of the period
+func (p Period) LastDay() time.Time {
+	return p.End.AddDate(0, 0, -1)
+}
+
+// Dates describes the days of the period, e.g. "2026-09-01 to 2026-09-30"
+func (p Period) Dates() string {
+	return fmt.Sprintf("%s to %s", p.Start.Format(dateFormatLayout), p.LastDay().Format(dateFormatLayout))
+}
+
+// Months returns the first day of every month the period is in
+func (p Period) Months() []time.Time {
+	months := []time.Time{}
+	for month := time.Date(p.Start.Year(), p.Start.Month(), 1, 0, 0, 0, 0, p.Start.Location()); month.Before(p.End); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+	return months
+}
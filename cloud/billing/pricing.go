@@ -8,55 +8,100 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/private/protocol"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/pricing"
 	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/status"
 )
 
 const (
-	gcpBucketPerGBMonth = 0.026
+	// Kubernetes persistent volumes can be backed by anything, so
+	// use a typical price for network attached SSD storage
+	kubernetesVolumePerGBDay = 0.10 / 30.0
+	// EFS standard storage, and a typical price of the storage capacity
+	// of FSx file systems, which depends on their kind and throughput
+	awsEFSPerGBMonth = 0.30
+	awsFSxPerGBMonth = 0.14
+	// Elastic IPs which aren't associated with a running instance are
+	// billed per hour
+	awsElasticIPPerHour = 0.005
+	// Standard resolution metric alarms, and dashboards beyond the first
+	// three of an account, are billed per month
+	awsAlarmPerMonth     = 0.10
+	awsDashboardPerMonth = 3.00
+	// Client VPN endpoints are billed per hour for every associated
+	// target network, and Site-to-Site VPN connections per hour
+	awsClientVPNAssociationPerHour = 0.10
+	awsVPNConnectionPerHour        = 0.05
+
+	// SageMaker ML instances are billed like the EC2 instance type they
+	// are based on, with a markup which is typically about this much
+	awsMLInstanceMarkup = 1.3
+	awsMLInstancePrefix = "ml."
+	// EMR instances are billed like EC2 instances, with a surcharge which
+	// is typically about a quarter of the on-demand price
+	awsEMRInstanceMarkup = 1.25
 
 	assumeRoleARNTemplate = "arn:aws:iam::%s:role/Cloudsweeper"
 )
 
 type instanceKeyPair struct {
 	Region, InstanceType string
+	Platform, Tenancy    string
 }
 
 type priceMap map[instanceKeyPair]float64
 
 var (
-	awsPrices priceMap
+	awsPrices     priceMap
+	awsSpotPrices priceMap
 )
 
 var generalInstanceFilters = []*pricing.Filter{
-	{
-		Field: aws.String("operatingSystem"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("Linux"),
-	},
-	{
-		Field: aws.String("operation"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("RunInstances"),
-	},
 	{
 		Field: aws.String("capacitystatus"),
 		Type:  aws.String("TERM_MATCH"),
 		Value: aws.String("Used"),
 	},
 	{
-		Field: aws.String("tenancy"),
+		Field: aws.String("preInstalledSw"),
 		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("Shared"),
+		Value: aws.String("NA"),
 	},
 }
 
+// awsPlatformPricing maps the platform of an instance to its operating
+// system and operation in the pricing API. The operation tells apart
+// Windows with the license included from Windows with your own license.
+var awsPlatformPricing = map[string]struct{ operatingSystem, operation string }{
+	cloud.PlatformLinux:   {"Linux", "RunInstances"},
+	cloud.PlatformWindows: {"Windows", "RunInstances:0002"},
+}
+
+// awsSpotProductDescriptions maps the platform of an instance to the
+// product descriptions of its spot prices
+var awsSpotProductDescriptions = map[string][]string{
+	cloud.PlatformLinux:   {"Linux/UNIX", "Linux/UNIX (Amazon VPC)"},
+	cloud.PlatformWindows: {"Windows", "Windows (Amazon VPC)"},
+}
+
+// awsTenancyPricing maps the tenancy of an instance to its tenancy in
+// the pricing API. Instances on dedicated hosts are billed through the
+// host, which is priced about the same as dedicated instances.
+var awsTenancyPricing = map[string]string{
+	cloud.TenancyDefault: "Shared",
+	"dedicated":          "Dedicated",
+	"host":               "Dedicated",
+}
+
 var awsRegionIDToNameMap = map[string]string{
 	"us-east-2":      "US East (Ohio)",
 	"us-east-1":      "US East (N. Virginia)",
@@ -82,13 +127,25 @@ var awsRegionIDToNameMap = map[string]string{
 }
 
 var awsS3StorageCostMap = map[string]float64{
-	"StandardStorage":             0.023,
-	"IntelligentTieringFAStorage": 0.023,
-	"IntelligentTieringIAStorage": 0.0125,
-	"StandardIAStorage":           0.0125,
-	"OneZoneIAStorage":            0.01,
-	"ReducedRedundancyStorage":    0.023, // TODO: double check this
-	"GlacierStorage":              0.004,
+	"StandardStorage":                0.023,
+	"IntelligentTieringFAStorage":    0.023,
+	"IntelligentTieringIAStorage":    0.0125,
+	"StandardIAStorage":              0.0125,
+	"OneZoneIAStorage":               0.01,
+	"ReducedRedundancyStorage":       0.023, // TODO: double check this
+	"GlacierStorage":                 0.004,
+	"GlacierInstantRetrievalStorage": 0.004,
+	"DeepArchiveStorage":             0.00099,
+}
+
+// awsS3MinimumStorageDays is how many days objects are billed for at
+// least in the storage classes with early deletion fees
+var awsS3MinimumStorageDays = map[string]int{
+	"StandardIAStorage":              30,
+	"OneZoneIAStorage":               30,
+	"GlacierInstantRetrievalStorage": 90,
+	"GlacierStorage":                 90,
+	"DeepArchiveStorage":             180,
 }
 
 // Storage cost per GB per day
@@ -101,11 +158,14 @@ var awsStorageCostMap = map[string]float64{
 	"snapshot": 0.05 / 30.0,
 }
 
+// Storage cost per GB per day of a snapshot in the EBS Snapshot Archive tier
+const awsSnapshotArchiveCostGBDay = 0.0125 / 30.0
+
 // Storage cost per GB per day
 var gcpStorageCostGBDayMap = map[string]float64{
 	"pd-ssd":      0.170 / 30.0,
 	"pd-standard": 0.040 / 30.0,
-	"snapshot":    0.026 / 30.0,
+	"image":       0.026 / 30.0,
 }
 
 var gcpInstanceCostPerHourMap = map[string]float64{
@@ -156,23 +216,50 @@ func ResourceCostPerDay(resource cloud.Resource) float64 {
 	}
 }
 
+// unknownVolumeTypes are the volume types which have been warned about,
+// per CSP
+var (
+	unknownVolumeTypes      = make(map[string]bool)
+	unknownVolumeTypesMutex sync.Mutex
+)
+
+// warnUnknownVolumeType records a warning the first time a volume type
+// without a price is found. Such volumes are counted as free.
+func warnUnknownVolumeType(csp cloud.CSP, volumeType string) {
+	unknownVolumeTypesMutex.Lock()
+	defer unknownVolumeTypesMutex.Unlock()
+	key := fmt.Sprintf("%s/%s", csp, volumeType)
+	if unknownVolumeTypes[key] {
+		return
+	}
+	unknownVolumeTypes[key] = true
+	status.Warnf("Could not find price for %s in %s, counting those volumes as free", volumeType, csp)
+}
+
 // VolumeCostPerDay returns the daily cost in USD for a
 // certain volume
 func VolumeCostPerDay(volume cloud.Volume) float64 {
 	if volume.CSP() == cloud.AWS {
 		price, ok := awsStorageCostMap[volume.VolumeType()]
 		if !ok {
-			log.Fatalf("Could not find price for %s in AWS", volume.VolumeType())
+			warnUnknownVolumeType(cloud.AWS, volume.VolumeType())
 			return 0.0
 		}
 		return price * float64(volume.SizeGB())
 	} else if volume.CSP() == cloud.GCP {
 		price, ok := gcpStorageCostGBDayMap[volume.VolumeType()]
 		if !ok {
-			log.Fatalf("Could not find price for %s in GCP", volume.VolumeType())
+			warnUnknownVolumeType(cloud.GCP, volume.VolumeType())
 			return 0.0
 		}
 		return price * float64(volume.SizeGB())
+	} else if volume.CSP() == cloud.Azure {
+		return azureVolumeCostPerDay(volume)
+	} else if volume.CSP() == cloud.Kubernetes {
+		return kubernetesVolumePerGBDay * float64(volume.SizeGB())
+	} else if volume.CSP() == cloud.VSphere {
+		// On-premises storage is already paid for
+		return 0.0
 	}
 	log.Panicln("Unsupported CSP:", volume.CSP())
 	return 0.0
@@ -184,21 +271,166 @@ func SnapshotCostPerDay(snapshot cloud.Snapshot) float64 {
 	if snapshot.CSP() == cloud.AWS {
 		return awsStorageCostMap["snapshot"] * float64(snapshot.SizeGB())
 	} else if snapshot.CSP() == cloud.GCP {
-		price := gcpStorageCostGBDayMap["snapshot"]
-		return price * float64(snapshot.SizeGB())
+		return gcpSnapshotCostPerDay(snapshot.Location(), snapshot.SizeGB())
+	} else if snapshot.CSP() == cloud.Azure {
+		return azureSnapshotCostPerDay(snapshot.Location(), snapshot.SizeGB())
+	} else if snapshot.CSP() == cloud.VSphere {
+		return 0.0
 	}
 	log.Panicln("Unsupported CSP:", snapshot.CSP())
 	return 0.0
 }
 
+// SnapshotArchiveSavingsPerMonth returns how much would be saved per
+// month, in USD, by moving a snapshot to the archive tier. Only AWS has
+// an archive tier. Archived snapshots are full copies rather than
+// incremental, so this is an upper bound of the savings.
+func SnapshotArchiveSavingsPerMonth(snapshot cloud.Snapshot) float64 {
+	if snapshot.CSP() != cloud.AWS {
+		return 0.0
+	}
+	return (awsStorageCostMap["snapshot"] - awsSnapshotArchiveCostGBDay) * 30.0 * float64(snapshot.SizeGB())
+}
+
+// MultipartUploadSavingsPerMonth returns how much would be saved per
+// month, in USD, by aborting an incomplete multipart upload to a bucket.
+// Uploaded parts are billed as standard storage.
+func MultipartUploadSavingsPerMonth(bucket cloud.Bucket, upload cloud.MultipartUpload) float64 {
+	sizeGB := float64(upload.SizeBytes) / (1 << 30)
+	if bucket.CSP() == cloud.AWS {
+		return awsS3StorageCostMap["StandardStorage"] * sizeGB
+	} else if bucket.CSP() == cloud.GCP {
+		return gcpStoragePricePerGBMonth(gcpStandardStorageClass, bucket.Location()) * sizeGB
+	}
+	return 0.0
+}
+
+// FileSystemCostPerMonth returns the monthly cost in USD of the storage
+// of a file system. EFS is billed by the data stored, and FSx by the
+// storage capacity of the file system.
+func FileSystemCostPerMonth(fileSystem cloud.FileSystem) float64 {
+	if fileSystem.CSP() != cloud.AWS {
+		return 0.0
+	}
+	if fileSystem.Kind() == "EFS" {
+		return awsEFSPerGBMonth * fileSystem.SizeGB()
+	}
+	return awsFSxPerGBMonth * fileSystem.SizeGB()
+}
+
+// ElasticIPCostPerMonth returns the monthly cost in USD of an Elastic IP
+// which isn't associated with a running instance
+func ElasticIPCostPerMonth() float64 {
+	return awsElasticIPPerHour * 24 * 30
+}
+
+// AlarmCostPerMonth returns the monthly cost in USD of an alarm
+func AlarmCostPerMonth(alarm cloud.Alarm) float64 {
+	if alarm.CSP() != cloud.AWS {
+		return 0.0
+	}
+	return awsAlarmPerMonth
+}
+
+// DashboardCostPerMonth returns the monthly cost in USD of a dashboard.
+// The first few dashboards of an account are free, so this is an upper
+// bound.
+func DashboardCostPerMonth(dashboard cloud.Dashboard) float64 {
+	if dashboard.CSP() != cloud.AWS {
+		return 0.0
+	}
+	return awsDashboardPerMonth
+}
+
+// VPNCostPerMonth returns the monthly cost in USD of a VPN, without the
+// connections to it, which an idle VPN doesn't have
+func VPNCostPerMonth(vpn cloud.VPN) float64 {
+	if vpn.CSP() != cloud.AWS {
+		return 0.0
+	}
+	if vpn.Associations() < 0 {
+		return awsVPNConnectionPerHour * 24 * 30
+	}
+	return awsClientVPNAssociationPerHour * 24 * 30 * float64(vpn.Associations())
+}
+
+// mlInstance is an instance of a machine learning resource, priced as
+// the instance type it is based on
+type mlInstance struct {
+	cloud.MLResource
+	instanceType string
+}
+
+func (i *mlInstance) InstanceType() string {
+	return i.instanceType
+}
+
+// MLResourceCostPerMonth returns the monthly cost in USD of the instances
+// of a machine learning resource, while it runs
+func MLResourceCostPerMonth(res cloud.MLResource) float64 {
+	if res.CSP() != cloud.AWS {
+		return 0.0
+	}
+	price := 0.0
+	for instanceType, count := range res.Instances() {
+		instance := &mlInstance{res, strings.TrimPrefix(instanceType, awsMLInstancePrefix)}
+		price += awsInstancePricePerHour(instance) * awsMLInstanceMarkup * float64(count)
+	}
+	return price * 24 * 30
+}
+
+// clusterInstance is an instance of a data processing cluster
+type clusterInstance struct {
+	cloud.DataCluster
+	instanceType, lifecycle string
+}
+
+func (i *clusterInstance) InstanceType() string {
+	return i.instanceType
+}
+
+func (i *clusterInstance) Platform() string {
+	return cloud.PlatformLinux
+}
+
+func (i *clusterInstance) Tenancy() string {
+	return cloud.TenancyDefault
+}
+
+func (i *clusterInstance) Lifecycle() string {
+	return i.lifecycle
+}
+
+// DataClusterCostPerMonth returns the monthly cost in USD of the running
+// instances of a data processing cluster. Spot instances are priced at
+// the current spot price.
+func DataClusterCostPerMonth(cluster cloud.DataCluster) float64 {
+	if cluster.CSP() != cloud.AWS {
+		return 0.0
+	}
+	price := 0.0
+	for lifecycle, instances := range map[string]map[string]int{
+		cloud.LifecycleOnDemand: cluster.OnDemandInstances(),
+		cloud.LifecycleSpot:     cluster.SpotInstances(),
+	} {
+		for instanceType, count := range instances {
+			instance := &clusterInstance{cluster, instanceType, lifecycle}
+			price += awsInstancePricePerHour(instance) * float64(count)
+		}
+	}
+	return price * awsEMRInstanceMarkup * 24 * 30
+}
+
 // ImageCostPerDay returns the daily cost in USD for a
 // certain image
 func ImageCostPerDay(image cloud.Image) float64 {
 	if image.CSP() == cloud.AWS {
 		return awsStorageCostMap["snapshot"] * float64(image.SizeGB())
 	} else if image.CSP() == cloud.GCP {
-		price := gcpStorageCostGBDayMap["snapshot"]
+		price := gcpStorageCostGBDayMap["image"]
 		return price * float64(image.SizeGB())
+	} else if image.CSP() == cloud.Azure {
+		return azureSnapshotCostPerDay(image.Location(), image.SizeGB())
 	}
 	log.Panicln("Unsupported CSP:", image.CSP())
 	return 0.0
@@ -207,20 +439,62 @@ func ImageCostPerDay(image cloud.Image) float64 {
 // InstancePricePerHour will return the hourly price in USD for a
 // specified instance.
 func InstancePricePerHour(instance cloud.Instance) float64 {
+	if recorded, ok := instance.(cloud.PriceRecorder); ok {
+		return recorded.RecordedPricePerHour()
+	}
 	if instance.CSP() == cloud.AWS {
 		return awsInstancePricePerHour(instance)
 	} else if instance.CSP() == cloud.GCP {
-		price, ok := gcpInstanceCostPerHourMap[instance.InstanceType()]
-		if !ok {
-			log.Fatalf("Could not find price for %s in GCP", instance.InstanceType())
-			return 0.0
-		}
-		return price
+		return gcpInstancePricePerHour(instance.InstanceType())
+	} else if instance.CSP() == cloud.Kubernetes {
+		// Namespaces, jobs and replica sets have no cost of their own,
+		// their cost is in the nodes of the cluster
+		return 0.0
+	} else if instance.CSP() == cloud.VSphere {
+		// On-premises hosts are already paid for
+		return 0.0
 	}
 	log.Panicln("Unsupported CSP:", instance.CSP())
 	return 0.0
 }
 
+// resizedInstance is an instance with another type, to price resizing it
+type resizedInstance struct {
+	cloud.Instance
+	instanceType string
+}
+
+func (i *resizedInstance) InstanceType() string {
+	return i.instanceType
+}
+
+func (i *resizedInstance) Platform() string {
+	if withPricing, ok := i.Instance.(cloud.InstancePricing); ok {
+		return withPricing.Platform()
+	}
+	return cloud.PlatformLinux
+}
+
+func (i *resizedInstance) Tenancy() string {
+	if withPricing, ok := i.Instance.(cloud.InstancePricing); ok {
+		return withPricing.Tenancy()
+	}
+	return cloud.TenancyDefault
+}
+
+func (i *resizedInstance) Lifecycle() string {
+	if withPricing, ok := i.Instance.(cloud.InstancePricing); ok {
+		return withPricing.Lifecycle()
+	}
+	return cloud.LifecycleOnDemand
+}
+
+// ResizedInstancePricePerHour returns what an instance would cost per
+// hour, in USD, with another instance type
+func ResizedInstancePricePerHour(instance cloud.Instance, instanceType string) float64 {
+	return InstancePricePerHour(&resizedInstance{instance, instanceType})
+}
+
 // BucketPricePerMonth will return the monthly price in USD for a
 // specified bucket. It will not take any account wide discounts
 // that might have been collected for using a certain amount of
@@ -233,31 +507,71 @@ func BucketPricePerMonth(bucket cloud.Bucket) float64 {
 		}
 		return price
 	} else if bucket.CSP() == cloud.GCP {
-		return gcpBucketPerGBMonth * bucket.TotalSizeGB()
+		return gcpBucketPricePerMonth(bucket)
+	} else if bucket.CSP() == cloud.Azure {
+		return azureBlobPricePerMonth(bucket)
 	}
 	log.Panicln("Unsupported CSP:", bucket.CSP())
 	return 0.0
 }
 
+// BucketEarlyDeletionFee returns the estimated fee in USD for deleting a
+// bucket now. Objects in storage classes such as Glacier are billed for a
+// minimum number of days, even if deleted before that. The fee is an upper
+// bound. In AWS, lifecycle rules move objects to another storage class
+// without changing when they were last modified, and the minimum starts
+// over in the new class, so every object is taken to have just entered its
+// class. Only AWS and GCP buckets have their size per storage class, so
+// the fee is zero in other CSPs.
+func BucketEarlyDeletionFee(bucket cloud.Bucket) float64 {
+	if bucket.CSP() == cloud.GCP {
+		return gcpBucketEarlyDeletionFee(bucket)
+	} else if bucket.CSP() != cloud.AWS {
+		return 0.0
+	}
+	fee := 0.0
+	for storageType, size := range bucket.StorageTypeSizesGB() {
+		minimumDays, exist := awsS3MinimumStorageDays[storageType]
+		if !exist {
+			continue
+		}
+		fee += awsS3StorageCostMap[storageType] * size * float64(minimumDays) / 30.0
+	}
+	return fee
+}
+
 // awsInstancePricePerHour will return the hourly price in USD for a
-// specified instance type in a specified AWS region.
+// specified instance, from its type, region, platform, tenancy and
+// lifecycle. Spot instances are priced at the current spot price, or the
+// on-demand price if that can't be found.
 func awsInstancePricePerHour(instance cloud.Instance) float64 {
 	if awsPrices == nil {
 		awsPrices = make(priceMap)
+		awsSpotPrices = make(priceMap)
 	}
+	key, lifecycle := awsInstanceKey(instance)
+	if lifecycle == cloud.LifecycleSpot {
+		price, err := awsSpotPricePerHour(instance.Owner(), key)
+		if err == nil {
+			return price
+		}
+		log.Printf("Could not find the spot price for %s in %s, using the on-demand price: %s", instance.InstanceType(), instance.Location(), err)
+	}
+
 	// The price for this instance type/region has already been fetched before
-	price, exist := awsPrices[instanceKeyPair{instance.Location(), instance.InstanceType()}]
+	price, exist := awsPrices[key]
 	if exist {
 		return price
 	}
 
-	sess := session.Must(session.NewSession())
+	sess := cloud.NewAWSSession()
 	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, instance.Owner()))
 	svc := pricing.New(sess, &aws.Config{
 		Credentials: creds,
 		Region:      aws.String("us-east-1"), // pricing API is only available here
 	})
 
+	platform := awsPlatformPricing[key.Platform]
 	specificFilters := []*pricing.Filter{
 		{
 			Field: aws.String("instanceType"),
@@ -269,6 +583,21 @@ func awsInstancePricePerHour(instance cloud.Instance) float64 {
 			Type:  aws.String("TERM_MATCH"),
 			Value: aws.String(awsRegionIDToNameMap[instance.Location()]),
 		},
+		{
+			Field: aws.String("operatingSystem"),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(platform.operatingSystem),
+		},
+		{
+			Field: aws.String("operation"),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(platform.operation),
+		},
+		{
+			Field: aws.String("tenancy"),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(awsTenancyPricing[key.Tenancy]),
+		},
 	}
 	filters := append(generalInstanceFilters, specificFilters...)
 	input := &pricing.GetProductsInput{
@@ -278,44 +607,147 @@ func awsInstancePricePerHour(instance cloud.Instance) float64 {
 	}
 	result, err := svc.GetProducts(input)
 	if err != nil {
-		log.Fatalln(err.Error())
+		log.Println("Could not get price for", instance.InstanceType(), "in", instance.Location(), "-", err)
+		return awsEstimatedInstancePrice(key)
+	}
+	if len(result.PriceList) == 0 {
+		log.Println("Could not find price for", instance.InstanceType(), key.Platform, "in", instance.Location())
+		return awsEstimatedInstancePrice(key)
 	}
 
 	var listPrice rawAWSPrice
 	rawListPriceJSON, err := protocol.EncodeJSONValue(result.PriceList[0], protocol.NoEscape)
 	if err != nil {
-		log.Fatalln(err.Error())
+		log.Println("Could not parse price for", instance.InstanceType(), "in", instance.Location(), "-", err)
+		return awsEstimatedInstancePrice(key)
 	}
 	err = json.Unmarshal([]byte(rawListPriceJSON), &listPrice)
 	if err != nil {
-		log.Fatalln(err.Error())
+		log.Println("Could not parse price for", instance.InstanceType(), "in", instance.Location(), "-", err)
+		return awsEstimatedInstancePrice(key)
 	}
 
 	for _, term := range listPrice.Terms.OnDemand {
 		for _, price := range term.PriceDimensions {
-			key := instanceKeyPair{
-				Region:       instance.Location(),
-				InstanceType: instance.InstanceType(),
-			}
 			usd, err := strconv.ParseFloat(price.PricePerUnit.USD, 64)
 			if err != nil {
-				log.Fatalln("Could not convert price from AWS JSON", err)
+				log.Println("Could not convert price from AWS JSON", err)
+				return awsEstimatedInstancePrice(key)
 			}
 			if usd == 0.00 {
 				log.Println("Price for", instance.InstanceType(), "in", instance.Location(), "is $0.00. Needs investigation!")
+				return awsEstimatedInstancePrice(key)
 			}
 			awsPrices[key] = usd
 			continue
 		}
 	}
 
-	price, exist = awsPrices[instanceKeyPair{instance.Location(), instance.InstanceType()}]
+	price, exist = awsPrices[key]
 	if !exist {
-		log.Fatalln("Could not fetch price for", instance.InstanceType(), "in", instance.Location())
+		log.Println("Could not fetch price for", instance.InstanceType(), "in", instance.Location())
+		return awsEstimatedInstancePrice(key)
+	}
+	return price
+}
+
+// awsInstanceKey returns what decides the price of an instance, apart
+// from its lifecycle, which is returned separately
+func awsInstanceKey(instance cloud.Instance) (instanceKeyPair, string) {
+	key := instanceKeyPair{
+		Region:       instance.Location(),
+		InstanceType: instance.InstanceType(),
+		Platform:     cloud.PlatformLinux,
+		Tenancy:      cloud.TenancyDefault,
+	}
+	lifecycle := cloud.LifecycleOnDemand
+	if withPricing, ok := instance.(cloud.InstancePricing); ok {
+		if _, known := awsPlatformPricing[withPricing.Platform()]; known {
+			key.Platform = withPricing.Platform()
+		}
+		if _, known := awsTenancyPricing[withPricing.Tenancy()]; known {
+			key.Tenancy = withPricing.Tenancy()
+		}
+		lifecycle = withPricing.Lifecycle()
+	}
+	return key, lifecycle
+}
+
+// InstanceSpotPricePerHour returns what an instance would cost per hour,
+// in USD, as a spot instance at the current spot price. Only AWS has spot
+// instances here, so an error is returned for other CSPs.
+func InstanceSpotPricePerHour(instance cloud.Instance) (float64, error) {
+	if instance.CSP() != cloud.AWS {
+		return 0.0, fmt.Errorf("spot prices are only known in AWS")
+	}
+	if awsSpotPrices == nil {
+		awsPrices = make(priceMap)
+		awsSpotPrices = make(priceMap)
+	}
+	key, _ := awsInstanceKey(instance)
+	return awsSpotPricePerHour(instance.Owner(), key)
+}
+
+// awsEstimatedInstancePrice estimates the price of an instance type the
+// pricing API doesn't know, so that its cost isn't taken to be zero. The
+// estimate is cached like a fetched price, and a warning is recorded the
+// first time a type is estimated.
+func awsEstimatedInstancePrice(key instanceKeyPair) float64 {
+	price := awsEstimatedPricePerHour(key.InstanceType)
+	warnUnknownInstanceType(key.InstanceType, price)
+	awsPrices[key] = price
+	return price
+}
+
+// gcpInstancePricePerHour returns the price of a GCP machine type, which
+// is estimated from its number of vCPUs if it's not in the price table
+func gcpInstancePricePerHour(machineType string) float64 {
+	if price, ok := gcpInstanceCostPerHourMap[machineType]; ok {
+		return price
+	}
+	price, known := gcpEstimatedPricePerHour(machineType)
+	if !known {
+		warnUnknownInstanceType(machineType, price)
 	}
 	return price
 }
 
+// awsSpotPricePerHour returns the current spot price in USD per hour of
+// an instance type in a region, averaged over its availability zones
+func awsSpotPricePerHour(account string, key instanceKeyPair) (float64, error) {
+	if price, exist := awsSpotPrices[key]; exist {
+		return price, nil
+	}
+	sess := cloud.NewAWSSession()
+	client := ec2.New(sess, &aws.Config{
+		Credentials: stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, account)),
+		Region:      aws.String(key.Region),
+	})
+	// Without an end time, only the current price of every zone is returned
+	output, err := client.DescribeSpotPriceHistory(&ec2.DescribeSpotPriceHistoryInput{
+		InstanceTypes:       aws.StringSlice([]string{key.InstanceType}),
+		ProductDescriptions: aws.StringSlice(awsSpotProductDescriptions[key.Platform]),
+		StartTime:           aws.Time(time.Now()),
+	})
+	if err != nil {
+		return 0.0, err
+	}
+	total, count := 0.0, 0
+	for _, spotPrice := range output.SpotPriceHistory {
+		usd, err := strconv.ParseFloat(aws.StringValue(spotPrice.SpotPrice), 64)
+		if err != nil {
+			continue
+		}
+		total += usd
+		count++
+	}
+	if count == 0 {
+		return 0.0, fmt.Errorf("no spot prices found")
+	}
+	awsSpotPrices[key] = total / float64(count)
+	return awsSpotPrices[key], nil
+}
+
 // Helper structs for parsing the JSON from AWS
 type rawAWSPrice struct {
 	Terms struct {
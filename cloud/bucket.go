@@ -7,27 +7,34 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	storage "google.golang.org/api/storage/v1"
 )
 
 type baseBucket struct {
 	baseResource
 	lastModified       time.Time
+	lastRead           time.Time
 	objectCount        int64
 	totalSizeGB        float64
 	storageTypeSizesGB map[string]float64
+	empty              bool
 }
 
 func (b *baseBucket) LastModified() time.Time {
 	return b.lastModified
 }
 
+func (b *baseBucket) LastRead() time.Time {
+	return b.lastRead
+}
+
 func (b *baseBucket) ObjectCount() int64 {
 	return b.objectCount
 }
@@ -40,6 +47,10 @@ func (b *baseBucket) StorageTypeSizesGB() map[string]float64 {
 	return b.storageTypeSizesGB
 }
 
+func (b *baseBucket) Empty() bool {
+	return b.empty
+}
+
 func cleanupBuckets(buckets []Bucket) error {
 	resList := []Resource{}
 	for i := range buckets {
@@ -60,19 +71,29 @@ type awsBucket struct {
 
 func (b *awsBucket) Cleanup() error {
 	log.Printf("Cleaning up bucket %s in %s", b.ID(), b.Owner())
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
+	return b.withS3Client(func(s3Client s3iface.S3API) error {
+		if b.Empty() {
+			// There are no objects to list and delete, only delete markers
+			// if the bucket is versioned. If objects were added since the
+			// bucket was found, deleting it fails.
+			if err := deleteAWSDeleteMarkers(s3Client, b.ID()); err != nil {
+				return err
+			}
+			_, err := s3Client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(b.ID())})
+			return err
+		}
+		return deleteAWSBucket(s3Client, b.ID())
 	})
+}
 
+// deleteAWSBucket deletes all objects in a bucket, and then the bucket
+func deleteAWSBucket(s3Client s3iface.S3API, bucket string) error {
 	var internalErr error
 	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
-		Bucket: aws.String(b.ID()),
+		Bucket: aws.String(bucket),
 	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
 		input := &s3.DeleteObjectsInput{
-			Bucket: aws.String(b.ID()),
+			Bucket: aws.String(bucket),
 		}
 		delete := &s3.Delete{
 			Objects: []*s3.ObjectIdentifier{},
@@ -107,71 +128,151 @@ func (b *awsBucket) Cleanup() error {
 	}
 
 	input := &s3.DeleteBucketInput{
-		Bucket: aws.String(b.ID()),
+		Bucket: aws.String(bucket),
 	}
 	_, err = s3Client.DeleteBucket(input)
 	return err
 }
 
-func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
-	_, exist := b.Tags()[key]
-	if exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, b.ID())
-	}
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
+// awsBucketHasNoVersions checks if a versioned bucket without objects has
+// any previous versions of objects left, apart from delete markers. Only
+// the versions up to the first one found are listed.
+func awsBucketHasNoVersions(s3Client s3iface.S3API, bucket string) (bool, error) {
+	noVersions := true
+	err := s3Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	}, func(output *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		if len(output.Versions) > 0 {
+			noVersions = false
+			return false
+		}
+		return !lastPage
 	})
+	return noVersions, err
+}
 
-	tagging := &s3.Tagging{
-		TagSet: []*s3.Tag{{
-			Key:   aws.String(key),
-			Value: aws.String(value),
-		}},
-	}
-	for key, value := range b.Tags() {
-		tagging.TagSet = append(tagging.TagSet, &s3.Tag{
-			Key: aws.String(key),
-			Value: aws.String(value),
+// deleteAWSDeleteMarkers deletes the delete markers in a versioned bucket,
+// which must be removed before the bucket can be deleted
+func deleteAWSDeleteMarkers(s3Client s3iface.S3API, bucket string) error {
+	var internalErr error
+	err := s3Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	}, func(output *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		if len(output.Versions) > 0 {
+			internalErr = errors.New("Bucket has versions of objects left")
+			return false
+		}
+		markers := []*s3.ObjectIdentifier{}
+		for _, marker := range output.DeleteMarkers {
+			markers = append(markers, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(markers) == 0 {
+			return !lastPage
+		}
+		out, e := s3Client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: markers, Quiet: aws.Bool(true)},
 		})
+		if e != nil {
+			internalErr = e
+			return false
+		}
+		if len(out.Errors) > 0 {
+			internalErr = fmt.Errorf("Failed to delete %d delete markers", len(out.Errors))
+			return false
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return err
 	}
-	input := &s3.PutBucketTaggingInput{
-		Bucket:  aws.String(b.ID()),
-		Tagging: tagging,
-	}
-	_, err := s3Client.PutBucketTagging(input)
-	return err
+	return internalErr
+}
+
+// awsBucketMaxTags is the most tags a bucket can have. Objects can only
+// have 10 tags, but Cloudsweeper never tags objects.
+const awsBucketMaxTags = 50
+
+// awsSystemTagPrefix is the prefix of tags set by AWS, such as the stack
+// of buckets created by CloudFormation. Such tags can't be written, so the
+// tags of a bucket which has them can't be changed without losing them.
+const awsSystemTagPrefix = "aws:"
+
+func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
+	return b.updateTags(func(tags map[string]string) (bool, error) {
+		if _, exist := tags[key]; exist && !overwrite {
+			return false, fmt.Errorf("Key %s already exist on %s", key, b.ID())
+		}
+		tags[key] = value
+		return true, nil
+	})
 }
 
 // RemoveTag removes the specified tag from the bucket
 func (b *awsBucket) RemoveTag(tagToRemove string) error {
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
+	return b.updateTags(func(tags map[string]string) (bool, error) {
+		key, exist := Tags(tags).Key(tagToRemove)
+		if !exist {
+			return false, nil
+		}
+		delete(tags, key)
+		return true, nil
 	})
-	
-	tagging := &s3.Tagging{
-		TagSet: []*s3.Tag{},
-	}
-	for k, v := range b.Tags() {
-		if k == tagToRemove {
-			continue
+}
+
+// updateTags reads the tags of the bucket, changes them, and writes them
+// back if they were changed. S3 can only replace all tags of a bucket at
+// once, so the tags are read right before being written, to keep any tag
+// set since the bucket was found. Buckets with tags set by AWS are never
+// changed, since those tags would be dropped.
+func (b *awsBucket) updateTags(update func(tags map[string]string) (bool, error)) error {
+	return b.withS3Client(func(s3Client s3iface.S3API) error {
+		tags, err := getAWSBucketTags(s3Client, b.ID())
+		if err != nil {
+			return err
 		}
-		tagging.TagSet = append(tagging.TagSet, &s3.Tag{
-			Key:   aws.String(k),
-			Value: aws.String(v),
-		})
-	}
-	input := &s3.PutBucketTaggingInput{
-		Bucket:  aws.String(b.ID()),
-		Tagging: tagging,
+		changed, err := update(tags)
+		if err != nil || !changed {
+			return err
+		}
+
+		tagSet := []*s3.Tag{}
+		for k, v := range tags {
+			if strings.HasPrefix(k, awsSystemTagPrefix) {
+				return fmt.Errorf("%s has the tag %s set by AWS, which can't be kept when changing its tags", b.ID(), k)
+			}
+			tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		if len(tagSet) > awsBucketMaxTags {
+			return fmt.Errorf("%s would have %d tags, but a bucket can have at most %d", b.ID(), len(tagSet), awsBucketMaxTags)
+		}
+		if len(tagSet) == 0 {
+			// An empty tag set is not allowed, the tagging must be deleted
+			_, err = s3Client.DeleteBucketTagging(&s3.DeleteBucketTaggingInput{Bucket: aws.String(b.ID())})
+		} else {
+			_, err = s3Client.PutBucketTagging(&s3.PutBucketTaggingInput{
+				Bucket:  aws.String(b.ID()),
+				Tagging: &s3.Tagging{TagSet: tagSet},
+			})
+		}
+		if err != nil {
+			return err
+		}
+		b.tags = tags
+		return nil
+	})
+}
+
+// getAWSBucketTags returns the current tags of a bucket
+func getAWSBucketTags(s3Client s3iface.S3API, bucket string) (map[string]string, error) {
+	output, err := s3Client.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchTagSet" {
+		return make(map[string]string), nil
+	} else if err != nil {
+		return nil, err
 	}
-	_, err := s3Client.PutBucketTagging(input)
-	return err
+	return convertAWSS3Tags(output.TagSet), nil
 }
 
 // GCP
@@ -1,20 +1,26 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+// Package cloud lists and operates on the resources of the supported
+// CSPs through a ResourceManager, created with NewManagerWithConfig. It
+// can be used as a library: listing can be canceled with the Context of
+// the ManagerConfig, and failures are recorded with the status package
+// instead of stopping the program, unless status.ExitOnFatal is turned on.
 package cloud
 
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
-	oauth2 "golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
 	storage "google.golang.org/api/storage/v1"
+	htransport "google.golang.org/api/transport/http"
 )
 
 const (
@@ -50,6 +56,31 @@ type ResourceManager interface {
 	// AllResourcesPerAccount will return a mapping from account/project
 	// to all of the resources associated with that account/project
 	AllResourcesPerAccount() map[string]*ResourceCollection
+	// ForEachAccountResources calls the specified function with all of the
+	// resources, including buckets, in one account/project at a time. An
+	// account is handed over as soon as it has been processed, so only a
+	// bounded amount of accounts are kept in memory at once. The function is
+	// never called concurrently.
+	ForEachAccountResources(func(*AllResourceCollection))
+	// ForEachInstance calls the specified function for every instance, as
+	// soon as it has been discovered. The function is never called concurrently.
+	ForEachInstance(func(Instance))
+	// ForEachImage calls the specified function for every image, as soon
+	// as it has been discovered. The function is never called concurrently.
+	ForEachImage(func(Image))
+	// ForEachVolume calls the specified function for every volume, as soon
+	// as it has been discovered. The function is never called concurrently.
+	ForEachVolume(func(Volume))
+	// ForEachSnapshot calls the specified function for every snapshot, as
+	// soon as it has been discovered. The function is never called concurrently.
+	ForEachSnapshot(func(Snapshot))
+	// ForEachBucket calls the specified function for every bucket, as soon
+	// as it has been discovered. The function is never called concurrently.
+	ForEachBucket(func(Bucket))
+	// ForEachResource calls the specified function for every resource of
+	// any type, including buckets, as soon as it has been discovered. The
+	// function is never called concurrently.
+	ForEachResource(func(Resource))
 	// CleanupInstances termiantes a list of instances, which is faster
 	// than calling Cleanup() on every individual instance
 	CleanupInstances([]Instance) error
@@ -79,6 +110,15 @@ type Resource interface {
 	Cleanup() error
 }
 
+// TagActivity is implemented by resources which can tell when their tags
+// were last changed, as resources which are old but still curated can be
+// treated more leniently. It's only known for AWS resources, from
+// CloudTrail, so use a type assertion on the Resource to check for
+// support. The zero time means it's unknown.
+type TagActivity interface {
+	LastTagged() time.Time
+}
+
 // Instance composes the Resource interface, and descibes an instance
 // in any CSP.
 type Instance interface {
@@ -86,12 +126,52 @@ type Instance interface {
 	InstanceType() string
 }
 
+// Utilization is how busy an instance has been. The 95th percentiles are
+// those of the busiest day.
+type Utilization struct {
+	CPUPercentP95 float64
+	// MemoryPercentP95 is only known if the memory use of the instance
+	// is reported, such as by the CloudWatch agent
+	MemoryPercentP95 float64
+	MemoryKnown      bool
+}
+
+// UtilizationReporter is implemented by instances whose utilization can
+// be looked up. Use a type assertion on the Instance to check for support.
+type UtilizationReporter interface {
+	// Utilization returns how busy the instance has been over the last
+	// days, or an error if that isn't known
+	Utilization(days int) (Utilization, error)
+}
+
+// GPUUtilization is how busy the GPUs and CPUs of an instance have been,
+// as the highest utilization of any hour
+type GPUUtilization struct {
+	// GPUPercentMax is only known if the GPU utilization of the instance
+	// is reported, such as by the CloudWatch agent or a DCGM exporter
+	GPUPercentMax float64
+	GPUKnown      bool
+	CPUPercentMax float64
+}
+
+// GPUUtilizationReporter is implemented by GPU instances whose
+// utilization can be looked up. Use a type assertion on the Instance to
+// check for support.
+type GPUUtilizationReporter interface {
+	// GPUUtilization returns how busy the instance has been over the
+	// last hours, or an error if that isn't known
+	GPUUtilization(hours int) (GPUUtilization, error)
+}
+
 // Image composes the Resource interface, and descibe an image in
 // any CSP. Such as an AMI in AWS.
 type Image interface {
 	Resource
 	Name() string
 	SizeGB() int64
+	// LastUsed is the last time an instance was launched from the image,
+	// or the zero time if that is not known
+	LastUsed() time.Time
 
 	MakePrivate() error
 }
@@ -113,15 +193,437 @@ type Snapshot interface {
 	Encrypted() bool
 	InUse() bool
 	SizeGB() int64
+	// LastUsed is the last time a volume was created from the snapshot,
+	// or the zero time if that is not known
+	LastUsed() time.Time
 }
 
 // Bucket represents a bucket in a CSP, such as an S3 bucket in AWS
 type Bucket interface {
 	Resource
 	LastModified() time.Time
+	// LastRead is the last time an object was read from the bucket, or the
+	// zero time if that is not known
+	LastRead() time.Time
 	ObjectCount() int64
 	TotalSizeGB() float64
 	StorageTypeSizesGB() map[string]float64
+	// Empty is true if the bucket has no objects. Versioned buckets with
+	// nothing but delete markers left are empty as well.
+	Empty() bool
+}
+
+// SecurityGroup composes the Resource interface, and describes a set
+// of firewall rules in any CSP, such as a security group in AWS.
+type SecurityGroup interface {
+	Resource
+	Name() string
+	IngressRules() []IngressRule
+
+	// RevokeIngressRules removes the specified rules from the group
+	RevokeIngressRules([]IngressRule) error
+}
+
+// FileSystem composes the Resource interface, and describes a network
+// file system in any CSP, such as an EFS or FSx file system in AWS.
+type FileSystem interface {
+	Resource
+	Name() string
+	// Kind is the kind of file system, such as EFS or FSx for Lustre
+	Kind() string
+	SizeGB() float64
+	// MountTargets is the number of mount targets, or -1 if the kind of
+	// file system doesn't have any
+	MountTargets() int
+	// LastUsed is the last day with any IO on the file system, or the
+	// zero time if there was none in the days searched
+	LastUsed() time.Time
+}
+
+// Network composes the Resource interface, and describes a virtual
+// network in any CSP, such as a VPC in AWS, together with the network
+// objects in it which are deleted with it. Cleanup deletes the objects in
+// the order they depend on each other, and the network last.
+type Network interface {
+	Resource
+	Name() string
+	CIDR() string
+	// Interfaces is the number of network interfaces in the network.
+	// Anything using the network, such as an instance, load balancer or
+	// NAT gateway, has one.
+	Interfaces() int
+	// Instances is the number of instances in the network which aren't
+	// terminated
+	Instances() int
+	// Objects are the network objects in the network, such as subnets,
+	// route tables and internet gateways, in the order they are deleted
+	Objects() []*NetworkObject
+	// Dependencies are the objects connecting the network to others, such
+	// as VPN gateways, peering connections and gateway endpoints. They
+	// aren't deleted with the network, which can't be deleted while it
+	// has any.
+	Dependencies() []*NetworkObject
+}
+
+// NetworkObject is an object in a network which is deleted with it
+type NetworkObject struct {
+	// Kind is the kind of object, such as subnet or route table
+	Kind string
+	ID   string
+	// Deleted is true if the object has been deleted
+	Deleted bool
+}
+
+// VPN composes the Resource interface, and describes a VPN in any CSP,
+// such as a Client VPN endpoint or a Site-to-Site VPN connection in AWS.
+type VPN interface {
+	Resource
+	Name() string
+	// Kind is the kind of VPN, such as Client VPN or Site-to-Site VPN
+	Kind() string
+	// Associations is the number of networks the VPN is associated with,
+	// or -1 if the kind of VPN doesn't have any
+	Associations() int
+	// LastUsed is the last day with any connections or traffic, or the
+	// zero time if there were none in the days searched
+	LastUsed() time.Time
+}
+
+// MLResource composes the Resource interface, and describes a machine
+// learning resource which is billed for its instances while it runs in
+// any CSP, such as a SageMaker notebook instance, endpoint or Studio app
+// in AWS.
+type MLResource interface {
+	Resource
+	Name() string
+	// Kind is the kind of resource, such as notebook instance or endpoint
+	Kind() string
+	// Instances is the number of instances of every instance type the
+	// resource runs on
+	Instances() map[string]int
+	// UserName is the user of the ML studio the resource belongs to, or
+	// an empty string if it doesn't belong to one
+	UserName() string
+	// LastUsed is the last time the resource was used, or the zero time
+	// if it wasn't used in the days searched
+	LastUsed() time.Time
+	// Stoppable is true if the resource can be stopped instead of deleted
+	Stoppable() bool
+	// Stop stops the resource, so that its instances are no longer
+	// billed, keeping it to be started again. Resources which can't be
+	// stopped return an error.
+	Stop() error
+}
+
+// DataCluster composes the Resource interface, and describes a cluster
+// for processing data in any CSP, such as an EMR cluster in AWS, which is
+// billed for its instances whether it runs any work or not.
+type DataCluster interface {
+	Resource
+	Name() string
+	// OnDemandInstances and SpotInstances are the number of running
+	// instances of every instance type in the cluster
+	OnDemandInstances() map[string]int
+	SpotInstances() map[string]int
+	// LastActive is the last time the cluster ran any work, or the zero
+	// time if it didn't in the hours searched
+	LastActive() time.Time
+	// TerminationProtected is true if the cluster can't be cleaned up
+	// before the protection is turned off
+	TerminationProtected() bool
+}
+
+// TransitGateway describes a hub connecting networks in any CSP, such as
+// a transit gateway in AWS. Only the attachments and routes of a transit
+// gateway are cleaned up, never the gateway itself, so it is not a
+// Resource.
+type TransitGateway interface {
+	CSP() CSP
+	Owner() string
+	ID() string
+	Location() string
+	Name() string
+	// Attachments are the attachments of networks to the gateway
+	Attachments() []*TransitGatewayAttachment
+	// BlackholeRoutes are the routes of the gateway to attachments which
+	// no longer exist
+	BlackholeRoutes() []*TransitGatewayRoute
+	// Detach deletes an attachment of the gateway
+	Detach(attachment *TransitGatewayAttachment) error
+	// DeleteRoute deletes a static route of the gateway
+	DeleteRoute(route *TransitGatewayRoute) error
+}
+
+// TransitGatewayAttachment is an attachment of a network, which may be in
+// another account, to a transit gateway
+type TransitGatewayAttachment struct {
+	ID   string
+	Tags map[string]string
+	// NetworkID and NetworkOwner are the ID and account of the network
+	NetworkID    string
+	NetworkOwner string
+	// NetworkKnown is true if the network could be looked up, which is
+	// only done in the accounts of the manager
+	NetworkKnown bool
+	// NetworkExists is true if the network still exists
+	NetworkExists bool
+	// NetworkInterfaces is the number of network interfaces in the
+	// network, apart from the ones of transit gateway attachments
+	NetworkInterfaces int
+	// Detached is true if the attachment has been deleted
+	Detached bool
+}
+
+// TransitGatewayRoute is a route in a route table of a transit gateway
+type TransitGatewayRoute struct {
+	RouteTableID string
+	// Destination is the CIDR or prefix list the route is for
+	Destination string
+	// Static is true if the route was added to the route table, instead
+	// of being propagated from an attachment. Only static routes to a
+	// CIDR can be deleted.
+	Static bool
+	// Deleted is true if the route has been deleted
+	Deleted bool
+}
+
+// EncryptedCopier is implemented by volumes and snapshots which can be
+// copied into an encrypted snapshot. Not every CSP supports this, so use
+// a type assertion on the Volume or Snapshot to check for support.
+type EncryptedCopier interface {
+	// CopyEncrypted creates an encrypted snapshot of the resource, tagged
+	// with the specified tags, and returns the ID of the new snapshot
+	CopyEncrypted(tags map[string]string) (string, error)
+}
+
+// Archiver is implemented by snapshots which can be moved to a cheaper
+// archive storage tier. Not every CSP supports this, so use a type
+// assertion on the Snapshot to check for support.
+type Archiver interface {
+	// Archive moves the resource to the archive storage tier
+	Archive() error
+}
+
+// PriceRecorder is implemented by instances with a recorded price, such
+// as instances read from an inventory, so that the price doesn't have to
+// be looked up again.
+type PriceRecorder interface {
+	// RecordedPricePerHour returns the recorded price in USD per hour
+	RecordedPricePerHour() float64
+}
+
+// SecurityGroupManager is implemented by resource managers which can
+// list security groups. Not every CSP supports this, so use a type
+// assertion on the ResourceManager to check for support.
+type SecurityGroupManager interface {
+	// ForEachAccountSecurityGroups calls the specified function with all
+	// security groups in one account/project at a time. The function is
+	// never called concurrently.
+	ForEachAccountSecurityGroups(func(account string, groups []SecurityGroup))
+}
+
+// FileSystemManager is implemented by resource managers which can list
+// file systems. Not every CSP supports this, so use a type assertion on
+// the ResourceManager to check for support.
+type FileSystemManager interface {
+	// ForEachAccountFileSystems calls the specified function with all
+	// file systems in one account/project at a time. IO in the last
+	// ioDays days is looked up to find when every file system was last
+	// used. The function is never called concurrently.
+	ForEachAccountFileSystems(ioDays int, f func(account string, fileSystems []FileSystem))
+}
+
+// NetworkManager is implemented by resource managers which can list
+// networks. Not every CSP supports this, so use a type assertion on the
+// ResourceManager to check for support.
+type NetworkManager interface {
+	// ForEachAccountNetworks calls the specified function with all
+	// networks, except the default ones, in one account/project at a
+	// time. Networks created in the last createdDays days are looked up
+	// to find their creation time, which is the zero time for the others.
+	// The function is never called concurrently.
+	ForEachAccountNetworks(createdDays int, f func(account string, networks []Network))
+}
+
+// VPNManager is implemented by resource managers which can list VPNs.
+// Not every CSP supports this, so use a type assertion on the
+// ResourceManager to check for support.
+type VPNManager interface {
+	// ForEachAccountVPNs calls the specified function with all VPNs in
+	// one account/project at a time. Connections and traffic in the last
+	// usageDays days are looked up to find when every VPN was last used.
+	// The function is never called concurrently.
+	ForEachAccountVPNs(usageDays int, f func(account string, vpns []VPN))
+}
+
+// MLManager is implemented by resource managers which can list machine
+// learning resources. Not every CSP supports this, so use a type
+// assertion on the ResourceManager to check for support.
+type MLManager interface {
+	// ForEachAccountMLResources calls the specified function with all
+	// running machine learning resources in one account/project at a
+	// time. Use in the last usageDays days is looked up to find when
+	// every resource was last used. The function is never called
+	// concurrently.
+	ForEachAccountMLResources(usageDays int, f func(account string, resources []MLResource))
+}
+
+// DataClusterManager is implemented by resource managers which can list
+// data processing clusters. Not every CSP supports this, so use a type
+// assertion on the ResourceManager to check for support.
+type DataClusterManager interface {
+	// ForEachAccountDataClusters calls the specified function with all
+	// running data processing clusters in one account/project at a time.
+	// Activity in the last activeHours hours is looked up to find when
+	// every cluster was last active. The function is never called
+	// concurrently.
+	ForEachAccountDataClusters(activeHours int, f func(account string, clusters []DataCluster))
+}
+
+// TransitGatewayManager is implemented by resource managers which can
+// list transit gateways. Not every CSP supports this, so use a type
+// assertion on the ResourceManager to check for support.
+type TransitGatewayManager interface {
+	// ForEachAccountTransitGateways calls the specified function with all
+	// transit gateways owned by one account/project at a time. The
+	// function is never called concurrently.
+	ForEachAccountTransitGateways(f func(account string, gateways []TransitGateway))
+}
+
+// Alarm describes a monitoring alarm in any CSP, such as a CloudWatch
+// alarm in AWS. The ID of an alarm is its name. Alarms can't be tagged,
+// so they are not Resources.
+type Alarm interface {
+	CSP() CSP
+	Owner() string
+	ID() string
+	Location() string
+	State() string
+	// StateUpdated is when the alarm last changed state
+	StateUpdated() time.Time
+	// MissingResources are the IDs of the resources the alarm is on which
+	// no longer exist. They are only looked up for alarms without data.
+	MissingResources() []string
+	Cleanup() error
+}
+
+// Dashboard describes a monitoring dashboard in any CSP, such as a
+// CloudWatch dashboard in AWS. The ID of a dashboard is its name.
+type Dashboard interface {
+	CSP() CSP
+	Owner() string
+	ID() string
+	Location() string
+	LastModified() time.Time
+	// ViewsKnown is true if it could be looked up when the dashboard was
+	// last viewed
+	ViewsKnown() bool
+	// LastViewed is the last time the dashboard was viewed, or the zero
+	// time if it wasn't viewed in the days searched
+	LastViewed() time.Time
+	Cleanup() error
+}
+
+// MonitoringManager is implemented by resource managers which can list
+// alarms and dashboards. Not every CSP supports this, so use a type
+// assertion on the ResourceManager to check for support.
+type MonitoringManager interface {
+	// ForEachAccountMonitoring calls the specified function with all
+	// alarms and dashboards in one account/project at a time. Views in
+	// the last viewDays days are looked up to find when every dashboard
+	// was last viewed, zero or less means they are not looked up. The
+	// function is never called concurrently.
+	ForEachAccountMonitoring(viewDays int, f func(account string, alarms []Alarm, dashboards []Dashboard))
+}
+
+// QuotaManager is implemented by resource managers which can look up
+// service quotas and how much of them is used. Not every CSP supports
+// this, so use a type assertion on the ResourceManager to check for
+// support.
+type QuotaManager interface {
+	// ForEachAccountQuotas calls the specified function with the usage
+	// of the quotas in every region of one account/project at a time.
+	// The function is never called concurrently.
+	ForEachAccountQuotas(f func(account string, quotas []QuotaUsage))
+}
+
+// ImageBuild is a build of an image pipeline, such as an EC2 Image
+// Builder image or a Packer build, with the images it produced
+type ImageBuild struct {
+	// Account is the account/project the build ran in, or empty if it's
+	// unknown
+	Account string
+	// Recipe is what the image was built from, such as the name of an
+	// Image Builder recipe or of a Packer build
+	Recipe  string
+	Version string
+	Created time.Time
+	// ImageIDs are the IDs of the images produced, in every location
+	// they were distributed to
+	ImageIDs []string
+}
+
+// ImageBuildManager is implemented by resource managers which can list
+// the builds of image pipelines. Not every CSP supports this, so use a
+// type assertion on the ResourceManager to check for support.
+type ImageBuildManager interface {
+	// ForEachAccountImageBuilds calls the specified function with all
+	// successful image builds in one account/project at a time. The
+	// function is never called concurrently.
+	ForEachAccountImageBuilds(f func(account string, builds []ImageBuild))
+}
+
+// LifecyclePolicy is a policy which creates snapshots on a schedule and
+// deletes them once they are no longer retained, such as an Amazon Data
+// Lifecycle Manager policy
+type LifecyclePolicy struct {
+	Account     string
+	Location    string
+	ID          string
+	Description string
+	// Enabled is false if the policy is disabled or in an error state, in
+	// which case it neither creates nor deletes snapshots
+	Enabled   bool
+	Schedules []LifecycleSchedule
+}
+
+// LifecycleSchedule is a schedule of a lifecycle policy, with how long
+// the snapshots it creates are retained. Snapshots are retained either
+// for a number of days or until a number of newer ones were created.
+type LifecycleSchedule struct {
+	Name string
+	// RetainDays is how many days snapshots are retained, zero if they
+	// are retained by count
+	RetainDays int
+	// RetainCount is how many of the latest snapshots are retained, zero
+	// if they are retained by age
+	RetainCount int
+	// IntervalHours is how often snapshots are created, zero if the
+	// schedule is a cron expression
+	IntervalHours int
+}
+
+// RetentionDays returns for how many days the snapshots of the schedule
+// are retained. For schedules retaining a number of snapshots, it's
+// estimated from how often they are created. Zero is returned if it
+// can't be estimated.
+func (s LifecycleSchedule) RetentionDays() int {
+	if s.RetainDays > 0 {
+		return s.RetainDays
+	}
+	hours := s.RetainCount * s.IntervalHours
+	return (hours + 23) / 24
+}
+
+// LifecyclePolicyManager is implemented by resource managers which can
+// list the lifecycle policies managing snapshots. Not every CSP supports
+// this, so use a type assertion on the ResourceManager to check for
+// support.
+type LifecyclePolicyManager interface {
+	// ForEachAccountLifecyclePolicies calls the specified function with
+	// the lifecycle policies in every region of one account/project at a
+	// time. The function is never called concurrently.
+	ForEachAccountLifecyclePolicies(f func(account string, policies []LifecyclePolicy))
 }
 
 // ResourceCollection encapsulates collections of multiple resources. Does not
@@ -145,6 +647,32 @@ type AllResourceCollection struct {
 	Buckets   []Bucket
 }
 
+// Resources returns every resource in the collection, all instances
+// first, then images, volumes, snapshots and buckets. A nil collection
+// has no resources.
+func (c *AllResourceCollection) Resources() []Resource {
+	resources := []Resource{}
+	if c == nil {
+		return resources
+	}
+	for _, res := range c.Instances {
+		resources = append(resources, res)
+	}
+	for _, res := range c.Images {
+		resources = append(resources, res)
+	}
+	for _, res := range c.Volumes {
+		resources = append(resources, res)
+	}
+	for _, res := range c.Snapshots {
+		resources = append(resources, res)
+	}
+	for _, res := range c.Buckets {
+		resources = append(resources, res)
+	}
+	return resources
+}
+
 // CSP represent a cloud service provider, such as AWS
 type CSP string
 
@@ -153,55 +681,203 @@ const (
 	AWS CSP = "AWS"
 	// GCP is Google Cloud Platform
 	GCP CSP = "GCP"
+	// Azure is Microsoft Azure
+	Azure CSP = "Azure"
+	// Kubernetes is Kubernetes clusters, where every cluster is an account
+	Kubernetes CSP = "Kubernetes"
+	// VSphere is VMware vSphere, where every vCenter is an account
+	VSphere CSP = "vSphere"
 )
 
-// NewManager will build a new resource manager for the specified CSP
+// ManagerConfig holds optional settings used when building a resource
+// manager. The zero value is valid and gives the default behavior.
+type ManagerConfig struct {
+	// Context cancels the requests made while listing resources once it
+	// is done, e.g. when a program embedding Cloudsweeper shuts down. The
+	// accounts/projects listed then are left out, like those which timed
+	// out. Nil means context.Background().
+	Context context.Context
+	// AccountParallelism is the maximum number of accounts/projects
+	// processed at the same time. Zero or less means no limit.
+	AccountParallelism int
+	// DisabledResourceTypes are the resource types, such as instances,
+	// which are never discovered in any account/project, and so never
+	// marked or cleaned up either.
+	DisabledResourceTypes []string
+	// OwnerDisabledResourceTypes maps accounts/projects to the resource
+	// types which are disabled in only them.
+	OwnerDisabledResourceTypes map[string][]string
+	// AccountTimeout is how long an account/project may be processed
+	// before the requests made in it are canceled, and the run continues
+	// without it. Zero or less means no limit.
+	AccountTimeout time.Duration
+	// RegionTimeout is how long a region of an AWS account, or a zone of
+	// a GCP project, may be processed before the run continues without
+	// it. Zero or less means no limit.
+	RegionTimeout time.Duration
+	// AWSConfigAggregator is the name of an AWS Config aggregator in the
+	// master account. If set, instances and volumes are read from it
+	// instead of calling the EC2 APIs in every region of every account.
+	AWSConfigAggregator string
+	// AWSConfigAggregatorRegion is the region of the aggregator. Defaults
+	// to us-west-2.
+	AWSConfigAggregatorRegion string
+	// AWSLastUsedDays is how many days of CloudTrail events are searched
+	// to find when AMIs and snapshots were last used. CloudTrail keeps 90
+	// days of events. Zero or less means the last use is not looked up.
+	AWSLastUsedDays int
+	// AWSLastTaggedDays is how many days of CloudTrail events are searched
+	// to find when the tags of resources were last changed. Zero or less
+	// means it's not looked up.
+	AWSLastTaggedDays int
+	// AWSBucketReadDays is how many days of S3 server access logs are
+	// searched to find when a bucket was last read. Only buckets with
+	// access logging enabled can be checked. Zero or less means the
+	// access logs are not searched.
+	AWSBucketReadDays int
+	// AWSOwnCredentials makes the default AWS credentials, such as the
+	// ones of the user running Cloudsweeper, be used to access accounts,
+	// instead of assuming the Cloudsweeper role in every account.
+	AWSOwnCredentials bool
+	// AWSRegionParallelism is the maximum number of regions of an account
+	// processed at the same time, to avoid being throttled. Only regions
+	// enabled in the account are processed. Zero or less means no limit.
+	AWSRegionParallelism int
+	// AWSReleaseElasticIPs makes the Elastic IPs of terminated instances
+	// be released. Otherwise they are only reported, and kept allocated.
+	AWSReleaseElasticIPs bool
+	// AWSClients builds the EC2, S3 and STS clients used to discover, tag
+	// and delete resources, e.g. to simulate failures of the AWS APIs in
+	// tests. Nil means the clients of the AWS SDK.
+	AWSClients AWSClients
+	// GCPImpersonationChain is a list of service accounts to impersonate
+	// when accessing GCP. The last service account is the one used to
+	// access the projects, any before it are delegates impersonated in
+	// order. This allows one central service account to access all
+	// projects without any per-project keys, similar to assuming roles
+	// in AWS.
+	GCPImpersonationChain []string
+	// GCPQuotaProject is the project which is billed for, and whose quota
+	// is used by, all GCP API calls.
+	GCPQuotaProject string
+	// KubernetesClusters maps the name of every Kubernetes cluster, which
+	// is used as its account, to how its API server is accessed.
+	KubernetesClusters map[string]KubernetesCluster
+	// KubernetesIdleDays is the number of days without any new pods, jobs
+	// or replica sets before a namespace is considered idle. Namespaces
+	// with running pods or available replicas are never idle. Defaults
+	// to 14.
+	KubernetesIdleDays int
+	// KubernetesOwnerLabel is the namespace label holding the username of
+	// the owner of everything in the namespace. Defaults to "owner".
+	KubernetesOwnerLabel string
+	// VSphereServers maps the name of every vCenter, which is used as its
+	// account, to how its SDK is accessed.
+	VSphereServers map[string]VSphereServer
+}
+
+// NewManager will build a new resource manager for the specified CSP.
+// Apart from AWS and GCP, any CSP added with RegisterProvider can be used.
 func NewManager(c CSP, accounts ...string) (ResourceManager, error) {
-	switch c {
-	case AWS:
-		log.Println("Initializing AWS Resource Manager")
-		manager := &awsResourceManager{
-			accounts: accounts,
-		}
-		return manager, nil
-	case GCP:
-		log.Println("Initializing GCP Resource Manager")
-		client, err := getGCPHttpClient()
-		if err != nil {
-			return nil, err
-		}
-		computeService, err := compute.New(client)
-		if err != nil {
-			return nil, fmt.Errorf("Could not initialize compute service: %s", err)
-		}
-		storageService, err := storage.New(client)
-		if err != nil {
-			return nil, fmt.Errorf("Coult not initialize storage service: %s", err)
-		}
-		manager := &gcpResourceManager{
-			projects: accounts,
-			compute:  computeService,
-			storage:  storageService,
-		}
-		return manager, nil
-	default:
+	return NewManagerWithConfig(c, nil, accounts...)
+}
+
+// NewManagerWithConfig will build a new resource manager for the specified
+// CSP, using the specified config. A nil config is the same as the zero value.
+func NewManagerWithConfig(c CSP, conf *ManagerConfig, accounts ...string) (ResourceManager, error) {
+	if conf == nil {
+		conf = new(ManagerConfig)
+	}
+	factory, exist := providerFactory(c)
+	if !exist {
 		return nil, fmt.Errorf("Invalid CSP specified: %s", c)
 	}
+	return factory(conf, accounts...)
 }
 
-func getGCPHttpClient() (*http.Client, error) {
-	credsFile, exist := os.LookupEnv(GcpCredentialsFileKey)
-	if !exist {
-		log.Println("No GCP credentials specified, using default")
-		return oauth2.DefaultClient(context.Background(), scopeGCPCompute, scopeGCPStorage)
+func newAWSManager(conf *ManagerConfig, accounts ...string) (ResourceManager, error) {
+	log.Println("Initializing AWS Resource Manager")
+	awsUseOwnCredentials = conf.AWSOwnCredentials
+	awsRegionParallelism = conf.AWSRegionParallelism
+	awsReleaseElasticIPs = conf.AWSReleaseElasticIPs
+	awsClients = conf.AWSClients
+	if awsClients == nil {
+		awsClients = awsSDKClients{}
+	}
+	awsTimeouts = newScopeTimeouts(conf.Context, conf.AccountTimeout, conf.RegionTimeout)
+	manager := &awsResourceManager{
+		accounts:       accounts,
+		parallelism:    conf.AccountParallelism,
+		inventory:      newAWSConfigInventory(conf.AWSConfigAggregator, conf.AWSConfigAggregatorRegion),
+		usage:          newAWSUsageLookup(conf.AWSLastUsedDays),
+		tagging:        newAWSTagLookup(conf.AWSLastTaggedDays),
+		bucketReadDays: conf.AWSBucketReadDays,
+		types:          newResourceTypeSwitches(conf),
 	}
-	creds, err := ioutil.ReadFile(credsFile)
+	return manager, nil
+}
+
+func newGCPManager(conf *ManagerConfig, accounts ...string) (ResourceManager, error) {
+	log.Println("Initializing GCP Resource Manager")
+	clientOpts, err := gcpClientOptions(conf)
 	if err != nil {
-		return nil, fmt.Errorf("Could not read GCP credentials JSON: %s", err)
+		return nil, fmt.Errorf("Could not initialize GCP credentials: %s", err)
 	}
-	conf, err := oauth2.JWTConfigFromJSON(creds, scopeGCPCompute, scopeGCPStorage)
+	// The API calls are counted by the base of the authenticated transport
+	transport, err := htransport.NewTransport(context.Background(), &gcpAPICallCounter{http.DefaultTransport}, clientOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("Could not get GCP credentials: %s", err)
+		return nil, fmt.Errorf("Could not initialize GCP credentials: %s", err)
+	}
+	opts := []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: transport})}
+	computeService, err := compute.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize compute service: %s", err)
+	}
+	storageService, err := storage.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Coult not initialize storage service: %s", err)
+	}
+	manager := &gcpResourceManager{
+		projects:    accounts,
+		parallelism: conf.AccountParallelism,
+		compute:     computeService,
+		storage:     storageService,
+		types:       newResourceTypeSwitches(conf),
+		timeouts:    newScopeTimeouts(conf.Context, conf.AccountTimeout, conf.RegionTimeout),
+	}
+	return manager, nil
+}
+
+// gcpClientOptions returns the options of the GCP clients. When service
+// accounts are impersonated, the credentials file or default credentials
+// are only used to get tokens of the impersonated service account.
+func gcpClientOptions(conf *ManagerConfig) ([]option.ClientOption, error) {
+	scopes := []string{scopeGCPCompute, scopeGCPStorage}
+	credentials := []option.ClientOption{}
+	if credsFile, exist := os.LookupEnv(GcpCredentialsFileKey); exist {
+		credentials = append(credentials, option.WithCredentialsFile(credsFile))
+	} else {
+		log.Println("No GCP credentials specified, using default")
+	}
+	opts := []option.ClientOption{}
+	if n := len(conf.GCPImpersonationChain); n > 0 {
+		target := conf.GCPImpersonationChain[n-1]
+		log.Printf("Impersonating GCP service account %s", target)
+		tokens, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: target,
+			Delegates:       conf.GCPImpersonationChain[:n-1],
+			Scopes:          scopes,
+		}, credentials...)
+		if err != nil {
+			return nil, fmt.Errorf("Could not impersonate GCP service account %s: %s", target, err)
+		}
+		opts = append(opts, option.WithTokenSource(tokens))
+	} else {
+		opts = append(opts, option.WithScopes(scopes...))
+		opts = append(opts, credentials...)
+	}
+	if conf.GCPQuotaProject != "" {
+		opts = append(opts, option.WithQuotaProject(conf.GCPQuotaProject))
 	}
-	return conf.Client(context.Background()), nil
+	return opts, nil
 }
@@ -0,0 +1,313 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+)
+
+const (
+	awsEventRunInstances = "RunInstances"
+	awsEventCreateVolume = "CreateVolume"
+
+	// awsCloudTrailMaxDays is how far back the CloudTrail event history goes
+	awsCloudTrailMaxDays = 90
+)
+
+// awsUsageLookup finds when AMIs and snapshots were last used, by going
+// through RunInstances and CreateVolume events in the CloudTrail event
+// history. Events are looked up once per account and region.
+type awsUsageLookup struct {
+	since time.Time
+
+	mutex   sync.Mutex
+	regions map[string]*awsRegionUsage
+}
+
+type awsRegionUsage struct {
+	once     sync.Once
+	lastUsed map[string]time.Time
+}
+
+type awsRunInstancesEvent struct {
+	RequestParameters struct {
+		InstancesSet struct {
+			Items []struct {
+				ImageID string `json:"imageId"`
+			} `json:"items"`
+		} `json:"instancesSet"`
+	} `json:"requestParameters"`
+}
+
+type awsCreateVolumeEvent struct {
+	RequestParameters struct {
+		SnapshotID string `json:"snapshotId"`
+	} `json:"requestParameters"`
+}
+
+func newAWSUsageLookup(days int) *awsUsageLookup {
+	if days <= 0 {
+		return nil
+	}
+	if days > awsCloudTrailMaxDays {
+		log.Printf("CloudTrail only keeps %d days of events, not %d", awsCloudTrailMaxDays, days)
+		days = awsCloudTrailMaxDays
+	}
+	return &awsUsageLookup{
+		since:   time.Now().AddDate(0, 0, -days),
+		regions: make(map[string]*awsRegionUsage),
+	}
+}
+
+// enrichImages sets when every image was last used to launch an instance
+func (l *awsUsageLookup) enrichImages(account string, client *awsEC2Client, images []Image) {
+	if l == nil || len(images) == 0 {
+		return
+	}
+	lastUsed := l.lastUsed(account, client)
+	for _, img := range images {
+		if t, ok := lastUsed[img.ID()]; ok {
+			if setter, ok := img.(interface{ setLastUsed(time.Time) }); ok {
+				setter.setLastUsed(t)
+			}
+		}
+	}
+}
+
+// enrichSnapshots sets when every snapshot was last used to create a volume
+func (l *awsUsageLookup) enrichSnapshots(account string, client *awsEC2Client, snapshots []Snapshot) {
+	if l == nil || len(snapshots) == 0 {
+		return
+	}
+	lastUsed := l.lastUsed(account, client)
+	for _, snap := range snapshots {
+		if t, ok := lastUsed[snap.ID()]; ok {
+			if setter, ok := snap.(interface{ setLastUsed(time.Time) }); ok {
+				setter.setLastUsed(t)
+			}
+		}
+	}
+}
+
+// lastUsed returns a mapping from AMI and snapshot IDs to the last time
+// they were used in the region of the client
+func (l *awsUsageLookup) lastUsed(account string, client *awsEC2Client) map[string]time.Time {
+	key := account + "/" + client.region
+	l.mutex.Lock()
+	usage, exist := l.regions[key]
+	if !exist {
+		usage = &awsRegionUsage{}
+		l.regions[key] = usage
+	}
+	l.mutex.Unlock()
+
+	usage.once.Do(func() {
+		usage.lastUsed = make(map[string]time.Time)
+		trail := cloudtrail.New(NewAWSSession(), &aws.Config{
+			Credentials: client.cred,
+			Region:      aws.String(client.region),
+			MaxRetries:  aws.Int(awsMaxRequestRetries),
+		})
+		err := lookupAWSEvents(trail, awsEventRunInstances, l.since, func(eventTime time.Time, raw []byte) {
+			var event awsRunInstancesEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				return
+			}
+			for _, item := range event.RequestParameters.InstancesSet.Items {
+				updateLastUsed(usage.lastUsed, item.ImageID, eventTime)
+			}
+		})
+		if err != nil {
+			status.Warnf("Could not look up %s events in %s (%s): %s", awsEventRunInstances, AccountDisplayName(account), key, err)
+		}
+		err = lookupAWSEvents(trail, awsEventCreateVolume, l.since, func(eventTime time.Time, raw []byte) {
+			var event awsCreateVolumeEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				return
+			}
+			updateLastUsed(usage.lastUsed, event.RequestParameters.SnapshotID, eventTime)
+		})
+		if err != nil {
+			status.Warnf("Could not look up %s events in %s (%s): %s", awsEventCreateVolume, AccountDisplayName(account), key, err)
+		}
+	})
+	return usage.lastUsed
+}
+
+// lookupAWSEvents calls the specified function with the time and raw
+// JSON of every event with the specified name since the specified time
+func lookupAWSEvents(trail *cloudtrail.CloudTrail, eventName string, since time.Time, f func(time.Time, []byte)) error {
+	input := &cloudtrail.LookupEventsInput{
+		StartTime: aws.Time(since),
+		LookupAttributes: []*cloudtrail.LookupAttribute{{
+			AttributeKey:   aws.String(cloudtrail.LookupAttributeKeyEventName),
+			AttributeValue: aws.String(eventName),
+		}},
+	}
+	return trail.LookupEventsPages(input, func(page *cloudtrail.LookupEventsOutput, lastPage bool) bool {
+		for _, event := range page.Events {
+			if event.EventTime == nil || event.CloudTrailEvent == nil {
+				continue
+			}
+			f(*event.EventTime, []byte(*event.CloudTrailEvent))
+		}
+		return true
+	})
+}
+
+func updateLastUsed(lastUsed map[string]time.Time, id string, t time.Time) {
+	if id == "" {
+		return
+	}
+	if t.After(lastUsed[id]) {
+		lastUsed[id] = t
+	}
+}
+
+const (
+	awsEventCreateTags          = "CreateTags"
+	awsEventDeleteTags          = "DeleteTags"
+	awsEventPutBucketTagging    = "PutBucketTagging"
+	awsEventDeleteBucketTagging = "DeleteBucketTagging"
+)
+
+// awsTagLookup finds when the tags of resources were last changed, by
+// going through the tagging events in the CloudTrail event history.
+// Events are looked up once per account and region.
+type awsTagLookup struct {
+	since time.Time
+
+	mutex   sync.Mutex
+	regions map[string]*awsRegionTagging
+}
+
+type awsRegionTagging struct {
+	once       sync.Once
+	lastTagged map[string]time.Time
+}
+
+type awsTagsEvent struct {
+	RequestParameters struct {
+		ResourcesSet struct {
+			Items []struct {
+				ResourceID string `json:"resourceId"`
+			} `json:"items"`
+		} `json:"resourcesSet"`
+	} `json:"requestParameters"`
+}
+
+type awsBucketTaggingEvent struct {
+	RequestParameters struct {
+		BucketName string `json:"bucketName"`
+	} `json:"requestParameters"`
+}
+
+func newAWSTagLookup(days int) *awsTagLookup {
+	if days <= 0 {
+		return nil
+	}
+	if days > awsCloudTrailMaxDays {
+		log.Printf("CloudTrail only keeps %d days of events, not %d", awsCloudTrailMaxDays, days)
+		days = awsCloudTrailMaxDays
+	}
+	return &awsTagLookup{
+		since:   time.Now().AddDate(0, 0, -days),
+		regions: make(map[string]*awsRegionTagging),
+	}
+}
+
+// enrich sets when the tags of every resource of an account were last
+// changed, looking up the events of every region with resources in it
+func (l *awsTagLookup) enrich(account string, cred *credentials.Credentials, compute *ResourceCollection, buckets []Bucket) {
+	if l == nil {
+		return
+	}
+	resources := []Resource{}
+	if compute != nil {
+		for _, inst := range compute.Instances {
+			resources = append(resources, inst)
+		}
+		for _, img := range compute.Images {
+			resources = append(resources, img)
+		}
+		for _, vol := range compute.Volumes {
+			resources = append(resources, vol)
+		}
+		for _, snap := range compute.Snapshots {
+			resources = append(resources, snap)
+		}
+	}
+	for _, buck := range buckets {
+		resources = append(resources, buck)
+	}
+	for _, res := range resources {
+		if res.Location() == "" {
+			continue
+		}
+		lastTagged := l.lastTagged(account, cred, res.Location())
+		if t, ok := lastTagged[res.ID()]; ok {
+			if setter, ok := res.(interface{ setLastTagged(time.Time) }); ok {
+				setter.setLastTagged(t)
+			}
+		}
+	}
+}
+
+// lastTagged returns a mapping from resource IDs, and bucket names, to
+// the last time their tags were changed in a region
+func (l *awsTagLookup) lastTagged(account string, cred *credentials.Credentials, region string) map[string]time.Time {
+	key := account + "/" + region
+	l.mutex.Lock()
+	tagging, exist := l.regions[key]
+	if !exist {
+		tagging = &awsRegionTagging{}
+		l.regions[key] = tagging
+	}
+	l.mutex.Unlock()
+
+	tagging.once.Do(func() {
+		tagging.lastTagged = make(map[string]time.Time)
+		trail := cloudtrail.New(NewAWSSession(), &aws.Config{
+			Credentials: cred,
+			Region:      aws.String(region),
+			MaxRetries:  aws.Int(awsMaxRequestRetries),
+		})
+		for _, eventName := range []string{awsEventCreateTags, awsEventDeleteTags} {
+			err := lookupAWSEvents(trail, eventName, l.since, func(eventTime time.Time, raw []byte) {
+				var event awsTagsEvent
+				if err := json.Unmarshal(raw, &event); err != nil {
+					return
+				}
+				for _, item := range event.RequestParameters.ResourcesSet.Items {
+					updateLastUsed(tagging.lastTagged, item.ResourceID, eventTime)
+				}
+			})
+			if err != nil {
+				status.Warnf("Could not look up %s events in %s (%s): %s", eventName, AccountDisplayName(account), key, err)
+			}
+		}
+		for _, eventName := range []string{awsEventPutBucketTagging, awsEventDeleteBucketTagging} {
+			err := lookupAWSEvents(trail, eventName, l.since, func(eventTime time.Time, raw []byte) {
+				var event awsBucketTaggingEvent
+				if err := json.Unmarshal(raw, &event); err != nil {
+					return
+				}
+				updateLastUsed(tagging.lastTagged, event.RequestParameters.BucketName, eventTime)
+			})
+			if err != nil {
+				status.Warnf("Could not look up %s events in %s (%s): %s", eventName, AccountDisplayName(account), key, err)
+			}
+		}
+	})
+	return tagging.lastTagged
+}
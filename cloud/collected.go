@@ -0,0 +1,36 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+// NewCollectedManager returns a resource manager serving resources which
+// were already discovered, so that they can be evaluated several times
+// without discovering them again. Unlike the resources of a recorded
+// inventory, they can still be tagged and cleaned up.
+func NewCollectedManager(accounts []*AllResourceCollection) ResourceManager {
+	return &collectedResourceManager{inventoryResourceManager{accounts: accounts}}
+}
+
+type collectedResourceManager struct {
+	inventoryResourceManager
+}
+
+func (m *collectedResourceManager) CleanupInstances(instances []Instance) error {
+	return cleanupInstances(instances)
+}
+
+func (m *collectedResourceManager) CleanupImages(images []Image) error {
+	return cleanupImages(images)
+}
+
+func (m *collectedResourceManager) CleanupVolumes(volumes []Volume) error {
+	return cleanupVolumes(volumes)
+}
+
+func (m *collectedResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
+	return cleanupSnapshots(snapshots)
+}
+
+func (m *collectedResourceManager) CleanupBuckets(buckets []Bucket) error {
+	return cleanupBuckets(buckets)
+}
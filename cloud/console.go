@@ -0,0 +1,128 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// AWSConsoleSSOStartURL is the start URL of AWS IAM Identity Center,
+	// e.g. https://example.awsapps.com/start. If set, links to the AWS
+	// console sign in to the account of the resource first.
+	AWSConsoleSSOStartURL = ""
+	// AWSConsoleSSORole is the permission set signed in with
+	AWSConsoleSSORole = ""
+)
+
+const (
+	awsEC2ConsoleTemplate = "https://%[1]s.console.aws.amazon.com/ec2/home?region=%[1]s#%s"
+	awsConsoleTemplate    = "https://%[1]s.console.aws.amazon.com/%s/home?region=%[1]s#%s"
+	awsS3ConsoleTemplate  = "https://s3.console.aws.amazon.com/s3/buckets/%s"
+	gcpConsoleTemplate    = "https://console.cloud.google.com/%s?project=%s"
+)
+
+// consoleResource is what every resource, alarm and dashboard has, which
+// is enough to find it in the console
+type consoleResource interface {
+	CSP() CSP
+	Owner() string
+	ID() string
+	Location() string
+}
+
+// ConsoleURL returns the URL of the page of a resource, alarm or
+// dashboard in the console of its CSP, or an empty string if there is
+// none. AWS console URLs are in the region of the resource, but signed
+// in to whatever account the user last was, unless AWSConsoleSSOStartURL
+// is set.
+func ConsoleURL(v interface{}) string {
+	res, ok := v.(consoleResource)
+	if !ok {
+		return ""
+	}
+	switch res.CSP() {
+	case AWS:
+		path := awsConsolePath(res)
+		if path == "" || AWSConsoleSSOStartURL == "" {
+			return path
+		}
+		return fmt.Sprintf("%s/#/console?account_id=%s&role_name=%s&destination=%s",
+			strings.TrimSuffix(AWSConsoleSSOStartURL, "/"), url.QueryEscape(res.Owner()), url.QueryEscape(AWSConsoleSSORole), url.QueryEscape(path))
+	case GCP:
+		return gcpConsolePath(res)
+	}
+	return ""
+}
+
+func awsConsolePath(res consoleResource) string {
+	region, id := res.Location(), url.PathEscape(res.ID())
+	switch r := res.(type) {
+	case Instance:
+		return fmt.Sprintf(awsEC2ConsoleTemplate, region, "InstanceDetails:instanceId="+id)
+	case Image:
+		return fmt.Sprintf(awsEC2ConsoleTemplate, region, "ImageDetails:imageId="+id)
+	case Volume:
+		return fmt.Sprintf(awsEC2ConsoleTemplate, region, "VolumeDetails:volumeId="+id)
+	case Snapshot:
+		return fmt.Sprintf(awsEC2ConsoleTemplate, region, "SnapshotDetails:snapshotId="+id)
+	case Bucket:
+		return fmt.Sprintf(awsS3ConsoleTemplate, id)
+	case SecurityGroup:
+		return fmt.Sprintf(awsEC2ConsoleTemplate, region, "SecurityGroup:groupId="+id)
+	case FileSystem:
+		if strings.HasPrefix(r.Kind(), "FSx") {
+			return fmt.Sprintf(awsConsoleTemplate, region, "fsx", "file-system-details/"+id)
+		}
+		return fmt.Sprintf(awsConsoleTemplate, region, "efs", "/file-systems/"+id)
+	case Network:
+		return fmt.Sprintf(awsConsoleTemplate, region, "vpc", "VpcDetails:VpcId="+id)
+	case VPN:
+		if r.Kind() == awsVPNKindClient {
+			return fmt.Sprintf(awsConsoleTemplate, region, "vpc", "ClientVPNEndpoints:search="+id)
+		}
+		return fmt.Sprintf(awsConsoleTemplate, region, "vpc", "VpnConnections:search="+id)
+	case DataCluster:
+		return fmt.Sprintf(awsConsoleTemplate, region, "emr", "/clusterDetails/"+id)
+	case MLResource:
+		switch r.Kind() {
+		case awsMLKindNotebook:
+			return fmt.Sprintf(awsConsoleTemplate, region, "sagemaker", "/notebook-instances/"+id)
+		case awsMLKindEndpoint:
+			return fmt.Sprintf(awsConsoleTemplate, region, "sagemaker", "/endpoints/"+id)
+		case awsMLKindStudioApp:
+			if parts := strings.Split(res.ID(), "/"); len(parts) == 4 {
+				return fmt.Sprintf(awsConsoleTemplate, region, "sagemaker", "/studio/"+url.PathEscape(parts[0])+"/user/"+url.PathEscape(parts[1]))
+			}
+		}
+	case TransitGateway:
+		return fmt.Sprintf(awsConsoleTemplate, region, "vpc", "TransitGateways:transitGatewayId="+id)
+	case Alarm:
+		return fmt.Sprintf(awsConsoleTemplate, region, "cloudwatch", "alarmsV2:alarm/"+id)
+	case Dashboard:
+		return fmt.Sprintf(awsConsoleTemplate, region, "cloudwatch", "dashboards:name="+id)
+	}
+	return ""
+}
+
+func gcpConsolePath(res consoleResource) string {
+	project, location, id := url.QueryEscape(res.Owner()), url.PathEscape(res.Location()), url.PathEscape(res.ID())
+	switch res.(type) {
+	case Instance:
+		return fmt.Sprintf(gcpConsoleTemplate, "compute/instancesDetail/zones/"+location+"/instances/"+id, project)
+	case Image:
+		return fmt.Sprintf(gcpConsoleTemplate, "compute/imagesDetail/projects/"+project+"/global/images/"+id, project)
+	case Volume:
+		return fmt.Sprintf(gcpConsoleTemplate, "compute/disksDetail/zones/"+location+"/disks/"+id, project)
+	case Snapshot:
+		return fmt.Sprintf(gcpConsoleTemplate, "compute/snapshotsDetail/projects/"+project+"/global/snapshots/"+id, project)
+	case Bucket:
+		return fmt.Sprintf(gcpConsoleTemplate, "storage/browser/"+id, project)
+	case SecurityGroup:
+		return fmt.Sprintf(gcpConsoleTemplate, "networking/firewalls/details/"+id, project)
+	}
+	return ""
+}
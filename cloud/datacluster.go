@@ -0,0 +1,270 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/emr"
+)
+
+// awsEMRMetricPeriod is how often EMR reports the metrics of a cluster
+const awsEMRMetricPeriod = 5 * 60
+
+// awsMaxMetricDatapoints is the maximum number of datapoints returned by
+// one request for metric statistics
+const awsMaxMetricDatapoints = 1440
+
+type baseDataCluster struct {
+	baseResource
+	name                 string
+	onDemandInstances    map[string]int
+	spotInstances        map[string]int
+	lastActive           time.Time
+	terminationProtected bool
+}
+
+func (c *baseDataCluster) Name() string {
+	return c.name
+}
+
+func (c *baseDataCluster) OnDemandInstances() map[string]int {
+	return c.onDemandInstances
+}
+
+func (c *baseDataCluster) SpotInstances() map[string]int {
+	return c.spotInstances
+}
+
+func (c *baseDataCluster) LastActive() time.Time {
+	return c.lastActive
+}
+
+func (c *baseDataCluster) TerminationProtected() bool {
+	return c.terminationProtected
+}
+
+// AWS
+
+type awsEMRCluster struct {
+	baseDataCluster
+}
+
+func (c *awsEMRCluster) client() *emr.EMR {
+	sess := NewAWSSession()
+	return emr.New(sess, &aws.Config{
+		Credentials: awsAccountCredentials(sess, c.Owner()),
+		Region:      aws.String(c.Location()),
+	})
+}
+
+// Cleanup terminates the cluster. Data in HDFS on the cluster is lost,
+// while data in S3 is kept.
+func (c *awsEMRCluster) Cleanup() error {
+	log.Printf("Cleaning up EMR cluster %s in %s", c.ID(), c.Owner())
+	if c.TerminationProtected() {
+		return fmt.Errorf("%s is termination protected", c.ID())
+	}
+	_, err := c.client().TerminateJobFlows(&emr.TerminateJobFlowsInput{
+		JobFlowIds: aws.StringSlice([]string{c.ID()}),
+	})
+	return err
+}
+
+func (c *awsEMRCluster) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
+	if _, exist := c.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, c.ID())
+	}
+	_, err := c.client().AddTags(&emr.AddTagsInput{
+		ResourceId: aws.String(c.ID()),
+		Tags:       []*emr.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	})
+	if err != nil {
+		return err
+	}
+	c.tags[key] = value
+	return nil
+}
+
+func (c *awsEMRCluster) RemoveTag(key string) error {
+	key, exist := Tags(c.tags).Key(key)
+	if !exist {
+		return nil
+	}
+	_, err := c.client().RemoveTags(&emr.RemoveTagsInput{
+		ResourceId: aws.String(c.ID()),
+		TagKeys:    aws.StringSlice([]string{key}),
+	})
+	if err != nil {
+		return err
+	}
+	delete(c.tags, key)
+	return nil
+}
+
+func (m *awsResourceManager) ForEachAccountDataClusters(activeHours int, f func(string, []DataCluster)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		clusters := []DataCluster{}
+		var clustersMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			config := &aws.Config{Credentials: cred, Region: aws.String(client.region)}
+			region := client.region
+			emrClient := emr.New(sess, config)
+			regionClusters, err := getAWSEMRClusters(account, emrClient)
+			if err != nil {
+				status.Warnf("Could not list EMR clusters in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			cw := cloudwatch.New(sess, config)
+			for _, cluster := range regionClusters {
+				setAWSEMRClusterLastActive(emrClient, cw, cluster, activeHours)
+			}
+			clustersMutex.Lock()
+			defer clustersMutex.Unlock()
+			for _, cluster := range regionClusters {
+				clusters = append(clusters, cluster)
+			}
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, clusters)
+	})
+}
+
+// getAWSEMRClusters will get the running and waiting EMR clusters in the
+// current region, with their running instances
+func getAWSEMRClusters(account string, client *emr.EMR) ([]*awsEMRCluster, error) {
+	region := aws.StringValue(client.Config.Region)
+	ids := []string{}
+	err := client.ListClustersPages(&emr.ListClustersInput{
+		ClusterStates: aws.StringSlice([]string{emr.ClusterStateRunning, emr.ClusterStateWaiting}),
+	}, func(output *emr.ListClustersOutput, lastPage bool) bool {
+		for _, cluster := range output.Clusters {
+			ids = append(ids, aws.StringValue(cluster.Id))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	clusters := []*awsEMRCluster{}
+	for _, id := range ids {
+		output, err := client.DescribeCluster(&emr.DescribeClusterInput{ClusterId: aws.String(id)})
+		if err != nil {
+			return nil, err
+		}
+		description := output.Cluster
+		tags := make(map[string]string)
+		for _, tag := range description.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		cluster := &awsEMRCluster{baseDataCluster{
+			baseResource: baseResource{
+				csp:      AWS,
+				owner:    account,
+				id:       id,
+				location: region,
+				tags:     tags,
+			},
+			name:                 aws.StringValue(description.Name),
+			onDemandInstances:    make(map[string]int),
+			spotInstances:        make(map[string]int),
+			terminationProtected: aws.BoolValue(description.TerminationProtected),
+		}}
+		if description.Status != nil && description.Status.Timeline != nil {
+			cluster.creationTime = aws.TimeValue(description.Status.Timeline.CreationDateTime)
+		}
+		err = client.ListInstancesPages(&emr.ListInstancesInput{
+			ClusterId:      aws.String(id),
+			InstanceStates: aws.StringSlice([]string{emr.InstanceStateRunning}),
+		}, func(output *emr.ListInstancesOutput, lastPage bool) bool {
+			for _, instance := range output.Instances {
+				if aws.StringValue(instance.Market) == emr.MarketTypeSpot {
+					cluster.spotInstances[aws.StringValue(instance.InstanceType)]++
+				} else {
+					cluster.onDemandInstances[aws.StringValue(instance.InstanceType)]++
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// setAWSEMRClusterLastActive sets the last time the cluster ran any work,
+// which is now if it has a pending or running step. Otherwise it's the
+// latest of when its last step ended, and the last time in the last
+// activeHours hours its metrics show steps or YARN applications running.
+// If the steps or metrics can't be read, the cluster is treated as active.
+func setAWSEMRClusterLastActive(client *emr.EMR, cw *cloudwatch.CloudWatch, cluster *awsEMRCluster, activeHours int) {
+	// The steps are listed newest first, so the first page has the last
+	steps, err := client.ListSteps(&emr.ListStepsInput{ClusterId: aws.String(cluster.ID())})
+	if err != nil {
+		status.Warnf("Could not list the steps of %s in %s, treating it as active: %s", cluster.ID(), AccountDisplayName(cluster.Owner()), err)
+		cluster.lastActive = time.Now()
+		return
+	}
+	for _, step := range steps.Steps {
+		if step.Status == nil {
+			continue
+		}
+		state := aws.StringValue(step.Status.State)
+		if state == emr.StepStatePending || state == emr.StepStateRunning {
+			cluster.lastActive = time.Now()
+			return
+		}
+		if step.Status.Timeline != nil && aws.TimeValue(step.Status.Timeline.EndDateTime).After(cluster.lastActive) {
+			cluster.lastActive = aws.TimeValue(step.Status.Timeline.EndDateTime)
+		}
+	}
+
+	// IsIdle is 1 while no steps or YARN applications run, so a minimum
+	// below 1 means the cluster was active some time in the period
+	period := awsEMRMetricPeriod * ((activeHours*60*60/awsEMRMetricPeriod + awsMaxMetricDatapoints - 1) / awsMaxMetricDatapoints)
+	for metric, active := range map[string]func(*cloudwatch.Datapoint) bool{
+		"IsIdle":      func(d *cloudwatch.Datapoint) bool { return aws.Float64Value(d.Minimum) < 1 },
+		"AppsRunning": func(d *cloudwatch.Datapoint) bool { return aws.Float64Value(d.Maximum) > 0 },
+	} {
+		output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/ElasticMapReduce"),
+			MetricName: aws.String(metric),
+			Dimensions: []*cloudwatch.Dimension{{
+				Name:  aws.String("JobFlowId"),
+				Value: aws.String(cluster.ID()),
+			}},
+			StartTime:  aws.Time(time.Now().Add(-time.Duration(activeHours) * time.Hour)),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int64(int64(period)),
+			Statistics: aws.StringSlice([]string{cloudwatch.StatisticMinimum, cloudwatch.StatisticMaximum}),
+		})
+		if err != nil {
+			status.Warnf("Could not read the activity of %s in %s, treating it as active: %s", cluster.ID(), AccountDisplayName(cluster.Owner()), err)
+			cluster.lastActive = time.Now()
+			return
+		}
+		for _, datapoint := range output.Datapoints {
+			// A datapoint covers the period starting at its timestamp
+			end := aws.TimeValue(datapoint.Timestamp).Add(time.Duration(period) * time.Second)
+			if end.After(time.Now()) {
+				end = time.Now()
+			}
+			if active(datapoint) && end.After(cluster.lastActive) {
+				cluster.lastActive = end
+			}
+		}
+	}
+}
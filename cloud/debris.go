@@ -0,0 +1,190 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsMaxDeleteAlarms is the maximum number of alarms deleted per request
+const awsMaxDeleteAlarms = 100
+
+// awsReleaseElasticIPs is set if the Elastic IPs of terminated instances
+// are released, instead of only being reported
+var awsReleaseElasticIPs bool
+
+// ReleasesElasticIPs returns true if the Elastic IPs of terminated
+// instances are released, instead of only being reported
+func ReleasesElasticIPs() bool {
+	return awsReleaseElasticIPs
+}
+
+// ElasticIP is a static public address which was associated with an
+// instance. It's kept, and billed, after the instance is terminated
+// until it's released.
+type ElasticIP struct {
+	PublicIP     string
+	AllocationID string
+	// Released is true if the address has been released
+	Released bool
+}
+
+// InstanceDebris holds the resources which referenced an instance, and
+// which would be left behind when it's terminated
+type InstanceDebris struct {
+	ElasticIPs []*ElasticIP
+	// Alarms are the names of the CloudWatch alarms on the instance
+	Alarms []string
+	// AlarmsDeleted is true if the alarms have been deleted
+	AlarmsDeleted bool
+}
+
+// Empty returns true if nothing referenced the instance
+func (d *InstanceDebris) Empty() bool {
+	return len(d.ElasticIPs) == 0 && len(d.Alarms) == 0
+}
+
+// DebrisReporter is implemented by instances which clean up the resources
+// referencing them when they are terminated. Not every CSP has those, so
+// use a type assertion on the Instance to check for support.
+type DebrisReporter interface {
+	// Debris returns what referenced the instance when it was cleaned up,
+	// or nil if it hasn't been cleaned up
+	Debris() *InstanceDebris
+	// FindDebris finds what references the instance now, which is cleaned
+	// up or left behind when it's terminated
+	FindDebris() *InstanceDebris
+}
+
+// The alarms of a region are listed once and cached, since there is no
+// way to only list the alarms of one instance
+var (
+	awsInstanceAlarms      = make(map[string]map[string][]string)
+	awsInstanceAlarmsMutex sync.Mutex
+)
+
+func (i *awsInstance) Debris() *InstanceDebris {
+	return i.debris
+}
+
+func (i *awsInstance) FindDebris() *InstanceDebris {
+	return i.findDebris()
+}
+
+// findDebris finds the Elastic IPs and alarms of the instance. This has
+// to be done before terminating it, since terminating the instance
+// disassociates its addresses.
+func (i *awsInstance) findDebris() *InstanceDebris {
+	debris := &InstanceDebris{}
+	client := clientForAWSResource(i)
+	output, err := client.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("instance-id"),
+			Values: aws.StringSlice([]string{i.ID()}),
+		}},
+	})
+	if err != nil {
+		status.Warnf("Could not find Elastic IPs of %s in %s: %s", i.ID(), AccountDisplayName(i.Owner()), err)
+	} else {
+		for _, address := range output.Addresses {
+			debris.ElasticIPs = append(debris.ElasticIPs, &ElasticIP{
+				PublicIP:     aws.StringValue(address.PublicIp),
+				AllocationID: aws.StringValue(address.AllocationId),
+			})
+		}
+	}
+
+	alarms, err := awsAlarmsByInstance(i.Owner(), i.Location())
+	if err != nil {
+		status.Warnf("Could not find alarms of %s in %s: %s", i.ID(), AccountDisplayName(i.Owner()), err)
+	} else {
+		debris.Alarms = alarms[i.ID()]
+	}
+	return debris
+}
+
+// cleanupDebris deletes the alarms of the terminated instance, and
+// releases its Elastic IPs if enabled. Failures are only reported, since
+// the instance itself is already gone.
+func (i *awsInstance) cleanupDebris(debris *InstanceDebris) {
+	if len(debris.Alarms) > 0 {
+		cw := awsCloudWatchClient(i.Owner(), i.Location())
+		debris.AlarmsDeleted = true
+		for _, batch := range batchStrings(debris.Alarms, awsMaxDeleteAlarms) {
+			_, err := cw.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+				AlarmNames: aws.StringSlice(batch),
+			})
+			if err != nil {
+				status.ActionFailedf("Could not delete alarms of %s in %s: %s", i.ID(), AccountDisplayName(i.Owner()), err)
+				debris.AlarmsDeleted = false
+			}
+		}
+		if debris.AlarmsDeleted {
+			log.Printf("Deleted %d alarms of %s in %s", len(debris.Alarms), i.ID(), AccountDisplayName(i.Owner()))
+		}
+	}
+
+	if !awsReleaseElasticIPs {
+		return
+	}
+	client := clientForAWSResource(i)
+	for _, address := range debris.ElasticIPs {
+		if address.AllocationID == "" {
+			// EC2-Classic addresses can't be released by allocation
+			continue
+		}
+		// The address may still be associated while the instance is
+		// shutting down, so disassociate it first. This fails if it
+		// already was, which is fine.
+		client.DisassociateAddress(&ec2.DisassociateAddressInput{
+			PublicIp: aws.String(address.PublicIP),
+		})
+		_, err := client.ReleaseAddress(&ec2.ReleaseAddressInput{
+			AllocationId: aws.String(address.AllocationID),
+		})
+		if err != nil {
+			status.ActionFailedf("Could not release Elastic IP %s of %s in %s: %s", address.PublicIP, i.ID(), AccountDisplayName(i.Owner()), err)
+			continue
+		}
+		address.Released = true
+		log.Printf("Released Elastic IP %s of %s in %s", address.PublicIP, i.ID(), AccountDisplayName(i.Owner()))
+	}
+}
+
+// awsAlarmsByInstance returns the names of the metric alarms in a region
+// of an account, keyed by the ID of the instance they are on
+func awsAlarmsByInstance(account, region string) (map[string][]string, error) {
+	key := account + "/" + region
+	awsInstanceAlarmsMutex.Lock()
+	defer awsInstanceAlarmsMutex.Unlock()
+	if alarms, exist := awsInstanceAlarms[key]; exist {
+		return alarms, nil
+	}
+
+	cw := awsCloudWatchClient(account, region)
+	alarms := make(map[string][]string)
+	err := cw.DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{},
+		func(output *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+			for _, alarm := range output.MetricAlarms {
+				for _, dimension := range alarm.Dimensions {
+					if aws.StringValue(dimension.Name) == "InstanceId" {
+						instanceID := aws.StringValue(dimension.Value)
+						alarms[instanceID] = append(alarms[instanceID], aws.StringValue(alarm.AlarmName))
+					}
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	awsInstanceAlarms[key] = alarms
+	return alarms, nil
+}
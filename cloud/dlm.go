@@ -0,0 +1,97 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dlm"
+)
+
+// Hours in the retention interval units of Data Lifecycle Manager. Months
+// and years are approximated.
+var awsDLMRetentionHours = map[string]int{
+	dlm.RetentionIntervalUnitValuesDays:   24,
+	dlm.RetentionIntervalUnitValuesWeeks:  7 * 24,
+	dlm.RetentionIntervalUnitValuesMonths: 30 * 24,
+	dlm.RetentionIntervalUnitValuesYears:  365 * 24,
+}
+
+func (m *awsResourceManager) ForEachAccountLifecyclePolicies(f func(string, []LifecyclePolicy)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.types.owners(m.accounts, ResourceTypeSnapshots), m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		policies := []LifecyclePolicy{}
+		var policiesMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			lifecycle := dlm.New(sess, &aws.Config{Credentials: cred, Region: aws.String(client.region)})
+			regionPolicies, err := getAWSLifecyclePolicies(account, region, lifecycle)
+			if err != nil {
+				status.Warnf("Could not list lifecycle policies in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			policiesMutex.Lock()
+			policies = append(policies, regionPolicies...)
+			policiesMutex.Unlock()
+		})
+		if len(policies) == 0 {
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, policies)
+	})
+}
+
+// getAWSLifecyclePolicies looks up the schedules of every lifecycle
+// policy in a region, since they aren't part of the policy summaries
+func getAWSLifecyclePolicies(account, region string, client *dlm.DLM) ([]LifecyclePolicy, error) {
+	result := []LifecyclePolicy{}
+	output, err := client.GetLifecyclePolicies(&dlm.GetLifecyclePoliciesInput{})
+	if err != nil {
+		return result, err
+	}
+	for _, summary := range output.Policies {
+		id := aws.StringValue(summary.PolicyId)
+		details, err := client.GetLifecyclePolicy(&dlm.GetLifecyclePolicyInput{PolicyId: summary.PolicyId})
+		if err != nil {
+			status.Warnf("Could not look up lifecycle policy %s in %s of %s: %s", id, region, AccountDisplayName(account), err)
+			continue
+		}
+		policy := LifecyclePolicy{
+			Account:     account,
+			Location:    region,
+			ID:          id,
+			Description: aws.StringValue(summary.Description),
+			Enabled:     aws.StringValue(summary.State) == dlm.GettablePolicyStateValuesEnabled,
+		}
+		if details.Policy != nil && details.Policy.PolicyDetails != nil {
+			for _, schedule := range details.Policy.PolicyDetails.Schedules {
+				policy.Schedules = append(policy.Schedules, awsLifecycleSchedule(schedule))
+			}
+		}
+		result = append(result, policy)
+	}
+	return result, nil
+}
+
+func awsLifecycleSchedule(schedule *dlm.Schedule) LifecycleSchedule {
+	result := LifecycleSchedule{Name: aws.StringValue(schedule.Name)}
+	if rule := schedule.CreateRule; rule != nil && aws.StringValue(rule.IntervalUnit) == dlm.IntervalUnitValuesHours {
+		result.IntervalHours = int(aws.Int64Value(rule.Interval))
+	}
+	if rule := schedule.RetainRule; rule != nil {
+		if rule.Count != nil {
+			result.RetainCount = int(aws.Int64Value(rule.Count))
+		} else {
+			hours := int(aws.Int64Value(rule.Interval)) * awsDLMRetentionHours[aws.StringValue(rule.IntervalUnit)]
+			result.RetainDays = hours / 24
+		}
+	}
+	return result
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/fsx"
+)
+
+const (
+	awsFileSystemKindEFS = "EFS"
+	// awsMountTargetDeleteWait is how long to wait for the mount targets
+	// of an EFS file system to be deleted, before deleting the file system
+	awsMountTargetDeleteWait = 5 * time.Minute
+)
+
+// awsFileSystemIOMetrics are the CloudWatch metrics with the IO of every
+// kind of file system
+var awsFileSystemIOMetrics = map[string][]string{
+	"AWS/EFS": {"TotalIOBytes"},
+	"AWS/FSx": {"DataReadBytes", "DataWriteBytes"},
+}
+
+type baseFileSystem struct {
+	baseResource
+	name         string
+	kind         string
+	sizeGB       float64
+	mountTargets int
+	lastUsed     time.Time
+}
+
+func (f *baseFileSystem) Name() string {
+	return f.name
+}
+
+func (f *baseFileSystem) Kind() string {
+	return f.kind
+}
+
+func (f *baseFileSystem) SizeGB() float64 {
+	return f.sizeGB
+}
+
+func (f *baseFileSystem) MountTargets() int {
+	return f.mountTargets
+}
+
+func (f *baseFileSystem) LastUsed() time.Time {
+	return f.lastUsed
+}
+
+// AWS
+
+func (m *awsResourceManager) ForEachAccountFileSystems(ioDays int, f func(string, []FileSystem)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		fileSystems := []FileSystem{}
+		var fileSystemsMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			config := &aws.Config{Credentials: cred, Region: aws.String(client.region)}
+			region := client.region
+			// Not every region has FSx, and the permissions to list file
+			// systems may be missing, so failures only skip the region
+			regionFileSystems, err := getAWSEFSFileSystems(account, efs.New(sess, config))
+			if err != nil {
+				status.Warnf("Could not list EFS file systems in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			fsxFileSystems, err := getAWSFSxFileSystems(account, fsx.New(sess, config))
+			if err != nil {
+				status.Warnf("Could not list FSx file systems in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			regionFileSystems = append(regionFileSystems, fsxFileSystems...)
+			if ioDays > 0 {
+				cw := cloudwatch.New(sess, config)
+				for _, fileSystem := range regionFileSystems {
+					setAWSFileSystemLastUsed(cw, fileSystem, ioDays)
+				}
+			}
+			fileSystemsMutex.Lock()
+			defer fileSystemsMutex.Unlock()
+			for _, fileSystem := range regionFileSystems {
+				fileSystems = append(fileSystems, fileSystem)
+			}
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, fileSystems)
+	})
+}
+
+// awsFileSystem is implemented by the EFS and FSx file systems, so their
+// last use can be looked up the same way
+type awsFileSystem interface {
+	FileSystem
+	metricsNamespace() string
+	setLastUsed(time.Time)
+}
+
+func (f *baseFileSystem) setLastUsed(t time.Time) {
+	f.lastUsed = t
+}
+
+// setAWSFileSystemLastUsed sets the last day with IO on the file system,
+// from the daily IO metrics of the last ioDays days. If the metrics can't
+// be read, the file system is treated as in use.
+func setAWSFileSystemLastUsed(cw *cloudwatch.CloudWatch, fileSystem awsFileSystem, ioDays int) {
+	namespace := fileSystem.metricsNamespace()
+	var lastUsed time.Time
+	for _, metric := range awsFileSystemIOMetrics[namespace] {
+		output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String(namespace),
+			MetricName: aws.String(metric),
+			Dimensions: []*cloudwatch.Dimension{{
+				Name:  aws.String("FileSystemId"),
+				Value: aws.String(fileSystem.ID()),
+			}},
+			StartTime:  aws.Time(time.Now().AddDate(0, 0, -ioDays)),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int64(24 * 60 * 60),
+			Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum}),
+		})
+		if err != nil {
+			status.Warnf("Could not read the IO of %s in %s, treating it as in use: %s", fileSystem.ID(), AccountDisplayName(fileSystem.Owner()), err)
+			fileSystem.setLastUsed(time.Now())
+			return
+		}
+		for _, datapoint := range output.Datapoints {
+			if aws.Float64Value(datapoint.Sum) > 0 && aws.TimeValue(datapoint.Timestamp).After(lastUsed) {
+				lastUsed = aws.TimeValue(datapoint.Timestamp)
+			}
+		}
+	}
+	fileSystem.setLastUsed(lastUsed)
+}
+
+type awsEFSFileSystem struct {
+	baseFileSystem
+}
+
+// getAWSEFSFileSystems will get all EFS file systems in the current
+// region of an account
+func getAWSEFSFileSystems(account string, client *efs.EFS) ([]awsFileSystem, error) {
+	result := []awsFileSystem{}
+	err := client.DescribeFileSystemsPages(&efs.DescribeFileSystemsInput{}, func(page *efs.DescribeFileSystemsOutput, lastPage bool) bool {
+		for _, fileSystem := range page.FileSystems {
+			tags := make(map[string]string)
+			for _, tag := range fileSystem.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			var sizeBytes int64
+			if fileSystem.SizeInBytes != nil {
+				sizeBytes = aws.Int64Value(fileSystem.SizeInBytes.Value)
+			}
+			result = append(result, &awsEFSFileSystem{baseFileSystem{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           aws.StringValue(fileSystem.FileSystemId),
+					location:     aws.StringValue(client.Config.Region),
+					creationTime: aws.TimeValue(fileSystem.CreationTime),
+					tags:         tags,
+				},
+				name:         aws.StringValue(fileSystem.Name),
+				kind:         awsFileSystemKindEFS,
+				sizeGB:       float64(sizeBytes) / gbDivider,
+				mountTargets: int(aws.Int64Value(fileSystem.NumberOfMountTargets)),
+			}})
+		}
+		return true
+	})
+	return result, err
+}
+
+func (f *awsEFSFileSystem) metricsNamespace() string {
+	return "AWS/EFS"
+}
+
+func (f *awsEFSFileSystem) client() *efs.EFS {
+	sess := NewAWSSession()
+	return efs.New(sess, &aws.Config{
+		Credentials: awsAccountCredentials(sess, f.Owner()),
+		Region:      aws.String(f.Location()),
+	})
+}
+
+// Cleanup deletes the mount targets of the file system first, since a
+// file system can't be deleted while it has any
+func (f *awsEFSFileSystem) Cleanup() error {
+	log.Printf("Cleaning up file system %s in %s", f.ID(), f.Owner())
+	client := f.client()
+	targets, err := client.DescribeMountTargets(&efs.DescribeMountTargetsInput{
+		FileSystemId: aws.String(f.ID()),
+	})
+	if err != nil {
+		return err
+	}
+	for _, target := range targets.MountTargets {
+		log.Printf("Deleting mount target %s of file system %s in %s", aws.StringValue(target.MountTargetId), f.ID(), f.Owner())
+		_, err := client.DeleteMountTarget(&efs.DeleteMountTargetInput{
+			MountTargetId: target.MountTargetId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(awsMountTargetDeleteWait)
+	for len(targets.MountTargets) > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The mount targets of %s were not deleted within %s", f.ID(), awsMountTargetDeleteWait)
+		}
+		time.Sleep(10 * time.Second)
+		targets, err = client.DescribeMountTargets(&efs.DescribeMountTargetsInput{
+			FileSystemId: aws.String(f.ID()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = client.DeleteFileSystem(&efs.DeleteFileSystemInput{
+		FileSystemId: aws.String(f.ID()),
+	})
+	return err
+}
+
+func (f *awsEFSFileSystem) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
+	if _, exist := f.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, f.ID())
+	}
+	_, err := f.client().TagResource(&efs.TagResourceInput{
+		ResourceId: aws.String(f.ID()),
+		Tags:       []*efs.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	})
+	if err != nil {
+		return err
+	}
+	f.tags[key] = value
+	return nil
+}
+
+func (f *awsEFSFileSystem) RemoveTag(key string) error {
+	key, exist := Tags(f.tags).Key(key)
+	if !exist {
+		return nil
+	}
+	_, err := f.client().UntagResource(&efs.UntagResourceInput{
+		ResourceId: aws.String(f.ID()),
+		TagKeys:    aws.StringSlice([]string{key}),
+	})
+	if err != nil {
+		return err
+	}
+	delete(f.tags, key)
+	return nil
+}
+
+type awsFSxFileSystem struct {
+	baseFileSystem
+	arn string
+}
+
+// getAWSFSxFileSystems will get all FSx file systems in the current
+// region of an account
+func getAWSFSxFileSystems(account string, client *fsx.FSx) ([]awsFileSystem, error) {
+	result := []awsFileSystem{}
+	err := client.DescribeFileSystemsPages(&fsx.DescribeFileSystemsInput{}, func(page *fsx.DescribeFileSystemsOutput, lastPage bool) bool {
+		for _, fileSystem := range page.FileSystems {
+			tags := make(map[string]string)
+			for _, tag := range fileSystem.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			result = append(result, &awsFSxFileSystem{
+				baseFileSystem: baseFileSystem{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						id:           aws.StringValue(fileSystem.FileSystemId),
+						location:     aws.StringValue(client.Config.Region),
+						creationTime: aws.TimeValue(fileSystem.CreationTime),
+						tags:         tags,
+					},
+					name:         tags["Name"],
+					kind:         fmt.Sprintf("FSx for %s", aws.StringValue(fileSystem.FileSystemType)),
+					sizeGB:       float64(aws.Int64Value(fileSystem.StorageCapacity)),
+					mountTargets: -1,
+				},
+				arn: aws.StringValue(fileSystem.ResourceARN),
+			})
+		}
+		return true
+	})
+	return result, err
+}
+
+func (f *awsFSxFileSystem) metricsNamespace() string {
+	return "AWS/FSx"
+}
+
+func (f *awsFSxFileSystem) client() *fsx.FSx {
+	sess := NewAWSSession()
+	return fsx.New(sess, &aws.Config{
+		Credentials: awsAccountCredentials(sess, f.Owner()),
+		Region:      aws.String(f.Location()),
+	})
+}
+
+// Cleanup deletes the file system. FSx takes a final backup of the file
+// systems that support it, which is kept until deleted separately.
+func (f *awsFSxFileSystem) Cleanup() error {
+	log.Printf("Cleaning up file system %s in %s", f.ID(), f.Owner())
+	_, err := f.client().DeleteFileSystem(&fsx.DeleteFileSystemInput{
+		FileSystemId: aws.String(f.ID()),
+	})
+	return err
+}
+
+func (f *awsFSxFileSystem) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
+	if _, exist := f.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, f.ID())
+	}
+	_, err := f.client().TagResource(&fsx.TagResourceInput{
+		ResourceARN: aws.String(f.arn),
+		Tags:        []*fsx.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	})
+	if err != nil {
+		return err
+	}
+	f.tags[key] = value
+	return nil
+}
+
+func (f *awsFSxFileSystem) RemoveTag(key string) error {
+	key, exist := Tags(f.tags).Key(key)
+	if !exist {
+		return nil
+	}
+	_, err := f.client().UntagResource(&fsx.UntagResourceInput{
+		ResourceARN: aws.String(f.arn),
+		TagKeys:     aws.StringSlice([]string{key}),
+	})
+	if err != nil {
+		return err
+	}
+	delete(f.tags, key)
+	return nil
+}
@@ -1,6 +1,10 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+// Package filter selects resources by rules, such as their age or tags.
+// A ResourceFilter holds rules which must all match, and the functions
+// taking several filters return the resources matching any of them.
+// Whitelisted resources never match unless OverrideWhitelist is set.
 package filter
 
 import (
@@ -66,6 +70,14 @@ func (f *ResourceFilter) AddBucketRule(rule func(cloud.Bucket) bool) {
 	f.bucketRules = append(f.bucketRules, rule)
 }
 
+// Match checks if a single resource matches the specified filters. This
+// is useful together with the resource iterators of a cloud.ResourceManager,
+// such as ForEachResource. A boolean OR is performed between every specified
+// filter.
+func Match(resource cloud.Resource, filters ...*ResourceFilter) bool {
+	return or(resource, filters)
+}
+
 // Instances will filter the specified instances using the specified filters and
 // return the instances which match. A boolean OR is performed between every specified
 // filter.
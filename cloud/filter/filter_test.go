@@ -96,9 +96,10 @@ type testImg struct {
 	testResource
 }
 
-func (i *testImg) Name() string       { return "test-img" }
-func (i *testImg) SizeGB() int64      { return 10 }
-func (i *testImg) MakePrivate() error { return nil }
+func (i *testImg) Name() string        { return "test-img" }
+func (i *testImg) SizeGB() int64       { return 10 }
+func (i *testImg) LastUsed() time.Time { return time.Time{} }
+func (i *testImg) MakePrivate() error  { return nil }
 
 // This will test the filters being used when marking resources for
 // cleanup. These are:
@@ -278,3 +279,39 @@ func TestCleanupRulesFilter(t *testing.T) {
 		t.Error("Failed to filter buckets")
 	}
 }
+
+func TestMatch(t *testing.T) {
+	inst1 := &testInstance{}
+	inst1.creationTime = time.Now().AddDate(0, 0, -5)
+	inst2 := &testInstance{}
+	inst2.creationTime = time.Now()
+
+	fil := New()
+	fil.AddGeneralRule(OlderThanXDays(2))
+
+	if !Match(inst1, fil) {
+		t.Error("Old instance should match filter")
+	}
+	if Match(inst2, fil) {
+		t.Error("New instance should not match filter")
+	}
+	if Match(inst1) {
+		t.Error("Nothing should match when no filters are specified")
+	}
+}
+
+func TestCustomWhitelistTagKey(t *testing.T) {
+	defaultKey := WhitelistTagKey
+	defer func() { WhitelistTagKey = defaultKey }()
+	WhitelistTagKey = "Keep-Forever"
+
+	inst := &testInstance{}
+	inst.tags = map[string]string{"keep_forever": ""}
+	if !IsWhitelisted(inst) {
+		t.Error("Custom whitelist tag key should be matched ignoring case and underscores")
+	}
+	inst.tags = map[string]string{"cloudsweeper-whitelisted": ""}
+	if IsWhitelisted(inst) {
+		t.Error("Default whitelist tag key should not be used when changed")
+	}
+}
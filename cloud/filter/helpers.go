@@ -12,12 +12,7 @@ import (
 
 // IsWhitelisted checks if the given resource has a whitelisting tag
 func IsWhitelisted(resource cloud.Resource) bool {
-	for key := range resource.Tags() {
-		if strings.Replace(strings.ToLower(key), "_", "-", -1) == WhitelistTagKey {
-			return true
-		}
-	}
-	return false
+	return cloud.Tags(resource.Tags()).Has(WhitelistTagKey)
 }
 
 func ParseFormat(image cloud.Image) (name string, creationTime time.Time) {
@@ -149,5 +144,12 @@ func or(resource cloud.Resource, filters []*ResourceFilter) bool {
 		return false
 	}
 
+	// Any other kind of resource, e.g. security groups, only
+	// have general rules applied
+	for _, filter := range filters {
+		if filter.includeResource(resource) && (!IsWhitelisted(resource) || filter.OverrideWhitelist) {
+			return true
+		}
+	}
 	return false
 }
@@ -0,0 +1,108 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// RuleFactory builds a rule from the arguments it's given in a policy
+// file. An error is returned if the arguments are invalid.
+type RuleFactory func(args map[string]string) (func(cloud.Resource) bool, error)
+
+var (
+	rulesMutex sync.RWMutex
+	rules      = map[string]RuleFactory{
+		"has-tag":           hasTagFactory,
+		"name-contains":     nameContainsFactory,
+		"older-than-days":   daysFactory(OlderThanXDays),
+		"not-used-in-days":  daysFactory(NotUsedInXDays),
+		"tagged-in-days":    daysFactory(TaggedInLastXDays),
+		"is-public":         noArgsFactory(IsPublic),
+		"is-unencrypted":    noArgsFactory(IsUnencrypted),
+		"is-backup-managed": noArgsFactory(IsBackupManaged),
+		"is-dlm-managed":    noArgsFactory(IsDLMManaged),
+	}
+)
+
+// RegisterRule makes a rule available by name, so that policy files can
+// refer to it. This allows organization specific rules, e.g. checking if
+// a resource is registered in a CMDB, to be added by programs embedding
+// Cloudsweeper. It's meant to be called from an init function, and
+// panics if a rule with the same name has already been registered.
+func RegisterRule(name string, factory RuleFactory) {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	if factory == nil {
+		log.Panicln("Rule factory is nil for", name)
+	}
+	if _, exist := rules[name]; exist {
+		log.Panicln("Rule registered twice:", name)
+	}
+	rules[name] = factory
+}
+
+// Rules returns the names of all registered rules
+func Rules() []string {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+	result := make([]string, 0, len(rules))
+	for name := range rules {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// NewRule builds the registered rule with the specified name and
+// arguments
+func NewRule(name string, args map[string]string) (func(cloud.Resource) bool, error) {
+	rulesMutex.RLock()
+	factory, exist := rules[name]
+	rulesMutex.RUnlock()
+	if !exist {
+		return nil, fmt.Errorf("Unknown rule '%s'", name)
+	}
+	rule, err := factory(args)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid arguments for rule '%s': %s", name, err)
+	}
+	return rule, nil
+}
+
+func hasTagFactory(args map[string]string) (func(cloud.Resource) bool, error) {
+	if args["key"] == "" {
+		return nil, fmt.Errorf("missing 'key'")
+	}
+	return HasTag(args["key"]), nil
+}
+
+func nameContainsFactory(args map[string]string) (func(cloud.Resource) bool, error) {
+	if args["text"] == "" {
+		return nil, fmt.Errorf("missing 'text'")
+	}
+	return NameContains(args["text"]), nil
+}
+
+func daysFactory(rule func(int) func(cloud.Resource) bool) RuleFactory {
+	return func(args map[string]string) (func(cloud.Resource) bool, error) {
+		days, err := strconv.Atoi(args["days"])
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("'days' must be a number of days, got '%s'", args["days"])
+		}
+		return rule(days), nil
+	}
+}
+
+func noArgsFactory(rule func() func(cloud.Resource) bool) RuleFactory {
+	return func(args map[string]string) (func(cloud.Resource) bool, error) {
+		return rule(), nil
+	}
+}
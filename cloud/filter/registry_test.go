@@ -0,0 +1,60 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("test-in-cmdb", func(args map[string]string) (func(cloud.Resource) bool, error) {
+		if args["system"] == "" {
+			return nil, fmt.Errorf("missing 'system'")
+		}
+		return func(r cloud.Resource) bool {
+			return r.Tags()["cmdb-system"] == args["system"]
+		}, nil
+	})
+
+	foo := &testResource{time.Now(), map[string]string{"cmdb-system": "billing"}}
+	rule, err := NewRule("test-in-cmdb", map[string]string{"system": "billing"})
+	if err != nil {
+		t.Fatalf("Registered rule should be built, got %s", err)
+	}
+	if !rule(foo) {
+		t.Error("Registered rule should match the resource")
+	}
+	if _, err := NewRule("test-in-cmdb", nil); err == nil {
+		t.Error("Rule with invalid arguments should not be built")
+	}
+	if _, err := NewRule("test-not-registered", nil); err == nil {
+		t.Error("Unknown rule should not be built")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a rule twice should panic")
+		}
+	}()
+	RegisterRule("test-in-cmdb", hasTagFactory)
+}
+
+func TestBuiltinRules(t *testing.T) {
+	foo := &testResource{time.Now().AddDate(0, 0, -10), map[string]string{"Name": "foo"}}
+	rule, err := NewRule("older-than-days", map[string]string{"days": "7"})
+	if err != nil || !rule(foo) {
+		t.Error("Resource should be older than 7 days")
+	}
+	if _, err := NewRule("older-than-days", map[string]string{"days": "a week"}); err == nil {
+		t.Error("Days should be a number")
+	}
+	rule, err = NewRule("has-tag", map[string]string{"key": "Name"})
+	if err != nil || !rule(foo) {
+		t.Error("Resource should have the Name tag")
+	}
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/agaridata/cloudsweeper/cloud"
 )
 
-const (
+// The tag keys used by cloudsweeper. They can be changed before any
+// filtering is done, to fit existing tagging conventions.
+var (
 	// WhitelistTagKey marks a resource to not matched by filter
 	WhitelistTagKey = "cloudsweeper-whitelisted"
 	// LifetimeTagKey marks a resource to be cleaned up after X days
@@ -23,8 +25,26 @@ const (
 	// to keep track of resources that should be cleaned up, but was not explicitly tagged
 	// by the resource owner.
 	DeleteTagKey = "cloudsweeper-delete-at"
+	// DeleteReasonTagKey is set next to the delete tag, with the rule that caused the
+	// resource to be marked for deletion, e.g. "unattached-volume>30d".
+	DeleteReasonTagKey = "cloudsweeper-delete-reason"
+	// DeletePolicyTagKey is set next to the delete tag, with the name, version and
+	// fingerprint of the policy the resource was marked under, e.g. "sandbox:7:1a2b3c4d".
+	DeletePolicyTagKey = "cloudsweeper-delete-policy"
+)
+
+const (
 	// ExpiryTagValueFormat is the format to use when setting expiry date
 	ExpiryTagValueFormat = "2006-01-02" // Used to parse string
+	// BackupTagPrefix starts the keys of the tags AWS Backup sets on the
+	// recovery points it creates, such as EBS snapshots and AMIs
+	BackupTagPrefix = "aws:backup:"
+	// BackupSourceTagKey is set by AWS Backup to the ARN of the resource
+	// a recovery point was created from
+	BackupSourceTagKey = "aws:backup:source-resource"
+	// DLMPolicyTagKey is set by Amazon Data Lifecycle Manager to the ID of
+	// the lifecycle policy which created a snapshot
+	DLMPolicyTagKey = "aws:dlm:lifecycle-policy-id"
 )
 
 // Below are general rules
@@ -81,7 +101,7 @@ func OlderThanXYears(years int) func(cloud.Resource) bool {
 func NameContains(contains string) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
 		name := ""
-		if n, ok := r.Tags()["Name"]; ok {
+		if n, ok := cloud.Tags(r.Tags()).Get("Name"); ok {
 			name = n
 		}
 		return strings.Contains(strings.ToLower(name), strings.ToLower(contains))
@@ -101,15 +121,11 @@ func IDMatches(ids ...string) func(cloud.Resource) bool {
 	}
 }
 
-// HasTag checks if a resource have a specified tag or not
+// HasTag checks if a resource have a specified tag or not. Tag keys are
+// compared the same way in every CSP, see cloud.CanonicalTagKey.
 func HasTag(tagKey string) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		for key := range r.Tags() {
-			if strings.ToLower(key) == strings.ToLower(tagKey) {
-				return true
-			}
-		}
-		return false
+		return cloud.Tags(r.Tags()).Has(tagKey)
 	}
 }
 
@@ -144,13 +160,66 @@ func IsPublic() func(cloud.Resource) bool {
 	}
 }
 
+// NotUsedInXDays checks if an image or snapshot has not been used,
+// nor created, in the last X days. If it's unknown when the resource
+// was last used, only its age is checked.
+func NotUsedInXDays(days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		lastUsed := r.CreationTime()
+		if usable, ok := r.(interface{ LastUsed() time.Time }); ok && usable.LastUsed().After(lastUsed) {
+			lastUsed = usable.LastUsed()
+		}
+		return time.Now().AddDate(0, 0, -days).After(lastUsed)
+	}
+}
+
+// IsBackupManaged checks if a resource is a recovery point created by
+// AWS Backup, which is deleted by its backup plan instead
+func IsBackupManaged() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		for key := range r.Tags() {
+			if strings.HasPrefix(key, BackupTagPrefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// IsDLMManaged checks if a resource is a snapshot created by an Amazon
+// Data Lifecycle Manager policy, which deletes it once it's no longer
+// retained
+func IsDLMManaged() func(cloud.Resource) bool {
+	return HasTag(DLMPolicyTagKey)
+}
+
+// TaggedInLastXDays checks if the tags of a resource were changed in the
+// last X days, which means that it's still being curated. Resources for
+// which it's unknown when their tags were last changed are never
+// included.
+func TaggedInLastXDays(days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		tagged, ok := r.(cloud.TagActivity)
+		return ok && !tagged.LastTagged().IsZero() && tagged.LastTagged().After(time.Now().AddDate(0, 0, -days))
+	}
+}
+
+// IsUnencrypted checks if a volume or snapshot is not encrypted.
+// Resources without an encryption setting are never included.
+func IsUnencrypted() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		encryptable, ok := r.(interface{ Encrypted() bool })
+		return ok && !encryptable.Encrypted()
+	}
+}
+
 // LifetimeExceeded check if a resource have the lifetime tag,
 // with the format "cloudsweeper-lifetime: days-X" (where X is the amount of
 // days to keep the resource). If the lifetime is passed, then
 // this resource should be included in the filter.
 func LifetimeExceeded() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		lifetime, hasLifetime := r.Tags()[LifetimeTagKey]
+		lifetime, hasLifetime := cloud.Tags(r.Tags()).Get(LifetimeTagKey)
 		if !hasLifetime {
 			// If resource doesn't have the lifetime tag then don't include it
 			return false
@@ -176,7 +245,7 @@ func LifetimeExceeded() func(cloud.Resource) bool {
 // expiry tag has the format "cloudsweeper-expiry: 2018-06-17".
 func ExpiryDatePassed() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		expiryVal, hasExpiry := r.Tags()[ExpiryTagKey]
+		expiryVal, hasExpiry := cloud.Tags(r.Tags()).Get(ExpiryTagKey)
 		if !hasExpiry {
 			// Don't include resource that doesn't have expiry tag
 			return false
@@ -195,11 +264,11 @@ func ExpiryDatePassed() func(cloud.Resource) bool {
 // includes resources which deletion time is passed.
 func DeleteWithinXHours(hours int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		deleteTimeString, hasDeletion := r.Tags()[DeleteTagKey]
+		deleteTimeString, hasDeletion := VerifiedTagValue(r, DeleteTagKey)
 		if !hasDeletion {
 			return false
 		}
-		deleteTime, err := time.Parse(time.RFC3339, deleteTimeString)
+		deleteTime, err := cloud.ParseTagTime(deleteTimeString)
 		if err != nil {
 			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), deleteTimeString)
 			return false
@@ -213,11 +282,11 @@ func DeleteWithinXHours(hours int) func(cloud.Resource) bool {
 // delete tag has the format "cloudsweeper-delete-at: 2018-01-25T16:51:39-08:00".
 func DeleteAtPassed() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		deleteAt, exist := r.Tags()[DeleteTagKey]
+		deleteAt, exist := VerifiedTagValue(r, DeleteTagKey)
 		if !exist {
 			return false
 		}
-		deleteAtTime, err := time.Parse(time.RFC3339, deleteAt)
+		deleteAtTime, err := cloud.ParseTagTime(deleteAt)
 		if err != nil {
 			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), deleteAt)
 			return false
@@ -281,6 +350,21 @@ func NotModifiedInXDays(days int) func(cloud.Bucket) bool {
 	}
 }
 
+// NotReadInXDays returns buckets which have not had any object read from
+// them within X days. Buckets where the last read is unknown are included.
+func NotReadInXDays(days int) func(cloud.Bucket) bool {
+	return func(b cloud.Bucket) bool {
+		return time.Now().After(b.LastRead().AddDate(0, 0, days))
+	}
+}
+
+// IsEmptyBucket returns buckets which have no objects
+func IsEmptyBucket() func(cloud.Bucket) bool {
+	return func(b cloud.Bucket) bool {
+		return b.Empty()
+	}
+}
+
 func DoNotDelete(dndList map[string]bool) func(cloud.Resource) bool {
 	return func(res cloud.Resource) bool {
 		if _, ok := dndList[res.ID()]; ok {
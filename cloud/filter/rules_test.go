@@ -38,6 +38,13 @@ func (r *testResource) SetTag(key, value string, overwrite bool) error { return
 func (r *testResource) RemoveTag(key string) error                     { return nil }
 func (r *testResource) Cleanup() error                                 { return nil }
 
+type taggedResource struct {
+	testResource
+	lastTagged time.Time
+}
+
+func (r *taggedResource) LastTagged() time.Time { return r.lastTagged }
+
 func TestNegate(t *testing.T) {
 	foo := &testResource{time.Now(), map[string]string{}}
 	fun := Negate(func(r cloud.Resource) bool {
@@ -163,6 +170,10 @@ func TestHasTag(t *testing.T) {
 	if HasTag("some-tag")(foo) {
 		t.Error("Resource does not have tag")
 	}
+
+	if !HasTag("Some_Tag_Key")(foo) {
+		t.Error("Tag keys should match regardless of case and underscores")
+	}
 }
 
 func TestHasTags(t *testing.T) {
@@ -310,6 +321,13 @@ func TestDeletePassed(t *testing.T) {
 	if DeleteAtPassed()(foo) {
 		t.Error("Malformed tag value")
 	}
+
+	_, gcpTime := cloud.NormalizeTag(cloud.GCP, DeleteTagKey, deleteTime)
+	foo.tags[DeleteTagKey] = gcpTime
+
+	if !DeleteAtPassed()(foo) {
+		t.Errorf("Delete time %s in a GCP label should be passed", gcpTime)
+	}
 }
 
 type testVolume struct {
@@ -344,17 +362,23 @@ func TestAttached(t *testing.T) {
 type testBucket struct {
 	testResource
 	lastModified time.Time
+	lastRead     time.Time
+	empty        bool
 }
 
 func (b *testBucket) LastModified() time.Time                { return b.lastModified }
+func (b *testBucket) LastRead() time.Time                    { return b.lastRead }
 func (b *testBucket) ObjectCount() int64                     { return 10 }
 func (b *testBucket) TotalSizeGB() float64                   { return 5.13 }
 func (b *testBucket) StorageTypeSizesGB() map[string]float64 { return make(map[string]float64) }
+func (b *testBucket) Empty() bool                            { return b.empty }
 
 func TestNotModified(t *testing.T) {
 	foo := &testBucket{
 		testResource{time.Now(), map[string]string{}},
 		time.Now(),
+		time.Time{},
+		false,
 	}
 
 	if NotModifiedInXDays(5)(foo) {
@@ -368,19 +392,41 @@ func TestNotModified(t *testing.T) {
 	}
 }
 
+func TestIsEmptyBucket(t *testing.T) {
+	foo := &testBucket{
+		testResource{time.Now(), map[string]string{}},
+		time.Now(),
+		time.Time{},
+		false,
+	}
+
+	if IsEmptyBucket()(foo) {
+		t.Error("Bucket has objects")
+	}
+
+	foo.empty = true
+
+	if !IsEmptyBucket()(foo) {
+		t.Error("Bucket is empty")
+	}
+}
+
 type testSnap struct {
 	testResource
-	inUse bool
+	inUse    bool
+	lastUsed time.Time
 }
 
-func (s *testSnap) Encrypted() bool { return false }
-func (s *testSnap) SizeGB() int64   { return 5 }
-func (s *testSnap) InUse() bool     { return s.inUse }
+func (s *testSnap) Encrypted() bool     { return false }
+func (s *testSnap) SizeGB() int64       { return 5 }
+func (s *testSnap) InUse() bool         { return s.inUse }
+func (s *testSnap) LastUsed() time.Time { return s.lastUsed }
 
 func TestInUse(t *testing.T) {
 	foo := &testSnap{
 		testResource{time.Now(), map[string]string{}},
 		false,
+		time.Time{},
 	}
 
 	if IsInUse()(foo) {
@@ -393,3 +439,103 @@ func TestInUse(t *testing.T) {
 		t.Error("Snapshot is in use")
 	}
 }
+
+func TestUnencrypted(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{}}
+	if IsUnencrypted()(foo) {
+		t.Error("Resource without encryption setting should not be included")
+	}
+
+	bar := &testVolume{*foo, false}
+	if IsUnencrypted()(bar) != !testEncrypted {
+		t.Error("Volume encryption value wrong")
+	}
+
+	baz := &testSnap{*foo, false, time.Time{}}
+	if !IsUnencrypted()(baz) {
+		t.Error("Snapshot is not encrypted")
+	}
+}
+
+func TestNotUsed(t *testing.T) {
+	foo := &testSnap{
+		testResource{time.Now().AddDate(0, 0, -20), map[string]string{}},
+		false,
+		time.Time{},
+	}
+
+	if !NotUsedInXDays(10)(foo) {
+		t.Error("Snapshot was created 20 days ago and never used")
+	}
+
+	foo.lastUsed = time.Now().AddDate(0, 0, -5)
+
+	if NotUsedInXDays(10)(foo) {
+		t.Error("Snapshot was used 5 days ago")
+	}
+
+	bar := &testResource{time.Now().AddDate(0, 0, -20), map[string]string{}}
+
+	if !NotUsedInXDays(10)(bar) {
+		t.Error("Resource without last use should only check age")
+	}
+}
+
+func TestNotRead(t *testing.T) {
+	foo := &testBucket{
+		testResource{time.Now(), map[string]string{}},
+		time.Now().AddDate(0, -5, 0),
+		time.Time{},
+		false,
+	}
+
+	if !NotReadInXDays(5)(foo) {
+		t.Error("Bucket without known reads should be included")
+	}
+
+	foo.lastRead = time.Now().AddDate(0, 0, -1)
+
+	if NotReadInXDays(5)(foo) {
+		t.Error("Bucket has been read within 5 days")
+	}
+}
+
+func TestTaggedInLastDays(t *testing.T) {
+	foo := &taggedResource{testResource{time.Now().AddDate(-1, 0, 0), map[string]string{}}, time.Now().AddDate(0, 0, -3)}
+	if !TaggedInLastXDays(7)(foo) {
+		t.Error("Resource was tagged in the last 7 days")
+	}
+	if TaggedInLastXDays(2)(foo) {
+		t.Error("Resource was not tagged in the last 2 days")
+	}
+
+	foo.lastTagged = time.Time{}
+	if TaggedInLastXDays(7)(foo) {
+		t.Error("Resource never tagged should not be included")
+	}
+	if TaggedInLastXDays(7)(&foo.testResource) {
+		t.Error("Resource without tag activity should not be included")
+	}
+}
+
+func TestIsBackupManaged(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{BackupSourceTagKey: "arn:aws:ec2:us-west-2::volume/vol-123"}}
+	if !IsBackupManaged()(foo) {
+		t.Error("Resource created by AWS Backup should be backup managed")
+	}
+	foo.tags = map[string]string{"Name": "backup"}
+	if IsBackupManaged()(foo) {
+		t.Error("Resource without AWS Backup tags should not be backup managed")
+	}
+}
+
+func TestIsDLMManaged(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{DLMPolicyTagKey: "policy-0123456789abcdef0"}}
+	if !IsDLMManaged()(foo) {
+		t.Error("Snapshot created by a lifecycle policy should be DLM managed")
+	}
+	foo.tags = map[string]string{"Name": "dlm"}
+	if IsDLMManaged()(foo) {
+		t.Error("Resource without the DLM policy tag should not be DLM managed")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+const (
+	tagSignatureSeparator = "_"
+	// Only part of the HMAC is kept, as some CSPs limit the length of
+	// tag values. 16 bytes is still plenty to make forging impractical.
+	tagSignatureBytes = 16
+)
+
+// TagSigningKey is used to sign the value of the delete tag when it's
+// written by cloudsweeper. If set, a delete tag without a valid signature
+// is ignored, so that resources can't be deleted by someone setting the
+// delete tag on resources they don't own. Signing is disabled if empty.
+// Tags are signed with a key derived from it per owner, see
+// OwnerSigningKeyFor.
+var TagSigningKey []byte
+
+// OwnerSigningKey signs and verifies the delete tags of a single owner's
+// resources when TagSigningKey isn't known, such as when owners extend
+// their own resources. It's the key OwnerSigningKeyFor returns for the
+// owner, so it can't sign the tags of anyone else's resources.
+var OwnerSigningKey []byte
+
+// OwnerSigningKeyFor returns the key which signs the tags of the
+// resources of an owner, i.e. an account or project, derived from
+// TagSigningKey. It's empty if TagSigningKey is.
+func OwnerSigningKeyFor(owner string) string {
+	if len(TagSigningKey) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, TagSigningKey)
+	mac.Write([]byte("owner"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(owner))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signingKey returns the key signing the tags of a resource, which is
+// empty if signing is disabled
+func signingKey(r cloud.Resource) []byte {
+	if len(TagSigningKey) == 0 {
+		return OwnerSigningKey
+	}
+	return []byte(OwnerSigningKeyFor(r.Owner()))
+}
+
+// SignTagValue returns the value to use for a tag on the specified
+// resource, with a signature appended if a signing key is set. The
+// signature covers the resource and tag key, so a signed value can't
+// be copied to another resource. The value is normalized for the CSP of
+// the resource before it's signed, so the signature matches the value
+// actually stored.
+func SignTagValue(r cloud.Resource, key, value string) string {
+	_, value = cloud.NormalizeTag(r.CSP(), key, value)
+	signing := signingKey(r)
+	if len(signing) == 0 {
+		return value
+	}
+	return value + tagSignatureSeparator + tagSignature(signing, r, key, value)
+}
+
+// VerifiedTagValue returns the value of a tag on the specified resource,
+// with any signature removed. If a signing key is set, the tag is only
+// considered to exist if its signature is valid.
+func VerifiedTagValue(r cloud.Resource, key string) (string, bool) {
+	value, exist := cloud.Tags(r.Tags()).Get(key)
+	signing := signingKey(r)
+	if !exist || len(signing) == 0 {
+		return value, exist
+	}
+	i := strings.LastIndex(value, tagSignatureSeparator)
+	if i < 0 {
+		log.Printf("%s has unsigned %s tag, ignoring it\n", r.ID(), key)
+		return "", false
+	}
+	value, signature := value[:i], value[i+len(tagSignatureSeparator):]
+	valid := hmac.Equal([]byte(signature), []byte(tagSignature(signing, r, key, value)))
+	if !valid && len(TagSigningKey) > 0 {
+		// Tags signed before keys were derived per owner were signed with
+		// TagSigningKey itself
+		valid = hmac.Equal([]byte(signature), []byte(tagSignature(TagSigningKey, r, key, value)))
+	}
+	if !valid {
+		log.Printf("%s has %s tag with invalid signature, ignoring it\n", r.ID(), key)
+		return "", false
+	}
+	return value, true
+}
+
+func tagSignature(signing []byte, r cloud.Resource, key, value string) string {
+	mac := hmac.New(sha256.New, signing)
+	for _, part := range []string{string(r.CSP()), r.Owner(), r.ID(), key, value} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:tagSignatureBytes])
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+type otherOwnerResource struct {
+	testResource
+}
+
+func (r *otherOwnerResource) Owner() string { return "other-" + testOwner }
+
+func TestOwnerSigningKey(t *testing.T) {
+	defer func() { TagSigningKey, OwnerSigningKey = nil, nil }()
+	TagSigningKey = []byte("organization secret")
+	res := &testResource{time.Now(), map[string]string{}}
+	other := &otherOwnerResource{testResource{time.Now(), map[string]string{}}}
+	ownerKey := OwnerSigningKeyFor(res.Owner())
+	if ownerKey == "" || ownerKey == OwnerSigningKeyFor(other.Owner()) {
+		t.Fatalf("Owners should have keys of their own, got %q", ownerKey)
+	}
+	signed := SignTagValue(res, DeleteTagKey, "2018-01-29")
+
+	// The owner only knows their own key
+	TagSigningKey, OwnerSigningKey = nil, []byte(ownerKey)
+	res.tags[DeleteTagKey] = signed
+	if value, exist := VerifiedTagValue(res, DeleteTagKey); !exist || value != "2018-01-29" {
+		t.Errorf("The owner key should verify the tag signed with the organization key, got %q", value)
+	}
+	other.tags[DeleteTagKey] = SignTagValue(other, DeleteTagKey, "2018-01-29")
+	extended := SignTagValue(res, DeleteTagKey, "2018-02-05")
+
+	TagSigningKey, OwnerSigningKey = []byte("organization secret"), nil
+	res.tags[DeleteTagKey] = extended
+	if value, exist := VerifiedTagValue(res, DeleteTagKey); !exist || value != "2018-02-05" {
+		t.Errorf("The tag signed with the owner key should be verified, got %q", value)
+	}
+	if _, exist := VerifiedTagValue(other, DeleteTagKey); exist {
+		t.Error("The owner key should not sign tags of resources of other owners")
+	}
+
+	legacy := "2018-01-29" + tagSignatureSeparator + tagSignature(TagSigningKey, res, DeleteTagKey, "2018-01-29")
+	res.tags[DeleteTagKey] = legacy
+	if _, exist := VerifiedTagValue(res, DeleteTagKey); !exist {
+		t.Error("Tags signed with the organization key itself should still be verified")
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/agaridata/cloudsweeper/status"
+
 	compute "google.golang.org/api/compute/v1"
 	storage "google.golang.org/api/storage/v1"
 )
@@ -25,9 +27,14 @@ var (
 // gcpResourceManager uses the Go API client for Google Cloud
 // https://github.com/google/google-api-go-client
 type gcpResourceManager struct {
-	projects []string
-	compute  *compute.Service
-	storage  *storage.Service
+	projects    []string
+	parallelism int
+	compute     *compute.Service
+	storage     *storage.Service
+	types       *resourceTypeSwitches
+	// timeouts bounds how long a project, and every zone of it, may be
+	// processed. Scopes are identified by the project.
+	timeouts *scopeTimeouts
 }
 
 func (m *gcpResourceManager) Owners() []string {
@@ -39,24 +46,7 @@ func (m *gcpResourceManager) InstancesPerAccount() map[string][]Instance {
 	result := make(map[string][]Instance)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
-		instList := []Instance{}
-		var listMutex sync.Mutex // Zones are proccessed in parallel
-		m.forEachZone(project, func(zone string) {
-			inst, err := m.getInstances(project, zone)
-			if err != nil {
-				log.Printf("Could not list instances in (%s, %s): %s", project, zone, err)
-				if err == ErrPermissionDenied {
-					log.Println(err)
-				} else {
-					// If it was an unknown error, abort
-					log.Fatalln(err)
-				}
-			} else if len(inst) > 0 {
-				listMutex.Lock()
-				instList = append(instList, inst...)
-				listMutex.Unlock()
-			}
-		})
+		instList := m.projectInstances(project)
 		resultMutex.Lock()
 		result[project] = instList
 		resultMutex.Unlock()
@@ -69,16 +59,8 @@ func (m *gcpResourceManager) ImagesPerAccount() map[string][]Image {
 	result := make(map[string][]Image)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
-		images, err := m.getImages(project)
-		if err != nil {
-			log.Printf("Could not list images in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
-		} else if len(images) > 0 {
+		images := m.projectImages(project)
+		if len(images) > 0 {
 			resultMutex.Lock()
 			result[project] = images
 			resultMutex.Unlock()
@@ -92,24 +74,7 @@ func (m *gcpResourceManager) VolumesPerAccount() map[string][]Volume {
 	result := make(map[string][]Volume)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
-		diskList := []Volume{}
-		var listMutex sync.Mutex // Zones are proccessed in parallel
-		m.forEachZone(project, func(zone string) {
-			volumes, err := m.getVolumes(project, zone)
-			if err != nil {
-				log.Printf("Could not list disks in (%s, %s): %s", project, zone, err)
-				if err == ErrPermissionDenied {
-					log.Println(err)
-				} else {
-					// If it was an unknown error, abort
-					log.Fatalln(err)
-				}
-			} else if len(volumes) > 0 {
-				listMutex.Lock()
-				diskList = append(diskList, volumes...)
-				listMutex.Unlock()
-			}
-		})
+		diskList := m.projectVolumes(project)
 		resultMutex.Lock()
 		result[project] = diskList
 		resultMutex.Unlock()
@@ -122,16 +87,8 @@ func (m *gcpResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
 	result := make(map[string][]Snapshot)
 	var resultMutex sync.Mutex
 	m.forEachProject(func(project string) {
-		snapshots, err := m.getSnapshots(project)
-		if err != nil {
-			log.Printf("Could not list snapshots in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
-		} else if len(snapshots) > 0 {
+		snapshots := m.projectSnapshots(project)
+		if len(snapshots) > 0 {
 			resultMutex.Lock()
 			result[project] = snapshots
 			resultMutex.Unlock()
@@ -145,16 +102,8 @@ func (m *gcpResourceManager) BucketsPerAccount() map[string][]Bucket {
 	result := make(map[string][]Bucket)
 	var resultMutex sync.Mutex
 	m.forEachProject(func(project string) {
-		buckets, err := m.getBuckets(project)
-		if err != nil {
-			log.Printf("Could not list buckets in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
-		} else if len(buckets) > 0 {
+		buckets := m.projectBuckets(project)
+		if len(buckets) > 0 {
 			resultMutex.Lock()
 			result[project] = buckets
 			resultMutex.Unlock()
@@ -167,71 +116,253 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	log.Println("Getting all compute resources in all accounts")
 	result := make(map[string]*ResourceCollection)
 	var resultMutex sync.Mutex
+	m.forEachProject(func(project string) {
+		collection := m.projectResources(project)
+		resultMutex.Lock()
+		result[project] = collection
+		resultMutex.Unlock()
+	})
+	return result
+}
+
+func (m *gcpResourceManager) ForEachAccountResources(f func(*AllResourceCollection)) {
+	log.Println("Going through all resources in all projects")
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		compute := m.projectResources(project)
+		buckets := m.projectBuckets(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(&AllResourceCollection{
+			Owner:     project,
+			Instances: compute.Instances,
+			Images:    compute.Images,
+			Volumes:   compute.Volumes,
+			Snapshots: compute.Snapshots,
+			Buckets:   buckets,
+		})
+	})
+}
+
+func (m *gcpResourceManager) ForEachInstance(f func(Instance)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		instances := m.projectInstances(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range instances {
+			f(instances[i])
+		}
+	})
+}
+
+func (m *gcpResourceManager) ForEachImage(f func(Image)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		images := m.projectImages(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range images {
+			f(images[i])
+		}
+	})
+}
+
+func (m *gcpResourceManager) ForEachVolume(f func(Volume)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		volumes := m.projectVolumes(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range volumes {
+			f(volumes[i])
+		}
+	})
+}
+
+func (m *gcpResourceManager) ForEachSnapshot(f func(Snapshot)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		snapshots := m.projectSnapshots(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range snapshots {
+			f(snapshots[i])
+		}
+	})
+}
+
+func (m *gcpResourceManager) ForEachBucket(f func(Bucket)) {
+	var funcMutex sync.Mutex // f must never be called concurrently
+	m.forEachProject(func(project string) {
+		buckets := m.projectBuckets(project)
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		for i := range buckets {
+			f(buckets[i])
+		}
+	})
+}
+
+func (m *gcpResourceManager) ForEachResource(f func(Resource)) {
+	log.Println("Going through all resources in all projects")
+	forEachResource(m, f)
+}
+
+func (m *gcpResourceManager) CleanupInstances(instances []Instance) error {
+	return cleanupInstances(instances)
+}
+
+func (m *gcpResourceManager) CleanupImages(images []Image) error {
+	return cleanupImages(images)
+}
+
+func (m *gcpResourceManager) CleanupVolumes(volumes []Volume) error {
+	return cleanupVolumes(volumes)
+}
+
+func (m *gcpResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
+	return cleanupSnapshots(snapshots)
+}
+
+func (m *gcpResourceManager) CleanupBuckets(buckets []Bucket) error {
+	return cleanupBuckets(buckets)
+}
+
+// projectResources gets all compute resources in a single project
+func (m *gcpResourceManager) projectResources(project string) *ResourceCollection {
+	collection := &ResourceCollection{Owner: project}
 	var wg sync.WaitGroup
-	var instanceMap map[string][]Instance
-	var imageMap map[string][]Image
-	var volumeMap map[string][]Volume
-	var snapMap map[string][]Snapshot
 	wg.Add(4)
 	go func() {
-		instanceMap = m.InstancesPerAccount()
+		collection.Instances = m.projectInstances(project)
 		wg.Done()
 	}()
 	go func() {
-		imageMap = m.ImagesPerAccount()
+		collection.Images = m.projectImages(project)
 		wg.Done()
 	}()
 	go func() {
-		volumeMap = m.VolumesPerAccount()
+		collection.Volumes = m.projectVolumes(project)
 		wg.Done()
 	}()
 	go func() {
-		snapMap = m.SnapshotsPerAccount()
+		collection.Snapshots = m.projectSnapshots(project)
 		wg.Done()
 	}()
 	wg.Wait()
-	for _, project := range m.projects {
-		collection := &ResourceCollection{
-			Owner:     project,
-			Instances: instanceMap[project],
-			Images:    imageMap[project],
-			Volumes:   volumeMap[project],
-			Snapshots: snapMap[project],
-		}
-		resultMutex.Lock()
-		result[project] = collection
-		resultMutex.Unlock()
+	return collection
+}
+
+func (m *gcpResourceManager) projectInstances(project string) []Instance {
+	instList := []Instance{}
+	if !m.types.enabled(project, ResourceTypeInstances) {
+		return instList
 	}
-	return result
+	var listMutex sync.Mutex // Zones are proccessed in parallel
+	m.forEachZone(project, func(zone string) {
+		inst, err := m.getInstances(project, zone)
+		if err != nil && m.timeouts.expired(project, zone) {
+			return
+		} else if err != nil {
+			status.DiscoveryFailedf("Could not list instances in (%s, %s): %s", AccountDisplayName(project), zone, err)
+			handleGCPError(err)
+		} else if len(inst) > 0 {
+			listMutex.Lock()
+			instList = append(instList, inst...)
+			listMutex.Unlock()
+		}
+	})
+	return instList
 }
 
-func (m *gcpResourceManager) CleanupInstances(instances []Instance) error {
-	return cleanupInstances(instances)
+func (m *gcpResourceManager) projectImages(project string) []Image {
+	if !m.types.enabled(project, ResourceTypeImages) {
+		return []Image{}
+	}
+	images, err := m.getImages(project)
+	if err != nil && m.timeouts.expired(project, "") {
+		return []Image{}
+	} else if err != nil {
+		status.DiscoveryFailedf("Could not list images in %s: %s", AccountDisplayName(project), err)
+		handleGCPError(err)
+	}
+	return images
 }
 
-func (m *gcpResourceManager) CleanupImages(images []Image) error {
-	return cleanupImages(images)
+func (m *gcpResourceManager) projectVolumes(project string) []Volume {
+	diskList := []Volume{}
+	if !m.types.enabled(project, ResourceTypeVolumes) {
+		return diskList
+	}
+	var listMutex sync.Mutex // Zones are proccessed in parallel
+	m.forEachZone(project, func(zone string) {
+		volumes, err := m.getVolumes(project, zone)
+		if err != nil && m.timeouts.expired(project, zone) {
+			return
+		} else if err != nil {
+			status.DiscoveryFailedf("Could not list disks in (%s, %s): %s", AccountDisplayName(project), zone, err)
+			handleGCPError(err)
+		} else if len(volumes) > 0 {
+			listMutex.Lock()
+			diskList = append(diskList, volumes...)
+			listMutex.Unlock()
+		}
+	})
+	return diskList
 }
 
-func (m *gcpResourceManager) CleanupVolumes(volumes []Volume) error {
-	return cleanupVolumes(volumes)
+func (m *gcpResourceManager) projectSnapshots(project string) []Snapshot {
+	if !m.types.enabled(project, ResourceTypeSnapshots) {
+		return []Snapshot{}
+	}
+	snapshots, err := m.getSnapshots(project)
+	if err != nil && m.timeouts.expired(project, "") {
+		return []Snapshot{}
+	} else if err != nil {
+		status.DiscoveryFailedf("Could not list snapshots in %s: %s", AccountDisplayName(project), err)
+		handleGCPError(err)
+	}
+	return snapshots
 }
 
-func (m *gcpResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
-	return cleanupSnapshots(snapshots)
+func (m *gcpResourceManager) projectBuckets(project string) []Bucket {
+	if !m.types.enabled(project, ResourceTypeBuckets) {
+		return []Bucket{}
+	}
+	buckets, err := m.getBuckets(project)
+	if err != nil && m.timeouts.expired(project, "") {
+		return []Bucket{}
+	} else if err != nil {
+		status.DiscoveryFailedf("Could not list buckets in %s: %s", AccountDisplayName(project), err)
+		handleGCPError(err)
+	}
+	return buckets
 }
 
-func (m *gcpResourceManager) CleanupBuckets(buckets []Bucket) error {
-	return cleanupBuckets(buckets)
+// handleGCPError will log permission denied errors, but abort
+// on any other unknown error
+func handleGCPError(err error) {
+	if err == ErrPermissionDenied {
+		status.DiscoveryFailedf("%s", err)
+	} else {
+		// If it was an unknown error, abort
+		status.DiscoveryFatalf("%s", err)
+	}
 }
 
 func (m *gcpResourceManager) forEachProject(f func(project string)) {
 	var wg sync.WaitGroup
+	limit := newLimiter(m.parallelism)
 	wg.Add(len(m.projects))
 	for i := range m.projects {
+		limit.acquire()
 		go func(i int) {
-			log.Printf("Accessing project %s", m.projects[i])
-			f(m.projects[i])
+			log.Printf("Accessing project %s", AccountDisplayName(m.projects[i]))
+			m.timeouts.runAccount(m.projects[i], AccountDisplayName(m.projects[i]), func() {
+				f(m.projects[i])
+			})
+			limit.release()
 			wg.Done()
 		}(i)
 	}
@@ -239,16 +370,20 @@ func (m *gcpResourceManager) forEachProject(f func(project string)) {
 }
 
 func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) {
-	zones, err := m.compute.Zones.List(project).Do()
-	if err != nil {
-		log.Printf("Could not list zones in %s. Err: %v", project, err)
+	zones, err := m.compute.Zones.List(project).Context(m.timeouts.context(project, "")).Do()
+	if err != nil && m.timeouts.expired(project, "") {
+		return
+	} else if err != nil {
+		status.DiscoveryFailedf("Could not list zones in %s. Err: %v", AccountDisplayName(project), err)
 		return
 	}
 	var wg sync.WaitGroup
 	for _, z := range zones.Items {
 		wg.Add(1)
 		go func(z string) {
-			f(z)
+			m.timeouts.runRegion(project, z, AccountDisplayName(project), func() {
+				f(z)
+			})
 			wg.Done()
 		}(z.Name)
 	}
@@ -256,7 +391,7 @@ func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) {
 }
 
 func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, error) {
-	instances, err := m.compute.Instances.List(project, zone).Do()
+	instances, err := m.compute.Instances.List(project, zone).Context(m.timeouts.context(project, zone)).Do()
 	if err != nil {
 		if instances != nil && isGCPAccessDeniedError(instances.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -267,7 +402,7 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 	for _, i := range instances.Items {
 		creationTime, err := time.Parse(time.RFC3339, i.CreationTimestamp)
 		if err != nil {
-			log.Printf("Could not parse timestamp of %s (in %s): %s", i.Name, project, err)
+			status.Warnf("Could not parse timestamp of %s (in %s): %s", i.Name, AccountDisplayName(project), err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
@@ -290,11 +425,12 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 			m.compute,
 		})
 	}
+	recordResources(GCP, ResourceTypeInstances, len(res))
 	return res, nil
 }
 
 func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
-	images, err := m.compute.Images.List(project).Do()
+	images, err := m.compute.Images.List(project).Context(m.timeouts.context(project, "")).Do()
 	if err != nil {
 		if images != nil && isGCPAccessDeniedError(images.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -305,7 +441,7 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 	for _, img := range images.Items {
 		creationTime, err := time.Parse(time.RFC3339, img.CreationTimestamp)
 		if err != nil {
-			log.Printf("Could not parse timestamp of %s (in %s): %s", img.Name, project, err)
+			status.Warnf("Could not parse timestamp of %s (in %s): %s", img.Name, AccountDisplayName(project), err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
@@ -330,11 +466,14 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 			compute: m.compute,
 		})
 	}
+	recordResources(GCP, ResourceTypeImages, len(imgList))
 	return imgList, nil
 }
 
+// getVolumes will get all disks in a zone. Persistent disks are always
+// encrypted at rest in GCP, so they are never reported as unencrypted.
 func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error) {
-	volumes, err := m.compute.Disks.List(project, zone).Do()
+	volumes, err := m.compute.Disks.List(project, zone).Context(m.timeouts.context(project, zone)).Do()
 	if err != nil {
 		if volumes != nil && isGCPAccessDeniedError(volumes.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -345,7 +484,7 @@ func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error)
 	for _, disk := range volumes.Items {
 		creationTime, err := time.Parse(time.RFC3339, disk.CreationTimestamp)
 		if err != nil {
-			log.Printf("Could not parse timestamp of %s (in %s): %s", disk.Name, project, err)
+			status.Warnf("Could not parse timestamp of %s (in %s): %s", disk.Name, AccountDisplayName(project), err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
@@ -365,18 +504,19 @@ func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error)
 					tags:         labels,
 				},
 				sizeGB:     disk.SizeGb,
-				encrypted:  false,
+				encrypted:  true,
 				attached:   disk.Users != nil && len(disk.Users) > 0,
 				volumeType: parseGCPResourceURL(disk.Type),
 			},
 			compute: m.compute,
 		})
 	}
+	recordResources(GCP, ResourceTypeVolumes, len(diskList))
 	return diskList, nil
 }
 
 func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
-	snapshots, err := m.compute.Snapshots.List(project).Do()
+	snapshots, err := m.compute.Snapshots.List(project).Context(m.timeouts.context(project, "")).Do()
 	if err != nil {
 		if snapshots != nil && isGCPAccessDeniedError(snapshots.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -387,7 +527,7 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 	for _, snap := range snapshots.Items {
 		creationTime, err := time.Parse(time.RFC3339, snap.CreationTimestamp)
 		if err != nil {
-			log.Printf("Could not parse timestamp of %s (in %s): %s", snap.Name, project, err)
+			status.Warnf("Could not parse timestamp of %s (in %s): %s", snap.Name, AccountDisplayName(project), err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
@@ -395,29 +535,36 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 		if labels == nil {
 			labels = make(map[string]string)
 		}
+		// The location of a snapshot is where its data is stored, which is
+		// a region or a multi-region
+		location := ""
+		if len(snap.StorageLocations) > 0 {
+			location = snap.StorageLocations[0]
+		}
 		snapList = append(snapList, &gcpSnapshot{
 			baseSnapshot: baseSnapshot{
 				baseResource: baseResource{
 					csp:          GCP,
 					id:           snap.Name,
 					owner:        project,
-					location:     "",
+					location:     location,
 					public:       true,
 					creationTime: creationTime,
 					tags:         labels,
 				},
-				encrypted: false,
+				encrypted: true,
 				inUse:     false,
 				sizeGB:    snap.DiskSizeGb,
 			},
 			compute: m.compute,
 		})
 	}
+	recordResources(GCP, ResourceTypeSnapshots, len(snapList))
 	return snapList, nil
 }
 
 func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
-	buckets, err := m.storage.Buckets.List(project).Do()
+	buckets, err := m.storage.Buckets.List(project).Context(m.timeouts.context(project, "")).Do()
 	if err != nil {
 		if buckets != nil && isGCPAccessDeniedError(buckets.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -439,9 +586,9 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 		if labels == nil {
 			labels = make(map[string]string)
 		}
-		count, size, err := m.bucketDetails(buck.Name)
-		if err != nil {
-			log.Printf("Could not get object details for %s: %s", buck.Name, err)
+		count, size, classSizes, err := m.bucketDetails(project, buck.Name, buck.StorageClass)
+		if err != nil && !m.timeouts.expired(project, "") {
+			status.Warnf("Could not get object details for %s: %s", buck.Name, err)
 		}
 		buckList = append(buckList, &gcpBucket{
 			baseBucket: baseBucket{
@@ -457,35 +604,44 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 				lastModified:       lastModified,
 				objectCount:        count,
 				totalSizeGB:        size,
-				storageTypeSizesGB: make(map[string]float64),
+				storageTypeSizesGB: classSizes,
+				empty:              err == nil && count == 0,
 			},
 			storage: m.storage,
 		})
 	}
+	recordResources(GCP, ResourceTypeBuckets, len(buckList))
 	return buckList, nil
 }
 
-// bucketDetails will determine how many objects there are in a bucket and what
-// the total bucket size is.
-func (m *gcpResourceManager) bucketDetails(bucketID string) (int64, float64, error) {
+// bucketDetails will determine how many objects there are in a bucket, what
+// the total bucket size is, and the size per storage class. Objects without
+// a storage class of their own are in the default class of the bucket.
+func (m *gcpResourceManager) bucketDetails(project, bucketID, defaultClass string) (int64, float64, map[string]float64, error) {
 	var count int64
 	var sizeGB float64
+	classSizes := make(map[string]float64)
 	var nextPageToken string
 	for ok := true; ok; ok = nextPageToken != "" {
-		objs, err := m.storage.Objects.List(bucketID).Do()
+		objs, err := m.storage.Objects.List(bucketID).PageToken(nextPageToken).Context(m.timeouts.context(project, "")).Do()
 		if err != nil {
 			if objs != nil && isGCPAccessDeniedError(objs.HTTPStatusCode) {
-				return 0, 0.0, ErrPermissionDenied
+				return 0, 0.0, make(map[string]float64), ErrPermissionDenied
 			}
-			return 0, 0.0, err
+			return 0, 0.0, make(map[string]float64), err
 		}
 		nextPageToken = objs.NextPageToken
 		for _, obj := range objs.Items {
+			class := obj.StorageClass
+			if class == "" {
+				class = defaultClass
+			}
 			sizeGB += (float64(obj.Size) / gbDivider)
+			classSizes[class] += float64(obj.Size) / gbDivider
 			count++
 		}
 	}
-	return count, sizeGB, nil
+	return count, sizeGB, classSizes, nil
 }
 
 // Figure out if http response code is permission denied
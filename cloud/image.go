@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -16,8 +18,9 @@ import (
 
 type baseImage struct {
 	baseResource
-	name   string
-	sizeGB int64
+	name     string
+	sizeGB   int64
+	lastUsed time.Time
 }
 
 func (i *baseImage) Name() string {
@@ -28,6 +31,14 @@ func (i *baseImage) SizeGB() int64 {
 	return i.sizeGB
 }
 
+func (i *baseImage) LastUsed() time.Time {
+	return i.lastUsed
+}
+
+func (i *baseImage) setLastUsed(t time.Time) {
+	i.lastUsed = t
+}
+
 func cleanupImages(images []Image) error {
 	resList := []Resource{}
 	for i := range images {
@@ -40,10 +51,78 @@ func cleanupImages(images []Image) error {
 	return cleanupResources(resList)
 }
 
+// ImageCopy is implemented by images which can be copies of an image in
+// another location, such as AMIs copied to other regions. Not every CSP
+// has those, so use a type assertion on the Image to check for support.
+type ImageCopy interface {
+	// CopiedFrom returns the ID and location of the image this image was
+	// copied from, or empty strings if it's not a copy
+	CopiedFrom() (id, location string)
+	// CleanupWithSnapshots removes the image and the snapshots backing
+	// it, which are kept when only the image is removed
+	CleanupWithSnapshots() error
+}
+
+// ImageSnapshots is implemented by images which are backed by snapshots,
+// such as EBS-backed AMIs. Use a type assertion on the Image to check
+// for support.
+type ImageSnapshots interface {
+	// SnapshotIDs returns the IDs of the snapshots backing the image
+	SnapshotIDs() []string
+}
+
 // AWS
 
+// awsImageCopyDescription matches the description CopyImage gives AMIs,
+// unless another description is specified
+var awsImageCopyDescription = regexp.MustCompile(`^\[Copied (ami-[0-9a-f]+) from ([a-z0-9-]+)\]`)
+
 type awsImage struct {
 	baseImage
+	sourceID     string
+	sourceRegion string
+	snapshotIDs  []string
+}
+
+// parseAWSImageCopy returns the source image and region in the
+// description of an AMI copy
+func parseAWSImageCopy(description string) (string, string) {
+	match := awsImageCopyDescription.FindStringSubmatch(description)
+	if match == nil {
+		return "", ""
+	}
+	return match[1], match[2]
+}
+
+func (i *awsImage) CopiedFrom() (string, string) {
+	return i.sourceID, i.sourceRegion
+}
+
+func (i *awsImage) SnapshotIDs() []string {
+	return i.snapshotIDs
+}
+
+func (i *awsImage) CleanupWithSnapshots() error {
+	if err := i.Cleanup(); err != nil {
+		return err
+	}
+	client := clientForAWSResource(i)
+	for _, snapshotID := range i.snapshotIDs {
+		log.Printf("Cleaning up snapshot %s of image %s in %s", snapshotID, i.ID(), i.Owner())
+		err := awsTryWithBackoff(func() error {
+			_, err := client.DeleteSnapshot(&ec2.DeleteSnapshotInput{
+				SnapshotId: aws.String(snapshotID),
+			})
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == requestLimitErrorCode {
+				return errAWSRequestLimit
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (i *awsImage) Cleanup() error {
@@ -111,6 +190,7 @@ func (i *gcpImage) Cleanup() error {
 }
 
 func (i *gcpImage) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(GCP, key, value)
 	img, err := i.compute.Images.Get(i.Owner(), i.ID()).Do()
 	if err != nil {
 		return nil
@@ -136,6 +216,7 @@ func (i *gcpImage) SetTag(key, value string, overwrite bool) error {
 }
 
 func (i *gcpImage) RemoveTag(key string) error {
+	key, _ = NormalizeTag(GCP, key, "")
 	newLabels := make(map[string]string)
 	for k, val := range i.tags {
 		if k != key {
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/imagebuilder"
+)
+
+func (m *awsResourceManager) ForEachAccountImageBuilds(f func(string, []ImageBuild)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.types.owners(m.accounts, ResourceTypeImages), m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		builds := []ImageBuild{}
+		var buildsMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			// Image Builder isn't available in every region, so failures
+			// only skip the region
+			ib := imagebuilder.New(sess, &aws.Config{Credentials: cred, Region: aws.String(client.region)})
+			regionBuilds, err := getAWSImageBuilds(account, ib)
+			if err != nil {
+				status.Warnf("Could not list Image Builder images in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			buildsMutex.Lock()
+			builds = append(builds, regionBuilds...)
+			buildsMutex.Unlock()
+		})
+		if len(builds) == 0 {
+			return
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, builds)
+	})
+}
+
+// getAWSImageBuilds lists every build version of the images owned by the
+// account, which produced AMIs. The recipe of a build is the name of its
+// image, which is the name of the recipe it was built from.
+func getAWSImageBuilds(account string, client *imagebuilder.Imagebuilder) ([]ImageBuild, error) {
+	result := []ImageBuild{}
+	versionARNs := []string{}
+	input := &imagebuilder.ListImagesInput{Owner: aws.String(imagebuilder.OwnershipSelf)}
+	err := client.ListImagesPages(input, func(page *imagebuilder.ListImagesOutput, lastPage bool) bool {
+		for _, version := range page.ImageVersionList {
+			versionARNs = append(versionARNs, aws.StringValue(version.Arn))
+		}
+		return true
+	})
+	if err != nil {
+		return result, err
+	}
+	for _, arn := range versionARNs {
+		input := &imagebuilder.ListImageBuildVersionsInput{ImageVersionArn: aws.String(arn)}
+		err := client.ListImageBuildVersionsPages(input, func(page *imagebuilder.ListImageBuildVersionsOutput, lastPage bool) bool {
+			for _, summary := range page.ImageSummaryList {
+				if summary.State == nil || aws.StringValue(summary.State.Status) != imagebuilder.ImageStatusAvailable || summary.OutputResources == nil {
+					continue
+				}
+				build := ImageBuild{
+					Account: account,
+					Recipe:  aws.StringValue(summary.Name),
+					Version: aws.StringValue(summary.Version),
+				}
+				// The creation time is an ISO 8601 timestamp
+				if created, err := time.Parse(time.RFC3339, aws.StringValue(summary.DateCreated)); err == nil {
+					build.Created = created
+				}
+				for _, ami := range summary.OutputResources.Amis {
+					if id := aws.StringValue(ami.Image); id != "" {
+						build.ImageIDs = append(build.ImageIDs, id)
+					}
+				}
+				if len(build.ImageIDs) > 0 {
+					result = append(result, build)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -7,23 +7,131 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
 	compute "google.golang.org/api/compute/v1"
 )
 
+// The platforms, tenancies and lifecycles of instances, which decide
+// what they cost together with their type and location
+const (
+	PlatformLinux     = "Linux/UNIX"
+	PlatformWindows   = "Windows"
+	TenancyDefault    = "default"
+	LifecycleOnDemand = "on-demand"
+	LifecycleSpot     = "spot"
+)
+
+// gcpGPUMachineSeries are the GCP machine series which come with GPUs
+var gcpGPUMachineSeries = []string{"a2", "a3", "g2"}
+
+// IsGPUInstanceType returns true if instances of the type come with GPUs,
+// which are the AWS p and g families, e.g. p4d.24xlarge and g5.xlarge,
+// and the GCP accelerator-optimized series, e.g. a2-highgpu-1g. GCP
+// instances with GPUs attached to another machine type aren't known.
+func IsGPUInstanceType(instanceType string) bool {
+	if i := strings.Index(instanceType, "."); i > 0 {
+		return instanceType[0] == 'p' || instanceType[0] == 'g'
+	}
+	series := strings.SplitN(instanceType, "-", 2)[0]
+	for _, gpuSeries := range gcpGPUMachineSeries {
+		if series == gpuSeries {
+			return true
+		}
+	}
+	return false
+}
+
 type baseInstance struct {
 	baseResource
 	instanceType string
+	imageID      string
+	platform     string
+	tenancy      string
+	lifecycle    string
 }
 
 func (i *baseInstance) InstanceType() string {
 	return i.instanceType
 }
 
+// InstanceImage is implemented by instances which know the image they
+// were launched from. Use a type assertion on the Instance to check for
+// support.
+type InstanceImage interface {
+	// ImageID returns the ID of the image the instance was launched from
+	ImageID() string
+}
+
+func (i *awsInstance) ImageID() string {
+	return i.imageID
+}
+
+// InstancePricing is implemented by instances which know what decides
+// their price apart from their type and location. Instances which don't
+// are priced as on-demand Linux instances on shared hardware. Use a type
+// assertion on the Instance to check for support.
+type InstancePricing interface {
+	// Platform is the operating system, Linux/UNIX or Windows
+	Platform() string
+	// Tenancy is default for shared hardware, dedicated or host
+	Tenancy() string
+	// Lifecycle is on-demand, spot or scheduled
+	Lifecycle() string
+}
+
+func (i *awsInstance) Platform() string {
+	return i.platform
+}
+
+func (i *awsInstance) Tenancy() string {
+	return i.tenancy
+}
+
+func (i *awsInstance) Lifecycle() string {
+	return i.lifecycle
+}
+
+// awsInstancePlatform returns the platform of an instance from its
+// platform, which is only set for Windows instances
+func awsInstancePlatform(platform string) string {
+	if strings.EqualFold(platform, PlatformWindows) {
+		return PlatformWindows
+	}
+	return PlatformLinux
+}
+
+// awsInstanceTenancy returns the tenancy of an instance, which is only
+// set for instances which aren't on shared hardware
+func awsInstanceTenancy(tenancy string) string {
+	if tenancy == "" {
+		return TenancyDefault
+	}
+	return tenancy
+}
+
+func awsPlacementTenancy(placement *ec2.Placement) string {
+	if placement == nil {
+		return ""
+	}
+	return aws.StringValue(placement.Tenancy)
+}
+
+// awsInstanceLifecycle returns the lifecycle of an instance, which is
+// only set for instances which aren't on-demand
+func awsInstanceLifecycle(lifecycle string) string {
+	if lifecycle == "" {
+		return LifecycleOnDemand
+	}
+	return lifecycle
+}
+
 func cleanupInstances(instances []Instance) error {
 	resList := []Resource{}
 	for i := range instances {
@@ -40,12 +148,23 @@ func cleanupInstances(instances []Instance) error {
 
 type awsInstance struct {
 	baseInstance
+	debris *InstanceDebris
+	// staleTags is true if the tags were read from an AWS Config
+	// aggregator, and may be out of date
+	staleTags bool
 }
 
-// Cleanup will termiante this instance
+// Cleanup will termiante this instance, and delete the alarms on it. Its
+// Elastic IPs are released if enabled.
 func (i *awsInstance) Cleanup() error {
 	log.Printf("Cleaning up instance %s in %s", i.ID(), i.Owner())
-	return awsTryWithBackoff(i.cleanup)
+	debris := i.findDebris()
+	if err := awsTryWithBackoff(i.cleanup); err != nil {
+		return err
+	}
+	i.cleanupDebris(debris)
+	i.debris = debris
+	return nil
 }
 
 func (i *awsInstance) cleanup() error {
@@ -85,6 +204,7 @@ func (i *gcpInstance) Cleanup() error {
 }
 
 func (i *gcpInstance) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(GCP, key, value)
 	inst, err := i.compute.Instances.Get(i.Owner(), i.Location(), i.ID()).Do()
 	if err != nil {
 		return err
@@ -110,6 +230,7 @@ func (i *gcpInstance) SetTag(key, value string, overwrite bool) error {
 }
 
 func (i *gcpInstance) RemoveTag(key string) error {
+	key, _ = NormalizeTag(GCP, key, "")
 	newLabels := make(map[string]string)
 	for k, val := range i.tags {
 		if k != key {
@@ -131,3 +252,100 @@ func (i *gcpInstance) RemoveTag(key string) error {
 	i.tags = newLabels
 	return nil
 }
+
+// Kubernetes
+
+type kubernetesInstance struct {
+	baseInstance
+	client *kubernetesClient
+	path   string
+}
+
+// Cleanup will delete this namespace, job or replica set
+func (i *kubernetesInstance) Cleanup() error {
+	log.Printf("Cleaning up %s %s in %s", i.InstanceType(), i.ID(), i.Location())
+	return i.client.delete(i.path)
+}
+
+func (i *kubernetesInstance) SetTag(key, value string, overwrite bool) error {
+	return addKubernetesTag(i.client, i.path, i, key, value, overwrite)
+}
+
+func (i *kubernetesInstance) RemoveTag(key string) error {
+	return removeKubernetesTag(i.client, i.path, i, key)
+}
+
+// vSphere
+
+type vsphereInstance struct {
+	baseInstance
+	client *vsphereClient
+	name   string
+	ref    types.ManagedObjectReference
+}
+
+// Name is the name of the VM in the inventory
+func (i *vsphereInstance) Name() string {
+	return i.name
+}
+
+// Cleanup will power off and destroy this VM, deleting its disks
+func (i *vsphereInstance) Cleanup() error {
+	log.Printf("Cleaning up VM %s (%s) in %s", i.Name(), i.ID(), i.Owner())
+	ctx := i.client.context()
+	c, err := i.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	vm := object.NewVirtualMachine(c, i.ref)
+	state, err := vm.PowerState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == types.VirtualMachinePowerStatePoweredOn {
+		task, err := vm.PowerOff(ctx)
+		if err != nil {
+			return err
+		}
+		if err := task.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+func (i *vsphereInstance) SetTag(key, value string, overwrite bool) error {
+	if _, exist := i.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, i.ID())
+	}
+	ctx := i.client.context()
+	c, err := i.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := setVSphereField(ctx, c, i.ref, key, value); err != nil {
+		return err
+	}
+	i.tags[key] = value
+	return nil
+}
+
+func (i *vsphereInstance) RemoveTag(key string) error {
+	if _, exist := i.tags[key]; !exist {
+		return nil
+	}
+	ctx := i.client.context()
+	c, err := i.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := setVSphereField(ctx, c, i.ref, key, ""); err != nil {
+		return err
+	}
+	delete(i.tags, key)
+	return nil
+}
@@ -0,0 +1,511 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/schema"
+)
+
+// ErrInventoryReadOnly is returned when trying to clean up resources
+// read from a recorded Inventory
+var ErrInventoryReadOnly = errors.New("Resources in a recorded inventory can't be cleaned up")
+
+// InventorySchemaVersion is the version of the format of inventory files
+// written by WriteInventory. ReadInventory reads this version and the one
+// before it, which is the same format without the version.
+const InventorySchemaVersion = 2
+
+// oldestInventorySchemaVersion is the oldest version ReadInventory reads
+const oldestInventorySchemaVersion = 1
+
+// Inventory is the format of a recorded inventory file
+type Inventory struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	Recorded      time.Time           `json:"recorded"`
+	Accounts      []*InventoryAccount `json:"accounts"`
+}
+
+// InventoryAccount holds the recorded resources of an account, and its
+// friendly name if it has one
+type InventoryAccount struct {
+	Owner     string             `json:"owner"`
+	Name      string             `json:"name,omitempty"`
+	Instances []*InventoryRecord `json:"instances,omitempty"`
+	Images    []*InventoryRecord `json:"images,omitempty"`
+	Volumes   []*InventoryRecord `json:"volumes,omitempty"`
+	Snapshots []*InventoryRecord `json:"snapshots,omitempty"`
+	Buckets   []*InventoryRecord `json:"buckets,omitempty"`
+}
+
+// InventoryRecord holds every attribute of a resource. Only the ones
+// relevant to the type of resource are set.
+type InventoryRecord struct {
+	CSP          CSP               `json:"csp"`
+	Owner        string            `json:"owner"`
+	ID           string            `json:"id"`
+	Location     string            `json:"location"`
+	Public       bool              `json:"public,omitempty"`
+	CreationTime time.Time         `json:"creation_time"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	LastTagged   *time.Time        `json:"last_tagged,omitempty"`
+
+	InstanceType       string             `json:"instance_type,omitempty"`
+	PricePerHour       float64            `json:"price_per_hour,omitempty"`
+	Name               string             `json:"name,omitempty"`
+	SizeGB             int64              `json:"size_gb,omitempty"`
+	Attached           bool               `json:"attached,omitempty"`
+	Encrypted          bool               `json:"encrypted,omitempty"`
+	InUse              bool               `json:"in_use,omitempty"`
+	VolumeType         string             `json:"volume_type,omitempty"`
+	LastUsed           *time.Time         `json:"last_used,omitempty"`
+	LastModified       *time.Time         `json:"last_modified,omitempty"`
+	LastRead           *time.Time         `json:"last_read,omitempty"`
+	ObjectCount        int64              `json:"object_count,omitempty"`
+	TotalSizeGB        float64            `json:"total_size_gb,omitempty"`
+	StorageTypeSizesGB map[string]float64 `json:"storage_type_sizes_gb,omitempty"`
+	Empty              bool               `json:"empty,omitempty"`
+}
+
+// WriteInventory will discover all resources of the resource manager,
+// and write them as JSON to the writer. The recorded inventory can be
+// read with ReadInventory, to evaluate rules against it offline. The
+// price of every instance is recorded using the specified function, so
+// that it doesn't have to be looked up offline.
+func WriteInventory(w io.Writer, mngr ResourceManager, instancePrice func(Instance) float64) error {
+	inv := Inventory{SchemaVersion: InventorySchemaVersion, Recorded: time.Now().UTC(), Accounts: []*InventoryAccount{}}
+	var accountsMutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *AllResourceCollection) {
+		account := &InventoryAccount{Owner: res.Owner, Name: AccountName(res.Owner)}
+		for _, inst := range res.Instances {
+			account.Instances = append(account.Instances, NewInventoryRecord(inst, instancePrice))
+		}
+		for _, img := range res.Images {
+			account.Images = append(account.Images, NewInventoryRecord(img, instancePrice))
+		}
+		for _, vol := range res.Volumes {
+			account.Volumes = append(account.Volumes, NewInventoryRecord(vol, instancePrice))
+		}
+		for _, snap := range res.Snapshots {
+			account.Snapshots = append(account.Snapshots, NewInventoryRecord(snap, instancePrice))
+		}
+		for _, buck := range res.Buckets {
+			account.Buckets = append(account.Buckets, NewInventoryRecord(buck, instancePrice))
+		}
+		for _, records := range [][]*InventoryRecord{account.Instances, account.Images, account.Volumes, account.Snapshots, account.Buckets} {
+			sortInventoryRecords(records)
+		}
+		accountsMutex.Lock()
+		defer accountsMutex.Unlock()
+		inv.Accounts = append(inv.Accounts, account)
+	})
+	// Accounts are discovered in parallel, so they are sorted to write the
+	// same file for the same resources
+	sort.Slice(inv.Accounts, func(i, j int) bool {
+		return inv.Accounts[i].Owner < inv.Accounts[j].Owner
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inv)
+}
+
+func sortInventoryRecords(records []*InventoryRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+}
+
+// NewInventoryRecord returns the record of a resource, as it's written to
+// an inventory. The price of an instance is looked up with the specified
+// function.
+func NewInventoryRecord(res Resource, instancePrice func(Instance) float64) *InventoryRecord {
+	record := &InventoryRecord{
+		CSP:          res.CSP(),
+		Owner:        res.Owner(),
+		ID:           res.ID(),
+		Location:     res.Location(),
+		Public:       res.Public(),
+		CreationTime: res.CreationTime(),
+		Tags:         res.Tags(),
+	}
+	if tagged, ok := res.(TagActivity); ok {
+		record.LastTagged = optionalTime(tagged.LastTagged())
+	}
+	switch res := res.(type) {
+	case Instance:
+		record.InstanceType = res.InstanceType()
+		record.PricePerHour = instancePrice(res)
+	case Image:
+		record.Name = res.Name()
+		record.SizeGB = res.SizeGB()
+		record.LastUsed = optionalTime(res.LastUsed())
+	case Volume:
+		record.SizeGB = res.SizeGB()
+		record.Attached = res.Attached()
+		record.Encrypted = res.Encrypted()
+		record.VolumeType = res.VolumeType()
+	case Snapshot:
+		record.SizeGB = res.SizeGB()
+		record.Encrypted = res.Encrypted()
+		record.InUse = res.InUse()
+		record.LastUsed = optionalTime(res.LastUsed())
+	case Bucket:
+		record.LastModified = optionalTime(res.LastModified())
+		record.LastRead = optionalTime(res.LastRead())
+		record.ObjectCount = res.ObjectCount()
+		record.TotalSizeGB = res.TotalSizeGB()
+		record.StorageTypeSizesGB = res.StorageTypeSizesGB()
+		record.Empty = res.Empty()
+	}
+	return record
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// ReadInventory reads an inventory written by WriteInventory, by this or
+// the previous version of Cloudsweeper. Inventories of older versions are
+// read as the current version.
+func ReadInventory(r io.Reader) (*Inventory, error) {
+	inv := new(Inventory)
+	if err := json.NewDecoder(r).Decode(inv); err != nil {
+		return nil, err
+	}
+	version := schema.Version(inv.SchemaVersion)
+	if err := schema.Check("inventory", version, oldestInventorySchemaVersion, InventorySchemaVersion); err != nil {
+		return nil, err
+	}
+	inv.SchemaVersion = InventorySchemaVersion
+	return inv, nil
+}
+
+// Manager returns a resource manager with the resources of the inventory.
+// All times are moved forward by the time passed since the inventory was
+// recorded, so that rules based on age are evaluated as they would have
+// been at the time of recording. Dates in tag values are not moved. Tags
+// can be changed, but only in memory, and cleaning up resources returns
+// ErrInventoryReadOnly.
+func (inv *Inventory) Manager() ResourceManager {
+	shift := time.Since(inv.Recorded)
+	if inv.Recorded.IsZero() {
+		shift = 0
+	}
+	m := &inventoryResourceManager{accounts: []*AllResourceCollection{}}
+	for _, account := range inv.Accounts {
+		res := &AllResourceCollection{Owner: account.Owner}
+		for _, record := range account.Instances {
+			inst := &inventoryInstance{baseInstance{baseResource: record.resource(shift), instanceType: record.InstanceType}, record.PricePerHour}
+			res.Instances = append(res.Instances, inst)
+		}
+		for _, record := range account.Images {
+			img := &inventoryImage{baseImage{record.resource(shift), record.Name, record.SizeGB, shiftTime(record.LastUsed, shift)}}
+			res.Images = append(res.Images, img)
+		}
+		for _, record := range account.Volumes {
+			vol := &inventoryVolume{baseVolume{record.resource(shift), record.SizeGB, record.Attached, record.Encrypted, record.VolumeType}}
+			res.Volumes = append(res.Volumes, vol)
+		}
+		for _, record := range account.Snapshots {
+			snap := &inventorySnapshot{baseSnapshot{record.resource(shift), record.Encrypted, record.InUse, record.SizeGB, shiftTime(record.LastUsed, shift)}}
+			res.Snapshots = append(res.Snapshots, snap)
+		}
+		for _, record := range account.Buckets {
+			buck := &inventoryBucket{baseBucket{
+				baseResource:       record.resource(shift),
+				lastModified:       shiftTime(record.LastModified, shift),
+				lastRead:           shiftTime(record.LastRead, shift),
+				objectCount:        record.ObjectCount,
+				totalSizeGB:        record.TotalSizeGB,
+				storageTypeSizesGB: record.StorageTypeSizesGB,
+				empty:              record.Empty,
+			}}
+			res.Buckets = append(res.Buckets, buck)
+		}
+		m.accounts = append(m.accounts, res)
+	}
+	return m
+}
+
+// AccountNames returns the names of the accounts/projects at the time the
+// inventory was recorded, for the accounts which had one. They can be
+// passed to SetAccountNames to display the accounts by name.
+func (inv *Inventory) AccountNames() map[string]string {
+	names := make(map[string]string)
+	for _, account := range inv.Accounts {
+		if account.Name != "" {
+			names[account.Owner] = account.Name
+		}
+	}
+	return names
+}
+
+func (r *InventoryRecord) resource(shift time.Duration) baseResource {
+	tags := r.Tags
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	return baseResource{
+		csp:          r.CSP,
+		owner:        r.Owner,
+		id:           r.ID,
+		tags:         tags,
+		location:     r.Location,
+		public:       r.Public,
+		creationTime: r.CreationTime.Add(shift),
+		lastTagged:   shiftTime(r.LastTagged, shift),
+	}
+}
+
+func shiftTime(t *time.Time, shift time.Duration) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Add(shift)
+}
+
+// inventoryResourceManager serves resources from a recorded Inventory
+type inventoryResourceManager struct {
+	accounts []*AllResourceCollection
+}
+
+func (m *inventoryResourceManager) Owners() []string {
+	owners := []string{}
+	for _, res := range m.accounts {
+		owners = append(owners, res.Owner)
+	}
+	return owners
+}
+
+func (m *inventoryResourceManager) InstancesPerAccount() map[string][]Instance {
+	result := make(map[string][]Instance)
+	for _, res := range m.accounts {
+		result[res.Owner] = append(result[res.Owner], res.Instances...)
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) ImagesPerAccount() map[string][]Image {
+	result := make(map[string][]Image)
+	for _, res := range m.accounts {
+		result[res.Owner] = append(result[res.Owner], res.Images...)
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) VolumesPerAccount() map[string][]Volume {
+	result := make(map[string][]Volume)
+	for _, res := range m.accounts {
+		result[res.Owner] = append(result[res.Owner], res.Volumes...)
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
+	result := make(map[string][]Snapshot)
+	for _, res := range m.accounts {
+		result[res.Owner] = append(result[res.Owner], res.Snapshots...)
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) BucketsPerAccount() map[string][]Bucket {
+	result := make(map[string][]Bucket)
+	for _, res := range m.accounts {
+		result[res.Owner] = append(result[res.Owner], res.Buckets...)
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) AllResourcesPerAccount() map[string]*ResourceCollection {
+	result := make(map[string]*ResourceCollection)
+	for _, res := range m.accounts {
+		result[res.Owner] = &ResourceCollection{
+			Owner:     res.Owner,
+			Instances: res.Instances,
+			Images:    res.Images,
+			Volumes:   res.Volumes,
+			Snapshots: res.Snapshots,
+		}
+	}
+	return result
+}
+
+func (m *inventoryResourceManager) ForEachAccountResources(f func(*AllResourceCollection)) {
+	for _, res := range m.accounts {
+		f(res)
+	}
+}
+
+func (m *inventoryResourceManager) ForEachInstance(f func(Instance)) {
+	for _, res := range m.accounts {
+		for _, inst := range res.Instances {
+			f(inst)
+		}
+	}
+}
+
+func (m *inventoryResourceManager) ForEachImage(f func(Image)) {
+	for _, res := range m.accounts {
+		for _, img := range res.Images {
+			f(img)
+		}
+	}
+}
+
+func (m *inventoryResourceManager) ForEachVolume(f func(Volume)) {
+	for _, res := range m.accounts {
+		for _, vol := range res.Volumes {
+			f(vol)
+		}
+	}
+}
+
+func (m *inventoryResourceManager) ForEachSnapshot(f func(Snapshot)) {
+	for _, res := range m.accounts {
+		for _, snap := range res.Snapshots {
+			f(snap)
+		}
+	}
+}
+
+func (m *inventoryResourceManager) ForEachBucket(f func(Bucket)) {
+	for _, res := range m.accounts {
+		for _, buck := range res.Buckets {
+			f(buck)
+		}
+	}
+}
+
+func (m *inventoryResourceManager) ForEachResource(f func(Resource)) {
+	m.ForEachAccountResources(func(res *AllResourceCollection) {
+		for _, r := range res.Resources() {
+			f(r)
+		}
+	})
+}
+
+func (m *inventoryResourceManager) CleanupInstances(instances []Instance) error {
+	return ErrInventoryReadOnly
+}
+
+func (m *inventoryResourceManager) CleanupImages(images []Image) error {
+	return ErrInventoryReadOnly
+}
+
+func (m *inventoryResourceManager) CleanupVolumes(volumes []Volume) error {
+	return ErrInventoryReadOnly
+}
+
+func (m *inventoryResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
+	return ErrInventoryReadOnly
+}
+
+func (m *inventoryResourceManager) CleanupBuckets(buckets []Bucket) error {
+	return ErrInventoryReadOnly
+}
+
+// setInventoryTag sets a tag of a recorded resource, in memory only
+func setInventoryTag(r *baseResource, key, value string, overwrite bool) error {
+	if _, exist := r.tags[key]; exist && !overwrite {
+		return nil
+	}
+	r.tags[key] = value
+	return nil
+}
+
+type inventoryInstance struct {
+	baseInstance
+	pricePerHour float64
+}
+
+func (i *inventoryInstance) RecordedPricePerHour() float64 {
+	return i.pricePerHour
+}
+
+func (i *inventoryInstance) SetTag(key, value string, overwrite bool) error {
+	return setInventoryTag(&i.baseResource, key, value, overwrite)
+}
+
+func (i *inventoryInstance) RemoveTag(key string) error {
+	delete(i.tags, key)
+	return nil
+}
+
+func (i *inventoryInstance) Cleanup() error {
+	return ErrInventoryReadOnly
+}
+
+type inventoryImage struct{ baseImage }
+
+func (i *inventoryImage) SetTag(key, value string, overwrite bool) error {
+	return setInventoryTag(&i.baseResource, key, value, overwrite)
+}
+
+func (i *inventoryImage) RemoveTag(key string) error {
+	delete(i.tags, key)
+	return nil
+}
+
+func (i *inventoryImage) Cleanup() error {
+	return ErrInventoryReadOnly
+}
+
+func (i *inventoryImage) MakePrivate() error {
+	return ErrInventoryReadOnly
+}
+
+type inventoryVolume struct{ baseVolume }
+
+func (v *inventoryVolume) SetTag(key, value string, overwrite bool) error {
+	return setInventoryTag(&v.baseResource, key, value, overwrite)
+}
+
+func (v *inventoryVolume) RemoveTag(key string) error {
+	delete(v.tags, key)
+	return nil
+}
+
+func (v *inventoryVolume) Cleanup() error {
+	return ErrInventoryReadOnly
+}
+
+type inventorySnapshot struct{ baseSnapshot }
+
+func (s *inventorySnapshot) SetTag(key, value string, overwrite bool) error {
+	return setInventoryTag(&s.baseResource, key, value, overwrite)
+}
+
+func (s *inventorySnapshot) RemoveTag(key string) error {
+	delete(s.tags, key)
+	return nil
+}
+
+func (s *inventorySnapshot) Cleanup() error {
+	return ErrInventoryReadOnly
+}
+
+type inventoryBucket struct{ baseBucket }
+
+func (b *inventoryBucket) SetTag(key, value string, overwrite bool) error {
+	return setInventoryTag(&b.baseResource, key, value, overwrite)
+}
+
+func (b *inventoryBucket) RemoveTag(key string) error {
+	delete(b.tags, key)
+	return nil
+}
+
+func (b *inventoryBucket) Cleanup() error {
+	return ErrInventoryReadOnly
+}
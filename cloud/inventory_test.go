@@ -0,0 +1,46 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadInventoryVersions(t *testing.T) {
+	unversioned := `{"recorded": "2018-01-29T15:04:05Z", "accounts": [{"owner": "123456789012", "volumes": [{"csp": "AWS", "owner": "123456789012", "id": "vol-1", "location": "us-east-1", "creation_time": "2018-01-01T00:00:00Z"}]}]}`
+	inv, err := ReadInventory(strings.NewReader(unversioned))
+	if err != nil {
+		t.Fatalf("Could not read an inventory without a version: %s", err)
+	}
+	if inv.SchemaVersion != InventorySchemaVersion || len(inv.Accounts) != 1 || len(inv.Accounts[0].Volumes) != 1 {
+		t.Errorf("The inventory without a version was not read as the current version")
+	}
+
+	current := `{"schemaVersion": 2, "recorded": "2018-01-29T15:04:05Z", "accounts": []}`
+	if _, err := ReadInventory(strings.NewReader(current)); err != nil {
+		t.Errorf("Could not read an inventory of the current version: %s", err)
+	}
+
+	newer := `{"schemaVersion": 3, "recorded": "2018-01-29T15:04:05Z", "accounts": []}`
+	if _, err := ReadInventory(strings.NewReader(newer)); err == nil {
+		t.Error("An inventory of a newer version should not be read")
+	}
+}
+
+func TestInventoryAccountNames(t *testing.T) {
+	recorded := `{"schemaVersion": 2, "recorded": "2018-01-29T15:04:05Z", "accounts": [{"owner": "210987654321", "name": "recorded-sandbox"}, {"owner": "123456789012"}]}`
+	inv, err := ReadInventory(strings.NewReader(recorded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.Manager()
+	if name := AccountName("210987654321"); name != "" {
+		t.Errorf("Creating the manager of an inventory set the name %q", name)
+	}
+	names := inv.AccountNames()
+	if len(names) != 1 || names["210987654321"] != "recorded-sandbox" {
+		t.Errorf("Unexpected recorded account names: %v", names)
+	}
+}
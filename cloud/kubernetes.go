@@ -0,0 +1,665 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+const (
+	kubernetesDefaultOwnerLabel = "owner"
+	kubernetesDefaultIdleDays   = 14
+
+	kubernetesTypeNamespace  = "namespace"
+	kubernetesTypeJob        = "job"
+	kubernetesTypeReplicaSet = "replicaset"
+)
+
+// Namespaces which are part of every cluster, and never considered idle
+var kubernetesSystemNamespaces = map[string]bool{
+	"default":         true,
+	"kube-system":     true,
+	"kube-public":     true,
+	"kube-node-lease": true,
+}
+
+// KubernetesCluster describes how to access the API server of
+// a Kubernetes cluster.
+type KubernetesCluster struct {
+	// Server is the URL of the API server, e.g. https://10.0.0.1:6443
+	Server string `json:"server"`
+	// TokenFile is a file containing a bearer token, e.g. for a
+	// service account allowed to list, patch and delete namespaces,
+	// jobs, replica sets and persistent volumes.
+	TokenFile string `json:"token_file"`
+	// CAFile is a PEM file with the certificate authority of the
+	// API server. The system roots are used if it's empty.
+	CAFile string `json:"ca_file,omitempty"`
+}
+
+// kubernetesResourceManager talks directly to the Kubernetes API
+// server of every cluster. Idle namespaces, completed jobs and old
+// replica sets are instances, and orphaned persistent volumes are
+// volumes. A resource is owned by the owner label of its namespace,
+// or by the cluster if the namespace has no such label. Cloudsweeper
+// tags are stored as annotations. API docs can be found at:
+// https://kubernetes.io/docs/reference/kubernetes-api/
+type kubernetesResourceManager struct {
+	clusters    []string
+	clients     map[string]*kubernetesClient
+	parallelism int
+	idleDays    int
+	ownerLabel  string
+	types       *resourceTypeSwitches
+	// timeouts bounds how long a cluster may be listed. Scopes are
+	// identified by the client of the cluster.
+	timeouts *scopeTimeouts
+}
+
+func newKubernetesManager(conf *ManagerConfig, accounts ...string) (ResourceManager, error) {
+	log.Println("Initializing Kubernetes Resource Manager")
+	manager := &kubernetesResourceManager{
+		clusters:    accounts,
+		clients:     make(map[string]*kubernetesClient, len(accounts)),
+		parallelism: conf.AccountParallelism,
+		idleDays:    conf.KubernetesIdleDays,
+		ownerLabel:  conf.KubernetesOwnerLabel,
+		types:       newResourceTypeSwitches(conf),
+		timeouts:    newScopeTimeouts(conf.Context, conf.AccountTimeout, 0),
+	}
+	if manager.idleDays <= 0 {
+		manager.idleDays = kubernetesDefaultIdleDays
+	}
+	if manager.ownerLabel == "" {
+		manager.ownerLabel = kubernetesDefaultOwnerLabel
+	}
+	for _, cluster := range accounts {
+		clusterConf, exist := conf.KubernetesClusters[cluster]
+		if !exist {
+			return nil, fmt.Errorf("No configuration for Kubernetes cluster %s", cluster)
+		}
+		client, err := newKubernetesClient(cluster, clusterConf)
+		if err != nil {
+			return nil, err
+		}
+		client.timeouts = manager.timeouts
+		manager.clients[cluster] = client
+	}
+	return manager, nil
+}
+
+func (m *kubernetesResourceManager) Owners() []string {
+	return m.clusters
+}
+
+func (m *kubernetesResourceManager) InstancesPerAccount() map[string][]Instance {
+	result := make(map[string][]Instance)
+	for owner, collection := range m.collect() {
+		result[owner] = collection.Instances
+	}
+	return result
+}
+
+func (m *kubernetesResourceManager) ImagesPerAccount() map[string][]Image {
+	return make(map[string][]Image)
+}
+
+func (m *kubernetesResourceManager) VolumesPerAccount() map[string][]Volume {
+	result := make(map[string][]Volume)
+	for owner, collection := range m.collect() {
+		result[owner] = collection.Volumes
+	}
+	return result
+}
+
+func (m *kubernetesResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
+	return make(map[string][]Snapshot)
+}
+
+func (m *kubernetesResourceManager) BucketsPerAccount() map[string][]Bucket {
+	return make(map[string][]Bucket)
+}
+
+func (m *kubernetesResourceManager) AllResourcesPerAccount() map[string]*ResourceCollection {
+	result := make(map[string]*ResourceCollection)
+	for owner, collection := range m.collect() {
+		result[owner] = &ResourceCollection{
+			Owner:     owner,
+			Instances: collection.Instances,
+			Volumes:   collection.Volumes,
+		}
+	}
+	return result
+}
+
+// ForEachAccountResources hands over one owner at a time. Since an owner
+// can have resources in several clusters, all clusters are listed first.
+func (m *kubernetesResourceManager) ForEachAccountResources(f func(*AllResourceCollection)) {
+	log.Println("Going through all resources in all clusters")
+	for _, collection := range m.collect() {
+		f(collection)
+	}
+}
+
+func (m *kubernetesResourceManager) ForEachInstance(f func(Instance)) {
+	for _, collection := range m.collect() {
+		for i := range collection.Instances {
+			f(collection.Instances[i])
+		}
+	}
+}
+
+func (m *kubernetesResourceManager) ForEachImage(f func(Image)) {}
+
+func (m *kubernetesResourceManager) ForEachVolume(f func(Volume)) {
+	for _, collection := range m.collect() {
+		for i := range collection.Volumes {
+			f(collection.Volumes[i])
+		}
+	}
+}
+
+func (m *kubernetesResourceManager) ForEachSnapshot(f func(Snapshot)) {}
+
+func (m *kubernetesResourceManager) ForEachBucket(f func(Bucket)) {}
+
+func (m *kubernetesResourceManager) ForEachResource(f func(Resource)) {
+	for _, collection := range m.collect() {
+		for _, res := range collection.Resources() {
+			f(res)
+		}
+	}
+}
+
+func (m *kubernetesResourceManager) CleanupInstances(instances []Instance) error {
+	return cleanupInstances(instances)
+}
+
+func (m *kubernetesResourceManager) CleanupImages(images []Image) error {
+	return cleanupImages(images)
+}
+
+func (m *kubernetesResourceManager) CleanupVolumes(volumes []Volume) error {
+	return cleanupVolumes(volumes)
+}
+
+func (m *kubernetesResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
+	return cleanupSnapshots(snapshots)
+}
+
+func (m *kubernetesResourceManager) CleanupBuckets(buckets []Bucket) error {
+	return cleanupBuckets(buckets)
+}
+
+// collect will list the resources of all clusters, and group them
+// by owner. At most parallelism clusters are listed at the same time.
+// Resources of types disabled for their owner are left out.
+func (m *kubernetesResourceManager) collect() map[string]*AllResourceCollection {
+	result := make(map[string]*AllResourceCollection)
+	var resultMutex sync.Mutex
+	var wg sync.WaitGroup
+	limit := newLimiter(m.parallelism)
+	for _, cluster := range m.clusters {
+		wg.Add(1)
+		go func(client *kubernetesClient) {
+			defer wg.Done()
+			limit.acquire()
+			defer limit.release()
+			var instances []Instance
+			var volumes []Volume
+			var err error
+			m.timeouts.runAccount(client, "cluster "+client.cluster, func() {
+				instances, volumes, err = m.clusterResources(client)
+				if err != nil && m.timeouts.expired(client, "") {
+					// The run continues without the cluster
+					instances, volumes, err = nil, nil, nil
+				}
+			})
+			if err != nil {
+				status.DiscoveryFailedf("Could not list resources in cluster %s: %s", client.cluster, err)
+				return
+			}
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			get := func(owner string) *AllResourceCollection {
+				if _, exist := result[owner]; !exist {
+					result[owner] = &AllResourceCollection{Owner: owner}
+				}
+				return result[owner]
+			}
+			for i := range instances {
+				collection := get(instances[i].Owner())
+				collection.Instances = append(collection.Instances, instances[i])
+			}
+			for i := range volumes {
+				collection := get(volumes[i].Owner())
+				collection.Volumes = append(collection.Volumes, volumes[i])
+			}
+		}(m.clients[cluster])
+	}
+	wg.Wait()
+	for _, collection := range result {
+		m.types.filter(collection)
+	}
+	return result
+}
+
+// clusterResources will list all sweepable resources in a cluster
+func (m *kubernetesResourceManager) clusterResources(client *kubernetesClient) ([]Instance, []Volume, error) {
+	namespaces := rawKubernetesList{}
+	if err := client.do(http.MethodGet, "/api/v1/namespaces", nil, &namespaces); err != nil {
+		return nil, nil, err
+	}
+	pods := rawKubernetesPodList{}
+	if err := client.do(http.MethodGet, "/api/v1/pods", nil, &pods); err != nil {
+		return nil, nil, err
+	}
+	jobs := rawKubernetesJobList{}
+	if err := client.do(http.MethodGet, "/apis/batch/v1/jobs", nil, &jobs); err != nil {
+		return nil, nil, err
+	}
+	replicaSets := rawKubernetesReplicaSetList{}
+	if err := client.do(http.MethodGet, "/apis/apps/v1/replicasets", nil, &replicaSets); err != nil {
+		return nil, nil, err
+	}
+	persistentVolumes := rawKubernetesPersistentVolumeList{}
+	if err := client.do(http.MethodGet, "/api/v1/persistentvolumes", nil, &persistentVolumes); err != nil {
+		return nil, nil, err
+	}
+
+	owners := make(map[string]string)
+	for _, ns := range namespaces.Items {
+		owners[ns.Metadata.Name] = client.cluster
+		if owner, exist := ns.Metadata.Labels[m.ownerLabel]; exist && owner != "" {
+			owners[ns.Metadata.Name] = owner
+		}
+	}
+	ownerOf := func(namespace string) string {
+		if owner, exist := owners[namespace]; exist {
+			return owner
+		}
+		return client.cluster
+	}
+
+	// The last activity in a namespace is when the latest pod, job or
+	// replica set in it was created. Namespaces with running pods or
+	// available replicas are active now, however long ago they were
+	// created, e.g. long-running deployments.
+	now := time.Now()
+	lastActivity := make(map[string]time.Time)
+	active := func(namespace string, at time.Time) {
+		if at.After(lastActivity[namespace]) {
+			lastActivity[namespace] = at
+		}
+	}
+	for _, pod := range pods.Items {
+		active(pod.Metadata.Namespace, pod.Metadata.CreationTimestamp)
+		if pod.Status.Phase == "Running" || pod.Status.Phase == "Pending" {
+			active(pod.Metadata.Namespace, now)
+		}
+	}
+	for _, job := range jobs.Items {
+		active(job.Metadata.Namespace, job.Metadata.CreationTimestamp)
+	}
+	for _, rs := range replicaSets.Items {
+		active(rs.Metadata.Namespace, rs.Metadata.CreationTimestamp)
+		if rs.Status.AvailableReplicas > 0 {
+			active(rs.Metadata.Namespace, now)
+		}
+	}
+
+	instances := []Instance{}
+	idleSince := now.AddDate(0, 0, -m.idleDays)
+	for _, ns := range namespaces.Items {
+		meta := ns.Metadata
+		if kubernetesSystemNamespaces[meta.Name] {
+			continue
+		}
+		// For namespaces the creation time is the last activity, so that
+		// age based rules are applied to the time it has been idle
+		lastActive := meta.CreationTimestamp
+		if lastActivity[meta.Name].After(lastActive) {
+			lastActive = lastActivity[meta.Name]
+		}
+		if lastActive.After(idleSince) {
+			continue
+		}
+		meta.CreationTimestamp = lastActive
+		instances = append(instances, newKubernetesInstance(client, ownerOf(meta.Name), meta.Name, kubernetesTypeNamespace, "/api/v1/namespaces/"+meta.Name, meta))
+	}
+	for _, job := range jobs.Items {
+		meta := job.Metadata
+		if job.Status.CompletionTime == nil && !job.failed() {
+			continue
+		}
+		// Completed jobs are aged from when they completed
+		if job.Status.CompletionTime != nil {
+			meta.CreationTimestamp = *job.Status.CompletionTime
+		}
+		path := fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs/%s", meta.Namespace, meta.Name)
+		instances = append(instances, newKubernetesInstance(client, ownerOf(meta.Namespace), meta.Namespace+"/"+meta.Name, kubernetesTypeJob, path, meta))
+	}
+	for _, rs := range replicaSets.Items {
+		meta := rs.Metadata
+		// Old replica sets are the scaled down ones kept by a
+		// deployment to be able to roll back
+		if !meta.ownedBy("Deployment") || rs.Spec.Replicas == nil || *rs.Spec.Replicas != 0 || rs.Status.Replicas != 0 {
+			continue
+		}
+		path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets/%s", meta.Namespace, meta.Name)
+		instances = append(instances, newKubernetesInstance(client, ownerOf(meta.Namespace), meta.Namespace+"/"+meta.Name, kubernetesTypeReplicaSet, path, meta))
+	}
+
+	volumes := []Volume{}
+	for _, pv := range persistentVolumes.Items {
+		meta := pv.Metadata
+		owner := client.cluster
+		if pv.Spec.ClaimRef != nil {
+			owner = ownerOf(pv.Spec.ClaimRef.Namespace)
+		}
+		vol := &kubernetesVolume{
+			baseVolume: baseVolume{
+				baseResource: baseResource{
+					csp:          Kubernetes,
+					owner:        owner,
+					id:           meta.Name,
+					location:     client.cluster,
+					creationTime: meta.CreationTimestamp,
+					public:       false,
+					tags:         meta.tags(),
+				},
+				sizeGB: kubernetesQuantityGB(pv.Spec.Capacity["storage"]),
+				// Only bound volumes are in use, released or available
+				// volumes are orphaned
+				attached:   pv.Status.Phase == "Bound",
+				volumeType: pv.Spec.StorageClassName,
+			},
+			client: client,
+			path:   "/api/v1/persistentvolumes/" + meta.Name,
+		}
+		volumes = append(volumes, vol)
+	}
+	recordResources(Kubernetes, ResourceTypeInstances, len(instances))
+	recordResources(Kubernetes, ResourceTypeVolumes, len(volumes))
+	return instances, volumes, nil
+}
+
+func newKubernetesInstance(client *kubernetesClient, owner, id, instanceType, path string, meta rawKubernetesMeta) *kubernetesInstance {
+	return &kubernetesInstance{
+		baseInstance: baseInstance{
+			baseResource: baseResource{
+				csp:          Kubernetes,
+				owner:        owner,
+				id:           id,
+				location:     client.cluster,
+				creationTime: meta.CreationTimestamp,
+				public:       false,
+				tags:         meta.tags(),
+			},
+			instanceType: instanceType,
+		},
+		client: client,
+		path:   path,
+	}
+}
+
+// kubernetesQuantityGB converts a Kubernetes quantity, such as
+// "10Gi" or "500M", to whole GB, rounded up
+func kubernetesQuantityGB(quantity string) int64 {
+	multipliers := []struct {
+		suffix string
+		bytes  float64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50},
+		{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15},
+	}
+	multiplier := 1.0
+	for _, m := range multipliers {
+		if strings.HasSuffix(quantity, m.suffix) {
+			quantity = strings.TrimSuffix(quantity, m.suffix)
+			multiplier = m.bytes
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(quantity, 64)
+	if err != nil {
+		return 0
+	}
+	gb := value * multiplier / 1e9
+	if gb > float64(int64(gb)) {
+		return int64(gb) + 1
+	}
+	return int64(gb)
+}
+
+func addKubernetesTag(client *kubernetesClient, path string, r Resource, key, value string, overwrite bool) error {
+	_, exist := r.Tags()[key]
+	if exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, r.ID())
+	}
+	if err := client.patchAnnotation(path, key, value); err != nil {
+		return err
+	}
+	r.Tags()[key] = value
+	return nil
+}
+
+func removeKubernetesTag(client *kubernetesClient, path string, r Resource, key string) error {
+	if _, exist := r.Tags()[key]; !exist {
+		return nil
+	}
+	if err := client.patchAnnotation(path, key, nil); err != nil {
+		return err
+	}
+	delete(r.Tags(), key)
+	return nil
+}
+
+type kubernetesClient struct {
+	cluster string
+	server  string
+	token   string
+	http    *http.Client
+	// timeouts cancels the requests made while listing the cluster
+	// once it has timed out
+	timeouts *scopeTimeouts
+}
+
+func newKubernetesClient(cluster string, conf KubernetesCluster) (*kubernetesClient, error) {
+	token, err := ioutil.ReadFile(conf.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read token for cluster %s: %s", cluster, err)
+	}
+	tlsConfig := &tls.Config{}
+	if conf.CAFile != "" {
+		ca, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA for cluster %s: %s", cluster, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No certificates found in %s", conf.CAFile)
+		}
+	}
+	return &kubernetesClient{
+		cluster: cluster,
+		server:  strings.TrimSuffix(conf.Server, "/"),
+		token:   strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// do will send a request to the API server, and decode the JSON
+// response into result, unless it's nil. A non-nil body is sent
+// as a JSON merge patch, the only kind of body used.
+func (c *kubernetesClient) do(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c.timeouts.context(c, ""))
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s in cluster %s failed with %s: %s", method, path, c.cluster, resp.Status, msg)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// patchAnnotation sets an annotation on an object, or removes it if
+// the value is nil
+func (c *kubernetesClient) patchAnnotation(path, key string, value interface{}) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{key: value},
+		},
+	}
+	return c.do(http.MethodPatch, path, patch, nil)
+}
+
+// delete removes an object, and lets Kubernetes garbage collect
+// any objects owned by it, e.g. the pods of a job
+func (c *kubernetesClient) delete(path string) error {
+	return c.do(http.MethodDelete, path+"?propagationPolicy=Background", nil, nil)
+}
+
+// Helper structs for parsing the JSON from the Kubernetes API
+
+type rawKubernetesMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations"`
+	OwnerReferences   []struct {
+		Kind string `json:"kind"`
+	} `json:"ownerReferences"`
+}
+
+// tags merges labels and annotations, where annotations take
+// precedence since that's where Cloudsweeper sets tags
+func (m *rawKubernetesMeta) tags() map[string]string {
+	tags := make(map[string]string, len(m.Labels)+len(m.Annotations))
+	for key, value := range m.Labels {
+		tags[key] = value
+	}
+	for key, value := range m.Annotations {
+		tags[key] = value
+	}
+	return tags
+}
+
+func (m *rawKubernetesMeta) ownedBy(kind string) bool {
+	for _, ref := range m.OwnerReferences {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type rawKubernetesList struct {
+	Items []struct {
+		Metadata rawKubernetesMeta `json:"metadata"`
+	} `json:"items"`
+}
+
+type rawKubernetesPodList struct {
+	Items []struct {
+		Metadata rawKubernetesMeta `json:"metadata"`
+		Status   struct {
+			Phase string `json:"phase"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type rawKubernetesJob struct {
+	Metadata rawKubernetesMeta `json:"metadata"`
+	Status   struct {
+		CompletionTime *time.Time `json:"completionTime"`
+		Conditions     []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (j *rawKubernetesJob) failed() bool {
+	for _, condition := range j.Status.Conditions {
+		if condition.Type == "Failed" && condition.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+type rawKubernetesJobList struct {
+	Items []rawKubernetesJob `json:"items"`
+}
+
+type rawKubernetesReplicaSetList struct {
+	Items []struct {
+		Metadata rawKubernetesMeta `json:"metadata"`
+		Spec     struct {
+			Replicas *int `json:"replicas"`
+		} `json:"spec"`
+		Status struct {
+			Replicas          int `json:"replicas"`
+			AvailableReplicas int `json:"availableReplicas"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type rawKubernetesPersistentVolumeList struct {
+	Items []struct {
+		Metadata rawKubernetesMeta `json:"metadata"`
+		Spec     struct {
+			Capacity         map[string]string `json:"capacity"`
+			StorageClassName string            `json:"storageClassName"`
+			ClaimRef         *struct {
+				Namespace string `json:"namespace"`
+			} `json:"claimRef"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+		} `json:"status"`
+	} `json:"items"`
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// awsAPICallHandlerName is the name of the request handler which counts
+// the AWS API calls
+const awsAPICallHandlerName = "cloudsweeper.CountAPICalls"
+
+// APICallCount is how many calls were made to an operation of a service
+// of a CSP. Retries are counted as calls of their own, since they count
+// towards the rate limits the same way. The operation of a GCP call is
+// its HTTP method.
+type APICallCount struct {
+	CSP       CSP    `json:"csp"`
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	Calls     int    `json:"calls"`
+}
+
+// ResourceCount is how many resources of a type were listed in a CSP. A
+// resource listed more than once during a run is counted every time.
+type ResourceCount struct {
+	CSP   CSP    `json:"csp"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+type apiCallKey struct {
+	csp       CSP
+	service   string
+	operation string
+}
+
+type resourceCountKey struct {
+	csp          CSP
+	resourceType string
+}
+
+var (
+	metricsMutex   sync.Mutex
+	apiCalls       = make(map[apiCallKey]int)
+	resourceCounts = make(map[resourceCountKey]int)
+)
+
+// NewAWSSession returns a new AWS session, whose API calls are counted.
+// It panics if the session can't be created, like session.Must.
+func NewAWSSession() *session.Session {
+	sess := session.Must(session.NewSession())
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: awsAPICallHandlerName,
+		Fn: func(r *request.Request) {
+			operation := ""
+			if r.Operation != nil {
+				operation = r.Operation.Name
+			}
+			recordAPICall(AWS, r.ClientInfo.ServiceName, operation)
+		},
+	})
+	return sess
+}
+
+// gcpAPICallCounter counts the GCP API calls sent through it
+type gcpAPICallCounter struct {
+	base http.RoundTripper
+}
+
+func (c *gcpAPICallCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordAPICall(GCP, gcpServiceName(req), req.Method)
+	return c.base.RoundTrip(req)
+}
+
+// gcpServiceName returns the name of the GCP service a request is sent
+// to, e.g. compute for compute.googleapis.com, or for
+// www.googleapis.com/compute/v1/...
+func gcpServiceName(req *http.Request) string {
+	host := strings.TrimSuffix(req.URL.Hostname(), ".googleapis.com")
+	if host != "www" {
+		return host
+	}
+	return strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)[0]
+}
+
+func recordAPICall(csp CSP, service, operation string) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	apiCalls[apiCallKey{csp, service, operation}]++
+}
+
+// recordResources records that a number of resources of a type were
+// listed in a CSP
+func recordResources(csp CSP, resourceType string, count int) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	resourceCounts[resourceCountKey{csp, resourceType}] += count
+}
+
+// APICalls returns the number of calls made to every operation since the
+// start of the run, with the operation called the most first
+func APICalls() []APICallCount {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	result := []APICallCount{}
+	for key, calls := range apiCalls {
+		result = append(result, APICallCount{key.csp, key.service, key.operation, calls})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Calls != result[j].Calls {
+			return result[i].Calls > result[j].Calls
+		}
+		if result[i].CSP != result[j].CSP {
+			return result[i].CSP < result[j].CSP
+		}
+		if result[i].Service != result[j].Service {
+			return result[i].Service < result[j].Service
+		}
+		return result[i].Operation < result[j].Operation
+	})
+	return result
+}
+
+// ResourceCounts returns the number of resources of every type listed
+// since the start of the run, sorted by CSP and type
+func ResourceCounts() []ResourceCount {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	result := []ResourceCount{}
+	for key, count := range resourceCounts {
+		result = append(result, ResourceCount{key.csp, key.resourceType, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CSP != result[j].CSP {
+			return result[i].CSP < result[j].CSP
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// ResetMetrics forgets the API calls and resources counted so far, e.g.
+// before the next run when running as a service
+func ResetMetrics() {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	apiCalls = make(map[apiCallKey]int)
+	resourceCounts = make(map[resourceCountKey]int)
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	awsEventGetDashboard = "GetDashboard"
+
+	// awsMaxFilterValues is the maximum number of values of a filter
+	// in one EC2 request
+	awsMaxFilterValues = 200
+)
+
+// awsAlarmDimensionLookups maps the names of the alarm dimensions which
+// reference resources to how the resources which still exist are found.
+// Alarms on other dimensions are never considered dead.
+var awsAlarmDimensionLookups = map[string]func(client *awsEC2Client, ids []string) (map[string]bool, error){
+	"InstanceId": existingAWSInstances,
+	"VolumeId":   existingAWSVolumes,
+}
+
+type baseAlarm struct {
+	baseResource
+	state            string
+	stateUpdated     time.Time
+	missingResources []string
+}
+
+func (a *baseAlarm) State() string {
+	return a.state
+}
+
+func (a *baseAlarm) StateUpdated() time.Time {
+	return a.stateUpdated
+}
+
+func (a *baseAlarm) MissingResources() []string {
+	return a.missingResources
+}
+
+type baseDashboard struct {
+	baseResource
+	lastModified time.Time
+	viewsKnown   bool
+	lastViewed   time.Time
+}
+
+func (d *baseDashboard) LastModified() time.Time {
+	return d.lastModified
+}
+
+func (d *baseDashboard) ViewsKnown() bool {
+	return d.viewsKnown
+}
+
+func (d *baseDashboard) LastViewed() time.Time {
+	return d.lastViewed
+}
+
+// AWS
+
+type awsAlarm struct {
+	baseAlarm
+	// dimensions are the resource dimensions of the alarm, keyed by name
+	dimensions map[string]string
+}
+
+func (a *awsAlarm) Cleanup() error {
+	return awsTryWithBackoff(func() error {
+		_, err := awsCloudWatchClient(a.Owner(), a.Location()).DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+			AlarmNames: aws.StringSlice([]string{a.ID()}),
+		})
+		return err
+	})
+}
+
+type awsDashboard struct {
+	baseDashboard
+}
+
+func (d *awsDashboard) Cleanup() error {
+	return awsTryWithBackoff(func() error {
+		_, err := awsCloudWatchClient(d.Owner(), d.Location()).DeleteDashboards(&cloudwatch.DeleteDashboardsInput{
+			DashboardNames: aws.StringSlice([]string{d.ID()}),
+		})
+		return err
+	})
+}
+
+func awsCloudWatchClient(account, region string) *cloudwatch.CloudWatch {
+	sess := NewAWSSession()
+	return cloudwatch.New(sess, &aws.Config{
+		Credentials: awsAccountCredentials(sess, account),
+		Region:      aws.String(region),
+	})
+}
+
+// awsDashboardRegion is the home region of CloudWatch dashboards. They are
+// global, so every region lists the same dashboards.
+const awsDashboardRegion = "us-east-1"
+
+func (m *awsResourceManager) ForEachAccountMonitoring(viewDays int, f func(string, []Alarm, []Dashboard)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		alarms := []Alarm{}
+		// A dashboard can be viewed through any region, which is where
+		// the GetDashboard event is recorded, so the views of all regions
+		// are combined
+		lastViewed := make(map[string]time.Time)
+		viewsKnown := true
+		var resultMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			config := &aws.Config{Credentials: cred, Region: aws.String(client.region)}
+			region := client.region
+			cw := cloudwatch.New(sess, config)
+			regionAlarms, err := getAWSAlarms(account, region, cw)
+			if err != nil {
+				status.Warnf("Could not list alarms in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			setAWSMissingResources(client, regionAlarms)
+			var regionViews map[string]time.Time
+			var viewsErr error
+			if viewDays > 0 {
+				regionViews, viewsErr = getAWSDashboardViews(cloudtrail.New(sess, config), viewDays)
+				if viewsErr != nil {
+					status.Warnf("Could not look up %s events in %s of %s: %s", awsEventGetDashboard, region, AccountDisplayName(account), viewsErr)
+				}
+			}
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			for _, alarm := range regionAlarms {
+				alarms = append(alarms, alarm)
+			}
+			if viewsErr != nil {
+				viewsKnown = false
+			}
+			for name, viewed := range regionViews {
+				updateLastUsed(lastViewed, name, viewed)
+			}
+		})
+
+		dashboards := []Dashboard{}
+		cw := cloudwatch.New(sess, &aws.Config{Credentials: cred, Region: aws.String(awsDashboardRegion)})
+		found, err := getAWSDashboards(account, awsDashboardRegion, cw)
+		if err != nil {
+			status.Warnf("Could not list dashboards of %s: %s", AccountDisplayName(account), err)
+		}
+		for _, dashboard := range found {
+			if viewDays > 0 && viewsKnown {
+				dashboard.viewsKnown = true
+				dashboard.lastViewed = lastViewed[dashboard.ID()]
+			}
+			dashboards = append(dashboards, dashboard)
+		}
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, alarms, dashboards)
+	})
+}
+
+func getAWSAlarms(account, region string, cw *cloudwatch.CloudWatch) ([]*awsAlarm, error) {
+	alarms := []*awsAlarm{}
+	err := cw.DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{},
+		func(output *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+			for _, metricAlarm := range output.MetricAlarms {
+				alarm := &awsAlarm{
+					baseAlarm: baseAlarm{
+						baseResource: baseResource{
+							csp:      AWS,
+							owner:    account,
+							id:       aws.StringValue(metricAlarm.AlarmName),
+							location: region,
+						},
+						state:        aws.StringValue(metricAlarm.StateValue),
+						stateUpdated: aws.TimeValue(metricAlarm.StateUpdatedTimestamp),
+					},
+					dimensions: make(map[string]string),
+				}
+				for _, dimension := range metricAlarm.Dimensions {
+					name := aws.StringValue(dimension.Name)
+					if _, ok := awsAlarmDimensionLookups[name]; ok {
+						alarm.dimensions[name] = aws.StringValue(dimension.Value)
+					}
+				}
+				alarms = append(alarms, alarm)
+			}
+			return true
+		})
+	return alarms, err
+}
+
+// setAWSMissingResources looks up if the resources referenced by the
+// alarms without data still exist. If that can't be looked up, the
+// resources are assumed to exist.
+func setAWSMissingResources(client *awsEC2Client, alarms []*awsAlarm) {
+	referenced := make(map[string][]string)
+	for _, alarm := range alarms {
+		if alarm.State() != cloudwatch.StateValueInsufficientData {
+			continue
+		}
+		for name, id := range alarm.dimensions {
+			referenced[name] = append(referenced[name], id)
+		}
+	}
+	for name, ids := range referenced {
+		existing, err := awsAlarmDimensionLookups[name](client, ids)
+		if err != nil {
+			status.Warnf("Could not look up the resources of alarms in %s: %s", client.region, err)
+			continue
+		}
+		for _, alarm := range alarms {
+			if id, ok := alarm.dimensions[name]; ok && alarm.State() == cloudwatch.StateValueInsufficientData && !existing[id] {
+				alarm.missingResources = append(alarm.missingResources, id)
+			}
+		}
+	}
+}
+
+// existingAWSInstances returns which of the instances exist and aren't
+// terminated. Filters are used instead of instance IDs, since requests
+// with IDs of instances which don't exist fail.
+func existingAWSInstances(client *awsEC2Client, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, batch := range batchStrings(ids, awsMaxFilterValues) {
+		err := client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{{
+				Name:   aws.String("instance-id"),
+				Values: aws.StringSlice(batch),
+			}},
+		}, func(output *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range output.Reservations {
+				for _, instance := range reservation.Instances {
+					if aws.StringValue(instance.State.Name) != ec2.InstanceStateNameTerminated {
+						existing[aws.StringValue(instance.InstanceId)] = true
+					}
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// existingAWSVolumes returns which of the volumes exist
+func existingAWSVolumes(client *awsEC2Client, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, batch := range batchStrings(ids, awsMaxFilterValues) {
+		err := client.DescribeVolumesPages(&ec2.DescribeVolumesInput{
+			Filters: []*ec2.Filter{{
+				Name:   aws.String("volume-id"),
+				Values: aws.StringSlice(batch),
+			}},
+		}, func(output *ec2.DescribeVolumesOutput, lastPage bool) bool {
+			for _, volume := range output.Volumes {
+				existing[aws.StringValue(volume.VolumeId)] = true
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+func getAWSDashboards(account, region string, cw *cloudwatch.CloudWatch) ([]*awsDashboard, error) {
+	dashboards := []*awsDashboard{}
+	err := cw.ListDashboardsPages(&cloudwatch.ListDashboardsInput{},
+		func(output *cloudwatch.ListDashboardsOutput, lastPage bool) bool {
+			for _, entry := range output.DashboardEntries {
+				dashboards = append(dashboards, &awsDashboard{baseDashboard{
+					baseResource: baseResource{
+						csp:      AWS,
+						owner:    account,
+						id:       aws.StringValue(entry.DashboardName),
+						location: region,
+					},
+					lastModified: aws.TimeValue(entry.LastModified),
+				}})
+			}
+			return true
+		})
+	return dashboards, err
+}
+
+type awsGetDashboardEvent struct {
+	RequestParameters struct {
+		DashboardName string `json:"dashboardName"`
+	} `json:"requestParameters"`
+}
+
+// getAWSDashboardViews returns when every dashboard was last viewed
+// through a region, from the GetDashboard events in its CloudTrail event
+// history. Viewing a dashboard in the console gets it, so this is when it
+// was last viewed.
+func getAWSDashboardViews(trail *cloudtrail.CloudTrail, viewDays int) (map[string]time.Time, error) {
+	if viewDays > awsCloudTrailMaxDays {
+		viewDays = awsCloudTrailMaxDays
+	}
+	lastViewed := make(map[string]time.Time)
+	err := lookupAWSEvents(trail, awsEventGetDashboard, time.Now().AddDate(0, 0, -viewDays), func(eventTime time.Time, raw []byte) {
+		var event awsGetDashboardEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return
+		}
+		updateLastUsed(lastViewed, event.RequestParameters.DashboardName, eventTime)
+	})
+	return lastViewed, err
+}
+
+// batchStrings splits the strings into batches of at most size strings
+func batchStrings(s []string, size int) [][]string {
+	batches := [][]string{}
+	for start := 0; start < len(s); start += size {
+		end := start + size
+		if end > len(s) {
+			end = len(s)
+		}
+		batches = append(batches, s[start:end])
+	}
+	return batches
+}
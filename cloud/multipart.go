@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// MultipartUpload is a multipart upload to a bucket which was started but
+// never completed or aborted. The parts uploaded so far are stored, and
+// billed, until the upload is aborted.
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+	// SizeBytes is the total size of the uploaded parts
+	SizeBytes int64
+}
+
+// MultipartUploader is implemented by buckets which can have incomplete
+// multipart uploads. Not every CSP has those, so use a type assertion on
+// the Bucket to check for support.
+type MultipartUploader interface {
+	// MultipartUploads returns the incomplete multipart uploads
+	MultipartUploads() ([]MultipartUpload, error)
+	// AbortMultipartUpload aborts an upload, which removes its parts
+	AbortMultipartUpload(upload MultipartUpload) error
+}
+
+func (b *awsBucket) MultipartUploads() ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	err := b.withS3Client(func(s3Client s3iface.S3API) error {
+		var err error
+		uploads, err = listAWSMultipartUploads(s3Client, b.ID())
+		return err
+	})
+	return uploads, err
+}
+
+// listAWSMultipartUploads returns the incomplete multipart uploads to the
+// bucket, with the total size of their parts
+func listAWSMultipartUploads(s3Client s3iface.S3API, bucket string) ([]MultipartUpload, error) {
+	uploads := []MultipartUpload{}
+	err := s3Client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+	}, func(output *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range output.Uploads {
+			uploads = append(uploads, MultipartUpload{
+				Key:       aws.StringValue(upload.Key),
+				UploadID:  aws.StringValue(upload.UploadId),
+				Initiated: aws.TimeValue(upload.Initiated),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range uploads {
+		upload := &uploads[i]
+		err := s3Client.ListPartsPages(&s3.ListPartsInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(upload.Key),
+			UploadId: aws.String(upload.UploadID),
+		}, func(output *s3.ListPartsOutput, lastPage bool) bool {
+			for _, part := range output.Parts {
+				upload.SizeBytes += aws.Int64Value(part.Size)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uploads, nil
+}
+
+func (b *awsBucket) AbortMultipartUpload(upload MultipartUpload) error {
+	return b.withS3Client(func(s3Client s3iface.S3API) error {
+		_, err := s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(b.ID()),
+			Key:      aws.String(upload.Key),
+			UploadId: aws.String(upload.UploadID),
+		})
+		return err
+	})
+}
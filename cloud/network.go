@@ -0,0 +1,488 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	awsEventCreateVpc = "CreateVpc"
+
+	awsNetworkObjectInternetGateway = "internet gateway"
+	awsNetworkObjectSubnet          = "subnet"
+	awsNetworkObjectRouteTable      = "route table"
+	awsNetworkObjectNetworkACL      = "network ACL"
+	awsNetworkObjectSecurityGroup   = "security group"
+
+	awsNetworkDependencyVPNGateway        = "VPN gateway"
+	awsNetworkDependencyPeeringConnection = "peering connection"
+	awsNetworkDependencyEndpoint          = "VPC endpoint"
+	awsNetworkDependencyEgressOnlyGateway = "egress-only internet gateway"
+
+	awsDefaultSecurityGroupName = "default"
+)
+
+// awsLiveInstanceStates are the states of instances which aren't
+// terminated
+var awsLiveInstanceStates = []string{
+	ec2.InstanceStateNamePending,
+	ec2.InstanceStateNameRunning,
+	ec2.InstanceStateNameShuttingDown,
+	ec2.InstanceStateNameStopping,
+	ec2.InstanceStateNameStopped,
+}
+
+// awsLivePeeringStates are the states of peering connections which
+// connect, or are about to connect, two VPCs
+var awsLivePeeringStates = []string{
+	ec2.VpcPeeringConnectionStateReasonCodeInitiatingRequest,
+	ec2.VpcPeeringConnectionStateReasonCodePendingAcceptance,
+	ec2.VpcPeeringConnectionStateReasonCodeProvisioning,
+	ec2.VpcPeeringConnectionStateReasonCodeActive,
+}
+
+// awsNetworkObjectDeleters delete every kind of object in a VPC. The
+// objects of a VPC are listed in the order they have to be deleted in:
+// internet gateways have to be detached before the subnets they route
+// for, the subnets have to be gone before their route tables and network
+// ACLs, and security groups come last since anything could use them.
+var awsNetworkObjectDeleters = map[string]func(client *awsEC2Client, vpcID, id string) error{
+	awsNetworkObjectInternetGateway: func(client *awsEC2Client, vpcID, id string) error {
+		_, err := client.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: aws.String(id),
+			VpcId:             aws.String(vpcID),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = client.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{
+			InternetGatewayId: aws.String(id),
+		})
+		return err
+	},
+	awsNetworkObjectSubnet: func(client *awsEC2Client, vpcID, id string) error {
+		_, err := client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(id)})
+		return err
+	},
+	awsNetworkObjectRouteTable: func(client *awsEC2Client, vpcID, id string) error {
+		_, err := client.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: aws.String(id)})
+		return err
+	},
+	awsNetworkObjectNetworkACL: func(client *awsEC2Client, vpcID, id string) error {
+		_, err := client.DeleteNetworkAcl(&ec2.DeleteNetworkAclInput{NetworkAclId: aws.String(id)})
+		return err
+	},
+	awsNetworkObjectSecurityGroup: func(client *awsEC2Client, vpcID, id string) error {
+		_, err := client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(id)})
+		return err
+	},
+}
+
+type baseNetwork struct {
+	baseResource
+	name         string
+	cidr         string
+	interfaces   int
+	instances    int
+	objects      []*NetworkObject
+	dependencies []*NetworkObject
+}
+
+func (n *baseNetwork) Name() string {
+	return n.name
+}
+
+func (n *baseNetwork) CIDR() string {
+	return n.cidr
+}
+
+func (n *baseNetwork) Interfaces() int {
+	return n.interfaces
+}
+
+func (n *baseNetwork) Instances() int {
+	return n.instances
+}
+
+func (n *baseNetwork) Objects() []*NetworkObject {
+	return n.objects
+}
+
+func (n *baseNetwork) Dependencies() []*NetworkObject {
+	return n.dependencies
+}
+
+// AWS
+
+type awsNetwork struct {
+	baseNetwork
+	// groupReferences are the rules of the security groups in the VPC
+	// which reference other groups, keyed by the ID of their group. A
+	// group can't be deleted while it's referenced.
+	groupReferences map[string]*awsGroupReferences
+}
+
+type awsGroupReferences struct {
+	ingress []*ec2.IpPermission
+	egress  []*ec2.IpPermission
+}
+
+type awsCreateVpcEvent struct {
+	ResponseElements struct {
+		Vpc struct {
+			VpcID string `json:"vpcId"`
+		} `json:"vpc"`
+	} `json:"responseElements"`
+}
+
+func (n *awsNetwork) Cleanup() error {
+	// DeleteVpc would fail on any of these after the objects were deleted,
+	// leaving half of the network behind
+	if n.interfaces > 0 || n.instances > 0 {
+		return fmt.Errorf("VPC %s has %d network interfaces and %d instances, not deleting anything", n.ID(), n.interfaces, n.instances)
+	}
+	if len(n.dependencies) > 0 {
+		dependency := n.dependencies[0]
+		return fmt.Errorf("VPC %s has %d dependencies, such as %s %s, not deleting anything", n.ID(), len(n.dependencies), dependency.Kind, dependency.ID)
+	}
+	log.Printf("Cleaning up VPC %s in %s", n.ID(), n.Owner())
+	client := clientForAWSResource(n)
+	for groupID, references := range n.groupReferences {
+		if len(references.ingress) > 0 {
+			_, err := client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: references.ingress,
+			})
+			if err != nil {
+				return fmt.Errorf("Could not revoke the rules of security group %s: %s", groupID, err)
+			}
+		}
+		if len(references.egress) > 0 {
+			_, err := client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: references.egress,
+			})
+			if err != nil {
+				return fmt.Errorf("Could not revoke the rules of security group %s: %s", groupID, err)
+			}
+		}
+	}
+	for _, object := range n.objects {
+		if object.Deleted {
+			continue
+		}
+		log.Printf("Deleting %s %s of VPC %s in %s", object.Kind, object.ID, n.ID(), n.Owner())
+		err := awsTryWithBackoff(func() error {
+			return awsNetworkObjectDeleters[object.Kind](client, n.ID(), object.ID)
+		})
+		if err != nil {
+			return fmt.Errorf("Could not delete %s %s: %s", object.Kind, object.ID, err)
+		}
+		object.Deleted = true
+	}
+	return awsTryWithBackoff(func() error {
+		_, err := client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(n.ID())})
+		return err
+	})
+}
+
+func (n *awsNetwork) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(n, key, value, overwrite)
+}
+
+func (n *awsNetwork) RemoveTag(key string) error {
+	return removeAWSTag(n, key)
+}
+
+func (m *awsResourceManager) ForEachAccountNetworks(createdDays int, f func(string, []Network)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		networks := []Network{}
+		var networksMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			regionNetworks, err := getAWSNetworks(account, client)
+			if err != nil {
+				status.Warnf("Could not list VPCs in %s of %s: %s", region, AccountDisplayName(account), err)
+				return
+			}
+			if createdDays > 0 && len(regionNetworks) > 0 {
+				trail := cloudtrail.New(sess, &aws.Config{Credentials: cred, Region: aws.String(client.region)})
+				if err := setAWSNetworksCreationTime(trail, regionNetworks, createdDays); err != nil {
+					// Without the creation time, VPCs which were just
+					// created would look old, so they are left out
+					status.Warnf("Could not look up when the VPCs in %s of %s were created, skipping them: %s", region, AccountDisplayName(account), err)
+					return
+				}
+			}
+			networksMutex.Lock()
+			defer networksMutex.Unlock()
+			for _, network := range regionNetworks {
+				networks = append(networks, network)
+			}
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, networks)
+	})
+}
+
+// getAWSNetworks returns the VPCs in a region, except the default VPC,
+// with how many network interfaces and instances each has, the objects
+// in it which are deleted with it and the objects connecting it to other
+// networks. The main route table, default network ACL and default
+// security group are deleted with the VPC by AWS, so they aren't objects
+// of their own.
+func getAWSNetworks(account string, client *awsEC2Client) ([]*awsNetwork, error) {
+	region := client.region
+	networks := []*awsNetwork{}
+	byID := make(map[string]*awsNetwork)
+	err := client.DescribeVpcsPages(&ec2.DescribeVpcsInput{}, func(output *ec2.DescribeVpcsOutput, lastPage bool) bool {
+		for _, vpc := range output.Vpcs {
+			if aws.BoolValue(vpc.IsDefault) {
+				continue
+			}
+			tags := convertAWSTags(vpc.Tags)
+			network := &awsNetwork{
+				baseNetwork: baseNetwork{
+					baseResource: baseResource{
+						csp:      AWS,
+						owner:    account,
+						id:       aws.StringValue(vpc.VpcId),
+						location: region,
+						tags:     tags,
+					},
+					name: tags["Name"],
+					cidr: aws.StringValue(vpc.CidrBlock),
+				},
+				groupReferences: make(map[string]*awsGroupReferences),
+			}
+			networks = append(networks, network)
+			byID[network.ID()] = network
+		}
+		return true
+	})
+	if err != nil || len(networks) == 0 {
+		return networks, err
+	}
+	addObject := func(vpcID, kind, id string) {
+		if network, ok := byID[vpcID]; ok {
+			network.objects = append(network.objects, &NetworkObject{Kind: kind, ID: id})
+		}
+	}
+	addDependency := func(vpcID, kind, id string) {
+		if network, ok := byID[vpcID]; ok {
+			network.dependencies = append(network.dependencies, &NetworkObject{Kind: kind, ID: id})
+		}
+	}
+
+	err = client.DescribeNetworkInterfacesPages(&ec2.DescribeNetworkInterfacesInput{}, func(output *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+		for _, iface := range output.NetworkInterfaces {
+			if network, ok := byID[aws.StringValue(iface.VpcId)]; ok {
+				network.interfaces++
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice(awsLiveInstanceStates),
+		}},
+	}, func(output *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				if network, ok := byID[aws.StringValue(instance.VpcId)]; ok {
+					network.instances++
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.DescribeInternetGatewaysPages(&ec2.DescribeInternetGatewaysInput{}, func(output *ec2.DescribeInternetGatewaysOutput, lastPage bool) bool {
+		for _, gateway := range output.InternetGateways {
+			for _, attachment := range gateway.Attachments {
+				addObject(aws.StringValue(attachment.VpcId), awsNetworkObjectInternetGateway, aws.StringValue(gateway.InternetGatewayId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{}, func(output *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+		for _, subnet := range output.Subnets {
+			addObject(aws.StringValue(subnet.VpcId), awsNetworkObjectSubnet, aws.StringValue(subnet.SubnetId))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeRouteTablesPages(&ec2.DescribeRouteTablesInput{}, func(output *ec2.DescribeRouteTablesOutput, lastPage bool) bool {
+		for _, table := range output.RouteTables {
+			isMain := false
+			for _, association := range table.Associations {
+				isMain = isMain || aws.BoolValue(association.Main)
+			}
+			if !isMain {
+				addObject(aws.StringValue(table.VpcId), awsNetworkObjectRouteTable, aws.StringValue(table.RouteTableId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeNetworkAclsPages(&ec2.DescribeNetworkAclsInput{}, func(output *ec2.DescribeNetworkAclsOutput, lastPage bool) bool {
+		for _, acl := range output.NetworkAcls {
+			if !aws.BoolValue(acl.IsDefault) {
+				addObject(aws.StringValue(acl.VpcId), awsNetworkObjectNetworkACL, aws.StringValue(acl.NetworkAclId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{}, func(output *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+		for _, group := range output.SecurityGroups {
+			network, ok := byID[aws.StringValue(group.VpcId)]
+			if !ok {
+				continue
+			}
+			groupID := aws.StringValue(group.GroupId)
+			references := &awsGroupReferences{
+				ingress: awsGroupReferencingPermissions(group.IpPermissions),
+				egress:  awsGroupReferencingPermissions(group.IpPermissionsEgress),
+			}
+			if len(references.ingress) > 0 || len(references.egress) > 0 {
+				network.groupReferences[groupID] = references
+			}
+			if aws.StringValue(group.GroupName) != awsDefaultSecurityGroupName {
+				addObject(network.ID(), awsNetworkObjectSecurityGroup, groupID)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Gateway endpoints, VPN gateways and peering connections have no
+	// network interfaces, so they are looked up on their own
+	gateways, err := client.DescribeVpnGateways(&ec2.DescribeVpnGatewaysInput{})
+	if err != nil {
+		return nil, err
+	}
+	for _, gateway := range gateways.VpnGateways {
+		for _, attachment := range gateway.VpcAttachments {
+			if aws.StringValue(attachment.State) != ec2.AttachmentStatusDetached {
+				addDependency(aws.StringValue(attachment.VpcId), awsNetworkDependencyVPNGateway, aws.StringValue(gateway.VpnGatewayId))
+			}
+		}
+	}
+	err = client.DescribeVpcPeeringConnectionsPages(&ec2.DescribeVpcPeeringConnectionsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("status-code"),
+			Values: aws.StringSlice(awsLivePeeringStates),
+		}},
+	}, func(output *ec2.DescribeVpcPeeringConnectionsOutput, lastPage bool) bool {
+		for _, peering := range output.VpcPeeringConnections {
+			id := aws.StringValue(peering.VpcPeeringConnectionId)
+			for _, vpc := range []*ec2.VpcPeeringConnectionVpcInfo{peering.RequesterVpcInfo, peering.AccepterVpcInfo} {
+				if vpc != nil {
+					addDependency(aws.StringValue(vpc.VpcId), awsNetworkDependencyPeeringConnection, id)
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeVpcEndpointsPages(&ec2.DescribeVpcEndpointsInput{}, func(output *ec2.DescribeVpcEndpointsOutput, lastPage bool) bool {
+		for _, endpoint := range output.VpcEndpoints {
+			if state := strings.ToLower(aws.StringValue(endpoint.State)); state != "deleted" && state != "deleting" {
+				addDependency(aws.StringValue(endpoint.VpcId), awsNetworkDependencyEndpoint, aws.StringValue(endpoint.VpcEndpointId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = client.DescribeEgressOnlyInternetGatewaysPages(&ec2.DescribeEgressOnlyInternetGatewaysInput{}, func(output *ec2.DescribeEgressOnlyInternetGatewaysOutput, lastPage bool) bool {
+		for _, gateway := range output.EgressOnlyInternetGateways {
+			for _, attachment := range gateway.Attachments {
+				addDependency(aws.StringValue(attachment.VpcId), awsNetworkDependencyEgressOnlyGateway, aws.StringValue(gateway.EgressOnlyInternetGatewayId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+// awsGroupReferencingPermissions returns the permissions which reference
+// other security groups
+func awsGroupReferencingPermissions(permissions []*ec2.IpPermission) []*ec2.IpPermission {
+	referencing := []*ec2.IpPermission{}
+	for _, permission := range permissions {
+		if len(permission.UserIdGroupPairs) > 0 {
+			referencing = append(referencing, &ec2.IpPermission{
+				IpProtocol:       permission.IpProtocol,
+				FromPort:         permission.FromPort,
+				ToPort:           permission.ToPort,
+				UserIdGroupPairs: permission.UserIdGroupPairs,
+			})
+		}
+	}
+	return referencing
+}
+
+// setAWSNetworksCreationTime sets when the VPCs created in the last days
+// were created, from the CreateVpc events in the CloudTrail event history
+func setAWSNetworksCreationTime(trail *cloudtrail.CloudTrail, networks []*awsNetwork, days int) error {
+	if days > awsCloudTrailMaxDays {
+		days = awsCloudTrailMaxDays
+	}
+	created := make(map[string]time.Time)
+	err := lookupAWSEvents(trail, awsEventCreateVpc, time.Now().AddDate(0, 0, -days), func(eventTime time.Time, raw []byte) {
+		var event awsCreateVpcEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return
+		}
+		updateLastUsed(created, event.ResponseElements.Vpc.VpcID, eventTime)
+	})
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		network.creationTime = created[network.ID()]
+	}
+	return nil
+}
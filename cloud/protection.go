@@ -0,0 +1,177 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DeleteProtection is implemented by resources which can be protected
+// from deletion by a policy of their own, such as buckets with S3 Object
+// Lock or locked snapshots. Use a type assertion on the Resource to check
+// for support.
+type DeleteProtection interface {
+	// DeleteProtection returns what keeps the resource from being
+	// deleted, or an empty string if nothing does. An error is returned
+	// if that couldn't be checked.
+	DeleteProtection() (string, error)
+}
+
+// awsBucketDeleteActions are the actions a bucket policy can deny which
+// keep Cloudsweeper from deleting the bucket, apart from wildcards
+var awsBucketDeleteActions = []string{"s3:DeleteBucket", "s3:DeleteObject", "s3:DeleteObjectVersion"}
+
+// awsTransportConditionKey is the condition of bucket policies requiring
+// HTTPS, which never applies to Cloudsweeper
+const awsTransportConditionKey = "aws:SecureTransport"
+
+// DeleteProtection checks if S3 Object Lock is enabled for the bucket,
+// which keeps locked objects from being deleted until they are
+// released, or if its policy explicitly denies deleting it or its
+// objects
+func (b *awsBucket) DeleteProtection() (string, error) {
+	protection := ""
+	err := b.withS3Client(func(s3Client s3iface.S3API) error {
+		lock, err := s3Client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{Bucket: aws.String(b.ID())})
+		if err != nil && !isAWSErrorCode(err, "ObjectLockConfigurationNotFoundError") {
+			return err
+		}
+		if err == nil && lock.ObjectLockConfiguration != nil && aws.StringValue(lock.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled {
+			protection = "S3 Object Lock is enabled"
+			return nil
+		}
+		policy, err := s3Client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(b.ID())})
+		if err != nil {
+			if isAWSErrorCode(err, "NoSuchBucketPolicy") {
+				return nil
+			}
+			return err
+		}
+		if action, denied := awsPolicyDeniesDelete(aws.StringValue(policy.Policy)); denied {
+			protection = fmt.Sprintf("Bucket policy denies %s", action)
+		}
+		return nil
+	})
+	return protection, err
+}
+
+// awsPolicyStatement is a statement of an IAM policy document, where the
+// actions can be a string or a list
+type awsPolicyStatement struct {
+	Effect    string                     `json:"Effect"`
+	Action    json.RawMessage            `json:"Action"`
+	Condition map[string]json.RawMessage `json:"Condition"`
+}
+
+// awsPolicyDeniesDelete returns the first action of a policy document
+// with an explicit deny which keeps the bucket or its objects from being
+// deleted. Denies which only apply to requests without HTTPS are
+// ignored, and so are policies which can't be parsed.
+func awsPolicyDeniesDelete(document string) (string, bool) {
+	var policy struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return "", false
+	}
+	statements := []awsPolicyStatement{}
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		single := awsPolicyStatement{}
+		if err := json.Unmarshal(policy.Statement, &single); err != nil {
+			return "", false
+		}
+		statements = append(statements, single)
+	}
+	for _, statement := range statements {
+		if statement.Effect != "Deny" || awsOnlyTransportConditions(statement.Condition) {
+			continue
+		}
+		for _, action := range awsPolicyActions(statement.Action) {
+			for _, deleteAction := range awsBucketDeleteActions {
+				if awsActionMatches(action, deleteAction) {
+					return action, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func awsPolicyActions(raw json.RawMessage) []string {
+	actions := []string{}
+	if err := json.Unmarshal(raw, &actions); err == nil {
+		return actions
+	}
+	action := ""
+	if err := json.Unmarshal(raw, &action); err == nil && action != "" {
+		return []string{action}
+	}
+	return actions
+}
+
+// awsActionMatches checks if an action of a policy, which may end with a
+// wildcard, e.g. s3:Delete*, matches an action. Actions are not case
+// sensitive.
+func awsActionMatches(pattern, action string) bool {
+	pattern, action = strings.ToLower(pattern), strings.ToLower(action)
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(action, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == action
+}
+
+func awsOnlyTransportConditions(conditions map[string]json.RawMessage) bool {
+	if len(conditions) == 0 {
+		return false
+	}
+	for _, keys := range conditions {
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal(keys, &values); err != nil {
+			return false
+		}
+		for key := range values {
+			if !strings.EqualFold(key, awsTransportConditionKey) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DeleteProtection checks if the snapshot is locked, in governance or
+// compliance mode, which keeps it from being deleted until the lock
+// expires
+func (s *awsSnapshot) DeleteProtection() (string, error) {
+	client := clientForAWSResource(s)
+	output, err := client.DescribeLockedSnapshots(&ec2.DescribeLockedSnapshotsInput{
+		SnapshotIds: []*string{aws.String(s.ID())},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, locked := range output.Snapshots {
+		state := aws.StringValue(locked.LockState)
+		if aws.StringValue(locked.SnapshotId) != s.ID() || state == "" || state == "expired" {
+			continue
+		}
+		if locked.LockExpiresOn != nil {
+			return fmt.Sprintf("Snapshot is locked in %s mode until %s", state, locked.LockExpiresOn.Format("2006-01-02")), nil
+		}
+		return fmt.Sprintf("Snapshot is locked in %s mode", state), nil
+	}
+	return "", nil
+}
+
+func isAWSErrorCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
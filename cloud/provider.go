@@ -0,0 +1,87 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManagerFactory builds a resource manager for a CSP, managing the
+// specified accounts. The config is never nil.
+type ManagerFactory func(conf *ManagerConfig, accounts ...string) (ResourceManager, error)
+
+var (
+	providersMutex sync.RWMutex
+	providers      = map[CSP]ManagerFactory{
+		AWS:        newAWSManager,
+		GCP:        newGCPManager,
+		Kubernetes: newKubernetesManager,
+		VSphere:    newVSphereManager,
+	}
+)
+
+// RegisterProvider makes a resource manager factory available for the
+// specified CSP, so that NewManager can be used with it. This allows
+// support for other providers, e.g. DigitalOcean, to live outside of
+// this package. It's meant to be called from the init function of the
+// package implementing the provider, and panics if the CSP has already
+// been registered.
+func RegisterProvider(c CSP, factory ManagerFactory) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	if factory == nil {
+		log.Panicln("Resource manager factory is nil for", c)
+	}
+	if _, exist := providers[c]; exist {
+		log.Panicln("Provider registered twice:", c)
+	}
+	providers[c] = factory
+}
+
+// Providers returns all CSPs which has a registered provider
+func Providers() []CSP {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	result := make([]CSP, 0, len(providers))
+	for c := range providers {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// LookupProvider finds the registered CSP with the specified name,
+// ignoring case.
+func LookupProvider(name string) (CSP, bool) {
+	for _, c := range Providers() {
+		if strings.EqualFold(string(c), name) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// LoadProviderPlugin opens a Go plugin containing a provider. The plugin
+// is expected to call RegisterProvider from an init function, which is
+// run when the plugin is opened. The plugin must be built with the same
+// version of this package as the binary loading it.
+func LoadProviderPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("Could not load provider plugin %s: %s", path, err)
+	}
+	log.Println("Loaded provider plugin", path)
+	return nil
+}
+
+func providerFactory(c CSP) (ManagerFactory, bool) {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	factory, exist := providers[c]
+	return factory, exist
+}
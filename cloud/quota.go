@@ -0,0 +1,142 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+)
+
+// QuotaUsage is how much of a service quota, such as the number of
+// snapshots, is used in a region of an account/project
+type QuotaUsage struct {
+	Account  string
+	Location string
+	// Name describes what the quota limits, e.g. "EBS snapshots"
+	Name  string
+	Usage float64
+	Limit float64
+}
+
+// Percent returns how many percent of the quota is used
+func (q QuotaUsage) Percent() float64 {
+	if q.Limit <= 0 {
+		return 0
+	}
+	return 100 * q.Usage / q.Limit
+}
+
+// awsQuota is a quota in the Service Quotas API, together with how its
+// usage is counted, since not every quota reports its usage
+type awsQuota struct {
+	name        string
+	serviceCode string
+	quotaCode   string
+	// defaultLimit is used if the quota can't be looked up
+	defaultLimit float64
+	count        func(client *awsEC2Client) (int, error)
+}
+
+// awsQuotas are the quotas which resources cleaned up by Cloudsweeper
+// count towards, and which are usually reached first
+var awsQuotas = []awsQuota{
+	{name: "EBS snapshots", serviceCode: "ebs", quotaCode: "L-309BACF6", defaultLimit: 100000, count: countAWSSnapshots},
+	{name: "AMIs", serviceCode: "ec2", quotaCode: "L-B665C33B", defaultLimit: 50000, count: countAWSImages},
+	{name: "VPCs", serviceCode: "vpc", quotaCode: "L-F678F1CE", defaultLimit: 5, count: countAWSVPCs},
+}
+
+func (m *awsResourceManager) ForEachAccountQuotas(f func(string, []QuotaUsage)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		quotas := []QuotaUsage{}
+		var quotasMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			sq := servicequotas.New(sess, &aws.Config{Credentials: cred, Region: aws.String(client.region)})
+			regionQuotas := []QuotaUsage{}
+			for _, quota := range awsQuotas {
+				usage, err := quota.count(client)
+				if err != nil {
+					status.Warnf("Could not count the %s in %s of %s: %s", quota.name, region, AccountDisplayName(account), err)
+					continue
+				}
+				regionQuotas = append(regionQuotas, QuotaUsage{
+					Account:  account,
+					Location: region,
+					Name:     quota.name,
+					Usage:    float64(usage),
+					Limit:    awsQuotaLimit(sq, quota, account, region),
+				})
+			}
+			quotasMutex.Lock()
+			defer quotasMutex.Unlock()
+			quotas = append(quotas, regionQuotas...)
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, quotas)
+	})
+}
+
+// awsQuotaLimit returns the quota applied to an account, which is the
+// default quota unless an increase was requested. If neither can be
+// looked up, the usual default is used.
+func awsQuotaLimit(sq *servicequotas.ServiceQuotas, quota awsQuota, account, region string) float64 {
+	applied, err := sq.GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String(quota.serviceCode),
+		QuotaCode:   aws.String(quota.quotaCode),
+	})
+	if err == nil && applied.Quota != nil && applied.Quota.Value != nil {
+		return aws.Float64Value(applied.Quota.Value)
+	}
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != servicequotas.ErrCodeNoSuchResourceException) {
+		status.Warnf("Could not look up the quota of %s in %s of %s, using the default of %.0f: %s", quota.name, region, AccountDisplayName(account), quota.defaultLimit, err)
+		return quota.defaultLimit
+	}
+	defaultQuota, err := sq.GetAWSDefaultServiceQuota(&servicequotas.GetAWSDefaultServiceQuotaInput{
+		ServiceCode: aws.String(quota.serviceCode),
+		QuotaCode:   aws.String(quota.quotaCode),
+	})
+	if err != nil || defaultQuota.Quota == nil || defaultQuota.Quota.Value == nil {
+		return quota.defaultLimit
+	}
+	return aws.Float64Value(defaultQuota.Quota.Value)
+}
+
+func countAWSSnapshots(client *awsEC2Client) (int, error) {
+	count := 0
+	err := client.DescribeSnapshotsPages(&ec2.DescribeSnapshotsInput{
+		OwnerIds: aws.StringSlice([]string{"self"}),
+	}, func(page *ec2.DescribeSnapshotsOutput, lastPage bool) bool {
+		count += len(page.Snapshots)
+		return true
+	})
+	return count, err
+}
+
+func countAWSImages(client *awsEC2Client) (int, error) {
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{"self"}),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(output.Images), nil
+}
+
+func countAWSVPCs(client *awsEC2Client) (int, error) {
+	count := 0
+	err := client.DescribeVpcsPages(&ec2.DescribeVpcsInput{}, func(page *ec2.DescribeVpcsOutput, lastPage bool) bool {
+		count += len(page.Vpcs)
+		return true
+	})
+	return count, err
+}
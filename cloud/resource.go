@@ -18,6 +18,7 @@ type baseResource struct {
 	location     string
 	public       bool
 	creationTime time.Time
+	lastTagged   time.Time
 }
 
 func (r *baseResource) CSP() CSP {
@@ -48,6 +49,14 @@ func (r *baseResource) CreationTime() time.Time {
 	return r.creationTime
 }
 
+func (r *baseResource) LastTagged() time.Time {
+	return r.lastTagged
+}
+
+func (r *baseResource) setLastTagged(t time.Time) {
+	r.lastTagged = t
+}
+
 func cleanupResources(resources []Resource) error {
 	failed := false
 	var wg sync.WaitGroup
@@ -56,7 +65,7 @@ func cleanupResources(resources []Resource) error {
 		go func(index int) {
 			err := resources[index].Cleanup()
 			if err != nil {
-				log.Printf("Cleaning up %s for owner %s failed\n%s\n", resources[index].ID(), resources[index].Owner(), err)
+				log.Printf("Cleaning up %s for owner %s failed\n%s\n", resources[index].ID(), AccountDisplayName(resources[index].Owner()), err)
 				failed = true
 			}
 			wg.Done()
@@ -68,3 +77,59 @@ func cleanupResources(resources []Resource) error {
 	}
 	return nil
 }
+
+// forEachResource runs all the resource type specific iterators of a
+// manager in parallel, and then calls f with every resource, one at a
+// time. Every iterator only adds to a field of its own.
+func forEachResource(m ResourceManager, f func(Resource)) {
+	collection := &AllResourceCollection{}
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		m.ForEachInstance(func(i Instance) { collection.Instances = append(collection.Instances, i) })
+		wg.Done()
+	}()
+	go func() {
+		m.ForEachImage(func(i Image) { collection.Images = append(collection.Images, i) })
+		wg.Done()
+	}()
+	go func() {
+		m.ForEachVolume(func(v Volume) { collection.Volumes = append(collection.Volumes, v) })
+		wg.Done()
+	}()
+	go func() {
+		m.ForEachSnapshot(func(s Snapshot) { collection.Snapshots = append(collection.Snapshots, s) })
+		wg.Done()
+	}()
+	go func() {
+		m.ForEachBucket(func(b Bucket) { collection.Buckets = append(collection.Buckets, b) })
+		wg.Done()
+	}()
+	wg.Wait()
+	for _, res := range collection.Resources() {
+		f(res)
+	}
+}
+
+// limiter is used to bound the amount of goroutines doing work at
+// the same time. A nil limiter doesn't limit anything.
+type limiter chan struct{}
+
+func newLimiter(n int) limiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(limiter, n)
+}
+
+func (l limiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
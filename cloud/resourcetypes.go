@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+// The types of resources which can be disabled in a resource manager.
+// They are named the same as the categories of a policy.
+const (
+	ResourceTypeInstances = "instances"
+	ResourceTypeImages    = "images"
+	ResourceTypeVolumes   = "volumes"
+	ResourceTypeSnapshots = "snapshots"
+	ResourceTypeBuckets   = "buckets"
+)
+
+// ResourceTypes is a list of all resource types
+var ResourceTypes = []string{ResourceTypeInstances, ResourceTypeImages, ResourceTypeVolumes, ResourceTypeSnapshots, ResourceTypeBuckets}
+
+// IsResourceType returns true if the name is one of the resource types
+func IsResourceType(name string) bool {
+	for _, resourceType := range ResourceTypes {
+		if name == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceTypeSwitches keeps track of the resource types which are
+// disabled, in all accounts or only in some. Resources of a disabled type
+// are never discovered, so they are never marked or cleaned up either.
+type resourceTypeSwitches struct {
+	disabled      map[string]bool
+	ownerDisabled map[string]map[string]bool
+}
+
+func newResourceTypeSwitches(conf *ManagerConfig) *resourceTypeSwitches {
+	switches := &resourceTypeSwitches{
+		disabled:      make(map[string]bool),
+		ownerDisabled: make(map[string]map[string]bool),
+	}
+	for _, resourceType := range conf.DisabledResourceTypes {
+		switches.disabled[resourceType] = true
+	}
+	for owner, resourceTypes := range conf.OwnerDisabledResourceTypes {
+		switches.ownerDisabled[owner] = make(map[string]bool)
+		for _, resourceType := range resourceTypes {
+			switches.ownerDisabled[owner][resourceType] = true
+		}
+	}
+	return switches
+}
+
+// enabled returns true if resources of the type are discovered in the
+// account/project of the owner
+func (s *resourceTypeSwitches) enabled(owner, resourceType string) bool {
+	return !s.disabled[resourceType] && !s.ownerDisabled[owner][resourceType]
+}
+
+// owners returns the owners in which resources of the type are discovered
+func (s *resourceTypeSwitches) owners(owners []string, resourceType string) []string {
+	if len(s.disabled) == 0 && len(s.ownerDisabled) == 0 {
+		return owners
+	}
+	result := []string{}
+	for _, owner := range owners {
+		if s.enabled(owner, resourceType) {
+			result = append(result, owner)
+		}
+	}
+	return result
+}
+
+// filter removes the resources of disabled types from a collection, for
+// managers where the owner of a resource is only known once it has been
+// discovered
+func (s *resourceTypeSwitches) filter(collection *AllResourceCollection) {
+	if !s.enabled(collection.Owner, ResourceTypeInstances) {
+		collection.Instances = nil
+	}
+	if !s.enabled(collection.Owner, ResourceTypeImages) {
+		collection.Images = nil
+	}
+	if !s.enabled(collection.Owner, ResourceTypeVolumes) {
+		collection.Volumes = nil
+	}
+	if !s.enabled(collection.Owner, ResourceTypeSnapshots) {
+		collection.Snapshots = nil
+	}
+	if !s.enabled(collection.Owner, ResourceTypeBuckets) {
+		collection.Buckets = nil
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	awsAccessLogKeyDayFormat   = "2006-01-02"
+	awsAccessLogPartitionDay   = "2006/01/02/"
+	awsAccessLogLineTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// awsAccessLogReadOperations are the operations in access logs which
+// read an object, or its data, from the bucket
+var awsAccessLogReadOperations = map[string]bool{
+	"REST.GET.OBJECT":         true,
+	"REST.HEAD.OBJECT":        true,
+	"REST.GET.OBJECT_TORRENT": true,
+	"REST.POST.SELECT":        true,
+	"REST.POST.RESTORE":       true,
+	"REST.COPY.OBJECT_GET":    true,
+	"REST.COPY.PART_GET":      true,
+}
+
+// getAWSBucketLastRead will go through the server access logs of a
+// bucket, if it has logging enabled, and return when an object was last
+// read. The zero time is returned if the bucket doesn't have access logs,
+// or no object was read since the specified time. Access logs are always
+// in a bucket in the same account and region, so the bucket client can
+// be used to read them.
+func getAWSBucketLastRead(client s3iface.S3API, account, region, bucket string, since time.Time) (time.Time, error) {
+	logging, err := client.GetBucketLogging(&s3.GetBucketLoggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if logging.LoggingEnabled == nil || logging.LoggingEnabled.TargetBucket == nil {
+		return time.Time{}, nil
+	}
+	target := logging.LoggingEnabled.TargetBucket
+	prefix := aws.StringValue(logging.LoggingEnabled.TargetPrefix)
+	partitioned := false
+	if format := logging.LoggingEnabled.TargetObjectKeyFormat; format != nil && format.PartitionedPrefix != nil {
+		// Partitioned keys have the source bucket in the prefix, so only
+		// the logs of this bucket are listed
+		prefix += fmt.Sprintf("%s/%s/%s/", account, region, bucket)
+		partitioned = true
+	}
+
+	// Log object keys have the day they were delivered in the prefix, so
+	// the logs are listed one day at a time, newest first, and the scan
+	// stops at the first day with a read
+	since = since.UTC()
+	for day := time.Now().UTC(); !day.Before(since.Truncate(24 * time.Hour)); day = day.AddDate(0, 0, -1) {
+		dayPrefix := prefix + day.Format(awsAccessLogKeyDayFormat)
+		if partitioned {
+			dayPrefix = prefix + day.Format(awsAccessLogPartitionDay)
+		}
+		lastRead, err := lastReadFromAccessLogs(client, target, dayPrefix, bucket)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if lastRead.After(since) {
+			return lastRead, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// lastReadFromAccessLogs returns the time of the last object read from
+// the bucket in the access log objects with the specified prefix. The
+// objects are read newest first, until one has a read.
+func lastReadFromAccessLogs(client s3iface.S3API, target *string, prefix, bucket string) (time.Time, error) {
+	keys := []string{}
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: target,
+		Prefix: aws.String(prefix),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range output.Contents {
+			keys = append(keys, *object.Key)
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		object, err := client.GetObject(&s3.GetObjectInput{Bucket: target, Key: aws.String(keys[i])})
+		if err != nil {
+			return time.Time{}, err
+		}
+		lastRead := lastReadFromAccessLog(bufio.NewScanner(object.Body), bucket)
+		object.Body.Close()
+		if !lastRead.IsZero() {
+			return lastRead, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// lastReadFromAccessLog returns the time of the last object read from
+// the bucket in an access log object. Every line has the format:
+// owner bucket [time] ip requester request-id operation key ...
+func lastReadFromAccessLog(scanner *bufio.Scanner, bucket string) time.Time {
+	lastRead := time.Time{}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != bucket || !awsAccessLogReadOperations[fields[7]] {
+			continue
+		}
+		rawTime := strings.Trim(fields[2]+" "+fields[3], "[]")
+		t, err := time.Parse(awsAccessLogLineTimeFormat, rawTime)
+		if err == nil && t.After(lastRead) {
+			lastRead = t
+		}
+	}
+	return lastRead
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3 requests for a bucket must be sent to the region of the bucket,
+// otherwise they fail with a redirect. The region of every bucket is
+// looked up once, and updated if a request is redirected anyway, e.g.
+// since the bucket was recreated in another region.
+var (
+	bucketRegions      = make(map[string]string)
+	bucketRegionsMutex sync.Mutex
+)
+
+// AWSBucketRegion returns the region of an S3 bucket. The region is found
+// without any credentials, so it works for buckets in any account.
+func AWSBucketRegion(bucket string) (string, error) {
+	bucketRegionsMutex.Lock()
+	region, exist := bucketRegions[bucket]
+	bucketRegionsMutex.Unlock()
+	if exist {
+		return region, nil
+	}
+	return lookupAWSBucketRegion(bucket)
+}
+
+func lookupAWSBucketRegion(bucket string) (string, error) {
+	sess := NewAWSSession()
+	region, err := s3manager.GetBucketRegion(context.Background(), sess, bucket, defaultAWSRegion)
+	if err != nil {
+		return "", err
+	}
+	bucketRegionsMutex.Lock()
+	defer bucketRegionsMutex.Unlock()
+	bucketRegions[bucket] = region
+	return region, nil
+}
+
+// NewAWSBucketClient returns an S3 client for the region of the bucket,
+// using the specified credentials, or the default ones if nil
+func NewAWSBucketClient(bucket string, creds *credentials.Credentials) (s3iface.S3API, error) {
+	region, err := AWSBucketRegion(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return newAWSS3Client(creds, region), nil
+}
+
+func newAWSS3Client(creds *credentials.Credentials, region string) s3iface.S3API {
+	return awsClients.S3(NewAWSSession(), creds, region)
+}
+
+// isAWSRegionError checks if a request failed since it was sent to
+// another region than the one of the bucket
+func isAWSRegionError(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusMovedPermanently {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "PermanentRedirect", "AuthorizationHeaderMalformed", "BucketRegionError", "IllegalLocationConstraintException":
+			return true
+		}
+	}
+	return false
+}
+
+// withS3Client calls the function with a client for the region of the
+// bucket. If the request is redirected, the region of the bucket is
+// looked up again and the function is retried once.
+func (b *awsBucket) withS3Client(f func(s3iface.S3API) error) error {
+	sess := NewAWSSession()
+	creds := awsAccountCredentials(sess, b.Owner())
+	region := b.Location()
+	bucketRegionsMutex.Lock()
+	if known, exist := bucketRegions[b.ID()]; exist {
+		region = known
+	}
+	bucketRegionsMutex.Unlock()
+
+	err := f(newAWSS3Client(creds, region))
+	if !isAWSRegionError(err) {
+		return err
+	}
+	actual, lookupErr := lookupAWSBucketRegion(b.ID())
+	if lookupErr != nil || actual == region {
+		return err
+	}
+	return f(newAWSS3Client(creds, actual))
+}
@@ -0,0 +1,516 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sagemaker"
+)
+
+const (
+	awsMLKindNotebook  = "Notebook instance"
+	awsMLKindEndpoint  = "Endpoint"
+	awsMLKindStudioApp = "Studio app"
+
+	// awsStudioSystemInstanceType is the instance type of Studio apps
+	// which run on an instance managed by SageMaker, which is free
+	awsStudioSystemInstanceType = "system"
+
+	// awsNotebookStopWait is how long to wait for a notebook instance to
+	// stop, before deleting it
+	awsNotebookStopWait = 10 * time.Minute
+
+	// Opening Jupyter from the console creates a presigned URL, so this
+	// event is when a notebook instance was last opened
+	awsEventCreatePresignedNotebookURL = "CreatePresignedNotebookInstanceUrl"
+)
+
+type baseMLResource struct {
+	baseResource
+	arn       string
+	name      string
+	kind      string
+	instances map[string]int
+	userName  string
+	lastUsed  time.Time
+}
+
+func (r *baseMLResource) Name() string {
+	return r.name
+}
+
+func (r *baseMLResource) Kind() string {
+	return r.kind
+}
+
+func (r *baseMLResource) Instances() map[string]int {
+	return r.instances
+}
+
+func (r *baseMLResource) UserName() string {
+	return r.userName
+}
+
+func (r *baseMLResource) LastUsed() time.Time {
+	return r.lastUsed
+}
+
+// AWS
+
+func (r *baseMLResource) client() *sagemaker.SageMaker {
+	sess := NewAWSSession()
+	return sagemaker.New(sess, &aws.Config{
+		Credentials: awsAccountCredentials(sess, r.Owner()),
+		Region:      aws.String(r.Location()),
+	})
+}
+
+func (r *baseMLResource) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(AWS, key, value)
+	if _, exist := r.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, r.ID())
+	}
+	_, err := r.client().AddTags(&sagemaker.AddTagsInput{
+		ResourceArn: aws.String(r.arn),
+		Tags:        []*sagemaker.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	})
+	if err != nil {
+		return err
+	}
+	r.tags[key] = value
+	return nil
+}
+
+func (r *baseMLResource) RemoveTag(key string) error {
+	key, exist := Tags(r.tags).Key(key)
+	if !exist {
+		return nil
+	}
+	_, err := r.client().DeleteTags(&sagemaker.DeleteTagsInput{
+		ResourceArn: aws.String(r.arn),
+		TagKeys:     aws.StringSlice([]string{key}),
+	})
+	if err != nil {
+		return err
+	}
+	delete(r.tags, key)
+	return nil
+}
+
+type awsNotebookInstance struct {
+	baseMLResource
+}
+
+func (n *awsNotebookInstance) Stoppable() bool {
+	return true
+}
+
+func (n *awsNotebookInstance) Stop() error {
+	log.Printf("Stopping notebook instance %s in %s", n.ID(), n.Owner())
+	_, err := n.client().StopNotebookInstance(&sagemaker.StopNotebookInstanceInput{
+		NotebookInstanceName: aws.String(n.ID()),
+	})
+	return err
+}
+
+// Cleanup stops the notebook instance first, since a notebook instance
+// can only be deleted once it's stopped. The ML storage volume of the
+// notebook instance is deleted with it.
+func (n *awsNotebookInstance) Cleanup() error {
+	log.Printf("Cleaning up notebook instance %s in %s", n.ID(), n.Owner())
+	client := n.client()
+	input := &sagemaker.DescribeNotebookInstanceInput{NotebookInstanceName: aws.String(n.ID())}
+	output, err := client.DescribeNotebookInstance(input)
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(output.NotebookInstanceStatus) == sagemaker.NotebookInstanceStatusInService {
+		if err := n.Stop(); err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(awsNotebookStopWait)
+	for {
+		switch aws.StringValue(output.NotebookInstanceStatus) {
+		case sagemaker.NotebookInstanceStatusStopped, sagemaker.NotebookInstanceStatusFailed:
+			_, err = client.DeleteNotebookInstance(&sagemaker.DeleteNotebookInstanceInput{
+				NotebookInstanceName: aws.String(n.ID()),
+			})
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s was not stopped within %s", n.ID(), awsNotebookStopWait)
+		}
+		time.Sleep(10 * time.Second)
+		if output, err = client.DescribeNotebookInstance(input); err != nil {
+			return err
+		}
+	}
+}
+
+type awsEndpoint struct {
+	baseMLResource
+	variants []string
+}
+
+func (e *awsEndpoint) Stoppable() bool {
+	return false
+}
+
+func (e *awsEndpoint) Stop() error {
+	return fmt.Errorf("Endpoint %s can't be stopped", e.ID())
+}
+
+// Cleanup deletes the endpoint. Its endpoint configuration and models are
+// kept, so the endpoint can be created again.
+func (e *awsEndpoint) Cleanup() error {
+	log.Printf("Cleaning up endpoint %s in %s", e.ID(), e.Owner())
+	_, err := e.client().DeleteEndpoint(&sagemaker.DeleteEndpointInput{
+		EndpointName: aws.String(e.ID()),
+	})
+	return err
+}
+
+type awsStudioApp struct {
+	baseMLResource
+	domainID string
+	appType  string
+}
+
+func (a *awsStudioApp) Stoppable() bool {
+	return false
+}
+
+func (a *awsStudioApp) Stop() error {
+	return fmt.Errorf("Studio app %s can't be stopped", a.ID())
+}
+
+// Cleanup deletes the app. The files of the user are in the home
+// directory of the domain, so they are kept.
+func (a *awsStudioApp) Cleanup() error {
+	log.Printf("Cleaning up Studio app %s in %s", a.ID(), a.Owner())
+	_, err := a.client().DeleteApp(&sagemaker.DeleteAppInput{
+		DomainId:        aws.String(a.domainID),
+		UserProfileName: aws.String(a.userName),
+		AppType:         aws.String(a.appType),
+		AppName:         aws.String(a.name),
+	})
+	return err
+}
+
+func (m *awsResourceManager) ForEachAccountMLResources(usageDays int, f func(string, []MLResource)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		resources := []MLResource{}
+		var resourcesMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			config := &aws.Config{Credentials: cred, Region: aws.String(client.region)}
+			region := client.region
+			// SageMaker isn't available in every region, so failures only
+			// skip the kind of resource in the region
+			sm := sagemaker.New(sess, config)
+			regionResources := []MLResource{}
+			notebooks, err := getAWSNotebookInstances(account, sm)
+			if err != nil {
+				status.Warnf("Could not list notebook instances in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			if len(notebooks) > 0 {
+				setAWSNotebooksLastOpened(cloudtrail.New(sess, config), notebooks, usageDays)
+			}
+			for _, notebook := range notebooks {
+				regionResources = append(regionResources, notebook)
+			}
+			endpoints, err := getAWSEndpoints(account, sm)
+			if err != nil {
+				status.Warnf("Could not list endpoints in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			cw := cloudwatch.New(sess, config)
+			for _, endpoint := range endpoints {
+				setAWSEndpointLastInvoked(cw, endpoint, usageDays)
+				regionResources = append(regionResources, endpoint)
+			}
+			apps, err := getAWSStudioApps(account, sm)
+			if err != nil {
+				status.Warnf("Could not list Studio apps in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			for _, app := range apps {
+				regionResources = append(regionResources, app)
+			}
+			resourcesMutex.Lock()
+			defer resourcesMutex.Unlock()
+			resources = append(resources, regionResources...)
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, resources)
+	})
+}
+
+// getAWSSageMakerTags returns the tags of a SageMaker resource, which
+// aren't included when listing the resources
+func getAWSSageMakerTags(client *sagemaker.SageMaker, arn string) (map[string]string, error) {
+	tags := make(map[string]string)
+	err := client.ListTagsPages(&sagemaker.ListTagsInput{ResourceArn: aws.String(arn)},
+		func(output *sagemaker.ListTagsOutput, lastPage bool) bool {
+			for _, tag := range output.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			return true
+		})
+	return tags, err
+}
+
+// getAWSNotebookInstances will get the running notebook instances in the
+// current region. A notebook instance was last used no earlier than when
+// it was last started, which is when it was last modified.
+func getAWSNotebookInstances(account string, client *sagemaker.SageMaker) ([]*awsNotebookInstance, error) {
+	region := aws.StringValue(client.Config.Region)
+	notebooks := []*awsNotebookInstance{}
+	err := client.ListNotebookInstancesPages(&sagemaker.ListNotebookInstancesInput{
+		StatusEquals: aws.String(sagemaker.NotebookInstanceStatusInService),
+	}, func(output *sagemaker.ListNotebookInstancesOutput, lastPage bool) bool {
+		for _, notebook := range output.NotebookInstances {
+			name := aws.StringValue(notebook.NotebookInstanceName)
+			notebooks = append(notebooks, &awsNotebookInstance{baseMLResource{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           name,
+					location:     region,
+					creationTime: aws.TimeValue(notebook.CreationTime),
+				},
+				arn:       aws.StringValue(notebook.NotebookInstanceArn),
+				name:      name,
+				kind:      awsMLKindNotebook,
+				instances: map[string]int{aws.StringValue(notebook.InstanceType): 1},
+				lastUsed:  aws.TimeValue(notebook.LastModifiedTime),
+			}})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, notebook := range notebooks {
+		if notebook.tags, err = getAWSSageMakerTags(client, notebook.arn); err != nil {
+			return nil, err
+		}
+	}
+	return notebooks, nil
+}
+
+type awsCreatePresignedNotebookURLEvent struct {
+	RequestParameters struct {
+		NotebookInstanceName string `json:"notebookInstanceName"`
+	} `json:"requestParameters"`
+}
+
+// setAWSNotebooksLastOpened updates when every notebook instance was last
+// used with when it was last opened, from the presigned URL events in the
+// CloudTrail event history. If the events can't be looked up, the
+// notebook instances are treated as in use.
+func setAWSNotebooksLastOpened(trail *cloudtrail.CloudTrail, notebooks []*awsNotebookInstance, usageDays int) {
+	if usageDays > awsCloudTrailMaxDays {
+		usageDays = awsCloudTrailMaxDays
+	}
+	lastOpened := make(map[string]time.Time)
+	err := lookupAWSEvents(trail, awsEventCreatePresignedNotebookURL, time.Now().AddDate(0, 0, -usageDays), func(eventTime time.Time, raw []byte) {
+		var event awsCreatePresignedNotebookURLEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return
+		}
+		updateLastUsed(lastOpened, event.RequestParameters.NotebookInstanceName, eventTime)
+	})
+	if err != nil {
+		status.Warnf("Could not look up %s events in %s, treating its notebook instances as in use: %s", awsEventCreatePresignedNotebookURL, aws.StringValue(trail.Config.Region), err)
+		for _, notebook := range notebooks {
+			notebook.lastUsed = time.Now()
+		}
+		return
+	}
+	for _, notebook := range notebooks {
+		if opened := lastOpened[notebook.ID()]; opened.After(notebook.lastUsed) {
+			notebook.lastUsed = opened
+		}
+	}
+}
+
+// getAWSEndpoints will get the endpoints in service in the current region,
+// with the instances of their variants. Serverless variants aren't billed
+// while idle, so endpoints with only serverless variants are left out.
+func getAWSEndpoints(account string, client *sagemaker.SageMaker) ([]*awsEndpoint, error) {
+	region := aws.StringValue(client.Config.Region)
+	names := []string{}
+	err := client.ListEndpointsPages(&sagemaker.ListEndpointsInput{
+		StatusEquals: aws.String(sagemaker.EndpointStatusInService),
+	}, func(output *sagemaker.ListEndpointsOutput, lastPage bool) bool {
+		for _, endpoint := range output.Endpoints {
+			names = append(names, aws.StringValue(endpoint.EndpointName))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []*awsEndpoint{}
+	for _, name := range names {
+		output, err := client.DescribeEndpoint(&sagemaker.DescribeEndpointInput{EndpointName: aws.String(name)})
+		if err != nil {
+			return nil, err
+		}
+		config, err := client.DescribeEndpointConfig(&sagemaker.DescribeEndpointConfigInput{
+			EndpointConfigName: output.EndpointConfigName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		instanceTypes := make(map[string]string)
+		for _, variant := range config.ProductionVariants {
+			instanceTypes[aws.StringValue(variant.VariantName)] = aws.StringValue(variant.InstanceType)
+		}
+		endpoint := &awsEndpoint{
+			baseMLResource: baseMLResource{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           name,
+					location:     region,
+					creationTime: aws.TimeValue(output.CreationTime),
+				},
+				arn:       aws.StringValue(output.EndpointArn),
+				name:      name,
+				kind:      awsMLKindEndpoint,
+				instances: make(map[string]int),
+				lastUsed:  aws.TimeValue(output.LastModifiedTime),
+			},
+		}
+		for _, variant := range output.ProductionVariants {
+			variantName := aws.StringValue(variant.VariantName)
+			endpoint.variants = append(endpoint.variants, variantName)
+			if instanceType := instanceTypes[variantName]; instanceType != "" {
+				endpoint.instances[instanceType] += int(aws.Int64Value(variant.CurrentInstanceCount))
+			}
+		}
+		if len(endpoint.instances) == 0 {
+			continue
+		}
+		if endpoint.tags, err = getAWSSageMakerTags(client, endpoint.arn); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// setAWSEndpointLastInvoked updates when the endpoint was last used with
+// the last day it was invoked, from the daily invocations of its variants
+// in the last usageDays days. If the metrics can't be read, the endpoint
+// is treated as in use.
+func setAWSEndpointLastInvoked(cw *cloudwatch.CloudWatch, endpoint *awsEndpoint, usageDays int) {
+	for _, variant := range endpoint.variants {
+		output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/SageMaker"),
+			MetricName: aws.String("Invocations"),
+			Dimensions: []*cloudwatch.Dimension{{
+				Name:  aws.String("EndpointName"),
+				Value: aws.String(endpoint.ID()),
+			}, {
+				Name:  aws.String("VariantName"),
+				Value: aws.String(variant),
+			}},
+			StartTime:  aws.Time(time.Now().AddDate(0, 0, -usageDays)),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int64(24 * 60 * 60),
+			Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum}),
+		})
+		if err != nil {
+			status.Warnf("Could not read the invocations of %s in %s, treating it as in use: %s", endpoint.ID(), AccountDisplayName(endpoint.Owner()), err)
+			endpoint.lastUsed = time.Now()
+			return
+		}
+		for _, datapoint := range output.Datapoints {
+			if aws.Float64Value(datapoint.Sum) > 0 && aws.TimeValue(datapoint.Timestamp).After(endpoint.lastUsed) {
+				endpoint.lastUsed = aws.TimeValue(datapoint.Timestamp)
+			}
+		}
+	}
+}
+
+// getAWSStudioApps will get the Studio apps in service in the current
+// region which run on an instance of their own. Apps on the free system
+// instance are left out. An app was last used when its user was last
+// active in it.
+func getAWSStudioApps(account string, client *sagemaker.SageMaker) ([]*awsStudioApp, error) {
+	region := aws.StringValue(client.Config.Region)
+	details := []*sagemaker.AppDetails{}
+	err := client.ListAppsPages(&sagemaker.ListAppsInput{}, func(output *sagemaker.ListAppsOutput, lastPage bool) bool {
+		for _, app := range output.Apps {
+			if aws.StringValue(app.Status) == sagemaker.AppStatusInService {
+				details = append(details, app)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	apps := []*awsStudioApp{}
+	for _, app := range details {
+		output, err := client.DescribeApp(&sagemaker.DescribeAppInput{
+			DomainId:        app.DomainId,
+			UserProfileName: app.UserProfileName,
+			AppType:         app.AppType,
+			AppName:         app.AppName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		instanceType := awsStudioSystemInstanceType
+		if output.ResourceSpec != nil && output.ResourceSpec.InstanceType != nil {
+			instanceType = aws.StringValue(output.ResourceSpec.InstanceType)
+		}
+		if instanceType == awsStudioSystemInstanceType {
+			continue
+		}
+		domainID, userName := aws.StringValue(output.DomainId), aws.StringValue(output.UserProfileName)
+		appType, name := aws.StringValue(output.AppType), aws.StringValue(output.AppName)
+		tags, err := getAWSSageMakerTags(client, aws.StringValue(output.AppArn))
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, &awsStudioApp{
+			baseMLResource: baseMLResource{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           strings.Join([]string{domainID, userName, appType, name}, "/"),
+					location:     region,
+					tags:         tags,
+					creationTime: aws.TimeValue(output.CreationTime),
+				},
+				arn:       aws.StringValue(output.AppArn),
+				name:      name,
+				kind:      awsMLKindStudioApp,
+				instances: map[string]int{instanceType: 1},
+				userName:  userName,
+				lastUsed:  aws.TimeValue(output.LastUserActivityTimestamp),
+			},
+			domainID: domainID,
+			appType:  appType,
+		})
+	}
+	return apps, nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// AnyIPv4 is the CIDR matching every IPv4 address
+	AnyIPv4 = "0.0.0.0/0"
+	// AnyIPv6 is the CIDR matching every IPv6 address
+	AnyIPv6 = "::/0"
+
+	protocolAll = "-1"
+)
+
+// IngressRule is a single rule allowing incoming traffic from a CIDR
+// on a range of ports
+type IngressRule struct {
+	Protocol string
+	FromPort int64
+	ToPort   int64
+	CIDR     string
+}
+
+// OpenToInternet checks if the rule allows traffic from any address
+func (r IngressRule) OpenToInternet() bool {
+	return r.CIDR == AnyIPv4 || r.CIDR == AnyIPv6
+}
+
+// CoversPort checks if the rule allows traffic on the specified port
+func (r IngressRule) CoversPort(port int64) bool {
+	if r.Protocol == protocolAll {
+		return true
+	}
+	return r.FromPort <= port && port <= r.ToPort
+}
+
+func (r IngressRule) String() string {
+	if r.Protocol == protocolAll {
+		return fmt.Sprintf("all traffic from %s", r.CIDR)
+	}
+	if r.FromPort == r.ToPort {
+		return fmt.Sprintf("%s port %d from %s", r.Protocol, r.FromPort, r.CIDR)
+	}
+	return fmt.Sprintf("%s ports %d-%d from %s", r.Protocol, r.FromPort, r.ToPort, r.CIDR)
+}
+
+type baseSecurityGroup struct {
+	baseResource
+	name         string
+	ingressRules []IngressRule
+}
+
+func (g *baseSecurityGroup) Name() string {
+	return g.name
+}
+
+func (g *baseSecurityGroup) IngressRules() []IngressRule {
+	return g.ingressRules
+}
+
+// AWS
+
+type awsSecurityGroup struct {
+	baseSecurityGroup
+}
+
+func (g *awsSecurityGroup) Cleanup() error {
+	log.Printf("Cleaning up security group %s in %s", g.ID(), g.Owner())
+	client := clientForAWSResource(g)
+	input := &ec2.DeleteSecurityGroupInput{
+		GroupId: aws.String(g.ID()),
+	}
+	_, err := client.DeleteSecurityGroup(input)
+	return err
+}
+
+func (g *awsSecurityGroup) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(g, key, value, overwrite)
+}
+
+func (g *awsSecurityGroup) RemoveTag(key string) error {
+	return removeAWSTag(g, key)
+}
+
+func (g *awsSecurityGroup) RevokeIngressRules(rules []IngressRule) error {
+	log.Printf("Revoking %d ingress rules on security group %s in %s", len(rules), g.ID(), g.Owner())
+	permissions := []*ec2.IpPermission{}
+	for _, rule := range rules {
+		permission := &ec2.IpPermission{
+			IpProtocol: aws.String(rule.Protocol),
+		}
+		if rule.Protocol != protocolAll {
+			permission.FromPort = aws.Int64(rule.FromPort)
+			permission.ToPort = aws.Int64(rule.ToPort)
+		}
+		if rule.CIDR == AnyIPv6 {
+			permission.Ipv6Ranges = []*ec2.Ipv6Range{{CidrIpv6: aws.String(rule.CIDR)}}
+		} else {
+			permission.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(rule.CIDR)}}
+		}
+		permissions = append(permissions, permission)
+	}
+	client := clientForAWSResource(g)
+	input := &ec2.RevokeSecurityGroupIngressInput{
+		GroupId:       aws.String(g.ID()),
+		IpPermissions: permissions,
+	}
+	_, err := client.RevokeSecurityGroupIngress(input)
+	if err != nil {
+		return err
+	}
+	remaining := []IngressRule{}
+	for _, existing := range g.ingressRules {
+		revoked := false
+		for _, rule := range rules {
+			revoked = revoked || existing == rule
+		}
+		if !revoked {
+			remaining = append(remaining, existing)
+		}
+	}
+	g.ingressRules = remaining
+	return nil
+}
@@ -7,11 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/vmware/govmomi/vim25/types"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -20,6 +22,7 @@ type baseSnapshot struct {
 	encrypted bool
 	inUse     bool
 	sizeGB    int64
+	lastUsed  time.Time
 }
 
 func (s *baseSnapshot) Encrypted() bool {
@@ -30,6 +33,14 @@ func (s *baseSnapshot) InUse() bool {
 	return s.inUse
 }
 
+func (s *baseSnapshot) LastUsed() time.Time {
+	return s.lastUsed
+}
+
+func (s *baseSnapshot) setLastUsed(t time.Time) {
+	s.lastUsed = t
+}
+
 func (s *baseSnapshot) SizeGB() int64 {
 	return s.sizeGB
 }
@@ -46,10 +57,24 @@ func cleanupSnapshots(snapshots []Snapshot) error {
 	return cleanupResources(resList)
 }
 
+// SnapshotSource is implemented by snapshots which know the volume they
+// were created from. Use a type assertion on the Snapshot to check for
+// support.
+type SnapshotSource interface {
+	// SourceVolumeID returns the ID of the volume the snapshot was
+	// created from, or an empty string if it's unknown
+	SourceVolumeID() string
+}
+
 // AWS
 
 type awsSnapshot struct {
 	baseSnapshot
+	volumeID string
+}
+
+func (s *awsSnapshot) SourceVolumeID() string {
+	return s.volumeID
 }
 
 func (s *awsSnapshot) Cleanup() error {
@@ -80,6 +105,24 @@ func (s *awsSnapshot) RemoveTag(key string) error {
 	return removeAWSTag(s, key)
 }
 
+// Archive will move the snapshot to the EBS Snapshot Archive tier
+func (s *awsSnapshot) Archive() error {
+	log.Printf("Archiving snapshot %s in %s", s.ID(), s.Owner())
+	client := clientForAWSResource(s)
+	_, err := client.ModifySnapshotTier(&ec2.ModifySnapshotTierInput{
+		SnapshotId:  aws.String(s.ID()),
+		StorageTier: aws.String(ec2.TargetStorageTierArchive),
+	})
+	return err
+}
+
+// CopyEncrypted will copy the snapshot with encryption enabled
+func (s *awsSnapshot) CopyEncrypted(tags map[string]string) (string, error) {
+	log.Printf("Creating encrypted copy of snapshot %s in %s", s.ID(), s.Owner())
+	client := clientForAWSResource(s)
+	return copyAWSSnapshotEncrypted(client, s.ID(), fmt.Sprintf("Encrypted copy of %s", s.ID()), tags)
+}
+
 // GCP
 
 type gcpSnapshot struct {
@@ -94,6 +137,7 @@ func (s *gcpSnapshot) Cleanup() error {
 }
 
 func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(GCP, key, value)
 	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
 	if err != nil {
 		return err
@@ -119,6 +163,7 @@ func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
 }
 
 func (s *gcpSnapshot) RemoveTag(key string) error {
+	key, _ = NormalizeTag(GCP, key, "")
 	newLabels := make(map[string]string)
 	for k, val := range s.tags {
 		if k != key {
@@ -140,3 +185,56 @@ func (s *gcpSnapshot) RemoveTag(key string) error {
 	s.tags = newLabels
 	return nil
 }
+
+// vSphere
+
+type vsphereSnapshot struct {
+	baseSnapshot
+	client      *vsphereClient
+	ref         types.ManagedObjectReference
+	name        string
+	description string
+}
+
+// Cleanup will remove this snapshot, consolidating its disks into those
+// of the snapshot after it. Snapshots after it are kept.
+func (s *vsphereSnapshot) Cleanup() error {
+	log.Printf("Cleaning up snapshot %s (%s) in %s", s.name, s.ID(), s.Owner())
+	ctx := s.client.context()
+	c, err := s.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	return removeVSphereSnapshot(ctx, c, s.ref)
+}
+
+func (s *vsphereSnapshot) SetTag(key, value string, overwrite bool) error {
+	if _, exist := s.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, s.ID())
+	}
+	return s.writeTag(key, &value)
+}
+
+func (s *vsphereSnapshot) RemoveTag(key string) error {
+	if _, exist := s.tags[key]; !exist {
+		return nil
+	}
+	return s.writeTag(key, nil)
+}
+
+// writeTag sets, or removes if value is nil, a tag in the description of
+// the snapshot, as snapshots can't have custom attributes
+func (s *vsphereSnapshot) writeTag(key string, value *string) error {
+	description := vsphereDescriptionWithTag(s.description, key, value)
+	ctx := s.client.context()
+	c, err := s.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := renameVSphereSnapshot(ctx, c, s.ref, s.name, description); err != nil {
+		return err
+	}
+	s.description = description
+	s.tags = vsphereDescriptionTags(description)
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Tags are the tags of a resource, called labels in GCP. The CSPs have
+// different rules for tags: AWS tag keys are case sensitive, while GCP
+// labels can only be lower case. Looking up tags through Tags makes the
+// same tag key match in every CSP.
+type Tags map[string]string
+
+// CanonicalTagKey returns the form of a tag key used to compare keys
+// across CSPs. Keys are compared case insensitively, and with underscores
+// and dashes being the same, since e.g. GCP labels can't contain upper
+// case letters.
+func CanonicalTagKey(key string) string {
+	return strings.Replace(strings.ToLower(key), "_", "-", -1)
+}
+
+// Key returns the key of the tag matching the specified key. A tag with
+// exactly that key is preferred over one that only matches canonically.
+func (t Tags) Key(key string) (string, bool) {
+	if _, exist := t[key]; exist {
+		return key, true
+	}
+	canonical := CanonicalTagKey(key)
+	for k := range t {
+		if CanonicalTagKey(k) == canonical {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Get returns the value of the tag matching the specified key
+func (t Tags) Get(key string) (string, bool) {
+	k, exist := t.Key(key)
+	if !exist {
+		return "", false
+	}
+	return t[k], true
+}
+
+// Has returns whether there is a tag matching the specified key
+func (t Tags) Has(key string) bool {
+	_, exist := t.Key(key)
+	return exist
+}
+
+// TagConstraints are the rules for tags in a CSP. Zero lengths mean no
+// limit, and a nil Allowed allows every character.
+type TagConstraints struct {
+	MaxKeyLength   int
+	MaxValueLength int
+	// LowerCase is true if keys and values can't contain upper case letters
+	LowerCase bool
+	// Allowed checks if a character can be used in keys and values
+	Allowed func(r rune) bool
+}
+
+var tagConstraints = map[CSP]TagConstraints{
+	AWS: {
+		MaxKeyLength:   128,
+		MaxValueLength: 256,
+		Allowed: func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune("_.:/=+-@", r)
+		},
+	},
+	GCP: {
+		MaxKeyLength:   63,
+		MaxValueLength: 63,
+		LowerCase:      true,
+		Allowed: func(r rune) bool {
+			return unicode.IsLower(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+		},
+	},
+}
+
+// TagConstraintsFor returns the rules for tags in the specified CSP. CSPs
+// without known rules, such as Kubernetes where tags are annotations,
+// have no constraints.
+func TagConstraintsFor(csp CSP) TagConstraints {
+	return tagConstraints[csp]
+}
+
+// Key returns the key changed to follow the constraints
+func (c TagConstraints) Key(key string) string {
+	return c.apply(key, c.MaxKeyLength)
+}
+
+// Value returns the value changed to follow the constraints
+func (c TagConstraints) Value(value string) string {
+	return c.apply(value, c.MaxValueLength)
+}
+
+// apply lower cases the text if required, replaces characters which are
+// not allowed with underscores, and cuts it to the maximum length
+func (c TagConstraints) apply(text string, maxLength int) string {
+	if c.LowerCase {
+		text = strings.ToLower(text)
+	}
+	if c.Allowed != nil {
+		text = strings.Map(func(r rune) rune {
+			if c.Allowed(r) {
+				return r
+			}
+			return '_'
+		}, text)
+	}
+	if maxLength > 0 && len([]rune(text)) > maxLength {
+		text = string([]rune(text)[:maxLength])
+	}
+	return text
+}
+
+// NormalizeTag returns the tag key and value changed to follow the rules
+// for tags in the specified CSP. Setting a tag normalizes it, so that
+// the same tag can be set in every CSP.
+func NormalizeTag(csp CSP, key, value string) (string, string) {
+	c := TagConstraintsFor(csp)
+	return c.Key(key), c.Value(value)
+}
+
+// ParseTagTime parses a time written to a tag in RFC3339 format. Times
+// in GCP labels are lower cased, with colons replaced by underscores, so
+// such times are parsed as well.
+func ParseTagTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	restored := strings.Replace(strings.ToUpper(value), "_", ":", -1)
+	if t, restoredErr := time.Parse(time.RFC3339, restored); restoredErr == nil {
+		return t, nil
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// awsScopeHandlerName is the name of the request handler which gives AWS
+// requests the context of the account and region they are made in
+const awsScopeHandlerName = "cloudsweeper.ScopeTimeout"
+
+// scopeTimeouts bounds how long an account/project, and every region or
+// zone of it, may be processed. Every scope gets a context which is done
+// once its timeout has passed, and the requests made in the scope are
+// canceled then, so that a slow account or region can't stall the whole
+// run. The run continues without the scopes which timed out, and they are
+// recorded with status.TimedOut. A zero timeout means no limit. All scopes
+// are canceled when the base context is done.
+type scopeTimeouts struct {
+	base     context.Context
+	account  time.Duration
+	region   time.Duration
+	mutex    sync.Mutex
+	contexts map[scopeKey]context.Context
+}
+
+// scopeKey identifies a scope. The owner is whatever the requests made in
+// the scope can be traced back to, such as the credentials of an account.
+// The region is empty for the scope of a whole account.
+type scopeKey struct {
+	owner  interface{}
+	region string
+}
+
+func newScopeTimeouts(base context.Context, account, region time.Duration) *scopeTimeouts {
+	if base == nil {
+		base = context.Background()
+	}
+	return &scopeTimeouts{
+		base:     base,
+		account:  account,
+		region:   region,
+		contexts: make(map[scopeKey]context.Context),
+	}
+}
+
+// runAccount calls f in the scope of an account, with the specified name
+func (t *scopeTimeouts) runAccount(owner interface{}, name string, f func()) {
+	t.run(scopeKey{owner, ""}, t.base, t.account, name, f)
+}
+
+// runRegion calls f in the scope of a region of an account. The region
+// times out when the account does, if that is sooner.
+func (t *scopeTimeouts) runRegion(owner interface{}, region, name string, f func()) {
+	t.run(scopeKey{owner, region}, t.context(owner, ""), t.region, name+" "+region, f)
+}
+
+func (t *scopeTimeouts) run(key scopeKey, parent context.Context, timeout time.Duration, name string, f func()) {
+	if t == nil || (timeout <= 0 && parent.Done() == nil) {
+		f()
+		return
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+	t.mutex.Lock()
+	t.contexts[key] = ctx
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.contexts, key)
+		t.mutex.Unlock()
+	}()
+
+	f()
+	// A region of an account which timed out is not reported on its own
+	if ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		status.TimedOut(name, timeout)
+	}
+}
+
+// context returns the context of the scope of a region of an account, or
+// that of the whole account if the region has no scope of its own, or else
+// the base context
+func (t *scopeTimeouts) context(owner interface{}, region string) context.Context {
+	if t == nil {
+		return context.Background()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if ctx, exist := t.contexts[scopeKey{owner, region}]; exist {
+		return ctx
+	}
+	if ctx, exist := t.contexts[scopeKey{owner, ""}]; exist {
+		return ctx
+	}
+	return t.base
+}
+
+// expired returns true if the scope of a region of an account, or of the
+// whole account, has timed out
+func (t *scopeTimeouts) expired(owner interface{}, region string) bool {
+	return t.context(owner, region).Err() != nil
+}
+
+// awsTimeouts bounds how long an AWS account and its regions may be
+// processed. Scopes are identified by the credentials of the account.
+var awsTimeouts *scopeTimeouts
+
+// addAWSScopeHandler makes the clients created from the session make their
+// requests in the context of the account, and region, whose credentials
+// they use, so that they are canceled when the scope times out. It must
+// be called before any goroutine uses the session.
+func addAWSScopeHandler(sess *session.Session) {
+	if awsTimeouts == nil {
+		return
+	}
+	sess.Handlers.Validate.RemoveByName(awsScopeHandlerName)
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: awsScopeHandlerName,
+		Fn: func(r *request.Request) {
+			if ctx := awsTimeouts.context(r.Config.Credentials, aws.StringValue(r.Config.Region)); ctx != context.Background() {
+				r.SetContext(ctx)
+			}
+		},
+	})
+}
+
+// isAWSScopeTimeout returns true if the error is from a request which was
+// canceled since its account or region timed out
+func isAWSScopeTimeout(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == request.CanceledErrorCode
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// awsTransitGatewayInterfaceType is the type of the network interfaces
+	// transit gateway attachments put in the subnets of a VPC
+	awsTransitGatewayInterfaceType = "transit_gateway"
+
+	// awsMaxTransitGatewayRoutes is the maximum number of routes returned
+	// by one search, which isn't paginated
+	awsMaxTransitGatewayRoutes = 1000
+)
+
+type awsTransitGateway struct {
+	owner           string
+	id              string
+	location        string
+	name            string
+	attachments     []*TransitGatewayAttachment
+	blackholeRoutes []*TransitGatewayRoute
+}
+
+func (g *awsTransitGateway) CSP() CSP {
+	return AWS
+}
+
+func (g *awsTransitGateway) Owner() string {
+	return g.owner
+}
+
+func (g *awsTransitGateway) ID() string {
+	return g.id
+}
+
+func (g *awsTransitGateway) Location() string {
+	return g.location
+}
+
+func (g *awsTransitGateway) Name() string {
+	return g.name
+}
+
+func (g *awsTransitGateway) Attachments() []*TransitGatewayAttachment {
+	return g.attachments
+}
+
+func (g *awsTransitGateway) BlackholeRoutes() []*TransitGatewayRoute {
+	return g.blackholeRoutes
+}
+
+func (g *awsTransitGateway) client() *awsEC2Client {
+	sess := NewAWSSession()
+	return newAWSEC2Client(sess, awsAccountCredentials(sess, g.owner), g.location)
+}
+
+func (g *awsTransitGateway) Detach(attachment *TransitGatewayAttachment) error {
+	log.Printf("Detaching %s from transit gateway %s in %s", attachment.ID, g.ID(), g.Owner())
+	return awsTryWithBackoff(func() error {
+		_, err := g.client().DeleteTransitGatewayVpcAttachment(&ec2.DeleteTransitGatewayVpcAttachmentInput{
+			TransitGatewayAttachmentId: aws.String(attachment.ID),
+		})
+		return err
+	})
+}
+
+func (g *awsTransitGateway) DeleteRoute(route *TransitGatewayRoute) error {
+	log.Printf("Deleting route to %s from %s of transit gateway %s in %s", route.Destination, route.RouteTableID, g.ID(), g.Owner())
+	return awsTryWithBackoff(func() error {
+		_, err := g.client().DeleteTransitGatewayRoute(&ec2.DeleteTransitGatewayRouteInput{
+			TransitGatewayRouteTableId: aws.String(route.RouteTableID),
+			DestinationCidrBlock:       aws.String(route.Destination),
+		})
+		return err
+	})
+}
+
+func (m *awsResourceManager) ForEachAccountTransitGateways(f func(string, []TransitGateway)) {
+	sess := NewAWSSession()
+	managed := make(map[string]bool)
+	for _, account := range m.accounts {
+		managed[account] = true
+	}
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		gateways := []TransitGateway{}
+		var gatewaysMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			regionGateways, err := getAWSTransitGateways(account, client)
+			if err != nil {
+				status.Warnf("Could not list transit gateways in %s of %s: %s", region, AccountDisplayName(account), err)
+				return
+			}
+			for _, gateway := range regionGateways {
+				for _, attachment := range gateway.attachments {
+					if !managed[attachment.NetworkOwner] {
+						continue
+					}
+					networkClient := client
+					if attachment.NetworkOwner != account {
+						networkClient = awsNetworkOwnerClient(sess, attachment.NetworkOwner, region)
+					}
+					setAWSAttachedNetwork(networkClient, attachment)
+				}
+			}
+			gatewaysMutex.Lock()
+			defer gatewaysMutex.Unlock()
+			for _, gateway := range regionGateways {
+				gateways = append(gateways, gateway)
+			}
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, gateways)
+	})
+}
+
+func awsNetworkOwnerClient(sess *session.Session, account, region string) *awsEC2Client {
+	return newAWSEC2Client(sess, awsAccountCredentials(sess, account), region)
+}
+
+// getAWSTransitGateways returns the transit gateways owned by the account
+// in the current region, with their VPC attachments and blackhole routes.
+// Gateways shared with the account are listed by their owner instead.
+func getAWSTransitGateways(account string, client *awsEC2Client) ([]*awsTransitGateway, error) {
+	region := client.region
+	gateways := []*awsTransitGateway{}
+	err := client.DescribeTransitGatewaysPages(&ec2.DescribeTransitGatewaysInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("owner-id"),
+			Values: aws.StringSlice([]string{account}),
+		}},
+	}, func(output *ec2.DescribeTransitGatewaysOutput, lastPage bool) bool {
+		for _, gateway := range output.TransitGateways {
+			if aws.StringValue(gateway.State) != ec2.TransitGatewayStateAvailable {
+				continue
+			}
+			gateways = append(gateways, &awsTransitGateway{
+				owner:    account,
+				id:       aws.StringValue(gateway.TransitGatewayId),
+				location: region,
+				name:     convertAWSTags(gateway.Tags)["Name"],
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, gateway := range gateways {
+		if gateway.attachments, err = getAWSTransitGatewayAttachments(client, gateway.id); err != nil {
+			return nil, err
+		}
+		if gateway.blackholeRoutes, err = getAWSBlackholeRoutes(client, gateway.id); err != nil {
+			return nil, err
+		}
+	}
+	return gateways, nil
+}
+
+func getAWSTransitGatewayAttachments(client *awsEC2Client, gatewayID string) ([]*TransitGatewayAttachment, error) {
+	attachments := []*TransitGatewayAttachment{}
+	err := client.DescribeTransitGatewayAttachmentsPages(&ec2.DescribeTransitGatewayAttachmentsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("transit-gateway-id"),
+			Values: aws.StringSlice([]string{gatewayID}),
+		}, {
+			Name:   aws.String("resource-type"),
+			Values: aws.StringSlice([]string{ec2.TransitGatewayAttachmentResourceTypeVpc}),
+		}, {
+			Name:   aws.String("state"),
+			Values: aws.StringSlice([]string{ec2.TransitGatewayAttachmentStateAvailable}),
+		}},
+	}, func(output *ec2.DescribeTransitGatewayAttachmentsOutput, lastPage bool) bool {
+		for _, attachment := range output.TransitGatewayAttachments {
+			attachments = append(attachments, &TransitGatewayAttachment{
+				ID:           aws.StringValue(attachment.TransitGatewayAttachmentId),
+				Tags:         convertAWSTags(attachment.Tags),
+				NetworkID:    aws.StringValue(attachment.ResourceId),
+				NetworkOwner: aws.StringValue(attachment.ResourceOwnerId),
+			})
+		}
+		return true
+	})
+	return attachments, err
+}
+
+// getAWSBlackholeRoutes returns the routes in the route tables of a
+// transit gateway whose attachment no longer exists
+func getAWSBlackholeRoutes(client *awsEC2Client, gatewayID string) ([]*TransitGatewayRoute, error) {
+	tableIDs := []string{}
+	err := client.DescribeTransitGatewayRouteTablesPages(&ec2.DescribeTransitGatewayRouteTablesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("transit-gateway-id"),
+			Values: aws.StringSlice([]string{gatewayID}),
+		}},
+	}, func(output *ec2.DescribeTransitGatewayRouteTablesOutput, lastPage bool) bool {
+		for _, table := range output.TransitGatewayRouteTables {
+			tableIDs = append(tableIDs, aws.StringValue(table.TransitGatewayRouteTableId))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	routes := []*TransitGatewayRoute{}
+	for _, tableID := range tableIDs {
+		output, err := client.SearchTransitGatewayRoutes(&ec2.SearchTransitGatewayRoutesInput{
+			TransitGatewayRouteTableId: aws.String(tableID),
+			Filters: []*ec2.Filter{{
+				Name:   aws.String("state"),
+				Values: aws.StringSlice([]string{ec2.TransitGatewayRouteStateBlackhole}),
+			}},
+			MaxResults: aws.Int64(awsMaxTransitGatewayRoutes),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if aws.BoolValue(output.AdditionalRoutesAvailable) {
+			log.Printf("Route table %s of transit gateway %s has more than %d blackhole routes, only the first are reported", tableID, gatewayID, awsMaxTransitGatewayRoutes)
+		}
+		for _, route := range output.Routes {
+			cidr := aws.StringValue(route.DestinationCidrBlock)
+			destination := cidr
+			if destination == "" {
+				destination = aws.StringValue(route.PrefixListId)
+			}
+			routes = append(routes, &TransitGatewayRoute{
+				RouteTableID: tableID,
+				Destination:  destination,
+				Static:       aws.StringValue(route.Type) == ec2.TransitGatewayRouteTypeStatic && cidr != "",
+			})
+		}
+	}
+	return routes, nil
+}
+
+// setAWSAttachedNetwork looks up if the VPC of an attachment still exists,
+// and how many network interfaces it has apart from the ones of transit
+// gateway attachments. If that can't be looked up, the VPC stays unknown.
+func setAWSAttachedNetwork(client *awsEC2Client, attachment *TransitGatewayAttachment) {
+	vpcFilter := []*ec2.Filter{{
+		Name:   aws.String("vpc-id"),
+		Values: aws.StringSlice([]string{attachment.NetworkID}),
+	}}
+	output, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: vpcFilter})
+	if err != nil {
+		status.Warnf("Could not look up VPC %s of attachment %s in %s: %s", attachment.NetworkID, attachment.ID, AccountDisplayName(attachment.NetworkOwner), err)
+		return
+	}
+	if len(output.Vpcs) == 0 {
+		attachment.NetworkKnown = true
+		return
+	}
+	interfaces := 0
+	err = client.DescribeNetworkInterfacesPages(&ec2.DescribeNetworkInterfacesInput{Filters: vpcFilter},
+		func(output *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+			for _, iface := range output.NetworkInterfaces {
+				if aws.StringValue(iface.InterfaceType) != awsTransitGatewayInterfaceType {
+					interfaces++
+				}
+			}
+			return true
+		})
+	if err != nil {
+		status.Warnf("Could not list the network interfaces of VPC %s in %s: %s", attachment.NetworkID, AccountDisplayName(attachment.NetworkOwner), err)
+		return
+	}
+	attachment.NetworkKnown = true
+	attachment.NetworkExists = true
+	attachment.NetworkInterfaces = interfaces
+}
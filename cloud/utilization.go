@@ -0,0 +1,161 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+const (
+	// awsUtilizationStatistic is the percentile of the utilization of
+	// every day
+	awsUtilizationStatistic = "p95"
+	// awsAgentNamespace is where the CloudWatch agent reports metrics
+	awsAgentNamespace = "CWAgent"
+)
+
+// awsAgentMemoryMetrics are the metrics with the percent of memory used
+// which the CloudWatch agent reports, on Linux and Windows
+var awsAgentMemoryMetrics = []string{"mem_used_percent", "Memory % Committed Bytes In Use"}
+
+// awsAgentGPUMetrics are the metrics with the percent of the time a GPU
+// was busy, which the CloudWatch agent reports from nvidia-smi, or from
+// a DCGM exporter it scrapes. There is one metric per GPU.
+var awsAgentGPUMetrics = []string{"nvidia_smi_utilization_gpu", "DCGM_FI_DEV_GPU_UTIL"}
+
+// Utilization looks up the CPU utilization of the instance, and the memory
+// used if the CloudWatch agent reports it
+func (i *awsInstance) Utilization(days int) (Utilization, error) {
+	cw := awsCloudWatchClient(i.Owner(), i.Location())
+	utilization := Utilization{}
+	instanceDimension := &cloudwatch.Dimension{Name: aws.String("InstanceId"), Value: aws.String(i.ID())}
+	cpu, found, err := awsBusiestDayP95(cw, "AWS/EC2", "CPUUtilization", []*cloudwatch.Dimension{instanceDimension}, days)
+	if err != nil {
+		return utilization, err
+	}
+	if !found {
+		return utilization, fmt.Errorf("no CPU utilization in the last %d days", days)
+	}
+	utilization.CPUPercentP95 = cpu
+	for _, metric := range awsAgentMemoryMetrics {
+		metrics, err := awsAgentInstanceMetrics(cw, metric, instanceDimension)
+		if err != nil {
+			return utilization, err
+		}
+		for _, m := range metrics {
+			memory, found, err := awsBusiestDayP95(cw, awsAgentNamespace, metric, m.Dimensions, days)
+			if err != nil {
+				return utilization, err
+			}
+			if found && (!utilization.MemoryKnown || memory > utilization.MemoryPercentP95) {
+				utilization.MemoryPercentP95, utilization.MemoryKnown = memory, true
+			}
+		}
+	}
+	return utilization, nil
+}
+
+// GPUUtilization looks up the highest CPU utilization of the instance in
+// any of the last hours, and that of its busiest GPU if the CloudWatch
+// agent reports it
+func (i *awsInstance) GPUUtilization(hours int) (GPUUtilization, error) {
+	cw := awsCloudWatchClient(i.Owner(), i.Location())
+	utilization := GPUUtilization{}
+	instanceDimension := &cloudwatch.Dimension{Name: aws.String("InstanceId"), Value: aws.String(i.ID())}
+	cpu, found, err := awsBusiestHourMaximum(cw, "AWS/EC2", "CPUUtilization", []*cloudwatch.Dimension{instanceDimension}, hours)
+	if err != nil {
+		return utilization, err
+	}
+	if !found {
+		return utilization, fmt.Errorf("no CPU utilization in the last %d hours", hours)
+	}
+	utilization.CPUPercentMax = cpu
+	for _, metric := range awsAgentGPUMetrics {
+		metrics, err := awsAgentInstanceMetrics(cw, metric, instanceDimension)
+		if err != nil {
+			return utilization, err
+		}
+		for _, m := range metrics {
+			gpu, found, err := awsBusiestHourMaximum(cw, awsAgentNamespace, metric, m.Dimensions, hours)
+			if err != nil {
+				return utilization, err
+			}
+			if found && (!utilization.GPUKnown || gpu > utilization.GPUPercentMax) {
+				utilization.GPUPercentMax, utilization.GPUKnown = gpu, true
+			}
+		}
+	}
+	return utilization, nil
+}
+
+// awsAgentInstanceMetrics returns the metrics the CloudWatch agent reports
+// with the specified name for an instance. The agent may add dimensions,
+// such as the image and type of the instance, or the index of a GPU, so
+// the metrics are looked up by the instance only.
+func awsAgentInstanceMetrics(cw *cloudwatch.CloudWatch, metric string, instanceDimension *cloudwatch.Dimension) ([]*cloudwatch.Metric, error) {
+	var metrics []*cloudwatch.Metric
+	err := cw.ListMetricsPages(&cloudwatch.ListMetricsInput{
+		Namespace:  aws.String(awsAgentNamespace),
+		MetricName: aws.String(metric),
+		Dimensions: []*cloudwatch.DimensionFilter{{Name: instanceDimension.Name, Value: instanceDimension.Value}},
+	}, func(page *cloudwatch.ListMetricsOutput, lastPage bool) bool {
+		metrics = append(metrics, page.Metrics...)
+		return true
+	})
+	return metrics, err
+}
+
+// awsBusiestHourMaximum returns the highest value of a metric in the last
+// hours, or false if there is no data
+func awsBusiestHourMaximum(cw *cloudwatch.CloudWatch, namespace, metric string, dimensions []*cloudwatch.Dimension, hours int) (float64, bool, error) {
+	output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String(namespace),
+		MetricName: aws.String(metric),
+		Dimensions: dimensions,
+		StartTime:  aws.Time(time.Now().Add(-time.Duration(hours) * time.Hour)),
+		EndTime:    aws.Time(time.Now()),
+		Period:     aws.Int64(60 * 60),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticMaximum}),
+	})
+	if err != nil {
+		return 0.0, false, err
+	}
+	busiest, found := 0.0, false
+	for _, datapoint := range output.Datapoints {
+		if datapoint.Maximum != nil && (!found || *datapoint.Maximum > busiest) {
+			busiest, found = *datapoint.Maximum, true
+		}
+	}
+	return busiest, found, nil
+}
+
+// awsBusiestDayP95 returns the highest daily 95th percentile of a metric
+// in the last days, or false if there is no data
+func awsBusiestDayP95(cw *cloudwatch.CloudWatch, namespace, metric string, dimensions []*cloudwatch.Dimension, days int) (float64, bool, error) {
+	output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:          aws.String(namespace),
+		MetricName:         aws.String(metric),
+		Dimensions:         dimensions,
+		StartTime:          aws.Time(time.Now().AddDate(0, 0, -days)),
+		EndTime:            aws.Time(time.Now()),
+		Period:             aws.Int64(24 * 60 * 60),
+		ExtendedStatistics: aws.StringSlice([]string{awsUtilizationStatistic}),
+	})
+	if err != nil {
+		return 0.0, false, err
+	}
+	busiest, found := 0.0, false
+	for _, datapoint := range output.Datapoints {
+		if value, exist := datapoint.ExtendedStatistics[awsUtilizationStatistic]; exist && value != nil {
+			if !found || *value > busiest {
+				busiest, found = *value, true
+			}
+		}
+	}
+	return busiest, found, nil
+}
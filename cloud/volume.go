@@ -8,9 +8,14 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/agaridata/cloudsweeper/status"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -50,10 +55,27 @@ func cleanupVolumes(volumes []Volume) error {
 	return cleanupResources(resList)
 }
 
+// VolumeAttachments is implemented by volumes which know the instances
+// they are attached to. Use a type assertion on the Volume to check for
+// support.
+type VolumeAttachments interface {
+	// AttachedInstanceIDs returns the IDs of the instances the volume is
+	// attached to
+	AttachedInstanceIDs() []string
+}
+
 // AWS
 
 type awsVolume struct {
 	baseVolume
+	instanceIDs []string
+	// staleTags is true if the tags were read from an AWS Config
+	// aggregator, and may be out of date
+	staleTags bool
+}
+
+func (v *awsVolume) AttachedInstanceIDs() []string {
+	return v.instanceIDs
 }
 
 func (v *awsVolume) Cleanup() error {
@@ -84,6 +106,50 @@ func (v *awsVolume) RemoveTag(key string) error {
 	return removeAWSTag(v, key)
 }
 
+// awsSnapshotWaitAttempts is how many times to check if the snapshot of
+// a volume is completed, 15 seconds apart. Large volumes can take hours.
+const awsSnapshotWaitAttempts = 960
+
+// CopyEncrypted will snapshot the volume, copy the snapshot with
+// encryption enabled and then remove the unencrypted snapshot. Copies are
+// made asynchronously, so the unencrypted snapshot is only removed once
+// the copy is completed, and is left if the copy fails.
+func (v *awsVolume) CopyEncrypted(tags map[string]string) (string, error) {
+	log.Printf("Creating encrypted snapshot of volume %s in %s", v.ID(), v.Owner())
+	client := clientForAWSResource(v)
+	snapshot, err := client.CreateSnapshot(&ec2.CreateSnapshotInput{
+		Description: aws.String(fmt.Sprintf("Cloudsweeper snapshot of %s", v.ID())),
+		VolumeId:    aws.String(v.ID()),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := waitForAWSSnapshot(client, *snapshot.SnapshotId); err != nil {
+		return "", err
+	}
+	copyID, err := copyAWSSnapshotEncrypted(client, *snapshot.SnapshotId, fmt.Sprintf("Encrypted copy of %s", v.ID()), tags)
+	if err != nil {
+		return "", err
+	}
+	if err := waitForAWSSnapshot(client, copyID); err != nil {
+		status.Warnf("Keeping intermediate snapshot %s in %s, since its encrypted copy %s did not complete: %s", *snapshot.SnapshotId, v.Owner(), copyID, err)
+		return copyID, err
+	}
+	_, err = client.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: snapshot.SnapshotId})
+	if err != nil {
+		status.Warnf("Could not remove intermediate snapshot %s in %s: %s", *snapshot.SnapshotId, v.Owner(), err)
+	}
+	return copyID, nil
+}
+
+// waitForAWSSnapshot waits until a snapshot, or copy of a snapshot, is
+// completed
+func waitForAWSSnapshot(client *awsEC2Client, snapshotID string) error {
+	return client.WaitUntilSnapshotCompletedWithContext(aws.BackgroundContext(),
+		&ec2.DescribeSnapshotsInput{SnapshotIds: []*string{aws.String(snapshotID)}},
+		request.WithWaiterMaxAttempts(awsSnapshotWaitAttempts))
+}
+
 // GCP
 
 type gcpVolume struct {
@@ -98,6 +164,7 @@ func (v *gcpVolume) Cleanup() error {
 }
 
 func (v *gcpVolume) SetTag(key, value string, overwrite bool) error {
+	key, value = NormalizeTag(GCP, key, value)
 	disk, err := v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
 	if err != nil {
 		return err
@@ -123,6 +190,7 @@ func (v *gcpVolume) SetTag(key, value string, overwrite bool) error {
 }
 
 func (v *gcpVolume) RemoveTag(key string) error {
+	key, _ = NormalizeTag(GCP, key, "")
 	newLabels := make(map[string]string)
 	for k, val := range v.tags {
 		if k != key {
@@ -144,3 +212,100 @@ func (v *gcpVolume) RemoveTag(key string) error {
 	v.tags = newLabels
 	return nil
 }
+
+// Kubernetes
+
+type kubernetesVolume struct {
+	baseVolume
+	client *kubernetesClient
+	path   string
+}
+
+// Cleanup will delete this persistent volume. Depending on its reclaim
+// policy, the underlying disk might have to be deleted separately.
+func (v *kubernetesVolume) Cleanup() error {
+	log.Printf("Cleaning up persistent volume %s in %s", v.ID(), v.Location())
+	return v.client.delete(v.path)
+}
+
+func (v *kubernetesVolume) SetTag(key, value string, overwrite bool) error {
+	return addKubernetesTag(v.client, v.path, v, key, value, overwrite)
+}
+
+func (v *kubernetesVolume) RemoveTag(key string) error {
+	return removeKubernetesTag(v.client, v.path, v, key)
+}
+
+// vSphere
+
+type vsphereVolume struct {
+	baseVolume
+	client     *vsphereClient
+	datacenter *object.Datacenter
+	datastore  *object.Datastore
+}
+
+// Cleanup will delete this VMDK, and the file with its tags
+func (v *vsphereVolume) Cleanup() error {
+	log.Printf("Cleaning up VMDK %s in %s", v.ID(), v.Owner())
+	ctx := v.client.context()
+	c, err := v.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+	task, err := object.NewVirtualDiskManager(c).DeleteVirtualDisk(ctx, v.ID(), v.datacenter)
+	if err != nil {
+		return err
+	}
+	if err := task.Wait(ctx); err != nil {
+		return err
+	}
+	if len(v.tags) == 0 {
+		return nil
+	}
+	task, err = object.NewFileManager(c).DeleteDatastoreFile(ctx, v.ID()+vsphereTagsSuffix, v.datacenter)
+	if err != nil {
+		return err
+	}
+	if err := task.Wait(ctx); err != nil && !types.IsFileNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (v *vsphereVolume) SetTag(key, value string, overwrite bool) error {
+	if _, exist := v.tags[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, v.ID())
+	}
+	return v.writeTags(key, &value)
+}
+
+func (v *vsphereVolume) RemoveTag(key string) error {
+	if _, exist := v.tags[key]; !exist {
+		return nil
+	}
+	return v.writeTags(key, nil)
+}
+
+// writeTags sets, or removes if value is nil, a tag in the file next to
+// the VMDK which holds its tags
+func (v *vsphereVolume) writeTags(key string, value *string) error {
+	tags := make(map[string]string, len(v.tags)+1)
+	for k, val := range v.tags {
+		tags[k] = val
+	}
+	if value != nil {
+		tags[key] = *value
+	} else {
+		delete(tags, key)
+	}
+	ctx := v.client.context()
+	if _, err := v.client.connect(ctx); err != nil {
+		return err
+	}
+	if err := writeVSphereDiskTags(ctx, v.datastore, v.ID(), tags); err != nil {
+		return err
+	}
+	v.tags = tags
+	return nil
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	awsVPNKindClient     = "Client VPN"
+	awsVPNKindSiteToSite = "Site-to-Site VPN"
+
+	// awsClientVPNDisassociateWait is how long to wait for the target
+	// networks of a Client VPN endpoint to be disassociated, before
+	// deleting the endpoint
+	awsClientVPNDisassociateWait = 10 * time.Minute
+
+	awsTunnelStatusUp = "UP"
+)
+
+// awsVPNUsageMetrics are the CloudWatch metrics with the usage of every
+// kind of VPN, with the dimension the VPN is identified by and the
+// statistic which is above zero on days it's used
+var awsVPNUsageMetrics = map[string]struct {
+	namespace, dimension, statistic string
+	metrics                         []string
+}{
+	awsVPNKindClient:     {"AWS/ClientVPN", "Endpoint", cloudwatch.StatisticMaximum, []string{"ActiveConnectionsCount"}},
+	awsVPNKindSiteToSite: {"AWS/VPN", "VpnId", cloudwatch.StatisticSum, []string{"TunnelDataIn", "TunnelDataOut"}},
+}
+
+// awsClientVPNCreationTimeFormat is the format of the creation time of
+// Client VPN endpoints, which is a string without a time zone in UTC
+const awsClientVPNCreationTimeFormat = "2006-01-02T15:04:05"
+
+type baseVPN struct {
+	baseResource
+	name         string
+	kind         string
+	associations int
+	lastUsed     time.Time
+}
+
+func (v *baseVPN) Name() string {
+	return v.name
+}
+
+func (v *baseVPN) Kind() string {
+	return v.kind
+}
+
+func (v *baseVPN) Associations() int {
+	return v.associations
+}
+
+func (v *baseVPN) LastUsed() time.Time {
+	return v.lastUsed
+}
+
+// AWS
+
+type awsVPN interface {
+	VPN
+	setLastUsed(time.Time)
+}
+
+func (v *baseVPN) setLastUsed(t time.Time) {
+	v.lastUsed = t
+}
+
+type awsClientVPN struct {
+	baseVPN
+}
+
+func (v *awsClientVPN) Cleanup() error {
+	log.Printf("Cleaning up Client VPN endpoint %s in %s", v.ID(), v.Owner())
+	client := clientForAWSResource(v)
+	associations, err := awsClientVPNAssociations(client, v.ID())
+	if err != nil {
+		return err
+	}
+	for _, associationID := range associations {
+		log.Printf("Disassociating target network %s of Client VPN endpoint %s in %s", associationID, v.ID(), v.Owner())
+		_, err := client.DisassociateClientVpnTargetNetwork(&ec2.DisassociateClientVpnTargetNetworkInput{
+			ClientVpnEndpointId: aws.String(v.ID()),
+			AssociationId:       aws.String(associationID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(awsClientVPNDisassociateWait)
+	for len(associations) > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The target networks of %s were not disassociated within %s", v.ID(), awsClientVPNDisassociateWait)
+		}
+		time.Sleep(10 * time.Second)
+		associations, err = awsClientVPNAssociations(client, v.ID())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = client.DeleteClientVpnEndpoint(&ec2.DeleteClientVpnEndpointInput{
+		ClientVpnEndpointId: aws.String(v.ID()),
+	})
+	return err
+}
+
+func (v *awsClientVPN) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(v, key, value, overwrite)
+}
+
+func (v *awsClientVPN) RemoveTag(key string) error {
+	return removeAWSTag(v, key)
+}
+
+type awsSiteToSiteVPN struct {
+	baseVPN
+	// tunnelUp is true if any tunnel of the connection is up
+	tunnelUp bool
+}
+
+func (v *awsSiteToSiteVPN) Cleanup() error {
+	log.Printf("Cleaning up VPN connection %s in %s", v.ID(), v.Owner())
+	_, err := clientForAWSResource(v).DeleteVpnConnection(&ec2.DeleteVpnConnectionInput{
+		VpnConnectionId: aws.String(v.ID()),
+	})
+	return err
+}
+
+func (v *awsSiteToSiteVPN) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(v, key, value, overwrite)
+}
+
+func (v *awsSiteToSiteVPN) RemoveTag(key string) error {
+	return removeAWSTag(v, key)
+}
+
+func (m *awsResourceManager) ForEachAccountVPNs(usageDays int, f func(string, []VPN)) {
+	sess := NewAWSSession()
+	var funcMutex sync.Mutex // f must never be called concurrently
+	forEachAccount(m.accounts, m.parallelism, sess, func(account string, cred *credentials.Credentials) {
+		vpns := []VPN{}
+		var vpnsMutex sync.Mutex
+		forEachEC2Client(sess, account, cred, func(client *awsEC2Client) {
+			region := client.region
+			regionVPNs := []awsVPN{}
+			clientVPNs, err := getAWSClientVPNs(account, client)
+			if err != nil {
+				status.Warnf("Could not list Client VPN endpoints in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			for _, vpn := range clientVPNs {
+				regionVPNs = append(regionVPNs, vpn)
+			}
+			connections, err := getAWSSiteToSiteVPNs(account, client)
+			if err != nil {
+				status.Warnf("Could not list VPN connections in %s of %s: %s", region, AccountDisplayName(account), err)
+			}
+			for _, vpn := range connections {
+				if vpn.tunnelUp {
+					// Traffic is only reported once a tunnel is up, so
+					// the connection is in use right now
+					vpn.setLastUsed(time.Now())
+				}
+				regionVPNs = append(regionVPNs, vpn)
+			}
+			cw := cloudwatch.New(sess, &aws.Config{Credentials: cred, Region: aws.String(client.region)})
+			for _, vpn := range regionVPNs {
+				if vpn.LastUsed().IsZero() {
+					setAWSVPNLastUsed(cw, vpn, usageDays)
+				}
+			}
+			vpnsMutex.Lock()
+			defer vpnsMutex.Unlock()
+			for _, vpn := range regionVPNs {
+				vpns = append(vpns, vpn)
+			}
+		})
+		funcMutex.Lock()
+		defer funcMutex.Unlock()
+		f(account, vpns)
+	})
+}
+
+// getAWSClientVPNs will get all Client VPN endpoints in the current
+// region, with the number of target networks associated with each
+func getAWSClientVPNs(account string, client *awsEC2Client) ([]*awsClientVPN, error) {
+	region := client.region
+	vpns := []*awsClientVPN{}
+	err := client.DescribeClientVpnEndpointsPages(&ec2.DescribeClientVpnEndpointsInput{},
+		func(output *ec2.DescribeClientVpnEndpointsOutput, lastPage bool) bool {
+			for _, endpoint := range output.ClientVpnEndpoints {
+				if endpoint.Status != nil {
+					code := aws.StringValue(endpoint.Status.Code)
+					if code == ec2.ClientVpnEndpointStatusCodeDeleting || code == ec2.ClientVpnEndpointStatusCodeDeleted {
+						continue
+					}
+				}
+				tags := convertAWSTags(endpoint.Tags)
+				creationTime, _ := time.Parse(awsClientVPNCreationTimeFormat, aws.StringValue(endpoint.CreationTime))
+				vpns = append(vpns, &awsClientVPN{baseVPN{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						id:           aws.StringValue(endpoint.ClientVpnEndpointId),
+						location:     region,
+						tags:         tags,
+						creationTime: creationTime,
+					},
+					name: tags["Name"],
+					kind: awsVPNKindClient,
+				}})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, vpn := range vpns {
+		associations, err := awsClientVPNAssociations(client, vpn.ID())
+		if err != nil {
+			return nil, err
+		}
+		vpn.associations = len(associations)
+	}
+	return vpns, nil
+}
+
+// awsClientVPNAssociations returns the IDs of the associations of target
+// networks with a Client VPN endpoint, which are billed while they exist
+func awsClientVPNAssociations(client *awsEC2Client, endpointID string) ([]string, error) {
+	associations := []string{}
+	err := client.DescribeClientVpnTargetNetworksPages(&ec2.DescribeClientVpnTargetNetworksInput{
+		ClientVpnEndpointId: aws.String(endpointID),
+	}, func(output *ec2.DescribeClientVpnTargetNetworksOutput, lastPage bool) bool {
+		for _, network := range output.ClientVpnTargetNetworks {
+			if network.Status != nil && aws.StringValue(network.Status.Code) == ec2.AssociationStatusCodeDisassociated {
+				continue
+			}
+			associations = append(associations, aws.StringValue(network.AssociationId))
+		}
+		return true
+	})
+	return associations, err
+}
+
+// getAWSSiteToSiteVPNs will get all VPN connections in the current
+// region. VPN connections don't have a creation time.
+func getAWSSiteToSiteVPNs(account string, client *awsEC2Client) ([]*awsSiteToSiteVPN, error) {
+	region := client.region
+	output, err := client.DescribeVpnConnections(&ec2.DescribeVpnConnectionsInput{})
+	if err != nil {
+		return nil, err
+	}
+	vpns := []*awsSiteToSiteVPN{}
+	for _, connection := range output.VpnConnections {
+		state := aws.StringValue(connection.State)
+		if state == ec2.VpnStateDeleting || state == ec2.VpnStateDeleted {
+			continue
+		}
+		tags := convertAWSTags(connection.Tags)
+		vpn := &awsSiteToSiteVPN{
+			baseVPN: baseVPN{
+				baseResource: baseResource{
+					csp:      AWS,
+					owner:    account,
+					id:       aws.StringValue(connection.VpnConnectionId),
+					location: region,
+					tags:     tags,
+				},
+				name:         tags["Name"],
+				kind:         awsVPNKindSiteToSite,
+				associations: -1,
+			},
+		}
+		for _, telemetry := range connection.VgwTelemetry {
+			vpn.tunnelUp = vpn.tunnelUp || aws.StringValue(telemetry.Status) == awsTunnelStatusUp
+		}
+		vpns = append(vpns, vpn)
+	}
+	return vpns, nil
+}
+
+// setAWSVPNLastUsed sets the last day with connections or traffic on the
+// VPN, from the daily usage metrics of the last usageDays days. If the
+// metrics can't be read, the VPN is treated as in use.
+func setAWSVPNLastUsed(cw *cloudwatch.CloudWatch, vpn awsVPN, usageDays int) {
+	usage := awsVPNUsageMetrics[vpn.Kind()]
+	var lastUsed time.Time
+	for _, metric := range usage.metrics {
+		output, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String(usage.namespace),
+			MetricName: aws.String(metric),
+			Dimensions: []*cloudwatch.Dimension{{
+				Name:  aws.String(usage.dimension),
+				Value: aws.String(vpn.ID()),
+			}},
+			StartTime:  aws.Time(time.Now().AddDate(0, 0, -usageDays)),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int64(24 * 60 * 60),
+			Statistics: aws.StringSlice([]string{usage.statistic}),
+		})
+		if err != nil {
+			status.Warnf("Could not read the usage of %s in %s, treating it as in use: %s", vpn.ID(), AccountDisplayName(vpn.Owner()), err)
+			vpn.setLastUsed(time.Now())
+			return
+		}
+		for _, datapoint := range output.Datapoints {
+			value := aws.Float64Value(datapoint.Sum)
+			if usage.statistic == cloudwatch.StatisticMaximum {
+				value = aws.Float64Value(datapoint.Maximum)
+			}
+			if value > 0 && aws.TimeValue(datapoint.Timestamp).After(lastUsed) {
+				lastUsed = aws.TimeValue(datapoint.Timestamp)
+			}
+		}
+	}
+	vpn.setLastUsed(lastUsed)
+}
@@ -0,0 +1,737 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	// vsphereTagsSuffix is the suffix of the file next to an orphaned
+	// VMDK which holds its tags, as files can't have custom attributes
+	vsphereTagsSuffix = ".cloudsweeper"
+)
+
+// Folders of datastores holding disks which aren't attached to any VM
+// on purpose, such as the first class disks of the vSphere CSI driver,
+// and which are never considered orphaned
+var vsphereManagedDiskFolders = []string{"fcd/", ".sdd.sf/", ".vSphere-HA/", "contentlib-"}
+
+// VSphereServer describes how to access the SDK of a vCenter, or of
+// a standalone ESXi host.
+type VSphereServer struct {
+	// URL of the SDK, e.g. https://vcenter.lab.example.com/sdk
+	URL string `json:"url"`
+	// Username of a user allowed to read, power off and destroy VMs,
+	// remove snapshots, set custom attributes and browse datastores.
+	Username string `json:"username"`
+	// PasswordFile is a file containing the password of the user
+	PasswordFile string `json:"password_file"`
+	// CAFile is a PEM file with the certificate authority of the
+	// server. The system roots are used if it's empty.
+	CAFile string `json:"ca_file,omitempty"`
+	// Insecure skips verifying the certificate of the server, e.g. for
+	// labs using self-signed certificates.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// vsphereResourceManager talks to the SDK of every vCenter, using
+// govmomi. VMs are instances, VMDKs in datastores which no VM uses are
+// volumes, and VM snapshots are snapshots. Every vCenter is an account,
+// owning everything in it. Cloudsweeper tags are stored as custom
+// attributes of VMs, in the description of snapshots, and in a file next
+// to orphaned VMDKs. API docs can be found at:
+// https://developer.vmware.com/apis/vsphere-automation/latest/
+type vsphereResourceManager struct {
+	servers     []string
+	clients     map[string]*vsphereClient
+	parallelism int
+	types       *resourceTypeSwitches
+	// timeouts bounds how long a vCenter may be listed. Scopes are
+	// identified by the client of the vCenter.
+	timeouts *scopeTimeouts
+}
+
+func newVSphereManager(conf *ManagerConfig, accounts ...string) (ResourceManager, error) {
+	log.Println("Initializing vSphere Resource Manager")
+	manager := &vsphereResourceManager{
+		servers:     accounts,
+		clients:     make(map[string]*vsphereClient, len(accounts)),
+		parallelism: conf.AccountParallelism,
+		types:       newResourceTypeSwitches(conf),
+		timeouts:    newScopeTimeouts(conf.Context, conf.AccountTimeout, 0),
+	}
+	for _, server := range accounts {
+		serverConf, exist := conf.VSphereServers[server]
+		if !exist {
+			return nil, fmt.Errorf("No configuration for vSphere server %s", server)
+		}
+		client, err := newVSphereClient(server, serverConf)
+		if err != nil {
+			return nil, err
+		}
+		client.timeouts = manager.timeouts
+		manager.clients[server] = client
+	}
+	return manager, nil
+}
+
+func (m *vsphereResourceManager) Owners() []string {
+	return m.servers
+}
+
+func (m *vsphereResourceManager) InstancesPerAccount() map[string][]Instance {
+	result := make(map[string][]Instance)
+	for owner, collection := range m.collect() {
+		result[owner] = collection.Instances
+	}
+	return result
+}
+
+func (m *vsphereResourceManager) ImagesPerAccount() map[string][]Image {
+	return make(map[string][]Image)
+}
+
+func (m *vsphereResourceManager) VolumesPerAccount() map[string][]Volume {
+	result := make(map[string][]Volume)
+	for owner, collection := range m.collect() {
+		result[owner] = collection.Volumes
+	}
+	return result
+}
+
+func (m *vsphereResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
+	result := make(map[string][]Snapshot)
+	for owner, collection := range m.collect() {
+		result[owner] = collection.Snapshots
+	}
+	return result
+}
+
+func (m *vsphereResourceManager) BucketsPerAccount() map[string][]Bucket {
+	return make(map[string][]Bucket)
+}
+
+func (m *vsphereResourceManager) AllResourcesPerAccount() map[string]*ResourceCollection {
+	result := make(map[string]*ResourceCollection)
+	for owner, collection := range m.collect() {
+		result[owner] = &ResourceCollection{
+			Owner:     owner,
+			Instances: collection.Instances,
+			Volumes:   collection.Volumes,
+			Snapshots: collection.Snapshots,
+		}
+	}
+	return result
+}
+
+func (m *vsphereResourceManager) ForEachAccountResources(f func(*AllResourceCollection)) {
+	log.Println("Going through all resources in all vSphere servers")
+	for _, collection := range m.collect() {
+		f(collection)
+	}
+}
+
+func (m *vsphereResourceManager) ForEachInstance(f func(Instance)) {
+	for _, collection := range m.collect() {
+		for i := range collection.Instances {
+			f(collection.Instances[i])
+		}
+	}
+}
+
+func (m *vsphereResourceManager) ForEachImage(f func(Image)) {}
+
+func (m *vsphereResourceManager) ForEachVolume(f func(Volume)) {
+	for _, collection := range m.collect() {
+		for i := range collection.Volumes {
+			f(collection.Volumes[i])
+		}
+	}
+}
+
+func (m *vsphereResourceManager) ForEachSnapshot(f func(Snapshot)) {
+	for _, collection := range m.collect() {
+		for i := range collection.Snapshots {
+			f(collection.Snapshots[i])
+		}
+	}
+}
+
+func (m *vsphereResourceManager) ForEachBucket(f func(Bucket)) {}
+
+func (m *vsphereResourceManager) ForEachResource(f func(Resource)) {
+	for _, collection := range m.collect() {
+		for _, res := range collection.Resources() {
+			f(res)
+		}
+	}
+}
+
+func (m *vsphereResourceManager) CleanupInstances(instances []Instance) error {
+	return cleanupInstances(instances)
+}
+
+func (m *vsphereResourceManager) CleanupImages(images []Image) error {
+	return cleanupImages(images)
+}
+
+func (m *vsphereResourceManager) CleanupVolumes(volumes []Volume) error {
+	return cleanupVolumes(volumes)
+}
+
+func (m *vsphereResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
+	return cleanupSnapshots(snapshots)
+}
+
+func (m *vsphereResourceManager) CleanupBuckets(buckets []Bucket) error {
+	return cleanupBuckets(buckets)
+}
+
+// collect will list the resources of all vCenters. At most parallelism
+// vCenters are listed at the same time. Resources of types disabled for
+// their owner are left out.
+func (m *vsphereResourceManager) collect() map[string]*AllResourceCollection {
+	result := make(map[string]*AllResourceCollection)
+	var resultMutex sync.Mutex
+	var wg sync.WaitGroup
+	limit := newLimiter(m.parallelism)
+	for _, server := range m.servers {
+		wg.Add(1)
+		go func(client *vsphereClient) {
+			defer wg.Done()
+			limit.acquire()
+			defer limit.release()
+			var collection *AllResourceCollection
+			var err error
+			m.timeouts.runAccount(client, "vSphere server "+client.server, func() {
+				collection, err = m.serverResources(client)
+				if err != nil && m.timeouts.expired(client, "") {
+					// The run continues without the vCenter
+					collection, err = nil, nil
+				}
+			})
+			if err != nil {
+				status.DiscoveryFailedf("Could not list resources in vSphere server %s: %s", client.server, err)
+				return
+			}
+			if collection == nil {
+				return
+			}
+			m.types.filter(collection)
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			result[client.server] = collection
+		}(m.clients[server])
+	}
+	wg.Wait()
+	return result
+}
+
+// serverResources will list all sweepable resources in every
+// datacenter of a vCenter
+func (m *vsphereResourceManager) serverResources(client *vsphereClient) (*AllResourceCollection, error) {
+	ctx := client.context()
+	c, err := client.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fieldNames, err := vsphereFieldNames(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	datacenters, err := find.NewFinder(c, false).DatacenterList(ctx, "*")
+	if err != nil {
+		return nil, err
+	}
+	collection := &AllResourceCollection{Owner: client.server}
+	for _, dc := range datacenters {
+		var vms []mo.VirtualMachine
+		if err := vsphereRetrieve(ctx, c, dc, "VirtualMachine", []string{"name", "config", "snapshot", "layoutEx", "customValue"}, &vms); err != nil {
+			return nil, err
+		}
+		var datastores []mo.Datastore
+		if err := vsphereRetrieve(ctx, c, dc, "Datastore", []string{"name", "browser"}, &datastores); err != nil {
+			return nil, err
+		}
+
+		// Every file of every VM, including templates, is in use. That
+		// includes the disks of all its snapshots.
+		used := make(map[string]bool)
+		for _, vm := range vms {
+			if vm.LayoutEx == nil {
+				continue
+			}
+			for _, file := range vm.LayoutEx.File {
+				used[file.Name] = true
+			}
+		}
+
+		for i := range vms {
+			vm := &vms[i]
+			if vm.Config == nil || vm.Config.Template {
+				continue
+			}
+			collection.Instances = append(collection.Instances, newVSphereInstance(client, dc, vm, fieldNames))
+			if vm.Snapshot != nil {
+				collection.Snapshots = append(collection.Snapshots, vsphereSnapshots(client, dc, vm)...)
+			}
+		}
+		for i := range datastores {
+			ds := object.NewDatastore(c, datastores[i].Reference())
+			ds.InventoryPath = dc.InventoryPath + "/datastore/" + datastores[i].Name
+			ds.DatacenterPath = dc.InventoryPath
+			volumes, err := vsphereOrphanedDisks(ctx, client, dc, ds, &datastores[i], used)
+			if err != nil {
+				return nil, err
+			}
+			collection.Volumes = append(collection.Volumes, volumes...)
+		}
+	}
+	recordResources(VSphere, ResourceTypeInstances, len(collection.Instances))
+	recordResources(VSphere, ResourceTypeVolumes, len(collection.Volumes))
+	recordResources(VSphere, ResourceTypeSnapshots, len(collection.Snapshots))
+	return collection, nil
+}
+
+// vsphereRetrieve will retrieve the specified properties of all managed
+// objects of a kind in a datacenter
+func vsphereRetrieve(ctx context.Context, c *vim25.Client, dc *object.Datacenter, kind string, props []string, dst interface{}) error {
+	v, err := view.NewManager(c).CreateContainerView(ctx, dc.Reference(), []string{kind}, true)
+	if err != nil {
+		return err
+	}
+	defer v.Destroy(ctx)
+	return v.Retrieve(ctx, []string{kind}, props, dst)
+}
+
+// vsphereFieldNames returns the names of all custom attributes by their
+// key. Standalone ESXi hosts don't have custom attributes.
+func vsphereFieldNames(ctx context.Context, c *vim25.Client) (map[int32]string, error) {
+	names := make(map[int32]string)
+	if c.ServiceContent.CustomFieldsManager == nil {
+		return names, nil
+	}
+	fields, err := object.NewCustomFieldsManager(c).Field(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		names[field.Key] = field.Name
+	}
+	return names, nil
+}
+
+func newVSphereInstance(client *vsphereClient, dc *object.Datacenter, vm *mo.VirtualMachine, fieldNames map[int32]string) *vsphereInstance {
+	tags := make(map[string]string)
+	for _, value := range vm.CustomValue {
+		field, ok := value.(*types.CustomFieldStringValue)
+		// An empty value is how a custom attribute is removed
+		if !ok || field.Value == "" {
+			continue
+		}
+		if name, exist := fieldNames[field.Key]; exist {
+			tags[name] = field.Value
+		}
+	}
+	// VMs created before vSphere 6.7 don't have a creation date, those
+	// are aged from when their configuration was last changed
+	creationTime := vm.Config.Modified
+	if vm.Config.CreateDate != nil {
+		creationTime = *vm.Config.CreateDate
+	}
+	return &vsphereInstance{
+		baseInstance: baseInstance{
+			baseResource: baseResource{
+				csp:          VSphere,
+				owner:        client.server,
+				id:           vm.Reference().Value,
+				location:     dc.Name(),
+				creationTime: creationTime,
+				public:       false,
+				tags:         tags,
+			},
+			instanceType: fmt.Sprintf("%dvCPU-%dMB", vm.Config.Hardware.NumCPU, vm.Config.Hardware.MemoryMB),
+			platform:     vm.Config.GuestFullName,
+		},
+		client: client,
+		name:   vm.Name,
+		ref:    vm.Reference(),
+	}
+}
+
+// vsphereSnapshots will flatten the tree of snapshots of a VM. The size
+// of a snapshot is that of the delta disks it froze, plus its memory.
+func vsphereSnapshots(client *vsphereClient, dc *object.Datacenter, vm *mo.VirtualMachine) []Snapshot {
+	sizes := make(map[int32]int64)
+	layouts := make(map[string]types.VirtualMachineFileLayoutExSnapshotLayout)
+	if vm.LayoutEx != nil {
+		for _, file := range vm.LayoutEx.File {
+			sizes[file.Key] = file.Size
+		}
+		for _, layout := range vm.LayoutEx.Snapshot {
+			layouts[layout.Key.Value] = layout
+		}
+	}
+	current := ""
+	if vm.Snapshot.CurrentSnapshot != nil {
+		current = vm.Snapshot.CurrentSnapshot.Value
+	}
+	result := []Snapshot{}
+	var walk func([]types.VirtualMachineSnapshotTree)
+	walk = func(trees []types.VirtualMachineSnapshotTree) {
+		for _, tree := range trees {
+			bytes := int64(0)
+			if layout, exist := layouts[tree.Snapshot.Value]; exist {
+				bytes += sizes[layout.DataKey] + sizes[layout.MemoryKey]
+				for _, disk := range layout.Disk {
+					if len(disk.Chain) == 0 {
+						continue
+					}
+					for _, key := range disk.Chain[len(disk.Chain)-1].FileKey {
+						bytes += sizes[key]
+					}
+				}
+			}
+			result = append(result, &vsphereSnapshot{
+				baseSnapshot: baseSnapshot{
+					baseResource: baseResource{
+						csp:          VSphere,
+						owner:        client.server,
+						id:           tree.Snapshot.Value,
+						location:     dc.Name(),
+						creationTime: tree.CreateTime,
+						public:       false,
+						tags:         vsphereDescriptionTags(tree.Description),
+					},
+					inUse:  tree.Snapshot.Value == current,
+					sizeGB: vsphereGB(bytes),
+				},
+				client:      client,
+				ref:         tree.Snapshot,
+				name:        tree.Name,
+				description: tree.Description,
+			})
+			walk(tree.ChildSnapshotList)
+		}
+	}
+	walk(vm.Snapshot.RootSnapshotList)
+	return result
+}
+
+// vsphereOrphanedDisks will search a datastore for VMDKs which aren't
+// used by any VM
+func vsphereOrphanedDisks(ctx context.Context, client *vsphereClient, dc *object.Datacenter, ds *object.Datastore, dsMo *mo.Datastore, used map[string]bool) ([]Volume, error) {
+	browser := object.NewHostDatastoreBrowser(ds.Client(), dsMo.Browser)
+	disks, err := vsphereSearch(ctx, browser, dsMo.Name, &types.HostDatastoreBrowserSearchSpec{
+		Query: []types.BaseFileQuery{&types.VmDiskFileQuery{
+			Details: &types.VmDiskFileQueryFlags{DiskType: true, CapacityKb: true},
+		}},
+		Details:      &types.FileQueryFlags{FileType: true, FileSize: true, Modification: true},
+		MatchPattern: []string{"*.vmdk"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tagFiles, err := vsphereSearch(ctx, browser, dsMo.Name, &types.HostDatastoreBrowserSearchSpec{
+		MatchPattern: []string{"*" + vsphereTagsSuffix},
+	})
+	if err != nil {
+		return nil, err
+	}
+	hasTags := make(map[string]bool)
+	for path := range tagFiles {
+		hasTags[path] = true
+	}
+
+	volumes := []Volume{}
+	for path, info := range disks {
+		if used[path] || vsphereManagedDisk(path) {
+			continue
+		}
+		disk, ok := info.(*types.VmDiskFileInfo)
+		if !ok {
+			continue
+		}
+		tags := make(map[string]string)
+		if hasTags[path+vsphereTagsSuffix] {
+			tags, err = readVSphereDiskTags(ctx, ds, path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// When a disk was created isn't known, so it's aged from when it
+		// was last written to
+		creationTime := time.Time{}
+		if disk.Modification != nil {
+			creationTime = *disk.Modification
+		}
+		volumes = append(volumes, &vsphereVolume{
+			baseVolume: baseVolume{
+				baseResource: baseResource{
+					csp:          VSphere,
+					owner:        client.server,
+					id:           path,
+					location:     dc.Name(),
+					creationTime: creationTime,
+					public:       false,
+					tags:         tags,
+				},
+				sizeGB:     vsphereGB(disk.CapacityKb * 1024),
+				attached:   false,
+				volumeType: disk.DiskType,
+			},
+			client:     client,
+			datacenter: dc,
+			datastore:  ds,
+		})
+	}
+	return volumes, nil
+}
+
+// vsphereSearch will search all folders of a datastore, and return the
+// files found by their datastore path, e.g. "[ds1] vm1/vm1.vmdk"
+func vsphereSearch(ctx context.Context, browser *object.HostDatastoreBrowser, datastore string, spec *types.HostDatastoreBrowserSearchSpec) (map[string]types.BaseFileInfo, error) {
+	task, err := browser.SearchDatastoreSubFolders(ctx, fmt.Sprintf("[%s]", datastore), spec)
+	if err != nil {
+		return nil, err
+	}
+	info, err := task.WaitForResult(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]types.BaseFileInfo)
+	results, ok := info.Result.(types.ArrayOfHostDatastoreBrowserSearchResults)
+	if !ok {
+		return files, nil
+	}
+	for _, result := range results.HostDatastoreBrowserSearchResults {
+		var folder object.DatastorePath
+		if !folder.FromString(result.FolderPath) {
+			continue
+		}
+		for _, file := range result.File {
+			path := object.DatastorePath{
+				Datastore: folder.Datastore,
+				Path:      strings.TrimPrefix(strings.TrimSuffix(folder.Path, "/")+"/"+file.GetFileInfo().Path, "/"),
+			}
+			files[path.String()] = file
+		}
+	}
+	return files, nil
+}
+
+func vsphereManagedDisk(path string) bool {
+	var dsPath object.DatastorePath
+	if !dsPath.FromString(path) {
+		return false
+	}
+	for _, folder := range vsphereManagedDiskFolders {
+		if strings.HasPrefix(dsPath.Path, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// vsphereGB converts bytes to whole GB, rounded up
+func vsphereGB(bytes int64) int64 {
+	return (bytes + 1e9 - 1) / 1e9
+}
+
+// vsphereDescriptionTags parses the tags in the description of a
+// snapshot, which are lines of the form key=value
+func vsphereDescriptionTags(description string) map[string]string {
+	tags := make(map[string]string)
+	for _, line := range strings.Split(description, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 && parts[0] != "" && !strings.ContainsAny(parts[0], " \t") {
+			tags[parts[0]] = parts[1]
+		}
+	}
+	return tags
+}
+
+// vsphereDescriptionWithTag sets a tag in the description of a snapshot,
+// keeping the rest of it, or removes the tag if value is nil
+func vsphereDescriptionWithTag(description, key string, value *string) string {
+	lines := []string{}
+	for _, line := range strings.Split(description, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), key+"=") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if value != nil {
+		lines = append(lines, key+"="+*value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func readVSphereDiskTags(ctx context.Context, ds *object.Datastore, path string) (map[string]string, error) {
+	var dsPath object.DatastorePath
+	dsPath.FromString(path + vsphereTagsSuffix)
+	reader, _, err := ds.Download(ctx, dsPath.Path, &soap.DefaultDownload)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	tags := make(map[string]string)
+	if err := json.NewDecoder(reader).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("Could not parse tags of %s: %s", path, err)
+	}
+	return tags, nil
+}
+
+func writeVSphereDiskTags(ctx context.Context, ds *object.Datastore, path string, tags map[string]string) error {
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	var dsPath object.DatastorePath
+	dsPath.FromString(path + vsphereTagsSuffix)
+	upload := soap.DefaultUpload
+	upload.ContentLength = int64(len(data))
+	return ds.Upload(ctx, bytes.NewReader(data), dsPath.Path, &upload)
+}
+
+// setVSphereField sets a custom attribute on a VM, adding the attribute
+// if it doesn't exist. An empty value removes it from the VM.
+func setVSphereField(ctx context.Context, c *vim25.Client, ref types.ManagedObjectReference, name, value string) error {
+	if c.ServiceContent.CustomFieldsManager == nil {
+		return fmt.Errorf("Custom attributes are not supported by %s", c.URL().Host)
+	}
+	fields := object.NewCustomFieldsManager(c)
+	key, err := fields.FindKey(ctx, name)
+	if err == object.ErrKeyNameNotFound {
+		if value == "" {
+			return nil
+		}
+		field, addErr := fields.Add(ctx, name, "VirtualMachine", nil, nil)
+		if addErr != nil {
+			return addErr
+		}
+		key, err = field.Key, nil
+	}
+	if err != nil {
+		return err
+	}
+	return fields.Set(ctx, ref, key, value)
+}
+
+// waitForVSphereTask waits for a task to complete, and returns its error
+func waitForVSphereTask(ctx context.Context, c *vim25.Client, ref types.ManagedObjectReference) error {
+	return object.NewTask(c, ref).Wait(ctx)
+}
+
+func removeVSphereSnapshot(ctx context.Context, c *vim25.Client, ref types.ManagedObjectReference) error {
+	consolidate := true
+	res, err := methods.RemoveSnapshot_Task(ctx, c, &types.RemoveSnapshot_Task{
+		This:           ref,
+		RemoveChildren: false,
+		Consolidate:    &consolidate,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForVSphereTask(ctx, c, res.Returnval)
+}
+
+func renameVSphereSnapshot(ctx context.Context, c *vim25.Client, ref types.ManagedObjectReference, name, description string) error {
+	_, err := methods.RenameSnapshot(ctx, c, &types.RenameSnapshot{
+		This:        ref,
+		Name:        name,
+		Description: description,
+	})
+	return err
+}
+
+type vsphereClient struct {
+	server   string
+	url      *url.URL
+	caFile   string
+	insecure bool
+
+	mutex  sync.Mutex
+	client *vim25.Client
+	// timeouts cancels the requests made while listing the vCenter once
+	// it has timed out
+	timeouts *scopeTimeouts
+}
+
+func newVSphereClient(server string, conf VSphereServer) (*vsphereClient, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid URL for vSphere server %s: %s", server, err)
+	}
+	password, err := ioutil.ReadFile(conf.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read password for vSphere server %s: %s", server, err)
+	}
+	u.User = url.UserPassword(conf.Username, strings.TrimSpace(string(password)))
+	return &vsphereClient{
+		server:   server,
+		url:      u,
+		caFile:   conf.CAFile,
+		insecure: conf.Insecure,
+	}, nil
+}
+
+func (c *vsphereClient) context() context.Context {
+	return c.timeouts.context(c, "")
+}
+
+// connect returns a client which is logged in to the server. The session
+// is reused, and renewed once it has expired, e.g. when running as a
+// service.
+func (c *vsphereClient) connect(ctx context.Context) (*vim25.Client, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client != nil {
+		current, err := session.NewManager(c.client).UserSession(ctx)
+		if err == nil && current != nil {
+			return c.client, nil
+		}
+	}
+	soapClient := soap.NewClient(c.url, c.insecure)
+	if c.caFile != "" {
+		if err := soapClient.SetRootCAs(c.caFile); err != nil {
+			return nil, fmt.Errorf("Could not read CA for vSphere server %s: %s", c.server, err)
+		}
+	}
+	vimClient, err := vim25.NewClient(ctx, soapClient)
+	if err != nil {
+		return nil, err
+	}
+	client := &govmomi.Client{Client: vimClient, SessionManager: session.NewManager(vimClient)}
+	if err := client.Login(ctx, c.url.User); err != nil {
+		return nil, fmt.Errorf("Could not log in to vSphere server %s: %s", c.server, err)
+	}
+	c.client = vimClient
+	return c.client, nil
+}
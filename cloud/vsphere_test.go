@@ -0,0 +1,157 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// newSimulatedVSphere starts a simulated vCenter, and returns a manager
+// for it, the server and a function stopping it
+func newSimulatedVSphere(t *testing.T) (ResourceManager, *simulator.Server, func()) {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		t.Fatalf("Could not create the simulated vCenter: %s", err)
+	}
+	server := model.Service.NewServer()
+	password, _ := server.URL.User.Password()
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(password), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf := &ManagerConfig{VSphereServers: map[string]VSphereServer{
+		"lab": {URL: server.URL.String(), Username: server.URL.User.Username(), PasswordFile: passwordFile, Insecure: true},
+	}}
+	mngr, err := NewManagerWithConfig(VSphere, conf, "lab")
+	if err != nil {
+		t.Fatalf("Could not create the vSphere manager: %s", err)
+	}
+	return mngr, server, func() {
+		server.Close()
+		model.Remove()
+	}
+}
+
+func TestVSphereResources(t *testing.T) {
+	mngr, server, stop := newSimulatedVSphere(t)
+	defer stop()
+	ctx := context.Background()
+	client := mngr.(*vsphereResourceManager).clients["lab"]
+	c, err := client.connect(ctx)
+	if err != nil {
+		t.Fatalf("Could not connect to %s: %s", server.URL.Host, err)
+	}
+	finder := find.NewFinder(c, true)
+	dc, err := finder.DefaultDatacenter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder.SetDatacenter(dc)
+	vms, err := finder.VirtualMachineList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := finder.DefaultDatastore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := ds.Path("orphan/orphan.vmdk")
+	if err := object.NewFileManager(c).MakeDirectory(ctx, ds.Path("orphan"), dc, true); err != nil {
+		t.Fatal(err)
+	}
+	task, err := object.NewVirtualDiskManager(c).CreateVirtualDisk(ctx, orphan, dc, &types.FileBackedVirtualDiskSpec{
+		VirtualDiskSpec: types.VirtualDiskSpec{AdapterType: "lsiLogic", DiskType: "thin"},
+		CapacityKb:      1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatalf("Could not create the orphaned disk: %s", err)
+	}
+	task, err = vms[0].CreateSnapshot(ctx, "before-upgrade", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatalf("Could not create the snapshot: %s", err)
+	}
+
+	resources := mngr.AllResourcesPerAccount()["lab"]
+	if resources == nil {
+		t.Fatal("No resources were found in the vCenter")
+	}
+	if len(resources.Instances) != len(vms) {
+		t.Errorf("Found %d instances, expected %d", len(resources.Instances), len(vms))
+	}
+	if len(resources.Volumes) != 1 || resources.Volumes[0].ID() != orphan {
+		t.Fatalf("Expected only %s to be found as an orphaned volume, found %d volumes", orphan, len(resources.Volumes))
+	}
+	if len(resources.Snapshots) != 1 || !resources.Snapshots[0].InUse() {
+		t.Fatalf("Expected one snapshot in use, found %v", resources.Snapshots)
+	}
+
+	inst := resources.Instances[0]
+	if inst.CreationTime().IsZero() {
+		t.Errorf("The creation time of %s is not known", inst.ID())
+	}
+	if err := inst.SetTag("cloudsweeper-delete-at", "2018-01-29", false); err != nil {
+		t.Fatalf("Could not tag %s: %s", inst.ID(), err)
+	}
+	if err := resources.Volumes[0].SetTag("cloudsweeper-delete-at", "2018-01-29", false); err != nil {
+		t.Fatalf("Could not tag %s: %s", orphan, err)
+	}
+	tagged := mngr.AllResourcesPerAccount()["lab"]
+	for _, res := range []Resource{tagged.Instances[0], tagged.Volumes[0]} {
+		if res.Tags()["cloudsweeper-delete-at"] != "2018-01-29" {
+			t.Errorf("The tag of %s was not read back, tags are %v", res.ID(), res.Tags())
+		}
+	}
+	if err := tagged.Instances[0].RemoveTag("cloudsweeper-delete-at"); err != nil {
+		t.Fatalf("Could not remove the tag of %s: %s", inst.ID(), err)
+	}
+	for _, untagged := range mngr.InstancesPerAccount()["lab"] {
+		if _, exist := untagged.Tags()["cloudsweeper-delete-at"]; exist && untagged.ID() == inst.ID() {
+			t.Errorf("The removed tag is still on %s", inst.ID())
+		}
+	}
+
+	if err := mngr.CleanupVolumes(tagged.Volumes); err != nil {
+		t.Fatalf("Could not clean up %s: %s", orphan, err)
+	}
+	if err := mngr.CleanupSnapshots(tagged.Snapshots); err != nil {
+		t.Fatalf("Could not clean up the snapshot: %s", err)
+	}
+	if err := mngr.CleanupInstances(tagged.Instances[:1]); err != nil {
+		t.Fatalf("Could not clean up %s: %s", tagged.Instances[0].ID(), err)
+	}
+	after := mngr.AllResourcesPerAccount()["lab"]
+	if len(after.Volumes) != 0 || len(after.Snapshots) != 0 || len(after.Instances) != len(vms)-1 {
+		t.Errorf("Resources were left after cleanup: %d instances, %d volumes, %d snapshots", len(after.Instances), len(after.Volumes), len(after.Snapshots))
+	}
+}
+
+func TestVSphereDescriptionTags(t *testing.T) {
+	value := "2018-01-29"
+	description := vsphereDescriptionWithTag("Before the upgrade\n", "cloudsweeper-delete-at", &value)
+	if description != "Before the upgrade\ncloudsweeper-delete-at=2018-01-29" {
+		t.Errorf("Unexpected description with tag: %q", description)
+	}
+	tags := vsphereDescriptionTags(description)
+	if len(tags) != 1 || tags["cloudsweeper-delete-at"] != value {
+		t.Errorf("Unexpected tags in description: %v", tags)
+	}
+	if removed := vsphereDescriptionWithTag(description, "cloudsweeper-delete-at", nil); removed != "Before the upgrade" {
+		t.Errorf("Unexpected description without tag: %q", removed)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloudsweeper
+
+import "github.com/agaridata/cloudsweeper/cloud"
+
+// The tag keys on resources which override the cost center and project
+// of their account. These can be changed to fit existing tagging
+// conventions.
+var (
+	CostCenterTagKey = "cost-center"
+	ProjectTagKey    = "project"
+)
+
+// Attribution is the cost center and project that the cost of an
+// account or resource is attributed to. Either can be empty if unknown.
+type Attribution struct {
+	CostCenter string
+	Project    string
+}
+
+// Attributions maps account/project IDs to their attribution
+type Attributions map[string]Attribution
+
+// ForResource returns the attribution of a resource. The tags of the
+// resource take precedence over the attribution of its account.
+func (a Attributions) ForResource(res cloud.Resource) Attribution {
+	result := a[res.Owner()]
+	tags := cloud.Tags(res.Tags())
+	if costCenter, exist := tags.Get(CostCenterTagKey); exist && costCenter != "" {
+		result.CostCenter = costCenter
+	}
+	if project, exist := tags.Get(ProjectTagKey); exist && project != "" {
+		result.Project = project
+	}
+	return result
+}
+
+// CostCenters returns a map from account/project IDs to cost centers
+func (a Attributions) CostCenters() map[string]string {
+	result := make(map[string]string, len(a))
+	for account, attribution := range a {
+		result[account] = attribution.CostCenter
+	}
+	return result
+}
+
+// Projects returns a map from account/project IDs to projects
+func (a Attributions) Projects() map[string]string {
+	result := make(map[string]string, len(a))
+	for account, attribution := range a {
+		result[account] = attribution.Project
+	}
+	return result
+}
+
+// AccountAttributions returns the attribution of every account in the
+// specified CSP. The cost center of an account is the one set on the
+// account, or else the one of its owner, or else the one of the owner's
+// department. The project is only set on accounts.
+func (org *Organization) AccountAttributions(csp cloud.CSP) Attributions {
+	result := make(Attributions)
+	for _, employee := range org.Employees {
+		costCenter := employee.CostCenter
+		if costCenter == "" && employee.Department != nil {
+			costCenter = employee.Department.CostCenter
+		}
+		add := func(id, accountCostCenter, project string) {
+			if accountCostCenter == "" {
+				accountCostCenter = costCenter
+			}
+			result[id] = Attribution{CostCenter: accountCostCenter, Project: project}
+		}
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				add(account.ID, account.CostCenter, account.Project)
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				add(project.ID, project.CostCenter, project.Project)
+			}
+		case cloud.Kubernetes:
+			// Kubernetes resources can be owned by a username, the same
+			// as in AccountToUserMapping
+			add(employee.Username, "", "")
+			for _, account := range employee.Accounts {
+				if account.CSP == csp {
+					add(account.ID, account.CostCenter, account.Project)
+				}
+			}
+		default:
+			for _, account := range employee.Accounts {
+				if account.CSP == csp {
+					add(account.ID, account.CostCenter, account.Project)
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package audit keeps a trail of the actions operators take on resources
+// by hand, such as marking, protecting or deleting them, and of the
+// resources cleanup deletes, so it's known afterwards who did what and
+// when. The trail is a file with one JSON entry per line, which is only
+// ever appended to. Deletions record the resource as it was, with its
+// tags, metadata and size, so questions about it can still be answered
+// once it's gone.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+)
+
+// Entry is an action taken on a resource
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor is who took the action, e.g. the username of an operator
+	Actor string `json:"actor"`
+	// Source is where the action was taken, e.g. "tui"
+	Source     string `json:"source"`
+	Action     string `json:"action"`
+	Account    string `json:"account"`
+	ResourceID string `json:"resource_id"`
+	Location   string `json:"location,omitempty"`
+	// Detail describes the action further, e.g. when a marked resource
+	// is deleted
+	Detail string `json:"detail,omitempty"`
+	// DryRun is true if the action was only logged
+	DryRun bool `json:"dry_run,omitempty"`
+	// Error is set if the action failed
+	Error string `json:"error,omitempty"`
+	// Resource is the resource as it was before it was deleted, with its
+	// tags, metadata and size. It's only set for deletions.
+	Resource *cloud.InventoryRecord `json:"resource,omitempty"`
+}
+
+// Snapshot returns the tags, metadata and size of a resource, to record
+// with its deletion. It must be taken before the resource is deleted.
+func Snapshot(res cloud.Resource) *cloud.InventoryRecord {
+	return cloud.NewInventoryRecord(res, billing.InstancePricePerHour)
+}
+
+// Trail appends entries to an audit trail file. It's safe to use from
+// several goroutines.
+type Trail struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewTrail returns a trail appending to the file at the path, which is
+// created when the first entry is recorded
+func NewTrail(path string) *Trail {
+	return &Trail{path: path}
+}
+
+// Record appends an entry to the trail. The time of the entry is set if
+// it's zero. The file is opened for every entry, so it can be rotated
+// while Cloudsweeper is running.
+func (t *Trail) Record(entry Entry) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read reads the entries of a trail, oldest first
+func Read(r io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// ForResource returns the entries of a trail for a resource ID, oldest
+// first
+func ForResource(entries []Entry, id string) []Entry {
+	result := []Entry{}
+	for _, entry := range entries {
+		if entry.ResourceID == id {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// CurrentActor returns the username of the user running Cloudsweeper, to
+// record as the actor of actions
+func CurrentActor() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package bulk performs an action, such as deleting or tagging, on every
+// resource in a list of IDs. Every ID is resolved to the account and
+// location of the resource, the action is taken on several resources at
+// a time, and the outcome for every ID is reported.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/schema"
+)
+
+// The outcomes of an action on an ID
+const (
+	OutcomeDone     = "done"
+	OutcomeDryRun   = "dry-run"
+	OutcomeSkipped  = "skipped"
+	OutcomeFailed   = "failed"
+	OutcomeNotFound = "not-found"
+)
+
+// Action is taken on every resource. In a dry run it only checks if the
+// resource would be skipped. It returns an error if it failed.
+type Action func(res cloud.Resource, dryRun bool) error
+
+// SkipError is returned by an action which refused to touch a resource,
+// e.g. because it's protected
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return e.Reason
+}
+
+// Result is the outcome of an action on an ID
+type Result struct {
+	ID       string `json:"id"`
+	Account  string `json:"account,omitempty"`
+	Location string `json:"location,omitempty"`
+	Outcome  string `json:"outcome"`
+	// Detail is the reason a resource was skipped, or the error of a
+	// failed action
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReportSchemaVersion is the version of the format of reports written by
+// WriteReport. Version 1 was a list of results, without the operation.
+const ReportSchemaVersion = 2
+
+// oldestReportSchemaVersion is the oldest version ReadReport reads
+const oldestReportSchemaVersion = 1
+
+// Report is the format of the report of a bulk operation. The report of a
+// dry run is the plan of what the operation would do.
+type Report struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Operation     string    `json:"operation,omitempty"`
+	DryRun        bool      `json:"dry_run,omitempty"`
+	Results       []*Result `json:"results"`
+}
+
+// ReadIDs reads one resource ID per line. Empty lines and lines starting
+// with # are ignored, and so are repeated IDs.
+func ReadIDs(r io.Reader) ([]string, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" || strings.HasPrefix(id, "#") || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+// Resolve finds the resources with the IDs among the resources of every
+// account of the manager. IDs which aren't found, or are found in several
+// accounts, have a result already.
+func Resolve(mngr cloud.ResourceManager, ids []string) (map[string]cloud.Resource, []*Result) {
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	found := map[string][]cloud.Resource{}
+	var mutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		for _, r := range resources(res) {
+			if wanted[r.ID()] {
+				mutex.Lock()
+				found[r.ID()] = append(found[r.ID()], r)
+				mutex.Unlock()
+			}
+		}
+	})
+	resolved := map[string]cloud.Resource{}
+	unresolved := []*Result{}
+	for _, id := range ids {
+		switch matches := found[id]; len(matches) {
+		case 0:
+			unresolved = append(unresolved, &Result{ID: id, Outcome: OutcomeNotFound, Detail: "Not found in any account"})
+		case 1:
+			resolved[id] = matches[0]
+		default:
+			accounts := []string{}
+			for _, r := range matches {
+				accounts = append(accounts, cloud.AccountDisplayName(r.Owner()))
+			}
+			sort.Strings(accounts)
+			unresolved = append(unresolved, &Result{ID: id, Outcome: OutcomeFailed, Detail: "Found in several accounts: " + strings.Join(accounts, ", ")})
+		}
+	}
+	return resolved, unresolved
+}
+
+// Run takes the action on every resolved resource, at most parallelism at
+// a time, and returns the result of every ID in the order of the IDs.
+// Results of IDs which couldn't be resolved are included.
+func Run(ids []string, resolved map[string]cloud.Resource, unresolved []*Result, action Action, parallelism int, dryRun bool) []*Result {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := map[string]*Result{}
+	for _, result := range unresolved {
+		results[result.ID] = result
+	}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for id, res := range resolved {
+		result := &Result{ID: id, Account: res.Owner(), Location: res.Location(), Outcome: OutcomeDone}
+		if dryRun {
+			result.Outcome = OutcomeDryRun
+		}
+		results[id] = result
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res cloud.Resource, result *Result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := action(res, dryRun)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if skip, ok := err.(*SkipError); ok {
+				result.Outcome, result.Detail = OutcomeSkipped, skip.Reason
+			} else if err != nil {
+				result.Outcome, result.Detail = OutcomeFailed, err.Error()
+			}
+		}(res, result)
+	}
+	wg.Wait()
+	ordered := []*Result{}
+	for _, id := range ids {
+		if result, exist := results[id]; exist {
+			ordered = append(ordered, result)
+		}
+	}
+	return ordered
+}
+
+// Count returns how many results have every outcome
+func Count(results []*Result) map[string]int {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Outcome]++
+	}
+	return counts
+}
+
+// FormatResults returns the results as a table, followed by how many IDs
+// had every outcome
+func FormatResults(results []*Result) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACCOUNT\tLOCATION\tOUTCOME\tDETAIL")
+	for _, result := range results {
+		account := "-"
+		if result.Account != "" {
+			account = cloud.AccountDisplayName(result.Account)
+		}
+		location := result.Location
+		if location == "" {
+			location = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.ID, account, location, result.Outcome, result.Detail)
+	}
+	w.Flush()
+	counts := Count(results)
+	summary := []string{}
+	for _, outcome := range []string{OutcomeDone, OutcomeDryRun, OutcomeSkipped, OutcomeFailed, OutcomeNotFound} {
+		if counts[outcome] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[outcome], outcome))
+		}
+	}
+	fmt.Fprintf(&b, "%d IDs: %s\n", len(results), strings.Join(summary, ", "))
+	return b.String()
+}
+
+// WriteReport writes the report of an operation, e.g. delete, with the
+// results of every ID as JSON
+func WriteReport(w io.Writer, operation string, dryRun bool, results []*Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&Report{
+		SchemaVersion: ReportSchemaVersion,
+		Operation:     operation,
+		DryRun:        dryRun,
+		Results:       results,
+	})
+}
+
+// ReadReport reads a report written by WriteReport, by this or the
+// previous version of Cloudsweeper. Reports of older versions are read
+// as the current version, without the operation.
+func ReadReport(r io.Reader) (*Report, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		report := &Report{SchemaVersion: ReportSchemaVersion}
+		if err := json.Unmarshal(trimmed, &report.Results); err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+	report := new(Report)
+	if err := json.Unmarshal(raw, report); err != nil {
+		return nil, err
+	}
+	version := schema.Version(report.SchemaVersion)
+	if err := schema.Check("bulk report", version, oldestReportSchemaVersion, ReportSchemaVersion); err != nil {
+		return nil, err
+	}
+	report.SchemaVersion = ReportSchemaVersion
+	return report, nil
+}
+
+func resources(res *cloud.AllResourceCollection) []cloud.Resource {
+	all := []cloud.Resource{}
+	for _, inst := range res.Instances {
+		all = append(all, inst)
+	}
+	for _, img := range res.Images {
+		all = append(all, img)
+	}
+	for _, vol := range res.Volumes {
+		all = append(all, vol)
+	}
+	for _, snap := range res.Snapshots {
+		all = append(all, snap)
+	}
+	for _, buck := range res.Buckets {
+		all = append(all, buck)
+	}
+	return all
+}
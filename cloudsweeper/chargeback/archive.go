@@ -0,0 +1,46 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package chargeback
+
+import (
+	"bytes"
+	"path"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Archive keeps the statements sent, for finance to look them up later
+type Archive interface {
+	// Store stores a statement file, replacing any earlier file with the
+	// same name for the same month
+	Store(s *Statement, name, contentType string, content []byte) error
+}
+
+// s3Archive stores statements in an S3 bucket, with the keys
+// <prefix><month>/<file name>
+type s3Archive struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3Archive returns an archive in the specified S3 bucket, with the
+// keys of the statements starting with the prefix
+func NewS3Archive(bucket, prefix, region string) Archive {
+	sess := cloud.NewAWSSession()
+	client := s3.New(sess, &aws.Config{Region: aws.String(region)})
+	return &s3Archive{client, bucket, prefix}
+}
+
+func (a *s3Archive) Store(s *Statement, name, contentType string, content []byte) error {
+	_, err := a.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(a.bucket),
+		Key:         aws.String(a.prefix + path.Join(s.Month.Format("2006-01"), name)),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package chargeback splits the bill of a month between the departments of
+// the organization, so that finance can charge every team for the cost of
+// its accounts. Every department gets a statement with the cost of each of
+// its accounts, and the total per cost center.
+package chargeback
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+)
+
+// UnassignedTeam is the name of the statement of the accounts which don't
+// belong to any department, such as accounts missing in the organization
+const UnassignedTeam = "Unassigned"
+
+// unsafeFileNameChars are replaced in the names of statement files
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Line is the cost of an account in a statement
+type Line struct {
+	Account string
+	// Name is the friendly name of the account, if it has one
+	Name       string
+	Owner      string
+	CostCenter string
+	Project    string
+	Cost       float64
+}
+
+// CostCenterTotal is the total cost of the accounts in a statement which
+// are attributed to a cost center
+type CostCenterTotal struct {
+	CostCenter string
+	Cost       float64
+}
+
+// Statement is the chargeback statement of a department for a month
+type Statement struct {
+	// Team is the department, or nil for the unassigned accounts
+	Team *cs.Department
+	// Lead is the active employee who leads the department, or nil if
+	// the statement has no lead
+	Lead  *cs.Employee
+	Month time.Time
+	// Report is the report the costs are from, which formats them in the
+	// currency of the statement
+	Report      *billing.Report
+	Lines       []Line
+	CostCenters []CostCenterTotal
+	Total       float64
+}
+
+// TeamName returns the name of the department of the statement
+func (s *Statement) TeamName() string {
+	if s.Team == nil {
+		return UnassignedTeam
+	}
+	if s.Team.Name != "" {
+		return s.Team.Name
+	}
+	return s.Team.ID
+}
+
+// MonthName returns the month of the statement, e.g. "September 2026"
+func (s *Statement) MonthName() string {
+	return s.Month.Format("January 2006")
+}
+
+// FileName returns the name of the statement file with the specified
+// extension, e.g. "aws-chargeback-2026-09-platform.pdf"
+func (s *Statement) FileName(extension string) string {
+	team := UnassignedTeam
+	if s.Team != nil {
+		team = s.Team.ID
+	}
+	team = strings.Trim(unsafeFileNameChars.ReplaceAllString(strings.ToLower(team), "-"), "-")
+	return fmt.Sprintf("%s-chargeback-%s-%s.%s", strings.ToLower(string(s.Report.CSP)), s.Month.Format("2006-01"), team, extension)
+}
+
+// Generate splits the costs in the report, which must be the report of the
+// month, into a statement per department. An account belongs to the
+// department of its owner in the organization. Accounts of owners without
+// a department, and accounts which aren't in the organization, are put in
+// a statement of their own, so that the statements add up to the total of
+// the report. Statements are sorted by the name of their department, with
+// the unassigned accounts last.
+func Generate(report billing.Report, org *cs.Organization, csp cloud.CSP, month time.Time) []*Statement {
+	accountUsers := org.AccountToUserMapping(csp)
+	employees := org.UsernameToEmployeeMapping()
+	attributions := org.AccountAttributions(csp)
+
+	accountCosts := make(map[string]float64)
+	for _, item := range report.Items {
+		accountCosts[item.Owner] += item.Cost
+	}
+
+	statements := make(map[string]*Statement)
+	for account, cost := range accountCosts {
+		var team *cs.Department
+		owner := accountUsers[account]
+		if employee, exist := employees[owner]; exist {
+			team = employee.Department
+		}
+		key := ""
+		if team != nil {
+			key = team.ID
+		}
+		statement, exist := statements[key]
+		if !exist {
+			reportCopy := report
+			statement = &Statement{Team: team, Month: month, Report: &reportCopy}
+			if team != nil {
+				if lead, exist := employees[team.Lead]; exist && !lead.Disabled {
+					statement.Lead = lead
+				}
+			}
+			statements[key] = statement
+		}
+		attribution := attributions[account]
+		statement.Lines = append(statement.Lines, Line{
+			Account:    account,
+			Name:       cloud.AccountName(account),
+			Owner:      owner,
+			CostCenter: attribution.CostCenter,
+			Project:    attribution.Project,
+			Cost:       cost,
+		})
+		statement.Total += cost
+	}
+
+	result := []*Statement{}
+	for _, statement := range statements {
+		statement.sort()
+		result = append(result, statement)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if (result[i].Team == nil) != (result[j].Team == nil) {
+			return result[j].Team == nil
+		}
+		return result[i].TeamName() < result[j].TeamName()
+	})
+	return result
+}
+
+// sort sorts the lines with the most expensive account first, and sums
+// up the cost centers, with the most expensive one first
+func (s *Statement) sort() {
+	sort.Slice(s.Lines, func(i, j int) bool {
+		if s.Lines[i].Cost != s.Lines[j].Cost {
+			return s.Lines[i].Cost > s.Lines[j].Cost
+		}
+		return s.Lines[i].Account < s.Lines[j].Account
+	})
+	costCenters := make(map[string]float64)
+	for _, line := range s.Lines {
+		costCenters[line.CostCenter] += line.Cost
+	}
+	s.CostCenters = []CostCenterTotal{}
+	for costCenter, cost := range costCenters {
+		s.CostCenters = append(s.CostCenters, CostCenterTotal{costCenter, cost})
+	}
+	sort.Slice(s.CostCenters, func(i, j int) bool {
+		if s.CostCenters[i].Cost != s.CostCenters[j].Cost {
+			return s.CostCenters[i].Cost > s.CostCenters[j].Cost
+		}
+		return s.CostCenters[i].CostCenter < s.CostCenters[j].CostCenter
+	})
+}
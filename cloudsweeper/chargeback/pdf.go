@@ -0,0 +1,176 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package chargeback
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The size of an A4 page and its margins, in points
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+// pdfFonts are the fonts statements are written in, which are standard
+// fonts every PDF reader has, so that no font has to be embedded. The
+// tables are written in Courier, since it's monospaced.
+var pdfFonts = []string{"Helvetica-Bold", "Courier", "Courier-Bold"}
+
+// pdfLine is a line of text in a PDF document
+type pdfLine struct {
+	font string
+	size float64
+	text string
+}
+
+// The widths of the columns of the account table, in characters
+const (
+	accountColumnWidth    = 14
+	nameColumnWidth       = 22
+	ownerColumnWidth      = 14
+	costCenterColumnWidth = 14
+	projectColumnWidth    = 10
+	costColumnWidth       = 12
+)
+
+// WritePDF writes the statement as a PDF document
+func (s *Statement) WritePDF(w io.Writer) error {
+	heading := func(text string) pdfLine { return pdfLine{"Helvetica-Bold", 16, text} }
+	bold := func(text string) pdfLine { return pdfLine{"Courier-Bold", 9, text} }
+	plain := func(text string) pdfLine { return pdfLine{"Courier", 9, text} }
+	row := func(account, name, owner, costCenter, project, cost string) string {
+		return fmt.Sprintf("%-*s %-*s %-*s %-*s %-*s %*s",
+			accountColumnWidth, truncate(account, accountColumnWidth),
+			nameColumnWidth, truncate(name, nameColumnWidth),
+			ownerColumnWidth, truncate(owner, ownerColumnWidth),
+			costCenterColumnWidth, truncate(costCenter, costCenterColumnWidth),
+			projectColumnWidth, truncate(project, projectColumnWidth),
+			costColumnWidth, cost)
+	}
+
+	lead := "-"
+	if s.Lead != nil {
+		lead = s.Lead.RealName
+	}
+	lines := []pdfLine{
+		heading(fmt.Sprintf("%s chargeback statement", s.Report.CSP)),
+		plain(""),
+		plain(fmt.Sprintf("Team:  %s", s.TeamName())),
+		plain(fmt.Sprintf("Lead:  %s", lead)),
+		plain(fmt.Sprintf("Month: %s", s.MonthName())),
+		plain(fmt.Sprintf("Total: %s", s.Report.FormatCost(s.Total))),
+		plain(""),
+		bold(row("Account", "Name", "Owner", "Cost center", "Project", "Cost")),
+	}
+	for _, line := range s.Lines {
+		lines = append(lines, plain(row(line.Account, line.Name, line.Owner, line.CostCenter, line.Project, s.Report.FormatCost(line.Cost))))
+	}
+	lines = append(lines, bold(row("Total", "", "", "", "", s.Report.FormatCost(s.Total))), plain(""))
+	lines = append(lines, bold(fmt.Sprintf("%-*s %*s", costCenterColumnWidth, "Cost center", costColumnWidth, "Cost")))
+	for _, costCenter := range s.CostCenters {
+		name := costCenter.CostCenter
+		if name == "" {
+			name = "<unattributed>"
+		}
+		lines = append(lines, plain(fmt.Sprintf("%-*s %*s", costCenterColumnWidth, truncate(name, costCenterColumnWidth), costColumnWidth, s.Report.FormatCost(costCenter.Cost))))
+	}
+	return writePDF(w, lines)
+}
+
+// truncate shortens text to at most width characters
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-1]) + "~"
+}
+
+// writePDF writes a PDF document with the lines from the top of the first
+// page, starting a new page whenever one is full
+func writePDF(w io.Writer, lines []pdfLine) error {
+	pages := []*bytes.Buffer{}
+	var page *bytes.Buffer
+	y := 0.0
+	for _, line := range lines {
+		leading := line.size * 1.4
+		if page == nil || y-leading < pdfMargin {
+			page = new(bytes.Buffer)
+			pages = append(pages, page)
+			y = pdfPageHeight - pdfMargin
+		}
+		y -= leading
+		fmt.Fprintf(page, "BT /F%d %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfFontNumber(line.font), line.size, pdfMargin, y, pdfString(line.text))
+	}
+
+	// The catalog and the page tree are objects 1 and 2, followed by the
+	// fonts, and then a page object and its content for every page
+	objects := []string{"", ""}
+	fontRefs := []string{}
+	for i, font := range pdfFonts {
+		objects = append(objects, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font))
+		fontRefs = append(fontRefs, fmt.Sprintf("/F%d %d 0 R", i+1, len(objects)))
+	}
+	pageRefs := []string{}
+	for _, content := range pages {
+		pageNumber := len(objects) + 1
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, strings.Join(fontRefs, " "), pageNumber+1))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+		pageRefs = append(pageRefs, fmt.Sprintf("%d 0 R", pageNumber))
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageRefs, " "), len(pages))
+
+	b := new(bytes.Buffer)
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func pdfFontNumber(font string) int {
+	for i, f := range pdfFonts {
+		if f == font {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// pdfString escapes text for a PDF string in the WinAnsi encoding of the
+// standard fonts. Characters outside of Latin-1 are replaced, since they
+// can't be shown without embedding a font.
+func pdfString(text string) string {
+	b := new(strings.Builder)
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
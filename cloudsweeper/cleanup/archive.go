@@ -0,0 +1,97 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// ArchivedTagKey is set on snapshots which have been moved to the
+// archive tier, with the time they were archived
+var ArchivedTagKey = "cloudsweeper-archived"
+
+// ArchiveCandidates holds the snapshots in one account which are
+// recommended to be moved to the archive tier
+type ArchiveCandidates struct {
+	Owner     string
+	Snapshots []cloud.Snapshot
+}
+
+// SavingsPerMonth returns the estimated monthly savings, in USD, of
+// moving all candidate snapshots to the archive tier
+func (c *ArchiveCandidates) SavingsPerMonth() float64 {
+	total := 0.0
+	for _, snap := range c.Snapshots {
+		total += billing.SnapshotArchiveSavingsPerMonth(snap)
+	}
+	return total
+}
+
+// FindArchiveCandidates will find snapshots older than the specified
+// number of days which have not been used to create a volume in that
+// time, grouped per account. Snapshots which are already archived, or
+// are marked for cleanup, are not included. Whitelisted snapshots are
+// included, since archiving keeps the data around.
+func FindArchiveCandidates(mngr cloud.ResourceManager, days int) map[string]*ArchiveCandidates {
+	result := make(map[string]*ArchiveCandidates)
+	var resultMutex sync.Mutex
+
+	archiveFilter := filter.New()
+	archiveFilter.AddGeneralRule(filter.OlderThanXDays(days))
+	archiveFilter.AddGeneralRule(filter.NotUsedInXDays(days))
+	archiveFilter.AddSnapshotRule(filter.IsNotInUse())
+	archiveFilter.AddGeneralRule(filter.Negate(filter.HasTag(ArchivedTagKey)))
+	archiveFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+	archiveFilter.OverrideWhitelist = true
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		candidates := []cloud.Snapshot{}
+		for _, snap := range filter.Snapshots(res.Snapshots, archiveFilter) {
+			if _, ok := snap.(cloud.Archiver); ok {
+				candidates = append(candidates, snap)
+			}
+		}
+		if len(candidates) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[res.Owner] = &ArchiveCandidates{Owner: res.Owner, Snapshots: candidates}
+	})
+	return result
+}
+
+// ArchiveSnapshots will move all candidate snapshots to the archive
+// tier instead of deleting them, and tag them so they are not archived
+// or marked for cleanup again. The archived snapshots are returned.
+func ArchiveSnapshots(found map[string]*ArchiveCandidates, dryRun bool) []cloud.Snapshot {
+	archived := []cloud.Snapshot{}
+	for _, candidates := range found {
+		for _, snap := range candidates.Snapshots {
+			archiver, ok := snap.(cloud.Archiver)
+			if !ok {
+				continue
+			}
+			if dryRun {
+				log.Printf("Would archive snapshot %s in %s", snap.ID(), cloud.AccountDisplayName(candidates.Owner))
+				continue
+			}
+			if err := archiver.Archive(); err != nil {
+				status.ActionFailedf("Could not archive snapshot %s in %s: %s", snap.ID(), cloud.AccountDisplayName(candidates.Owner), err)
+				continue
+			}
+			if err := snap.SetTag(ArchivedTagKey, time.Now().Format(time.RFC3339), true); err != nil {
+				status.ActionFailedf("Could not tag archived snapshot %s in %s: %s", snap.ID(), cloud.AccountDisplayName(candidates.Owner), err)
+			}
+			archived = append(archived, snap)
+		}
+	}
+	return archived
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+)
+
+// AuditSource is the source of the deletions cleanup records in the
+// audit trail
+const AuditSource = "cleanup"
+
+// auditDeletion records the deletion of a resource, and whether it
+// failed, in the audit trail
+func auditDeletion(res cloud.Resource, err error) {
+	if options.AuditTrail == nil {
+		return
+	}
+	entry := audit.Entry{
+		Actor:      audit.CurrentActor(),
+		Source:     AuditSource,
+		Action:     ActionDelete,
+		Account:    res.Owner(),
+		ResourceID: res.ID(),
+		Location:   res.Location(),
+		Resource:   audit.Snapshot(res),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if auditErr := options.AuditTrail.Record(entry); auditErr != nil {
+		log.Printf("Could not record the deletion of %s in the audit trail: %s", res.ID(), auditErr)
+	}
+}
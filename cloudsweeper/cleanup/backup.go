@@ -0,0 +1,62 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+var (
+	// backupManaged are the resources of every account which would have
+	// been marked when they were last marked, had they not been managed
+	// by AWS Backup
+	backupManaged      = make(map[string][]cloud.Resource)
+	backupManagedMutex sync.RWMutex
+)
+
+// BackupManagedOf returns the resources of an account which would have
+// been marked when its resources were last marked, but were left alone
+// since AWS Backup manages them
+func BackupManagedOf(owner string) []cloud.Resource {
+	backupManagedMutex.RLock()
+	defer backupManagedMutex.RUnlock()
+	return backupManaged[owner]
+}
+
+// withoutBackupManaged removes the resources managed by AWS Backup from
+// the collection, records them for the account, and returns their IDs
+func withoutBackupManaged(resources *cloud.AllResourceCollection) map[string]bool {
+	ids := map[string]bool{}
+	kept := cloud.AllResourceCollection{Owner: resources.Owner}
+	managed := []cloud.Resource{}
+	isManaged := filter.IsBackupManaged()
+	for _, res := range resources.Resources() {
+		if isManaged(res) {
+			ids[res.ID()] = true
+			managed = append(managed, res)
+		} else {
+			addResource(&kept, res)
+		}
+	}
+	backupManagedMutex.Lock()
+	defer backupManagedMutex.Unlock()
+	delete(backupManaged, resources.Owner)
+	if len(ids) == 0 {
+		return ids
+	}
+	log.Printf("%s: Not marking %d resources managed by AWS Backup", cloud.AccountDisplayName(resources.Owner), len(ids))
+	backupManaged[resources.Owner] = managed
+	*resources = kept
+	return ids
+}
+
+// notBackupManaged checks that a resource isn't managed by AWS Backup,
+// unless those aren't excluded
+func notBackupManaged(res cloud.Resource) bool {
+	return !options.ExcludeBackupManaged || !filter.IsBackupManaged()(res)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// StepEmptyBuckets is the step of a cleanup run deleting the empty
+// buckets of an account. The other steps are the resource types whose
+// passed lifetimes, expiry dates and delete tags are cleaned up.
+const StepEmptyBuckets = "empty-buckets"
+
+// Steps returns the steps of a cleanup run in every account, in order
+func Steps(emptyBuckets bool) []string {
+	steps := append([]string{}, cloud.ResourceTypes...)
+	if emptyBuckets {
+		steps = append(steps, StepEmptyBuckets)
+	}
+	return steps
+}
+
+// Checkpointer keeps track of the steps of a cleanup run done in every
+// account, so an interrupted run can be resumed where it left off
+type Checkpointer interface {
+	// Done returns true if the step was done in the account by an
+	// earlier attempt of the run
+	Done(owner, step string) bool
+	// Checkpoint records that the step is done in the account
+	Checkpoint(owner, step string) error
+}
+
+// stepDone returns true if the step was done in the account before the
+// run was resumed, and logs that it's skipped
+func stepDone(owner, step string) bool {
+	if options.Checkpoints == nil || !options.Checkpoints.Done(owner, step) {
+		return false
+	}
+	log.Printf("Already cleaned up %s in %s, skipping", step, cloud.AccountDisplayName(owner))
+	return true
+}
+
+// checkpoint records that the step is done in the account. Steps which
+// failed, or were stopped before every resource was deleted, aren't, so
+// they are tried again when the run is resumed.
+func checkpoint(owner, step string, err error) {
+	if options.Checkpoints == nil || err != nil || Stopped() {
+		return
+	}
+	if err := options.Checkpoints.Checkpoint(owner, step); err != nil {
+		log.Printf("Could not save the checkpoint of %s in %s: %s", step, cloud.AccountDisplayName(owner), err)
+	}
+}
+
+// nextDelete is when the next chunk of deletes may start
+var nextDelete time.Time
+
+// throttleDeletes waits until a chunk of count deletes, which is at most
+// DeletesPerMinute, can start without deleting more than DeletesPerMinute
+// in any minute. It returns false, without waiting any longer, if cleanup
+// is stopped meanwhile.
+func throttleDeletes(owner, what string, count int) bool {
+	if options.DeletesPerMinute <= 0 || count == 0 {
+		return !skipStopped(owner, what)
+	}
+	if wait := time.Until(nextDelete); wait > 0 {
+		log.Printf("Waiting %s before deleting %d %s in %s, to delete at most %d resources per minute", wait.Round(time.Second), count, what, cloud.AccountDisplayName(owner), options.DeletesPerMinute)
+	}
+	for time.Now().Before(nextDelete) {
+		if Stopped() {
+			break
+		}
+		wait := time.Until(nextDelete)
+		if wait > time.Second {
+			wait = time.Second
+		}
+		time.Sleep(wait)
+	}
+	if skipStopped(owner, what) {
+		return false
+	}
+	nextDelete = time.Now().Add(time.Duration(count) * time.Minute / time.Duration(options.DeletesPerMinute))
+	return true
+}
@@ -1,21 +1,49 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+// Package cleanup marks resources for cleanup and deletes them once
+// their time is up. MarkForCleanup and the review functions report bad
+// input as errors, and failures to tag or delete single resources are
+// recorded with the status package, so the package can be embedded in
+// other programs. See examples/embed for a minimal program.
 package cleanup
 
 import (
+	"fmt"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
 	"github.com/agaridata/cloudsweeper/cloud/billing"
 	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
 )
 
-const (
-	totalCostThreshold = 10.0
-)
+// markThresholds are the thresholds MarkForCleanup needs
+var markThresholds = []string{
+	"clean-untagged-older-than-days",
+	"clean-instances-older-than-days",
+	"clean-unattached-older-than-days",
+	"clean-snapshots-older-than-days",
+	"clean-bucket-not-modified-days",
+	"clean-bucket-older-than-days",
+	"clean-images-older-than-days",
+	"clean-keep-n-component-images",
+}
+
+// CheckThresholds returns an error if any of the thresholds with the
+// specified keys is missing
+func CheckThresholds(thresholds map[string]int, keys ...string) error {
+	for _, key := range keys {
+		if _, found := thresholds[key]; !found {
+			return fmt.Errorf("Threshold '%s' not found", key)
+		}
+	}
+	return nil
+}
 
 // MarkForCleanup will look for resources that should be automatically
 // cleaned up. These resources are not deleted directly, but are given
@@ -27,27 +55,51 @@ const (
 // 		- non-whitelisted snapshots > 6 months
 // 		- non-whitelisted volumes > 6 months
 //		- untagged resources > 30 days (this should take care of instances)
-func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRun bool) map[string]*cloud.AllResourceCollection {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
+// Resources in categories with the notify action in the policy are never
+// tagged. They are returned separately, so their owners can be notified.
+// An error is returned, before anything is marked, if a threshold is
+// missing.
+func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, pol *policy.Policy, dryRun bool) (map[string]*cloud.AllResourceCollection, map[string]*cloud.AllResourceCollection, error) {
+	if err := CheckThresholds(thresholds, markThresholds...); err != nil {
+		return nil, nil, err
+	}
 	allResourcesToTag := make(map[string]*cloud.AllResourceCollection)
+	allNotifyOnly := make(map[string]*cloud.AllResourceCollection)
+	var resultMutex sync.Mutex
+	version := NewPolicyVersion(pol, thresholds)
 
-	for owner, res := range allResources {
-		log.Println("Marking resources for cleanup in", owner)
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		owner := res.Owner
+		log.Println("Marking resources for cleanup in", cloud.AccountDisplayName(owner))
 
+		// All thresholds were checked before marking anything
 		getThreshold := func(key string, thresholds map[string]int) int {
-			threshold, found := thresholds[key]
-			if found {
-				return threshold
-			} else {
-				log.Fatalf("Threshold '%s' not found", key)
-				return 99999
+			return thresholds[key]
+		}
+
+		// The reason of a resource matching a filter OR:ed with the untagged
+		// filter is the one of that filter, unless only untagged matches
+		untaggedReason := fmt.Sprintf("untagged>%dd", getThreshold("clean-untagged-older-than-days", thresholds))
+		reasonFor := func(res cloud.Resource, specific *filter.ResourceFilter, reason string) string {
+			if filter.Match(res, specific) {
+				return reason
 			}
+			return untaggedReason
 		}
 
-		// Deletion thresholds
-		timeToDeleteGeneral := time.Now().AddDate(0, 0, 4)
-		timeToDeleteUnnamedInstances := time.Now().AddDate(0, 0, 1)
+		// Deletion thresholds, after any freeze they would be in
+		timeToDeleteGeneral := postponeForFreeze(time.Now().AddDate(0, 0, 4))
+		timeToDeleteUnnamedInstances := postponeForFreeze(time.Now().AddDate(0, 0, 1))
+
+		// Whitelisting a resource is how to stop it being marked, so its
+		// remarks no longer count
+		if options.Remarks != nil {
+			for _, res := range res.Resources() {
+				if filter.IsWhitelisted(res) {
+					options.Remarks.Forget(owner, res.ID())
+				}
+			}
+		}
 
 		resourcesToTag := cloud.AllResourceCollection{}
 		resourcesToTag.Owner = owner
@@ -55,7 +107,6 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 		// pass a []Image to a function that takes []Resource without explicitly converting everything...
 		tagListGeneral := []cloud.Resource{}
 		tagListUnnamedInstances := []cloud.Resource{}
-		totalCost := 0.0
 
 		// General filters
 		untaggedFilter := filter.New()
@@ -64,6 +115,7 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 		untaggedFilter.AddSnapshotRule(filter.IsNotInUse())
 		untaggedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		untaggedFilter.AddVolumeRule(filter.IsUnattached())
+		untaggedFilter.AddImageRule(notRetained)
 
 		// INSTANCES
 		instanceFilter := filter.New()
@@ -84,9 +136,7 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 			resourcesToTag.Instances = append(resourcesToTag.Instances, res)
 			tagListUnnamedInstances = append(tagListUnnamedInstances, res)
 			alreadySelectedInstances[res.ID()] = true
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			recordDeleteReason(res, fmt.Sprintf("unnamed-instance>%dd", getThreshold("clean-untagged-older-than-days", thresholds)))
 		}
 
 		// General case
@@ -95,9 +145,7 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 				resourcesToTag.Instances = append(resourcesToTag.Instances, res)
 				tagListGeneral = append(tagListGeneral, res)
 				alreadySelectedInstances[res.ID()] = true
-				days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-				costPerDay := billing.ResourceCostPerDay(res)
-				totalCost += days * costPerDay
+				recordDeleteReason(res, reasonFor(res, instanceFilter, fmt.Sprintf("instance>%dd", getThreshold("clean-instances-older-than-days", thresholds))))
 			}
 		}
 
@@ -110,49 +158,49 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 		for _, res := range filter.Volumes(res.Volumes, volumeFilter, untaggedFilter) {
 			resourcesToTag.Volumes = append(resourcesToTag.Volumes, res)
 			tagListGeneral = append(tagListGeneral, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			recordDeleteReason(res, reasonFor(res, volumeFilter, fmt.Sprintf("unattached-volume>%dd", getThreshold("clean-unattached-older-than-days", thresholds))))
 		}
 
 		// SNAPSHOTS
 		snapshotFilter := filter.New()
 		snapshotFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-snapshots-older-than-days", thresholds)))
+		snapshotFilter.AddGeneralRule(filter.NotUsedInXDays(getThreshold("clean-snapshots-older-than-days", thresholds)))
 		snapshotFilter.AddSnapshotRule(filter.IsNotInUse())
 		snapshotFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		snapshotFilter.AddGeneralRule(filter.Negate(filter.HasTag(ArchivedTagKey)))
 
 		for _, res := range filter.Snapshots(res.Snapshots, snapshotFilter, untaggedFilter) {
 			resourcesToTag.Snapshots = append(resourcesToTag.Snapshots, res)
 			tagListGeneral = append(tagListGeneral, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			recordDeleteReason(res, reasonFor(res, snapshotFilter, fmt.Sprintf("unused-snapshot>%dd", getThreshold("clean-snapshots-older-than-days", thresholds))))
 		}
 
 		// BUCKETS
 		bucketFilter := filter.New()
 		bucketFilter.AddBucketRule(filter.NotModifiedInXDays(getThreshold("clean-bucket-not-modified-days", thresholds)))
+		bucketFilter.AddBucketRule(filter.NotReadInXDays(getThreshold("clean-bucket-not-modified-days", thresholds)))
 		bucketFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-bucket-older-than-days", thresholds)))
 		bucketFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 
-		if buck, ok := allBuckets[owner]; ok {
-			for _, res := range filter.Buckets(buck, bucketFilter, untaggedFilter) {
-				resourcesToTag.Buckets = append(resourcesToTag.Buckets, res)
-				tagListGeneral = append(tagListGeneral, res)
-				totalCost += billing.BucketPricePerMonth(res)
-				log.Printf("Want to mark bucket %s with Tags %v and lastModified %s", res.ID(), res.Tags(), res.LastModified().String())
-			}
+		for _, res := range filter.Buckets(res.Buckets, bucketFilter, untaggedFilter) {
+			resourcesToTag.Buckets = append(resourcesToTag.Buckets, res)
+			tagListGeneral = append(tagListGeneral, res)
+			recordDeleteReason(res, reasonFor(res, bucketFilter, fmt.Sprintf("unused-bucket>%dd", getThreshold("clean-bucket-not-modified-days", thresholds))))
+			log.Printf("Want to mark bucket %s with Tags %v and lastModified %s", res.ID(), res.Tags(), res.LastModified().String())
 		}
 
 		// IMAGES
 		unformattedImageFilter := filter.New()
 		unformattedImageFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-images-older-than-days", thresholds)))
+		unformattedImageFilter.AddGeneralRule(filter.NotUsedInXDays(getThreshold("clean-images-older-than-days", thresholds)))
 		unformattedImageFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		unformattedImageFilter.AddImageRule(filter.DoesNotFollowFormat())
+		unformattedImageFilter.AddImageRule(notRetained)
 
 		formattedImageFilter := filter.New()
 		formattedImageFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		formattedImageFilter.AddImageRule(filter.FollowsFormat())
+		formattedImageFilter.AddImageRule(notRetained)
 
 		// Helper map to avoid duplicated images
 		alreadySelectedImages := map[string]bool{}
@@ -162,9 +210,7 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 			resourcesToTag.Images = append(resourcesToTag.Images, res)
 			tagListGeneral = append(tagListGeneral, res)
 			alreadySelectedImages[res.ID()] = true
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			recordDeleteReason(res, untaggedReason)
 		}
 
 		// Images NOT following the component-date pattern
@@ -173,9 +219,7 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 				resourcesToTag.Images = append(resourcesToTag.Images, res)
 				tagListGeneral = append(tagListGeneral, res)
 				alreadySelectedImages[res.ID()] = true
-				days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-				costPerDay := billing.ResourceCostPerDay(res)
-				totalCost += days * costPerDay
+				recordDeleteReason(res, fmt.Sprintf("unused-image>%dd", getThreshold("clean-images-older-than-days", thresholds)))
 			}
 		}
 
@@ -186,33 +230,195 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 				resourcesToTag.Images = append(resourcesToTag.Images, res)
 				tagListGeneral = append(tagListGeneral, res)
 				alreadySelectedImages[res.ID()] = true
-				days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-				costPerDay := billing.ResourceCostPerDay(res)
-				totalCost += days * costPerDay
+				recordDeleteReason(res, fmt.Sprintf("older-than-%d-latest-images", getThreshold("clean-keep-n-component-images", thresholds)))
 			}
 		}
 
-		log.Printf("%s: Attempting to apply tags to resources", owner)
-		applyTags(tagListGeneral, timeToDeleteGeneral, totalCost, dryRun)
-		applyTags(tagListUnnamedInstances, timeToDeleteUnnamedInstances, totalCost, dryRun)
-
+		var notifyOnly *cloud.AllResourceCollection
+		if pol.UsesRego() {
+			// The Rego policy decides instead, and the resources it marks
+			// stay in the batch the native engine put them in, if any
+			var marked *cloud.AllResourceCollection
+			marked, notifyOnly = decideWithRego(res, &resourcesToTag, pol)
+			resourcesToTag = *marked
+			tagListGeneral, tagListUnnamedInstances = splitBatches(marked.Resources(), tagListUnnamedInstances)
+		} else {
+			notMatching := withoutPolicyRulesMismatches(&resourcesToTag, pol)
+			tagListGeneral = withoutIDs(tagListGeneral, notMatching)
+			tagListUnnamedInstances = withoutIDs(tagListUnnamedInstances, notMatching)
+			notifyOnly = splitNotifyOnly(&resourcesToTag, pol)
+		}
+		if options.ExcludeBackupManaged {
+			managed := withoutBackupManaged(&resourcesToTag)
+			tagListGeneral = withoutIDs(tagListGeneral, managed)
+			tagListUnnamedInstances = withoutIDs(tagListUnnamedInstances, managed)
+		}
+		if options.ExcludeDLMManaged {
+			managed := withoutDLMManaged(&resourcesToTag)
+			tagListGeneral = withoutIDs(tagListGeneral, managed)
+			tagListUnnamedInstances = withoutIDs(tagListUnnamedInstances, managed)
+		}
+		// Protected resources can't be deleted, so they are reviewed by
+		// hand instead of being marked
+		tagListGeneral = withoutIDs(tagListGeneral, withoutUndeletable(&resourcesToTag))
+		notifyOnlyIDs := map[string]bool{}
+		for _, res := range notifyOnly.Resources() {
+			notifyOnlyIDs[res.ID()] = true
+		}
+		tagListGeneral = withoutIDs(tagListGeneral, notifyOnlyIDs)
+		tagListUnnamedInstances = withoutIDs(tagListUnnamedInstances, notifyOnlyIDs)
+		tagListGeneral = withoutIDs(tagListGeneral, options.Disputed)
+		tagListUnnamedInstances = withoutIDs(tagListUnnamedInstances, options.Disputed)
+
+		// Every batch is gated by its own cost, since they are deleted at
+		// different times
+		resetCostGates(owner)
+		log.Printf("%s: Attempting to apply tags to resources", cloud.AccountDisplayName(owner))
+		applyTags(owner, costBatchGeneral, tagListGeneral, timeToDeleteGeneral, version, dryRun)
+		applyTags(owner, costBatchUnnamedInstance, tagListUnnamedInstances, timeToDeleteUnnamedInstances, version, dryRun)
+
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
 		allResourcesToTag[owner] = &resourcesToTag
+		allNotifyOnly[owner] = notifyOnly
+	})
+	return allResourcesToTag, allNotifyOnly, nil
+}
+
+// withoutPolicyRulesMismatches removes the resources which don't match
+// the rules of their category in the policy from the collection, and
+// returns their IDs
+func withoutPolicyRulesMismatches(resources *cloud.AllResourceCollection, pol *policy.Policy) map[string]bool {
+	all := resources.Resources()
+	if f := pol.Filter(policy.Instances); f != nil {
+		resources.Instances = filter.Instances(resources.Instances, f)
+	}
+	if f := pol.Filter(policy.Images); f != nil {
+		resources.Images = filter.Images(resources.Images, f)
+	}
+	if f := pol.Filter(policy.Volumes); f != nil {
+		resources.Volumes = filter.Volumes(resources.Volumes, f)
+	}
+	if f := pol.Filter(policy.Snapshots); f != nil {
+		resources.Snapshots = filter.Snapshots(resources.Snapshots, f)
+	}
+	if f := pol.Filter(policy.Buckets); f != nil {
+		resources.Buckets = filter.Buckets(resources.Buckets, f)
+	}
+	kept := map[string]bool{}
+	for _, res := range resources.Resources() {
+		kept[res.ID()] = true
 	}
-	return allResourcesToTag
+	removed := map[string]bool{}
+	for _, res := range all {
+		if !kept[res.ID()] {
+			removed[res.ID()] = true
+		}
+	}
+	return removed
+}
+
+// splitBatches splits resources into the general batch and the batch of
+// unnamed instances, which holds the ones in unnamed
+func splitBatches(resources, unnamed []cloud.Resource) ([]cloud.Resource, []cloud.Resource) {
+	unnamedIDs := map[string]bool{}
+	for _, res := range unnamed {
+		unnamedIDs[res.ID()] = true
+	}
+	general := []cloud.Resource{}
+	unnamedResult := []cloud.Resource{}
+	for _, res := range resources {
+		if unnamedIDs[res.ID()] {
+			unnamedResult = append(unnamedResult, res)
+		} else {
+			general = append(general, res)
+		}
+	}
+	return general, unnamedResult
+}
+
+// splitNotifyOnly moves the resources of every category with the notify
+// action out of the collection, and returns them in a new collection
+func splitNotifyOnly(resources *cloud.AllResourceCollection, pol *policy.Policy) *cloud.AllResourceCollection {
+	notifyOnly := &cloud.AllResourceCollection{Owner: resources.Owner}
+	if pol.NotifyOnly(policy.Instances) {
+		notifyOnly.Instances, resources.Instances = resources.Instances, nil
+	}
+	if pol.NotifyOnly(policy.Images) {
+		notifyOnly.Images, resources.Images = resources.Images, nil
+	}
+	if pol.NotifyOnly(policy.Volumes) {
+		notifyOnly.Volumes, resources.Volumes = resources.Volumes, nil
+	}
+	if pol.NotifyOnly(policy.Snapshots) {
+		notifyOnly.Snapshots, resources.Snapshots = resources.Snapshots, nil
+	}
+	if pol.NotifyOnly(policy.Buckets) {
+		notifyOnly.Buckets, resources.Buckets = resources.Buckets, nil
+	}
+	return notifyOnly
 }
 
-func applyTags(resources []cloud.Resource, timeToDelete time.Time, totalCost float64, dryRun bool) {
+func withoutIDs(resources []cloud.Resource, ids map[string]bool) []cloud.Resource {
+	result := []cloud.Resource{}
+	for _, res := range resources {
+		if !ids[res.ID()] {
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+// ResourceCost returns the cost of a resource the same way it is counted
+// towards the total cost when marking resources
+func ResourceCost(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
+	return days * billing.ResourceCostPerDay(res)
+}
+
+// applyTags tags a batch of resources for deletion, unless they cost too
+// little to be worth bothering their owner about. Every resource is also
+// tagged with the version of the policy it was marked under. In a dry
+// run, nothing is tagged, but what would have been is logged.
+func applyTags(owner, batch string, resources []cloud.Resource, timeToDelete time.Time, version PolicyVersion, dryRun bool) {
+	resources, gate := applyCostGate(owner, batch, resources)
+	if gate.Tagged+gate.Skipped > 0 {
+		log.Printf("%s: %s", cloud.AccountDisplayName(owner), gate.Explanation())
+	}
 	if dryRun {
+		for _, res := range resources {
+			log.Printf("Would mark %s for deletion at %s (%s, $%.2f)\n", res.ID(), timeToDelete, DeleteReason(res), ResourceCost(res))
+			reportProgress(res, ActionMark, true, nil)
+		}
 		log.Printf("Resources not tagged since this is a dry run")
-	} else if totalCost < totalCostThreshold {
-		log.Printf("Resources not tagged since the total cost $%.2f is less than $%.2f", totalCost, totalCostThreshold)
 	} else {
 		for _, res := range resources {
-			err := res.SetTag(filter.DeleteTagKey, timeToDelete.Format(time.RFC3339), true)
+			value := filter.SignTagValue(res, filter.DeleteTagKey, timeToDelete.Format(time.RFC3339))
+			err := res.SetTag(filter.DeleteTagKey, value, true)
+			reportProgress(res, ActionMark, false, err)
 			if err != nil {
-				log.Printf("Failed to tag %s for deletion: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Marked %s for deletion at %s\n", res.ID(), timeToDelete)
+				status.ActionFailedf("Failed to tag %s for deletion: %s\n", res.ID(), err)
+				continue
+			}
+			reason := DeleteReason(res)
+			log.Printf("Marked %s for deletion at %s (%s)\n", res.ID(), timeToDelete, reason)
+			if options.Remarks != nil {
+				// Only resources not tagged for deletion are marked, so
+				// the tag was removed since it was last marked
+				if count := options.Remarks.Marked(owner, res.ID(), reason, version.String(), time.Now()); count > 0 {
+					log.Printf("%s in %s has been marked again %d times, after its delete tag was removed\n", res.ID(), cloud.AccountDisplayName(owner), count)
+				}
+			}
+			if reason != "" {
+				if err := res.SetTag(filter.DeleteReasonTagKey, reason, true); err != nil {
+					status.ActionFailedf("Failed to tag %s with the reason for deletion: %s\n", res.ID(), err)
+				}
+			}
+			if err := res.SetTag(filter.DeletePolicyTagKey, version.String(), true); err != nil {
+				status.ActionFailedf("Failed to tag %s with the policy it was marked under: %s\n", res.ID(), err)
 			}
 		}
 	}
@@ -234,11 +440,8 @@ func getAllButNLatestComponents(images []cloud.Image, componentsToKeep int) []cl
 	}
 
 	findThreshold := func(componentName string) time.Time {
-		times, found := componentDatesMap[componentName]
-		if !found {
-			log.Fatalln("Times not found for some reason")
-			return time.Now().AddDate(-10, 0, 0)
-		}
+		// Every component was added to the map above
+		times := componentDatesMap[componentName]
 
 		sort.Slice(times, func(i, j int) bool {
 			// Sort times so that newest are first
@@ -265,97 +468,228 @@ func getAllButNLatestComponents(images []cloud.Image, componentsToKeep int) []cl
 }
 
 // PerformCleanup will run different cleanup functions which all
-// do some sort of rule based cleanup
-func PerformCleanup(mngr cloud.ResourceManager) {
+// do some sort of rule based cleanup. It returns the terminated instances
+// of every account which left Elastic IPs or alarms behind.
+func PerformCleanup(mngr cloud.ResourceManager) map[string][]*TerminatedInstance {
 	// Cleanup all resources with a lifetime tag that has passed. This
 	// includes both the lifetime and the expiry tag
-	cleanupLifetimePassed(mngr)
+	return cleanupLifetimePassed(mngr)
 }
 
-func cleanupLifetimePassed(mngr cloud.ResourceManager) {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	for owner, resources := range allResources {
-		log.Println("Performing lifetime check in", owner)
+func cleanupLifetimePassed(mngr cloud.ResourceManager) map[string][]*TerminatedInstance {
+	terminated := make(map[string][]*TerminatedInstance)
+	mngr.ForEachAccountResources(func(resources *cloud.AllResourceCollection) {
+		owner := resources.Owner
+		log.Println("Performing lifetime check in", cloud.AccountDisplayName(owner))
+		forgetUndeletable(owner)
 		lifetimeFilter := filter.New()
 		lifetimeFilter.AddGeneralRule(filter.LifetimeExceeded())
+		lifetimeFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(options.Disputed)))
+		lifetimeFilter.AddGeneralRule(notBackupManaged)
+		lifetimeFilter.AddGeneralRule(notDLMManaged)
+		lifetimeFilter.AddGeneralRule(notNotifyOnly)
 
 		expiryFilter := filter.New()
 		expiryFilter.AddGeneralRule(filter.ExpiryDatePassed())
+		expiryFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(options.Disputed)))
+		expiryFilter.AddGeneralRule(notBackupManaged)
+		expiryFilter.AddGeneralRule(notDLMManaged)
+		expiryFilter.AddGeneralRule(notNotifyOnly)
+
+		// Resources marked under an outdated policy are kept or unmarked,
+		// rather than deleted under rules which no longer apply
+		outdated := handleOutdatedMarks(resources.Resources())
 
 		deleteAtFilter := filter.New()
 		deleteAtFilter.AddGeneralRule(filter.DeleteAtPassed())
-
-		err := mngr.CleanupInstances(filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup instances in %s, err:\n%s", owner, err)
+		deleteAtFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(options.Disputed)))
+		deleteAtFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(outdated)))
+		deleteAtFilter.AddGeneralRule(notBackupManaged)
+		deleteAtFilter.AddGeneralRule(notDLMManaged)
+		deleteAtFilter.AddGeneralRule(notNotifyOnly)
+		deleteAtFilter.AddImageRule(notRetained)
+
+		if !stepDone(owner, cloud.ResourceTypeInstances) {
+			instances := filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter)
+			instances = liveInstances(instances, lifetimeFilter, expiryFilter, deleteAtFilter)
+			if skipStopped(owner, "instances") {
+				return
+			}
+			instances = instancesPassingHooks(instances)
+			deleted, err := deleteEach(policy.Instances, (&cloud.AllResourceCollection{Instances: instances}).Resources(), func(res cloud.Resource) error {
+				return mngr.CleanupInstances([]cloud.Instance{res.(cloud.Instance)})
+			})
+			if err != nil {
+				status.ActionFailedf("Could not cleanup instances in %s, err:\n%s", cloud.AccountDisplayName(owner), err)
+			}
+			terminatedInstances := []cloud.Instance{}
+			for _, res := range deleted {
+				terminatedInstances = append(terminatedInstances, res.(cloud.Instance))
+			}
+			if left := reportInstanceDebris(owner, terminatedInstances); len(left) > 0 {
+				terminated[owner] = left
+			}
+			checkpoint(owner, cloud.ResourceTypeInstances, err)
 		}
-		err = mngr.CleanupImages(filter.Images(resources.Images, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup images in %s, err:\n%s", owner, err)
+		if !stepDone(owner, cloud.ResourceTypeImages) {
+			images := filter.Images(resources.Images, lifetimeFilter, expiryFilter, deleteAtFilter)
+			if skipStopped(owner, "images") {
+				return
+			}
+			images = imagesPassingHooks(images)
+			_, err := deleteEach(policy.Images, (&cloud.AllResourceCollection{Images: images}).Resources(), func(res cloud.Resource) error {
+				return mngr.CleanupImages([]cloud.Image{res.(cloud.Image)})
+			})
+			if err != nil {
+				status.ActionFailedf("Could not cleanup images in %s, err:\n%s", cloud.AccountDisplayName(owner), err)
+			}
+			checkpoint(owner, cloud.ResourceTypeImages, err)
 		}
-		err = mngr.CleanupVolumes(filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup volumes in %s, err:\n%s", owner, err)
+		if !stepDone(owner, cloud.ResourceTypeVolumes) {
+			volumes := filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter)
+			volumes = liveVolumes(volumes, lifetimeFilter, expiryFilter, deleteAtFilter)
+			if skipStopped(owner, "volumes") {
+				return
+			}
+			volumes = volumesPassingHooks(volumes)
+			_, err := deleteEach(policy.Volumes, (&cloud.AllResourceCollection{Volumes: volumes}).Resources(), func(res cloud.Resource) error {
+				return mngr.CleanupVolumes([]cloud.Volume{res.(cloud.Volume)})
+			})
+			if err != nil {
+				status.ActionFailedf("Could not cleanup volumes in %s, err:\n%s", cloud.AccountDisplayName(owner), err)
+			}
+			checkpoint(owner, cloud.ResourceTypeVolumes, err)
 		}
-		err = mngr.CleanupSnapshots(filter.Snapshots(resources.Snapshots, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup snapshots in %s, err:\n%s", owner, err)
+		if !stepDone(owner, cloud.ResourceTypeSnapshots) {
+			snapshots := deletableSnapshots(filter.Snapshots(resources.Snapshots, lifetimeFilter, expiryFilter, deleteAtFilter))
+			if skipStopped(owner, "snapshots") {
+				return
+			}
+			snapshots = snapshotsPassingHooks(snapshots)
+			_, err := deleteEach(policy.Snapshots, (&cloud.AllResourceCollection{Snapshots: snapshots}).Resources(), func(res cloud.Resource) error {
+				return mngr.CleanupSnapshots([]cloud.Snapshot{res.(cloud.Snapshot)})
+			})
+			if err != nil {
+				status.ActionFailedf("Could not cleanup snapshots in %s, err:\n%s", cloud.AccountDisplayName(owner), err)
+			}
+			checkpoint(owner, cloud.ResourceTypeSnapshots, err)
 		}
-		if bucks, ok := allBuckets[owner]; ok {
-			err = mngr.CleanupBuckets(filter.Buckets(bucks, lifetimeFilter, expiryFilter, deleteAtFilter))
+		if !stepDone(owner, cloud.ResourceTypeBuckets) {
+			buckets := withConfirmedFees(deletableBuckets(filter.Buckets(resources.Buckets, lifetimeFilter, expiryFilter, deleteAtFilter)))
+			if skipStopped(owner, "buckets") {
+				return
+			}
+			buckets = bucketsPassingHooks(buckets)
+			_, err := deleteEach(policy.Buckets, (&cloud.AllResourceCollection{Buckets: buckets}).Resources(), func(res cloud.Resource) error {
+				return mngr.CleanupBuckets([]cloud.Bucket{res.(cloud.Bucket)})
+			})
 			if err != nil {
-				log.Printf("Could not cleanup buckets in %s, err:\n%s", owner, err)
+				status.ActionFailedf("Could not cleanup buckets in %s, err:\n%s", cloud.AccountDisplayName(owner), err)
 			}
+			checkpoint(owner, cloud.ResourceTypeBuckets, err)
 		}
-	}
+	})
+	return terminated
 }
 
-// ResetCloudsweeper will remove any cleanup tags existing in the accounts
-// associated with the provided resource manager
-func ResetCloudsweeper(mngr cloud.ResourceManager) {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-
-	for owner, res := range allResources {
-		log.Println("Resetting Cloudsweeper tags in", owner)
-		taggedFilter := filter.New()
-		taggedFilter.AddGeneralRule(filter.HasTag(filter.DeleteTagKey))
+// notNotifyOnly checks that a resource isn't in a category whose owners
+// are only notified, which is never deleted however it was tagged
+func notNotifyOnly(res cloud.Resource) bool {
+	return !options.HookPolicy.NotifyOnly(policy.CategoryOf(res))
+}
 
-		handleError := func(res cloud.Resource, err error) {
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
-			}
+// withConfirmedFees returns the buckets which can be deleted without a
+// large early deletion fee, or whose fees have been confirmed
+func withConfirmedFees(buckets []cloud.Bucket) []cloud.Bucket {
+	result := []cloud.Bucket{}
+	for _, bucket := range buckets {
+		if fee, unconfirmed := unconfirmedFee(bucket); unconfirmed {
+			status.Warnf("Not cleaning up bucket %s in %s, since deleting it has an early deletion fee of up to $%.2f. Run with --confirm-early-deletion-fees to delete it anyway", bucket.ID(), cloud.AccountDisplayName(bucket.Owner()), fee)
+			continue
 		}
+		result = append(result, bucket)
+	}
+	return result
+}
 
-		// Un-Tag instances
-		for _, res := range filter.Instances(res.Instances, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
-		}
+// unconfirmedFee returns the early deletion fee of a bucket, and true if
+// it's above the limit and hasn't been confirmed
+func unconfirmedFee(bucket cloud.Bucket) (float64, bool) {
+	fee := billing.BucketEarlyDeletionFee(bucket)
+	return fee, fee > options.EarlyDeletionFeeLimit && !options.ConfirmEarlyDeletionFees
+}
 
-		// Un-Tag volumes
-		for _, res := range filter.Volumes(res.Volumes, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+// CleanupEmptyBuckets will delete empty buckets older than the specified
+// number of days right away, instead of marking them for cleanup first.
+// Empty buckets, such as the ones left behind by CloudFormation, hold no
+// data and cost nothing, but clutter the accounts. Whitelisted, disputed
+// and buckets on the do-not-delete list are kept.
+func CleanupEmptyBuckets(mngr cloud.ResourceManager, days int, dndList map[string]bool, dryRun bool) {
+	emptyFilter := filter.New()
+	emptyFilter.AddBucketRule(filter.IsEmptyBucket())
+	emptyFilter.AddGeneralRule(filter.OlderThanXDays(days))
+	emptyFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(dndList)))
+	emptyFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(options.Disputed)))
+	mngr.ForEachAccountResources(func(resources *cloud.AllResourceCollection) {
+		if stepDone(resources.Owner, StepEmptyBuckets) {
+			return
 		}
-
-		// Un-Tag snapshots
-		for _, res := range filter.Snapshots(res.Snapshots, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+		empty := filter.Buckets(resources.Buckets, emptyFilter)
+		if len(empty) == 0 {
+			checkpoint(resources.Owner, StepEmptyBuckets, nil)
+			return
 		}
-
-		// Un-Tag images
-		for _, res := range filter.Images(res.Images, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+		if dryRun {
+			for _, bucket := range empty {
+				log.Printf("Would delete empty bucket %s in %s", bucket.ID(), cloud.AccountDisplayName(resources.Owner))
+				reportProgress(bucket, ActionDelete, true, nil)
+			}
+			return
+		}
+		empty = deletableBuckets(empty)
+		if skipStopped(resources.Owner, "empty buckets") {
+			return
 		}
+		empty = bucketsPassingHooks(empty)
+		log.Printf("Deleting %d empty buckets in %s", len(empty), cloud.AccountDisplayName(resources.Owner))
+		_, err := deleteEach(policy.Buckets, (&cloud.AllResourceCollection{Buckets: empty}).Resources(), func(res cloud.Resource) error {
+			return mngr.CleanupBuckets([]cloud.Bucket{res.(cloud.Bucket)})
+		})
+		if err != nil {
+			status.ActionFailedf("Could not delete empty buckets in %s, err:\n%s", cloud.AccountDisplayName(resources.Owner), err)
+		}
+		checkpoint(resources.Owner, StepEmptyBuckets, err)
+	})
+}
 
-		// Un-Tag buckets
-		if buck, ok := allBuckets[owner]; ok {
-			for _, res := range filter.Buckets(buck, taggedFilter) {
-				handleError(res, res.RemoveTag(filter.DeleteTagKey))
+// ResetCloudsweeper will remove any cleanup tags existing in the accounts
+// associated with the provided resource manager
+func ResetCloudsweeper(mngr cloud.ResourceManager) {
+	log.Println("Resetting Cloudsweeper tags in all accounts")
+	taggedFilter := filter.New()
+	taggedFilter.AddGeneralRule(filter.HasTag(filter.DeleteTagKey))
+
+	// Resources are un-tagged as soon as they are discovered
+	mngr.ForEachResource(func(res cloud.Resource) {
+		if !filter.Match(res, taggedFilter) {
+			return
+		}
+		err := res.RemoveTag(filter.DeleteTagKey)
+		reportProgress(res, ActionUnmark, false, err)
+		if err != nil {
+			status.ActionFailedf("Failed to remove tag on %s: %s\n", res.ID(), err)
+		} else {
+			if cloud.Tags(res.Tags()).Has(filter.DeleteReasonTagKey) {
+				if err := res.RemoveTag(filter.DeleteReasonTagKey); err != nil {
+					status.ActionFailedf("Failed to remove the reason tag on %s: %s\n", res.ID(), err)
+				}
 			}
+			if cloud.Tags(res.Tags()).Has(filter.DeletePolicyTagKey) {
+				if err := res.RemoveTag(filter.DeletePolicyTagKey); err != nil {
+					status.ActionFailedf("Failed to remove the policy tag on %s: %s\n", res.ID(), err)
+				}
+			}
+			log.Printf("Removed cleanup tag on %s in %s\n", res.ID(), cloud.AccountDisplayName(res.Owner()))
 		}
-
-	}
+	})
 }
@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// IdleDataCluster is a data processing cluster which hasn't run any work
+// for a while
+type IdleDataCluster struct {
+	Cluster cloud.DataCluster
+	// Terminated is true if the cluster has been terminated
+	Terminated bool
+}
+
+// Reason returns why the cluster is idle, which is also the reason it's
+// marked for termination
+func (c *IdleDataCluster) Reason() string {
+	return "idle-cluster"
+}
+
+// FindIdleDataClusters will find running data processing clusters older
+// than the specified number of hours, which didn't run any work in that
+// time, grouped per account. Whitelisted clusters are left out.
+func FindIdleDataClusters(mngr cloud.ResourceManager, hours int) map[string][]*IdleDataCluster {
+	result := make(map[string][]*IdleDataCluster)
+	clusterManager, ok := mngr.(cloud.DataClusterManager)
+	if !ok {
+		log.Println("Data processing clusters are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	clusterManager.ForEachAccountDataClusters(hours, func(account string, clusters []cloud.DataCluster) {
+		log.Printf("Checking %d data processing clusters in %s", len(clusters), cloud.AccountDisplayName(account))
+		idleSince := time.Now().Add(-time.Duration(hours) * time.Hour)
+		found := []*IdleDataCluster{}
+		for _, cluster := range clusters {
+			if filter.IsWhitelisted(cluster) || cluster.CreationTime().After(idleSince) {
+				continue
+			}
+			if cluster.LastActive().Before(idleSince) {
+				found = append(found, &IdleDataCluster{Cluster: cluster})
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupIdleDataClusters will mark idle clusters for termination in the
+// specified number of hours, and terminate the ones whose time to be
+// terminated has passed. Clusters which are no longer idle are never
+// found, so they aren't terminated even if they are still marked.
+// Termination protected clusters are only reported.
+func CleanupIdleDataClusters(found map[string][]*IdleDataCluster, hours int, dryRun bool) {
+	timeToDelete := time.Now().Add(time.Duration(hours) * time.Hour)
+	for owner, clusters := range found {
+		for _, idle := range clusters {
+			cluster := idle.Cluster
+			name := fmt.Sprintf("cluster %s in %s", cluster.ID(), cloud.AccountDisplayName(owner))
+			if cluster.TerminationProtected() {
+				log.Printf("Not marking %s, since it's termination protected", name)
+				continue
+			}
+			idle.Terminated = markOrDeleteIdle(policy.DataClusters, cluster, name, idle.Reason(), timeToDelete, dryRun)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"strings"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// TerminatedInstance is an instance terminated by cleanup, with the
+// Elastic IPs and alarms which referenced it
+type TerminatedInstance struct {
+	Instance cloud.Instance
+	Debris   *cloud.InstanceDebris
+}
+
+// reportInstanceDebris reports what referenced the instances which were
+// terminated, and returns the instances which left anything behind.
+// Elastic IPs which are still allocated are reported as warnings, since
+// they keep being billed.
+func reportInstanceDebris(owner string, instances []cloud.Instance) []*TerminatedInstance {
+	terminated := []*TerminatedInstance{}
+	for _, instance := range instances {
+		reporter, ok := instance.(cloud.DebrisReporter)
+		if !ok {
+			continue
+		}
+		debris := reporter.Debris()
+		if debris == nil || debris.Empty() {
+			continue
+		}
+		terminated = append(terminated, &TerminatedInstance{Instance: instance, Debris: debris})
+		if len(debris.Alarms) > 0 {
+			action := "Deleted"
+			if !debris.AlarmsDeleted {
+				action = "Could not delete"
+			}
+			log.Printf("%s alarms of terminated instance %s in %s: %s", action, instance.ID(), cloud.AccountDisplayName(owner), strings.Join(debris.Alarms, ", "))
+		}
+		for _, address := range debris.ElasticIPs {
+			if address.Released {
+				log.Printf("Released Elastic IP %s of terminated instance %s in %s", address.PublicIP, instance.ID(), cloud.AccountDisplayName(owner))
+				continue
+			}
+			status.Warnf("Elastic IP %s of terminated instance %s in %s is still allocated, costing $%.2f per month. Run with --release-elastic-ips to release it", address.PublicIP, instance.ID(), cloud.AccountDisplayName(owner), billing.ElasticIPCostPerMonth())
+		}
+	}
+	return terminated
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// The verdicts of comparing the retention of a lifecycle policy schedule
+// with when Cloudsweeper cleans up snapshots
+const (
+	// RetentionExcluded means that Cloudsweeper leaves the snapshots of
+	// lifecycle policies alone
+	RetentionExcluded = "excluded"
+	// RetentionUnmanaged means that the snapshots of a disabled policy
+	// are left alone by Cloudsweeper, so nothing ever deletes them
+	RetentionUnmanaged = "unmanaged"
+	// RetentionConflict means that Cloudsweeper marks snapshots which the
+	// policy still retains
+	RetentionConflict = "conflict"
+	// RetentionOverlap means that the policy deletes snapshots before
+	// Cloudsweeper would mark them
+	RetentionOverlap = "overlap"
+	// RetentionNotifyOnly means that Cloudsweeper only notifies about the
+	// snapshots, and never marks them
+	RetentionNotifyOnly = "notify-only"
+	// RetentionUnknown means that the retention of the schedule can't be
+	// compared, since it's unknown or a Rego policy decides on snapshots
+	RetentionUnknown = "unknown"
+)
+
+// RetentionComparison compares how long a schedule of a lifecycle policy
+// retains its snapshots with how old snapshots are when Cloudsweeper
+// marks them
+type RetentionComparison struct {
+	Policy   cloud.LifecyclePolicy
+	Schedule cloud.LifecycleSchedule
+	// CleanupDays is how old unused snapshots are when marked
+	CleanupDays int
+	Verdict     string
+}
+
+// CompareLifecyclePolicies compares the retention of every schedule of
+// the lifecycle policies in every account, such as Amazon Data Lifecycle
+// Manager policies, with the age at which snapshots are marked by
+// Cloudsweeper, so that overlapping or conflicting retention is visible.
+// The comparisons of every account are sorted with conflicts first.
+func CompareLifecyclePolicies(mngr cloud.ResourceManager, cleanupDays int, pol *policy.Policy) map[string][]*RetentionComparison {
+	result := make(map[string][]*RetentionComparison)
+	lifecycleManager, ok := mngr.(cloud.LifecyclePolicyManager)
+	if !ok {
+		log.Println("Lifecycle policies are not supported")
+		return result
+	}
+	lifecycleManager.ForEachAccountLifecyclePolicies(func(account string, policies []cloud.LifecyclePolicy) {
+		log.Printf("Comparing %d lifecycle policies in %s", len(policies), cloud.AccountDisplayName(account))
+		comparisons := []*RetentionComparison{}
+		for _, lifecyclePolicy := range policies {
+			for _, schedule := range lifecyclePolicy.Schedules {
+				comparisons = append(comparisons, &RetentionComparison{
+					Policy:      lifecyclePolicy,
+					Schedule:    schedule,
+					CleanupDays: cleanupDays,
+					Verdict:     retentionVerdict(lifecyclePolicy, schedule, cleanupDays, pol),
+				})
+			}
+		}
+		sort.SliceStable(comparisons, func(i, j int) bool {
+			if verdictOrder[comparisons[i].Verdict] != verdictOrder[comparisons[j].Verdict] {
+				return verdictOrder[comparisons[i].Verdict] < verdictOrder[comparisons[j].Verdict]
+			}
+			if comparisons[i].Policy.Location != comparisons[j].Policy.Location {
+				return comparisons[i].Policy.Location < comparisons[j].Policy.Location
+			}
+			return comparisons[i].Policy.ID < comparisons[j].Policy.ID
+		})
+		result[account] = comparisons
+	})
+	return result
+}
+
+// verdictOrder lists the verdicts needing attention first
+var verdictOrder = map[string]int{
+	RetentionConflict:   0,
+	RetentionUnmanaged:  1,
+	RetentionUnknown:    2,
+	RetentionOverlap:    3,
+	RetentionNotifyOnly: 4,
+	RetentionExcluded:   5,
+}
+
+func retentionVerdict(lifecyclePolicy cloud.LifecyclePolicy, schedule cloud.LifecycleSchedule, cleanupDays int, pol *policy.Policy) string {
+	switch {
+	case options.ExcludeDLMManaged && !lifecyclePolicy.Enabled:
+		return RetentionUnmanaged
+	case options.ExcludeDLMManaged:
+		return RetentionExcluded
+	case pol.UsesRego() || schedule.RetentionDays() == 0:
+		return RetentionUnknown
+	case pol.NotifyOnly(policy.Snapshots):
+		return RetentionNotifyOnly
+	case !lifecyclePolicy.Enabled || schedule.RetentionDays() > cleanupDays:
+		// Snapshots of disabled policies are never deleted by them
+		return RetentionConflict
+	}
+	return RetentionOverlap
+}
+
+// withoutDLMManaged removes the snapshots created by lifecycle policies
+// from the collection, and returns their IDs
+func withoutDLMManaged(resources *cloud.AllResourceCollection) map[string]bool {
+	ids := map[string]bool{}
+	kept := cloud.AllResourceCollection{Owner: resources.Owner}
+	isManaged := filter.IsDLMManaged()
+	for _, res := range resources.Resources() {
+		if isManaged(res) {
+			ids[res.ID()] = true
+		} else {
+			addResource(&kept, res)
+		}
+	}
+	if len(ids) == 0 {
+		return ids
+	}
+	log.Printf("%s: Not marking %d snapshots managed by lifecycle policies", cloud.AccountDisplayName(resources.Owner), len(ids))
+	*resources = kept
+	return ids
+}
+
+// notDLMManaged checks that a resource wasn't created by a lifecycle
+// policy, unless those aren't excluded
+func notDLMManaged(res cloud.Resource) bool {
+	return !options.ExcludeDLMManaged || !filter.IsDLMManaged()(res)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// IdleFileSystem is a file system which isn't mounted anywhere, or
+// hasn't had any IO for a while
+type IdleFileSystem struct {
+	FileSystem cloud.FileSystem
+	// Unmounted is true if the file system has no mount targets
+	Unmounted bool
+	// NoIO is true if the file system had no IO in the days searched
+	NoIO bool
+	// Deleted is true if the file system has been deleted
+	Deleted bool
+}
+
+// FindIdleFileSystems will find file systems older than the specified
+// number of days, which have no mount targets or had no IO in that time,
+// grouped per account. Whitelisted file systems are left out.
+func FindIdleFileSystems(mngr cloud.ResourceManager, days int) map[string][]*IdleFileSystem {
+	result := make(map[string][]*IdleFileSystem)
+	fileSystemManager, ok := mngr.(cloud.FileSystemManager)
+	if !ok {
+		log.Println("File systems are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	olderThan := filter.OlderThanXDays(days)
+	notUsed := filter.NotUsedInXDays(days)
+	fileSystemManager.ForEachAccountFileSystems(days, func(account string, fileSystems []cloud.FileSystem) {
+		log.Printf("Checking %d file systems in %s", len(fileSystems), cloud.AccountDisplayName(account))
+		found := []*IdleFileSystem{}
+		for _, fileSystem := range fileSystems {
+			if filter.IsWhitelisted(fileSystem) || !olderThan(fileSystem) {
+				continue
+			}
+			idle := &IdleFileSystem{
+				FileSystem: fileSystem,
+				Unmounted:  fileSystem.MountTargets() == 0,
+				NoIO:       notUsed(fileSystem),
+			}
+			if idle.Unmounted || idle.NoIO {
+				found = append(found, idle)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// Reason returns why the file system is idle, which is also the reason
+// it's marked for deletion
+func (f *IdleFileSystem) Reason() string {
+	if f.Unmounted {
+		return "unmounted-file-system"
+	}
+	return "file-system-without-io"
+}
+
+// CleanupIdleFileSystems will mark idle file systems for deletion in the
+// specified number of days, and delete the ones whose time to be deleted
+// has passed. File systems which are no longer idle are never found, so
+// they aren't deleted even if they are still marked.
+func CleanupIdleFileSystems(found map[string][]*IdleFileSystem, days int, dryRun bool) {
+	timeToDelete := time.Now().AddDate(0, 0, days)
+	for owner, fileSystems := range found {
+		for _, idle := range fileSystems {
+			fileSystem := idle.FileSystem
+			name := fmt.Sprintf("%s %s in %s", fileSystem.Kind(), fileSystem.ID(), cloud.AccountDisplayName(owner))
+			idle.Deleted = markOrDeleteIdle(policy.FileSystems, fileSystem, name, idle.Reason(), timeToDelete, dryRun)
+		}
+	}
+}
+
+// markOrDeleteIdle deletes an idle resource if its time to be deleted has
+// passed, and marks it for deletion at timeToDelete with the reason if it
+// isn't marked yet. The pre-delete and post-delete hooks of the category
+// are run around the delete. It returns true if the resource was deleted.
+func markOrDeleteIdle(category string, res cloud.Resource, name, reason string, timeToDelete time.Time, dryRun bool) bool {
+	if filter.DeleteAtPassed()(res) {
+		if dryRun {
+			log.Printf("Would delete %s", name)
+			return false
+		}
+		if !preDelete(category, res) {
+			return false
+		}
+		if err := res.Cleanup(); err != nil {
+			status.ActionFailedf("Could not delete %s: %s", name, err)
+			return false
+		}
+		postDelete(category, res)
+		return true
+	}
+	if filter.TaggedForCleanup()(res) {
+		return false
+	}
+	if dryRun {
+		log.Printf("Would mark %s for deletion at %s", name, timeToDelete)
+		return false
+	}
+	value := filter.SignTagValue(res, filter.DeleteTagKey, timeToDelete.Format(time.RFC3339))
+	if err := res.SetTag(filter.DeleteTagKey, value, true); err != nil {
+		status.ActionFailedf("Failed to tag %s for deletion: %s", name, err)
+		return false
+	}
+	recordDeleteReason(res, reason)
+	if err := res.SetTag(filter.DeleteReasonTagKey, reason, true); err != nil {
+		status.ActionFailedf("Failed to tag %s with the reason for deletion: %s", name, err)
+	}
+	log.Printf("Marked %s for deletion at %s", name, timeToDelete)
+	return false
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// freezeNoticeDays is the number of days after a freeze that resources
+// whose marks expired during it are deleted, like resources marked the
+// day the freeze ended
+const freezeNoticeDays = 4
+
+// maxFreezeDays is the longest freeze looked for, so that a window which
+// never ends, such as every day, doesn't postpone deletions forever
+const maxFreezeDays = 366
+
+// FreezeWindow is a set of days during which changes are frozen, either
+// a range of dates such as 2026-12-20..2027-01-04, or a cron-like
+// expression with the day of the month, month and day of the week, such
+// as "* * sat,sun" for every weekend or "24-31 12 *" for the end of every
+// December. Days are in the local time zone.
+type FreezeWindow struct {
+	Spec string
+
+	from, to   time.Time
+	monthDays  map[int]bool
+	months     map[int]bool
+	weekdays   map[int]bool
+	isCronLike bool
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseFreezeWindows parses freeze windows separated by semicolons, since
+// cron-like expressions use commas for lists
+func ParseFreezeWindows(raw string) ([]FreezeWindow, error) {
+	result := []FreezeWindow{}
+	for _, spec := range strings.Split(raw, ";") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		window, err := ParseFreezeWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, window)
+	}
+	return result, nil
+}
+
+// ParseFreezeWindow parses a single freeze window, which is a date, a
+// range of dates or a cron-like expression
+func ParseFreezeWindow(spec string) (FreezeWindow, error) {
+	window := FreezeWindow{Spec: spec}
+	fields := strings.Fields(spec)
+	if len(fields) == 3 {
+		var err error
+		window.isCronLike = true
+		if window.monthDays, err = parseCronField(fields[0], 1, 31, nil); err != nil {
+			return window, fmt.Errorf("Invalid day of the month in freeze window '%s': %s", spec, err)
+		}
+		if window.months, err = parseCronField(fields[1], 1, 12, monthNames); err != nil {
+			return window, fmt.Errorf("Invalid month in freeze window '%s': %s", spec, err)
+		}
+		if window.weekdays, err = parseCronField(fields[2], 0, 6, weekdayNames); err != nil {
+			return window, fmt.Errorf("Invalid day of the week in freeze window '%s': %s", spec, err)
+		}
+		return window, nil
+	}
+	from, to := spec, spec
+	if parts := strings.SplitN(spec, "..", 2); len(parts) == 2 {
+		from, to = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	var err error
+	if window.from, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+		return window, fmt.Errorf("Freeze window '%s' is neither a date range like 2026-12-20..2027-01-04 nor a cron-like expression like '* * sat,sun'", spec)
+	}
+	if window.to, err = time.ParseInLocation("2006-01-02", to, time.Local); err != nil {
+		return window, fmt.Errorf("Invalid end date of freeze window '%s'", spec)
+	}
+	if window.to.Before(window.from) {
+		return window, fmt.Errorf("Freeze window '%s' ends before it starts", spec)
+	}
+	return window, nil
+}
+
+// parseCronField parses a field of a cron-like expression, which is *
+// or a list of values and ranges separated by commas. Values can also be
+// the names of months or days, if there are any.
+func parseCronField(field string, min, max int, names []string) (map[int]bool, error) {
+	if field == "*" {
+		return nil, nil
+	}
+	result := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		first, last := item, item
+		if parts := strings.SplitN(item, "-", 2); len(parts) == 2 {
+			first, last = parts[0], parts[1]
+		}
+		from, err := parseCronValue(first, min, max, names)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseCronValue(last, min, max, names)
+		if err != nil {
+			return nil, err
+		}
+		if to < from {
+			return nil, fmt.Errorf("range %s ends before it starts", item)
+		}
+		for v := from; v <= to; v++ {
+			result[v] = true
+		}
+	}
+	return result, nil
+}
+
+func parseCronValue(value string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%s is not a number between %d and %d", value, min, max)
+	}
+	return v, nil
+}
+
+// Contains returns true if the day of the specified time is frozen
+func (w FreezeWindow) Contains(t time.Time) bool {
+	t = t.In(time.Local)
+	if !w.isCronLike {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		return !day.Before(w.from) && !day.After(w.to)
+	}
+	return cronMatch(w.monthDays, t.Day()) && cronMatch(w.months, int(t.Month())) && cronMatch(w.weekdays, int(t.Weekday()))
+}
+
+func cronMatch(values map[int]bool, value int) bool {
+	return values == nil || values[value]
+}
+
+// ActiveFreeze returns the freeze window the specified time is in, if any
+func ActiveFreeze(t time.Time) (FreezeWindow, bool) {
+	for _, window := range options.FreezeWindows {
+		if window.Contains(t) {
+			return window, true
+		}
+	}
+	return FreezeWindow{}, false
+}
+
+// FreezeEnd returns when the freeze the specified time is in ends, which
+// is the start of the first day which isn't frozen. If the time isn't in
+// a freeze, it's returned as is.
+func FreezeEnd(t time.Time) time.Time {
+	if _, frozen := ActiveFreeze(t); !frozen {
+		return t
+	}
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	for i := 0; i < maxFreezeDays; i++ {
+		day = day.AddDate(0, 0, 1)
+		if _, frozen := ActiveFreeze(day); !frozen {
+			return day
+		}
+	}
+	return day
+}
+
+// postponeForFreeze returns when a resource marked now for deletion at
+// the specified time is deleted. Resources which would be deleted during
+// a freeze are given the same notice again once it has ended.
+func postponeForFreeze(timeToDelete time.Time) time.Time {
+	end := FreezeEnd(timeToDelete)
+	if end.Equal(timeToDelete) {
+		return timeToDelete
+	}
+	return end.Add(time.Until(timeToDelete))
+}
+
+// PostponeFrozenMarks postpones the deletion of every resource marked to
+// be deleted before the current freeze ends, since nothing is cleaned up
+// during it. They are deleted freezeNoticeDays after the freeze, so that
+// their owners are warned first. Resources with a lifetime or expiry tag
+// are kept until the freeze ends as well, as cleanup is skipped.
+func PostponeFrozenMarks(mngr cloud.ResourceManager, dryRun bool) {
+	window, frozen := ActiveFreeze(time.Now())
+	if !frozen {
+		return
+	}
+	end := FreezeEnd(time.Now())
+	postponed := end.AddDate(0, 0, freezeNoticeDays)
+	count := 0
+	var countMutex sync.Mutex
+	mngr.ForEachResource(func(res cloud.Resource) {
+		value, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey)
+		if !exist {
+			return
+		}
+		current, err := cloud.ParseTagTime(value)
+		if err != nil || !current.Before(end) {
+			return
+		}
+		if dryRun {
+			log.Printf("Would postpone the deletion of %s from %s to %s, because of the freeze %s", res.ID(), current, postponed, window.Spec)
+			return
+		}
+		value = filter.SignTagValue(res, filter.DeleteTagKey, postponed.Format(time.RFC3339))
+		if err := res.SetTag(filter.DeleteTagKey, value, true); err != nil {
+			status.ActionFailedf("Failed to postpone the deletion of %s: %s\n", res.ID(), err)
+			return
+		}
+		log.Printf("Postponed the deletion of %s from %s to %s, because of the freeze %s", res.ID(), current, postponed, window.Spec)
+		countMutex.Lock()
+		defer countMutex.Unlock()
+		count++
+	})
+	status.Notef("Change freeze '%s' until %s, cleanup skipped and %d marks postponed to %s", window.Spec, end.Format("2006-01-02"), count, postponed.Format("2006-01-02"))
+}
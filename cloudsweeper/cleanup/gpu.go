@@ -0,0 +1,119 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// IdleGPUInstance is a running GPU instance which hasn't been used for a
+// while
+type IdleGPUInstance struct {
+	Instance    cloud.Instance
+	Utilization cloud.GPUUtilization
+	// Deleted is true if the instance has been deleted
+	Deleted bool
+}
+
+// Reason returns why the instance is idle, which is also the reason it's
+// marked for deletion
+func (i *IdleGPUInstance) Reason() string {
+	return "idle-gpu-instance"
+}
+
+// CostPerDay returns what the instance costs per day, in USD
+func (i *IdleGPUInstance) CostPerDay() float64 {
+	return billing.InstancePricePerHour(i.Instance) * 24
+}
+
+// FindIdleGPUInstances will find GPU instances which have been running
+// for more than the specified number of hours, and used less than the
+// specified percent of their busiest GPU in every hour of that time,
+// grouped per account and sorted by their cost. Instances whose GPU
+// utilization isn't reported are idle if they used less than that
+// percent of their CPUs. Whitelisted instances, and instances not
+// matching the rules of the GPU instances category of the policy, are
+// left out.
+func FindIdleGPUInstances(mngr cloud.ResourceManager, hours, percent int, pol *policy.Policy) map[string][]*IdleGPUInstance {
+	result := make(map[string][]*IdleGPUInstance)
+	var resultMutex sync.Mutex
+	rules := pol.Filter(policy.GPUInstances)
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		runningSince := time.Now().Add(-time.Duration(hours) * time.Hour)
+		found := []*IdleGPUInstance{}
+		for _, inst := range res.Instances {
+			if !cloud.IsGPUInstanceType(inst.InstanceType()) || filter.IsWhitelisted(inst) || inst.CreationTime().After(runningSince) {
+				continue
+			}
+			if rules != nil && !filter.Match(inst, rules) {
+				continue
+			}
+			reporter, ok := inst.(cloud.GPUUtilizationReporter)
+			if !ok {
+				continue
+			}
+			utilization, err := reporter.GPUUtilization(hours)
+			if err != nil {
+				log.Printf("Could not look up the utilization of %s in %s: %s", inst.ID(), cloud.AccountDisplayName(res.Owner), err)
+				continue
+			}
+			busiest := utilization.CPUPercentMax
+			if utilization.GPUKnown {
+				busiest = utilization.GPUPercentMax
+			}
+			if busiest < float64(percent) {
+				found = append(found, &IdleGPUInstance{Instance: inst, Utilization: utilization})
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		log.Printf("Found %d idle GPU instances in %s", len(found), cloud.AccountDisplayName(res.Owner))
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[res.Owner] = found
+	})
+	// Prices are looked up one at a time, since they're cached
+	for _, instances := range result {
+		sort.Slice(instances, func(i, j int) bool {
+			a, b := instances[i], instances[j]
+			if a.CostPerDay() != b.CostPerDay() {
+				return a.CostPerDay() > b.CostPerDay()
+			}
+			return a.Instance.ID() < b.Instance.ID()
+		})
+	}
+	return result
+}
+
+// CleanupIdleGPUInstances will mark idle GPU instances for deletion in
+// the specified number of hours, and delete the ones whose time to be
+// deleted has passed, unless the policy only notifies about GPU
+// instances. The pre-delete and post-delete hooks of the GPU instances
+// category are run around every delete. Instances which are no longer
+// idle are never found, so they aren't deleted by this even if they are
+// still marked.
+func CleanupIdleGPUInstances(found map[string][]*IdleGPUInstance, hours int, pol *policy.Policy, dryRun bool) {
+	if pol.NotifyOnly(policy.GPUInstances) {
+		log.Println("Not marking idle GPU instances, since the policy only notifies about them")
+		return
+	}
+	timeToDelete := time.Now().Add(time.Duration(hours) * time.Hour)
+	for owner, instances := range found {
+		for _, idle := range instances {
+			inst := idle.Instance
+			name := fmt.Sprintf("GPU instance %s in %s", inst.ID(), cloud.AccountDisplayName(owner))
+			idle.Deleted = markOrDeleteIdle(policy.GPUInstances, inst, name, idle.Reason(), timeToDelete, dryRun)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+func hookEvent(event, category string, res cloud.Resource) policy.HookEvent {
+	return policy.HookEvent{
+		Event:    event,
+		Category: category,
+		CSP:      string(res.CSP()),
+		Account:  res.Owner(),
+		ID:       res.ID(),
+		Location: res.Location(),
+		Tags:     res.Tags(),
+	}
+}
+
+// preDelete runs the pre-delete hooks of a category for a resource, and
+// returns false if any of them failed, in which case the resource must
+// not be deleted. Later hooks aren't run once one has failed.
+func preDelete(category string, res cloud.Resource) bool {
+	for _, hook := range options.HookPolicy.PreDeleteHooks(category) {
+		if err := hook.Run(hookEvent(policy.EventPreDelete, category, res)); err != nil {
+			status.ActionFailedf("Pre-delete hook failed for %s in %s, not deleting it: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+			reportProgress(res, ActionDelete, false, err)
+			return false
+		}
+	}
+	return true
+}
+
+// postDelete runs the post-delete hooks of a category for a resource
+// which was deleted
+func postDelete(category string, res cloud.Resource) {
+	for _, hook := range options.HookPolicy.PostDeleteHooks(category) {
+		if err := hook.Run(hookEvent(policy.EventPostDelete, category, res)); err != nil {
+			status.ActionFailedf("Post-delete hook failed for %s in %s: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+		}
+	}
+}
+
+// deleteEach deletes every resource on its own with del, so that it's
+// known which of them were deleted. The resources are deleted in parallel,
+// in chunks of at most DeletesPerMinute which are throttled, and the
+// resources left are skipped if cleanup is stopped. The progress of every
+// delete is reported, and the post-delete hooks of the category are run
+// for the resources which were deleted, even if others failed. It
+// returns the resources which were deleted, and an error if deleting any
+// of them failed.
+func deleteEach(category string, resources []cloud.Resource, del func(cloud.Resource) error) ([]cloud.Resource, error) {
+	deleted := []cloud.Resource{}
+	failed := 0
+	for left := resources; len(left) > 0; {
+		chunk := left
+		if options.DeletesPerMinute > 0 && len(chunk) > options.DeletesPerMinute {
+			chunk = chunk[:options.DeletesPerMinute]
+		}
+		left = left[len(chunk):]
+		if !throttleDeletes(chunk[0].Owner(), category, len(chunk)) {
+			break
+		}
+		errs := make([]error, len(chunk))
+		var wg sync.WaitGroup
+		wg.Add(len(chunk))
+		for i := range chunk {
+			go func(index int) {
+				defer wg.Done()
+				errs[index] = del(chunk[index])
+			}(i)
+		}
+		wg.Wait()
+		for i, res := range chunk {
+			reportProgress(res, ActionDelete, false, errs[i])
+			if errs[i] != nil {
+				log.Printf("Could not delete %s in %s: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), errs[i])
+				failed++
+				continue
+			}
+			deleted = append(deleted, res)
+			postDelete(category, res)
+		}
+	}
+	if failed > 0 {
+		return deleted, fmt.Errorf("%d of %d %s could not be deleted", failed, len(resources), category)
+	}
+	return deleted, nil
+}
+
+// The functions below return the resources whose pre-delete hooks all
+// succeeded
+
+func instancesPassingHooks(instances []cloud.Instance) []cloud.Instance {
+	result := []cloud.Instance{}
+	for _, instance := range instances {
+		if preDelete(policy.Instances, instance) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+func imagesPassingHooks(images []cloud.Image) []cloud.Image {
+	result := []cloud.Image{}
+	for _, image := range images {
+		if preDelete(policy.Images, image) {
+			result = append(result, image)
+		}
+	}
+	return result
+}
+
+func volumesPassingHooks(volumes []cloud.Volume) []cloud.Volume {
+	result := []cloud.Volume{}
+	for _, volume := range volumes {
+		if preDelete(policy.Volumes, volume) {
+			result = append(result, volume)
+		}
+	}
+	return result
+}
+
+func snapshotsPassingHooks(snapshots []cloud.Snapshot) []cloud.Snapshot {
+	result := []cloud.Snapshot{}
+	for _, snapshot := range snapshots {
+		if preDelete(policy.Snapshots, snapshot) {
+			result = append(result, snapshot)
+		}
+	}
+	return result
+}
+
+func bucketsPassingHooks(buckets []cloud.Bucket) []cloud.Bucket {
+	result := []cloud.Bucket{}
+	for _, bucket := range buckets {
+		if preDelete(policy.Buckets, bucket) {
+			result = append(result, bucket)
+		}
+	}
+	return result
+}
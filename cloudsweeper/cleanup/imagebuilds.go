@@ -0,0 +1,106 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// packerManifest is the format of the manifest written by the manifest
+// post-processor of Packer
+type packerManifest struct {
+	Builds []struct {
+		Name        string `json:"name"`
+		BuilderType string `json:"builder_type"`
+		BuildTime   int64  `json:"build_time"`
+		// ArtifactID is e.g. "us-east-1:ami-123,us-west-2:ami-456" for the
+		// Amazon builders
+		ArtifactID    string `json:"artifact_id"`
+		PackerRunUUID string `json:"packer_run_uuid"`
+	} `json:"builds"`
+}
+
+// ImageBuilderKeepList returns the IDs of the images produced by the
+// latest builds of every Image Builder recipe, keep builds per recipe
+func ImageBuilderKeepList(mngr cloud.ResourceManager, keep int) map[string]bool {
+	result := map[string]bool{}
+	buildManager, ok := mngr.(cloud.ImageBuildManager)
+	if !ok {
+		log.Println("Image pipelines are not supported")
+		return result
+	}
+	builds := []cloud.ImageBuild{}
+	buildManager.ForEachAccountImageBuilds(func(account string, accountBuilds []cloud.ImageBuild) {
+		log.Printf("Found %d image builds in %s", len(accountBuilds), cloud.AccountDisplayName(account))
+		builds = append(builds, accountBuilds...)
+	})
+	for id := range keepLatestBuilds(builds, keep) {
+		result[id] = true
+	}
+	return result
+}
+
+// PackerKeepList returns the IDs of the AMIs produced by the latest
+// builds in a Packer manifest, keep builds per build name
+func PackerKeepList(r io.Reader, keep int) (map[string]bool, error) {
+	manifest := packerManifest{}
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Could not parse Packer manifest: %s", err)
+	}
+	builds := []cloud.ImageBuild{}
+	for _, packerBuild := range manifest.Builds {
+		build := cloud.ImageBuild{
+			Recipe:  packerBuild.Name,
+			Version: packerBuild.PackerRunUUID,
+			Created: time.Unix(packerBuild.BuildTime, 0),
+		}
+		for _, artifact := range strings.Split(packerBuild.ArtifactID, ",") {
+			// Artifacts of the Amazon builders are <region>:<AMI ID>
+			parts := strings.SplitN(strings.TrimSpace(artifact), ":", 2)
+			if len(parts) == 2 && strings.HasPrefix(parts[1], "ami-") {
+				build.ImageIDs = append(build.ImageIDs, parts[1])
+			}
+		}
+		if len(build.ImageIDs) > 0 {
+			builds = append(builds, build)
+		}
+	}
+	return keepLatestBuilds(builds, keep), nil
+}
+
+// keepLatestBuilds returns the IDs of the images produced by the keep
+// latest builds of every recipe in every account
+func keepLatestBuilds(builds []cloud.ImageBuild, keep int) map[string]bool {
+	perRecipe := map[string][]cloud.ImageBuild{}
+	for _, build := range builds {
+		key := build.Account + "/" + build.Recipe
+		perRecipe[key] = append(perRecipe[key], build)
+	}
+	result := map[string]bool{}
+	for _, recipeBuilds := range perRecipe {
+		sort.Slice(recipeBuilds, func(i, j int) bool {
+			// Sort builds so that newest are first
+			return recipeBuilds[i].Created.After(recipeBuilds[j].Created)
+		})
+		for i := 0; i < keep && i < len(recipeBuilds); i++ {
+			for _, id := range recipeBuilds[i].ImageIDs {
+				result[id] = true
+			}
+		}
+	}
+	return result
+}
+
+// notRetained checks that an image isn't one of the RetainedImages
+func notRetained(img cloud.Image) bool {
+	return !options.RetainedImages[img.ID()]
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// ImageCopyGroup holds the copies of one image in an account, such as an
+// AMI copied to several regions. The source image itself is always kept.
+type ImageCopyGroup struct {
+	Name           string
+	SourceID       string
+	SourceLocation string
+	// Used are the copies which are kept, since they are in use or in a
+	// location where copies are always kept
+	Used []cloud.Image
+	// Unused are the copies which can be removed
+	Unused []cloud.Image
+	// Removed holds the IDs of the unused copies which have been removed
+	Removed map[string]bool
+}
+
+// UsedLocations returns the locations of the copies which are kept
+func (g *ImageCopyGroup) UsedLocations() string {
+	locations := []string{}
+	for _, img := range g.Used {
+		locations = append(locations, img.Location())
+	}
+	sort.Strings(locations)
+	return strings.Join(locations, ", ")
+}
+
+// SizeGB returns the total size of the snapshots of the unused copies
+func (g *ImageCopyGroup) SizeGB() int64 {
+	var total int64
+	for _, img := range g.Unused {
+		total += img.SizeGB()
+	}
+	return total
+}
+
+// SavingsPerMonth returns the estimated monthly savings, in USD, of
+// removing the unused copies along with their snapshots
+func (g *ImageCopyGroup) SavingsPerMonth() float64 {
+	total := 0.0
+	for _, img := range g.Unused {
+		total += billing.ImageCostPerDay(img) * 30.0
+	}
+	return total
+}
+
+// FindImageCopies will find images which were copied to other locations
+// of the same account, grouped per account. Copies are found from the
+// source the CSP records for them, and images without one are grouped by
+// name, with the oldest one as the source. A copy is unused unless an
+// instance was launched from it in the specified number of days, or it
+// was made in that time, it's in one of the locations to keep, or it's
+// whitelisted. Only groups with unused copies are returned.
+func FindImageCopies(mngr cloud.ResourceManager, keepLocations []string, days int) map[string][]*ImageCopyGroup {
+	result := make(map[string][]*ImageCopyGroup)
+	var resultMutex sync.Mutex
+	keep := make(map[string]bool)
+	for _, location := range keepLocations {
+		keep[location] = true
+	}
+	usedSince := time.Now().AddDate(0, 0, -days)
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		running := make(map[string]bool)
+		for _, inst := range res.Instances {
+			if launched, ok := inst.(cloud.InstanceImage); ok {
+				running[launched.ImageID()] = true
+			}
+		}
+		used := func(img cloud.Image) bool {
+			return running[img.ID()] || keep[img.Location()] || filter.IsWhitelisted(img) ||
+				img.CreationTime().After(usedSince) || img.LastUsed().After(usedSince)
+		}
+
+		found := []*ImageCopyGroup{}
+		for _, group := range groupImageCopies(res.Images) {
+			for _, img := range group.copies {
+				if used(img) {
+					group.Used = append(group.Used, img)
+				} else {
+					group.Unused = append(group.Unused, img)
+				}
+			}
+			if len(group.Unused) > 0 {
+				found = append(found, group.ImageCopyGroup)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].SavingsPerMonth() > found[j].SavingsPerMonth()
+		})
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[res.Owner] = found
+	})
+	return result
+}
+
+type imageCopies struct {
+	*ImageCopyGroup
+	copies []cloud.Image
+}
+
+// groupImageCopies groups the copies of every image by their source.
+// Copies of copies are grouped with the original source, if that is in
+// the same account.
+func groupImageCopies(images []cloud.Image) []*imageCopies {
+	byID := make(map[string]cloud.Image)
+	for _, img := range images {
+		byID[img.ID()] = img
+	}
+	copiedFrom := func(img cloud.Image) (string, string) {
+		if imgCopy, ok := img.(cloud.ImageCopy); ok {
+			return imgCopy.CopiedFrom()
+		}
+		return "", ""
+	}
+
+	groups := make(map[string]*imageCopies)
+	isSource := make(map[string]bool)
+	notCopied := []cloud.Image{}
+	for _, img := range images {
+		sourceID, sourceLocation := copiedFrom(img)
+		if sourceID == "" {
+			notCopied = append(notCopied, img)
+			continue
+		}
+		for depth := 0; depth < len(images); depth++ {
+			source, exist := byID[sourceID]
+			if !exist {
+				break
+			}
+			id, location := copiedFrom(source)
+			if id == "" {
+				break
+			}
+			sourceID, sourceLocation = id, location
+		}
+		if _, exist := groups[sourceID]; !exist {
+			groups[sourceID] = &imageCopies{ImageCopyGroup: &ImageCopyGroup{
+				Name:           img.Name(),
+				SourceID:       sourceID,
+				SourceLocation: sourceLocation,
+			}}
+		}
+		groups[sourceID].copies = append(groups[sourceID].copies, img)
+		isSource[sourceID] = true
+	}
+
+	// Images without a recorded source are copies if there are images
+	// with the same name in other locations
+	byName := make(map[string][]cloud.Image)
+	for _, img := range notCopied {
+		if !isSource[img.ID()] && img.Name() != "" {
+			byName[img.Name()] = append(byName[img.Name()], img)
+		}
+	}
+	for name, named := range byName {
+		sort.Slice(named, func(i, j int) bool {
+			return named[i].CreationTime().Before(named[j].CreationTime())
+		})
+		source := named[0]
+		copies := []cloud.Image{}
+		for _, img := range named[1:] {
+			if img.Location() != source.Location() {
+				copies = append(copies, img)
+			}
+		}
+		if len(copies) == 0 {
+			continue
+		}
+		groups[source.ID()] = &imageCopies{
+			ImageCopyGroup: &ImageCopyGroup{Name: name, SourceID: source.ID(), SourceLocation: source.Location()},
+			copies:         copies,
+		}
+	}
+
+	result := []*imageCopies{}
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SourceID < result[j].SourceID
+	})
+	return result
+}
+
+// RemoveUnusedImageCopies will remove the unused copies of every image,
+// along with the snapshots backing them. The source images and the copies
+// in use are kept. The removed copies are returned.
+func RemoveUnusedImageCopies(found map[string][]*ImageCopyGroup, dryRun bool) []cloud.Image {
+	removed := []cloud.Image{}
+	for owner, groups := range found {
+		for _, group := range groups {
+			group.Removed = make(map[string]bool)
+			for _, img := range group.Unused {
+				imgCopy, ok := img.(cloud.ImageCopy)
+				if !ok {
+					continue
+				}
+				if dryRun {
+					log.Printf("Would remove %s, a copy of %s in %s, in %s", img.ID(), group.SourceID, img.Location(), cloud.AccountDisplayName(owner))
+					continue
+				}
+				if err := imgCopy.CleanupWithSnapshots(); err != nil {
+					status.ActionFailedf("Could not remove %s, a copy of %s, in %s: %s", img.ID(), group.SourceID, cloud.AccountDisplayName(owner), err)
+					continue
+				}
+				group.Removed[img.ID()] = true
+				removed = append(removed, img)
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// stillMatches reads the tags of a resource again if they may be out of
+// date, such as the tags of instances and volumes read from an AWS Config
+// aggregator, and checks that it still matches the filters. A tag
+// protecting the resource may have been set since it was listed.
+// Resources whose tags can't be read again are not deleted.
+func stillMatches(res cloud.Resource, filters []*filter.ResourceFilter) bool {
+	refresher, ok := res.(cloud.TagRefresher)
+	if !ok {
+		return true
+	}
+	if err := refresher.RefreshTags(); err != nil {
+		status.Warnf("Not cleaning up %s in %s, since its tags could not be read again: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+		return false
+	}
+	if !filter.Match(res, filters...) {
+		log.Printf("Not cleaning up %s in %s, since its tags changed since it was listed", res.ID(), cloud.AccountDisplayName(res.Owner()))
+		return false
+	}
+	return true
+}
+
+func liveInstances(instances []cloud.Instance, filters ...*filter.ResourceFilter) []cloud.Instance {
+	result := []cloud.Instance{}
+	for _, instance := range instances {
+		if stillMatches(instance, filters) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+func liveVolumes(volumes []cloud.Volume, filters ...*filter.ResourceFilter) []cloud.Volume {
+	result := []cloud.Volume{}
+	for _, vol := range volumes {
+		if stillMatches(vol, filters) {
+			result = append(result, vol)
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// ManualReason is the reason of resources marked for deletion by an
+// operator, rather than by the marking rules
+const ManualReason = "marked-by-operator"
+
+// MarkResource tags a single resource for deletion at the specified time,
+// with the reason, such as when an operator marks it by hand
+func MarkResource(res cloud.Resource, timeToDelete time.Time, reason string) error {
+	value := filter.SignTagValue(res, filter.DeleteTagKey, timeToDelete.Format(time.RFC3339))
+	err := res.SetTag(filter.DeleteTagKey, value, true)
+	reportProgress(res, ActionMark, false, err)
+	if err != nil {
+		return fmt.Errorf("Could not mark %s: %s", res.ID(), err)
+	}
+	log.Printf("Marked %s in %s for deletion at %s (%s)", res.ID(), cloud.AccountDisplayName(res.Owner()), timeToDelete, reason)
+	recordDeleteReason(res, reason)
+	if err := res.SetTag(filter.DeleteReasonTagKey, reason, true); err != nil {
+		return fmt.Errorf("Marked %s, but could not tag it with the reason: %s", res.ID(), err)
+	}
+	// The resource isn't marked under a policy, so a policy tag left from
+	// an earlier mark mustn't make it look outdated
+	if cloud.Tags(res.Tags()).Has(filter.DeletePolicyTagKey) {
+		if err := res.RemoveTag(filter.DeletePolicyTagKey); err != nil {
+			return fmt.Errorf("Marked %s, but could not remove its old policy tag: %s", res.ID(), err)
+		}
+	}
+	return nil
+}
+
+// DeleteExclusion returns why cleanup would never delete a resource,
+// whatever it was tagged with, or an empty string if it would. Resources
+// are excluded if they are disputed, managed by AWS Backup or a lifecycle
+// policy, in a notify-only category, retained by an image pipeline or
+// protected from deletion, and buckets if their early deletion fee is
+// above the limit and hasn't been confirmed. Whitelisted resources are
+// left to the caller.
+func DeleteExclusion(res cloud.Resource) string {
+	category := policy.CategoryOf(res)
+	switch {
+	case options.Disputed[res.ID()]:
+		return "Disputed by its owner"
+	case !notBackupManaged(res):
+		return "Managed by AWS Backup"
+	case !notDLMManaged(res):
+		return "Managed by a Data Lifecycle Manager policy"
+	case !notNotifyOnly(res):
+		return fmt.Sprintf("The policy only notifies about %s", category)
+	}
+	if image, ok := res.(cloud.Image); ok && !notRetained(image) {
+		return "Built by the latest build of an image pipeline"
+	}
+	if protection := protectionOf(res); protection != "" {
+		return fmt.Sprintf("Protected from deletion: %s", protection)
+	}
+	if bucket, ok := res.(cloud.Bucket); ok {
+		if fee, unconfirmed := unconfirmedFee(bucket); unconfirmed {
+			return fmt.Sprintf("Early deletion fee of up to $%.2f, which --confirm-early-deletion-fees confirms", fee)
+		}
+	}
+	return ""
+}
+
+// DeleteResource deletes a single resource right away, such as when an
+// operator deletes it by hand. The pre-delete and post-delete hooks of
+// its category are run around it, and it isn't deleted if a pre-delete
+// hook fails.
+func DeleteResource(res cloud.Resource) error {
+	category := policy.CategoryOf(res)
+	if !preDelete(category, res) {
+		return fmt.Errorf("A pre-delete hook failed for %s, not deleting it", res.ID())
+	}
+	err := res.Cleanup()
+	reportProgress(res, ActionDelete, false, err)
+	if err != nil {
+		return fmt.Errorf("Could not delete %s: %s", res.ID(), err)
+	}
+	postDelete(category, res)
+	return nil
+}
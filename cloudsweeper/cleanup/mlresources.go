@@ -0,0 +1,95 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// IdleMLResource is a running machine learning resource, such as a
+// notebook instance or endpoint, which hasn't been used for a while
+type IdleMLResource struct {
+	Resource cloud.MLResource
+	// Stopped is true if the resource has been stopped
+	Stopped bool
+	// Deleted is true if the resource has been deleted
+	Deleted bool
+}
+
+// Reason returns why the resource is idle, which is also the reason it's
+// marked for deletion
+func (r *IdleMLResource) Reason() string {
+	return "ml-resource-without-use"
+}
+
+// FindIdleMLResources will find running machine learning resources older
+// than the specified number of days, which weren't used in that time,
+// grouped per account. Whitelisted resources are left out.
+func FindIdleMLResources(mngr cloud.ResourceManager, days int) map[string][]*IdleMLResource {
+	result := make(map[string][]*IdleMLResource)
+	mlManager, ok := mngr.(cloud.MLManager)
+	if !ok {
+		log.Println("Machine learning resources are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	olderThan := filter.OlderThanXDays(days)
+	notUsed := filter.NotUsedInXDays(days)
+	mlManager.ForEachAccountMLResources(days, func(account string, resources []cloud.MLResource) {
+		log.Printf("Checking %d machine learning resources in %s", len(resources), cloud.AccountDisplayName(account))
+		found := []*IdleMLResource{}
+		for _, res := range resources {
+			if filter.IsWhitelisted(res) || !olderThan(res) {
+				continue
+			}
+			if notUsed(res) {
+				found = append(found, &IdleMLResource{Resource: res})
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupIdleMLResources will stop the idle resources which can be
+// stopped, such as notebook instances, since they keep their data and can
+// be started again. The others are marked for deletion in the specified
+// number of days, and deleted once their time to be deleted has passed.
+// Resources which are no longer idle are never found, so they aren't
+// deleted even if they are still marked.
+func CleanupIdleMLResources(found map[string][]*IdleMLResource, days int, dryRun bool) {
+	timeToDelete := time.Now().AddDate(0, 0, days)
+	for owner, resources := range found {
+		for _, idle := range resources {
+			res := idle.Resource
+			name := fmt.Sprintf("%s %s in %s", res.Kind(), res.ID(), cloud.AccountDisplayName(owner))
+			if !res.Stoppable() {
+				idle.Deleted = markOrDeleteIdle(policy.MLResources, res, name, idle.Reason(), timeToDelete, dryRun)
+				continue
+			}
+			if dryRun {
+				log.Printf("Would stop %s", name)
+				continue
+			}
+			if err := res.Stop(); err != nil {
+				status.ActionFailedf("Could not stop %s: %s", name, err)
+				continue
+			}
+			idle.Stopped = true
+		}
+	}
+}
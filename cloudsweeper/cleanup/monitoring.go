@@ -0,0 +1,117 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// DeadAlarm is an alarm without data, since the resources it's on no
+// longer exist
+type DeadAlarm struct {
+	Alarm cloud.Alarm
+	// Deleted is true if the alarm has been deleted
+	Deleted bool
+}
+
+// UnviewedDashboard is a dashboard which hasn't been viewed or modified
+// for a while
+type UnviewedDashboard struct {
+	Dashboard cloud.Dashboard
+	// Deleted is true if the dashboard has been deleted
+	Deleted bool
+}
+
+// DeadMonitoring holds the dead alarms and unviewed dashboards of one
+// account
+type DeadMonitoring struct {
+	Alarms     []*DeadAlarm
+	Dashboards []*UnviewedDashboard
+}
+
+// CostPerMonth returns the estimated monthly cost, in USD, of the dead
+// alarms and unviewed dashboards
+func (d *DeadMonitoring) CostPerMonth() float64 {
+	total := 0.0
+	for _, dead := range d.Alarms {
+		total += billing.AlarmCostPerMonth(dead.Alarm)
+	}
+	for _, unviewed := range d.Dashboards {
+		total += billing.DashboardCostPerMonth(unviewed.Dashboard)
+	}
+	return total
+}
+
+// FindDeadMonitoring will find alarms without data on resources which no
+// longer exist, and dashboards which haven't been viewed or modified in
+// the specified number of days, grouped per account. Dashboards are only
+// found if it's known when they were last viewed.
+func FindDeadMonitoring(mngr cloud.ResourceManager, days int) map[string]*DeadMonitoring {
+	result := make(map[string]*DeadMonitoring)
+	monitoringManager, ok := mngr.(cloud.MonitoringManager)
+	if !ok {
+		log.Println("Alarms and dashboards are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	unusedSince := time.Now().AddDate(0, 0, -days)
+	monitoringManager.ForEachAccountMonitoring(days, func(account string, alarms []cloud.Alarm, dashboards []cloud.Dashboard) {
+		log.Printf("Checking %d alarms and %d dashboards in %s", len(alarms), len(dashboards), cloud.AccountDisplayName(account))
+		found := &DeadMonitoring{}
+		for _, alarm := range alarms {
+			if len(alarm.MissingResources()) > 0 {
+				found.Alarms = append(found.Alarms, &DeadAlarm{Alarm: alarm})
+			}
+		}
+		for _, dashboard := range dashboards {
+			if dashboard.ViewsKnown() && dashboard.LastViewed().IsZero() && dashboard.LastModified().Before(unusedSince) {
+				found.Dashboards = append(found.Dashboards, &UnviewedDashboard{Dashboard: dashboard})
+			}
+		}
+		if len(found.Alarms) == 0 && len(found.Dashboards) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupDeadMonitoring will delete the dead alarms and unviewed
+// dashboards. Alarms and dashboards hold no data, so they are deleted
+// right away instead of being marked first.
+func CleanupDeadMonitoring(found map[string]*DeadMonitoring, dryRun bool) {
+	for owner, dead := range found {
+		if dryRun {
+			log.Printf("Would delete %d alarms and %d dashboards in %s", len(dead.Alarms), len(dead.Dashboards), cloud.AccountDisplayName(owner))
+			continue
+		}
+		deletedAlarms := 0
+		for _, alarm := range dead.Alarms {
+			if err := alarm.Alarm.Cleanup(); err != nil {
+				status.ActionFailedf("Could not delete alarm %s in %s: %s", alarm.Alarm.ID(), cloud.AccountDisplayName(owner), err)
+				continue
+			}
+			alarm.Deleted = true
+			deletedAlarms++
+		}
+		deletedDashboards := 0
+		for _, dashboard := range dead.Dashboards {
+			if err := dashboard.Dashboard.Cleanup(); err != nil {
+				status.ActionFailedf("Could not delete dashboard %s in %s: %s", dashboard.Dashboard.ID(), cloud.AccountDisplayName(owner), err)
+				continue
+			}
+			dashboard.Deleted = true
+			deletedDashboards++
+		}
+		log.Printf("Deleted %d alarms and %d dashboards in %s", deletedAlarms, deletedDashboards, cloud.AccountDisplayName(owner))
+	}
+}
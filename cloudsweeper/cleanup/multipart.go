@@ -0,0 +1,129 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// StaleUploads holds the incomplete multipart uploads of one bucket which
+// are older than the threshold
+type StaleUploads struct {
+	Bucket  cloud.Bucket
+	Uploads []cloud.MultipartUpload
+	// Aborted is true if the uploads have been aborted
+	Aborted bool
+}
+
+// SizeBytes returns the total size of the uploaded parts
+func (s *StaleUploads) SizeBytes() int64 {
+	var total int64
+	for _, upload := range s.Uploads {
+		total += upload.SizeBytes
+	}
+	return total
+}
+
+// SizeGB returns the total size of the uploaded parts in GB
+func (s *StaleUploads) SizeGB() float64 {
+	return float64(s.SizeBytes()) / (1 << 30)
+}
+
+// Oldest returns when the oldest of the uploads was started
+func (s *StaleUploads) Oldest() time.Time {
+	var oldest time.Time
+	for _, upload := range s.Uploads {
+		if oldest.IsZero() || upload.Initiated.Before(oldest) {
+			oldest = upload.Initiated
+		}
+	}
+	return oldest
+}
+
+// SavingsPerMonth returns the estimated monthly savings, in USD, of
+// aborting the uploads
+func (s *StaleUploads) SavingsPerMonth() float64 {
+	total := 0.0
+	for _, upload := range s.Uploads {
+		total += billing.MultipartUploadSavingsPerMonth(s.Bucket, upload)
+	}
+	return total
+}
+
+// FindStaleMultipartUploads will find multipart uploads which were
+// started more than the specified number of days ago without being
+// completed, grouped per account. Whitelisted buckets are left out.
+func FindStaleMultipartUploads(mngr cloud.ResourceManager, days int) map[string][]*StaleUploads {
+	result := make(map[string][]*StaleUploads)
+	var resultMutex sync.Mutex
+	startedBefore := time.Now().AddDate(0, 0, -days)
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		found := []*StaleUploads{}
+		for _, bucket := range res.Buckets {
+			uploader, ok := bucket.(cloud.MultipartUploader)
+			if !ok || filter.IsWhitelisted(bucket) {
+				continue
+			}
+			uploads, err := uploader.MultipartUploads()
+			if err != nil {
+				status.ActionFailedf("Could not list multipart uploads of %s in %s: %s", bucket.ID(), cloud.AccountDisplayName(res.Owner), err)
+				continue
+			}
+			stale := &StaleUploads{Bucket: bucket}
+			for _, upload := range uploads {
+				if upload.Initiated.Before(startedBefore) {
+					stale.Uploads = append(stale.Uploads, upload)
+				}
+			}
+			if len(stale.Uploads) > 0 {
+				found = append(found, stale)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[res.Owner] = found
+	})
+	return result
+}
+
+// AbortMultipartUploads will abort all stale uploads, which removes their
+// parts. Buckets are only marked as aborted if all of their stale uploads
+// were aborted. The number of bytes reclaimed is returned.
+func AbortMultipartUploads(found map[string][]*StaleUploads, dryRun bool) int64 {
+	var reclaimed int64
+	for owner, buckets := range found {
+		for _, stale := range buckets {
+			uploader, ok := stale.Bucket.(cloud.MultipartUploader)
+			if !ok {
+				continue
+			}
+			if dryRun {
+				log.Printf("Would abort %d multipart uploads to %s in %s", len(stale.Uploads), stale.Bucket.ID(), cloud.AccountDisplayName(owner))
+				continue
+			}
+			aborted := []cloud.MultipartUpload{}
+			for _, upload := range stale.Uploads {
+				if err := uploader.AbortMultipartUpload(upload); err != nil {
+					status.ActionFailedf("Could not abort multipart upload of %s to %s in %s: %s", upload.Key, stale.Bucket.ID(), cloud.AccountDisplayName(owner), err)
+					continue
+				}
+				aborted = append(aborted, upload)
+				reclaimed += upload.SizeBytes
+			}
+			log.Printf("Aborted %d multipart uploads to %s in %s", len(aborted), stale.Bucket.ID(), cloud.AccountDisplayName(owner))
+			stale.Aborted = len(aborted) == len(stale.Uploads)
+		}
+	}
+	return reclaimed
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// EmptyNetwork is a network which nothing uses, such as a VPC left
+// behind after an experiment
+type EmptyNetwork struct {
+	Network cloud.Network
+	// Deleted is true if the network has been deleted
+	Deleted bool
+}
+
+// Reason returns why the network is reviewed, which is also the reason
+// it's marked for deletion
+func (e *EmptyNetwork) Reason() string {
+	return "empty-network"
+}
+
+// FindEmptyNetworks will find networks without network interfaces,
+// instances or dependencies, such as peering connections, which weren't
+// created in the specified number of days, grouped per account. Default
+// networks and whitelisted networks are left out.
+func FindEmptyNetworks(mngr cloud.ResourceManager, days int) map[string][]*EmptyNetwork {
+	result := make(map[string][]*EmptyNetwork)
+	networkManager, ok := mngr.(cloud.NetworkManager)
+	if !ok {
+		log.Println("Networks are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	olderThan := filter.OlderThanXDays(days)
+	networkManager.ForEachAccountNetworks(days, func(account string, networks []cloud.Network) {
+		log.Printf("Checking %d networks in %s", len(networks), cloud.AccountDisplayName(account))
+		found := []*EmptyNetwork{}
+		for _, network := range networks {
+			if filter.IsWhitelisted(network) || !olderThan(network) {
+				continue
+			}
+			if network.Interfaces() == 0 && network.Instances() == 0 && len(network.Dependencies()) == 0 {
+				found = append(found, &EmptyNetwork{Network: network})
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupEmptyNetworks will mark empty networks for deletion in the
+// specified number of days, and delete the ones whose time to be deleted
+// has passed, together with the objects in them. Networks which are no
+// longer empty are never found, so they aren't deleted even if they are
+// still marked. The objects which were deleted are marked as such, also
+// when deleting the rest failed.
+func CleanupEmptyNetworks(found map[string][]*EmptyNetwork, days int, dryRun bool) {
+	timeToDelete := time.Now().AddDate(0, 0, days)
+	for owner, networks := range found {
+		if !dryRun && skipStopped(owner, "empty networks") {
+			continue
+		}
+		deleted := 0
+		for _, empty := range networks {
+			network := empty.Network
+			name := fmt.Sprintf("network %s in %s", network.ID(), cloud.AccountDisplayName(owner))
+			empty.Deleted = markOrDeleteIdle(policy.Networks, network, name, empty.Reason(), timeToDelete, dryRun)
+			if empty.Deleted {
+				deleted++
+				log.Printf("Deleted %s with %d network objects", name, len(network.Objects()))
+			}
+		}
+		if deleted > 0 {
+			log.Printf("Deleted %d empty networks in %s", deleted, cloud.AccountDisplayName(owner))
+		}
+	}
+}
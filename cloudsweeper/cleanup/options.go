@@ -0,0 +1,114 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/remarks"
+)
+
+// Options configures how resources are marked and cleaned up. Start from
+// DefaultOptions, so options added later keep their defaults, and set
+// them with SetOptions.
+type Options struct {
+	// EarlyDeletionFeeLimit is the largest estimated early deletion fee,
+	// in USD, of a bucket which is cleaned up without confirmation
+	EarlyDeletionFeeLimit float64
+	// ConfirmEarlyDeletionFees confirms that buckets with early deletion
+	// fees above EarlyDeletionFeeLimit can be cleaned up
+	ConfirmEarlyDeletionFees bool
+	// Disputed are the IDs of the resources whose owners say they aren't
+	// theirs, which are neither marked nor cleaned up until assigned
+	Disputed map[string]bool
+	// RetainedImages are the IDs of the images produced by the latest
+	// builds of image pipelines, which are kept no matter how old they are
+	RetainedImages map[string]bool
+	// ExcludeBackupManaged keeps the recovery points created by AWS
+	// Backup, such as snapshots, from being marked or cleaned up, since
+	// their backup plan deletes them
+	ExcludeBackupManaged bool
+	// ExcludeDLMManaged keeps the snapshots created by Amazon Data
+	// Lifecycle Manager policies from being marked or cleaned up, since
+	// the policies delete them
+	ExcludeDLMManaged bool
+	// Remarks is the history of resources tagged for deletion, used to
+	// find resources whose delete tag keeps being removed. It's nil if
+	// that isn't tracked.
+	Remarks *remarks.History
+	// ActivePolicy is the version of the policy and thresholds resources
+	// are marked under now, used to find resources marked under outdated
+	// policies when cleaning up. It's nil if that isn't checked.
+	ActivePolicy *PolicyVersion
+	// OutdatedMarks is what cleanup does with resources marked under
+	// another policy than ActivePolicy, one of OutdatedMarksActions
+	OutdatedMarks string
+	// HookPolicy is the policy whose pre-delete and post-delete hooks are
+	// run around the deletion of resources, and whose notify-only
+	// categories are never cleaned up. It's nil if no hooks are run.
+	HookPolicy *policy.Policy
+	// Progress is called for every resource marked, deleted or unmarked,
+	// e.g. to stream the progress of a run to a remote client. Calls are
+	// never concurrent. Nil means progress isn't reported.
+	Progress func(ProgressEvent)
+	// TotalCostThreshold is the smallest total cost, in USD, of a batch
+	// of resources matching the marking rules in an account, for them to
+	// be tagged. It keeps owners from being bothered about resources which
+	// cost next to nothing. Zero tags every resource matching the rules.
+	TotalCostThreshold float64
+	// OwnerCostThresholds overrides TotalCostThreshold for some accounts
+	OwnerCostThresholds map[string]float64
+	// ResourceCostThreshold is the smallest cost, in USD, of a resource
+	// which is tagged even if the total cost of its batch is below the
+	// threshold. Zero disables it.
+	ResourceCostThreshold float64
+	// AuditTrail is the trail every resource deleted by cleanup is
+	// recorded in, with its tags, metadata and size. Nil means deletions
+	// aren't recorded, e.g. when the caller records them itself.
+	AuditTrail *audit.Trail
+	// Checkpoints records the progress of cleanup, and skips the steps
+	// done before it was resumed. Nil means cleanup always starts over.
+	Checkpoints Checkpointer
+	// DeletesPerMinute limits how many resources cleanup deletes per
+	// minute, across all accounts, so large runs don't hit the API limits
+	// of the CSP or delete too much before anyone notices. Zero means
+	// there is no limit.
+	DeletesPerMinute int
+	// FreezeWindows are the change freezes, such as releases, during which
+	// nothing is cleaned up and owners aren't emailed about deletions.
+	// Marks which would expire during a freeze are postponed until after it.
+	FreezeWindows []FreezeWindow
+}
+
+// DefaultOptions returns the options marking and cleanup run with unless
+// others are set
+func DefaultOptions() Options {
+	return Options{
+		EarlyDeletionFeeLimit: 10.0,
+		Disputed:              map[string]bool{},
+		RetainedImages:        map[string]bool{},
+		ExcludeBackupManaged:  true,
+		ExcludeDLMManaged:     true,
+		OutdatedMarks:         OutdatedDelete,
+		TotalCostThreshold:    10.0,
+		OwnerCostThresholds:   map[string]float64{},
+	}
+}
+
+// options are the options marking and cleanup run with
+var options = DefaultOptions()
+
+// SetOptions sets the options marking and cleanup run with. They are
+// shared by the whole process, so they must not be changed while
+// resources are marked or cleaned up, and runs with different options
+// must not overlap.
+func SetOptions(opts Options) {
+	options = opts
+}
+
+// CurrentOptions returns the options marking and cleanup run with, to
+// change some of them with SetOptions
+func CurrentOptions() Options {
+	return options
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+var (
+	// NeedsOwnerTagKey is set on resources in accounts of departed
+	// employees, with the time they were first found without an owner
+	NeedsOwnerTagKey = "cloudsweeper-needs-owner"
+	// ClaimedByTagKey can be set on a resource of a departed employee, to
+	// the username of an active employee who takes over the resource
+	ClaimedByTagKey = "cloudsweeper-claimed-by"
+)
+
+// OrphanedResource is a resource in an account of a departed employee,
+// which nobody has claimed yet
+type OrphanedResource struct {
+	Category string
+	Resource cloud.Resource
+	// ClaimBy is when the resource is marked for cleanup, unless claimed
+	ClaimBy time.Time
+	// Escalated is true if the resource has been marked for cleanup,
+	// since it wasn't claimed in time
+	Escalated   bool
+	Whitelisted bool
+}
+
+// Orphaned holds the unclaimed resources of a departed employee
+type Orphaned struct {
+	Employee  *cs.Employee
+	Resources []*OrphanedResource
+}
+
+// HandleOrphanedResources finds the resources in accounts of disabled
+// employees, and tags them as needing a new owner. Resources which are
+// not claimed within the specified number of days of being tagged are
+// marked for cleanup, unless whitelisted. A resource is claimed either by
+// moving its account to an active employee in the organization, or by
+// tagging it with the username of an active employee. Claimed resources
+// have the needs-owner tag removed. The unclaimed resources are returned
+// per departed employee.
+func HandleOrphanedResources(mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, days int, dryRun bool) []*Orphaned {
+	accountUserMapping := org.AccountToUserMapping(csp)
+	employees := org.UsernameToEmployeeMapping()
+	claimedByActive := func(res cloud.Resource) bool {
+		claimedBy, _ := cloud.Tags(res.Tags()).Get(ClaimedByTagKey)
+		claimer, exist := employees[claimedBy]
+		return exist && !claimer.Disabled
+	}
+
+	orphaned := make(map[string]*Orphaned)
+	var resultMutex sync.Mutex
+	visit := func(res cloud.Resource) {
+		needsOwner, tagged := cloud.Tags(res.Tags()).Get(NeedsOwnerTagKey)
+		employee, exist := employees[accountUserMapping[res.Owner()]]
+		if !exist || !employee.Disabled || claimedByActive(res) {
+			if tagged {
+				removeNeedsOwnerTag(res, dryRun)
+			}
+			return
+		}
+
+		orphan := &OrphanedResource{
+			Category:    policy.CategoryOf(res),
+			Resource:    res,
+			Whitelisted: filter.IsWhitelisted(res),
+		}
+		taggedAt, err := cloud.ParseTagTime(needsOwner)
+		if !tagged || err != nil {
+			taggedAt = time.Now()
+			if dryRun {
+				log.Printf("Would tag %s in %s as needing an owner", res.ID(), cloud.AccountDisplayName(res.Owner()))
+			} else if err := res.SetTag(NeedsOwnerTagKey, taggedAt.Format(time.RFC3339), true); err != nil {
+				status.ActionFailedf("Could not tag %s in %s as needing an owner: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+			}
+		}
+		orphan.ClaimBy = taggedAt.AddDate(0, 0, days)
+		if !orphan.Whitelisted && time.Now().After(orphan.ClaimBy) {
+			orphan.Escalated = escalate(res, dryRun)
+		}
+
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		if _, exist := orphaned[employee.Username]; !exist {
+			orphaned[employee.Username] = &Orphaned{Employee: employee}
+		}
+		orphaned[employee.Username].Resources = append(orphaned[employee.Username].Resources, orphan)
+	}
+	mngr.ForEachAccountResources(func(collection *cloud.AllResourceCollection) {
+		for _, res := range collection.Resources() {
+			visit(res)
+		}
+	})
+
+	result := []*Orphaned{}
+	for _, owner := range orphaned {
+		sort.Slice(owner.Resources, func(i, j int) bool {
+			a, b := owner.Resources[i].Resource, owner.Resources[j].Resource
+			if a.Owner() != b.Owner() {
+				return a.Owner() < b.Owner()
+			}
+			return a.ID() < b.ID()
+		})
+		result = append(result, owner)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Employee.Username < result[j].Employee.Username
+	})
+	return result
+}
+
+// escalate marks an unclaimed resource for cleanup, and returns whether
+// it is marked. Resources already marked are left as they are.
+func escalate(res cloud.Resource, dryRun bool) bool {
+	if filter.TaggedForCleanup()(res) {
+		return true
+	}
+	timeToDelete := time.Now().AddDate(0, 0, 4)
+	if dryRun {
+		log.Printf("Would mark unclaimed %s in %s for deletion at %s", res.ID(), cloud.AccountDisplayName(res.Owner()), timeToDelete)
+		return false
+	}
+	value := filter.SignTagValue(res, filter.DeleteTagKey, timeToDelete.Format(time.RFC3339))
+	if err := res.SetTag(filter.DeleteTagKey, value, true); err != nil {
+		status.ActionFailedf("Failed to tag unclaimed %s in %s for deletion: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+		return false
+	}
+	recordDeleteReason(res, UnclaimedReason)
+	if err := res.SetTag(filter.DeleteReasonTagKey, UnclaimedReason, true); err != nil {
+		status.ActionFailedf("Failed to tag unclaimed %s in %s with the reason for deletion: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+	}
+	log.Printf("Marked unclaimed %s in %s for deletion at %s", res.ID(), cloud.AccountDisplayName(res.Owner()), timeToDelete)
+	return true
+}
+
+func removeNeedsOwnerTag(res cloud.Resource, dryRun bool) {
+	if dryRun {
+		log.Printf("Would remove the needs-owner tag from claimed %s in %s", res.ID(), cloud.AccountDisplayName(res.Owner()))
+		return
+	}
+	if err := res.RemoveTag(NeedsOwnerTagKey); err != nil {
+		status.ActionFailedf("Could not remove the needs-owner tag from %s in %s: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// What cleanup does with resources marked under an outdated policy
+const (
+	// OutdatedDelete deletes them like any other marked resource
+	OutdatedDelete = "delete"
+	// OutdatedKeep leaves them marked, but doesn't delete them, so they
+	// can be reviewed
+	OutdatedKeep = "keep"
+	// OutdatedReevaluate removes their marks, so the next marking
+	// evaluates them under the current policy
+	OutdatedReevaluate = "reevaluate"
+)
+
+// OutdatedMarksActions lists what can be done with outdated marks
+var OutdatedMarksActions = []string{OutdatedDelete, OutdatedKeep, OutdatedReevaluate}
+
+// unsetVersionField stands in for a policy without a name or version in
+// the policy tag
+const unsetVersionField = "-"
+
+// PolicyVersion identifies the policy, and the thresholds, resources are
+// marked under
+type PolicyVersion struct {
+	Name    string
+	Version string
+	// Fingerprint is a hash of everything deciding which resources are
+	// marked, so it changes with them even if the version doesn't
+	Fingerprint string
+}
+
+// NewPolicyVersion returns the version of a policy, with the thresholds of
+// marking. The fingerprint covers the engine, the actions and rules of
+// every category, and the marking thresholds. Hooks don't decide what's
+// marked, so they aren't part of it. The policy may be nil for the
+// default policy.
+func NewPolicyVersion(pol *policy.Policy, thresholds map[string]int) PolicyVersion {
+	type categoryRules struct {
+		Action             policy.Action  `json:"action"`
+		Rules              []*policy.Rule `json:"rules,omitempty"`
+		RecentlyTaggedDays int            `json:"recently_tagged_days,omitempty"`
+	}
+	fingerprinted := struct {
+		Engine     string                   `json:"engine,omitempty"`
+		Rego       *policy.RegoSettings     `json:"rego,omitempty"`
+		Categories map[string]categoryRules `json:"categories"`
+		Thresholds map[string]int           `json:"thresholds"`
+	}{Categories: map[string]categoryRules{}, Thresholds: map[string]int{}}
+	version := PolicyVersion{}
+	if pol != nil {
+		version.Name, version.Version = pol.Name, pol.Version
+		fingerprinted.Engine, fingerprinted.Rego = pol.Engine, pol.Rego
+		for name, category := range pol.Categories {
+			fingerprinted.Categories[name] = categoryRules{category.Action, category.Rules, category.RecentlyTaggedDays}
+		}
+	}
+	for _, key := range markThresholds {
+		fingerprinted.Thresholds[key] = thresholds[key]
+	}
+	// Maps are encoded with sorted keys, so the same policy always has
+	// the same fingerprint
+	raw, _ := json.Marshal(fingerprinted)
+	sum := sha256.Sum256(raw)
+	version.Fingerprint = hex.EncodeToString(sum[:])[:8]
+	return version
+}
+
+// String returns the value of the policy tag, the name, version and
+// fingerprint separated by colons
+func (v PolicyVersion) String() string {
+	fields := []string{v.Name, v.Version, v.Fingerprint}
+	for i, field := range fields {
+		if field == "" {
+			fields[i] = unsetVersionField
+		}
+	}
+	return strings.Join(fields, ":")
+}
+
+// ParsePolicyVersion parses the value of the policy tag. GCP labels can't
+// contain colons, so they're replaced by underscores there, and only the
+// fingerprint can be told apart from the name and version.
+func ParsePolicyVersion(value string) (PolicyVersion, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) != 3 {
+		i := strings.LastIndex(value, "_")
+		if i < 0 {
+			return PolicyVersion{}, fmt.Errorf("Invalid policy version '%s'", value)
+		}
+		fields = []string{value[:i], "", value[i+1:]}
+	}
+	if _, err := hex.DecodeString(fields[2]); err != nil || fields[2] == "" {
+		return PolicyVersion{}, fmt.Errorf("Invalid fingerprint in policy version '%s'", value)
+	}
+	for i, field := range fields {
+		if field == unsetVersionField {
+			fields[i] = ""
+		}
+	}
+	return PolicyVersion{Name: fields[0], Version: fields[1], Fingerprint: fields[2]}, nil
+}
+
+// MarkedUnder returns the policy version a resource was marked under, or
+// false if it isn't marked, or was marked without recording the policy,
+// e.g. by an operator
+func MarkedUnder(res cloud.Resource) (PolicyVersion, bool) {
+	if _, marked := filter.VerifiedTagValue(res, filter.DeleteTagKey); !marked {
+		return PolicyVersion{}, false
+	}
+	value, exist := cloud.Tags(res.Tags()).Get(filter.DeletePolicyTagKey)
+	if !exist {
+		return PolicyVersion{}, false
+	}
+	version, err := ParsePolicyVersion(value)
+	if err != nil {
+		return PolicyVersion{}, false
+	}
+	return version, true
+}
+
+// isOutdated returns true if a resource was marked under another policy
+// than the active one
+func isOutdated(res cloud.Resource, active PolicyVersion) bool {
+	version, recorded := MarkedUnder(res)
+	return recorded && version.Fingerprint != active.Fingerprint
+}
+
+// OutdatedMark is a resource marked under an outdated policy
+type OutdatedMark struct {
+	Resource    cloud.Resource
+	MarkedUnder PolicyVersion
+}
+
+// FindOutdatedMarks returns the resources of every account marked under
+// another policy than the active one, sorted by ID
+func FindOutdatedMarks(mngr cloud.ResourceManager, active PolicyVersion) map[string][]OutdatedMark {
+	result := map[string][]OutdatedMark{}
+	var resultMutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		outdated := []OutdatedMark{}
+		for _, r := range res.Resources() {
+			if isOutdated(r, active) {
+				version, _ := MarkedUnder(r)
+				outdated = append(outdated, OutdatedMark{Resource: r, MarkedUnder: version})
+			}
+		}
+		if len(outdated) == 0 {
+			return
+		}
+		sort.Slice(outdated, func(i, j int) bool {
+			return outdated[i].Resource.ID() < outdated[j].Resource.ID()
+		})
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[res.Owner] = outdated
+	})
+	return result
+}
+
+// handleOutdatedMarks keeps or unmarks the resources of an account which
+// are due for deletion, but were marked under an outdated policy, and
+// returns their IDs so they aren't deleted. Nothing is done if outdated
+// marks are deleted, or the active policy isn't known.
+func handleOutdatedMarks(resources []cloud.Resource) map[string]bool {
+	outdated := map[string]bool{}
+	if options.ActivePolicy == nil || options.OutdatedMarks == OutdatedDelete {
+		return outdated
+	}
+	due := filter.DeleteAtPassed()
+	for _, res := range resources {
+		if !due(res) || !isOutdated(res, *options.ActivePolicy) {
+			continue
+		}
+		outdated[res.ID()] = true
+		version, _ := MarkedUnder(res)
+		if options.OutdatedMarks == OutdatedKeep {
+			status.Warnf("Not deleting %s in %s, since it was marked under policy %s, which is now %s", res.ID(), cloud.AccountDisplayName(res.Owner()), version, options.ActivePolicy)
+			continue
+		}
+		err := res.RemoveTag(filter.DeleteTagKey)
+		reportProgress(res, ActionUnmark, false, err)
+		if err != nil {
+			status.ActionFailedf("Failed to remove the outdated mark of %s: %s\n", res.ID(), err)
+			continue
+		}
+		for _, key := range []string{filter.DeleteReasonTagKey, filter.DeletePolicyTagKey} {
+			if cloud.Tags(res.Tags()).Has(key) {
+				if err := res.RemoveTag(key); err != nil {
+					status.ActionFailedf("Failed to remove the %s tag of %s: %s\n", key, res.ID(), err)
+				}
+			}
+		}
+		log.Printf("Removed the mark of %s in %s, made under policy %s, so it's evaluated under %s next time", res.ID(), cloud.AccountDisplayName(res.Owner()), version, options.ActivePolicy)
+	}
+	return outdated
+}
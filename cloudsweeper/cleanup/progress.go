@@ -0,0 +1,44 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// The actions reported to Progress
+const (
+	// ActionMark is tagging a resource for deletion
+	ActionMark = "mark"
+	// ActionDelete is deleting a resource
+	ActionDelete = "delete"
+	// ActionUnmark is removing the delete tag of a resource
+	ActionUnmark = "unmark"
+)
+
+// ProgressEvent is what was done to a single resource
+type ProgressEvent struct {
+	Resource cloud.Resource
+	Action   string
+	// DryRun is true if the action was only logged
+	DryRun bool
+	// Err is nil if the action succeeded
+	Err error
+}
+
+// progressMutex keeps Options.Progress from being called concurrently
+var progressMutex sync.Mutex
+
+func reportProgress(res cloud.Resource, action string, dryRun bool, err error) {
+	if action == ActionDelete && !dryRun {
+		auditDeletion(res, err)
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	if options.Progress != nil {
+		options.Progress(ProgressEvent{Resource: res, Action: action, DryRun: dryRun, Err: err})
+	}
+}
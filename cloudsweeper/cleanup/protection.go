@@ -0,0 +1,136 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// Undeletable is a resource which matches the rules, but is protected
+// from deletion by a policy of its own, such as S3 Object Lock, a bucket
+// policy or a snapshot lock. It needs to be reviewed by hand.
+type Undeletable struct {
+	Resource cloud.Resource
+	// Protection describes what keeps the resource from being deleted
+	Protection string
+}
+
+var (
+	// undeletable are the resources of every account which were found to
+	// be protected from deletion when they were last marked or cleaned up
+	undeletable      = make(map[string][]*Undeletable)
+	undeletableMutex sync.RWMutex
+)
+
+// UndeletableOf returns the resources of an account which would have
+// been marked or deleted when its resources were last marked or cleaned
+// up, but were left alone since they are protected from deletion
+func UndeletableOf(owner string) []*Undeletable {
+	undeletableMutex.RLock()
+	defer undeletableMutex.RUnlock()
+	return undeletable[owner]
+}
+
+// protectionOf returns what keeps a resource from being deleted, or an
+// empty string if nothing does or it isn't known. Resources whose
+// protection can't be checked are taken to be deletable, so deleting
+// them fails like before if they are protected.
+func protectionOf(res cloud.Resource) string {
+	protected, ok := res.(cloud.DeleteProtection)
+	if !ok {
+		return ""
+	}
+	protection, err := protected.DeleteProtection()
+	if err != nil {
+		log.Printf("Could not check if %s in %s is protected from deletion: %s", res.ID(), cloud.AccountDisplayName(res.Owner()), err)
+		return ""
+	}
+	return protection
+}
+
+// withoutUndeletable removes the buckets and snapshots protected from
+// deletion from the collection, records them for the account, and
+// returns their IDs
+func withoutUndeletable(resources *cloud.AllResourceCollection) map[string]bool {
+	ids := map[string]bool{}
+	found := []*Undeletable{}
+	snapshots := []cloud.Snapshot{}
+	for _, snap := range resources.Snapshots {
+		if protection := protectionOf(snap); protection != "" {
+			ids[snap.ID()] = true
+			found = append(found, &Undeletable{Resource: snap, Protection: protection})
+		} else {
+			snapshots = append(snapshots, snap)
+		}
+	}
+	buckets := []cloud.Bucket{}
+	for _, bucket := range resources.Buckets {
+		if protection := protectionOf(bucket); protection != "" {
+			ids[bucket.ID()] = true
+			found = append(found, &Undeletable{Resource: bucket, Protection: protection})
+		} else {
+			buckets = append(buckets, bucket)
+		}
+	}
+	undeletableMutex.Lock()
+	defer undeletableMutex.Unlock()
+	delete(undeletable, resources.Owner)
+	if len(found) == 0 {
+		return ids
+	}
+	log.Printf("%s: Not marking %d resources protected from deletion", cloud.AccountDisplayName(resources.Owner), len(found))
+	undeletable[resources.Owner] = found
+	resources.Snapshots, resources.Buckets = snapshots, buckets
+	return ids
+}
+
+// forgetUndeletable forgets the protected resources of an account, before
+// its resources are cleaned up
+func forgetUndeletable(owner string) {
+	undeletableMutex.Lock()
+	defer undeletableMutex.Unlock()
+	delete(undeletable, owner)
+}
+
+// recordUndeletable adds a resource found to be protected when cleaning
+// up to the resources of its account needing review
+func recordUndeletable(res cloud.Resource, protection string) {
+	undeletableMutex.Lock()
+	defer undeletableMutex.Unlock()
+	undeletable[res.Owner()] = append(undeletable[res.Owner()], &Undeletable{Resource: res, Protection: protection})
+}
+
+// The functions below return the resources which aren't protected from
+// deletion. Resources marked before they were protected are kept, and
+// reported for review, instead of failing to be deleted.
+
+func deletableSnapshots(snapshots []cloud.Snapshot) []cloud.Snapshot {
+	result := []cloud.Snapshot{}
+	for _, snap := range snapshots {
+		if protection := protectionOf(snap); protection != "" {
+			status.Warnf("Not cleaning up snapshot %s in %s, since it's protected from deletion: %s. Review it by hand", snap.ID(), cloud.AccountDisplayName(snap.Owner()), protection)
+			recordUndeletable(snap, protection)
+			continue
+		}
+		result = append(result, snap)
+	}
+	return result
+}
+
+func deletableBuckets(buckets []cloud.Bucket) []cloud.Bucket {
+	result := []cloud.Bucket{}
+	for _, bucket := range buckets {
+		if protection := protectionOf(bucket); protection != "" {
+			status.Warnf("Not cleaning up bucket %s in %s, since it's protected from deletion: %s. Review it by hand", bucket.ID(), cloud.AccountDisplayName(bucket.Owner()), protection)
+			recordUndeletable(bucket, protection)
+			continue
+		}
+		result = append(result, bucket)
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// FindQuotaPressure will find the quotas, such as the number of EBS
+// snapshots, AMIs and VPCs in a region, of which at least the specified
+// percent is used, grouped per account. Every account's quotas are
+// sorted with the most used first, since cleaning up the resources
+// counting towards them is the most urgent.
+func FindQuotaPressure(mngr cloud.ResourceManager, percent int) map[string][]cloud.QuotaUsage {
+	result := make(map[string][]cloud.QuotaUsage)
+	quotaManager, ok := mngr.(cloud.QuotaManager)
+	if !ok {
+		log.Println("Service quotas are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	quotaManager.ForEachAccountQuotas(func(account string, quotas []cloud.QuotaUsage) {
+		log.Printf("Checking %d quotas in %s", len(quotas), cloud.AccountDisplayName(account))
+		found := []cloud.QuotaUsage{}
+		for _, quota := range quotas {
+			if quota.Limit > 0 && quota.Percent() >= float64(percent) {
+				found = append(found, quota)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		sort.Slice(found, func(i, j int) bool {
+			if found[i].Percent() != found[j].Percent() {
+				return found[i].Percent() > found[j].Percent()
+			}
+			if found[i].Name != found[j].Name {
+				return found[i].Name < found[j].Name
+			}
+			return found[i].Location < found[j].Location
+		})
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// UnclaimedReason is the reason resources of departed employees, which
+// nobody claimed in time, are marked for deletion
+const UnclaimedReason = "unclaimed-after-owner-left"
+
+// deleteReasons holds the rule that selected every resource marked in
+// this run, including resources not tagged because of a dry run or the
+// notify action, keyed by account and resource ID
+var (
+	deleteReasons      = make(map[string]string)
+	deleteReasonsMutex sync.RWMutex
+)
+
+func deleteReasonKey(res cloud.Resource) string {
+	return res.Owner() + "/" + res.ID()
+}
+
+func recordDeleteReason(res cloud.Resource, reason string) {
+	deleteReasonsMutex.Lock()
+	defer deleteReasonsMutex.Unlock()
+	deleteReasons[deleteReasonKey(res)] = reason
+}
+
+// DeleteReason returns the rule that caused a resource to be marked for
+// deletion, e.g. "unattached-volume>30d". Resources marked in this run
+// have the reason they were selected for, even if they weren't tagged.
+// Otherwise the reason is read from its tag, and is empty if unknown.
+func DeleteReason(res cloud.Resource) string {
+	deleteReasonsMutex.RLock()
+	reason, exist := deleteReasons[deleteReasonKey(res)]
+	deleteReasonsMutex.RUnlock()
+	if exist {
+		return reason
+	}
+	reason, _ = cloud.Tags(res.Tags()).Get(filter.DeleteReasonTagKey)
+	return reason
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// regoReason is the reason of resources marked by a Rego policy which
+// didn't give one
+const regoReason = "rego-policy"
+
+// decideWithRego asks the Rego policy what to do with every resource of
+// an account which isn't whitelisted, disputed, retained or already
+// marked. The resources selected by the native engine are passed to it
+// as marked, with their reason. The resources to mark and to notify about
+// are returned. If the policy can't be evaluated, nothing is marked or
+// notified about in the account.
+func decideWithRego(all, selected *cloud.AllResourceCollection, pol *policy.Policy) (*cloud.AllResourceCollection, *cloud.AllResourceCollection) {
+	marked := &cloud.AllResourceCollection{Owner: all.Owner}
+	notifyOnly := &cloud.AllResourceCollection{Owner: all.Owner}
+	selectedIDs := map[string]bool{}
+	for _, res := range selected.Resources() {
+		selectedIDs[res.ID()] = true
+	}
+	alreadyMarked := filter.TaggedForCleanup()
+	resources := []cloud.Resource{}
+	decisions := []policy.Decision{}
+	for _, res := range all.Resources() {
+		if filter.IsWhitelisted(res) || options.Disputed[res.ID()] || options.RetainedImages[res.ID()] || alreadyMarked(res) {
+			continue
+		}
+		input := policy.RegoInput{
+			Category: policy.CategoryOf(res),
+			Resource: cloud.NewInventoryRecord(res, billing.InstancePricePerHour),
+			Marked:   selectedIDs[res.ID()],
+		}
+		if input.Marked {
+			input.Reason = DeleteReason(res)
+		}
+		decision, err := pol.Decide(input)
+		if err != nil {
+			status.Warnf("Could not evaluate the Rego policy for %s in %s, nothing is marked there: %s", res.ID(), cloud.AccountDisplayName(all.Owner), err)
+			return &cloud.AllResourceCollection{Owner: all.Owner}, &cloud.AllResourceCollection{Owner: all.Owner}
+		}
+		resources = append(resources, res)
+		decisions = append(decisions, decision)
+	}
+	for i, res := range resources {
+		decision := decisions[i]
+		switch decision.Action {
+		case policy.ActionMark:
+			reason := decision.Reason
+			if reason == "" && !selectedIDs[res.ID()] {
+				reason = regoReason
+			}
+			if reason != "" {
+				recordDeleteReason(res, reason)
+			}
+			addResource(marked, res)
+		case policy.ActionNotify:
+			addResource(notifyOnly, res)
+		}
+	}
+	return marked, notifyOnly
+}
+
+func addResource(collection *cloud.AllResourceCollection, res cloud.Resource) {
+	switch res := res.(type) {
+	case cloud.Instance:
+		collection.Instances = append(collection.Instances, res)
+	case cloud.Image:
+		collection.Images = append(collection.Images, res)
+	case cloud.Volume:
+		collection.Volumes = append(collection.Volumes, res)
+	case cloud.Snapshot:
+		collection.Snapshots = append(collection.Snapshots, res)
+	case cloud.Bucket:
+		collection.Buckets = append(collection.Buckets, res)
+	}
+}
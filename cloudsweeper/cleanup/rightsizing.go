@@ -0,0 +1,80 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// RightSizingThresholds decide which instances are recommended a smaller
+// type. The 95th percentile of the CPU and memory used on the busiest of
+// the last Days days must both be below their thresholds, in percent.
+type RightSizingThresholds struct {
+	Days          int
+	CPUPercent    int
+	MemoryPercent int
+}
+
+// RightSizing is a recommendation to change an instance to a smaller type
+type RightSizing struct {
+	Instance        cloud.Instance
+	Utilization     cloud.Utilization
+	RecommendedType string
+	// SavingsPerMonth is how much would be saved per month, in USD, by
+	// changing to the recommended type
+	SavingsPerMonth float64
+}
+
+// FindRightSizing recommends a smaller type for the instances which have
+// run for the days of the thresholds, and used less CPU and memory than
+// the thresholds, with the largest savings first. Only AWS instances
+// reporting their memory use with the CloudWatch agent are recommended,
+// since a smaller type has less memory. Whitelisted instances are
+// included, since nothing is done to them.
+func FindRightSizing(instances []cloud.Instance, thresholds RightSizingThresholds) []*RightSizing {
+	runningFilter := filter.New()
+	runningFilter.AddGeneralRule(filter.OlderThanXDays(thresholds.Days))
+	runningFilter.OverrideWhitelist = true
+	result := []*RightSizing{}
+	for _, inst := range filter.Instances(instances, runningFilter) {
+		reporter, ok := inst.(cloud.UtilizationReporter)
+		if !ok || inst.CSP() != cloud.AWS {
+			continue
+		}
+		smaller, ok := billing.SmallerAWSInstanceType(inst.InstanceType())
+		if !ok {
+			continue
+		}
+		utilization, err := reporter.Utilization(thresholds.Days)
+		if err != nil {
+			log.Printf("Could not look up the utilization of %s in %s: %s", inst.ID(), cloud.AccountDisplayName(inst.Owner()), err)
+			continue
+		}
+		if !utilization.MemoryKnown || utilization.CPUPercentP95 >= float64(thresholds.CPUPercent) || utilization.MemoryPercentP95 >= float64(thresholds.MemoryPercent) {
+			continue
+		}
+		savings := (billing.InstancePricePerHour(inst) - billing.ResizedInstancePricePerHour(inst, smaller)) * 24 * 30
+		if savings <= 0 {
+			continue
+		}
+		result = append(result, &RightSizing{
+			Instance:        inst,
+			Utilization:     utilization,
+			RecommendedType: smaller,
+			SavingsPerMonth: savings,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SavingsPerMonth != result[j].SavingsPerMonth {
+			return result[i].SavingsPerMonth > result[j].SavingsPerMonth
+		}
+		return result[i].Instance.ID() < result[j].Instance.ID()
+	})
+	return result
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// ShadowMarking evaluates an upcoming policy alongside the active one,
+// and returns the resources, per account, which would be marked for
+// cleanup under the upcoming policy but not under the active one. The
+// resources are listed once and both policies are evaluated against the
+// same recording of them, so nothing is tagged.
+func ShadowMarking(mngr cloud.ResourceManager, thresholds map[string]int, active, upcoming *policy.Policy) (map[string]*cloud.AllResourceCollection, error) {
+	var recorded bytes.Buffer
+	if err := cloud.WriteInventory(&recorded, mngr, billing.InstancePricePerHour); err != nil {
+		return nil, err
+	}
+	inv, err := cloud.ReadInventory(&recorded)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := inv.Manager()
+	activeMarked, _, err := MarkForCleanup(snapshot, thresholds, active, true)
+	if err != nil {
+		return nil, err
+	}
+	upcomingMarked, _, err := MarkForCleanup(snapshot, thresholds, upcoming, true)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := make(map[string]*cloud.AllResourceCollection)
+	for owner, res := range upcomingMarked {
+		marked := make(map[string]bool)
+		if previous, exist := activeMarked[owner]; exist {
+			for _, r := range previous.Resources() {
+				marked[r.ID()] = true
+			}
+		}
+		additional := &cloud.AllResourceCollection{Owner: owner}
+		for _, inst := range res.Instances {
+			if !marked[inst.ID()] {
+				additional.Instances = append(additional.Instances, inst)
+			}
+		}
+		for _, img := range res.Images {
+			if !marked[img.ID()] {
+				additional.Images = append(additional.Images, img)
+			}
+		}
+		for _, vol := range res.Volumes {
+			if !marked[vol.ID()] {
+				additional.Volumes = append(additional.Volumes, vol)
+			}
+		}
+		for _, snap := range res.Snapshots {
+			if !marked[snap.ID()] {
+				additional.Snapshots = append(additional.Snapshots, snap)
+			}
+		}
+		for _, buck := range res.Buckets {
+			if !marked[buck.ID()] {
+				additional.Buckets = append(additional.Buckets, buck)
+			}
+		}
+		if len(additional.Resources()) > 0 {
+			delta[owner] = additional
+		}
+	}
+	return delta, nil
+}
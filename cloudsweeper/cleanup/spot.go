@@ -0,0 +1,123 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// SpotCandidate is an on-demand instance which has been running for long
+// enough that running it as a spot instance, or under a savings plan,
+// would be cheaper
+type SpotCandidate struct {
+	Instance cloud.Instance
+	// OnDemandPerMonth is what the instance costs per month, in USD
+	OnDemandPerMonth float64
+	// SpotPerMonth is what the instance would cost per month as a spot
+	// instance at the current spot price, if SpotPriceKnown
+	SpotPerMonth   float64
+	SpotPriceKnown bool
+	// SavingsPlanPerMonth is what the instance would cost per month
+	// under a savings plan
+	SavingsPlanPerMonth float64
+}
+
+// RunningDays returns how many days the instance has been running since
+// it was last started
+func (c *SpotCandidate) RunningDays() int {
+	return int(time.Since(c.Instance.CreationTime()).Hours() / 24)
+}
+
+// SpotSavingsPerMonth returns how much would be saved per month, in USD,
+// by running the instance as a spot instance, or 0 if the spot price
+// isn't known
+func (c *SpotCandidate) SpotSavingsPerMonth() float64 {
+	if !c.SpotPriceKnown || c.SpotPerMonth > c.OnDemandPerMonth {
+		return 0.0
+	}
+	return c.OnDemandPerMonth - c.SpotPerMonth
+}
+
+// SavingsPlanSavingsPerMonth returns how much would be saved per month,
+// in USD, by running the instance under a savings plan
+func (c *SpotCandidate) SavingsPlanSavingsPerMonth() float64 {
+	return c.OnDemandPerMonth - c.SavingsPlanPerMonth
+}
+
+// FindSpotCandidates will find the on-demand instances which have been
+// running continuously for more than the specified number of days in the
+// specified accounts, grouped per account and sorted by their spot
+// savings. The accounts are IDs or names, and every account is included
+// if there are none. Savings plans are estimated to take the specified
+// percent off the on-demand price. Whitelisted instances are included,
+// since nothing is done to them. Instances without a known lifecycle,
+// which are the ones outside AWS, are left out.
+func FindSpotCandidates(mngr cloud.ResourceManager, accounts []string, days int, savingsPlanDiscount int) map[string][]*SpotCandidate {
+	included := make(map[string]bool)
+	for _, account := range accounts {
+		included[account] = true
+	}
+	found := make(map[string][]cloud.Instance)
+	var foundMutex sync.Mutex
+
+	runningFilter := filter.New()
+	runningFilter.AddGeneralRule(filter.OlderThanXDays(days))
+	runningFilter.OverrideWhitelist = true
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		if len(included) > 0 && !included[res.Owner] && !included[cloud.AccountName(res.Owner)] {
+			return
+		}
+		instances := []cloud.Instance{}
+		for _, inst := range filter.Instances(res.Instances, runningFilter) {
+			// Only running instances are discovered, and their creation
+			// time is when they were last started
+			if withPricing, ok := inst.(cloud.InstancePricing); ok && withPricing.Lifecycle() == cloud.LifecycleOnDemand {
+				instances = append(instances, inst)
+			}
+		}
+		if len(instances) == 0 {
+			return
+		}
+		foundMutex.Lock()
+		defer foundMutex.Unlock()
+		found[res.Owner] = instances
+	})
+
+	// Prices are looked up one at a time, since they're cached
+	result := make(map[string][]*SpotCandidate)
+	for account, instances := range found {
+		candidates := []*SpotCandidate{}
+		for _, inst := range instances {
+			onDemand := billing.InstancePricePerHour(inst) * 24 * 30
+			candidate := &SpotCandidate{
+				Instance:            inst,
+				OnDemandPerMonth:    onDemand,
+				SavingsPlanPerMonth: onDemand * float64(100-savingsPlanDiscount) / 100,
+			}
+			spot, err := billing.InstanceSpotPricePerHour(inst)
+			if err != nil {
+				log.Printf("Could not find the spot price of %s in %s: %s", inst.ID(), cloud.AccountDisplayName(account), err)
+			} else {
+				candidate.SpotPerMonth, candidate.SpotPriceKnown = spot*24*30, true
+			}
+			candidates = append(candidates, candidate)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if a.SpotSavingsPerMonth() != b.SpotSavingsPerMonth() {
+				return a.SpotSavingsPerMonth() > b.SpotSavingsPerMonth()
+			}
+			return a.Instance.ID() < b.Instance.ID()
+		})
+		result[account] = candidates
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+var stopping int32
+
+// Stop makes cleanup skip the deletes it hasn't started yet, e.g. when
+// the program is asked to shut down. Deletes already in flight are
+// finished, so that no resource is left half deleted.
+func Stop() {
+	atomic.StoreInt32(&stopping, 1)
+}
+
+// Stopped returns true once Stop has been called
+func Stopped() bool {
+	return atomic.LoadInt32(&stopping) == 1
+}
+
+// skipStopped returns true if cleanup was stopped, and logs that the
+// resources of the account weren't cleaned up
+func skipStopped(owner, what string) bool {
+	if !Stopped() {
+		return false
+	}
+	log.Printf("Stopped, not deleting %s in %s", what, cloud.AccountDisplayName(owner))
+	return true
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// The batches of resources which are tagged together, and gated by
+// their own total cost
+const (
+	costBatchGeneral         = "resources"
+	costBatchUnnamedInstance = "unnamed instances"
+)
+
+// CostGate is how the cost thresholds were applied to a batch of
+// resources matching the marking rules in an account. Resources deleted
+// after a different number of days are tagged in separate batches, and
+// the cost of one batch never decides whether another is tagged.
+type CostGate struct {
+	// Batch is the kind of resources in the batch, e.g. unnamed instances
+	Batch string
+	// TotalCost is the total cost of the resources in the batch, and
+	// Threshold is the smallest total cost for all of them to be tagged
+	TotalCost float64
+	Threshold float64
+	// ResourceThreshold is the smallest cost of a resource which is
+	// tagged on its own, or zero if resources aren't
+	ResourceThreshold float64
+	// Tagged is the number of resources tagged, or which would have been
+	// in a dry run, and Skipped the number not tagged since they cost
+	// too little
+	Tagged  int
+	Skipped int
+}
+
+// Met returns true if the total cost reached the threshold of the account
+func (g *CostGate) Met() bool {
+	return g.TotalCost >= g.Threshold
+}
+
+// Explanation describes why the resources were, or weren't, tagged
+func (g *CostGate) Explanation() string {
+	if g.Met() {
+		return fmt.Sprintf("The %s cost $%.2f in total, which reaches the threshold of $%.2f, so all %d are marked.", g.Batch, g.TotalCost, g.Threshold, g.Tagged)
+	}
+	explanation := fmt.Sprintf("The %s cost $%.2f in total, which is less than the threshold of $%.2f", g.Batch, g.TotalCost, g.Threshold)
+	if g.ResourceThreshold > 0 {
+		return fmt.Sprintf("%s, so only the %d costing at least $%.2f each are marked, and %d are not.", explanation, g.Tagged, g.ResourceThreshold, g.Skipped)
+	}
+	return fmt.Sprintf("%s, so none of the %d are marked.", explanation, g.Skipped)
+}
+
+var (
+	costGates      = make(map[string][]*CostGate)
+	costGatesMutex sync.RWMutex
+)
+
+// CostGatesOf returns how the cost thresholds were applied to the
+// batches of an account when its resources were last marked. Batches
+// without resources matching the rules are left out.
+func CostGatesOf(owner string) []*CostGate {
+	costGatesMutex.RLock()
+	defer costGatesMutex.RUnlock()
+	return costGates[owner]
+}
+
+// costThresholdOf returns the total cost threshold of an account
+func costThresholdOf(owner string) float64 {
+	if threshold, exist := options.OwnerCostThresholds[owner]; exist {
+		return threshold
+	}
+	return options.TotalCostThreshold
+}
+
+// resetCostGates forgets how the thresholds were applied to an account,
+// before its resources are marked again
+func resetCostGates(owner string) {
+	costGatesMutex.Lock()
+	defer costGatesMutex.Unlock()
+	delete(costGates, owner)
+}
+
+// applyCostGate returns the resources of a batch which are tagged, from
+// the total cost of the batch and the cost of every resource, and
+// records how the thresholds were applied
+func applyCostGate(owner, batch string, resources []cloud.Resource) ([]cloud.Resource, *CostGate) {
+	gate := &CostGate{
+		Batch:             batch,
+		Threshold:         costThresholdOf(owner),
+		ResourceThreshold: options.ResourceCostThreshold,
+	}
+	costs := make([]float64, len(resources))
+	for i, res := range resources {
+		costs[i] = ResourceCost(res)
+		gate.TotalCost += costs[i]
+	}
+	result := []cloud.Resource{}
+	for i, res := range resources {
+		if gate.Met() || (gate.ResourceThreshold > 0 && costs[i] >= gate.ResourceThreshold) {
+			result = append(result, res)
+		}
+	}
+	gate.Tagged = len(result)
+	gate.Skipped = len(resources) - len(result)
+	if len(resources) > 0 {
+		costGatesMutex.Lock()
+		defer costGatesMutex.Unlock()
+		costGates[owner] = append(costGates[owner], gate)
+	}
+	return result, gate
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// UnusedTransitGateway holds the attachments of a transit gateway to
+// networks which were deleted or are empty, and the routes of the gateway
+// to attachments which no longer exist
+type UnusedTransitGateway struct {
+	Gateway     cloud.TransitGateway
+	Attachments []*cloud.TransitGatewayAttachment
+	Routes      []*cloud.TransitGatewayRoute
+}
+
+// FindUnusedTransitGateways will find the attachments of transit gateways
+// to networks which were deleted or have no network interfaces, and the
+// blackhole routes of the gateways, grouped per account owning the
+// gateways. Whitelisted attachments, and attachments to networks in
+// accounts which aren't managed, are left out.
+func FindUnusedTransitGateways(mngr cloud.ResourceManager) map[string][]*UnusedTransitGateway {
+	result := make(map[string][]*UnusedTransitGateway)
+	gatewayManager, ok := mngr.(cloud.TransitGatewayManager)
+	if !ok {
+		log.Println("Transit gateways are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	gatewayManager.ForEachAccountTransitGateways(func(account string, gateways []cloud.TransitGateway) {
+		log.Printf("Checking %d transit gateways in %s", len(gateways), cloud.AccountDisplayName(account))
+		found := []*UnusedTransitGateway{}
+		for _, gateway := range gateways {
+			unused := &UnusedTransitGateway{Gateway: gateway, Routes: gateway.BlackholeRoutes()}
+			for _, attachment := range gateway.Attachments() {
+				if cloud.Tags(attachment.Tags).Has(filter.WhitelistTagKey) || !attachment.NetworkKnown {
+					continue
+				}
+				if !attachment.NetworkExists || attachment.NetworkInterfaces == 0 {
+					unused.Attachments = append(unused.Attachments, attachment)
+				}
+			}
+			if len(unused.Attachments) > 0 || len(unused.Routes) > 0 {
+				found = append(found, unused)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupUnusedTransitGateways will detach the unused attachments from
+// the transit gateways, and delete the static blackhole routes. Routes
+// propagated from an attachment go away with it. Attachments hold no
+// data, so they are detached right away instead of being marked first.
+func CleanupUnusedTransitGateways(found map[string][]*UnusedTransitGateway, dryRun bool) {
+	for owner, gateways := range found {
+		if dryRun {
+			log.Printf("Would clean up %d transit gateways in %s", len(gateways), cloud.AccountDisplayName(owner))
+			continue
+		}
+		if skipStopped(owner, "transit gateway attachments") {
+			continue
+		}
+		for _, unused := range gateways {
+			gateway := unused.Gateway
+			for _, attachment := range unused.Attachments {
+				if err := gateway.Detach(attachment); err != nil {
+					status.ActionFailedf("Could not detach %s from %s in %s: %s", attachment.ID, gateway.ID(), cloud.AccountDisplayName(owner), err)
+					continue
+				}
+				attachment.Detached = true
+			}
+			for _, route := range unused.Routes {
+				if !route.Static {
+					continue
+				}
+				if err := gateway.DeleteRoute(route); err != nil {
+					status.ActionFailedf("Could not delete route to %s from %s of %s in %s: %s", route.Destination, route.RouteTableID, gateway.ID(), cloud.AccountDisplayName(owner), err)
+					continue
+				}
+				route.Deleted = true
+			}
+		}
+	}
+}
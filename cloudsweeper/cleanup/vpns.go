@@ -0,0 +1,76 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// IdleVPN is a VPN which had no connections or traffic for a while
+type IdleVPN struct {
+	VPN cloud.VPN
+	// Deleted is true if the VPN has been deleted
+	Deleted bool
+}
+
+// Reason returns why the VPN is idle, which is also the reason it's
+// marked for deletion
+func (v *IdleVPN) Reason() string {
+	return "vpn-without-connections"
+}
+
+// FindIdleVPNs will find VPNs older than the specified number of days,
+// which had no connections or traffic in that time, grouped per account.
+// Whitelisted VPNs are left out.
+func FindIdleVPNs(mngr cloud.ResourceManager, days int) map[string][]*IdleVPN {
+	result := make(map[string][]*IdleVPN)
+	vpnManager, ok := mngr.(cloud.VPNManager)
+	if !ok {
+		log.Println("VPNs are not supported")
+		return result
+	}
+	var resultMutex sync.Mutex
+	olderThan := filter.OlderThanXDays(days)
+	vpnManager.ForEachAccountVPNs(days, func(account string, vpns []cloud.VPN) {
+		log.Printf("Checking %d VPNs in %s", len(vpns), cloud.AccountDisplayName(account))
+		found := []*IdleVPN{}
+		for _, vpn := range vpns {
+			if filter.IsWhitelisted(vpn) || !olderThan(vpn) {
+				continue
+			}
+			if vpn.LastUsed().IsZero() {
+				found = append(found, &IdleVPN{VPN: vpn})
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		result[account] = found
+	})
+	return result
+}
+
+// CleanupIdleVPNs will mark idle VPNs for deletion in the specified
+// number of days, and delete the ones whose time to be deleted has
+// passed. VPNs which are no longer idle are never found, so they aren't
+// deleted even if they are still marked.
+func CleanupIdleVPNs(found map[string][]*IdleVPN, days int, dryRun bool) {
+	timeToDelete := time.Now().AddDate(0, 0, days)
+	for owner, vpns := range found {
+		for _, idle := range vpns {
+			vpn := idle.VPN
+			name := fmt.Sprintf("%s %s in %s", vpn.Kind(), vpn.ID(), cloud.AccountDisplayName(owner))
+			idle.Deleted = markOrDeleteIdle(policy.VPNs, vpn, name, idle.Reason(), timeToDelete, dryRun)
+		}
+	}
+}
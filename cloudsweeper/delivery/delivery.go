@@ -0,0 +1,150 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package delivery keeps track of whether notification emails reach their
+// recipients. The SMTP outcome of every email is recorded when it's sent,
+// and delivery and bounce notifications from SES are recorded when they
+// are processed, so addresses which keep bouncing can be found.
+package delivery
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recipient is the delivery status of one email address
+type Recipient struct {
+	Address       string    `json:"address"`
+	LastSent      time.Time `json:"last_sent"`
+	LastDelivered time.Time `json:"last_delivered"`
+	LastFailure   time.Time `json:"last_failure"`
+	LastError     string    `json:"last_error,omitempty"`
+	// Bounces is the number of permanent bounces since the last delivery
+	Bounces int `json:"bounces"`
+}
+
+// Log is the format of the delivery log file. It's safe to use from
+// several goroutines.
+type Log struct {
+	Recipients []*Recipient `json:"recipients"`
+
+	mutex     sync.Mutex
+	byAddress map[string]*Recipient
+}
+
+// ReadLog reads a log written by Write
+func ReadLog(r io.Reader) (*Log, error) {
+	l := &Log{}
+	if err := json.NewDecoder(r).Decode(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write writes the log as JSON, sorted by address
+func (l *Log) Write(w io.Writer) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sort.Slice(l.Recipients, func(i, j int) bool {
+		return l.Recipients[i].Address < l.Recipients[j].Address
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(l)
+}
+
+// lookup returns the status of an address, or nil if it's not in the
+// log. The mutex must be held by the caller.
+func (l *Log) lookup(address string) *Recipient {
+	if l.byAddress == nil {
+		l.byAddress = make(map[string]*Recipient, len(l.Recipients))
+		for _, r := range l.Recipients {
+			l.byAddress[r.Address] = r
+		}
+	}
+	return l.byAddress[normalizeAddress(address)]
+}
+
+// recipient returns the status of an address, adding it if it's new. The
+// mutex must be held by the caller.
+func (l *Log) recipient(address string) *Recipient {
+	r := l.lookup(address)
+	if r == nil {
+		r = &Recipient{Address: normalizeAddress(address)}
+		l.byAddress[r.Address] = r
+		l.Recipients = append(l.Recipients, r)
+	}
+	return r
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// Sent records that an email was handed to the SMTP server, or that the
+// SMTP server refused it if err is not nil
+func (l *Log) Sent(address string, when time.Time, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	r := l.recipient(address)
+	if err != nil {
+		r.LastFailure = when.UTC()
+		r.LastError = err.Error()
+		return
+	}
+	r.LastSent = when.UTC()
+}
+
+// Delivered records that an email reached the mailbox of the address,
+// which resets the bounce count
+func (l *Log) Delivered(address string, when time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	r := l.recipient(address)
+	if when.After(r.LastDelivered) {
+		r.LastDelivered = when.UTC()
+	}
+	r.Bounces = 0
+}
+
+// Bounced records that an email to the address bounced. Only permanent
+// bounces count towards escalation, as temporary ones are retried by the
+// mail server.
+func (l *Log) Bounced(address string, when time.Time, permanent bool, reason string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	r := l.recipient(address)
+	r.LastFailure = when.UTC()
+	r.LastError = reason
+	if permanent {
+		r.Bounces++
+	}
+}
+
+// Bounces returns the number of permanent bounces of the address since an
+// email was last delivered to it
+func (l *Log) Bounces(address string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if r := l.lookup(address); r != nil {
+		return r.Bounces
+	}
+	return 0
+}
+
+// Apply records the delivery or bounce in a notification from SES.
+// Complaints and other notifications are ignored.
+func (l *Log) Apply(n *Notification) {
+	for _, address := range n.Recipients {
+		switch n.Type {
+		case NotificationDelivery:
+			l.Delivered(address, n.Timestamp)
+		case NotificationBounce:
+			l.Bounced(address, n.Timestamp, n.Permanent, n.Reason)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package delivery
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const defaultQueueRegion = "us-east-1"
+
+// Message is a message received from a queue
+type Message struct {
+	Body string
+	// Handle is used to remove the message once processed
+	Handle string
+}
+
+// Queue holds the notifications from SES, which are removed once
+// processed
+type Queue interface {
+	// Receive returns the next batch of messages, or none if the queue
+	// is empty
+	Receive() ([]Message, error)
+	// Remove removes a received message from the queue
+	Remove(message Message) error
+}
+
+// sqsQueue reads the notifications that SES publishes to an SNS topic,
+// with the queue subscribed to that topic
+type sqsQueue struct {
+	client *sqs.SQS
+	url    string
+}
+
+// NewSQSQueue returns the SQS queue with the specified URL
+func NewSQSQueue(queueURL string) Queue {
+	sess := session.Must(session.NewSession())
+	client := sqs.New(sess, &aws.Config{Region: aws.String(queueRegion(queueURL))})
+	return &sqsQueue{client, queueURL}
+}
+
+// queueRegion returns the region in a queue URL such as
+// https://sqs.us-west-2.amazonaws.com/123456789012/queue
+func queueRegion(queueURL string) string {
+	parsed, err := url.Parse(queueURL)
+	if err != nil {
+		return defaultQueueRegion
+	}
+	parts := strings.Split(parsed.Hostname(), ".")
+	if len(parts) >= 4 && parts[0] == "sqs" {
+		return parts[1]
+	}
+	return defaultQueueRegion
+}
+
+func (q *sqsQueue) Receive() ([]Message, error) {
+	output, err := q.client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: aws.Int64(10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := []Message{}
+	for _, message := range output.Messages {
+		messages = append(messages, Message{
+			Body:   aws.StringValue(message.Body),
+			Handle: aws.StringValue(message.ReceiptHandle),
+		})
+	}
+	return messages, nil
+}
+
+func (q *sqsQueue) Remove(message Message) error {
+	_, err := q.client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(message.Handle),
+	})
+	return err
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Types of SES notifications
+const (
+	NotificationDelivery  = "Delivery"
+	NotificationBounce    = "Bounce"
+	NotificationComplaint = "Complaint"
+)
+
+// Notification is a delivery, bounce or complaint notification from SES
+type Notification struct {
+	Type       string
+	Timestamp  time.Time
+	Recipients []string
+	// Permanent is true for bounces which won't be retried, e.g. since
+	// the address doesn't exist
+	Permanent bool
+	// Reason is the SMTP response of the receiving mail server
+	Reason string
+}
+
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	// EventType is used instead of NotificationType by SES event publishing
+	EventType string `json:"eventType"`
+	Bounce    *struct {
+		BounceType        string    `json:"bounceType"`
+		Timestamp         time.Time `json:"timestamp"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Delivery *struct {
+		Timestamp    time.Time `json:"timestamp"`
+		Recipients   []string  `json:"recipients"`
+		SMTPResponse string    `json:"smtpResponse"`
+	} `json:"delivery"`
+	Complaint *struct {
+		Timestamp            time.Time `json:"timestamp"`
+		ComplainedRecipients []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+// ParseNotification parses an SES notification, either as published to
+// SNS, or wrapped in the SNS envelope as SNS delivers it to SQS
+func ParseNotification(raw []byte) (*Notification, error) {
+	envelope := snsEnvelope{}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Type == "Notification" && envelope.Message != "" {
+		raw = []byte(envelope.Message)
+	}
+
+	ses := sesNotification{}
+	if err := json.Unmarshal(raw, &ses); err != nil {
+		return nil, err
+	}
+	notificationType := ses.NotificationType
+	if notificationType == "" {
+		notificationType = ses.EventType
+	}
+	n := &Notification{Type: notificationType}
+	switch {
+	case notificationType == NotificationBounce && ses.Bounce != nil:
+		n.Timestamp = ses.Bounce.Timestamp
+		n.Permanent = ses.Bounce.BounceType == "Permanent"
+		for _, recipient := range ses.Bounce.BouncedRecipients {
+			n.Recipients = append(n.Recipients, recipient.EmailAddress)
+			if n.Reason == "" {
+				n.Reason = recipient.DiagnosticCode
+			}
+		}
+		if n.Reason == "" {
+			n.Reason = fmt.Sprintf("%s bounce", ses.Bounce.BounceType)
+		}
+	case notificationType == NotificationDelivery && ses.Delivery != nil:
+		n.Timestamp = ses.Delivery.Timestamp
+		n.Recipients = ses.Delivery.Recipients
+		n.Reason = ses.Delivery.SMTPResponse
+	case notificationType == NotificationComplaint && ses.Complaint != nil:
+		n.Timestamp = ses.Complaint.Timestamp
+		for _, recipient := range ses.Complaint.ComplainedRecipients {
+			n.Recipients = append(n.Recipients, recipient.EmailAddress)
+		}
+	default:
+		return nil, fmt.Errorf("not an SES notification")
+	}
+	return n, nil
+}
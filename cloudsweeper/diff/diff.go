@@ -0,0 +1,181 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package diff compares two recorded inventories, to find out what
+// changed between two runs of Cloudsweeper. A resource is in violation if
+// it matches the marking rules, whether it would be marked for cleanup or
+// only notified about, or if it's already marked for cleanup.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// Resource identifies a resource in a diff
+type Resource struct {
+	Owner    string
+	Category string
+	ID       string
+}
+
+// Diff holds the changes between two inventories
+type Diff struct {
+	Previous time.Time
+	Current  time.Time
+
+	// Appeared are resources which didn't exist in the previous inventory
+	Appeared []Resource
+	// AgedIntoViolation are resources which exist in both inventories, and
+	// are only in violation in the current one
+	AgedIntoViolation []Resource
+	// Remediated are resources which were in violation in the previous
+	// inventory, and still exist without being in violation, e.g. since
+	// the owner whitelisted or started using them
+	Remediated []Resource
+	// Deleted are resources which don't exist in the current inventory
+	Deleted []Resource
+}
+
+// Compare evaluates the thresholds and policy against both inventories,
+// as of the time each was recorded, and returns the changes between them
+func Compare(previous, current *cloud.Inventory, thresholds map[string]int, pol *policy.Policy) (*Diff, error) {
+	previousResources := resources(previous)
+	currentResources := resources(current)
+	previousViolations, err := violations(previous, thresholds, pol)
+	if err != nil {
+		return nil, err
+	}
+	currentViolations, err := violations(current, thresholds, pol)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{Previous: previous.Recorded, Current: current.Recorded}
+	for res := range currentResources {
+		if !previousResources[res] {
+			diff.Appeared = append(diff.Appeared, res)
+		} else if currentViolations[res] && !previousViolations[res] {
+			diff.AgedIntoViolation = append(diff.AgedIntoViolation, res)
+		}
+	}
+	for res := range previousResources {
+		if !currentResources[res] {
+			diff.Deleted = append(diff.Deleted, res)
+		} else if previousViolations[res] && !currentViolations[res] {
+			diff.Remediated = append(diff.Remediated, res)
+		}
+	}
+	sortResources(diff.Appeared)
+	sortResources(diff.AgedIntoViolation)
+	sortResources(diff.Remediated)
+	sortResources(diff.Deleted)
+	return diff, nil
+}
+
+// Format returns the diff as text, grouped by kind of change and owner
+func (d *Diff) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changes between %s and %s\n", d.Previous.Format(time.RFC3339), d.Current.Format(time.RFC3339))
+	formatResources(&b, "Newly appeared", d.Appeared)
+	formatResources(&b, "Aged into violation", d.AgedIntoViolation)
+	formatResources(&b, "Remediated by owners", d.Remediated)
+	formatResources(&b, "Deleted", d.Deleted)
+	return b.String()
+}
+
+func formatResources(b *strings.Builder, title string, resources []Resource) {
+	fmt.Fprintf(b, "\n%s (%d):\n", title, len(resources))
+	owner := ""
+	for _, res := range resources {
+		if res.Owner != owner {
+			owner = res.Owner
+			fmt.Fprintf(b, "  %s\n", cloud.AccountDisplayName(owner))
+		}
+		fmt.Fprintf(b, "    %s %s\n", res.Category, res.ID)
+	}
+}
+
+// resources returns every resource in an inventory
+func resources(inv *cloud.Inventory) map[Resource]bool {
+	result := make(map[Resource]bool)
+	for _, account := range inv.Accounts {
+		add := func(category string, records []*cloud.InventoryRecord) {
+			for _, record := range records {
+				result[Resource{account.Owner, category, record.ID}] = true
+			}
+		}
+		add(policy.Instances, account.Instances)
+		add(policy.Images, account.Images)
+		add(policy.Volumes, account.Volumes)
+		add(policy.Snapshots, account.Snapshots)
+		add(policy.Buckets, account.Buckets)
+	}
+	return result
+}
+
+// violations returns every resource in an inventory which matches the
+// marking rules, or is already marked for cleanup
+func violations(inv *cloud.Inventory, thresholds map[string]int, pol *policy.Policy) (map[Resource]bool, error) {
+	result := make(map[Resource]bool)
+	marked, notifyOnly, err := cleanup.MarkForCleanup(inv.Manager(), thresholds, pol, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, found := range []map[string]*cloud.AllResourceCollection{marked, notifyOnly} {
+		for owner, res := range found {
+			for _, inst := range res.Instances {
+				result[Resource{owner, policy.Instances, inst.ID()}] = true
+			}
+			for _, img := range res.Images {
+				result[Resource{owner, policy.Images, img.ID()}] = true
+			}
+			for _, vol := range res.Volumes {
+				result[Resource{owner, policy.Volumes, vol.ID()}] = true
+			}
+			for _, snap := range res.Snapshots {
+				result[Resource{owner, policy.Snapshots, snap.ID()}] = true
+			}
+			for _, buck := range res.Buckets {
+				result[Resource{owner, policy.Buckets, buck.ID()}] = true
+			}
+		}
+	}
+	// MarkForCleanup skips resources which are already marked, but they
+	// are still in violation until they are deleted or unmarked
+	for _, account := range inv.Accounts {
+		add := func(category string, records []*cloud.InventoryRecord) {
+			for _, record := range records {
+				if _, marked := record.Tags[filter.DeleteTagKey]; marked {
+					result[Resource{account.Owner, category, record.ID}] = true
+				}
+			}
+		}
+		add(policy.Instances, account.Instances)
+		add(policy.Images, account.Images)
+		add(policy.Volumes, account.Volumes)
+		add(policy.Snapshots, account.Snapshots)
+		add(policy.Buckets, account.Buckets)
+	}
+	return result, nil
+}
+
+func sortResources(resources []Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package digest keeps the resources left out of emails to owners whose
+// flagged resources cost too little to be worth an email on their own.
+// The resources are sent to their owners in a monthly digest instead.
+package digest
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Item is a resource which was left out of an email
+type Item struct {
+	// Owner is the username of the owner the email was for
+	Owner      string `json:"owner"`
+	Account    string `json:"account"`
+	ResourceID string `json:"resource_id"`
+	// Kind is the kind of resource, e.g. "Instance"
+	Kind         string  `json:"kind"`
+	Location     string  `json:"location"`
+	CostPerMonth float64 `json:"cost_per_month"`
+	// Report is the email the resource was left out of, e.g. "review"
+	Report          string    `json:"report"`
+	FirstSuppressed time.Time `json:"first_suppressed"`
+	LastSuppressed  time.Time `json:"last_suppressed"`
+}
+
+// Digest is the format of the digest file. It's safe to use from several
+// goroutines.
+type Digest struct {
+	Items []*Item `json:"items"`
+
+	mutex sync.Mutex
+}
+
+// Read reads a digest written by Write
+func Read(r io.Reader) (*Digest, error) {
+	d := &Digest{}
+	if err := json.NewDecoder(r).Decode(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Write writes the digest as JSON, sorted by owner, account and resource
+func (d *Digest) Write(w io.Writer) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	sortItems(d.Items)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// Suppressed records that a resource was left out of an email. A
+// resource left out of the same report again is only updated, so it's
+// listed once in the digest.
+func (d *Digest) Suppressed(item Item, now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now = now.UTC()
+	for _, existing := range d.Items {
+		if existing.Owner == item.Owner && existing.Account == item.Account &&
+			existing.ResourceID == item.ResourceID && existing.Report == item.Report {
+			existing.CostPerMonth = item.CostPerMonth
+			existing.LastSuppressed = now
+			return
+		}
+	}
+	item.FirstSuppressed = now
+	item.LastSuppressed = now
+	d.Items = append(d.Items, &item)
+}
+
+// Owners returns the owners with resources in the digest, sorted
+func (d *Digest) Owners() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	seen := map[string]bool{}
+	result := []string{}
+	for _, item := range d.Items {
+		if !seen[item.Owner] {
+			seen[item.Owner] = true
+			result = append(result, item.Owner)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ItemsOf returns the resources of an owner in the digest, sorted by
+// account and resource ID
+func (d *Digest) ItemsOf(owner string) []*Item {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	result := []*Item{}
+	for _, item := range d.Items {
+		if item.Owner == owner {
+			result = append(result, item)
+		}
+	}
+	sortItems(result)
+	return result
+}
+
+// Clear removes the resources of an owner from the digest, once they
+// have been sent to the owner
+func (d *Digest) Clear(owner string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	items := []*Item{}
+	for _, item := range d.Items {
+		if item.Owner != owner {
+			items = append(items, item)
+		}
+	}
+	d.Items = items
+}
+
+func sortItems(items []*Item) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Owner != items[j].Owner {
+			return items[i].Owner < items[j].Owner
+		}
+		if items[i].Account != items[j].Account {
+			return items[i].Account < items[j].Account
+		}
+		if items[i].ResourceID != items[j].ResourceID {
+			return items[i].ResourceID < items[j].ResourceID
+		}
+		return items[i].Report < items[j].Report
+	})
+}
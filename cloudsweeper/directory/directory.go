@@ -0,0 +1,153 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package directory keeps the organization up to date with a user
+// directory, such as a SCIM 2.0 server or Okta. Names, email addresses,
+// managers and whether employees are still active are refreshed from the
+// directory. Usernames in the directory which are email addresses are
+// matched on the part before the @.
+package directory
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+)
+
+// The supported kinds of directories
+const (
+	KindSCIM = "scim"
+	KindOkta = "okta"
+)
+
+const requestTimeout = 30 * time.Second
+
+// User is a user in the directory
+type User struct {
+	Username string
+	RealName string
+	Email    string
+	// Manager is the username of the user's manager, if known
+	Manager string
+	Active  bool
+}
+
+// Directory is a source of users
+type Directory interface {
+	// Users returns every user in the directory
+	Users() ([]User, error)
+}
+
+// New returns a directory of the specified kind, accessed at the
+// specified URL with the specified API token
+func New(kind, url, token string) (Directory, error) {
+	client := &http.Client{Timeout: requestTimeout}
+	url = strings.TrimSuffix(url, "/")
+	switch kind {
+	case KindSCIM:
+		return &scimDirectory{client: client, url: url, token: token}, nil
+	case KindOkta:
+		return &oktaDirectory{client: client, url: url, token: token}, nil
+	default:
+		return nil, fmt.Errorf("Unknown directory '%s', must be '%s' or '%s'", kind, KindSCIM, KindOkta)
+	}
+}
+
+// SyncResult describes what a sync changed in the organization
+type SyncResult struct {
+	// Changes lists every change made, in a human readable form
+	Changes []string
+	// Departed are employees who are inactive or missing in the directory
+	Departed cs.Employees
+}
+
+// Sync updates the employees of the organization with the users in the
+// directory. Employees are never added or removed, since the accounts
+// they own are only known by the organization. Employees who are
+// inactive, or no longer in the directory, are disabled. If more than
+// maxDisabledPercent of the enabled employees would be disabled, the
+// directory is likely incomplete, so an error is returned and nothing is
+// changed. One employee can always be disabled.
+func Sync(org *cs.Organization, users []User, maxDisabledPercent int) (*SyncResult, error) {
+	result := &SyncResult{Changes: []string{}, Departed: cs.Employees{}}
+	byUsername := make(map[string]User)
+	for _, user := range users {
+		byUsername[normalizeUsername(user.Username)] = user
+	}
+	enabled, disabling := 0, 0
+	for _, employee := range org.Employees {
+		if employee.Disabled {
+			continue
+		}
+		enabled++
+		if user, exist := byUsername[normalizeUsername(employee.Username)]; !exist || !user.Active {
+			disabling++
+		}
+	}
+	if limit := enabled * maxDisabledPercent / 100; disabling > 1 && disabling > limit {
+		return nil, fmt.Errorf("%d of %d employees would be disabled, more than %d%%, so the directory is likely incomplete. Not syncing", disabling, enabled, maxDisabledPercent)
+	}
+	// The usernames of the employees, by their normalized username
+	employees := make(map[string]string)
+	for _, employee := range org.Employees {
+		employees[normalizeUsername(employee.Username)] = employee.Username
+	}
+	change := func(employee *cs.Employee, format string, args ...interface{}) {
+		result.Changes = append(result.Changes, employee.Username+": "+fmt.Sprintf(format, args...))
+	}
+	for _, employee := range org.Employees {
+		user, exist := byUsername[normalizeUsername(employee.Username)]
+		if !exist || !user.Active {
+			if !employee.Disabled {
+				if exist {
+					change(employee, "disabled, since inactive in the directory")
+				} else {
+					change(employee, "disabled, since not in the directory")
+				}
+				employee.Disabled = true
+			}
+			result.Departed = append(result.Departed, employee)
+			continue
+		}
+		if employee.Disabled {
+			change(employee, "enabled, since active in the directory")
+			employee.Disabled = false
+		}
+		if user.RealName != "" && user.RealName != employee.RealName {
+			change(employee, "real name changed from %q to %q", employee.RealName, user.RealName)
+			employee.RealName = user.RealName
+		}
+		if user.Email != "" && user.Email != employee.Email {
+			change(employee, "email changed from %q to %q", employee.Email, user.Email)
+			employee.Email = user.Email
+		}
+		manager := normalizeUsername(user.Manager)
+		if manager != "" && manager != normalizeUsername(employee.ManagerID) {
+			if _, exist := employees[manager]; !exist {
+				change(employee, "manager %s is not in the organization, keeping %q", manager, employee.ManagerID)
+				continue
+			}
+			manager = employees[manager]
+			change(employee, "manager changed from %q to %q", employee.ManagerID, manager)
+			employee.ManagerID = manager
+			org.AddManager(manager)
+		}
+	}
+	sort.Slice(result.Departed, func(i, j int) bool {
+		return result.Departed[i].Username < result.Departed[j].Username
+	})
+	return result, nil
+}
+
+// normalizeUsername removes the domain from usernames which are email
+// addresses, since the organization only uses the part before the @
+func normalizeUsername(username string) string {
+	if i := strings.Index(username, "@"); i >= 0 {
+		username = username[:i]
+	}
+	return strings.ToLower(username)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	oktaPageSize            = 200
+	oktaStatusDeprovisioned = "DEPROVISIONED"
+)
+
+// oktaLinkNext finds the URL of the next page in the Link header
+var oktaLinkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// oktaDirectory reads users from the Okta Users API
+type oktaDirectory struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+type oktaUser struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Profile struct {
+		Login       string `json:"login"`
+		Email       string `json:"email"`
+		FirstName   string `json:"firstName"`
+		LastName    string `json:"lastName"`
+		DisplayName string `json:"displayName"`
+		ManagerID   string `json:"managerId"`
+	} `json:"profile"`
+}
+
+func (d *oktaDirectory) Users() ([]User, error) {
+	oktaUsers := []*oktaUser{}
+	// Deprovisioned users aren't listed, so they are disabled since they
+	// are not in the directory
+	url := fmt.Sprintf("%s/api/v1/users?limit=%d", d.url, oktaPageSize)
+	for url != "" {
+		page, next, err := d.page(url)
+		if err != nil {
+			return nil, err
+		}
+		oktaUsers = append(oktaUsers, page...)
+		url = next
+	}
+	// The manager ID is commonly either the Okta ID or the login of the
+	// manager
+	usernames := make(map[string]string)
+	for _, user := range oktaUsers {
+		usernames[user.ID] = user.Profile.Login
+		usernames[user.Profile.Login] = user.Profile.Login
+	}
+	users := []User{}
+	for _, user := range oktaUsers {
+		realName := user.Profile.DisplayName
+		if realName == "" {
+			realName = strings.TrimSpace(user.Profile.FirstName + " " + user.Profile.LastName)
+		}
+		manager := user.Profile.ManagerID
+		if username, exist := usernames[manager]; exist {
+			manager = username
+		}
+		users = append(users, User{
+			Username: user.Profile.Login,
+			RealName: realName,
+			Email:    user.Profile.Email,
+			Manager:  manager,
+			// Locked out users, or users with an expired password, are
+			// still employed, only deprovisioned users have left
+			Active: user.Status != oktaStatusDeprovisioned,
+		})
+	}
+	return users, nil
+}
+
+// page returns the users in a page, and the URL of the next page, which
+// is empty on the last page
+func (d *oktaDirectory) page(url string) ([]*oktaUser, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Authorization", "SSWS "+d.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("Okta returned status %d", resp.StatusCode)
+	}
+	users := []*oktaUser{}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	for _, link := range resp.Header["Link"] {
+		if match := oktaLinkNext.FindStringSubmatch(link); match != nil {
+			next = match[1]
+		}
+	}
+	return users, next, nil
+}
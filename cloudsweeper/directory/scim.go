@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const scimPageSize = 100
+
+// scimDirectory reads users from the /Users endpoint of a SCIM 2.0
+// server, as described in RFC 7644
+type scimDirectory struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+type scimListResponse struct {
+	TotalResults int         `json:"totalResults"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    []*scimUser `json:"Resources"`
+}
+
+type scimUser struct {
+	ID          string `json:"id"`
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName"`
+	Active      *bool  `json:"active"`
+	Name        struct {
+		Formatted string `json:"formatted"`
+	} `json:"name"`
+	Emails []struct {
+		Value   string `json:"value"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+	Enterprise struct {
+		Manager struct {
+			Value string `json:"value"`
+		} `json:"manager"`
+	} `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`
+}
+
+func (d *scimDirectory) Users() ([]User, error) {
+	scimUsers := []*scimUser{}
+	for startIndex := 1; ; {
+		page, err := d.page(startIndex)
+		if err != nil {
+			return nil, err
+		}
+		scimUsers = append(scimUsers, page.Resources...)
+		startIndex += len(page.Resources)
+		if len(page.Resources) == 0 || startIndex > page.TotalResults {
+			break
+		}
+	}
+	// Managers are referenced by their SCIM ID
+	usernames := make(map[string]string)
+	for _, user := range scimUsers {
+		usernames[user.ID] = user.UserName
+	}
+	users := []User{}
+	for _, user := range scimUsers {
+		realName := user.Name.Formatted
+		if realName == "" {
+			realName = user.DisplayName
+		}
+		email := ""
+		for _, e := range user.Emails {
+			if e.Primary || email == "" {
+				email = e.Value
+			}
+		}
+		users = append(users, User{
+			Username: user.UserName,
+			RealName: realName,
+			Email:    email,
+			Manager:  usernames[user.Enterprise.Manager.Value],
+			// Users are active unless the server says otherwise
+			Active: user.Active == nil || *user.Active,
+		})
+	}
+	return users, nil
+}
+
+func (d *scimDirectory) page(startIndex int) (*scimListResponse, error) {
+	url := fmt.Sprintf("%s/Users?startIndex=%d&count=%d", d.url, startIndex, scimPageSize)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	req.Header.Set("Accept", "application/scim+json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SCIM server returned status %d", resp.StatusCode)
+	}
+	page := new(scimListResponse)
+	if err := json.NewDecoder(resp.Body).Decode(page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package disputes keeps the review queue of resources whose owners say
+// they aren't theirs. Disputed resources are never cleaned up, since the
+// wrong owner was notified about them, until an operator assigns them to
+// their actual owner.
+package disputes
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dispute is a resource in the review queue
+type Dispute struct {
+	ResourceID string    `json:"resource_id"`
+	Account    string    `json:"account"`
+	DisputedBy string    `json:"disputed_by"`
+	Reason     string    `json:"reason,omitempty"`
+	DisputedAt time.Time `json:"disputed_at"`
+}
+
+// Queue is the format of the dispute file. It's safe to use from several
+// goroutines.
+type Queue struct {
+	Disputes []*Dispute `json:"disputes"`
+
+	mutex sync.Mutex
+}
+
+// ReadQueue reads a queue written by Write
+func ReadQueue(r io.Reader) (*Queue, error) {
+	q := &Queue{}
+	if err := json.NewDecoder(r).Decode(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Write writes the queue as JSON, with the oldest dispute first
+func (q *Queue) Write(w io.Writer) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.sort()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(q)
+}
+
+// sort sorts the disputes with the oldest first. The mutex must be held
+// by the caller.
+func (q *Queue) sort() {
+	sort.Slice(q.Disputes, func(i, j int) bool {
+		if !q.Disputes[i].DisputedAt.Equal(q.Disputes[j].DisputedAt) {
+			return q.Disputes[i].DisputedAt.Before(q.Disputes[j].DisputedAt)
+		}
+		return q.Disputes[i].ResourceID < q.Disputes[j].ResourceID
+	})
+}
+
+// Add puts a resource in the queue, and returns false if it already was
+func (q *Queue) Add(d *Dispute) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, existing := range q.Disputes {
+		if existing.ResourceID == d.ResourceID {
+			return false
+		}
+	}
+	d.DisputedAt = d.DisputedAt.UTC()
+	q.Disputes = append(q.Disputes, d)
+	return true
+}
+
+// Remove takes a resource out of the queue, and returns its dispute, or
+// false if it wasn't in the queue
+func (q *Queue) Remove(resourceID string) (*Dispute, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, d := range q.Disputes {
+		if d.ResourceID == resourceID {
+			q.Disputes = append(q.Disputes[:i], q.Disputes[i+1:]...)
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the disputes in the queue, with the oldest first
+func (q *Queue) List() []*Dispute {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.sort()
+	return append([]*Dispute{}, q.Disputes...)
+}
+
+// IDs returns the IDs of the resources in the queue
+func (q *Queue) IDs() map[string]bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	ids := make(map[string]bool, len(q.Disputes))
+	for _, d := range q.Disputes {
+		ids[d.ResourceID] = true
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package distribute
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/schema"
+)
+
+// CheckpointSchemaVersion is the version of the format of checkpoints
+const CheckpointSchemaVersion = 1
+
+// oldestCheckpointSchemaVersion is the oldest version ParseCheckpoint
+// reads
+const oldestCheckpointSchemaVersion = 1
+
+// Checkpoint is the progress of a run in an account, saved whenever a
+// step of the run is done in the account, so an interrupted run can be
+// resumed where it left off
+type Checkpoint struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Run           string `json:"run"`
+	Account       string `json:"account"`
+	// Done are the steps of the run done in the account, e.g. the
+	// resource types cleaned up
+	Done    []string  `json:"done"`
+	Updated time.Time `json:"updated"`
+}
+
+// ParseCheckpoint parses a checkpoint saved in the store
+func ParseCheckpoint(raw []byte) (*Checkpoint, error) {
+	checkpoint := new(Checkpoint)
+	if err := json.Unmarshal(raw, checkpoint); err != nil {
+		return nil, err
+	}
+	version := schema.Version(checkpoint.SchemaVersion)
+	if err := schema.Check("checkpoint", version, oldestCheckpointSchemaVersion, CheckpointSchemaVersion); err != nil {
+		return nil, err
+	}
+	checkpoint.SchemaVersion = CheckpointSchemaVersion
+	return checkpoint, nil
+}
+
+// Progress keeps track of the steps of a run done in every account,
+// saving a checkpoint in the store whenever one is done. It's safe to
+// use from several goroutines.
+type Progress struct {
+	store Store
+	run   string
+	mutex sync.Mutex
+	done  map[string]map[string]bool
+}
+
+// LoadProgress returns the progress of a run from the checkpoints saved
+// in the store, which is empty for a new run
+func LoadProgress(store Store, run string) (*Progress, error) {
+	checkpoints, err := store.Checkpoints(run)
+	if err != nil {
+		return nil, err
+	}
+	progress := &Progress{store: store, run: run, done: make(map[string]map[string]bool)}
+	for _, checkpoint := range checkpoints {
+		progress.done[checkpoint.Account] = make(map[string]bool)
+		for _, step := range checkpoint.Done {
+			progress.done[checkpoint.Account][step] = true
+		}
+	}
+	return progress, nil
+}
+
+// Run returns the ID of the run
+func (p *Progress) Run() string {
+	return p.run
+}
+
+// Done returns true if the step is done in the account
+func (p *Progress) Done(account, step string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.done[account][step]
+}
+
+// Finished returns true if every one of the steps is done in the account
+func (p *Progress) Finished(account string, steps []string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, step := range steps {
+		if !p.done[account][step] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checkpoint records that the step is done in the account, and saves the
+// checkpoint of the account
+func (p *Progress) Checkpoint(account, step string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.done[account] == nil {
+		p.done[account] = make(map[string]bool)
+	}
+	p.done[account][step] = true
+	done := make([]string, 0, len(p.done[account]))
+	for doneStep := range p.done[account] {
+		done = append(done, doneStep)
+	}
+	sort.Strings(done)
+	return p.store.SaveCheckpoint(&Checkpoint{
+		SchemaVersion: CheckpointSchemaVersion,
+		Run:           p.run,
+		Account:       account,
+		Done:          done,
+		Updated:       time.Now().UTC(),
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package distribute spreads the accounts of a run over many workers, for
+// organizations too large for one process to finish in time. A
+// coordinator sends a work item per account to a queue, every worker
+// runs the command against the accounts it receives, and stores the
+// result of each in a store shared by all of them, which the coordinator
+// collects the results of the run from.
+package distribute
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/schema"
+)
+
+// WorkItem is a command to run against a single account or project
+type WorkItem struct {
+	// Run identifies the run the item is part of
+	Run     string    `json:"run"`
+	Command string    `json:"command"`
+	CSP     string    `json:"csp"`
+	Account string    `json:"account"`
+	DryRun  bool      `json:"dry_run,omitempty"`
+	Queued  time.Time `json:"queued"`
+}
+
+// ResultSchemaVersion is the version of the format of results. Results
+// of the previous version, which is the same format without the version,
+// are read as well, so that workers can be upgraded one at a time.
+const ResultSchemaVersion = 2
+
+// oldestResultSchemaVersion is the oldest version ParseResult reads
+const oldestResultSchemaVersion = 1
+
+// Result is the outcome of a work item, which summarizes the run of the
+// command against its account
+type Result struct {
+	SchemaVersion     int       `json:"schemaVersion"`
+	Run               string    `json:"run"`
+	Account           string    `json:"account"`
+	Worker            string    `json:"worker"`
+	Started           time.Time `json:"started"`
+	Finished          time.Time `json:"finished"`
+	DiscoveryFailures int       `json:"discovery_failures"`
+	ActionFailures    int       `json:"action_failures"`
+	Warnings          int       `json:"warnings"`
+	Summary           string    `json:"summary"`
+}
+
+// AllAccounts is the account of the results of commands run against all
+// accounts at once, rather than split into work items
+const AllAccounts = "all"
+
+// NewRun returns the ID of a new run of the command
+func NewRun(command string, now time.Time) string {
+	return fmt.Sprintf("%s-%s", now.UTC().Format("20060102T150405Z"), command)
+}
+
+// Enqueue sends a work item for every account to the queue
+func Enqueue(queue Queue, run, command, csp string, accounts []string, dryRun bool) error {
+	now := time.Now().UTC()
+	for _, account := range accounts {
+		raw, err := json.Marshal(&WorkItem{
+			Run:     run,
+			Command: command,
+			CSP:     csp,
+			Account: account,
+			DryRun:  dryRun,
+			Queued:  now,
+		})
+		if err != nil {
+			return err
+		}
+		if err := queue.Send(string(raw)); err != nil {
+			return fmt.Errorf("Could not queue %s: %s", account, err)
+		}
+	}
+	return nil
+}
+
+// ParseWorkItem parses a work item received from the queue
+func ParseWorkItem(body string) (*WorkItem, error) {
+	item := new(WorkItem)
+	if err := json.Unmarshal([]byte(body), item); err != nil {
+		return nil, fmt.Errorf("Could not parse work item: %s", err)
+	}
+	if item.Run == "" || item.Command == "" || item.Account == "" {
+		return nil, fmt.Errorf("Work item without run, command or account")
+	}
+	return item, nil
+}
+
+// ParseResult parses a result saved in the store, by this or the previous
+// version of Cloudsweeper. Results of older versions are read as the
+// current version.
+func ParseResult(raw []byte) (*Result, error) {
+	result := new(Result)
+	if err := json.Unmarshal(raw, result); err != nil {
+		return nil, err
+	}
+	version := schema.Version(result.SchemaVersion)
+	if err := schema.Check("run result", version, oldestResultSchemaVersion, ResultSchemaVersion); err != nil {
+		return nil, err
+	}
+	result.SchemaVersion = ResultSchemaVersion
+	return result, nil
+}
+
+// Collect waits until the store has the results of all the accounts of
+// a run, or the timeout passed, checking every poll interval. The
+// results are returned in the order of their accounts, together with the
+// accounts without a result.
+func Collect(store Store, run string, accounts []string, timeout, poll time.Duration) ([]*Result, []string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		results, err := store.Results(run)
+		if err != nil {
+			return nil, nil, err
+		}
+		found := make(map[string]*Result)
+		for _, result := range results {
+			found[result.Account] = result
+		}
+		collected := []*Result{}
+		missing := []string{}
+		for _, account := range accounts {
+			if result, exist := found[account]; exist {
+				collected = append(collected, result)
+			} else {
+				missing = append(missing, account)
+			}
+		}
+		if len(missing) == 0 || !time.Now().Before(deadline) {
+			sort.Slice(collected, func(i, j int) bool {
+				return collected[i].Account < collected[j].Account
+			})
+			sort.Strings(missing)
+			return collected, missing, nil
+		}
+		time.Sleep(poll)
+	}
+}
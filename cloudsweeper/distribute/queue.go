@@ -0,0 +1,109 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package distribute
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const defaultQueueRegion = "us-east-1"
+
+// Message is a work item received from a queue
+type Message struct {
+	Body string
+	// Handle is used to extend or remove the message while processed
+	Handle string
+}
+
+// Queue holds the work items of runs until a worker has processed them.
+// An item a worker stopped processing without removing it becomes
+// visible again, and is processed by another worker.
+type Queue interface {
+	// Send adds a message to the queue
+	Send(body string) error
+	// Receive returns the next message, or nil if the queue is empty
+	Receive() (*Message, error)
+	// Extend hides a received message from other workers for the
+	// duration from now on, while it's still being processed
+	Extend(message *Message, hidden time.Duration) error
+	// Remove removes a processed message from the queue
+	Remove(message *Message) error
+}
+
+type sqsQueue struct {
+	client *sqs.SQS
+	url    string
+}
+
+// NewSQSQueue returns the SQS queue with the specified URL. The queue
+// may as well be subscribed to an SNS topic the items are published to,
+// with raw message delivery enabled.
+func NewSQSQueue(queueURL string) Queue {
+	sess := cloud.NewAWSSession()
+	client := sqs.New(sess, &aws.Config{Region: aws.String(queueRegion(queueURL))})
+	return &sqsQueue{client, queueURL}
+}
+
+// queueRegion returns the region in a queue URL such as
+// https://sqs.us-west-2.amazonaws.com/123456789012/queue
+func queueRegion(queueURL string) string {
+	parsed, err := url.Parse(queueURL)
+	if err != nil {
+		return defaultQueueRegion
+	}
+	parts := strings.Split(parsed.Hostname(), ".")
+	if len(parts) >= 4 && parts[0] == "sqs" {
+		return parts[1]
+	}
+	return defaultQueueRegion
+}
+
+func (q *sqsQueue) Send(body string) error {
+	_, err := q.client.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.url),
+		MessageBody: aws.String(body),
+	})
+	return err
+}
+
+func (q *sqsQueue) Receive() (*Message, error) {
+	output, err := q.client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: aws.Int64(1),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Messages) == 0 {
+		return nil, nil
+	}
+	return &Message{
+		Body:   aws.StringValue(output.Messages[0].Body),
+		Handle: aws.StringValue(output.Messages[0].ReceiptHandle),
+	}, nil
+}
+
+func (q *sqsQueue) Extend(message *Message, hidden time.Duration) error {
+	_, err := q.client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.url),
+		ReceiptHandle:     aws.String(message.Handle),
+		VisibilityTimeout: aws.Int64(int64(hidden / time.Second)),
+	})
+	return err
+}
+
+func (q *sqsQueue) Remove(message *Message) error {
+	_, err := q.client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(message.Handle),
+	})
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package distribute
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Store keeps the results of the work items, shared by the workers and
+// the coordinator of a run, and the checkpoints of runs which can be
+// resumed
+type Store interface {
+	// Save stores the result of a work item, replacing any earlier
+	// result for the same account in the same run
+	Save(result *Result) error
+	// Results returns the results stored so far for a run
+	Results(run string) ([]*Result, error)
+	// SaveCheckpoint stores the progress of a run in an account,
+	// replacing any earlier checkpoint of the account in the run
+	SaveCheckpoint(checkpoint *Checkpoint) error
+	// Checkpoints returns the checkpoints stored so far for a run
+	Checkpoints(run string) ([]*Checkpoint, error)
+}
+
+// s3Store stores results in an S3 bucket, with the keys
+// <prefix>runs/<run>/<account>.json, and checkpoints with the keys
+// <prefix>checkpoints/<run>/<account>.json
+type s3Store struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3Store returns a store in the specified S3 bucket, with the keys
+// of the results starting with the prefix
+func NewS3Store(bucket, prefix, region string) Store {
+	sess := cloud.NewAWSSession()
+	client := s3.New(sess, &aws.Config{Region: aws.String(region)})
+	return &s3Store{client, bucket, prefix}
+}
+
+func (s *s3Store) runPrefix(run string) string {
+	return s.prefix + path.Join("runs", run) + "/"
+}
+
+func (s *s3Store) checkpointPrefix(run string) string {
+	return s.prefix + path.Join("checkpoints", run) + "/"
+}
+
+func (s *s3Store) Save(result *Result) error {
+	return s.put(s.runPrefix(result.Run)+result.Account+".json", result)
+}
+
+func (s *s3Store) Results(run string) ([]*Result, error) {
+	results := []*Result{}
+	err := s.forEachObject(s.runPrefix(run), func(key string, raw []byte) error {
+		result, err := ParseResult(raw)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %s", key, err)
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+func (s *s3Store) SaveCheckpoint(checkpoint *Checkpoint) error {
+	return s.put(s.checkpointPrefix(checkpoint.Run)+checkpoint.Account+".json", checkpoint)
+}
+
+func (s *s3Store) Checkpoints(run string) ([]*Checkpoint, error) {
+	checkpoints := []*Checkpoint{}
+	err := s.forEachObject(s.checkpointPrefix(run), func(key string, raw []byte) error {
+		checkpoint, err := ParseCheckpoint(raw)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %s", key, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+		return nil
+	})
+	return checkpoints, err
+}
+
+// put stores the value as JSON under the key
+func (s *s3Store) put(key string, value interface{}) error {
+	raw, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(raw),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// forEachObject calls the function with the key and content of every
+// object with the prefix, until it returns an error
+func (s *s3Store) forEachObject(prefix string, f func(key string, raw []byte) error) error {
+	keys := []string{}
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		output, err := s.client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		raw, err := ioutil.ReadAll(output.Body)
+		output.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := f(key, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileStore stores results and checkpoints in a local directory, in the
+// same layout as the keys of the S3 store, for runs which aren't
+// distributed
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store in the specified directory, which is
+// created when the first result or checkpoint is stored
+func NewFileStore(dir string) Store {
+	return &fileStore{dir}
+}
+
+func (s *fileStore) Save(result *Result) error {
+	return s.write(filepath.Join(s.dir, "runs", result.Run), result.Account, result)
+}
+
+func (s *fileStore) Results(run string) ([]*Result, error) {
+	results := []*Result{}
+	err := s.forEachFile(filepath.Join(s.dir, "runs", run), func(name string, raw []byte) error {
+		result, err := ParseResult(raw)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %s", name, err)
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+func (s *fileStore) SaveCheckpoint(checkpoint *Checkpoint) error {
+	return s.write(filepath.Join(s.dir, "checkpoints", checkpoint.Run), checkpoint.Account, checkpoint)
+}
+
+func (s *fileStore) Checkpoints(run string) ([]*Checkpoint, error) {
+	checkpoints := []*Checkpoint{}
+	err := s.forEachFile(filepath.Join(s.dir, "checkpoints", run), func(name string, raw []byte) error {
+		checkpoint, err := ParseCheckpoint(raw)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %s", name, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+		return nil
+	})
+	return checkpoints, err
+}
+
+// write writes the value as JSON to <dir>/<account>.json. It's written to
+// a temporary file first, so it's never read half written.
+func (s *fileStore) write(dir, account string, value interface{}) error {
+	raw, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, account+".json")
+	if err := ioutil.WriteFile(path+".tmp", raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// forEachFile calls the function with the name and content of every JSON
+// file in the directory, which may not exist yet, until it returns an
+// error
+func (s *fileStore) forEachFile(dir string, f func(name string, raw []byte) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		name := filepath.Join(dir, file.Name())
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := f(name, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package events checks resources for required tags as soon as they are
+// created, complementing the periodic sweeps. It reads the CloudTrail
+// events of AWS API calls which EventBridge sends to an SQS queue, with
+// a rule such as
+//
+//	{"source": ["aws.ec2"], "detail-type": ["AWS API Call via CloudTrail"],
+//	 "detail": {"eventName": ["RunInstances", "CreateVolume", "CreateSnapshot", "CreateImage"]}}
+//
+// Only the tags given when the resource was created are checked, since
+// the event is handled before anything else could tag it.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cloudTrailDetailType is the detail type of CloudTrail events of API
+// calls in EventBridge
+const cloudTrailDetailType = "AWS API Call via CloudTrail"
+
+// ErrNotCreation is returned for events which don't create a resource
+// that can be checked, so they can be ignored
+var ErrNotCreation = errors.New("Event is not the creation of a resource")
+
+// Creation is a resource created by an API call
+type Creation struct {
+	Account string
+	Region  string
+	Time    time.Time
+	// EventName is the API call, e.g. RunInstances
+	EventName string
+	// ResourceType is the type of the created resources, e.g. instance
+	ResourceType string
+	IDs          []string
+	Tags         map[string]string
+	// Creator is the username of whoever made the call, and CreatorARN
+	// the ARN of their identity
+	Creator    string
+	CreatorARN string
+}
+
+// MissingTags returns the required tags which the resource was created
+// without, in order
+func (c *Creation) MissingTags(required []string) []string {
+	missing := []string{}
+	for _, key := range required {
+		if _, exist := c.Tags[key]; !exist {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+type event struct {
+	DetailType string    `json:"detail-type"`
+	Account    string    `json:"account"`
+	Region     string    `json:"region"`
+	Time       time.Time `json:"time"`
+	Detail     detail    `json:"detail"`
+}
+
+type detail struct {
+	EventName         string          `json:"eventName"`
+	ErrorCode         string          `json:"errorCode"`
+	UserIdentity      userIdentity    `json:"userIdentity"`
+	RequestParameters json.RawMessage `json:"requestParameters"`
+	ResponseElements  json.RawMessage `json:"responseElements"`
+}
+
+type userIdentity struct {
+	Type     string `json:"type"`
+	ARN      string `json:"arn"`
+	UserName string `json:"userName"`
+}
+
+// tagSpecifications are the tags given to the resources created by an
+// EC2 API call
+type tagSpecifications struct {
+	TagSpecificationSet struct {
+		Items []struct {
+			ResourceType string `json:"resourceType"`
+			Tags         []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"tags"`
+		} `json:"items"`
+	} `json:"tagSpecificationSet"`
+}
+
+// creations are the resource types created by the supported API calls,
+// and how to find the IDs of the created resources in the response
+var creations = map[string]struct {
+	resourceType string
+	ids          func(response json.RawMessage) ([]string, error)
+}{
+	"RunInstances":   {"instance", instanceIDs},
+	"CreateVolume":   {"volume", responseID("volumeId")},
+	"CreateSnapshot": {"snapshot", responseID("snapshotId")},
+	"CreateImage":    {"image", responseID("imageId")},
+}
+
+// ParseCreation returns the resource created in an EventBridge event.
+// ErrNotCreation is returned for other events, and for calls which
+// failed.
+func ParseCreation(body []byte) (*Creation, error) {
+	var e event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("Could not parse event: %s", err)
+	}
+	kind, supported := creations[e.Detail.EventName]
+	if e.DetailType != cloudTrailDetailType || !supported || e.Detail.ErrorCode != "" {
+		return nil, ErrNotCreation
+	}
+	ids, err := kind.ids(e.Detail.ResponseElements)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse the response of %s: %s", e.Detail.EventName, err)
+	}
+	tags, err := requestTags(e.Detail.RequestParameters, kind.resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse the request of %s: %s", e.Detail.EventName, err)
+	}
+	return &Creation{
+		Account:      e.Account,
+		Region:       e.Region,
+		Time:         e.Time,
+		EventName:    e.Detail.EventName,
+		ResourceType: kind.resourceType,
+		IDs:          ids,
+		Tags:         tags,
+		Creator:      creator(e.Detail.UserIdentity),
+		CreatorARN:   e.Detail.UserIdentity.ARN,
+	}, nil
+}
+
+// requestTags returns the tags the resources of the type were created with
+func requestTags(request json.RawMessage, resourceType string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if len(request) == 0 || string(request) == "null" {
+		return tags, nil
+	}
+	var specs tagSpecifications
+	if err := json.Unmarshal(request, &specs); err != nil {
+		return nil, err
+	}
+	for _, item := range specs.TagSpecificationSet.Items {
+		if item.ResourceType != resourceType {
+			continue
+		}
+		for _, tag := range item.Tags {
+			tags[tag.Key] = tag.Value
+		}
+	}
+	return tags, nil
+}
+
+func instanceIDs(response json.RawMessage) ([]string, error) {
+	var parsed struct {
+		InstancesSet struct {
+			Items []struct {
+				InstanceID string `json:"instanceId"`
+			} `json:"items"`
+		} `json:"instancesSet"`
+	}
+	if err := json.Unmarshal(response, &parsed); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, item := range parsed.InstancesSet.Items {
+		ids = append(ids, item.InstanceID)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no instances in the response")
+	}
+	return ids, nil
+}
+
+func responseID(key string) func(json.RawMessage) ([]string, error) {
+	return func(response json.RawMessage) ([]string, error) {
+		parsed := make(map[string]interface{})
+		if err := json.Unmarshal(response, &parsed); err != nil {
+			return nil, err
+		}
+		id, ok := parsed[key].(string)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("no %s in the response", key)
+		}
+		return []string{id}, nil
+	}
+}
+
+// creator returns the username of the identity which made an API call.
+// For assumed roles, such as the ones of AWS SSO, it's the session name.
+// Usernames which are email addresses are cut at the @, the same way as
+// when syncing with a directory.
+func creator(identity userIdentity) string {
+	username := identity.UserName
+	if identity.Type == "AssumedRole" || username == "" {
+		if i := strings.LastIndex(identity.ARN, "/"); i >= 0 {
+			username = identity.ARN[i+1:]
+		}
+	}
+	if i := strings.Index(username, "@"); i >= 0 {
+		username = username[:i]
+	}
+	return username
+}
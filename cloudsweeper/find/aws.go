@@ -38,13 +38,13 @@ func (c *awsClient) FindResource(id string) error {
 	}
 
 	for account, resources := range c.cloudManager.AllResourcesPerAccount() {
-		log.Printf("Looking for %s in account %s\n", id, account)
+		log.Printf("Looking for %s in account %s\n", id, cloud.AccountDisplayName(account))
 		switch resourceType {
 		case awsTypeInstance:
 			for _, inst := range resources.Instances {
 				if inst.ID() == id {
 					// Found instance
-					log.Printf("Found instance in account %s", account)
+					log.Printf("Found instance in account %s", cloud.AccountDisplayName(account))
 					employee, err := c.getEmployee(account)
 					if err != nil {
 						return err
@@ -72,7 +72,7 @@ func foundSnapshot(snap cloud.Snapshot, account string, owner *cloudsweeper.Empl
 
 func foundResource(res cloud.Resource, account string, owner *cloudsweeper.Employee) {
 	var resourceName = "<no name tag>"
-	if name, ok := res.Tags()["Name"]; ok {
+	if name, ok := cloud.Tags(res.Tags()).Get("Name"); ok {
 		resourceName = name
 	}
 
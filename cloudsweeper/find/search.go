@@ -0,0 +1,254 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package find
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// idResourceTypes maps the prefixes of AWS resource IDs to the type of
+// the resource, so a live lookup of an ID only discovers that type
+var idResourceTypes = map[string]string{
+	"i":    cloud.ResourceTypeInstances,
+	"vol":  cloud.ResourceTypeVolumes,
+	"snap": cloud.ResourceTypeSnapshots,
+	"ami":  cloud.ResourceTypeImages,
+}
+
+// ResourceTypeOfID returns the type of resource an AWS resource ID, such
+// as i-0123456789abcdef0, belongs to, or false if the query isn't an ID
+func ResourceTypeOfID(query string) (string, bool) {
+	parts := strings.Split(query, "-")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false
+	}
+	resourceType, ok := idResourceTypes[parts[0]]
+	return resourceType, ok
+}
+
+// Match is a resource matching a search, with where it lives, who owns it
+// and what Cloudsweeper does with it
+type Match struct {
+	Category string
+	Resource cloud.Resource
+	// MatchedBy describes what matched the query, e.g. "id" or "tag Project"
+	MatchedBy string
+	// Owner is the owner of the account, or nil if unknown
+	Owner        *cloudsweeper.Employee
+	CostPerMonth float64
+	// DeleteAt is when the resource is deleted, or the zero time if it
+	// isn't marked for deletion
+	DeleteAt    time.Time
+	Whitelisted bool
+	// WouldMark and WouldNotify are true if the next marking would mark
+	// the resource, or only notify its owner about it
+	WouldMark   bool
+	WouldNotify bool
+	Reason      string
+}
+
+// Search returns the resources of the manager matching the query, sorted
+// by account and ID. The query matches the ID of a resource, its name, or
+// the value of any of its tags, ignoring case, or "key=value" matches a
+// tag, and "key=" any resource with the tag. Names only need to contain
+// the query.
+func Search(mngr cloud.ResourceManager, org *cloudsweeper.Organization, csp cloud.CSP, query string) []*Match {
+	users := org.AccountToUserMapping(csp)
+	employees := org.UsernameToEmployeeMapping()
+	matches := []*Match{}
+	var mutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		found := []*Match{}
+		for _, r := range res.Resources() {
+			matchedBy := matchQuery(r, query)
+			if matchedBy == "" {
+				continue
+			}
+			found = append(found, &Match{
+				Category:     policy.CategoryOf(r),
+				Resource:     r,
+				MatchedBy:    matchedBy,
+				Owner:        employees[users[res.Owner]],
+				CostPerMonth: costPerMonth(r),
+				DeleteAt:     deleteAt(r),
+				Whitelisted:  filter.IsWhitelisted(r),
+			})
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		matches = append(matches, found...)
+	})
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i].Resource, matches[j].Resource
+		if a.Owner() != b.Owner() {
+			return a.Owner() < b.Owner()
+		}
+		return a.ID() < b.ID()
+	})
+	return matches
+}
+
+// Evaluate sets what the next marking would do with every match. Marking
+// is run as a dry run against the whole accounts of the matches, since
+// whether a resource is marked can depend on the other resources in its
+// account, such as the instances using an image.
+func Evaluate(mngr cloud.ResourceManager, matches []*Match, thresholds map[string]int, pol *policy.Policy) error {
+	accounts := map[string]bool{}
+	for _, match := range matches {
+		accounts[match.Resource.Owner()] = true
+	}
+	collections := []*cloud.AllResourceCollection{}
+	var mutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		if accounts[res.Owner] {
+			mutex.Lock()
+			defer mutex.Unlock()
+			collections = append(collections, res)
+		}
+	})
+	marked, notifyOnly, err := cleanup.MarkForCleanup(cloud.NewCollectedManager(collections), thresholds, pol, true)
+	if err != nil {
+		return err
+	}
+	flagged := func(collections map[string]*cloud.AllResourceCollection) map[string]bool {
+		keys := map[string]bool{}
+		for _, collection := range collections {
+			for _, r := range collection.Resources() {
+				keys[r.Owner()+"/"+r.ID()] = true
+			}
+		}
+		return keys
+	}
+	wouldMark, wouldNotify := flagged(marked), flagged(notifyOnly)
+	for _, match := range matches {
+		key := match.Resource.Owner() + "/" + match.Resource.ID()
+		match.WouldMark, match.WouldNotify = wouldMark[key], wouldNotify[key]
+		if match.WouldMark || match.WouldNotify || !match.DeleteAt.IsZero() {
+			match.Reason = cleanup.DeleteReason(match.Resource)
+		}
+	}
+	return nil
+}
+
+// State describes what Cloudsweeper does with the resource
+func (m *Match) State() string {
+	reason := ""
+	if m.Reason != "" {
+		reason = fmt.Sprintf(" (%s)", m.Reason)
+	}
+	switch {
+	case !m.DeleteAt.IsZero():
+		return fmt.Sprintf("Marked, will be deleted at %s%s", m.DeleteAt.Format(time.RFC3339), reason)
+	case m.Whitelisted:
+		return "Protected"
+	case m.WouldMark:
+		return "Will be marked for deletion in the next run" + reason
+	case m.WouldNotify:
+		return "Owner will be notified in the next run" + reason
+	}
+	return "Not flagged"
+}
+
+// FormatMatches describes every match, with where it lives, its owner,
+// age, cost and state
+func FormatMatches(matches []*Match) string {
+	var b strings.Builder
+	for _, m := range matches {
+		res := m.Resource
+		fmt.Fprintf(&b, "\n%s %s (matched by %s)\n", strings.TrimSuffix(m.Category, "s"), res.ID(), m.MatchedBy)
+		if name := resourceName(res); name != "" && name != res.ID() {
+			fmt.Fprintf(&b, "  Name:     %s\n", name)
+		}
+		fmt.Fprintf(&b, "  Account:  %s\n", cloud.AccountDisplayName(res.Owner()))
+		fmt.Fprintf(&b, "  Location: %s\n", res.Location())
+		owner := "unknown"
+		if m.Owner != nil {
+			owner = fmt.Sprintf("%s (%s)", m.Owner.RealName, m.Owner.Username)
+		}
+		fmt.Fprintf(&b, "  Owner:    %s\n", owner)
+		if claimed, ok := cloud.Tags(res.Tags()).Get(cleanup.ClaimedByTagKey); ok {
+			fmt.Fprintf(&b, "  Claimed:  %s\n", claimed)
+		}
+		fmt.Fprintf(&b, "  Age:      %d days\n", int(time.Since(res.CreationTime()).Hours()/24))
+		fmt.Fprintf(&b, "  Cost:     $%.2f/month\n", m.CostPerMonth)
+		fmt.Fprintf(&b, "  State:    %s\n", m.State())
+	}
+	return b.String()
+}
+
+// matchQuery returns what about the resource matches the query, or an
+// empty string if it doesn't match
+func matchQuery(res cloud.Resource, query string) string {
+	if i := strings.Index(query, "="); i > 0 {
+		key, value := query[:i], query[i+1:]
+		for tagKey, tagValue := range res.Tags() {
+			if strings.EqualFold(tagKey, key) && (value == "" || strings.EqualFold(tagValue, value)) {
+				return "tag " + tagKey
+			}
+		}
+		return ""
+	}
+	if strings.EqualFold(res.ID(), query) {
+		return "id"
+	}
+	if name := resourceName(res); name != "" && strings.Contains(strings.ToLower(name), strings.ToLower(query)) {
+		return "name"
+	}
+	keys := []string{}
+	for key := range res.Tags() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.EqualFold(res.Tags()[key], query) {
+			return "tag " + key
+		}
+	}
+	return ""
+}
+
+// resourceName returns the name of an image or bucket, or else the Name
+// tag
+func resourceName(res cloud.Resource) string {
+	switch res := res.(type) {
+	case cloud.Image:
+		if res.Name() != "" {
+			return res.Name()
+		}
+	case cloud.Bucket:
+		return res.ID()
+	}
+	return res.Tags()["Name"]
+}
+
+func costPerMonth(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	return 30 * billing.ResourceCostPerDay(res)
+}
+
+// deleteAt returns when a resource will be deleted, or the zero time
+func deleteAt(res cloud.Resource) time.Time {
+	value, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey)
+	if !exist {
+		return time.Time{}
+	}
+	t, err := cloud.ParseTagTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
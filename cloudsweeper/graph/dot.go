@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// nodeShapes are the Graphviz shapes of every kind of node
+var nodeShapes = map[string]string{
+	KindStack:    "folder",
+	KindInstance: "box3d",
+	KindVolume:   "cylinder",
+	KindSnapshot: "note",
+	KindImage:    "component",
+	KindBucket:   "tab",
+}
+
+// WriteDOT writes the graph in the DOT format of Graphviz, e.g. to be
+// rendered with "dot -Tsvg". Resources marked for cleanup are red, and
+// whitelisted resources green.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "digraph %s {\n", dotQuote(g.Account))
+	fmt.Fprintln(out, "\trankdir=LR;")
+	fmt.Fprintln(out, "\tnode [fontname=\"Helvetica\", fontsize=10];")
+	fmt.Fprintln(out, "\tedge [fontname=\"Helvetica\", fontsize=8];")
+	for _, node := range g.Nodes {
+		attributes := []string{
+			"label=" + dotQuote(nodeLabel(node)),
+			"shape=" + nodeShapes[node.Kind],
+			"kind=" + dotQuote(node.Kind),
+			fmt.Sprintf("cost_per_month=\"%.2f\"", node.CostPerMonth),
+		}
+		if age := node.AgeDays(); age >= 0 {
+			attributes = append(attributes, fmt.Sprintf("age_days=\"%d\"", age))
+		}
+		switch {
+		case node.Marked():
+			attributes = append(attributes, "color=red", "fontcolor=red", "delete_at="+dotQuote(node.DeleteAt.Format(time.RFC3339)))
+		case node.Whitelisted:
+			attributes = append(attributes, "color=darkgreen")
+		}
+		fmt.Fprintf(out, "\t%s [%s];\n", dotQuote(node.ID), strings.Join(attributes, ", "))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(out, "\t%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Label))
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// nodeLabel describes a node on a few lines
+func nodeLabel(node *Node) string {
+	lines := []string{fmt.Sprintf("%s %s", strings.Title(node.Kind), node.ID)}
+	if node.Name != "" && node.Name != node.ID {
+		lines = append(lines, node.Name)
+	}
+	details := fmt.Sprintf("%s, $%.2f/month", node.Location, node.CostPerMonth)
+	if age := node.AgeDays(); age >= 0 {
+		details = fmt.Sprintf("%s, %d days old, $%.2f/month", node.Location, age, node.CostPerMonth)
+	}
+	lines = append(lines, details)
+	if node.Marked() {
+		lines = append(lines, "Deleted "+node.DeleteAt.Format("2006-01-02"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dotQuote quotes a string as a DOT ID, escaping quotes and turning new
+// lines into line breaks of labels
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
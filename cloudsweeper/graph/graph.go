@@ -0,0 +1,227 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package graph builds the graph of how the resources of an account
+// depend on each other: instances on the volumes attached to them and the
+// images they were launched from, snapshots on the volumes they were
+// created from, and images on the snapshots backing them. Resources
+// created by a CloudFormation stack belong to a node of the stack. Every
+// resource is annotated with its age and cost, and when it's deleted if
+// it's marked for cleanup, so what a sweep touches can be explored
+// visually. Graphs are written in the DOT format of Graphviz, or as
+// GraphML.
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// The formats graphs can be written in
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+)
+
+// Formats lists every format graphs can be written in
+var Formats = []string{FormatDOT, FormatGraphML}
+
+// StackTagKey is set by CloudFormation to the name of the stack which
+// created a resource
+const StackTagKey = "aws:cloudformation:stack-name"
+
+// The kinds of nodes
+const (
+	KindInstance = "instance"
+	KindVolume   = "volume"
+	KindSnapshot = "snapshot"
+	KindImage    = "image"
+	KindBucket   = "bucket"
+	KindStack    = "stack"
+)
+
+// kindOrder is the order nodes are listed in
+var kindOrder = map[string]int{
+	KindStack:    0,
+	KindInstance: 1,
+	KindVolume:   2,
+	KindSnapshot: 3,
+	KindImage:    4,
+	KindBucket:   5,
+}
+
+// Node is a resource, or a stack of resources
+type Node struct {
+	ID       string
+	Kind     string
+	Name     string
+	Location string
+	// Created is the zero time for stacks
+	Created      time.Time
+	CostPerMonth float64
+	Whitelisted  bool
+	// DeleteAt is when the resource is deleted, or the zero time if it
+	// isn't marked for cleanup
+	DeleteAt time.Time
+}
+
+// Marked returns true if the resource is marked for cleanup
+func (n *Node) Marked() bool {
+	return !n.DeleteAt.IsZero()
+}
+
+// AgeDays returns how many days ago the resource was created, or -1 for
+// stacks
+func (n *Node) AgeDays() int {
+	if n.Created.IsZero() {
+		return -1
+	}
+	return int(time.Since(n.Created).Hours() / 24)
+}
+
+// Edge is a dependency of one node on another
+type Edge struct {
+	From string
+	To   string
+	// Label describes the dependency, e.g. "attached"
+	Label string
+}
+
+// Graph holds the resources of an account, and their dependencies
+type Graph struct {
+	Account string
+	Nodes   []*Node
+	Edges   []*Edge
+}
+
+// New builds the graph of the resources of an account. Dependencies are
+// only added between resources in the collection, so resources owned by
+// other accounts, such as public images, are left out.
+func New(res *cloud.AllResourceCollection) *Graph {
+	g := &Graph{Account: res.Owner, Nodes: []*Node{}, Edges: []*Edge{}}
+	nodes := map[string]*Node{}
+	resources := []cloud.Resource{}
+	add := func(r cloud.Resource, kind, name string) {
+		node := &Node{
+			ID:           r.ID(),
+			Kind:         kind,
+			Name:         name,
+			Location:     r.Location(),
+			Created:      r.CreationTime(),
+			CostPerMonth: costPerMonth(r),
+			Whitelisted:  filter.IsWhitelisted(r),
+			DeleteAt:     deleteAt(r),
+		}
+		nodes[node.ID] = node
+		g.Nodes = append(g.Nodes, node)
+		resources = append(resources, r)
+	}
+	for _, inst := range res.Instances {
+		add(inst, KindInstance, inst.Tags()["Name"])
+	}
+	for _, vol := range res.Volumes {
+		add(vol, KindVolume, vol.Tags()["Name"])
+	}
+	for _, snap := range res.Snapshots {
+		add(snap, KindSnapshot, snap.Tags()["Name"])
+	}
+	for _, img := range res.Images {
+		add(img, KindImage, img.Name())
+	}
+	for _, buck := range res.Buckets {
+		add(buck, KindBucket, buck.ID())
+	}
+
+	connect := func(from, to, label string) {
+		if nodes[from] != nil && nodes[to] != nil {
+			g.Edges = append(g.Edges, &Edge{From: from, To: to, Label: label})
+		}
+	}
+	for _, r := range resources {
+		switch r := r.(type) {
+		case cloud.Instance:
+			if launched, ok := r.(cloud.InstanceImage); ok {
+				connect(r.ID(), launched.ImageID(), "launched from")
+			}
+		case cloud.Volume:
+			if attachments, ok := r.(cloud.VolumeAttachments); ok {
+				for _, instanceID := range attachments.AttachedInstanceIDs() {
+					connect(instanceID, r.ID(), "attached")
+				}
+			}
+		case cloud.Snapshot:
+			if source, ok := r.(cloud.SnapshotSource); ok {
+				connect(source.SourceVolumeID(), r.ID(), "snapshot")
+			}
+		case cloud.Image:
+			if backing, ok := r.(cloud.ImageSnapshots); ok {
+				for _, snapshotID := range backing.SnapshotIDs() {
+					connect(snapshotID, r.ID(), "backs")
+				}
+			}
+		}
+		if stack := r.Tags()[StackTagKey]; stack != "" {
+			stackID := "stack:" + stack
+			if nodes[stackID] == nil {
+				node := &Node{ID: stackID, Kind: KindStack, Name: stack, Location: r.Location()}
+				nodes[stackID] = node
+				g.Nodes = append(g.Nodes, node)
+			}
+			stackNode := nodes[stackID]
+			stackNode.CostPerMonth += nodes[r.ID()].CostPerMonth
+			connect(stackID, r.ID(), "contains")
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Kind != g.Nodes[j].Kind {
+			return kindOrder[g.Nodes[i].Kind] < kindOrder[g.Nodes[j].Kind]
+		}
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// Write writes the graph in the specified format
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	}
+	return fmt.Errorf("Unknown graph format '%s'", format)
+}
+
+func costPerMonth(r cloud.Resource) float64 {
+	if bucket, ok := r.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	return 30 * billing.ResourceCostPerDay(r)
+}
+
+// deleteAt returns when a resource marked for cleanup is deleted, or the
+// zero time if it isn't marked
+func deleteAt(r cloud.Resource) time.Time {
+	value, marked := filter.VerifiedTagValue(r, filter.DeleteTagKey)
+	if !marked {
+		return time.Time{}
+	}
+	t, err := cloud.ParseTagTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys are the attributes of nodes and edges
+var graphMLKeys = []graphMLKey{
+	{ID: "kind", For: "node", Name: "kind", Type: "string"},
+	{ID: "name", For: "node", Name: "name", Type: "string"},
+	{ID: "location", For: "node", Name: "location", Type: "string"},
+	{ID: "created", For: "node", Name: "created", Type: "string"},
+	{ID: "age_days", For: "node", Name: "age_days", Type: "int"},
+	{ID: "cost_per_month", For: "node", Name: "cost_per_month", Type: "double"},
+	{ID: "whitelisted", For: "node", Name: "whitelisted", Type: "boolean"},
+	{ID: "marked", For: "node", Name: "marked", Type: "boolean"},
+	{ID: "delete_at", For: "node", Name: "delete_at", Type: "string"},
+	{ID: "label", For: "edge", Name: "label", Type: "string"},
+}
+
+// WriteGraphML writes the graph as GraphML, e.g. to be explored with
+// Gephi or yEd
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphMLDocument{
+		Xmlns: graphMLNamespace,
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{ID: g.Account, EdgeDefault: "directed"},
+	}
+	for _, node := range g.Nodes {
+		data := []graphMLData{
+			{Key: "kind", Value: node.Kind},
+			{Key: "name", Value: node.Name},
+			{Key: "location", Value: node.Location},
+			{Key: "cost_per_month", Value: fmt.Sprintf("%.2f", node.CostPerMonth)},
+			{Key: "whitelisted", Value: strconv.FormatBool(node.Whitelisted)},
+			{Key: "marked", Value: strconv.FormatBool(node.Marked())},
+		}
+		if !node.Created.IsZero() {
+			data = append(data,
+				graphMLData{Key: "created", Value: node.Created.UTC().Format(time.RFC3339)},
+				graphMLData{Key: "age_days", Value: strconv.Itoa(node.AgeDays())})
+		}
+		if node.Marked() {
+			data = append(data, graphMLData{Key: "delete_at", Value: node.DeleteAt.Format(time.RFC3339)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: edge.From,
+			Target: edge.To,
+			Data:   []graphMLData{{Key: "label", Value: edge.Label}},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
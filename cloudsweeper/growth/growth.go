@@ -0,0 +1,230 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package growth keeps track of the size and object count of buckets
+// over time. Every run records a sample per bucket in a history file, so
+// that buckets which keep growing can be found, and not only the ones
+// which are no longer used.
+package growth
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+const (
+	// monthDays is how far back the sample a bucket is compared with is
+	monthDays = 30
+	// keepDays is how long samples are kept in the history
+	keepDays = 400
+)
+
+// Sample is the size and object count of a bucket at one point in time
+type Sample struct {
+	Recorded    time.Time `json:"recorded"`
+	ObjectCount int64     `json:"object_count"`
+	SizeGB      float64   `json:"size_gb"`
+}
+
+// BucketHistory holds the samples of one bucket, oldest first
+type BucketHistory struct {
+	Owner   string    `json:"owner"`
+	ID      string    `json:"id"`
+	Samples []*Sample `json:"samples"`
+}
+
+// History is the format of the bucket history file
+type History struct {
+	Buckets []*BucketHistory `json:"buckets"`
+}
+
+// ReadHistory reads a history written by Write
+func ReadHistory(r io.Reader) (*History, error) {
+	h := &History{}
+	if err := json.NewDecoder(r).Decode(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Write writes the history as JSON
+func (h *History) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(h)
+}
+
+// Record adds a sample of every bucket of the resource manager to the
+// history. A bucket only gets one sample per day, so running more than
+// once a day replaces that day's sample. Samples older than about a year
+// are removed, so deleted buckets are eventually removed as well.
+func (h *History) Record(mngr cloud.ResourceManager, now time.Time) {
+	buckets := make(map[string]*BucketHistory)
+	for _, bucket := range h.Buckets {
+		buckets[bucketKey(bucket.Owner, bucket.ID)] = bucket
+	}
+
+	var bucketsMutex sync.Mutex
+	mngr.ForEachBucket(func(b cloud.Bucket) {
+		bucketsMutex.Lock()
+		defer bucketsMutex.Unlock()
+		key := bucketKey(b.Owner(), b.ID())
+		if _, exist := buckets[key]; !exist {
+			buckets[key] = &BucketHistory{Owner: b.Owner(), ID: b.ID()}
+		}
+		buckets[key].add(&Sample{Recorded: now.UTC(), ObjectCount: b.ObjectCount(), SizeGB: b.TotalSizeGB()})
+	})
+
+	h.Buckets = []*BucketHistory{}
+	for _, bucket := range buckets {
+		bucket.prune(now.AddDate(0, 0, -keepDays))
+		if len(bucket.Samples) > 0 {
+			h.Buckets = append(h.Buckets, bucket)
+		}
+	}
+	sort.Slice(h.Buckets, func(i, j int) bool {
+		a, b := h.Buckets[i], h.Buckets[j]
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		return a.ID < b.ID
+	})
+}
+
+func (b *BucketHistory) add(sample *Sample) {
+	if last := b.latest(); last != nil && sameDay(last.Recorded, sample.Recorded) {
+		b.Samples[len(b.Samples)-1] = sample
+		return
+	}
+	b.Samples = append(b.Samples, sample)
+}
+
+func (b *BucketHistory) prune(before time.Time) {
+	kept := []*Sample{}
+	for _, sample := range b.Samples {
+		if !sample.Recorded.Before(before) {
+			kept = append(kept, sample)
+		}
+	}
+	b.Samples = kept
+}
+
+func (b *BucketHistory) latest() *Sample {
+	if len(b.Samples) == 0 {
+		return nil
+	}
+	return b.Samples[len(b.Samples)-1]
+}
+
+// monthBefore returns the latest sample recorded at least a month before
+// the specified sample, or nil if the bucket has no such sample
+func (b *BucketHistory) monthBefore(sample *Sample) *Sample {
+	limit := sample.Recorded.AddDate(0, 0, -monthDays)
+	var found *Sample
+	for _, s := range b.Samples {
+		if s.Recorded.After(limit) {
+			break
+		}
+		found = s
+	}
+	return found
+}
+
+// Trend is the growth of a bucket over the last month
+type Trend struct {
+	Owner    string
+	ID       string
+	Current  *Sample
+	Previous *Sample
+	// SizeGrowth and ObjectGrowth are the growth in percent since the
+	// previous sample, or zero if the bucket was empty back then
+	SizeGrowth   float64
+	ObjectGrowth float64
+	// Runaway is true if the size or the object count grew by more than
+	// the threshold
+	Runaway bool
+}
+
+// Days returns the number of days between the samples of the trend
+func (t *Trend) Days() int {
+	return int(t.Current.Recorded.Sub(t.Previous.Recorded).Hours() / 24)
+}
+
+// Trends compares the latest sample of every bucket with the sample from
+// a month before, and returns the trends per account. Buckets without a
+// sample from a month ago, or which weren't found on the day of the
+// latest sample in the history, are left out. A bucket is a runaway if it
+// grew by more than the specified percent. Trends are sorted by size
+// growth, largest first.
+func (h *History) Trends(thresholdPercent float64) map[string][]*Trend {
+	var lastRecorded time.Time
+	for _, bucket := range h.Buckets {
+		if current := bucket.latest(); current != nil && current.Recorded.After(lastRecorded) {
+			lastRecorded = current.Recorded
+		}
+	}
+
+	result := make(map[string][]*Trend)
+	for _, bucket := range h.Buckets {
+		current := bucket.latest()
+		if current == nil || !sameDay(current.Recorded, lastRecorded) {
+			continue
+		}
+		previous := bucket.monthBefore(current)
+		if previous == nil {
+			continue
+		}
+		trend := &Trend{
+			Owner:        bucket.Owner,
+			ID:           bucket.ID,
+			Current:      current,
+			Previous:     previous,
+			SizeGrowth:   percentGrowth(previous.SizeGB, current.SizeGB),
+			ObjectGrowth: percentGrowth(float64(previous.ObjectCount), float64(current.ObjectCount)),
+		}
+		trend.Runaway = trend.SizeGrowth > thresholdPercent || trend.ObjectGrowth > thresholdPercent
+		result[bucket.Owner] = append(result[bucket.Owner], trend)
+	}
+	for _, trends := range result {
+		sort.Slice(trends, func(i, j int) bool {
+			if trends[i].SizeGrowth != trends[j].SizeGrowth {
+				return trends[i].SizeGrowth > trends[j].SizeGrowth
+			}
+			return trends[i].ID < trends[j].ID
+		})
+	}
+	return result
+}
+
+// Runaways returns the trends of the buckets which are runaways
+func Runaways(trends []*Trend) []*Trend {
+	result := []*Trend{}
+	for _, trend := range trends {
+		if trend.Runaway {
+			result = append(result, trend)
+		}
+	}
+	return result
+}
+
+func percentGrowth(previous, current float64) float64 {
+	if previous <= 0 {
+		return 0
+	}
+	return (current - previous) / previous * 100
+}
+
+func bucketKey(owner, id string) string {
+	return owner + "/" + id
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
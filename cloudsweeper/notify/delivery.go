@@ -0,0 +1,95 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/delivery"
+	"github.com/agaridata/cloudsweeper/mailer"
+)
+
+// deliveryAttempts is how many times an email is sent before giving up,
+// if the SMTP server fails temporarily
+const deliveryAttempts = 3
+
+var deliveryRetryWait = 10 * time.Second
+
+var managerAddresses = map[string]string{} // Address of the manager of every employee with one, used for escalation
+
+// trackingClient records the outcome of every email in the delivery log,
+// and retries emails which failed temporarily. Emails to an address which
+// bounced repeatedly are sent to the manager of its owner instead.
+type trackingClient struct {
+	client      mailer.Client
+	deliveries  *delivery.Log
+	bounceLimit int
+}
+
+func (t *trackingClient) SendEmail(subject, content string, recipients ...string) error {
+	return t.send(recipients, func(to []string) error {
+		return t.client.SendEmail(subject, content, to...)
+	})
+}
+
+func (t *trackingClient) SendEmailWithAttachments(subject, content string, attachments []mailer.Attachment, recipients ...string) error {
+	return t.send(recipients, func(to []string) error {
+		return t.client.SendEmailWithAttachments(subject, content, attachments, to...)
+	})
+}
+
+func (t *trackingClient) send(recipients []string, send func([]string) error) error {
+	recipients = t.escalate(recipients)
+	var err error
+	for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+		err = send(recipients)
+		if err == nil || isPermanentSMTPError(err) || attempt == deliveryAttempts {
+			break
+		}
+		log.Printf("Could not send email to %s, retrying in %s: %s", strings.Join(recipients, ", "), deliveryRetryWait, err)
+		time.Sleep(deliveryRetryWait)
+	}
+	now := time.Now()
+	for _, recipient := range recipients {
+		t.deliveries.Sent(recipient, now, err)
+	}
+	return err
+}
+
+// escalate replaces the addresses which bounced at least bounceLimit
+// times in a row with the address of the owner's manager
+func (t *trackingClient) escalate(recipients []string) []string {
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, recipient := range recipients {
+		if bounces := t.deliveries.Bounces(recipient); t.bounceLimit > 0 && bounces >= t.bounceLimit {
+			if manager, exist := managerAddresses[recipient]; exist {
+				log.Printf("Emails to %s bounced %d times in a row, sending to %s instead", recipient, bounces, manager)
+				recipient = manager
+			} else {
+				log.Printf("Emails to %s bounced %d times in a row, and there is no manager to send to instead", recipient, bounces)
+			}
+		}
+		if !seen[recipient] {
+			seen[recipient] = true
+			result = append(result, recipient)
+		}
+	}
+	return result
+}
+
+// isPermanentSMTPError checks if the SMTP server refused an email with a
+// 5xx reply, in which case sending it again won't help
+func isPermanentSMTPError(err error) bool {
+	smtpErr, ok := err.(*textproto.Error)
+	return ok && smtpErr.Code >= 500
+}
+
+func employeeAddress(username, domain string) string {
+	return convertEmailExceptions(fmt.Sprintf("%s@%s", username, domain))
+}
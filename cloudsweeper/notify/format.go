@@ -0,0 +1,149 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// DefaultTimeZone is the time zone of dates in emails to users without
+// a time zone of their own
+const DefaultTimeZone = "America/New_York"
+
+var (
+	defaultLocation = mustLoadLocation(DefaultTimeZone)
+	// userLocations maps usernames to the time zone they want dates in
+	userLocations = make(map[string]*time.Location)
+)
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Could not load time zone %s, using UTC: %s", name, err)
+		return time.UTC
+	}
+	return location
+}
+
+// formatter formats dates and sizes in emails the way the recipient
+// wants them. Dates are in the time zone of the recipient.
+type formatter struct {
+	location *time.Location
+	now      time.Time
+}
+
+// formatterFor returns the formatter for the recipient of the email with
+// the specified data, which is the user in its Owner field
+func formatterFor(data interface{}) *formatter {
+	f := &formatter{location: defaultLocation, now: time.Now()}
+	value := reflect.Indirect(reflect.ValueOf(data))
+	if value.Kind() != reflect.Struct {
+		return f
+	}
+	owner := value.FieldByName("Owner")
+	if owner.Kind() != reflect.String {
+		return f
+	}
+	if location, exist := userLocations[owner.String()]; exist {
+		f.location = location
+	}
+	return f
+}
+
+// templateFunctions returns the template functions which format dates
+// and sizes
+func (f *formatter) templateFunctions() template.FuncMap {
+	return template.FuncMap{
+		"fdate":       f.date,
+		"daysrunning": f.ago,
+		"size":        formatSize,
+		"deletedate": func(res cloud.Resource, format string) string {
+			tag, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey)
+			if !exist {
+				return ""
+			}
+			t, err := cloud.ParseTagTime(tag)
+			if err != nil {
+				return ""
+			}
+			return f.date(t, format)
+		},
+	}
+}
+
+// date formats a time in the time zone of the recipient
+func (f *formatter) date(t time.Time, format string) string {
+	return t.In(f.location).Format(format)
+}
+
+// ago describes how long ago a time was, e.g. "3 months ago", in the
+// largest unit that fits
+func (f *formatter) ago(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	days := int(f.now.Sub(t).Hours() / 24.0)
+	switch {
+	case days <= 0:
+		return "today"
+	case days == 1:
+		return "yesterday"
+	case days < 14:
+		return fmt.Sprintf("%d days ago", days)
+	case days < 60:
+		return fmt.Sprintf("%d weeks ago", days/7)
+	case days < 365:
+		return fmt.Sprintf("%d months ago", days/30)
+	case days < 730:
+		return "1 year ago"
+	default:
+		return fmt.Sprintf("%d years ago", days/365)
+	}
+}
+
+var sizeUnits = []string{"GB", "TB", "PB"}
+
+// formatSize formats a size in GB with the largest unit that fits, e.g.
+// "1.2 TB" or "340 MB". Sizes below 10 of a unit get one decimal.
+func formatSize(sizeGB interface{}) string {
+	var size float64
+	switch v := sizeGB.(type) {
+	case float64:
+		size = v
+	case int64:
+		size = float64(v)
+	case int:
+		size = float64(v)
+	default:
+		return fmt.Sprint(sizeGB)
+	}
+	if size == 0 {
+		return "0 GB"
+	}
+	if size < 1 {
+		return formatSizeIn(size*1024, "MB")
+	}
+	unit := 0
+	for size >= 1024 && unit < len(sizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	return formatSizeIn(size, sizeUnits[unit])
+}
+
+func formatSizeIn(size float64, unit string) string {
+	if size < 10 && size != math.Trunc(size) {
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + " " + unit
+	}
+	return fmt.Sprintf("%.0f %s", size, unit)
+}
@@ -7,19 +7,31 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
 	"github.com/agaridata/cloudsweeper/cloud/billing"
 	"github.com/agaridata/cloudsweeper/cloud/filter"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/security"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/unsubscribe"
 	"github.com/agaridata/cloudsweeper/mailer"
 )
 
 var emailEdgeCases = map[string]string{} // Use this map to fix bad mappings between usernames and email aliases
 
+var accountAttributions = cs.Attributions{} // Cost center and project of every account, used by the templates
+var replyCommands = false                   // Whether owners can reply to emails with commands, used by the templates
+var unsubscribeURL = ""                     // Where unsubscribe links point to, empty if owners can't unsubscribe
+var unsubscribeKey []byte                   // Key unsubscribe links are signed with
+
 func generateMail(data interface{}, templateString string) (string, error) {
-	t := template.New("emailTemplate").Funcs(extraTemplateFunctions())
+	t := template.New("emailTemplate").Funcs(extraTemplateFunctions()).Funcs(formatterFor(data).templateFunctions())
 	t, err := t.Parse(templateString)
 	if err != nil {
 		return "", err
@@ -49,7 +61,11 @@ func getMailClient(notifyClient *Client) mailer.Client {
 	port := notifyClient.config.SMTPPort
 	from := notifyClient.config.MailFrom
 	displayName := notifyClient.config.DisplayName
-	return mailer.NewClient(username, password, displayName, from, server, port)
+	client := mailer.NewClient(username, password, displayName, from, server, port)
+	if notifyClient.config.Deliveries == nil {
+		return client
+	}
+	return &trackingClient{client, notifyClient.config.Deliveries, notifyClient.config.BounceLimit}
 }
 
 func timeUntilEarliestDeletion(resourceCollection cloud.AllResourceCollection) string {
@@ -75,11 +91,11 @@ func timeUntilEarliestDeletion(resourceCollection cloud.AllResourceCollection) s
 	}
 
 	for _, res := range resources {
-		tempTag, exists := res.Tags()["cloudsweeper-delete-at"]
+		tempTag, exists := filter.VerifiedTagValue(res, filter.DeleteTagKey)
 		if !exists {
 			continue
 		}
-		tempTime, err := time.Parse(time.RFC3339, tempTag)
+		tempTime, err := cloud.ParseTagTime(tempTag)
 		if err != nil {
 			continue
 		}
@@ -98,23 +114,160 @@ func accumulatedCost(res cloud.Resource) float64 {
 	return days * costPerDay
 }
 
+// sortedKeys returns the keys of a map keyed by account or username in
+// order, so that emails are sent, and summaries are listed, in the same
+// order on every run
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lessByCost is the order of everything listed in emails: by owner, then
+// by cost with the most expensive first, then by ID
+func lessByCost(ownerA, ownerB string, costA, costB float64, idA, idB string) bool {
+	if ownerA != ownerB {
+		return ownerA < ownerB
+	}
+	if costA != costB {
+		return costA > costB
+	}
+	return idA < idB
+}
+
+// lessResourceByCost orders resources by lessByCost
+func lessResourceByCost(a, b cloud.Resource, cost func(cloud.Resource) float64) bool {
+	return lessByCost(a.Owner(), b.Owner(), cost(a), cost(b), a.ID(), b.ID())
+}
+
+// sortInstances sorts instances by cost, with GPU instances first since
+// they cost the most to leave running
+func sortInstances(instances []cloud.Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		gpuA, gpuB := cloud.IsGPUInstanceType(instances[i].InstanceType()), cloud.IsGPUInstanceType(instances[j].InstanceType())
+		if gpuA != gpuB {
+			return gpuA
+		}
+		return lessResourceByCost(instances[i], instances[j], accumulatedCost)
+	})
+}
+
+func sortVolumes(volumes []cloud.Volume) {
+	sort.Slice(volumes, func(i, j int) bool {
+		return lessResourceByCost(volumes[i], volumes[j], accumulatedCost)
+	})
+}
+
+func sortSnapshots(snapshots []cloud.Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return lessResourceByCost(snapshots[i], snapshots[j], accumulatedCost)
+	})
+}
+
+func sortOpenGroups(groups []security.OpenGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].Group, groups[j].Group
+		return lessByCost(a.Owner(), b.Owner(), 0, 0, a.ID(), b.ID())
+	})
+}
+
+// costPerMonth returns what a resource costs per month
+func costPerMonth(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	return billing.ResourceCostPerDay(res) * 30
+}
+
+// resourceKind returns the kind of a resource, as shown in emails
+func resourceKind(res cloud.Resource) string {
+	switch res.(type) {
+	case cloud.Instance:
+		return "Instance"
+	case cloud.Image:
+		return "Image"
+	case cloud.Volume:
+		return "Volume"
+	case cloud.Snapshot:
+		return "Snapshot"
+	case cloud.Bucket:
+		return "Bucket"
+	}
+	return "Resource"
+}
+
+func bucketCost(res cloud.Resource) float64 {
+	return billing.BucketPricePerMonth(res.(cloud.Bucket))
+}
+
+func fileSystemCost(res cloud.Resource) float64 {
+	return billing.FileSystemCostPerMonth(res.(cloud.FileSystem))
+}
+
+func vpnCost(res cloud.Resource) float64 {
+	return billing.VPNCostPerMonth(res.(cloud.VPN))
+}
+
+func dataClusterCost(res cloud.Resource) float64 {
+	return billing.DataClusterCostPerMonth(res.(cloud.DataCluster))
+}
+
+// dataClusterInstances describes the running instances of a cluster,
+// such as 1 x m5.xlarge, 4 x r5.2xlarge (spot)
+func dataClusterInstances(cluster cloud.DataCluster) string {
+	descriptions := []string{}
+	for instanceType, count := range cluster.OnDemandInstances() {
+		descriptions = append(descriptions, fmt.Sprintf("%d x %s", count, instanceType))
+	}
+	for instanceType, count := range cluster.SpotInstances() {
+		descriptions = append(descriptions, fmt.Sprintf("%d x %s (spot)", count, instanceType))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ", ")
+}
+
+func mlCost(res cloud.Resource) float64 {
+	return billing.MLResourceCostPerMonth(res.(cloud.MLResource))
+}
+
+// mlInstances describes the instances of a machine learning resource,
+// such as 2 x ml.m5.xlarge
+func mlInstances(res cloud.MLResource) string {
+	descriptions := []string{}
+	for instanceType, count := range res.Instances() {
+		descriptions = append(descriptions, fmt.Sprintf("%d x %s", count, instanceType))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ", ")
+}
+
+// attributedGroups returns the groups of a cost rollup, or nil if no
+// costs are attributed to any group, so the rollup isn't shown
+func attributedGroups(groups billing.UserList) billing.UserList {
+	for _, group := range groups {
+		if group.Name != "" {
+			return groups
+		}
+	}
+	return nil
+}
+
+// consoleLink returns the ID of a resource, alarm or dashboard, linked to
+// its page in the console of its CSP if it has one
+func consoleLink(res interface{ ID() string }) template.HTML {
+	id := template.HTMLEscapeString(res.ID())
+	consoleURL := cloud.ConsoleURL(res)
+	if consoleURL == "" {
+		return template.HTML(id)
+	}
+	return template.HTML(fmt.Sprintf(`<a href="%s">%s</a>`, template.HTMLEscapeString(consoleURL), id))
+}
+
 func extraTemplateFunctions() template.FuncMap {
 	return template.FuncMap{
-		"fdate": func(t time.Time, format string) string { return t.Format(format) },
-		"daysrunning": func(t time.Time) string {
-			if (t == time.Time{}) {
-				return "never"
-			}
-			days := int(time.Now().Sub(t).Hours() / 24.0)
-			switch days {
-			case 0:
-				return "today"
-			case 1:
-				return "yesterday"
-			default:
-				return fmt.Sprintf("%d days ago", days)
-			}
-		},
 		// TODO: this should be configurable
 		"modifiedInTheLast6Months": func(t time.Time) string {
 			if time.Now().Before(t.AddDate(0, 6, 0)) {
@@ -130,6 +283,19 @@ func extraTemplateFunctions() template.FuncMap {
 			}
 			return "No"
 		},
+		"tagkey": func(name string) string {
+			switch name {
+			case "whitelist":
+				return filter.WhitelistTagKey
+			case "lifetime":
+				return filter.LifetimeTagKey
+			case "expiry":
+				return filter.ExpiryTagKey
+			case "delete":
+				return filter.DeleteTagKey
+			}
+			return name
+		},
 		"whitelisted": func(res cloud.Resource) bool {
 			return filter.IsWhitelisted(res)
 		},
@@ -140,6 +306,40 @@ func extraTemplateFunctions() template.FuncMap {
 		"bucketcost": func(res cloud.Bucket) float64 {
 			return billing.BucketPricePerMonth(res)
 		},
+		"earlydeletionfee": func(res cloud.Bucket) float64 {
+			return billing.BucketEarlyDeletionFee(res)
+		},
+		"archivesavings": func(snap cloud.Snapshot) float64 {
+			return billing.SnapshotArchiveSavingsPerMonth(snap)
+		},
+		"filesystemcost": func(fileSystem cloud.FileSystem) float64 {
+			return billing.FileSystemCostPerMonth(fileSystem)
+		},
+		"vpncost": func(vpn cloud.VPN) float64 {
+			return billing.VPNCostPerMonth(vpn)
+		},
+		"clustercost": func(cluster cloud.DataCluster) float64 {
+			return billing.DataClusterCostPerMonth(cluster)
+		},
+		"clusterinstances": dataClusterInstances,
+		"mlcost": func(res cloud.MLResource) float64 {
+			return billing.MLResourceCostPerMonth(res)
+		},
+		"mlinstances": mlInstances,
+		"debris": func(inst cloud.Instance) *cloud.InstanceDebris {
+			if reporter, ok := inst.(cloud.DebrisReporter); ok {
+				return reporter.FindDebris()
+			}
+			return nil
+		},
+		"releaseselasticips": cloud.ReleasesElasticIPs,
+		"elasticipcost":      billing.ElasticIPCostPerMonth,
+		"gpu": func(inst cloud.Instance) bool {
+			return cloud.IsGPUInstanceType(inst.InstanceType())
+		},
+		"imagesavings": func(img cloud.Image) float64 {
+			return billing.ImageCostPerDay(img) * 30.0
+		},
 		"instname": func(inst cloud.Instance) string {
 			if inst.CSP() == cloud.AWS {
 				name, exist := inst.Tags()["Name"]
@@ -148,31 +348,48 @@ func extraTemplateFunctions() template.FuncMap {
 				}
 				return ""
 
-			} else if inst.CSP() == cloud.GCP {
+			} else if inst.CSP() == cloud.GCP || inst.CSP() == cloud.Kubernetes {
 				return inst.ID()
+			} else if vm, ok := inst.(interface{ Name() string }); ok && inst.CSP() == cloud.VSphere {
+				return vm.Name()
 			} else {
 				return ""
 			}
 		},
 		"productname": func(res cloud.Resource) string {
-			product, exist := res.Tags()["product"]
+			product, exist := cloud.Tags(res.Tags()).Get("product")
 			if exist {
 				return product
 			}
 			return ""
 		},
+		"costcenter": func(res cloud.Resource) string {
+			return accountAttributions.ForResource(res).CostCenter
+		},
+		"project": func(res cloud.Resource) string {
+			return accountAttributions.ForResource(res).Project
+		},
 		"rolename": func(res cloud.Resource) string {
-			role, exist := res.Tags()["role"]
+			role, exist := cloud.Tags(res.Tags()).Get("role")
 			if exist {
 				return role
 			}
 			return ""
 		},
+		"link":         consoleLink,
+		"accountname":  cloud.AccountDisplayName,
+		"deletereason": cleanup.DeleteReason,
+		"kind":         resourceKind,
+		"backupsource": func(res cloud.Resource) string {
+			return res.Tags()[filter.BackupSourceTagKey]
+		},
+		"replycommands": func() bool { return replyCommands },
+		"unsubscribe":   unsubscribeFooter,
 		"maybeRealName": func(account string, accountToUser map[string]string) string {
 			if name, ok := accountToUser[account]; ok {
 				return name
 			}
-			return account
+			return cloud.AccountDisplayName(account)
 		},
 		"prettyTag": func(key, val string) string {
 			if val == "" {
@@ -180,17 +397,6 @@ func extraTemplateFunctions() template.FuncMap {
 			}
 			return fmt.Sprintf("%s: %s", key, val)
 		},
-		"deletedate": func(res cloud.Resource, format string) string {
-			tag, exist := res.Tags()["cloudsweeper-delete-at"]
-			if !exist {
-				return ""
-			}
-			t, err := time.Parse(time.RFC3339, tag)
-			if err != nil {
-				return ""
-			}
-			return t.Format(format)
-		},
 		// TODO: This isn't pretty whatsoever
 		"timeUntilDelete": func(instances []cloud.Instance, images []cloud.Image, snapshots []cloud.Snapshot, volumes []cloud.Volume, buckets []cloud.Bucket) string {
 			allResources := cloud.AllResourceCollection{}
@@ -203,3 +409,14 @@ func extraTemplateFunctions() template.FuncMap {
 		},
 	}
 }
+
+// unsubscribeFooter returns the footer of informational emails, with the
+// link unsubscribing the owner from the report
+func unsubscribeFooter(owner, report string) template.HTML {
+	if unsubscribeURL == "" || owner == "" {
+		return ""
+	}
+	link := unsubscribe.Link(unsubscribeURL, unsubscribeKey, owner, report)
+	return template.HTML(fmt.Sprintf(`<p style="font-size: small; color: #666;">Don't want these emails? <a href="%s">Unsubscribe</a> from %s.</p>`,
+		template.HTMLEscapeString(link), template.HTMLEscapeString(unsubscribe.Reports[report])))
+}
@@ -15,9 +15,11 @@
 package notify
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/agaridata/cloudsweeper/mailer"
@@ -26,6 +28,17 @@ import (
 	"github.com/agaridata/cloudsweeper/cloud/billing"
 	"github.com/agaridata/cloudsweeper/cloud/filter"
 	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/chargeback"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/delivery"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/digest"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/events"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/growth"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/remarks"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/replies"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/security"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/unsubscribe"
+	"github.com/agaridata/cloudsweeper/status"
 )
 
 // Client is used to perform the notify actions. It must be
@@ -45,10 +58,68 @@ type Config struct {
 	EmailDomain            string
 	BillingReportAddressee string
 	TotalSumAddresse       string
+	// Emails maps usernames to email addresses, for users whose address
+	// isn't their username at EmailDomain
+	Emails map[string]string
+	// Attributions maps accounts to their cost center and project, which
+	// are shown in emails and used for rollups in the billing report
+	Attributions cs.Attributions
+	// ReplyCommands is true if replies to emails are processed, so owners
+	// are told they can reply with commands
+	ReplyCommands bool
+	// Deliveries is where the outcome of every email is recorded, or nil
+	// if deliveries aren't tracked
+	Deliveries *delivery.Log
+	// Managers maps usernames to the username of their manager. Emails
+	// are sent to the manager instead once an address bounced BounceLimit
+	// times in a row.
+	Managers    map[string]string
+	BounceLimit int
+	// TimeZone is the time zone of dates in emails, and TimeZones maps
+	// usernames to the time zone of the dates in emails to them
+	TimeZone  string
+	TimeZones map[string]string
+	// Unsubscribes are the informational emails owners unsubscribed
+	// from, which aren't sent to them, or nil if they can't unsubscribe.
+	// UnsubscribeURL is where the signed unsubscribe links point to, and
+	// UnsubscribeKey is the key they are signed with.
+	Unsubscribes   *unsubscribe.List
+	UnsubscribeURL string
+	UnsubscribeKey []byte
+	// CostThreshold is the smallest cost per month, in USD, of the
+	// resources in a review email for it to be sent, and OwnerCostThresholds
+	// overrides it for some owners. The resources of emails which aren't
+	// sent are added to Digest, which is sent monthly, instead. Zero sends
+	// every email.
+	CostThreshold       float64
+	OwnerCostThresholds map[string]float64
+	Digest              *digest.Digest
+	// RightSizing are the thresholds of the right-sizing recommendations
+	// in review emails, or nil if review emails have none
+	RightSizing *cleanup.RightSizingThresholds
 }
 
 // Init will initialize a notify Client with a given Config
 func Init(config *Config) *Client {
+	for username, email := range config.Emails {
+		emailEdgeCases[fmt.Sprintf("%s@%s", username, config.EmailDomain)] = email
+	}
+	if config.Attributions != nil {
+		accountAttributions = config.Attributions
+	}
+	replyCommands = config.ReplyCommands
+	unsubscribeURL = config.UnsubscribeURL
+	unsubscribeKey = config.UnsubscribeKey
+	if config.TimeZone != "" {
+		defaultLocation = mustLoadLocation(config.TimeZone)
+	}
+	userLocations = make(map[string]*time.Location)
+	for username, timeZone := range config.TimeZones {
+		userLocations[username] = mustLoadLocation(timeZone)
+	}
+	for username, manager := range config.Managers {
+		managerAddresses[employeeAddress(username, config.EmailDomain)] = employeeAddress(manager, config.EmailDomain)
+	}
 	return &Client{config: config}
 }
 
@@ -61,27 +132,57 @@ type resourceMailData struct {
 	Volumes        []cloud.Volume
 	Buckets        []cloud.Bucket
 	HoursInAdvance int
+	// CostGates are how the cost thresholds were applied when marking
+	CostGates []*cleanup.CostGate
+	// BackupManaged are the resources which would have been marked, had
+	// they not been managed by AWS Backup
+	BackupManaged []cloud.Resource
+	// RightSizing are the instances recommended a smaller type, by the
+	// thresholds in RightSizingThresholds
+	RightSizing           []*cleanup.RightSizing
+	RightSizingThresholds cleanup.RightSizingThresholds
+	// Undeletable are the resources which would have been marked, had
+	// they not been protected from deletion
+	Undeletable []*cleanup.Undeletable
 }
 
 func (d *resourceMailData) ResourceCount() int {
 	return len(d.Images) + len(d.Instances) + len(d.Snapshots) + len(d.Volumes) + len(d.Buckets)
 }
 
+func (d *resourceMailData) resources() []cloud.Resource {
+	resources := []cloud.Resource{}
+	for _, res := range d.Instances {
+		resources = append(resources, res)
+	}
+	for _, res := range d.Images {
+		resources = append(resources, res)
+	}
+	for _, res := range d.Snapshots {
+		resources = append(resources, res)
+	}
+	for _, res := range d.Volumes {
+		resources = append(resources, res)
+	}
+	for _, res := range d.Buckets {
+		resources = append(resources, res)
+	}
+	return resources
+}
+
 func (d *resourceMailData) SortByCost() {
-	sort.Slice(d.Instances, func(i, j int) bool {
-		return accumulatedCost(d.Instances[i]) > accumulatedCost(d.Instances[j])
-	})
+	sortInstances(d.Instances)
 	sort.Slice(d.Images, func(i, j int) bool {
-		return accumulatedCost(d.Images[i]) > accumulatedCost(d.Images[j])
+		return lessResourceByCost(d.Images[i], d.Images[j], accumulatedCost)
 	})
 	sort.Slice(d.Snapshots, func(i, j int) bool {
-		return accumulatedCost(d.Snapshots[i]) > accumulatedCost(d.Snapshots[j])
+		return lessResourceByCost(d.Snapshots[i], d.Snapshots[j], accumulatedCost)
 	})
 	sort.Slice(d.Volumes, func(i, j int) bool {
-		return accumulatedCost(d.Volumes[i]) > accumulatedCost(d.Volumes[j])
+		return lessResourceByCost(d.Volumes[i], d.Volumes[j], accumulatedCost)
 	})
 	sort.Slice(d.Buckets, func(i, j int) bool {
-		return billing.BucketPricePerMonth(d.Buckets[i]) > billing.BucketPricePerMonth(d.Buckets[j])
+		return lessResourceByCost(d.Buckets[i], d.Buckets[j], bucketCost)
 	})
 }
 
@@ -91,7 +192,8 @@ func (d *resourceMailData) SendEmail(client mailer.Client, domain, mailTemplate,
 
 	mailContent, err := generateMail(d, mailTemplate)
 	if err != nil {
-		log.Fatalln("Could not generate email:", err)
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
 	}
 
 	ownerMail := fmt.Sprintf("%s@%s", d.Owner, domain)
@@ -100,7 +202,7 @@ func (d *resourceMailData) SendEmail(client mailer.Client, domain, mailTemplate,
 	addressees := append(debugAddressees, recieverMail)
 	err = client.SendEmail(title, mailContent, addressees...)
 	if err != nil {
-		log.Fatalf("Failed to email %s: %s\n", recieverMail, err)
+		status.ActionFailedf("Failed to email %s: %s\n", recieverMail, err)
 	}
 }
 
@@ -111,6 +213,17 @@ type monthToDateData struct {
 	MinimumTotalCost float64
 	MinimumCost      float64
 	AccountToUser    map[string]string
+	TotalBlendedCost float64
+	ShowBlended      bool
+	Report           *billing.Report
+	CostCenters      billing.UserList
+	Projects         billing.UserList
+	// Previous is the report of the previous equivalent period, which
+	// costs are compared with, or nil if they aren't
+	Previous            *billing.Report
+	PreviousUsers       map[string]float64
+	PreviousCostCenters map[string]float64
+	PreviousProjects    map[string]float64
 }
 
 func initTotalSummaryMailData(totalSumAddressee string) *resourceMailData {
@@ -139,6 +252,18 @@ func initManagerToMailDataMapping(managers cs.Employees) map[string]*resourceMai
 	return result
 }
 
+// reviewThresholds are the thresholds OldResourceReview needs
+var reviewThresholds = []string{
+	"notify-instances-older-than-days",
+	"notify-images-older-than-days",
+	"notify-unattached-older-than-days",
+	"notify-snapshots-older-than-days",
+	"notify-buckets-older-than-days",
+	"notify-whitelist-older-than-days",
+	"notify-untagged-older-than-days",
+	"notify-dnd-older-than-days",
+}
+
 // OldResourceReview will review (but not do any cleanup action) old resources
 // that an owner might want to consider doing something about. The owner is then
 // sent an email with a list of these resources. Resources are sent for review
@@ -146,23 +271,19 @@ func initManagerToMailDataMapping(managers cs.Employees) map[string]*resourceMai
 //		- Resource is older than 30 days
 //		- A whitelisted resource is older than 6 months
 //		- An instance marked with do-not-delete is older than a week
-func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, thresholds map[string]int, dndList map[string]bool) {
-	allCompute := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
+// An error is returned, before any email is sent, if a threshold is missing.
+func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, thresholds map[string]int, dndList map[string]bool) error {
+	if err := cleanup.CheckThresholds(thresholds, reviewThresholds...); err != nil {
+		return err
+	}
 	accountUserMapping := org.AccountToUserMapping(csp)
 	userEmployeeMapping := org.UsernameToEmployeeMapping()
 	totalSummaryMailData := initTotalSummaryMailData(c.config.TotalSumAddresse)
 	managerToMailDataMapping := initManagerToMailDataMapping(org.Managers)
 
+	// All thresholds were checked above
 	getThreshold := func(key string, thresholds map[string]int) int {
-		threshold, found := thresholds[key]
-		if found {
-			return threshold
-		} else {
-			errorText := fmt.Sprintf("Threshold '%s' not found", key)
-			log.Fatalln(errorText)
-			return 99999
-		}
+		return thresholds[key]
 	}
 
 	// Create filters
@@ -203,8 +324,9 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 	dndFilter.AddGeneralRule(filter.Negate(filter.DoNotDelete(dndList)))
 	dndFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-dnd-older-than-days", thresholds)))
 
-	for account, resources := range allCompute {
-		log.Println("Performing old resource review in", account)
+	mngr.ForEachAccountResources(func(resources *cloud.AllResourceCollection) {
+		account := resources.Owner
+		log.Println("Performing old resource review in", cloud.AccountDisplayName(account))
 		username := accountUserMapping[account]
 		employee := userEmployeeMapping[username]
 
@@ -215,10 +337,7 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 			Images:    filter.Images(resources.Images, imageFilter, untaggedFilter),
 			//Volumes:   filter.Volumes(resources.Volumes, volumeFilter, untaggedFilter),
 			//Snapshots: filter.Snapshots(resources.Snapshots, snapshotFilter, untaggedFilter),
-			Buckets: []cloud.Bucket{},
-		}
-		if buckets, ok := allBuckets[account]; ok {
-			userMailData.Buckets = filter.Buckets(buckets, bucketFilter, untaggedFilter)
+			Buckets: filter.Buckets(resources.Buckets, bucketFilter, untaggedFilter),
 		}
 
 		// Apply filters (INCLUDE WHITELISTED)
@@ -228,10 +347,7 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 			Images:    filter.Images(resources.Images, imageFilter, whitelistFilter, untaggedFilter),
 			//Volumes:   filter.Volumes(resources.Volumes, volumeFilter, untaggedFilter),
 			//Snapshots: filter.Snapshots(resources.Snapshots, snapshotFilter, untaggedFilter),
-			Buckets: []cloud.Bucket{},
-		}
-		if buckets, ok := allBuckets[account]; ok {
-			userMailDataWhitelisted.Buckets = filter.Buckets(buckets, bucketFilter, whitelistFilter, untaggedFilter)
+			Buckets: filter.Buckets(resources.Buckets, bucketFilter, whitelistFilter, untaggedFilter),
 		}
 		// Add to the manager summary
 		if managerSummaryMailData, ok := managerToMailDataMapping[employee.Manager.Username]; ok { // safe or org _should_ have thrown an error
@@ -241,7 +357,7 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 			managerSummaryMailData.Volumes = append(managerSummaryMailData.Volumes, userMailData.Volumes...)
 			managerSummaryMailData.Buckets = append(managerSummaryMailData.Buckets, userMailData.Buckets...)
 		} else {
-			log.Fatalf("%s is not a manager??? Verify `organization.go` and the org repo itself for issues", employee.Manager.Username)
+			status.Warnf("%s is not a manager, leaving %s out of the team summary. Verify the organization file", employee.Manager.Username, username)
 		}
 
 		// Add to the total summary
@@ -251,16 +367,32 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 		totalSummaryMailData.Volumes = append(totalSummaryMailData.Volumes, userMailDataWhitelisted.Volumes...)
 		totalSummaryMailData.Buckets = append(totalSummaryMailData.Buckets, userMailDataWhitelisted.Buckets...)
 
-		if userMailData.ResourceCount() > 0 {
+		if c.unsubscribed(username, "review") {
+			return
+		}
+		if userMailData.ResourceCount() > 0 && c.suppressedByCost(&userMailData, "review") {
+			// The resources are in the digest, but the recommendations
+			// are still sent
+			userMailData = resourceMailData{Owner: username}
+		}
+		if c.config.RightSizing != nil {
+			userMailData.RightSizing = cleanup.FindRightSizing(resources.Instances, *c.config.RightSizing)
+			userMailData.RightSizingThresholds = *c.config.RightSizing
+		}
+		if userMailData.ResourceCount() > 0 || len(userMailData.RightSizing) > 0 {
 			title := fmt.Sprintf("Review Notification (%d resources) (%s)", userMailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			if len(userMailData.RightSizing) > 0 {
+				title = fmt.Sprintf("Review Notification (%d resources, %d right-sizing recommendations) (%s)", userMailData.ResourceCount(), len(userMailData.RightSizing), time.Now().Format("2006-01-02"))
+			}
 			userMailData.SendEmail(getMailClient(c), c.config.EmailDomain, reviewMailTemplate, title)
 		}
-	}
+	})
 
 	// Send out manager emails
-	for username, managerSummaryMailData := range managerToMailDataMapping {
+	for _, username := range sortedKeys(managerToMailDataMapping) {
+		managerSummaryMailData := managerToMailDataMapping[username]
 		log.Printf("Collecting old resources to review for %s's team\n", username)
-		if managerSummaryMailData.ResourceCount() > 0 {
+		if managerSummaryMailData.ResourceCount() > 0 && !c.unsubscribed(username, "review") {
 			title := fmt.Sprintf("Your team has %d old resources to review (%s)", managerSummaryMailData.ResourceCount(), time.Now().Format("2006-01-02"))
 			managerSummaryMailData.SendEmail(getMailClient(c), c.config.EmailDomain, managerReviewMailTemplate, title)
 		}
@@ -268,19 +400,22 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 
 	// Send out a total summary
 	log.Println("Collecting old resource review for the org")
+	if c.unsubscribed(totalSummaryMailData.Owner, "review") {
+		return nil
+	}
 	title := fmt.Sprintf("Your org has %d old resources to review (%s)", totalSummaryMailData.ResourceCount(), time.Now().Format("2006-01-02"))
 	totalSummaryMailData.SendEmail(getMailClient(c), c.config.EmailDomain, totalReviewMailTemplate, title)
+	return nil
 }
 
 // UntaggedResourcesReview will look for resources without any tags, and
 // send out a mail encouraging people to tag them
 func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUserMapping map[string]string, tags []string) {
-	allCompute := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	for account, resources := range allCompute {
-		log.Printf("Performing untagged resources review in %s", account)
+	mngr.ForEachAccountResources(func(resources *cloud.AllResourceCollection) {
+		account := resources.Owner
+		log.Printf("Performing untagged resources review in %s", cloud.AccountDisplayName(account))
 		untaggedFilter := filter.New()
-		untaggedFilter.AddGeneralRule(filter.Negate(filter.HasTag("cloudsweeper-delete-at")))
+		untaggedFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.DeleteTagKey)))
 		untaggedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		if len(tags) == 0 {
 			untaggedFilter.AddGeneralRule(filter.IsUntaggedWithException("Name"))
@@ -299,13 +434,10 @@ func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUser
 			Images:    filter.Images(resources.Images, untaggedFilter),
 			//Snapshots: filter.Snapshots(resources.Snapshots, untaggedFilter),
 			//Volumes:   filter.Volumes(resources.Volumes, untaggedFilter),
-			Buckets: []cloud.Bucket{},
-		}
-		if buckets, ok := allBuckets[account]; ok {
-			mailData.Buckets = filter.Buckets(buckets, untaggedFilter)
+			Buckets: filter.Buckets(resources.Buckets, untaggedFilter),
 		}
 
-		if mailData.ResourceCount() > 0 {
+		if mailData.ResourceCount() > 0 && !c.unsubscribed(username, "untagged") {
 			// Send mail
 			title := fmt.Sprintf("Untagged Notification (%d resources) (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
 			// You can add some debug email address to ensure it works
@@ -313,7 +445,7 @@ func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUser
 			// mailData.SendEmail(getMailClient(c), c.config.EmailDomain, untaggedMailTemplate, title, debugAddressees...)
 			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, untaggedMailTemplate, title)
 		}
-	}
+	})
 }
 
 // DeletionWarning will find resources which are about to be deleted within
@@ -321,12 +453,19 @@ func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUser
 // with a warning. Resources explicitly tagged to be deleted are not included
 // in this warning.
 func (c *Client) DeletionWarning(hoursInAdvance int, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
-	allCompute := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	for account, resources := range allCompute {
+	mngr.ForEachAccountResources(func(resources *cloud.AllResourceCollection) {
+		account := resources.Owner
 		ownerName := convertEmailExceptions(accountUserMapping[account])
 		fil := filter.New()
 		fil.AddGeneralRule(filter.DeleteWithinXHours(hoursInAdvance))
+		opts := cleanup.CurrentOptions()
+		if opts.ExcludeBackupManaged {
+			// Left to their backup plan, so they won't be deleted
+			fil.AddGeneralRule(filter.Negate(filter.IsBackupManaged()))
+		}
+		if opts.ExcludeDLMManaged {
+			fil.AddGeneralRule(filter.Negate(filter.IsDLMManaged()))
+		}
 		mailData := resourceMailData{
 			ownerName,
 			account,
@@ -334,11 +473,13 @@ func (c *Client) DeletionWarning(hoursInAdvance int, mngr cloud.ResourceManager,
 			filter.Images(resources.Images, fil),
 			filter.Snapshots(resources.Snapshots, fil),
 			filter.Volumes(resources.Volumes, fil),
-			[]cloud.Bucket{},
+			filter.Buckets(resources.Buckets, fil),
 			hoursInAdvance,
-		}
-		if buckets, ok := allBuckets[account]; ok {
-			mailData.Buckets = filter.Buckets(buckets, fil)
+			nil,
+			nil,
+			nil,
+			cleanup.RightSizingThresholds{},
+			nil,
 		}
 
 		if mailData.ResourceCount() > 0 {
@@ -346,12 +487,12 @@ func (c *Client) DeletionWarning(hoursInAdvance int, mngr cloud.ResourceManager,
 			title := fmt.Sprintf("Deletion Warning (%d resources)", mailData.ResourceCount())
 			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, deletionWarningTemplate, title)
 		}
-	}
+	})
 }
 
 // MonthToDateReport sends an email to engineering with the
 // Month-to-Date billing report
-func (c *Client) MonthToDateReport(report billing.Report, accountUserMapping map[string]string, sortedByTags bool) {
+func (c *Client) MonthToDateReport(report billing.Report, previous *billing.Report, accountUserMapping map[string]string, sortedByTags bool) {
 	mailClient := getMailClient(c)
 	var sorted billing.UserList
 	if sortedByTags {
@@ -359,24 +500,47 @@ func (c *Client) MonthToDateReport(report billing.Report, accountUserMapping map
 	} else {
 		sorted = report.SortedUsersByTotalCost()
 	}
-	reportData := monthToDateData{report.CSP, report.TotalCost(), sorted, billing.MinimumTotalCost, billing.MinimumCost, accountUserMapping}
+	reportData := monthToDateData{report.CSP, report.TotalCost(), sorted, billing.MinimumTotalCost, billing.MinimumCost, accountUserMapping, report.TotalBlendedCost(), report.HasBlendedCosts(), &report,
+		attributedGroups(report.SortedAccountGroupsByTotalCost(accountAttributions.CostCenters())),
+		attributedGroups(report.SortedAccountGroupsByTotalCost(accountAttributions.Projects())),
+		previous, nil, nil, nil}
+	if previous != nil {
+		reportData.PreviousUsers = previous.TotalCostsByUser(sortedByTags)
+		reportData.PreviousCostCenters = previous.TotalCostsByAccountGroup(accountAttributions.CostCenters())
+		reportData.PreviousProjects = previous.TotalCostsByAccountGroup(accountAttributions.Projects())
+	}
 	mailContent, err := generateMail(reportData, monthToDateTemplate)
 	if err != nil {
-		log.Fatalln("Could not generate email:", err)
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
 	}
 	billingReportMail := fmt.Sprintf("%s@%s", c.config.BillingReportAddressee, c.config.EmailDomain)
 	recipientMail := convertEmailExceptions(billingReportMail)
-	log.Printf("Sending the Month-to-date report to %s\n", recipientMail)
-	title := fmt.Sprintf("Month-to-date %s billing report", report.CSP)
-	err = mailClient.SendEmail(title, mailContent, recipientMail)
+	log.Printf("Sending the %s report to %s\n", report.Period.Name, recipientMail)
+	title := fmt.Sprintf("%s %s billing report", report.Period.Name, report.CSP)
+	var breakdown bytes.Buffer
+	err = report.WriteCSV(&breakdown, accountUserMapping,
+		billing.AccountColumn{Title: "Cost center", Values: accountAttributions.CostCenters()},
+		billing.AccountColumn{Title: "Project", Values: accountAttributions.Projects()})
+	if err != nil {
+		status.ActionFailedf("Could not generate the billing breakdown: %s\n", err)
+		return
+	}
+	attachment := mailer.Attachment{
+		Filename:    fmt.Sprintf("%s-billing-%s-%s.csv", strings.ToLower(string(report.CSP)), report.Period.Start.Format("2006-01-02"), report.Period.LastDay().Format("2006-01-02")),
+		ContentType: "text/csv",
+		Content:     breakdown.Bytes(),
+	}
+	err = mailClient.SendEmailWithAttachments(title, mailContent, []mailer.Attachment{attachment}, recipientMail)
 	if err != nil {
-		log.Printf("Failed to email %s: %s\n", recipientMail, err)
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
 	}
 }
 
 // MarkingDryRunReport will send an email with all the resources that would have been marked for deletion
 func (c *Client) MarkingDryRunReport(taggedResources map[string]*cloud.AllResourceCollection, accountUserMapping map[string]string) {
-	for account, resources := range taggedResources {
+	for _, account := range sortedKeys(taggedResources) {
+		resources := taggedResources[account]
 		// Use a debug user here
 		mailData := resourceMailData{
 			Owner:     "cloudsweeper-test",
@@ -386,12 +550,1502 @@ func (c *Client) MarkingDryRunReport(taggedResources map[string]*cloud.AllResour
 			Snapshots: resources.Snapshots,
 			Volumes:   resources.Volumes,
 			Buckets:   resources.Buckets,
+			CostGates:     cleanup.CostGatesOf(account),
+			BackupManaged: cleanup.BackupManagedOf(account),
+			Undeletable:   cleanup.UndeletableOf(account),
 		}
 
-		if mailData.ResourceCount() > 0 {
+		if mailData.ResourceCount() > 0 || len(mailData.BackupManaged) > 0 || len(mailData.Undeletable) > 0 {
 			// Send email
 			title := fmt.Sprintf("Dry Run Notification (%d resources)", mailData.ResourceCount())
 			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, markingDryRunTemplate, title)
 		}
 	}
 }
+
+// NotifyOnlyReview will send an email to the owner of every account with
+// resources matching the cleanup rules in categories which the policy
+// only allows notifying about. These resources are never marked, so the
+// owner is notified about them on every run.
+func (c *Client) NotifyOnlyReview(notifyOnly map[string]*cloud.AllResourceCollection, accountUserMapping map[string]string) {
+	for _, account := range sortedKeys(notifyOnly) {
+		resources := notifyOnly[account]
+		mailData := resourceMailData{
+			Owner:     accountUserMapping[account],
+			OwnerID:   account,
+			Instances: resources.Instances,
+			Images:    resources.Images,
+			Snapshots: resources.Snapshots,
+			Volumes:   resources.Volumes,
+			Buckets:   resources.Buckets,
+		}
+		if mailData.ResourceCount() > 0 && c.suppressedByCost(&mailData, "notify-only") {
+			// The resources are in the digest, but the protected ones
+			// still need to be reviewed
+			mailData = resourceMailData{Owner: mailData.Owner, OwnerID: account}
+		}
+		mailData.Undeletable = cleanup.UndeletableOf(account)
+
+		count := mailData.ResourceCount() + len(mailData.Undeletable)
+		if count > 0 && !c.unsubscribed(mailData.Owner, "notify-only") {
+			title := fmt.Sprintf("Resources to review (%d resources)", count)
+			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, notifyOnlyTemplate, title)
+		}
+	}
+}
+
+// ShadowPolicyReview will send a one-off email to the owner of every
+// account with resources which would be marked for cleanup under an
+// upcoming policy, but not under the active one, to give them warning
+// before a stricter policy goes live
+func (c *Client) ShadowPolicyReview(delta map[string]*cloud.AllResourceCollection, accountUserMapping map[string]string) {
+	for _, account := range sortedKeys(delta) {
+		resources := delta[account]
+		mailData := resourceMailData{
+			Owner:     accountUserMapping[account],
+			OwnerID:   account,
+			Instances: resources.Instances,
+			Images:    resources.Images,
+			Snapshots: resources.Snapshots,
+			Volumes:   resources.Volumes,
+			Buckets:   resources.Buckets,
+		}
+
+		if mailData.ResourceCount() > 0 {
+			title := fmt.Sprintf("Upcoming cleanup policy (%d additional resources)", mailData.ResourceCount())
+			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, shadowPolicyTemplate, title)
+		}
+	}
+}
+
+type exposureMailData struct {
+	Owner           string
+	OwnerID         string
+	PublicInstances []cloud.Instance
+	OpenGroups      []security.OpenGroup
+	RevokedGroups   []security.OpenGroup
+	TemporaryTagKey string
+}
+
+// ExposureReview will send an email to the owner of every account with
+// instances or security groups exposed to the internet. Security groups
+// which had their open rules revoked are listed separately.
+func (c *Client) ExposureReview(exposures map[string]*security.Exposure, revoked []security.OpenGroup, temporaryTagKey string, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	for _, account := range sortedKeys(exposures) {
+		exposure := exposures[account]
+		mailData := exposureMailData{
+			Owner:           accountUserMapping[account],
+			OwnerID:         account,
+			PublicInstances: exposure.PublicInstances,
+			OpenGroups:      exposure.OpenGroups,
+			TemporaryTagKey: temporaryTagKey,
+		}
+		for _, open := range revoked {
+			if open.Group.Owner() == account {
+				mailData.RevokedGroups = append(mailData.RevokedGroups, open)
+			}
+		}
+		count := exposure.Count() + len(mailData.RevokedGroups)
+		if count == 0 {
+			continue
+		}
+		sortInstances(mailData.PublicInstances)
+		sortOpenGroups(mailData.OpenGroups)
+		sortOpenGroups(mailData.RevokedGroups)
+		mailContent, err := generateMail(mailData, exposureMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending exposure review to %s\n", recipientMail)
+		title := fmt.Sprintf("Internet Exposure Review (%d resources)", count)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+}
+
+type unencryptedMailData struct {
+	Owner     string
+	OwnerID   string
+	Volumes   []cloud.Volume
+	Snapshots []cloud.Snapshot
+	Copies    []security.EncryptedCopy
+}
+
+// UnencryptedReview will send an email to the owner of every account
+// with unencrypted volumes or snapshots. Encrypted copies made of them
+// are listed as well, so the owner can switch over to the copies.
+func (c *Client) UnencryptedReview(found map[string]*security.Unencrypted, copies []security.EncryptedCopy, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	for _, account := range sortedKeys(found) {
+		unencrypted := found[account]
+		if unencrypted.Count() == 0 {
+			continue
+		}
+		mailData := unencryptedMailData{
+			Owner:     accountUserMapping[account],
+			OwnerID:   account,
+			Volumes:   unencrypted.Volumes,
+			Snapshots: unencrypted.Snapshots,
+		}
+		for _, encryptedCopy := range copies {
+			if encryptedCopy.Source.Owner() == account {
+				mailData.Copies = append(mailData.Copies, encryptedCopy)
+			}
+		}
+		sortVolumes(mailData.Volumes)
+		sortSnapshots(mailData.Snapshots)
+		sort.Slice(mailData.Copies, func(i, j int) bool {
+			return mailData.Copies[i].Source.ID() < mailData.Copies[j].Source.ID()
+		})
+		mailContent, err := generateMail(mailData, unencryptedMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending unencrypted resources review to %s\n", recipientMail)
+		title := fmt.Sprintf("Unencrypted Resources Review (%d resources)", unencrypted.Count())
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+}
+
+type archiveMailData struct {
+	Owner           string
+	OwnerID         string
+	Days            int
+	Snapshots       []cloud.Snapshot
+	Archived        []cloud.Snapshot
+	SavingsPerMonth float64
+}
+
+// ArchiveReview will send an email to the owner of every account with
+// snapshots which are recommended to be moved to the archive tier,
+// together with the estimated savings. Snapshots which were archived
+// are listed separately.
+func (c *Client) ArchiveReview(found map[string]*cleanup.ArchiveCandidates, archived []cloud.Snapshot, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	for _, account := range sortedKeys(found) {
+		candidates := found[account]
+		if len(candidates.Snapshots) == 0 || c.unsubscribed(accountUserMapping[account], "archive") {
+			continue
+		}
+		mailData := archiveMailData{
+			Owner:           accountUserMapping[account],
+			OwnerID:         account,
+			Days:            days,
+			SavingsPerMonth: candidates.SavingsPerMonth(),
+		}
+		archivedIDs := make(map[string]bool)
+		for _, snap := range archived {
+			if snap.Owner() == account {
+				mailData.Archived = append(mailData.Archived, snap)
+				archivedIDs[snap.ID()] = true
+			}
+		}
+		for _, snap := range candidates.Snapshots {
+			if !archivedIDs[snap.ID()] {
+				mailData.Snapshots = append(mailData.Snapshots, snap)
+			}
+		}
+		sortSnapshots(mailData.Snapshots)
+		sortSnapshots(mailData.Archived)
+		mailContent, err := generateMail(mailData, archiveMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending snapshot archive review to %s\n", recipientMail)
+		title := fmt.Sprintf("Snapshot Archive Recommendations ($%.2f/month)", mailData.SavingsPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+}
+
+type multipartMailData struct {
+	Owner           string
+	OwnerID         string
+	Days            int
+	Buckets         []*cleanup.StaleUploads
+	SizeGB          float64
+	SavingsPerMonth float64
+}
+
+func newMultipartMailData(owner, ownerID string, days int, buckets []*cleanup.StaleUploads) multipartMailData {
+	sort.Slice(buckets, func(i, j int) bool {
+		a, b := buckets[i], buckets[j]
+		return lessByCost(a.Bucket.Owner(), b.Bucket.Owner(), a.SavingsPerMonth(), b.SavingsPerMonth(), a.Bucket.ID(), b.Bucket.ID())
+	})
+	mailData := multipartMailData{Owner: owner, OwnerID: ownerID, Days: days, Buckets: buckets}
+	for _, stale := range buckets {
+		mailData.SizeGB += stale.SizeGB()
+		mailData.SavingsPerMonth += stale.SavingsPerMonth()
+	}
+	return mailData
+}
+
+// MultipartUploadReview will send an email to the owner of every account
+// with buckets that have incomplete multipart uploads older than the
+// specified number of days, together with the storage they use and the
+// estimated savings of aborting them. Buckets whose uploads were aborted
+// are shown as such. The buckets of all accounts, with the total storage
+// reclaimed, are sent to the total sum addressee.
+func (c *Client) MultipartUploadReview(found map[string][]*cleanup.StaleUploads, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.StaleUploads{}
+	for _, account := range sortedKeys(found) {
+		buckets := found[account]
+		all = append(all, buckets...)
+		if c.unsubscribed(accountUserMapping[account], "multipart") {
+			continue
+		}
+		mailData := newMultipartMailData(accountUserMapping[account], account, days, buckets)
+		mailContent, err := generateMail(mailData, multipartMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending multipart upload review to %s\n", recipientMail)
+		title := fmt.Sprintf("Incomplete multipart uploads (%.2f GB, $%.2f/month)", mailData.SizeGB, mailData.SavingsPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No incomplete multipart uploads found")
+		return
+	}
+	if c.unsubscribed(c.config.TotalSumAddresse, "multipart") {
+		return
+	}
+	summary := newMultipartMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, multipartMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending multipart upload summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Incomplete multipart uploads summary (%.2f GB, $%.2f/month)", summary.SizeGB, summary.SavingsPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type spotMailData struct {
+	Owner                      string
+	OwnerID                    string
+	Days                       int
+	Instances                  []*cleanup.SpotCandidate
+	OnDemandPerMonth           float64
+	SpotSavingsPerMonth        float64
+	SavingsPlanSavingsPerMonth float64
+}
+
+func newSpotMailData(owner, ownerID string, days int, instances []*cleanup.SpotCandidate) spotMailData {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		return lessByCost(a.Instance.Owner(), b.Instance.Owner(), a.SpotSavingsPerMonth(), b.SpotSavingsPerMonth(), a.Instance.ID(), b.Instance.ID())
+	})
+	mailData := spotMailData{Owner: owner, OwnerID: ownerID, Days: days, Instances: instances}
+	for _, candidate := range instances {
+		mailData.OnDemandPerMonth += candidate.OnDemandPerMonth
+		mailData.SpotSavingsPerMonth += candidate.SpotSavingsPerMonth()
+		mailData.SavingsPlanSavingsPerMonth += candidate.SavingsPlanSavingsPerMonth()
+	}
+	return mailData
+}
+
+// SpotReview will send an email to the owner of every account with
+// on-demand instances which have been running for more than the
+// specified number of days, together with the estimated savings of
+// running them as spot instances or under a savings plan. The instances
+// of all accounts are sent to the total sum addressee.
+func (c *Client) SpotReview(found map[string][]*cleanup.SpotCandidate, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.SpotCandidate{}
+	for _, account := range sortedKeys(found) {
+		instances := found[account]
+		all = append(all, instances...)
+		if c.unsubscribed(accountUserMapping[account], "spot") {
+			continue
+		}
+		mailData := newSpotMailData(accountUserMapping[account], account, days, instances)
+		mailContent, err := generateMail(mailData, spotMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending spot review to %s\n", recipientMail)
+		title := fmt.Sprintf("Long-running on-demand instances ($%.2f/month with spot)", mailData.SpotSavingsPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No long-running on-demand instances found")
+		return
+	}
+	if c.unsubscribed(c.config.TotalSumAddresse, "spot") {
+		return
+	}
+	summary := newSpotMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, spotMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending spot summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Long-running on-demand instances summary ($%.2f/month with spot)", summary.SpotSavingsPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type imageCopyMailData struct {
+	Owner           string
+	OwnerID         string
+	Days            int
+	Groups          []*cleanup.ImageCopyGroup
+	SizeGB          int64
+	SavingsPerMonth float64
+}
+
+func newImageCopyMailData(owner, ownerID string, days int, groups []*cleanup.ImageCopyGroup) imageCopyMailData {
+	mailData := imageCopyMailData{Owner: owner, OwnerID: ownerID, Days: days, Groups: groups}
+	for _, group := range groups {
+		mailData.SizeGB += group.SizeGB()
+		mailData.SavingsPerMonth += group.SavingsPerMonth()
+	}
+	return mailData
+}
+
+// ImageCopyReview will send an email to the owner of every account with
+// unused copies of images in other locations, together with the snapshot
+// storage they use and the estimated savings of removing them. Copies
+// which were removed are shown as such. The copies of all accounts are
+// sent to the total sum addressee.
+func (c *Client) ImageCopyReview(found map[string][]*cleanup.ImageCopyGroup, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.ImageCopyGroup{}
+	owners := make(map[*cleanup.ImageCopyGroup]string)
+	for _, account := range sortedKeys(found) {
+		groups := found[account]
+		all = append(all, groups...)
+		for _, group := range groups {
+			owners[group] = account
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			a, b := groups[i], groups[j]
+			return lessByCost(account, account, a.SavingsPerMonth(), b.SavingsPerMonth(), a.SourceID, b.SourceID)
+		})
+		mailData := newImageCopyMailData(accountUserMapping[account], account, days, groups)
+		mailContent, err := generateMail(mailData, imageCopyMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending image copy review to %s\n", recipientMail)
+		title := fmt.Sprintf("Unused image copies (%d GB, $%.2f/month)", mailData.SizeGB, mailData.SavingsPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No unused image copies found")
+		return
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		return lessByCost(owners[a], owners[b], a.SavingsPerMonth(), b.SavingsPerMonth(), a.SourceID, b.SourceID)
+	})
+	summary := newImageCopyMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, imageCopyMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending image copy summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Unused image copies summary (%d GB, $%.2f/month)", summary.SizeGB, summary.SavingsPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type fileSystemMailData struct {
+	Owner        string
+	OwnerID      string
+	Days         int
+	FileSystems  []*cleanup.IdleFileSystem
+	CostPerMonth float64
+}
+
+func newFileSystemMailData(owner, ownerID string, days int, fileSystems []*cleanup.IdleFileSystem) fileSystemMailData {
+	sort.Slice(fileSystems, func(i, j int) bool {
+		return lessResourceByCost(fileSystems[i].FileSystem, fileSystems[j].FileSystem, fileSystemCost)
+	})
+	mailData := fileSystemMailData{Owner: owner, OwnerID: ownerID, Days: days, FileSystems: fileSystems}
+	for _, idle := range fileSystems {
+		mailData.CostPerMonth += billing.FileSystemCostPerMonth(idle.FileSystem)
+	}
+	return mailData
+}
+
+// FileSystemReview will send an email to the owner of every account with
+// file systems that have no mount targets, or had no IO in the specified
+// number of days, together with what they cost. File systems which were
+// deleted, or are marked for deletion, are shown as such. The file
+// systems of all accounts are sent to the total sum addressee.
+func (c *Client) FileSystemReview(found map[string][]*cleanup.IdleFileSystem, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.IdleFileSystem{}
+	for _, account := range sortedKeys(found) {
+		fileSystems := found[account]
+		all = append(all, fileSystems...)
+		mailData := newFileSystemMailData(accountUserMapping[account], account, days, fileSystems)
+		mailContent, err := generateMail(mailData, fileSystemMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending file system review to %s\n", recipientMail)
+		title := fmt.Sprintf("Unused file systems ($%.2f/month)", mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No unused file systems found")
+		return
+	}
+	summary := newFileSystemMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, fileSystemMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending file system summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Unused file systems summary ($%.2f/month)", summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type vpnMailData struct {
+	Owner        string
+	OwnerID      string
+	Days         int
+	VPNs         []*cleanup.IdleVPN
+	CostPerMonth float64
+}
+
+func newVPNMailData(owner, ownerID string, days int, vpns []*cleanup.IdleVPN) vpnMailData {
+	sort.Slice(vpns, func(i, j int) bool {
+		return lessResourceByCost(vpns[i].VPN, vpns[j].VPN, vpnCost)
+	})
+	mailData := vpnMailData{Owner: owner, OwnerID: ownerID, Days: days, VPNs: vpns}
+	for _, idle := range vpns {
+		mailData.CostPerMonth += billing.VPNCostPerMonth(idle.VPN)
+	}
+	return mailData
+}
+
+// VPNReview will send an email to the owner of every account with Client
+// VPN endpoints and VPN connections which had no connections or traffic
+// in the specified number of days, together with what they cost. VPNs
+// which were deleted, or are marked for deletion, are shown as such. The
+// VPNs of all accounts are sent to the total sum addressee.
+func (c *Client) VPNReview(found map[string][]*cleanup.IdleVPN, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.IdleVPN{}
+	for _, account := range sortedKeys(found) {
+		vpns := found[account]
+		all = append(all, vpns...)
+		mailData := newVPNMailData(accountUserMapping[account], account, days, vpns)
+		mailContent, err := generateMail(mailData, vpnMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending VPN review to %s\n", recipientMail)
+		title := fmt.Sprintf("Idle VPNs ($%.2f/month)", mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No idle VPNs found")
+		return
+	}
+	summary := newVPNMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, vpnMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending VPN summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Idle VPNs summary ($%.2f/month)", summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type dataClusterMailData struct {
+	Owner        string
+	OwnerID      string
+	Hours        int
+	Clusters     []*cleanup.IdleDataCluster
+	CostPerMonth float64
+}
+
+func newDataClusterMailData(owner, ownerID string, hours int, clusters []*cleanup.IdleDataCluster) dataClusterMailData {
+	sort.Slice(clusters, func(i, j int) bool {
+		return lessResourceByCost(clusters[i].Cluster, clusters[j].Cluster, dataClusterCost)
+	})
+	mailData := dataClusterMailData{Owner: owner, OwnerID: ownerID, Hours: hours, Clusters: clusters}
+	for _, idle := range clusters {
+		mailData.CostPerMonth += billing.DataClusterCostPerMonth(idle.Cluster)
+	}
+	return mailData
+}
+
+// DataClusterReview will send an email to the owner of every account with
+// data processing clusters, such as EMR clusters, which didn't run any
+// work in the specified number of hours, together with what they cost.
+// Clusters which were terminated, or are marked for termination, are
+// shown as such. The clusters of all accounts are sent to the total sum
+// addressee.
+func (c *Client) DataClusterReview(found map[string][]*cleanup.IdleDataCluster, hours int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.IdleDataCluster{}
+	for _, account := range sortedKeys(found) {
+		clusters := found[account]
+		all = append(all, clusters...)
+		mailData := newDataClusterMailData(accountUserMapping[account], account, hours, clusters)
+		mailContent, err := generateMail(mailData, dataClusterMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending cluster review to %s\n", recipientMail)
+		title := fmt.Sprintf("Idle clusters ($%.2f/month)", mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No idle clusters found")
+		return
+	}
+	summary := newDataClusterMailData(c.config.TotalSumAddresse, "", hours, all)
+	mailContent, err := generateMail(summary, dataClusterMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending cluster summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Idle clusters summary ($%.2f/month)", summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type gpuMailData struct {
+	Owner     string
+	Hours     int
+	Percent   int
+	Instances []*cleanup.IdleGPUInstance
+	// Marking is true if idle instances are marked for deletion, and
+	// false if the owners are only notified
+	Marking    bool
+	CostPerDay float64
+}
+
+func newGPUMailData(owner string, hours, percent int, marking bool, instances []*cleanup.IdleGPUInstance) gpuMailData {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		return lessByCost(a.Instance.Owner(), b.Instance.Owner(), a.CostPerDay(), b.CostPerDay(), a.Instance.ID(), b.Instance.ID())
+	})
+	mailData := gpuMailData{Owner: owner, Hours: hours, Percent: percent, Marking: marking, Instances: instances}
+	for _, idle := range instances {
+		mailData.CostPerDay += idle.CostPerDay()
+	}
+	return mailData
+}
+
+// GPUReview will send an email to the owner of every account with GPU
+// instances which have been idle for more than the specified number of
+// hours. GPU instances cost more per idle night than most other waste,
+// so the email is flagged as needing action. The instances of all
+// accounts are sent to the total sum addressee.
+func (c *Client) GPUReview(found map[string][]*cleanup.IdleGPUInstance, hours, percent int, marking bool, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.IdleGPUInstance{}
+	for _, account := range sortedKeys(found) {
+		instances := found[account]
+		all = append(all, instances...)
+		mailData := newGPUMailData(accountUserMapping[account], hours, percent, marking, instances)
+		mailContent, err := generateMail(mailData, gpuMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending GPU review to %s\n", recipientMail)
+		title := fmt.Sprintf("Action needed: idle GPU instances ($%.2f/day)", mailData.CostPerDay)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No idle GPU instances found")
+		return
+	}
+	summary := newGPUMailData(c.config.TotalSumAddresse, hours, percent, marking, all)
+	mailContent, err := generateMail(summary, gpuMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending GPU summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Action needed: idle GPU instances summary ($%.2f/day)", summary.CostPerDay)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type mlMailData struct {
+	Owner        string
+	Days         int
+	Resources    []*cleanup.IdleMLResource
+	CostPerMonth float64
+}
+
+func newMLMailData(owner string, days int, resources []*cleanup.IdleMLResource) mlMailData {
+	sort.Slice(resources, func(i, j int) bool {
+		return lessResourceByCost(resources[i].Resource, resources[j].Resource, mlCost)
+	})
+	mailData := mlMailData{Owner: owner, Days: days, Resources: resources}
+	for _, idle := range resources {
+		mailData.CostPerMonth += billing.MLResourceCostPerMonth(idle.Resource)
+	}
+	return mailData
+}
+
+// mlResourceUser returns the username of the active employee a machine
+// learning resource belongs to, which is the value of its owner tag, or
+// else the ML studio user it belongs to. An empty string is returned if
+// neither is an active employee.
+func mlResourceUser(res cloud.MLResource, ownerTagKey string, employees map[string]*cs.Employee) string {
+	tagged, _ := cloud.Tags(res.Tags()).Get(ownerTagKey)
+	for _, username := range []string{tagged, res.UserName()} {
+		if employee, exist := employees[username]; exist && !employee.Disabled {
+			return username
+		}
+	}
+	return ""
+}
+
+// MLReview will send an email about the running machine learning
+// resources, such as SageMaker notebook instances, endpoints and Studio
+// apps, which weren't used in the specified number of days, together with
+// what they cost. Every resource is sent to the active employee it's
+// tagged with in the owner tag, or else to the ML studio user it belongs
+// to, and otherwise to the owner of its account. Resources which were
+// stopped or deleted, or are marked for deletion, are shown as such. The
+// resources of all accounts are sent to the total sum addressee.
+func (c *Client) MLReview(found map[string][]*cleanup.IdleMLResource, days int, ownerTagKey string, employees map[string]*cs.Employee, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.IdleMLResource{}
+	perRecipient := make(map[string][]*cleanup.IdleMLResource)
+	for _, account := range sortedKeys(found) {
+		for _, idle := range found[account] {
+			all = append(all, idle)
+			recipient := mlResourceUser(idle.Resource, ownerTagKey, employees)
+			if recipient == "" {
+				recipient = accountUserMapping[account]
+			}
+			perRecipient[recipient] = append(perRecipient[recipient], idle)
+		}
+	}
+	for _, recipient := range sortedKeys(perRecipient) {
+		mailData := newMLMailData(recipient, days, perRecipient[recipient])
+		mailContent, err := generateMail(mailData, mlMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending machine learning review to %s\n", recipientMail)
+		title := fmt.Sprintf("Idle machine learning resources ($%.2f/month)", mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No idle machine learning resources found")
+		return
+	}
+	summary := newMLMailData(c.config.TotalSumAddresse, days, all)
+	mailContent, err := generateMail(summary, mlMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending machine learning summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Idle machine learning resources summary ($%.2f/month)", summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type transitGatewayMailData struct {
+	Owner    string
+	Gateways []*cleanup.UnusedTransitGateway
+}
+
+func newTransitGatewayMailData(owner string, gateways []*cleanup.UnusedTransitGateway) transitGatewayMailData {
+	sort.Slice(gateways, func(i, j int) bool {
+		a, b := gateways[i].Gateway, gateways[j].Gateway
+		if a.Owner() != b.Owner() {
+			return a.Owner() < b.Owner()
+		}
+		return a.ID() < b.ID()
+	})
+	return transitGatewayMailData{Owner: owner, Gateways: gateways}
+}
+
+// TransitGatewayReview will send an email to the network owners of every
+// account with transit gateways which have attachments to deleted or
+// empty networks, or blackhole routes. Accounts without network owners
+// are emailed to their owner instead. Attachments and routes which were
+// deleted are shown as such. The transit gateways of all accounts are
+// sent to the total sum addressee.
+func (c *Client) TransitGatewayReview(found map[string][]*cleanup.UnusedTransitGateway, networkOwners func(account string) []string, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.UnusedTransitGateway{}
+	perRecipient := make(map[string][]*cleanup.UnusedTransitGateway)
+	for _, account := range sortedKeys(found) {
+		all = append(all, found[account]...)
+		recipients := networkOwners(account)
+		if len(recipients) == 0 {
+			recipients = []string{accountUserMapping[account]}
+		}
+		for _, recipient := range recipients {
+			perRecipient[recipient] = append(perRecipient[recipient], found[account]...)
+		}
+	}
+	for _, recipient := range sortedKeys(perRecipient) {
+		mailData := newTransitGatewayMailData(recipient, perRecipient[recipient])
+		mailContent, err := generateMail(mailData, transitGatewayMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending transit gateway review to %s\n", recipientMail)
+		if err := mailClient.SendEmail("Unused transit gateway attachments and routes", mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No unused transit gateway attachments or routes found")
+		return
+	}
+	summary := newTransitGatewayMailData(c.config.TotalSumAddresse, all)
+	mailContent, err := generateMail(summary, transitGatewayMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending transit gateway summary to %s\n", recipientMail)
+	if err := mailClient.SendEmail("Unused transit gateway attachments and routes summary", mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type monitoringMailData struct {
+	Owner        string
+	OwnerID      string
+	Days         int
+	Alarms       []*cleanup.DeadAlarm
+	Dashboards   []*cleanup.UnviewedDashboard
+	CostPerMonth float64
+}
+
+func newMonitoringMailData(owner, ownerID string, days int, dead *cleanup.DeadMonitoring) monitoringMailData {
+	sort.Slice(dead.Alarms, func(i, j int) bool {
+		a, b := dead.Alarms[i].Alarm, dead.Alarms[j].Alarm
+		return lessByCost(a.Owner(), b.Owner(), billing.AlarmCostPerMonth(a), billing.AlarmCostPerMonth(b), a.ID(), b.ID())
+	})
+	sort.Slice(dead.Dashboards, func(i, j int) bool {
+		a, b := dead.Dashboards[i].Dashboard, dead.Dashboards[j].Dashboard
+		return lessByCost(a.Owner(), b.Owner(), billing.DashboardCostPerMonth(a), billing.DashboardCostPerMonth(b), a.ID(), b.ID())
+	})
+	return monitoringMailData{
+		Owner:        owner,
+		OwnerID:      ownerID,
+		Days:         days,
+		Alarms:       dead.Alarms,
+		Dashboards:   dead.Dashboards,
+		CostPerMonth: dead.CostPerMonth(),
+	}
+}
+
+// MonitoringReview will send an email to the owner of every account with
+// alarms on resources which no longer exist, and dashboards which weren't
+// viewed in the specified number of days, together with what they cost.
+// Alarms and dashboards which were deleted are shown as such. The alarms
+// and dashboards of all accounts are sent to the total sum addressee.
+func (c *Client) MonitoringReview(found map[string]*cleanup.DeadMonitoring, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := &cleanup.DeadMonitoring{}
+	for _, account := range sortedKeys(found) {
+		dead := found[account]
+		all.Alarms = append(all.Alarms, dead.Alarms...)
+		all.Dashboards = append(all.Dashboards, dead.Dashboards...)
+		mailData := newMonitoringMailData(accountUserMapping[account], account, days, dead)
+		mailContent, err := generateMail(mailData, monitoringMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending monitoring review to %s\n", recipientMail)
+		title := fmt.Sprintf("Dead alarms and unused dashboards ($%.2f/month)", mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all.Alarms) == 0 && len(all.Dashboards) == 0 {
+		log.Println("No dead alarms or unused dashboards found")
+		return
+	}
+	summary := newMonitoringMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, monitoringMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending monitoring summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Dead alarms and unused dashboards summary ($%.2f/month)", summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type networkMailData struct {
+	Owner    string
+	OwnerID  string
+	Days     int
+	Networks []*cleanup.EmptyNetwork
+	// Deleted is the number of networks which were deleted
+	Deleted int
+}
+
+func newNetworkMailData(owner, ownerID string, days int, networks []*cleanup.EmptyNetwork) networkMailData {
+	sort.Slice(networks, func(i, j int) bool {
+		a, b := networks[i].Network, networks[j].Network
+		if a.Owner() != b.Owner() {
+			return a.Owner() < b.Owner()
+		}
+		if a.Location() != b.Location() {
+			return a.Location() < b.Location()
+		}
+		return a.ID() < b.ID()
+	})
+	deleted := 0
+	for _, empty := range networks {
+		if empty.Deleted {
+			deleted++
+		}
+	}
+	return networkMailData{
+		Owner:    owner,
+		OwnerID:  ownerID,
+		Days:     days,
+		Networks: networks,
+		Deleted:  deleted,
+	}
+}
+
+// NetworkReview will send an email to the owner of every account with
+// empty networks, listing the subnets, route tables and other network
+// objects in them. Networks which were deleted are shown as such, with
+// the objects deleted with them. The networks of all accounts are sent
+// to the total sum addressee.
+func (c *Client) NetworkReview(found map[string][]*cleanup.EmptyNetwork, days int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.EmptyNetwork{}
+	for _, account := range sortedKeys(found) {
+		networks := found[account]
+		all = append(all, networks...)
+		mailData := newNetworkMailData(accountUserMapping[account], account, days, networks)
+		mailContent, err := generateMail(mailData, networkMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending network review to %s\n", recipientMail)
+		title := fmt.Sprintf("Empty networks (%d deleted)", mailData.Deleted)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No empty networks found")
+		return
+	}
+	summary := newNetworkMailData(c.config.TotalSumAddresse, "", days, all)
+	mailContent, err := generateMail(summary, networkMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending network summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Empty networks summary (%d deleted)", summary.Deleted)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type cleanupMailData struct {
+	Owner      string
+	OwnerID    string
+	Terminated []*cleanup.TerminatedInstance
+	// Allocated is the number of Elastic IPs which are still allocated,
+	// and CostPerMonth what they cost
+	Allocated    int
+	CostPerMonth float64
+}
+
+func newCleanupMailData(owner, ownerID string, terminated []*cleanup.TerminatedInstance) cleanupMailData {
+	sort.Slice(terminated, func(i, j int) bool {
+		a, b := terminated[i].Instance, terminated[j].Instance
+		if a.Owner() != b.Owner() {
+			return a.Owner() < b.Owner()
+		}
+		return a.ID() < b.ID()
+	})
+	allocated := 0
+	for _, instance := range terminated {
+		for _, address := range instance.Debris.ElasticIPs {
+			if !address.Released {
+				allocated++
+			}
+		}
+	}
+	return cleanupMailData{
+		Owner:        owner,
+		OwnerID:      ownerID,
+		Terminated:   terminated,
+		Allocated:    allocated,
+		CostPerMonth: float64(allocated) * billing.ElasticIPCostPerMonth(),
+	}
+}
+
+// CleanupReport will send an email to the owner of every account where
+// cleanup terminated instances which left Elastic IPs or alarms behind,
+// with whether the alarms were deleted and the Elastic IPs released. The
+// instances of all accounts are sent to the total sum addressee.
+func (c *Client) CleanupReport(terminated map[string][]*cleanup.TerminatedInstance, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.TerminatedInstance{}
+	for _, account := range sortedKeys(terminated) {
+		instances := terminated[account]
+		all = append(all, instances...)
+		mailData := newCleanupMailData(accountUserMapping[account], account, instances)
+		mailContent, err := generateMail(mailData, cleanupMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending cleanup report to %s\n", recipientMail)
+		title := fmt.Sprintf("Terminated instances left behind %d Elastic IPs ($%.2f/month)", mailData.Allocated, mailData.CostPerMonth)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No terminated instances left anything behind")
+		return
+	}
+	summary := newCleanupMailData(c.config.TotalSumAddresse, "", all)
+	mailContent, err := generateMail(summary, cleanupMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending cleanup summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Cleanup summary: terminated instances left behind %d Elastic IPs ($%.2f/month)", summary.Allocated, summary.CostPerMonth)
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type chargebackMailData struct {
+	Owner     string
+	Statement *chargeback.Statement
+}
+
+// chargebackRecipient returns the username of the lead of the team of a
+// statement, or the total sum addressee if the team has no lead
+func (c *Client) chargebackRecipient(statement *chargeback.Statement) string {
+	if statement.Lead != nil {
+		return statement.Lead.Username
+	}
+	return c.config.TotalSumAddresse
+}
+
+// ChargebackHTML returns the chargeback statement of a team as the HTML
+// of the email sent to its recipient, which is also the HTML version of
+// the statement that is archived
+func (c *Client) ChargebackHTML(statement *chargeback.Statement) (string, error) {
+	return generateMail(chargebackMailData{c.chargebackRecipient(statement), statement}, chargebackTemplate)
+}
+
+// ChargebackStatement will send the chargeback statement of a team, with
+// its PDF version attached, to the lead of the team. Statements of teams
+// without a lead, and of the accounts without a team, are sent to the
+// total sum addressee.
+func (c *Client) ChargebackStatement(statement *chargeback.Statement, html string, pdf []byte) {
+	mailClient := getMailClient(c)
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", c.chargebackRecipient(statement), c.config.EmailDomain))
+	log.Printf("Sending the chargeback statement of %s to %s\n", statement.TeamName(), recipientMail)
+	title := fmt.Sprintf("%s chargeback statement of %s for %s", statement.Report.CSP, statement.TeamName(), statement.MonthName())
+	attachment := mailer.Attachment{
+		Filename:    statement.FileName("pdf"),
+		ContentType: "application/pdf",
+		Content:     pdf,
+	}
+	if err := mailClient.SendEmailWithAttachments(title, html, []mailer.Attachment{attachment}, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type quotaMailData struct {
+	Owner   string
+	OwnerID string
+	Percent int
+	Quotas  []cloud.QuotaUsage
+}
+
+// QuotaReview will send an email to the owner of every account using at
+// least the specified percent of a service quota, such as the number of
+// snapshots in a region, so that resources counting towards the quota
+// can be cleaned up before it's reached. The quotas of all accounts are
+// sent to the total sum addressee, with the most used first.
+func (c *Client) QuotaReview(found map[string][]cloud.QuotaUsage, percent int, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []cloud.QuotaUsage{}
+	for _, account := range sortedKeys(found) {
+		quotas := found[account]
+		all = append(all, quotas...)
+		if c.unsubscribed(accountUserMapping[account], "quota") {
+			continue
+		}
+		mailData := quotaMailData{accountUserMapping[account], account, percent, quotas}
+		mailContent, err := generateMail(mailData, quotaMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending quota review to %s\n", recipientMail)
+		title := fmt.Sprintf("Service quotas nearly reached (%d)", len(quotas))
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No service quotas nearly reached")
+		return
+	}
+	if c.unsubscribed(c.config.TotalSumAddresse, "quota") {
+		return
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Percent() > all[j].Percent()
+	})
+	summary := quotaMailData{c.config.TotalSumAddresse, "", percent, all}
+	mailContent, err := generateMail(summary, quotaMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending quota summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Service quotas nearly reached summary (%d)", len(all))
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type lifecycleMailData struct {
+	Owner       string
+	OwnerID     string
+	Comparisons []*cleanup.RetentionComparison
+}
+
+// LifecycleReview will send an email to the owner of every account with
+// lifecycle policies, comparing how long they retain snapshots with when
+// Cloudsweeper marks snapshots, so that conflicting retention can be
+// fixed. The comparisons of all accounts are sent to the total sum
+// addressee.
+func (c *Client) LifecycleReview(found map[string][]*cleanup.RetentionComparison, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	all := []*cleanup.RetentionComparison{}
+	for _, account := range sortedKeys(found) {
+		comparisons := found[account]
+		all = append(all, comparisons...)
+		if c.unsubscribed(accountUserMapping[account], "lifecycle") {
+			continue
+		}
+		mailData := lifecycleMailData{accountUserMapping[account], account, comparisons}
+		mailContent, err := generateMail(mailData, lifecycleMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending lifecycle policy review to %s\n", recipientMail)
+		title := fmt.Sprintf("Snapshot lifecycle policies compared with Cloudsweeper (%d)", len(comparisons))
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(all) == 0 {
+		log.Println("No lifecycle policies found")
+		return
+	}
+	if c.unsubscribed(c.config.TotalSumAddresse, "lifecycle") {
+		return
+	}
+	summary := lifecycleMailData{c.config.TotalSumAddresse, "", all}
+	mailContent, err := generateMail(summary, lifecycleMailTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending lifecycle policy summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Snapshot lifecycle policies summary (%d)", len(all))
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type departedOwnersMailData struct {
+	Owner    string
+	Departed []*cleanup.Orphaned
+}
+
+// DepartedOwnersReview will send an email to the manager of every
+// departed employee who still owns unclaimed resources, listing the
+// resources and when they will be marked for cleanup unless claimed.
+// Resources of departed employees without an active manager are sent to
+// the total sum addressee.
+func (c *Client) DepartedOwnersReview(orphaned []*cleanup.Orphaned) {
+	perRecipient := make(map[string]*departedOwnersMailData)
+	for _, owner := range orphaned {
+		recipient := c.config.TotalSumAddresse
+		if owner.Employee.Manager != nil && !owner.Employee.Manager.Disabled {
+			recipient = owner.Employee.Manager.Username
+		}
+		if _, exist := perRecipient[recipient]; !exist {
+			perRecipient[recipient] = &departedOwnersMailData{Owner: recipient}
+		}
+		perRecipient[recipient].Departed = append(perRecipient[recipient].Departed, owner)
+	}
+
+	mailClient := getMailClient(c)
+	for _, mailData := range perRecipient {
+		count := 0
+		for _, owner := range mailData.Departed {
+			count += len(owner.Resources)
+		}
+		mailContent, err := generateMail(mailData, departedOwnersTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending departed owners review to %s\n", recipientMail)
+		title := fmt.Sprintf("Resources owned by people who have left (%d resources)", count)
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+}
+
+type bucketGrowthMailData struct {
+	Owner     string
+	OwnerID   string
+	Threshold float64
+	Runaways  []*growth.Trend
+	Trends    []*growth.Trend
+}
+
+// BucketGrowthReview will send an email to the owner of every account
+// with buckets which grew by more than the threshold percent in the last
+// month, listing the growth of every bucket in the account. The runaway
+// buckets of all accounts are sent to the total sum addressee.
+func (c *Client) BucketGrowthReview(trends map[string][]*growth.Trend, threshold float64, accountUserMapping map[string]string) {
+	mailClient := getMailClient(c)
+	summary := bucketGrowthMailData{Owner: c.config.TotalSumAddresse, Threshold: threshold}
+	for _, account := range sortedKeys(trends) {
+		accountTrends := trends[account]
+		runaways := growth.Runaways(accountTrends)
+		if len(runaways) == 0 {
+			continue
+		}
+		summary.Runaways = append(summary.Runaways, runaways...)
+		if c.unsubscribed(accountUserMapping[account], "bucket-growth") {
+			continue
+		}
+		mailData := bucketGrowthMailData{
+			Owner:     accountUserMapping[account],
+			OwnerID:   account,
+			Threshold: threshold,
+			Runaways:  runaways,
+			Trends:    accountTrends,
+		}
+		mailContent, err := generateMail(mailData, bucketGrowthTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+		log.Printf("Sending bucket growth review to %s\n", recipientMail)
+		title := fmt.Sprintf("Fast growing buckets in %s (%d buckets)", cloud.AccountDisplayName(account), len(runaways))
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+		}
+	}
+
+	if len(summary.Runaways) == 0 {
+		log.Println("No buckets grew by more than the threshold")
+		return
+	}
+	if c.unsubscribed(c.config.TotalSumAddresse, "bucket-growth") {
+		return
+	}
+	sort.Slice(summary.Runaways, func(i, j int) bool {
+		a, b := summary.Runaways[i], summary.Runaways[j]
+		return lessByCost(a.Owner, b.Owner, a.SizeGrowth, b.SizeGrowth, a.ID, b.ID)
+	})
+	mailContent, err := generateMail(summary, bucketGrowthTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", summary.Owner, c.config.EmailDomain))
+	log.Printf("Sending bucket growth summary to %s\n", recipientMail)
+	title := fmt.Sprintf("Fast growing buckets (%d buckets)", len(summary.Runaways))
+	if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type remarkMailData struct {
+	Owner string
+	Limit int
+	Marks []*remarks.Mark
+}
+
+// RemarkReview will send an email to the total sum addressee listing the
+// resources which have been marked for cleanup again at least limit times,
+// since their delete tag keeps being removed instead of them being
+// whitelisted
+func (c *Client) RemarkReview(escalated []*remarks.Mark, limit int) {
+	if len(escalated) == 0 {
+		log.Println("No resources have been marked again too many times")
+		return
+	}
+	mailData := remarkMailData{Owner: c.config.TotalSumAddresse, Limit: limit, Marks: escalated}
+	mailContent, err := generateMail(mailData, remarkTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", mailData.Owner, c.config.EmailDomain))
+	log.Printf("Sending remark review to %s\n", recipientMail)
+	title := fmt.Sprintf("Resources whose delete tag keeps being removed (%d resources)", len(escalated))
+	if err := getMailClient(c).SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type missingTagsMailData struct {
+	Owner    string
+	Creation *events.Creation
+	Missing  []string
+}
+
+// MissingTagsWarning will send an email to the creator of resources
+// which were created without some of the required tags, right after
+// they were created, so the tags can be added while it's fresh in mind
+func (c *Client) MissingTagsWarning(recipient string, creation *events.Creation, missing []string) {
+	if c.unsubscribed(recipient, "missing-tags") {
+		return
+	}
+	mailData := missingTagsMailData{recipient, creation, missing}
+	mailContent, err := generateMail(mailData, missingTagsTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", recipient, c.config.EmailDomain))
+	log.Printf("Sending missing tags warning about %s to %s\n", strings.Join(creation.IDs, ", "), recipientMail)
+	title := fmt.Sprintf("Your new %s is missing required tags (%s)", creation.ResourceType, strings.Join(missing, ", "))
+	if err := getMailClient(c).SendEmail(title, mailContent, recipientMail); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+	}
+}
+
+type replyResultsMailData struct {
+	Owner   string
+	Results []replies.Result
+}
+
+// ReplyResults will send an email to the sender of a reply with the
+// outcome of every command in it
+func (c *Client) ReplyResults(sender *cs.Employee, address string, results []replies.Result) {
+	mailContent, err := generateMail(replyResultsMailData{sender.Username, results}, replyResultsTemplate)
+	if err != nil {
+		status.ActionFailedf("Could not generate email: %s\n", err)
+		return
+	}
+	log.Printf("Sending the results of %d commands to %s\n", len(results), address)
+	title := fmt.Sprintf("Your Cloudsweeper commands (%d)", len(results))
+	if err := getMailClient(c).SendEmail(title, mailContent, address); err != nil {
+		status.ActionFailedf("Failed to email %s: %s\n", address, err)
+	}
+}
+
+// unsubscribed returns true if the owner unsubscribed from the
+// informational report, in which case it isn't sent to them
+func (c *Client) unsubscribed(owner, report string) bool {
+	if c.config.Unsubscribes == nil || !c.config.Unsubscribes.IsUnsubscribed(owner, report) {
+		return false
+	}
+	log.Printf("%s unsubscribed from %s emails, not sending them\n", owner, report)
+	return true
+}
+
+// suppressedByCost returns true if the resources of an email cost less per
+// month than the threshold of its owner, in which case they are added to
+// the digest instead of being sent
+func (c *Client) suppressedByCost(mailData *resourceMailData, report string) bool {
+	threshold := c.config.CostThreshold
+	if ownerThreshold, exist := c.config.OwnerCostThresholds[mailData.Owner]; exist {
+		threshold = ownerThreshold
+	}
+	if threshold <= 0 || c.config.Digest == nil {
+		return false
+	}
+	resources := mailData.resources()
+	total := 0.0
+	for _, res := range resources {
+		total += costPerMonth(res)
+	}
+	if total >= threshold {
+		return false
+	}
+	log.Printf("%d resources of %s in %s cost $%.2f per month, less than $%.2f, adding them to the digest instead of sending %s email\n",
+		len(resources), mailData.Owner, cloud.AccountDisplayName(mailData.OwnerID), total, threshold, report)
+	now := time.Now()
+	for _, res := range resources {
+		c.config.Digest.Suppressed(digest.Item{
+			Owner:        mailData.Owner,
+			Account:      res.Owner(),
+			ResourceID:   res.ID(),
+			Kind:         resourceKind(res),
+			Location:     res.Location(),
+			CostPerMonth: costPerMonth(res),
+			Report:       report,
+		}, now)
+	}
+	return true
+}
+
+type digestMailData struct {
+	Owner        string
+	Items        []*digest.Item
+	CostPerMonth float64
+}
+
+// MonthlyDigest will send every owner with resources in the digest an
+// email listing them, and then remove them from the digest. These are
+// the resources left out of review emails since they cost too little.
+// Owners who unsubscribed from the digest are only removed.
+func (c *Client) MonthlyDigest() {
+	if c.config.Digest == nil {
+		log.Println("No digest to send")
+		return
+	}
+	mailClient := getMailClient(c)
+	for _, owner := range c.config.Digest.Owners() {
+		mailData := digestMailData{Owner: owner, Items: c.config.Digest.ItemsOf(owner)}
+		for _, item := range mailData.Items {
+			mailData.CostPerMonth += item.CostPerMonth
+		}
+		if c.unsubscribed(owner, "digest") {
+			c.config.Digest.Clear(owner)
+			continue
+		}
+		mailContent, err := generateMail(mailData, digestMailTemplate)
+		if err != nil {
+			status.ActionFailedf("Could not generate email: %s\n", err)
+			continue
+		}
+		recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", owner, c.config.EmailDomain))
+		log.Printf("Sending the digest of %d resources to %s\n", len(mailData.Items), recipientMail)
+		title := fmt.Sprintf("Monthly digest of resources to review (%d resources)", len(mailData.Items))
+		if err := mailClient.SendEmail(title, mailContent, recipientMail); err != nil {
+			status.ActionFailedf("Failed to email %s: %s\n", recipientMail, err)
+			continue
+		}
+		c.config.Digest.Clear(owner)
+	}
+}
@@ -11,7 +11,7 @@ Please review, and either tag or delete them.
 </p>
 
 <p>If you want to delete a resource, either remove its
-<b>cloudsweeper-whitelisted</b> tag or delete it manually.</p>
+<b>{{ tagkey "whitelist" }}</b> tag or delete it manually.</p>
 
 <p>
 Conversely, if you want to keep a resource around for a longer time, then
@@ -19,9 +19,9 @@ add any of the following tags:
 </p>
 
 <ol>
-	<li><b>cloudsweeper-whitelisted</b>: (Resource stays around indefinitely.)</li>
-	<li><b>cloudsweeper-expiry</b>: <i>YYYY-MM-DD</i> (Deletion occurs after the specified date.)</li>
-	<li><b>cloudsweeper-lifetime</b>: days-<i>N</i> (Deletion occurs <i>N</i> days after resource was created.)</li>
+	<li><b>{{ tagkey "whitelist" }}</b>: (Resource stays around indefinitely.)</li>
+	<li><b>{{ tagkey "expiry" }}</b>: <i>YYYY-MM-DD</i> (Deletion occurs after the specified date.)</li>
+	<li><b>{{ tagkey "lifetime" }}</b>: days-<i>N</i> (Deletion occurs <i>N</i> days after resource was created.)</li>
 </ol>
 
 <p>
@@ -29,10 +29,12 @@ Read more about how Cloudsweeper works and how to better tag your resources
 <a href="https://agaridata.atlassian.net/wiki/spaces/EN/pages/808189987/Cloudsweeper">here</a>.
 </p>
 
+{{ if gt .ResourceCount 0 }}
 <h2>Old resources:</h2>
 <p>
 Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
 </p>
+{{ end }}
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
 	<table style="width: 100%;">
@@ -40,6 +42,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
@@ -49,12 +53,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ accountname $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
+			<td>{{ costcenter $instance }}</td>
+			<td>{{ project $instance }}</td>
+			<td>{{ link $instance }}</td>
 			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
@@ -70,6 +76,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Location</strong></th>
@@ -78,10 +86,12 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $image := .Images }}
 	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ accountname $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
+			<td>{{ costcenter $image }}</td>
+			<td>{{ project $image }}</td>
+			<td>{{ link $image }}</td>
 			<td>{{ $image.Name }}</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
@@ -98,8 +108,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
@@ -108,11 +120,13 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ accountname $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
-			<td>{{ $volume.ID }}</td>
-			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ costcenter $volume }}</td>
+			<td>{{ project $volume }}</td>
+			<td>{{ link $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
 			<td>{{ $volume.Location }}</td>
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
@@ -130,19 +144,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ accountname $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
-			<td>{{ $snapshot.ID }}</td>
-			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ costcenter $snapshot }}</td>
+			<td>{{ project $snapshot }}</td>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
@@ -158,19 +176,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ accountname $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ costcenter $bucket }}</td>
+			<td>{{ project $bucket }}</td>
+			<td>{{ link $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
@@ -179,10 +201,47 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	</table>
 {{ end }}
 
+{{ if gt (len .RightSizing) 0 }}
+	<h2>Right-sizing recommendations:</h2>
+	<p>
+	These instances used less than {{ .RightSizingThresholds.CPUPercent }}% CPU and {{ .RightSizingThresholds.MemoryPercent }}% memory
+	at the 95th percentile of their busiest day in the last {{ .RightSizingThresholds.Days }} days, so a smaller type would
+	likely do. This is only advice, nothing is done to the instances. Changing the type requires
+	stopping the instance.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>CPU (p95)</strong></th>
+			<th><strong>Memory (p95)</strong></th>
+			<th><strong>Recommended type</strong></th>
+			<th><strong>Savings/month</strong></th>
+		</tr>
+	{{ range $i, $rec := .RightSizing }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ accountname $rec.Instance.Owner }}</td>
+			<td>{{ link $rec.Instance }}</td>
+			<td>{{ instname $rec.Instance }}</td>
+			<td>{{ $rec.Instance.Location }}</td>
+			<td>{{ $rec.Instance.InstanceType }}</td>
+			<td>{{ printf "%.0f" $rec.Utilization.CPUPercentP95 }}%</td>
+			<td>{{ printf "%.0f" $rec.Utilization.MemoryPercentP95 }}%</td>
+			<td>{{ $rec.RecommendedType }}</td>
+			<td>${{ printf "%.2f" $rec.SavingsPerMonth }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
+{{ unsubscribe .Owner "review" }}
 `
 
 const managerReviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
@@ -202,6 +261,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
@@ -211,12 +272,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ accountname $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
+			<td>{{ costcenter $instance }}</td>
+			<td>{{ project $instance }}</td>
+			<td>{{ link $instance }}</td>
 			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
@@ -232,6 +295,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Location</strong></th>
@@ -240,10 +305,12 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $image := .Images }}
 	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ accountname $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
+			<td>{{ costcenter $image }}</td>
+			<td>{{ project $image }}</td>
+			<td>{{ link $image }}</td>
 			<td>{{ $image.Name }}</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
@@ -260,8 +327,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
@@ -270,11 +339,13 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ accountname $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
-			<td>{{ $volume.ID }}</td>
-			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ costcenter $volume }}</td>
+			<td>{{ project $volume }}</td>
+			<td>{{ link $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
 			<td>{{ $volume.Location }}</td>
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
@@ -292,19 +363,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ accountname $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
-			<td>{{ $snapshot.ID }}</td>
-			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ costcenter $snapshot }}</td>
+			<td>{{ project $snapshot }}</td>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
@@ -320,19 +395,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ accountname $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ costcenter $bucket }}</td>
+			<td>{{ project $bucket }}</td>
+			<td>{{ link $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
@@ -345,6 +424,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
+{{ unsubscribe .Owner "review" }}
 `
 
 const totalReviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
@@ -364,6 +444,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
@@ -373,12 +455,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ accountname $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
+			<td>{{ costcenter $instance }}</td>
+			<td>{{ project $instance }}</td>
+			<td>{{ link $instance }}</td>
 			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
@@ -394,6 +478,8 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Location</strong></th>
@@ -402,10 +488,12 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $image := .Images }}
 	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ accountname $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
+			<td>{{ costcenter $image }}</td>
+			<td>{{ project $image }}</td>
+			<td>{{ link $image }}</td>
 			<td>{{ $image.Name }}</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
@@ -422,8 +510,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
@@ -432,11 +522,13 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ accountname $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
-			<td>{{ $volume.ID }}</td>
-			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ costcenter $volume }}</td>
+			<td>{{ project $volume }}</td>
+			<td>{{ link $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
 			<td>{{ $volume.Location }}</td>
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
@@ -454,19 +546,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ accountname $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
-			<td>{{ $snapshot.ID }}</td>
-			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ costcenter $snapshot }}</td>
+			<td>{{ project $snapshot }}</td>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
@@ -482,19 +578,23 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ accountname $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ costcenter $bucket }}</td>
+			<td>{{ project $bucket }}</td>
+			<td>{{ link $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
@@ -507,6 +607,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
+{{ unsubscribe .Owner "review" }}
 `
 
 const deletionWarningTemplate = `<h1>Hello {{ .Owner -}},</h1>
@@ -522,22 +623,38 @@ from your account shortly.
 
 <p>
 If you want to save any of these resources from deletion,
-add a tag with the key <b>cloudsweeper-whitelisted</b> to it.
+add a tag with the key <b>{{ tagkey "whitelist" }}</b> to it.
 </p>
 
 <p>If you only want to keep the resource around for a while, first delete
-its <b>cloudsweeper-delete-at</b> tag. Then add one of the following tags to it:</p>
+its <b>{{ tagkey "delete" }}</b> tag. Then add one of the following tags to it:</p>
+
+<ol>
+	<li><b>{{ tagkey "expiry" }}</b>: <i>YYYY-MM-DD</i> (Deletion occurs after the specified date.)</li>
+	<li><b>{{ tagkey "lifetime" }}</b>: days-<i>N</i> (Deletion occurs <i>N</i> days after resource was created.)</li>
+</ol>
+
+{{ if replycommands }}
+<p>You can also reply to this email with one command per line:</p>
 
 <ol>
-	<li><b>cloudsweeper-expiry</b>: <i>YYYY-MM-DD</i> (Deletion occurs after the specified date.)</li>
-	<li><b>cloudsweeper-lifetime</b>: days-<i>N</i> (Deletion occurs <i>N</i> days after resource was created.)</li>
+	<li><b>EXTEND</b> <i>resource ID</i> <i>N</i>d (Postpones the deletion by <i>N</i> days.)</li>
+	<li><b>PROTECT</b> <i>resource ID</i> reason: <i>why it must be kept</i> (Whitelists the resource.)</li>
+	<li><b>DISPUTE</b> <i>resource ID</i> reason: <i>who it belongs to</i> (Keeps a resource which isn't yours until it's assigned to its owner.)</li>
 </ol>
+{{ end }}
 
 <p>
 Read more about how Cloudsweeper works and how to better tag your resources 
 <a href="https://agaridata.atlassian.net/wiki/spaces/EN/pages/808189987/Cloudsweeper">here</a>.
 </p>
 
+<p>
+Elastic IPs and CloudWatch alarms of an instance are left behind when it's terminated. Alarms are
+deleted with the instance. Elastic IPs keep being billed until they are released, so release the
+ones you don't need anymore.
+</p>
+
 <h2>Marked resources:</h2>
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
@@ -546,26 +663,34 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 			<th><strong>Deletion date</strong></th>
+			<th><strong>Left behind</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ accountname $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
+			<td>{{ costcenter $instance }}</td>
+			<td>{{ project $instance }}</td>
+			<td>{{ link $instance }}</td>
+			<td>{{ deletereason $instance }}</td>
 			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
-			<td>{{ deletedate $instance "2006-01-02 (03:04 PM ET)" }}</td>	
+			<td>{{ deletedate $instance "2006-01-02 (03:04 PM MST)" }}</td>	
+			<td>{{ with debris $instance }}{{ range .ElasticIPs }}Elastic IP {{ .PublicIP }} ({{ if releaseselasticips }}released{{ else }}${{ printf "%.2f" elasticipcost }}/month{{ end }})<br />{{ end }}{{ if .Alarms }}{{ len .Alarms }} alarms (deleted){{ end }}{{ end }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -578,7 +703,10 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
@@ -587,15 +715,18 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $image := .Images }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ accountname $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
+			<td>{{ costcenter $image }}</td>
+			<td>{{ project $image }}</td>
+			<td>{{ link $image }}</td>
+			<td>{{ deletereason $image }}</td>
 			<td>{{ $image.Name }}</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
-			<td>{{ deletedate $image "2006-01-02 (03:04 PM ET)" }}</td>
+			<td>{{ deletedate $image "2006-01-02 (03:04 PM MST)" }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -608,8 +739,11 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
@@ -619,17 +753,20 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ accountname $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
-			<td>{{ $volume.ID }}</td>
-			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ costcenter $volume }}</td>
+			<td>{{ project $volume }}</td>
+			<td>{{ link $volume }}</td>
+			<td>{{ deletereason $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
 			<td>{{ $volume.Location }}</td>
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
 			<td>{{ accucost $volume }}</td>
-			<td>{{ deletedate $volume "2006-01-02 (03:04 PM ET)" }}</td>
+			<td>{{ deletedate $volume "2006-01-02 (03:04 PM MST)" }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -642,8 +779,11 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
@@ -651,15 +791,18 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ accountname $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
-			<td>{{ $snapshot.ID }}</td>
-			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ costcenter $snapshot }}</td>
+			<td>{{ project $snapshot }}</td>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ deletereason $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
-			<td>{{ deletedate $snapshot "2006-01-02 (03:04 PM ET)" }}</td>
+			<td>{{ deletedate $snapshot "2006-01-02 (03:04 PM MST)" }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -672,24 +815,32 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Early deletion fee</strong></th>
 			<th><strong>Deletion date</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ accountname $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ costcenter $bucket }}</td>
+			<td>{{ project $bucket }}</td>
+			<td>{{ link $bucket }}</td>
+			<td>{{ deletereason $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
-			<td>{{ deletedate $bucket "2006-01-02 (03:04 PM ET)" }}</td>
+			<td>{{ printf "$%.2f" (earlydeletionfee $bucket) }}</td>
+			<td>{{ deletedate $bucket "2006-01-02 (03:04 PM MST)" }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -713,6 +864,17 @@ Read more about how Cloudsweeper works and how to better tag your resources
 <a href="https://agaridata.atlassian.net/wiki/spaces/EN/pages/808189987/Cloudsweeper">here</a>.
 </p>
 
+{{ if gt (len .CostGates) 0 }}
+<p>Resources are marked in batches, which are deleted at different times. The resources
+of a batch are only marked if they cost at least the threshold of the account in total,
+or if a resource costs at least the threshold of a resource on its own.</p>
+<ul>
+{{ range .CostGates }}
+	<li>{{ .Explanation }}</li>
+{{ end }}
+</ul>
+{{ end }}
+
 <h2>Marked resources:</h2>
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
@@ -721,7 +883,10 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
 			<th><strong>Location</strong></th>
@@ -730,12 +895,15 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ accountname $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
+			<td>{{ costcenter $instance }}</td>
+			<td>{{ project $instance }}</td>
+			<td>{{ link $instance }}</td>
+			<td>{{ deletereason $instance }}</td>
 			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
@@ -751,7 +919,10 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
@@ -759,10 +930,13 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $image := .Images }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ accountname $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
+			<td>{{ costcenter $image }}</td>
+			<td>{{ project $image }}</td>
+			<td>{{ link $image }}</td>
+			<td>{{ deletereason $image }}</td>
 			<td>{{ $image.Name }}</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
@@ -779,8 +953,11 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
@@ -789,11 +966,14 @@ Read more about how Cloudsweeper works and how to better tag your resources
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ accountname $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
-			<td>{{ $volume.ID }}</td>
-			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ costcenter $volume }}</td>
+			<td>{{ project $volume }}</td>
+			<td>{{ link $volume }}</td>
+			<td>{{ deletereason $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
 			<td>{{ $volume.Location }}</td>
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
@@ -811,19 +991,25 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ accountname $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
-			<td>{{ $snapshot.ID }}</td>
-			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ costcenter $snapshot }}</td>
+			<td>{{ project $snapshot }}</td>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ deletereason $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
@@ -839,22 +1025,251 @@ Read more about how Cloudsweeper works and how to better tag your resources
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
+			<th><strong>Cost center</strong></th>
+			<th><strong>Project</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Early deletion fee</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ accountname $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ costcenter $bucket }}</td>
+			<td>{{ project $bucket }}</td>
+			<td>{{ link $bucket }}</td>
+			<td>{{ deletereason $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ printf "$%.2f" (earlydeletionfee $bucket) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .BackupManaged) 0 }}
+<h2>Managed by backup:</h2>
+<p>These resources match the rules, but were not marked since they were created by
+AWS Backup, and are deleted by their backup plan instead.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Kind</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Backup of</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $res := .BackupManaged }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ accountname $res.Owner }}</td>
+			<td>{{ kind $res }}</td>
+			<td>{{ link $res }}</td>
+			<td>{{ backupsource $res }}</td>
+			<td>{{ $res.Location }}</td>
+			<td>{{ fdate $res.CreationTime "2006-01-02" }} ({{ daysrunning $res.CreationTime }})</td>
+			<td>{{ accucost $res }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Undeletable) 0 }}
+<h2>Needs manual review:</h2>
+<p>These resources match the rules, but are protected from deletion by S3 Object Lock,
+their bucket policy or a snapshot lock, so Cloudsweeper can't delete them. Please review
+them, and remove the protection and the resource if it's no longer needed.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Kind</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Protection</strong></th>
+			<th><strong>Created</strong></th>
+		</tr>
+	{{ range $i, $res := .Undeletable }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ accountname $res.Resource.Owner }}</td>
+			<td>{{ kind $res.Resource }}</td>
+			<td>{{ link $res.Resource }}</td>
+			<td>{{ $res.Resource.Location }}</td>
+			<td>{{ $res.Protection }}</td>
+			<td>{{ fdate $res.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $res.Resource.CreationTime }})</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const notifyOnlyTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>These resources in your account match the cleanup rules, but will not be deleted.</h2>
+
+<p>Please review them and remove the ones no longer needed. Cloudsweeper will keep
+reminding you about them until they are removed or whitelisted.</p>
+
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
+
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $instance := .Instances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $instance }}</td>
+			<td>{{ deletereason $instance }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ accucost $instance }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $image }}</td>
+			<td>{{ deletereason $image }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ accucost $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Attached to instance</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $volume }}</td>
+			<td>{{ deletereason $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ yesno $volume.Attached }}</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ accucost $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ deletereason $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Files</strong></th>
+			<th><strong>Last modified</strong></th>
+			<th><strong>Monthly cost</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $bucket }}</td>
+			<td>{{ deletereason $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
+			<td>{{ $bucket.ObjectCount }}</td>
+			<td>{{ daysrunning $bucket.LastModified }}</td>
+			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Undeletable) 0 }}
+<h2>Needs manual review:</h2>
+<p>These resources match the rules, but are protected from deletion by S3 Object Lock,
+their bucket policy or a snapshot lock, so Cloudsweeper can't delete them. Please review
+them, and remove the protection and the resource if it's no longer needed.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Kind</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Protection</strong></th>
+			<th><strong>Created</strong></th>
+		</tr>
+	{{ range $i, $res := .Undeletable }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ accountname $res.Resource.Owner }}</td>
+			<td>{{ kind $res.Resource }}</td>
+			<td>{{ link $res.Resource }}</td>
+			<td>{{ $res.Resource.Location }}</td>
+			<td>{{ $res.Protection }}</td>
+			<td>{{ fdate $res.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $res.Resource.CreationTime }})</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -864,6 +1279,7 @@ Read more about how Cloudsweeper works and how to better tag your resources
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
+{{ unsubscribe .Owner "notify-only" }}
 `
 
 const untaggedMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
@@ -880,7 +1296,7 @@ Read more about how Cloudsweeper works and how to better tag your resources
 </p>
 
 <h2>Untagged resources:</h2>
-<p><strong>Account ID:</strong> {{ .OwnerID }}</p>
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
 <p>
 Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
 </p>
@@ -896,7 +1312,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
 			<td style="white-space: nowrap;">{{ $instance.Location }}</td>
-			<td style="white-space: nowrap;">{{ $instance.ID }}</td>
+			<td style="white-space: nowrap;">{{ link $instance }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $instance.CreationTime }}</td>
 			<td>
 			{{ range $key, $val := $instance.Tags }}
@@ -921,7 +1337,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	{{ range $i, $image := .Images }}
 	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
 			<td style="white-space: nowrap;">{{ $image.Location }}</td>
-			<td style="white-space: nowrap;">{{ $image.ID }}</td>
+			<td style="white-space: nowrap;">{{ link $image }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $image.CreationTime }}</td>
 			<td>
 			{{ range $key, $val := $image.Tags }}
@@ -945,7 +1361,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	{{ range $i, $volume := .Volumes }}
 	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
 			<td style="white-space: nowrap;">{{ $volume.Location }}</td>
-			<td style="white-space: nowrap;">{{ $volume.ID }}</td>
+			<td style="white-space: nowrap;">{{ link $volume }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $volume.CreationTime }}</td>
 			<td>
 			{{ range $key, $val := $volume.Tags }}
@@ -969,7 +1385,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	{{ range $i, $snapshot := .Snapshots }}
 	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
 			<td style="white-space: nowrap;">{{ $snapshot.Location }}</td>
-			<td style="white-space: nowrap;">{{ $snapshot.ID }}</td>
+			<td style="white-space: nowrap;">{{ link $snapshot }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $snapshot.CreationTime }}</td>
 			<td>
 			{{ range $key, $val := $snapshot.Tags }}
@@ -990,7 +1406,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td style="white-space: nowrap;">{{ $bucket.ID }}</td>
+			<td style="white-space: nowrap;">{{ link $bucket }}</td>
 			<td>
 			{{ range $key, $val := $bucket.Tags }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
@@ -1005,20 +1421,32 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
+{{ unsubscribe .Owner "untagged" }}
 `
 
 const monthToDateTemplate = `
 {{ $accountToUserMapping := .AccountToUser }}
+{{ $showBlended := .ShowBlended }}
+{{ $report := .Report }}
+{{ $previous := .Previous }}
 <h2>Hello,</h2>
 
 <p>
-The following is a summary of this month's expenditures in {{ .CSP }}.
+The following is a summary of the expenditures in {{ .CSP }} from {{ $report.Period.Dates }}.
 </p>
+{{ if $previous }}
 <p>
-In the summary, only accounts with a total cost over ${{ .MinimumTotalCost }} are listed.
+Costs are compared with the previous period, from {{ $previous.Period.Dates }}, when the total cost was {{ $report.FormatCost $previous.TotalCost }}.
+</p>
+{{ end }}
+<p>
+In the summary, only accounts with a total cost over {{ $report.FormatCost .MinimumTotalCost }} are listed.
+</p>
+<p>
+In the detailed breakdown, only costs over {{ $report.FormatCost .MinimumCost }} are listed (but every cost is still counted towards the total!)
 </p>
 <p>
-In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but every cost is still counted towards the total!)
+The attached CSV file has every cost per account and service, to sort and pivot in a spreadsheet.
 </p>
 
 <h3>Summary:</h3>
@@ -1027,14 +1455,61 @@ In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but e
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
 			<th><strong>Cost</strong></th>
+			{{ if $showBlended }}<th><strong>Blended cost</strong></th>{{ end }}
+			{{ if $previous }}<th><strong>Change</strong></th>{{ end }}
 		</tr>
+	{{ $previousUsers := .PreviousUsers }}
 	{{ range $i, $user := .SortedUsers }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
 			<td>{{ maybeRealName $user.Name $accountToUserMapping }}</td>
-			<td>{{ printf "$%.2f" $user.TotalCost }}</td>
+			<td>{{ $report.FormatCost $user.TotalCost }}</td>
+			{{ if $showBlended }}<td>{{ $report.FormatCost $user.TotalBlendedCost }}</td>{{ end }}
+			{{ if $previous }}<td>{{ $report.FormatChange $user.TotalCost (index $previousUsers $user.Name) }}</td>{{ end }}
+		</tr>
+	{{ end }}
+		<td colspan="2"><strong>Total cost: {{ $report.FormatCost .TotalCost }}{{ if $showBlended }} (blended: {{ $report.FormatCost .TotalBlendedCost }}){{ end }}{{ if $previous }}, {{ $report.FormatChange .TotalCost $previous.TotalCost }}{{ end }}<strong></td>
+	</table>
+{{ end }}
+
+{{ if .CostCenters }}
+<h3>Per cost center:</h3>
+	<table>
+		<tr style="text-align:left;">
+			<th><strong>Cost center</strong></th>
+			<th><strong>Cost</strong></th>
+			{{ if $showBlended }}<th><strong>Blended cost</strong></th>{{ end }}
+			{{ if $previous }}<th><strong>Change</strong></th>{{ end }}
+		</tr>
+	{{ $previousGroups := .PreviousCostCenters }}
+	{{ range $i, $group := .CostCenters }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ if $group.Name }}{{ $group.Name }}{{ else }}&lt;unattributed&gt;{{ end }}</td>
+			<td>{{ $report.FormatCost $group.TotalCost }}</td>
+			{{ if $showBlended }}<td>{{ $report.FormatCost $group.TotalBlendedCost }}</td>{{ end }}
+			{{ if $previous }}<td>{{ $report.FormatChange $group.TotalCost (index $previousGroups $group.Name) }}</td>{{ end }}
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if .Projects }}
+<h3>Per project:</h3>
+	<table>
+		<tr style="text-align:left;">
+			<th><strong>Project</strong></th>
+			<th><strong>Cost</strong></th>
+			{{ if $showBlended }}<th><strong>Blended cost</strong></th>{{ end }}
+			{{ if $previous }}<th><strong>Change</strong></th>{{ end }}
+		</tr>
+	{{ $previousGroups := .PreviousProjects }}
+	{{ range $i, $group := .Projects }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ if $group.Name }}{{ $group.Name }}{{ else }}&lt;unattributed&gt;{{ end }}</td>
+			<td>{{ $report.FormatCost $group.TotalCost }}</td>
+			{{ if $showBlended }}<td>{{ $report.FormatCost $group.TotalBlendedCost }}</td>{{ end }}
+			{{ if $previous }}<td>{{ $report.FormatChange $group.TotalCost (index $previousGroups $group.Name) }}</td>{{ end }}
 		</tr>
 	{{ end }}
-		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" .TotalCost }}<strong></td>
 	</table>
 {{ end }}
 
@@ -1042,19 +1517,21 @@ In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but e
 {{ if gt (len .SortedUsers) 0 }}
 	{{ range $index, $user := .SortedUsers }}
 		<h3>{{- maybeRealName $user.Name $accountToUserMapping -}}'s costs:</h3>
-		<h4>(Account ID: {{ $user.Name }})</h4>
+		<h4>(Account: {{ accountname $user.Name }})</h4>
 		<table>
 		<tr style="text-align:left;">
 			<th><strong>Cost</strong></th>
+			{{ if $showBlended }}<th><strong>Blended cost</strong></th>{{ end }}
 			<th><strong>Description</strong></th>
 		</tr>
 		{{ range $i, $detailedCost := $user.DetailedCosts }}
 			<tr {{ if even $i }} style="background-color: #f2f2f2;"{{ end }}>
-				<td>{{ printf "$%.2f" $detailedCost.Cost }}</td>
+				<td>{{ $report.FormatCost $detailedCost.Cost }}</td>
+				{{ if $showBlended }}<td>{{ $report.FormatCost $detailedCost.BlendedCost }}</td>{{ end }}
 				<td>{{ $detailedCost.Description }}</td>
 			</tr>
 		{{ end }}
-		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" $user.TotalCost }}<strong></td>
+		<td colspan="2"><strong>Total cost: {{ $report.FormatCost $user.TotalCost }}<strong></td>
 	</table>
 	<br />
 	{{ end }}
@@ -1065,3 +1542,1325 @@ Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
+
+const exposureMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following resources in your account are exposed to the internet. Please make sure that this is
+intended, and restrict access to only the addresses that need it. Security groups open to everyone
+(0.0.0.0/0 or ::/0) on sensitive ports, such as SSH, RDP or databases, are a common way for
+attackers to get in.
+</p>
+
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
+
+{{ if gt (len .RevokedGroups) 0 }}
+	<h3>Revoked rules</h3>
+	<p>These security groups were tagged with <b>{{ .TemporaryTagKey }}</b>, so their open rules have been revoked.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Revoked rules</strong></th>
+		</tr>
+	{{ range $i, $open := .RevokedGroups }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $open.Group.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $open.Group }}</td>
+			<td style="white-space: nowrap;">{{ $open.Group.Name }}</td>
+			<td>{{ range $open.Rules }}{{ . }}<br />{{ end }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .OpenGroups) 0 }}
+	<h3>Security groups open to the internet</h3>
+	<p>Tag a security group with <b>{{ .TemporaryTagKey }}</b> to let Cloudsweeper revoke these rules automatically.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Open rules</strong></th>
+		</tr>
+	{{ range $i, $open := .OpenGroups }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $open.Group.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $open.Group }}</td>
+			<td style="white-space: nowrap;">{{ $open.Group.Name }}</td>
+			<td>{{ range $open.Rules }}{{ . }}<br />{{ end }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .PublicInstances) 0 }}
+	<h3>Instances with a public IP</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>Created</strong></th>
+		</tr>
+	{{ range $i, $instance := .PublicInstances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $instance.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $instance }}</td>
+			<td style="white-space: nowrap;">{{ instname $instance }}</td>
+			<td style="white-space: nowrap;">{{ $instance.InstanceType }}</td>
+			<td style="white-space: nowrap;">{{ daysrunning $instance.CreationTime }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const unencryptedMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following volumes and snapshots in your account are not encrypted. Please replace them with
+encrypted ones. An unencrypted volume can be replaced by creating a new volume from an encrypted
+snapshot of it. Enabling EBS encryption by default in every region makes sure that new volumes
+are always encrypted.
+</p>
+
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
+
+{{ if gt (len .Copies) 0 }}
+	<h3>Encrypted copies</h3>
+	<p>Encrypted snapshots have been created of these resources. The originals have not been modified.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>Source ID</strong></th>
+			<th><strong>Encrypted snapshot ID</strong></th>
+		</tr>
+	{{ range $i, $copy := .Copies }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $copy.Source.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $copy.Source }}</td>
+			<td style="white-space: nowrap;">{{ $copy.CopyID }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Unencrypted volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>Attached</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $volume.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $volume }}</td>
+			<td style="white-space: nowrap;">{{ size $volume.SizeGB }}</td>
+			<td style="white-space: nowrap;">{{ $volume.VolumeType }}</td>
+			<td style="white-space: nowrap;">{{ $volume.Attached }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Unencrypted snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Created</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $snapshot.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $snapshot }}</td>
+			<td style="white-space: nowrap;">{{ size $snapshot.SizeGB }}</td>
+			<td style="white-space: nowrap;">{{ daysrunning $snapshot.CreationTime }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const archiveMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following snapshots in your account are more than {{ .Days }} days old and have not been
+restored in the last {{ .Days }} days. Instead of deleting them, they can be moved to the archive
+tier, which costs about 75% less to store. Restoring an archived snapshot takes up to 72 hours,
+and archived snapshots are billed for at least 90 days.
+</p>
+
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
+<p><strong>Estimated savings:</strong> ${{ printf "%.2f" .SavingsPerMonth }} per month</p>
+
+{{ if gt (len .Archived) 0 }}
+	<h3>Archived snapshots</h3>
+	<p>These snapshots have been moved to the archive tier.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Savings/month</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Archived }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $snapshot.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $snapshot }}</td>
+			<td style="white-space: nowrap;">{{ size $snapshot.SizeGB }}</td>
+			<td style="white-space: nowrap;">{{ fdate $snapshot.CreationTime "2006-01-02" }}</td>
+			<td style="white-space: nowrap;">${{ printf "%.2f" (archivesavings $snapshot) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Recommended for archiving</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Last restored</strong></th>
+			<th><strong>Savings/month</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $snapshot.Location }}</td>
+			<td style="white-space: nowrap;">{{ link $snapshot }}</td>
+			<td style="white-space: nowrap;">{{ size $snapshot.SizeGB }}</td>
+			<td style="white-space: nowrap;">{{ fdate $snapshot.CreationTime "2006-01-02" }}</td>
+			<td style="white-space: nowrap;">{{ daysrunning $snapshot.LastUsed }}</td>
+			<td style="white-space: nowrap;">${{ printf "%.2f" (archivesavings $snapshot) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "archive" }}
+`
+
+const multipartMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following buckets have multipart uploads which were started more than {{ .Days }} days ago
+and never completed. The parts uploaded so far are stored, and billed, until the upload is
+aborted, but they don't show up as objects in the bucket. Setting up a lifecycle rule to abort
+incomplete multipart uploads keeps this from happening again.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Storage used:</strong> {{ size .SizeGB }}</p>
+<p><strong>Estimated savings:</strong> ${{ printf "%.2f" .SavingsPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Bucket</strong></th>
+		<th><strong>Uploads</strong></th>
+		<th><strong>Size</strong></th>
+		<th><strong>Oldest</strong></th>
+		<th><strong>Savings/month</strong></th>
+		<th><strong>Aborted</strong></th>
+	</tr>
+{{ range $i, $stale := .Buckets }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $stale.Bucket.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $stale.Bucket.Location }}</td>
+		<td style="white-space: nowrap;">{{ link $stale.Bucket }}</td>
+		<td style="white-space: nowrap;">{{ len $stale.Uploads }}</td>
+		<td style="white-space: nowrap;">{{ size $stale.SizeGB }}</td>
+		<td style="white-space: nowrap;">{{ fdate $stale.Oldest "2006-01-02" }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" $stale.SavingsPerMonth }}</td>
+		<td style="white-space: nowrap;">{{ yesno $stale.Aborted }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "multipart" }}
+`
+
+const spotMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following on-demand instances have been running for more than {{ .Days }} days without being
+stopped. Instances which can be interrupted, such as build agents and test environments, cost
+much less as spot instances, which are launched the same way but may be stopped with two minutes'
+notice. Instances which must keep running cost less under a savings plan, which commits to an
+amount of compute per hour for one or three years.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>On-demand cost:</strong> ${{ printf "%.2f" .OnDemandPerMonth }} per month</p>
+<p><strong>Estimated savings with spot instances:</strong> ${{ printf "%.2f" .SpotSavingsPerMonth }} per month</p>
+<p><strong>Estimated savings with a savings plan:</strong> ${{ printf "%.2f" .SavingsPlanSavingsPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Instance</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>Running</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>Spot savings/month</strong></th>
+		<th><strong>Savings plan savings/month</strong></th>
+	</tr>
+{{ range $i, $candidate := .Instances }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $candidate.Instance.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $candidate.Instance.Location }}</td>
+		<td style="white-space: nowrap;">{{ link $candidate.Instance }}</td>
+		<td style="white-space: nowrap;">{{ $candidate.Instance.InstanceType }}</td>
+		<td style="white-space: nowrap;">{{ $candidate.RunningDays }} days</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" $candidate.OnDemandPerMonth }}</td>
+		<td style="white-space: nowrap;">{{ if $candidate.SpotPriceKnown }}${{ printf "%.2f" $candidate.SpotSavingsPerMonth }}{{ else }}unknown{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" $candidate.SavingsPlanSavingsPerMonth }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Spot savings are estimated from the current spot price, which changes over time.
+</p>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "spot" }}
+`
+
+const imageCopyMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following images have been copied to other locations, where no instance has been launched
+from them in the last {{ .Days }} days. Each copy is stored as separate snapshots, which are
+billed until the copy is removed along with its snapshots. The source images, and the copies
+in use, are kept.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Snapshot storage used:</strong> {{ size .SizeGB }}</p>
+<p><strong>Estimated savings:</strong> ${{ printf "%.2f" .SavingsPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Source</strong></th>
+		<th><strong>Kept in</strong></th>
+		<th><strong>Copy</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Size</strong></th>
+		<th><strong>Last used</strong></th>
+		<th><strong>Savings/month</strong></th>
+		<th><strong>Removed</strong></th>
+	</tr>
+{{ range $i, $group := .Groups }}
+	{{ range $img := $group.Unused }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $img.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $group.Name }}</td>
+		<td style="white-space: nowrap;">{{ $group.SourceID }} ({{ $group.SourceLocation }})</td>
+		<td style="white-space: nowrap;">{{ $group.UsedLocations }}</td>
+		<td style="white-space: nowrap;">{{ link $img }}</td>
+		<td style="white-space: nowrap;">{{ $img.Location }}</td>
+		<td style="white-space: nowrap;">{{ size $img.SizeGB }}</td>
+		<td style="white-space: nowrap;">{{ if $img.LastUsed.IsZero }}Unknown{{ else }}{{ fdate $img.LastUsed "2006-01-02" }}{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" (imagesavings $img) }}</td>
+		<td style="white-space: nowrap;">{{ yesno (index $group.Removed $img.ID) }}</td>
+	</tr>
+	{{ end }}
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const fileSystemMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following file systems are not mounted anywhere, or have had no reads or writes in the
+last {{ .Days }} days. They are billed for their storage whether they are used or not. File
+systems marked for deletion are deleted at the time shown, unless they are used again before
+then or whitelisted.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Kind</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Size</strong></th>
+		<th><strong>Mount targets</strong></th>
+		<th><strong>Last IO</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $idle := .FileSystems }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $idle.FileSystem.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $idle.FileSystem.Kind }}</td>
+		<td style="white-space: nowrap;">{{ link $idle.FileSystem }}</td>
+		<td style="white-space: nowrap;">{{ $idle.FileSystem.Name }}</td>
+		<td style="white-space: nowrap;">{{ $idle.FileSystem.Location }}</td>
+		<td style="white-space: nowrap;">{{ size $idle.FileSystem.SizeGB }}</td>
+		<td style="white-space: nowrap;">{{ if lt $idle.FileSystem.MountTargets 0 }}-{{ else }}{{ $idle.FileSystem.MountTargets }}{{ end }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.FileSystem.LastUsed.IsZero }}Not in {{ $.Days }} days{{ else }}{{ fdate $idle.FileSystem.LastUsed "2006-01-02" }}{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" (filesystemcost $idle.FileSystem) }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Deleted }}Deleted{{ else }}{{ with deletedate $idle.FileSystem "2006-01-02" }}Delete at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const vpnMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following Client VPN endpoints and VPN connections have had no connections or traffic in the
+last {{ .Days }} days. Client VPN endpoints are billed every hour for each network they are
+associated with, and VPN connections every hour they exist, whether they are used or not. VPNs
+marked for deletion are deleted at the time shown, unless they are used again before then or
+whitelisted.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Kind</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Associated networks</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $idle := .VPNs }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $idle.VPN.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $idle.VPN.Kind }}</td>
+		<td style="white-space: nowrap;">{{ link $idle.VPN }}</td>
+		<td style="white-space: nowrap;">{{ $idle.VPN.Name }}</td>
+		<td style="white-space: nowrap;">{{ $idle.VPN.Location }}</td>
+		<td style="white-space: nowrap;">{{ if lt $idle.VPN.Associations 0 }}-{{ else }}{{ $idle.VPN.Associations }}{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" (vpncost $idle.VPN) }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Deleted }}Deleted{{ else }}{{ with deletedate $idle.VPN "2006-01-02" }}Delete at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const dataClusterMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following clusters, such as EMR clusters, have not run any steps or applications in the last
+{{ .Hours }} hours. They are billed every hour for their instances, whether they run any work or
+not. Clusters marked for termination are terminated at the time shown, unless they run any work
+before then or are whitelisted. Data stored on the cluster, such as in HDFS, is lost when it's
+terminated, while data in S3 is kept. Termination protected clusters are never terminated. Tag a
+cluster with the <b>{{ tagkey "whitelist" }}</b> tag to keep it running.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Instances</strong></th>
+		<th><strong>Last active</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $idle := .Clusters }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $idle.Cluster.Owner }}</td>
+		<td style="white-space: nowrap;">{{ link $idle.Cluster }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Cluster.Name }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Cluster.Location }}</td>
+		<td style="white-space: nowrap;">{{ clusterinstances $idle.Cluster }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Cluster.LastActive.IsZero }}Not in {{ $.Hours }} hours{{ else }}{{ fdate $idle.Cluster.LastActive "2006-01-02 15:04" }}{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" (clustercost $idle.Cluster) }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Terminated }}Terminated{{ else if $idle.Cluster.TerminationProtected }}Termination protected{{ else }}{{ with deletedate $idle.Cluster "2006-01-02 15:04" }}Terminate at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const gpuMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following GPU instances have been running for more than {{ .Hours }} hours without their GPUs,
+or their CPUs where GPU utilization isn't reported, being more than {{ .Percent }}% busy in any hour.
+GPU instances are billed every hour they run, and one left running overnight can cost more than
+all other unused resources of an account. Stop the instances you don't need right now, they can
+be started again later.{{ if .Marking }} Instances marked for deletion are deleted at the time shown,
+unless they are used again before then or whitelisted.{{ end }} Tag an instance with the
+<b>{{ tagkey "whitelist" }}</b> tag to keep it running.
+</p>
+
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerDay }} per day</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Instance type</strong></th>
+		<th><strong>Started</strong></th>
+		<th><strong>GPU (max)</strong></th>
+		<th><strong>CPU (max)</strong></th>
+		<th><strong>Cost/day</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $idle := .Instances }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $idle.Instance.Owner }}</td>
+		<td style="white-space: nowrap;">{{ link $idle.Instance }}</td>
+		<td style="white-space: nowrap;">{{ instname $idle.Instance }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Instance.Location }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Instance.InstanceType }}</td>
+		<td style="white-space: nowrap;">{{ fdate $idle.Instance.CreationTime "2006-01-02 15:04" }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Utilization.GPUKnown }}{{ printf "%.0f" $idle.Utilization.GPUPercentMax }}%{{ else }}Not reported{{ end }}</td>
+		<td style="white-space: nowrap;">{{ printf "%.0f" $idle.Utilization.CPUPercentMax }}%</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" $idle.CostPerDay }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Deleted }}Deleted{{ else }}{{ with deletedate $idle.Instance "2006-01-02 15:04" }}Delete at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+GPU utilization is reported by the CloudWatch agent with the nvidia_gpu plugin, or a DCGM exporter
+it scrapes. Without it, idle GPU instances can only be told by their CPUs.
+</p>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const mlMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following machine learning resources, such as SageMaker notebook instances, endpoints and
+Studio apps, have not been used in the last {{ .Days }} days. They are billed every hour for their
+instances while they run, whether they are used or not. Notebook instances are stopped, keeping
+their data, and can be started again when needed. Endpoints and Studio apps marked for deletion
+are deleted at the time shown, unless they are used again before then or whitelisted. Endpoint
+configurations and models, and the files of Studio users, are kept. Tag a resource with the
+<b>{{ tagkey "whitelist" }}</b> tag to keep it running.
+</p>
+
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Kind</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>User</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Instances</strong></th>
+		<th><strong>Last used</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $idle := .Resources }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $idle.Resource.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Resource.Kind }}</td>
+		<td style="white-space: nowrap;">{{ link $idle.Resource }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Resource.UserName }}</td>
+		<td style="white-space: nowrap;">{{ $idle.Resource.Location }}</td>
+		<td style="white-space: nowrap;">{{ mlinstances $idle.Resource }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Resource.LastUsed.IsZero }}Not in {{ $.Days }} days{{ else }}{{ fdate $idle.Resource.LastUsed "2006-01-02" }}{{ end }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" (mlcost $idle.Resource) }}</td>
+		<td style="white-space: nowrap;">{{ if $idle.Stopped }}Stopped{{ else if $idle.Deleted }}Deleted{{ else }}{{ with deletedate $idle.Resource "2006-01-02" }}Delete at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const transitGatewayMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following transit gateways are attached to VPCs which were deleted, or which have no network
+interfaces apart from the ones of the attachment, so nothing in them uses the gateway. Every
+attachment is billed per hour. Routes to attachments which no longer exist are blackhole routes,
+which drop the traffic sent to them. Attachments and routes which were deleted are shown as
+such. Tag an attachment with the <b>{{ tagkey "whitelist" }}</b> tag to keep it.
+</p>
+
+{{ range .Gateways }}
+<h2>{{ link .Gateway }}{{ with .Gateway.Name }} ({{ . }}){{ end }} in {{ accountname .Gateway.Owner }}, {{ .Gateway.Location }}</h2>
+{{ if .Attachments }}
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Attachment</strong></th>
+		<th><strong>VPC</strong></th>
+		<th><strong>VPC account</strong></th>
+		<th><strong>Problem</strong></th>
+		<th><strong>Detached</strong></th>
+	</tr>
+{{ range $i, $attachment := .Attachments }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ $attachment.ID }}</td>
+		<td style="white-space: nowrap;">{{ $attachment.NetworkID }}</td>
+		<td style="white-space: nowrap;">{{ accountname $attachment.NetworkOwner }}</td>
+		<td style="white-space: nowrap;">{{ if $attachment.NetworkExists }}VPC is empty{{ else }}VPC was deleted{{ end }}</td>
+		<td style="white-space: nowrap;">{{ yesno $attachment.Detached }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ end }}
+{{ if .Routes }}
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Route table</strong></th>
+		<th><strong>Destination</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>Deleted</strong></th>
+	</tr>
+{{ range $i, $route := .Routes }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ $route.RouteTableID }}</td>
+		<td style="white-space: nowrap;">{{ $route.Destination }}</td>
+		<td style="white-space: nowrap;">{{ if $route.Static }}Static{{ else }}Propagated{{ end }}</td>
+		<td style="white-space: nowrap;">{{ yesno $route.Deleted }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ end }}
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const monitoringMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following alarms have no data, since the resources they are on no longer exist, and the
+following dashboards have not been viewed or modified in the last {{ .Days }} days. Both are
+billed every month whether they are used or not. Alarms are only considered dead if they are
+on instances or volumes.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+{{ if .Alarms }}
+<h2>Alarms on resources which no longer exist</h2>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Alarm</strong></th>
+		<th><strong>Missing resources</strong></th>
+		<th><strong>No data since</strong></th>
+		<th><strong>Deleted</strong></th>
+	</tr>
+{{ range $i, $dead := .Alarms }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $dead.Alarm.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $dead.Alarm.Location }}</td>
+		<td>{{ link $dead.Alarm }}</td>
+		<td style="white-space: nowrap;">{{ $dead.Alarm.MissingResources }}</td>
+		<td style="white-space: nowrap;">{{ fdate $dead.Alarm.StateUpdated "2006-01-02" }}</td>
+		<td style="white-space: nowrap;">{{ yesno $dead.Deleted }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ end }}
+
+{{ if .Dashboards }}
+<h2>Dashboards not viewed in {{ .Days }} days</h2>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Dashboard</strong></th>
+		<th><strong>Last modified</strong></th>
+		<th><strong>Deleted</strong></th>
+	</tr>
+{{ range $i, $unviewed := .Dashboards }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $unviewed.Dashboard.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $unviewed.Dashboard.Location }}</td>
+		<td>{{ link $unviewed.Dashboard }}</td>
+		<td style="white-space: nowrap;">{{ fdate $unviewed.Dashboard.LastModified "2006-01-02" }}</td>
+		<td style="white-space: nowrap;">{{ yesno $unviewed.Deleted }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const networkMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following networks have no network interfaces, instances or connections to other networks, and
+were not created in the last {{ .Days }} days. Nothing can be running in them, so they are most
+likely left over from an experiment. Empty networks still count towards the quotas of VPCs,
+internet gateways and subnets, and clutter the account. Networks marked for deletion are deleted at
+the time shown, unless they are used again before, and networks which were deleted are shown as
+such, together with the network objects deleted with them. Tag a network with the
+<b>{{ tagkey "whitelist" }}</b> tag to keep it.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Networks deleted:</strong> {{ .Deleted }} of {{ len .Networks }}</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Network</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>CIDR</strong></th>
+		<th><strong>Network objects</strong></th>
+		<th><strong>Status</strong></th>
+	</tr>
+{{ range $i, $empty := .Networks }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $empty.Network.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $empty.Network.Location }}</td>
+		<td>{{ link $empty.Network }}</td>
+		<td>{{ $empty.Network.Name }}</td>
+		<td style="white-space: nowrap;">{{ $empty.Network.CIDR }}</td>
+		<td>{{ range $empty.Network.Objects }}{{ .Kind }} {{ .ID }}{{ if .Deleted }} (deleted){{ end }}<br />{{ end }}</td>
+		<td style="white-space: nowrap;">{{ if $empty.Deleted }}Deleted{{ else }}{{ with deletedate $empty.Network "2006-01-02" }}Delete at {{ . }}{{ end }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const cleanupMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+Cleanup terminated the following instances, which were referenced by Elastic IPs or CloudWatch
+alarms. The alarms were deleted with the instances. Elastic IPs which are still allocated keep
+being billed, {{ printf "%.2f" elasticipcost }} USD per month each, so please release the ones
+you don't need anymore.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+<p><strong>Elastic IPs still allocated:</strong> {{ .Allocated }} (${{ printf "%.2f" .CostPerMonth }}/month)</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Instance</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Elastic IPs</strong></th>
+		<th><strong>Alarms</strong></th>
+	</tr>
+{{ range $i, $terminated := .Terminated }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $terminated.Instance.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $terminated.Instance.Location }}</td>
+		<td>{{ $terminated.Instance.ID }}</td>
+		<td>{{ instname $terminated.Instance }}</td>
+		<td>{{ range $terminated.Debris.ElasticIPs }}{{ .PublicIP }} ({{ if .Released }}released{{ else }}still allocated{{ end }})<br />{{ end }}</td>
+		<td>{{ range $terminated.Debris.Alarms }}{{ . }}<br />{{ end }}{{ if and $terminated.Debris.Alarms (not $terminated.Debris.AlarmsDeleted) }}<strong>Could not be deleted</strong>{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const quotaMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following service quotas are at least {{ .Percent }}% used. Once a quota is reached, no more
+resources of that kind can be created in the region, which can break deployments and backups.
+Cleaning up unused snapshots, AMIs and VPCs frees up their quotas, so please start with the
+most used ones. If the resources are needed, consider requesting a quota increase instead.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Quota</strong></th>
+		<th><strong>Used</strong></th>
+		<th><strong>Limit</strong></th>
+		<th><strong>Percent used</strong></th>
+	</tr>
+{{ range $i, $quota := .Quotas }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $quota.Account }}</td>
+		<td style="white-space: nowrap;">{{ $quota.Location }}</td>
+		<td>{{ $quota.Name }}</td>
+		<td style="white-space: nowrap;">{{ printf "%.0f" $quota.Usage }}</td>
+		<td style="white-space: nowrap;">{{ printf "%.0f" $quota.Limit }}</td>
+		<td style="white-space: nowrap;">{{ printf "%.0f" $quota.Percent }}%</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "quota" }}
+`
+
+const lifecycleMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following lifecycle policies create snapshots on a schedule and delete them once they are
+no longer retained. Cloudsweeper marks unused snapshots for cleanup once they are older than the
+number of days listed below. Please check that both agree on how long snapshots are kept, starting
+with the schedules at the top. A conflict means that Cloudsweeper deletes snapshots which the
+policy still retains, so either the policy or the Cloudsweeper settings should change.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Policy</strong></th>
+		<th><strong>Schedule</strong></th>
+		<th><strong>Retained by policy</strong></th>
+		<th><strong>Marked after</strong></th>
+		<th><strong>Verdict</strong></th>
+	</tr>
+{{ range $i, $comparison := .Comparisons }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $comparison.Policy.Account }}</td>
+		<td style="white-space: nowrap;">{{ $comparison.Policy.Location }}</td>
+		<td>{{ $comparison.Policy.ID }}{{ if $comparison.Policy.Description }} ({{ $comparison.Policy.Description }}){{ end }}{{ if not $comparison.Policy.Enabled }}, disabled{{ end }}</td>
+		<td>{{ $comparison.Schedule.Name }}</td>
+		<td style="white-space: nowrap;">{{ if $comparison.Schedule.RetainCount }}{{ $comparison.Schedule.RetainCount }} snapshots{{ if $comparison.Schedule.RetentionDays }}, ~{{ $comparison.Schedule.RetentionDays }} days{{ end }}{{ else }}{{ $comparison.Schedule.RetainDays }} days{{ end }}</td>
+		<td style="white-space: nowrap;">{{ $comparison.CleanupDays }} days</td>
+		<td>
+		{{- if eq $comparison.Verdict "conflict" }}<strong>Conflict:</strong> Cloudsweeper deletes snapshots the policy still retains
+		{{- else if eq $comparison.Verdict "unmanaged" }}<strong>Unmanaged:</strong> the policy is disabled, and Cloudsweeper leaves its snapshots alone
+		{{- else if eq $comparison.Verdict "unknown" }}Unknown: the retention can't be compared
+		{{- else if eq $comparison.Verdict "overlap" }}Overlap: the policy deletes snapshots first
+		{{- else if eq $comparison.Verdict "notify-only" }}Cloudsweeper only notifies about snapshots
+		{{- else }}Cloudsweeper leaves the snapshots to the policy{{ end -}}
+		</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "lifecycle" }}
+`
+
+const chargebackTemplate = `{{ $statement := .Statement }}{{ $report := $statement.Report }}<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+This is the {{ $report.CSP }} chargeback statement of <strong>{{ $statement.TeamName }}</strong> for
+{{ $statement.MonthName }}. It lists the cost of every account of the team, which is charged to
+the cost centers below. The same statement is attached as a PDF file, for your records.
+</p>
+
+<p><strong>Total:</strong> {{ $report.FormatCost $statement.Total }}</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Owner</strong></th>
+		<th><strong>Cost center</strong></th>
+		<th><strong>Project</strong></th>
+		<th><strong>Cost</strong></th>
+	</tr>
+{{ range $i, $line := $statement.Lines }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $line.Account }}</td>
+		<td>{{ $line.Owner }}</td>
+		<td>{{ $line.CostCenter }}</td>
+		<td>{{ $line.Project }}</td>
+		<td style="white-space: nowrap;">{{ $report.FormatCost $line.Cost }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<h3>Per cost center:</h3>
+<table>
+	<tr style="text-align:left;">
+		<th><strong>Cost center</strong></th>
+		<th><strong>Cost</strong></th>
+	</tr>
+{{ range $i, $total := $statement.CostCenters }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ if $total.CostCenter }}{{ $total.CostCenter }}{{ else }}&lt;unattributed&gt;{{ end }}</td>
+		<td style="white-space: nowrap;">{{ $report.FormatCost $total.Cost }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const departedOwnersTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>These resources are owned by people who are no longer active in the company.</h2>
+
+<p>They have been tagged with <strong>cloudsweeper-needs-owner</strong>. Please find
+new owners for the resources still needed, either by moving the accounts to them in
+the organization file, or by tagging the resources with <strong>cloudsweeper-claimed-by</strong>
+set to the username of the new owner. Resources which are not claimed in time will be
+marked for cleanup, unless whitelisted.</p>
+
+{{ range $owner := .Departed }}
+	<h3>{{ $owner.Employee.RealName }} ({{ $owner.Employee.Username }}) - {{ len $owner.Resources }} resources</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Status</strong></th>
+		</tr>
+	{{ range $orphan := $owner.Resources }}
+		<tr>
+			<td>{{ accountname $orphan.Resource.Owner }}</td>
+			<td>{{ $orphan.Category }}</td>
+			<td>{{ link $orphan.Resource }}</td>
+			<td>{{ $orphan.Resource.Location }}</td>
+			<td>{{ fdate $orphan.Resource.CreationTime "2006-01-02" }}</td>
+			<td>{{ if $orphan.Escalated }}Marked for cleanup{{ else if $orphan.Whitelisted }}Whitelisted{{ else }}Claim by {{ fdate $orphan.ClaimBy "2006-01-02" }}{{ end }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const shadowPolicyTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>{{ .ResourceCount }} additional resources in your account would be marked for cleanup under the upcoming policy.</h2>
+
+<p>The cleanup policy will soon become stricter. Nothing has been marked yet, but once the
+new policy is in effect, these resources will be marked for cleanup and deleted a few days
+later. Please remove the ones no longer needed, and whitelist the ones you want to keep.</p>
+
+<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>
+
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $instance := .Instances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $instance }}</td>
+			<td>{{ deletereason $instance }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}{{ if gpu $instance }} <strong style="color: #cc0000;">GPU</strong>{{ end }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ accucost $instance }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $image }}</td>
+			<td>{{ deletereason $image }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ accucost $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Attached to instance</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $volume }}</td>
+			<td>{{ deletereason $volume }}</td>
+			<td>{{ size $volume.SizeGB }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ yesno $volume.Attached }}</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ accucost $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $snapshot }}</td>
+			<td>{{ deletereason $snapshot }}</td>
+			<td>{{ size $snapshot.SizeGB }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>ID</strong></th>
+			<th><strong>Reason</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Files</strong></th>
+			<th><strong>Last modified</strong></th>
+			<th><strong>Monthly cost</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ link $bucket }}</td>
+			<td>{{ deletereason $bucket }}</td>
+			<td>{{ size $bucket.TotalSizeGB }}</td>
+			<td>{{ $bucket.ObjectCount }}</td>
+			<td>{{ daysrunning $bucket.LastModified }}</td>
+			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const bucketGrowthTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following buckets grew by more than {{ printf "%.0f" .Threshold }}% in size or number of objects
+in the last month. Buckets which keep growing like this can become expensive quickly, so please
+make sure that the growth is expected, e.g. by setting up lifecycle rules to expire old objects.
+</p>
+
+{{ if .OwnerID }}<p><strong>Account:</strong> {{ accountname .OwnerID }}</p>{{ end }}
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Bucket</strong></th>
+		<th><strong>Size</strong></th>
+		<th><strong>Size growth</strong></th>
+		<th><strong>Objects</strong></th>
+		<th><strong>Object growth</strong></th>
+		<th><strong>Since</strong></th>
+	</tr>
+{{ range $i, $trend := .Runaways }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $trend.Owner }}</td>
+		<td style="white-space: nowrap;">{{ $trend.ID }}</td>
+		<td style="white-space: nowrap;">{{ size $trend.Current.SizeGB }}</td>
+		<td style="white-space: nowrap;">{{ printf "%+.1f" $trend.SizeGrowth }}%</td>
+		<td style="white-space: nowrap;">{{ $trend.Current.ObjectCount }}</td>
+		<td style="white-space: nowrap;">{{ printf "%+.1f" $trend.ObjectGrowth }}%</td>
+		<td style="white-space: nowrap;">{{ fdate $trend.Previous.Recorded "2006-01-02" }}</td>
+	</tr>
+{{ end }}
+</table>
+
+{{ if gt (len .Trends) 0 }}
+	<h3>Growth of every bucket in the account</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Bucket</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Size growth</strong></th>
+			<th><strong>Objects</strong></th>
+			<th><strong>Object growth</strong></th>
+		</tr>
+	{{ range $i, $trend := .Trends }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $trend.ID }}</td>
+			<td style="white-space: nowrap;">{{ size $trend.Current.SizeGB }}</td>
+			<td style="white-space: nowrap;">{{ printf "%+.1f" $trend.SizeGrowth }}%</td>
+			<td style="white-space: nowrap;">{{ $trend.Current.ObjectCount }}</td>
+			<td style="white-space: nowrap;">{{ printf "%+.1f" $trend.ObjectGrowth }}%</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "bucket-growth" }}
+`
+
+const replyResultsTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>These are the results of the commands in your reply.</h2>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Command</strong></th>
+		<th><strong>Result</strong></th>
+	</tr>
+{{ range $i, $result := .Results }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ $result.Command }}</td>
+		<td>{{ $result.Message }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const remarkTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>The delete tag of these resources keeps being removed.</h2>
+
+<p>These resources have been marked for cleanup again at least {{ .Limit }} times, since
+their delete tag was removed every time instead of the resources being whitelisted. They
+will keep being marked until they are whitelisted, so please follow up with their owners,
+and either whitelist the resources they need or let them be cleaned up.</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Reason</strong></th>
+		<th><strong>First marked</strong></th>
+		<th><strong>Last marked</strong></th>
+		<th><strong>Marked again</strong></th>
+	</tr>
+{{ range $i, $mark := .Marks }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $mark.Account }}</td>
+		<td style="white-space: nowrap;">{{ $mark.ResourceID }}</td>
+		<td>{{ $mark.Reason }}</td>
+		<td style="white-space: nowrap;">{{ fdate $mark.FirstMarked "2006-01-02" }}</td>
+		<td style="white-space: nowrap;">{{ fdate $mark.LastMarked "2006-01-02" }}</td>
+		<td style="white-space: nowrap;">{{ $mark.Remarks }} times</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const missingTagsTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+You just created the following {{ .Creation.ResourceType }}s without all of the tags every
+resource is required to have. Please add the missing tags now, since resources without them
+can't be attributed, and will be reported as untagged until they are tagged.
+</p>
+
+<p>
+<strong>Account:</strong> {{ accountname .Creation.Account }}<br />
+<strong>Region:</strong> {{ .Creation.Region }}<br />
+<strong>Created:</strong> {{ fdate .Creation.Time "2006-01-02 15:04" }} ({{ .Creation.EventName }})<br />
+<strong>Missing tags:</strong> {{ range $i, $key := .Missing }}{{ if $i }}, {{ end }}<code>{{ $key }}</code>{{ end }}
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>ID</strong></th>
+	</tr>
+{{ range $i, $id := .Creation.IDs }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ $id }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "missing-tags" }}
+`
+
+const digestMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+These resources were left out of the emails you would otherwise have received this month, since
+together they cost too little to be worth an email on their own. They still match the rules of
+Cloudsweeper, so please review them and remove the ones no longer needed.
+</p>
+
+<p><strong>Total cost:</strong> ${{ printf "%.2f" .CostPerMonth }} per month</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Kind</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Cost/month</strong></th>
+		<th><strong>First left out</strong></th>
+	</tr>
+{{ range $i, $item := .Items }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td style="white-space: nowrap;">{{ accountname $item.Account }}</td>
+		<td style="white-space: nowrap;">{{ $item.Kind }}</td>
+		<td style="white-space: nowrap;">{{ $item.ResourceID }}</td>
+		<td style="white-space: nowrap;">{{ $item.Location }}</td>
+		<td style="white-space: nowrap;">${{ printf "%.2f" $item.CostPerMonth }}</td>
+		<td style="white-space: nowrap;">{{ fdate $item.FirstSuppressed "2006-01-02" }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+{{ unsubscribe .Owner "digest" }}
+`
@@ -7,8 +7,13 @@
 package cloudsweeper
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
 )
@@ -23,6 +28,9 @@ type Organization struct {
 	ManagerIDs  []managerID `json:"managers"`
 	Departments Departments `json:"departments"`
 	Employees   Employees   `json:"employees"`
+	// NetworkOwners are the employees responsible for the shared network,
+	// such as the transit gateways connecting the accounts
+	NetworkOwners NetworkOwners `json:"network_owners,omitempty"`
 
 	managerMapping    map[string]*Employee
 	departmentMapping map[string]*Department
@@ -34,24 +42,42 @@ type managerID struct {
 	ID string `json:"username"`
 }
 
-// Department represents a department in your org
+// Department represents a department in your org. The lead is the
+// username of the employee who receives the chargeback statement of the
+// department.
 type Department struct {
-	Number int    `json:"number"`
-	ID     string `json:"id"`
-	Name   string `json:"name"`
+	Number     int    `json:"number"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CostCenter string `json:"cost_center,omitempty"`
+	Lead       string `json:"lead,omitempty"`
 }
 
 // Departments is a list of Department
 type Departments []*Department
 
+// NetworkOwner is an employee responsible for the shared network in some
+// AWS accounts, or in every account if none are listed. Network owners
+// get the emails about the network instead of the owners of the accounts.
+type NetworkOwner struct {
+	Username    string   `json:"username"`
+	AWSAccounts []string `json:"aws_accounts,omitempty"`
+}
+
+// NetworkOwners is a list of NetworkOwner
+type NetworkOwners []*NetworkOwner
+
 // Employee represents an employee, which
 // belong to a department and has a manager. An employee can
 // also have multiple accounts and projects associated with
 // them in AWS and GCP. "Disabled" employees are employees
-// who should no longer be regarded as active in the company
+// who should no longer be regarded as active in the company.
+// The cost center of an employee overrides that of their
+// department.
 type Employee struct {
 	Username     string      `json:"username"`
 	RealName     string      `json:"real_name"`
+	Email        string      `json:"email,omitempty"`
 	ManagerID    string      `json:"manager"`
 	Manager      *Employee   `json:"-"`
 	DepartmentID string      `json:"department"`
@@ -59,6 +85,15 @@ type Employee struct {
 	Disabled     bool        `json:"disabled,omitempty"`
 	AWSAccounts  AWSAccounts `json:"aws_accounts"`
 	GCPProjects  GCPProjects `json:"gcp_projects"`
+	Accounts     Accounts    `json:"accounts,omitempty"`
+	Currency     string      `json:"currency,omitempty"`
+	CostCenter   string      `json:"cost_center,omitempty"`
+	// TimeZone is the IANA time zone, e.g. Europe/Stockholm, of the dates
+	// in emails to the employee
+	TimeZone string `json:"time_zone,omitempty"`
+	// DisabledResourceTypes are the resource types, e.g. instances, which
+	// Cloudsweeper leaves alone in all accounts of the employee
+	DisabledResourceTypes []string `json:"disabled_resource_types,omitempty"`
 }
 
 // Employees is a list of Employee
@@ -66,10 +101,14 @@ type Employees []*Employee
 
 // AWSAccount represents an account in AWS. An account
 // can have automatic cleanup enabled, indiacated by
-// the CloudsweeperEnabled attribute.
+// the CloudsweeperEnabled attribute. The name is shown
+// alongside the account number, instead of the AWS alias.
 type AWSAccount struct {
 	ID                  string `json:"id"`
+	Name                string `json:"name,omitempty"`
 	CloudsweeperEnabled bool   `json:"cloudsweeper_enabled,omitempty"`
+	CostCenter          string `json:"cost_center,omitempty"`
+	Project             string `json:"project,omitempty"`
 }
 
 // AWSAccounts is a list of AWSAccount
@@ -80,12 +119,30 @@ type AWSAccounts []*AWSAccount
 // the CloudsweeperEnabled attribute.
 type GCPProject struct {
 	ID                  string `json:"id"`
+	Name                string `json:"name,omitempty"`
 	CloudsweeperEnabled bool   `json:"cloudsweeper_enabled,omitempty"`
+	CostCenter          string `json:"cost_center,omitempty"`
+	Project             string `json:"project,omitempty"`
 }
 
 // GCPProjects is a list of GCPProject
 type GCPProjects []*GCPProject
 
+// Account represents an account in any other CSP than AWS
+// and GCP, added through cloud.RegisterProvider. The CSP
+// attribute is the name the provider was registered with.
+type Account struct {
+	CSP                 cloud.CSP `json:"csp"`
+	ID                  string    `json:"id"`
+	Name                string    `json:"name,omitempty"`
+	CloudsweeperEnabled bool      `json:"cloudsweeper_enabled,omitempty"`
+	CostCenter          string    `json:"cost_center,omitempty"`
+	Project             string    `json:"project,omitempty"`
+}
+
+// Accounts is a list of Account
+type Accounts []*Account
+
 // InitOrganization initializes an organisation from raw data,
 // e.g. the contents of a JSON file.
 func InitOrganization(orgData []byte) (*Organization, error) {
@@ -132,6 +189,114 @@ func InitOrganization(orgData []byte) (*Organization, error) {
 	return org, nil
 }
 
+var awsAccountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+var gcpProjectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+// ValidateOrganization checks raw organization data, e.g. the contents
+// of a JSON file, and returns all problems found. Unlike InitOrganization
+// it does not stop at the first problem, and it also rejects unknown
+// fields, duplicated IDs and malformed account numbers.
+func ValidateOrganization(orgData []byte) []error {
+	org := new(Organization)
+	decoder := json.NewDecoder(bytes.NewReader(orgData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(org); err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	departments := make(map[string]bool)
+	for _, department := range org.Departments {
+		if departments[department.ID] {
+			errs = append(errs, fmt.Errorf("Department %s is listed more than once", department.ID))
+		}
+		departments[department.ID] = true
+	}
+	employees := make(map[string]bool)
+	for _, employee := range org.Employees {
+		if employee.Username == "" {
+			errs = append(errs, errors.New("Employee without a username"))
+		} else if employees[employee.Username] {
+			errs = append(errs, fmt.Errorf("Employee %s is listed more than once", employee.Username))
+		}
+		employees[employee.Username] = true
+	}
+	for _, department := range org.Departments {
+		if department.Lead != "" && !employees[department.Lead] {
+			errs = append(errs, fmt.Errorf("Lead %s of department %s is not in the list of employees", department.Lead, department.ID))
+		}
+	}
+	for _, manager := range org.ManagerIDs {
+		if !employees[manager.ID] {
+			errs = append(errs, fmt.Errorf("Manager %s is not in the list of employees", manager.ID))
+		}
+	}
+	for _, owner := range org.NetworkOwners {
+		if !employees[owner.Username] {
+			errs = append(errs, fmt.Errorf("Network owner %s is not in the list of employees", owner.Username))
+		}
+		for _, account := range owner.AWSAccounts {
+			if !awsAccountIDPattern.MatchString(account) {
+				errs = append(errs, fmt.Errorf("AWS account %q of network owner %s is not a 12 digit account number", account, owner.Username))
+			}
+		}
+	}
+	accountOwners := make(map[string]string)
+	addAccount := func(kind, id, username string) {
+		key := kind + "/" + id
+		if owner, exist := accountOwners[key]; exist {
+			errs = append(errs, fmt.Errorf("%s %s belongs to both %s and %s", kind, id, owner, username))
+		}
+		accountOwners[key] = username
+	}
+	for _, employee := range org.Employees {
+		if employee.DepartmentID != "" && !departments[employee.DepartmentID] {
+			errs = append(errs, fmt.Errorf("Department %s of %s does not exist", employee.DepartmentID, employee.Username))
+		}
+		if employee.ManagerID != "" && !employees[employee.ManagerID] {
+			errs = append(errs, fmt.Errorf("Manager %s of %s is not in the list of employees", employee.ManagerID, employee.Username))
+		}
+		if employee.TimeZone != "" {
+			if _, err := time.LoadLocation(employee.TimeZone); err != nil {
+				errs = append(errs, fmt.Errorf("Time zone %q of %s is not valid", employee.TimeZone, employee.Username))
+			}
+		}
+		for _, resourceType := range employee.DisabledResourceTypes {
+			if !cloud.IsResourceType(resourceType) {
+				errs = append(errs, fmt.Errorf("Disabled resource type %q of %s is not one of %s", resourceType, employee.Username, strings.Join(cloud.ResourceTypes, ", ")))
+			}
+		}
+		for _, account := range employee.AWSAccounts {
+			if !awsAccountIDPattern.MatchString(account.ID) {
+				errs = append(errs, fmt.Errorf("AWS account %q of %s is not a 12 digit account number", account.ID, employee.Username))
+			}
+			addAccount("AWS account", account.ID, employee.Username)
+		}
+		for _, project := range employee.GCPProjects {
+			if !gcpProjectIDPattern.MatchString(project.ID) {
+				errs = append(errs, fmt.Errorf("GCP project %q of %s is not a valid project ID", project.ID, employee.Username))
+			}
+			addAccount("GCP project", project.ID, employee.Username)
+		}
+		for _, account := range employee.Accounts {
+			if account.CSP == "" || account.ID == "" {
+				errs = append(errs, fmt.Errorf("Account of %s must have both a csp and an id", employee.Username))
+				continue
+			}
+			addAccount(fmt.Sprintf("%s account", account.CSP), account.ID, employee.Username)
+		}
+	}
+	return errs
+}
+
+// CurrencyFor returns the currency code that the specified user wants
+// costs reported in, or an empty string if the user has no preference
+func (org *Organization) CurrencyFor(username string) string {
+	if employee, exist := org.employeeMapping[username]; exist {
+		return employee.Currency
+	}
+	return ""
+}
+
 // EmployeesForManager gets all the employees who has the
 // specifed manager as their manager.
 func (org *Organization) EmployeesForManager(manager *Employee) (Employees, error) {
@@ -163,6 +328,12 @@ func (org *Organization) EnabledAccounts(csp cloud.CSP) []string {
 					accounts = append(accounts, project.ID)
 				}
 			}
+		default:
+			for _, account := range employee.Accounts {
+				if account.CSP == csp && account.CloudsweeperEnabled {
+					accounts = append(accounts, account.ID)
+				}
+			}
 		}
 	}
 	return accounts
@@ -182,11 +353,133 @@ func (org *Organization) AccountToUserMapping(csp cloud.CSP) map[string]string {
 			for _, project := range employee.GCPProjects {
 				result[project.ID] = employee.Username
 			}
+		case cloud.Kubernetes:
+			// Kubernetes resources are owned by the username in the
+			// owner label of their namespace, or by their cluster
+			result[employee.Username] = employee.Username
+			for _, account := range employee.Accounts {
+				if account.CSP == csp {
+					result[account.ID] = employee.Username
+				}
+			}
+		default:
+			for _, account := range employee.Accounts {
+				if account.CSP == csp {
+					result[account.ID] = employee.Username
+				}
+			}
 		}
 	}
 	return result
 }
 
+// DisabledResourceTypes maps the accounts/projects in the specified CSP,
+// whose owner has disabled some resource types, to those types
+func (org *Organization) DisabledResourceTypes(csp cloud.CSP) map[string][]string {
+	result := make(map[string][]string)
+	employees := org.UsernameToEmployeeMapping()
+	for account, username := range org.AccountToUserMapping(csp) {
+		if employee, exist := employees[username]; exist && len(employee.DisabledResourceTypes) > 0 {
+			result[account] = employee.DisabledResourceTypes
+		}
+	}
+	return result
+}
+
+// AccountNames returns a map from the accounts/projects in the specified
+// CSP which have a friendly name in the organization to that name
+func (org *Organization) AccountNames(csp cloud.CSP) map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				if account.Name != "" {
+					result[account.ID] = account.Name
+				}
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				if project.Name != "" {
+					result[project.ID] = project.Name
+				}
+			}
+		default:
+			for _, account := range employee.Accounts {
+				if account.CSP == csp && account.Name != "" {
+					result[account.ID] = account.Name
+				}
+			}
+		}
+	}
+	return result
+}
+
+// EmailMapping returns a map from the username of every employee with an
+// email address in the organization to that address
+func (org *Organization) EmailMapping() map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		if employee.Email != "" {
+			result[employee.Username] = employee.Email
+		}
+	}
+	return result
+}
+
+// TimeZoneMapping is a helper method that returns a map of username to
+// the time zone of the employee, for every employee with a time zone
+func (org *Organization) TimeZoneMapping() map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		if employee.TimeZone != "" {
+			result[employee.Username] = employee.TimeZone
+		}
+	}
+	return result
+}
+
+// ManagerMapping is a helper method that returns a map of username to the
+// username of their manager, for every employee with a manager
+func (org *Organization) ManagerMapping() map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		if employee.Manager != nil {
+			result[employee.Username] = employee.Manager.Username
+		}
+	}
+	return result
+}
+
+// NetworkOwnersOf returns the usernames of the network owners of an AWS
+// account, or nil if the account has none
+func (org *Organization) NetworkOwnersOf(account string) []string {
+	var usernames []string
+	for _, owner := range org.NetworkOwners {
+		if len(owner.AWSAccounts) == 0 {
+			usernames = append(usernames, owner.Username)
+			continue
+		}
+		for _, ownedAccount := range owner.AWSAccounts {
+			if ownedAccount == account {
+				usernames = append(usernames, owner.Username)
+				break
+			}
+		}
+	}
+	return usernames
+}
+
+// AddManager adds an employee to the list of managers, if not already in it
+func (org *Organization) AddManager(username string) {
+	for _, manager := range org.ManagerIDs {
+		if manager.ID == username {
+			return
+		}
+	}
+	org.ManagerIDs = append(org.ManagerIDs, managerID{ID: username})
+}
+
 // UsernameToEmployeeMapping is a helper method that returns a map of username to Employee struct.
 func (org *Organization) UsernameToEmployeeMapping() map[string]*Employee {
 	return org.employeeMapping
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The events hooks are run for
+const (
+	EventPreDelete  = "pre-delete"
+	EventPostDelete = "post-delete"
+)
+
+// defaultHookTimeout is how long a hook may run if it has no timeout
+const defaultHookTimeout = 60 * time.Second
+
+// maxHookOutput is how much of the output of a failed hook is kept in
+// its error
+const maxHookOutput = 512
+
+// Hook is a webhook or local command, run before or after the resources
+// of a category are deleted. Exactly one of URL and Command is set.
+type Hook struct {
+	// URL is called with a POST request with the event as JSON. Any
+	// status but 2xx is a failure.
+	URL string `json:"url,omitempty"`
+	// Command is run with the event as JSON on stdin, and some of it in
+	// environment variables. Any exit code but 0 is a failure.
+	Command []string `json:"command,omitempty"`
+	// TimeoutSeconds is how long the hook may run before it fails,
+	// 60 seconds by default
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// HookEvent describes the resource a hook is run for
+type HookEvent struct {
+	Event    string            `json:"event"`
+	Category string            `json:"category"`
+	CSP      string            `json:"csp"`
+	Account  string            `json:"account"`
+	ID       string            `json:"id"`
+	Location string            `json:"location"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// String returns a short description of the hook, for logs and errors
+func (h *Hook) String() string {
+	if h.URL != "" {
+		return fmt.Sprintf("webhook %s", h.URL)
+	}
+	return fmt.Sprintf("command %s", strings.Join(h.Command, " "))
+}
+
+// Run runs the hook for an event, and returns an error if it fails or
+// doesn't finish in time
+func (h *Hook) Run(event HookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	timeout := defaultHookTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if h.URL != "" {
+		err = h.call(ctx, payload)
+	} else {
+		err = h.execute(ctx, event, payload)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", h, timeout)
+	}
+	return err
+}
+
+func (h *Hook) call(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned %s: %s", h, resp.Status, truncateOutput(body))
+	}
+	return nil
+}
+
+func (h *Hook) execute(ctx context.Context, event HookEvent, payload []byte) error {
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"CS_HOOK_EVENT="+event.Event,
+		"CS_RESOURCE_CATEGORY="+event.Category,
+		"CS_RESOURCE_CSP="+event.CSP,
+		"CS_RESOURCE_ACCOUNT="+event.Account,
+		"CS_RESOURCE_ID="+event.ID,
+		"CS_RESOURCE_LOCATION="+event.Location,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed, %s: %s", h, err, truncateOutput(output))
+	}
+	return nil
+}
+
+// validate returns the problems with the hook
+func (h *Hook) validate() []error {
+	errs := []error{}
+	if h == nil {
+		return []error{fmt.Errorf("empty hook")}
+	}
+	switch {
+	case h.URL == "" && len(h.Command) == 0:
+		errs = append(errs, fmt.Errorf("hook has neither a url nor a command"))
+	case h.URL != "" && len(h.Command) > 0:
+		errs = append(errs, fmt.Errorf("hook has both a url and a command"))
+	case h.URL != "":
+		parsed, err := url.Parse(h.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("hook url '%s' is not an http or https URL", h.URL))
+		}
+	case h.Command[0] == "":
+		errs = append(errs, fmt.Errorf("hook command has no program"))
+	}
+	if h.TimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("hook timeout %d is negative", h.TimeoutSeconds))
+	}
+	return errs
+}
+
+func truncateOutput(output []byte) string {
+	trimmed := strings.TrimSpace(string(output))
+	if len(trimmed) > maxHookOutput {
+		return trimmed[:maxHookOutput] + "..."
+	}
+	return trimmed
+}
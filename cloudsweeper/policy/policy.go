@@ -0,0 +1,334 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package policy describes how Cloudsweeper should act on the resources
+// it finds in each category. The policy is read from a JSON file, e.g.
+//
+//	{
+//		"categories": {
+//			"buckets": {"action": "notify"},
+//			"instances": {
+//				"rules": [{"name": "has-tag", "args": {"key": "cmdb-id"}, "negate": true}],
+//				"pre_delete": [{"command": ["/usr/local/bin/drain-host"]}],
+//				"post_delete": [{"url": "https://inventory.example.com/deleted"}]
+//			}
+//		}
+//	}
+//
+// Categories without an entry use the default action, which is to mark
+// the resources for cleanup. Rules limit which resources of a category
+// are marked or notified about, see Rule. Hooks are run before and after
+// every resource of their category is deleted, see Hook.
+//
+// With the "rego" engine, an Open Policy Agent server decides what to do
+// with every resource instead of the actions and rules, see RegoInput.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+)
+
+// Action is what Cloudsweeper does with the resources found in a category
+type Action string
+
+const (
+	// ActionMark marks resources for cleanup, so they are deleted later
+	ActionMark Action = "mark"
+	// ActionNotify only notifies the owner of the resources, every time
+	// they are found, and never marks them for cleanup
+	ActionNotify Action = "notify"
+)
+
+// The categories of resources which can be given an action
+const (
+	Instances = "instances"
+	Images    = "images"
+	Volumes   = "volumes"
+	Snapshots = "snapshots"
+	Buckets   = "buckets"
+)
+
+// Categories is a list of all known categories
+var Categories = []string{Instances, Images, Volumes, Snapshots, Buckets}
+
+// GPUInstances is the category of the idle GPU instances found by
+// gpu-review. GPU instances are instances too, and are marked by
+// mark-for-cleanup under the settings of Instances, but gpu-review looks
+// at them after a much shorter time. Its action decides if they are
+// marked or only notified about, and its rules which are looked at.
+const GPUInstances = "gpu-instances"
+
+// The categories of the resources the reviews mark and delete, such as
+// the idle file systems of file-system-review. The reviews decide which
+// of their resources are marked, so these categories only have hooks.
+const (
+	FileSystems  = "file-systems"
+	Networks     = "networks"
+	VPNs         = "vpns"
+	MLResources  = "ml-resources"
+	DataClusters = "data-clusters"
+)
+
+// ReviewCategories is a list of the categories of the reviews, which
+// only have hooks
+var ReviewCategories = []string{FileSystems, Networks, VPNs, MLResources, DataClusters}
+
+// CategoryOf returns the category of a resource, or an empty string if
+// it is of no known category
+func CategoryOf(res cloud.Resource) string {
+	switch res.(type) {
+	case cloud.Instance:
+		return Instances
+	case cloud.Image:
+		return Images
+	case cloud.Volume:
+		return Volumes
+	case cloud.Snapshot:
+		return Snapshots
+	case cloud.Bucket:
+		return Buckets
+	}
+	return ""
+}
+
+// Policy holds the settings of every category
+type Policy struct {
+	// Name and Version identify the policy in the tag of every resource
+	// marked under it. Both are optional, as the fingerprint of the policy
+	// is recorded too.
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Engine decides which resources are marked, EngineNative by default
+	Engine string `json:"engine,omitempty"`
+	// Rego tells where to evaluate the policy with EngineRego
+	Rego       *RegoSettings        `json:"rego,omitempty"`
+	Categories map[string]*Category `json:"categories"`
+}
+
+// Category holds the settings of a single category
+type Category struct {
+	Action Action `json:"action"`
+	// Rules must all match a resource for it to be marked or notified
+	// about
+	Rules []*Rule `json:"rules,omitempty"`
+	// RecentlyTaggedDays leaves resources whose tags were changed in the
+	// last number of days alone, as they are still being curated. 0 means
+	// disabled.
+	RecentlyTaggedDays int `json:"recently_tagged_days,omitempty"`
+	// PreDelete hooks are run before a resource is deleted. If any of
+	// them fails, the resource isn't deleted.
+	PreDelete []*Hook `json:"pre_delete,omitempty"`
+	// PostDelete hooks are run after a resource has been deleted
+	PostDelete []*Hook `json:"post_delete,omitempty"`
+}
+
+// Rule refers to a rule registered with filter.RegisterRule, such as
+// "has-tag", by name
+type Rule struct {
+	Name string            `json:"name"`
+	Args map[string]string `json:"args,omitempty"`
+	// Negate makes the rule match the resources it wouldn't otherwise
+	Negate bool `json:"negate,omitempty"`
+
+	rule func(cloud.Resource) bool
+}
+
+// InitPolicy will parse and validate a policy from raw JSON. Unknown
+// fields are rejected, to catch misspelled settings.
+func InitPolicy(raw []byte) (*Policy, error) {
+	pol := new(Policy)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(pol); err != nil {
+		return nil, err
+	}
+	if errs := pol.Validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return pol, nil
+}
+
+// ValidatePolicy checks a policy in raw JSON and returns all problems
+// found, instead of only the first one
+func ValidatePolicy(raw []byte) []error {
+	pol := new(Policy)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(pol); err != nil {
+		return []error{err}
+	}
+	return pol.Validate()
+}
+
+// Validate returns all problems with the policy, such as unknown
+// categories, actions and rules. Rules are built when they are
+// validated, and a rule which hasn't been built never matches.
+func (p *Policy) Validate() []error {
+	errs := []error{}
+	if p == nil {
+		return errs
+	}
+	switch p.Engine {
+	case "", EngineNative:
+	case EngineRego:
+		errs = append(errs, p.Rego.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("Unknown policy engine '%s'", p.Engine))
+	}
+	names := []string{}
+	for name := range p.Categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isCategory(name) {
+			errs = append(errs, fmt.Errorf("Unknown policy category '%s'", name))
+			continue
+		}
+		category := p.Categories[name]
+		if category == nil {
+			continue
+		}
+		switch category.Action {
+		case "", ActionMark, ActionNotify:
+		default:
+			errs = append(errs, fmt.Errorf("Unknown action '%s' for policy category '%s'", category.Action, name))
+		}
+		if p.UsesRego() && (category.Action != "" || len(category.Rules) > 0 || category.RecentlyTaggedDays != 0) {
+			errs = append(errs, fmt.Errorf("Policy category '%s' has an action, rules or recently tagged days, which the Rego policy decides instead", name))
+		}
+		if isReviewCategory(name) && (category.Action != "" || len(category.Rules) > 0 || category.RecentlyTaggedDays != 0) {
+			errs = append(errs, fmt.Errorf("Policy category '%s' can only have hooks, since its review decides what is marked", name))
+		}
+		if category.RecentlyTaggedDays < 0 {
+			errs = append(errs, fmt.Errorf("Recently tagged days %d for policy category '%s' is negative", category.RecentlyTaggedDays, name))
+		}
+		for _, rule := range category.Rules {
+			if err := rule.build(); err != nil {
+				errs = append(errs, fmt.Errorf("%s in policy category '%s'", err, name))
+			}
+		}
+		errs = append(errs, validateHooks(name, EventPreDelete, category.PreDelete)...)
+		errs = append(errs, validateHooks(name, EventPostDelete, category.PostDelete)...)
+	}
+	return errs
+}
+
+// Action returns the action of a category. Categories without an
+// action, or a nil policy, use ActionMark.
+func (p *Policy) Action(category string) Action {
+	if p == nil {
+		return ActionMark
+	}
+	settings, exist := p.Categories[category]
+	if !exist || settings == nil || settings.Action == "" {
+		return ActionMark
+	}
+	return settings.Action
+}
+
+// NotifyOnly returns true if the resources of a category should only be
+// notified about, and never marked for cleanup
+func (p *Policy) NotifyOnly(category string) bool {
+	return p.Action(category) == ActionNotify
+}
+
+// Filter returns a filter matching the resources of a category which
+// match all of its rules, and weren't tagged recently, or nil if the
+// category has neither. Whitelisted resources are matched as well.
+func (p *Policy) Filter(category string) *filter.ResourceFilter {
+	settings := p.category(category)
+	if settings == nil || (len(settings.Rules) == 0 && settings.RecentlyTaggedDays == 0) {
+		return nil
+	}
+	result := filter.New()
+	result.OverrideWhitelist = true
+	for _, rule := range settings.Rules {
+		result.AddGeneralRule(rule.matches)
+	}
+	if settings.RecentlyTaggedDays > 0 {
+		result.AddGeneralRule(filter.Negate(filter.TaggedInLastXDays(settings.RecentlyTaggedDays)))
+	}
+	return result
+}
+
+// PreDeleteHooks returns the hooks to run before a resource of a
+// category is deleted
+func (p *Policy) PreDeleteHooks(category string) []*Hook {
+	if settings := p.category(category); settings != nil {
+		return settings.PreDelete
+	}
+	return nil
+}
+
+// PostDeleteHooks returns the hooks to run after a resource of a
+// category has been deleted
+func (p *Policy) PostDeleteHooks(category string) []*Hook {
+	if settings := p.category(category); settings != nil {
+		return settings.PostDelete
+	}
+	return nil
+}
+
+func (r *Rule) build() error {
+	if r == nil {
+		return fmt.Errorf("Empty rule")
+	}
+	rule, err := filter.NewRule(r.Name, r.Args)
+	if err != nil {
+		return err
+	}
+	r.rule = rule
+	if r.Negate {
+		r.rule = filter.Negate(rule)
+	}
+	return nil
+}
+
+func (r *Rule) matches(res cloud.Resource) bool {
+	return r.rule != nil && r.rule(res)
+}
+
+func validateHooks(category, event string, hooks []*Hook) []error {
+	errs := []error{}
+	for i, hook := range hooks {
+		for _, err := range hook.validate() {
+			errs = append(errs, fmt.Errorf("Invalid %s hook %d for policy category '%s': %s", event, i+1, category, err))
+		}
+	}
+	return errs
+}
+
+func (p *Policy) category(name string) *Category {
+	if p == nil {
+		return nil
+	}
+	return p.Categories[name]
+}
+
+func isCategory(name string) bool {
+	if name == GPUInstances || isReviewCategory(name) {
+		return true
+	}
+	for _, category := range Categories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isReviewCategory(name string) bool {
+	for _, category := range ReviewCategories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+)
+
+// The engines deciding which resources are marked
+const (
+	// EngineNative marks the resources matching the thresholds, and the
+	// rules of their category
+	EngineNative = "native"
+	// EngineRego asks an Open Policy Agent server what to do with every
+	// resource
+	EngineRego = "rego"
+)
+
+// ActionSkip leaves a resource alone. It's only decided by Rego policies.
+const ActionSkip Action = "skip"
+
+// defaultRegoTimeout is how long a decision may take if the Rego settings
+// have no timeout
+const defaultRegoTimeout = 10 * time.Second
+
+// RegoSettings tells where the Rego policy is evaluated
+type RegoSettings struct {
+	// URL is the address of the Open Policy Agent server, e.g.
+	// http://localhost:8181
+	URL string `json:"url"`
+	// Path is the path of the decision in the data of the server, e.g.
+	// cloudsweeper/decision for data.cloudsweeper.decision
+	Path string `json:"path"`
+	// TimeoutSeconds is how long a decision may take, 10 seconds by
+	// default
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// RegoInput is the input a Rego policy decides on
+type RegoInput struct {
+	Category string                 `json:"category"`
+	Resource *cloud.InventoryRecord `json:"resource"`
+	// Marked is true if the native engine would mark the resource, with
+	// the reason in Reason, so a Rego policy can build on its decisions
+	Marked bool   `json:"marked"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decision is what a Rego policy decided to do with a resource. The
+// policy can return an object with an action and a reason, or only the
+// action as a string. An undefined decision is ActionSkip.
+type Decision struct {
+	Action Action `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// UsesRego returns true if the policy decides which resources are marked
+// with Rego, instead of the native engine
+func (p *Policy) UsesRego() bool {
+	return p != nil && p.Engine == EngineRego
+}
+
+// Decide asks the Open Policy Agent server what to do with a resource
+func (p *Policy) Decide(input RegoInput) (Decision, error) {
+	if !p.UsesRego() {
+		return Decision{}, fmt.Errorf("The policy doesn't use the %s engine", EngineRego)
+	}
+	payload, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return Decision{}, err
+	}
+	timeout := defaultRegoTimeout
+	if p.Rego.TimeoutSeconds > 0 {
+		timeout = time.Duration(p.Rego.TimeoutSeconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(p.Rego.dataURL(), "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Decision{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("Open Policy Agent returned %s: %s", resp.Status, truncateOutput(body))
+	}
+	var output struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return Decision{}, fmt.Errorf("Could not parse the decision: %s", err)
+	}
+	return parseDecision(output.Result)
+}
+
+func (s *RegoSettings) dataURL() string {
+	return strings.TrimSuffix(s.URL, "/") + "/v1/data/" + strings.Trim(s.Path, "/")
+}
+
+func (s *RegoSettings) validate() []error {
+	errs := []error{}
+	if s == nil {
+		return []error{fmt.Errorf("The %s engine needs the 'rego' settings", EngineRego)}
+	}
+	parsed, err := url.Parse(s.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		errs = append(errs, fmt.Errorf("Rego url '%s' is not an http or https URL", s.URL))
+	}
+	if strings.Trim(s.Path, "/") == "" {
+		errs = append(errs, fmt.Errorf("Rego settings have no path"))
+	}
+	if s.TimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("Rego timeout %d is negative", s.TimeoutSeconds))
+	}
+	return errs
+}
+
+func parseDecision(raw json.RawMessage) (Decision, error) {
+	decision := Decision{}
+	trimmed := bytes.TrimSpace(raw)
+	switch {
+	case len(trimmed) == 0 || string(trimmed) == "null":
+		return Decision{Action: ActionSkip}, nil
+	case trimmed[0] == '"':
+		if err := json.Unmarshal(trimmed, &decision.Action); err != nil {
+			return decision, err
+		}
+	default:
+		if err := json.Unmarshal(trimmed, &decision); err != nil {
+			return decision, fmt.Errorf("Could not parse the decision: %s", err)
+		}
+	}
+	switch decision.Action {
+	case ActionMark, ActionNotify, ActionSkip:
+		return decision, nil
+	default:
+		return decision, fmt.Errorf("Unknown action '%s' in decision", decision.Action)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package policytest runs a policy and thresholds against fixture
+// resources, and checks which of them would be marked for cleanup, or
+// only notified about. Fixtures are read from a YAML file, e.g.
+//
+//	tests:
+//	  - name: old unattached volumes are marked
+//	    thresholds:
+//	      clean-unattached-older-than-days: 30
+//	    resources:
+//	      - {category: volumes, id: vol-1, age_days: 40, volume_type: gp2, tags: {Name: db}}
+//	      - {category: volumes, id: vol-2, age_days: 40, volume_type: gp2, attached: true}
+//	    expect_marked: [vol-1]
+//
+// The listed IDs must be exactly the resources marked, or notified about,
+// so an empty list expects nothing to match.
+package policytest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultOwner is the account of fixture resources without an owner
+	DefaultOwner = "123456789012"
+	// DefaultLocation is the location of fixture resources without one
+	DefaultLocation = "us-east-1"
+)
+
+// Fixtures is the format of a fixture file
+type Fixtures struct {
+	Tests []*Test `yaml:"tests"`
+}
+
+// Test is a set of resources, along with the resources which are
+// expected to be marked and notified about
+type Test struct {
+	Name string `yaml:"name"`
+	// Thresholds overrides the configured thresholds in this test only
+	Thresholds     map[string]int `yaml:"thresholds,omitempty"`
+	Resources      []*Resource    `yaml:"resources"`
+	ExpectMarked   []string       `yaml:"expect_marked"`
+	ExpectNotified []string       `yaml:"expect_notified"`
+}
+
+// Resource is a fixture resource. Ages are in days before the test runs.
+type Resource struct {
+	Category     string            `yaml:"category"`
+	ID           string            `yaml:"id"`
+	Owner        string            `yaml:"owner,omitempty"`
+	CSP          cloud.CSP         `yaml:"csp,omitempty"`
+	Location     string            `yaml:"location,omitempty"`
+	Public       bool              `yaml:"public,omitempty"`
+	AgeDays      int               `yaml:"age_days"`
+	Tags         map[string]string `yaml:"tags,omitempty"`
+	InstanceType string            `yaml:"instance_type,omitempty"`
+	PricePerHour float64           `yaml:"price_per_hour,omitempty"`
+	Name         string            `yaml:"name,omitempty"`
+	SizeGB       int64             `yaml:"size_gb,omitempty"`
+	Attached     bool              `yaml:"attached,omitempty"`
+	Encrypted    bool              `yaml:"encrypted,omitempty"`
+	InUse        bool              `yaml:"in_use,omitempty"`
+	VolumeType   string            `yaml:"volume_type,omitempty"`
+	ObjectCount  int64             `yaml:"object_count,omitempty"`
+	TotalSizeGB  float64           `yaml:"total_size_gb,omitempty"`
+
+	LastUsedDaysAgo     *int `yaml:"last_used_days_ago,omitempty"`
+	LastModifiedDaysAgo *int `yaml:"last_modified_days_ago,omitempty"`
+	LastReadDaysAgo     *int `yaml:"last_read_days_ago,omitempty"`
+}
+
+// Result is the outcome of a single test
+type Result struct {
+	Name     string
+	Failures []string
+}
+
+// Passed returns true if the test had no failures
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadFixtures parses and validates fixtures from raw YAML. Unknown
+// fields are rejected, to catch misspelled settings.
+func LoadFixtures(raw []byte) (*Fixtures, error) {
+	fixtures := new(Fixtures)
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(fixtures); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(fixtures.Tests) == 0 {
+		return nil, fmt.Errorf("No tests found")
+	}
+	for i, test := range fixtures.Tests {
+		if test.Name == "" {
+			return nil, fmt.Errorf("Test %d has no name", i+1)
+		}
+		ids := make(map[string]bool)
+		for _, res := range test.Resources {
+			if res.ID == "" {
+				return nil, fmt.Errorf("Test '%s' has a resource without an ID", test.Name)
+			}
+			if ids[res.ID] {
+				return nil, fmt.Errorf("Test '%s' has more than one resource with ID %s", test.Name, res.ID)
+			}
+			ids[res.ID] = true
+			if !isCategory(res.Category) {
+				return nil, fmt.Errorf("Unknown category '%s' of %s in test '%s'", res.Category, res.ID, test.Name)
+			}
+			// The cost of volumes is looked up by their type
+			if res.Category == policy.Volumes && res.VolumeType == "" {
+				return nil, fmt.Errorf("Volume %s in test '%s' has no volume_type", res.ID, test.Name)
+			}
+		}
+		for _, id := range append(test.ExpectMarked, test.ExpectNotified...) {
+			if !ids[id] {
+				return nil, fmt.Errorf("Test '%s' expects %s, which is not one of its resources", test.Name, id)
+			}
+		}
+	}
+	return fixtures, nil
+}
+
+// Run runs every test with the specified policy and thresholds, and
+// returns the results in the same order as the tests. Nothing is tagged,
+// since the resources only exist in memory.
+func (f *Fixtures) Run(pol *policy.Policy, thresholds map[string]int) ([]*Result, error) {
+	results := []*Result{}
+	for _, test := range f.Tests {
+		testThresholds := make(map[string]int)
+		for key, value := range thresholds {
+			testThresholds[key] = value
+		}
+		for key, value := range test.Thresholds {
+			if _, exist := thresholds[key]; !exist {
+				return nil, fmt.Errorf("Unknown threshold '%s' in test '%s'", key, test.Name)
+			}
+			testThresholds[key] = value
+		}
+		marked, notifyOnly, err := cleanup.MarkForCleanup(test.inventory().Manager(), testThresholds, pol, true)
+		if err != nil {
+			return nil, err
+		}
+		result := &Result{Name: test.Name}
+		result.Failures = append(result.Failures, compare("marked", test.ExpectMarked, foundIDs(marked))...)
+		result.Failures = append(result.Failures, compare("notified about", test.ExpectNotified, foundIDs(notifyOnly))...)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// inventory converts the fixture resources to an inventory recorded now
+func (t *Test) inventory() *cloud.Inventory {
+	now := time.Now().UTC()
+	daysAgo := func(days *int) *time.Time {
+		if days == nil {
+			return nil
+		}
+		t := now.AddDate(0, 0, -*days)
+		return &t
+	}
+	inv := &cloud.Inventory{SchemaVersion: cloud.InventorySchemaVersion, Recorded: now}
+	accounts := make(map[string]*cloud.InventoryAccount)
+	for _, res := range t.Resources {
+		record := &cloud.InventoryRecord{
+			CSP:          res.CSP,
+			Owner:        res.Owner,
+			ID:           res.ID,
+			Location:     res.Location,
+			Public:       res.Public,
+			CreationTime: now.AddDate(0, 0, -res.AgeDays),
+			Tags:         copyTags(res.Tags),
+			InstanceType: res.InstanceType,
+			PricePerHour: res.PricePerHour,
+			Name:         res.Name,
+			SizeGB:       res.SizeGB,
+			Attached:     res.Attached,
+			Encrypted:    res.Encrypted,
+			InUse:        res.InUse,
+			VolumeType:   res.VolumeType,
+			LastUsed:     daysAgo(res.LastUsedDaysAgo),
+			LastModified: daysAgo(res.LastModifiedDaysAgo),
+			LastRead:     daysAgo(res.LastReadDaysAgo),
+			ObjectCount:  res.ObjectCount,
+			TotalSizeGB:  res.TotalSizeGB,
+		}
+		if record.CSP == "" {
+			record.CSP = cloud.AWS
+		}
+		if record.Owner == "" {
+			record.Owner = DefaultOwner
+		}
+		if record.Location == "" {
+			record.Location = DefaultLocation
+		}
+		account, exist := accounts[record.Owner]
+		if !exist {
+			account = &cloud.InventoryAccount{Owner: record.Owner}
+			accounts[record.Owner] = account
+			inv.Accounts = append(inv.Accounts, account)
+		}
+		switch res.Category {
+		case policy.Instances:
+			account.Instances = append(account.Instances, record)
+		case policy.Images:
+			account.Images = append(account.Images, record)
+		case policy.Volumes:
+			account.Volumes = append(account.Volumes, record)
+		case policy.Snapshots:
+			account.Snapshots = append(account.Snapshots, record)
+		case policy.Buckets:
+			account.Buckets = append(account.Buckets, record)
+		}
+	}
+	return inv
+}
+
+// compare returns a failure for every resource which was expected but
+// not found, or found but not expected
+func compare(what string, expected []string, found map[string]bool) []string {
+	failures := []string{}
+	expectedIDs := make(map[string]bool)
+	for _, id := range expected {
+		expectedIDs[id] = true
+		if !found[id] {
+			failures = append(failures, fmt.Sprintf("%s was expected to be %s, but wasn't", id, what))
+		}
+	}
+	unexpected := []string{}
+	for id := range found {
+		if !expectedIDs[id] {
+			unexpected = append(unexpected, id)
+		}
+	}
+	sort.Strings(unexpected)
+	for _, id := range unexpected {
+		failures = append(failures, fmt.Sprintf("%s was %s, but wasn't expected to be", id, what))
+	}
+	return failures
+}
+
+func foundIDs(found map[string]*cloud.AllResourceCollection) map[string]bool {
+	ids := make(map[string]bool)
+	for _, res := range found {
+		for _, inst := range res.Instances {
+			ids[inst.ID()] = true
+		}
+		for _, img := range res.Images {
+			ids[img.ID()] = true
+		}
+		for _, vol := range res.Volumes {
+			ids[vol.ID()] = true
+		}
+		for _, snap := range res.Snapshots {
+			ids[snap.ID()] = true
+		}
+		for _, buck := range res.Buckets {
+			ids[buck.ID()] = true
+		}
+	}
+	return ids
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range tags {
+		result[key] = value
+	}
+	return result
+}
+
+func isCategory(name string) bool {
+	for _, category := range policy.Categories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policytest
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// thresholds are the default thresholds of the configuration
+var thresholds = map[string]int{
+	"clean-untagged-older-than-days":   30,
+	"clean-instances-older-than-days":  182,
+	"clean-images-older-than-days":     182,
+	"clean-snapshots-older-than-days":  182,
+	"clean-unattached-older-than-days": 30,
+	"clean-bucket-not-modified-days":   182,
+	"clean-bucket-older-than-days":     7,
+	"clean-keep-n-component-images":    2,
+}
+
+func TestExampleFixtures(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../policy-tests.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures, err := LoadFixtures(raw)
+	if err != nil {
+		t.Fatalf("Could not load the example fixtures: %s", err)
+	}
+	results, err := fixtures.Run(nil, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if !result.Passed() {
+			t.Errorf("Example test '%s' failed: %v", result.Name, result.Failures)
+		}
+	}
+}
+
+func TestNotifyOnlyFixtures(t *testing.T) {
+	fixtures, err := LoadFixtures([]byte(`
+tests:
+  - name: buckets are only notified about
+    resources:
+      - {category: buckets, id: bucket-stale, age_days: 400, last_modified_days_ago: 200}
+      - {category: volumes, id: vol-old, age_days: 40, volume_type: gp2}
+    expect_marked: [vol-old]
+    expect_notified: [bucket-stale]
+  - name: failing expectations are reported
+    resources:
+      - {category: volumes, id: vol-new, age_days: 10, volume_type: gp2}
+    expect_marked: [vol-new]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pol, err := policy.InitPolicy([]byte(`{"categories": {"buckets": {"action": "notify"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := fixtures.Run(pol, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Passed() {
+		t.Errorf("Test '%s' failed: %v", results[0].Name, results[0].Failures)
+	}
+	if results[1].Passed() || len(results[1].Failures) != 1 {
+		t.Errorf("Expected one failure of '%s', got %v", results[1].Name, results[1].Failures)
+	}
+}
+
+func TestInvalidFixtures(t *testing.T) {
+	invalid := map[string]string{
+		"empty":            ``,
+		"unknown field":    "tests:\n  - name: typo\n    resources: []\n    expect_markd: []\n",
+		"unknown category": "tests:\n  - name: disks\n    resources:\n      - {category: disks, id: disk-1}\n",
+		"unknown expected": "tests:\n  - name: missing\n    resources: []\n    expect_marked: [vol-1]\n",
+		"duplicate ID":     "tests:\n  - name: twice\n    resources:\n      - {category: images, id: ami-1}\n      - {category: images, id: ami-1}\n",
+	}
+	for name, raw := range invalid {
+		if _, err := LoadFixtures([]byte(raw)); err == nil {
+			t.Errorf("Fixtures with %s were loaded", name)
+		}
+	}
+	fixtures, err := LoadFixtures([]byte("tests:\n  - name: threshold\n    thresholds: {clean-everything-days: 1}\n    resources: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fixtures.Run(nil, thresholds); err == nil {
+		t.Error("Fixtures with an unknown threshold were run")
+	}
+}
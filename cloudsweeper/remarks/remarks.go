@@ -0,0 +1,144 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package remarks keeps track of resources which are marked for cleanup
+// over and over again. Resources being marked are only selected if they
+// aren't tagged for deletion already, so a resource which is marked again
+// had its delete tag removed without being whitelisted. Without tracking,
+// that could go on forever without anyone noticing.
+package remarks
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// keepDays is how long a resource which isn't marked again is kept in
+// the history, so that deleted and whitelisted resources are eventually
+// forgotten
+const keepDays = 365
+
+// Mark is a resource which has been marked for cleanup
+type Mark struct {
+	Account    string `json:"account"`
+	ResourceID string `json:"resource_id"`
+	Reason     string `json:"reason,omitempty"`
+	// Policy is the version of the policy the resource was last marked
+	// under
+	Policy      string    `json:"policy,omitempty"`
+	FirstMarked time.Time `json:"first_marked"`
+	LastMarked  time.Time `json:"last_marked"`
+	// Remarks is how many times the resource has been marked again
+	// since it was first marked
+	Remarks int `json:"remarks"`
+}
+
+// History is the format of the remark file. It's safe to use from several
+// goroutines.
+type History struct {
+	Marks []*Mark `json:"marks"`
+
+	mutex sync.Mutex
+}
+
+// ReadHistory reads a history written by Write
+func ReadHistory(r io.Reader) (*History, error) {
+	h := &History{}
+	if err := json.NewDecoder(r).Decode(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Write writes the history as JSON, sorted by account and resource ID.
+// Resources not marked for about a year are left out.
+func (h *History) Write(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	since := time.Now().AddDate(0, 0, -keepDays)
+	marks := []*Mark{}
+	for _, mark := range h.Marks {
+		if mark.LastMarked.After(since) {
+			marks = append(marks, mark)
+		}
+	}
+	h.Marks = marks
+	sortMarks(h.Marks)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(h)
+}
+
+// Marked records that a resource was tagged for deletion under a version
+// of the policy, and returns how many times it has been marked again since
+// it was first marked. Marking under another version of the policy than
+// last time isn't counted, since outdated marks are removed on purpose to
+// evaluate the resources under the new policy.
+func (h *History) Marked(account, id, reason, policy string, now time.Time) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now = now.UTC()
+	for _, mark := range h.Marks {
+		if mark.Account == account && mark.ResourceID == id {
+			if mark.Policy == "" || mark.Policy == policy {
+				mark.Remarks++
+			}
+			mark.LastMarked = now
+			mark.Reason = reason
+			mark.Policy = policy
+			return mark.Remarks
+		}
+	}
+	h.Marks = append(h.Marks, &Mark{
+		Account:     account,
+		ResourceID:  id,
+		Reason:      reason,
+		Policy:      policy,
+		FirstMarked: now,
+		LastMarked:  now,
+	})
+	return 0
+}
+
+// Forget removes a resource from the history, e.g. once it's whitelisted
+func (h *History) Forget(account, id string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, mark := range h.Marks {
+		if mark.Account == account && mark.ResourceID == id {
+			h.Marks = append(h.Marks[:i], h.Marks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Escalated returns the resources which have been marked again at least
+// limit times, sorted by account and resource ID. Nothing is escalated if
+// the limit is 0.
+func (h *History) Escalated(limit int) []*Mark {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	result := []*Mark{}
+	if limit <= 0 {
+		return result
+	}
+	for _, mark := range h.Marks {
+		if mark.Remarks >= limit {
+			result = append(result, mark)
+		}
+	}
+	sortMarks(result)
+	return result
+}
+
+func sortMarks(marks []*Mark) {
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].Account != marks[j].Account {
+			return marks[i].Account < marks[j].Account
+		}
+		return marks[i].ResourceID < marks[j].ResourceID
+	})
+}
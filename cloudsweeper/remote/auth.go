@@ -0,0 +1,72 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package remote
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const bearerPrefix = "Bearer "
+
+// authenticatesClients returns true if clients need a certificate or a
+// token to use the API
+func (s *Server) authenticatesClients() bool {
+	if s.Token != "" {
+		return true
+	}
+	return s.TLS != nil && s.TLS.ClientAuth == tls.RequireAndVerifyClientCert
+}
+
+// authorize returns an Unauthenticated error unless the request carries
+// the token of the server, if it has one. Client certificates are
+// already verified by the TLS handshake.
+func (s *Server) authorize(ctx context.Context) error {
+	if s.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(bearerPrefix+s.Token)) == 1 {
+			return nil
+		}
+	}
+	return grpcstatus.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (s *Server) authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// isLoopback returns true if the address only listens for connections
+// from the same host. An address without a host listens on every
+// interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
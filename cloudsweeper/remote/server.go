@@ -0,0 +1,289 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package remote serves the gRPC API of Cloudsweeper, defined in
+// remote.proto, so that a control plane can stream discovered resources,
+// plan what would be marked, and run commands with typed results. Emails
+// are never sent for remote requests, the outcome is only streamed back
+// to the client.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// running is set while a run is in progress in any server of the process,
+// since the options of the cleanup package are shared by the whole process
+var running int32
+
+// Server implements the Sweeper service
+type Server struct {
+	// NewManager builds the resource manager of a request, for the
+	// requested CSP, or the configured one if empty, and limited to the
+	// requested accounts, or all accounts if none were requested. The
+	// manager should stop listing resources once ctx is done.
+	NewManager func(ctx context.Context, csp string, accounts []string) (cloud.ResourceManager, error)
+	// Thresholds returns the thresholds used to plan and mark
+	Thresholds func() map[string]int
+	// Policy returns the policy used to plan and mark. Nil means every
+	// category is marked.
+	Policy func() *policy.Policy
+	// Prepare is called before every request, with Lock held, e.g. to
+	// load the disputed resources. Nil means nothing is prepared.
+	Prepare func()
+	// Lock is held while handling a request, since runs share the state
+	// of the cleanup and status packages. Nil means a lock of its own.
+	Lock sync.Locker
+	// FailOn is the fail-on setting the exit code of runs is based on
+	FailOn string
+	// TLS serves the API over TLS. Clients are authenticated by their
+	// certificates if its ClientAuth is tls.RequireAndVerifyClientCert.
+	// Nil means the API is served in clear text.
+	TLS *tls.Config
+	// Token is the bearer token clients must send in the authorization
+	// metadata of every request. Empty means no token is required.
+	Token string
+
+	ownLock sync.Mutex
+}
+
+// ListenAndServe serves the Sweeper service on the TCP address until
+// listening fails. Since any client can run cleanup, it refuses to serve
+// on other than a loopback address unless clients are authenticated,
+// by certificate or by token.
+func ListenAndServe(address string, srv *Server) error {
+	if !srv.authenticatesClients() && !isLoopback(address) {
+		return fmt.Errorf("Refusing to serve gRPC on %s without authenticating clients, set a token or client certificates, or listen on a loopback address", address)
+	}
+	if srv.Token != "" && srv.TLS == nil && !isLoopback(address) {
+		log.Printf("Warning: the gRPC token is sent in clear text to %s, since the API isn't served over TLS", address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(srv.authorizeUnary),
+		grpc.StreamInterceptor(srv.authorizeStream),
+	}
+	if srv.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(srv.TLS)))
+	}
+	grpcServer := grpc.NewServer(options...)
+	RegisterSweeperServer(grpcServer, srv)
+	log.Printf("Serving gRPC on %s", listener.Addr())
+	return grpcServer.Serve(listener)
+}
+
+func (s *Server) lock() func() {
+	locker := s.Lock
+	if locker == nil {
+		locker = &s.ownLock
+	}
+	locker.Lock()
+	if s.Prepare != nil {
+		s.Prepare()
+	}
+	return locker.Unlock
+}
+
+func (s *Server) manager(ctx context.Context, csp string, accounts []string) (cloud.ResourceManager, error) {
+	mngr, err := s.NewManager(ctx, csp, accounts)
+	if err != nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	return mngr, nil
+}
+
+// Discover streams every resource as soon as it has been discovered
+func (s *Server) Discover(req *DiscoverRequest, stream Sweeper_DiscoverServer) error {
+	defer s.lock()()
+	mngr, err := s.manager(stream.Context(), req.Csp, req.Accounts)
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	mngr.ForEachResource(func(res cloud.Resource) {
+		if sendErr == nil {
+			sendErr = stream.Send(toResource(res))
+		}
+	})
+	return sendErr
+}
+
+// Plan returns what mark-for-cleanup would mark, without tagging anything
+func (s *Server) Plan(ctx context.Context, req *PlanRequest) (*Plan, error) {
+	defer s.lock()()
+	mngr, err := s.manager(ctx, req.Csp, req.Accounts)
+	if err != nil {
+		return nil, err
+	}
+	marked, notifyOnly, err := cleanup.MarkForCleanup(mngr, s.Thresholds(), s.Policy(), true)
+	if err != nil {
+		return nil, grpcstatus.Error(codes.FailedPrecondition, err.Error())
+	}
+	plan := &Plan{}
+	for _, owner := range sortedOwners(marked) {
+		for _, res := range marked[owner].Resources() {
+			plan.Marked = append(plan.Marked, &PlannedResource{
+				Resource: toResource(res),
+				Reason:   cleanup.DeleteReason(res),
+				CostUsd:  cleanup.ResourceCost(res),
+			})
+		}
+	}
+	for _, owner := range sortedOwners(notifyOnly) {
+		for _, res := range notifyOnly[owner].Resources() {
+			plan.NotifyOnly = append(plan.NotifyOnly, toResource(res))
+		}
+	}
+	return plan, nil
+}
+
+// Run runs a command, and streams an event for every resource acted on,
+// followed by the summary of the run. Runs can't overlap, since they set
+// the options of the cleanup package, so a run requested while another
+// is in progress is refused.
+func (s *Server) Run(req *RunRequest, stream Sweeper_RunServer) error {
+	if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+		return grpcstatus.Error(codes.Aborted, "another run is in progress, try again once it's finished")
+	}
+	defer atomic.StoreInt32(&running, 0)
+	defer s.lock()()
+	mngr, err := s.manager(stream.Context(), req.Csp, req.Accounts)
+	if err != nil {
+		return err
+	}
+	status.Reset()
+	cloud.ResetMetrics()
+
+	// Progress is reported one event at a time, and a client which went
+	// away only stops the events, the run finishes what it started
+	var sendErr error
+	previous := cleanup.CurrentOptions()
+	opts := previous
+	opts.Progress = func(event cleanup.ProgressEvent) {
+		if sendErr == nil {
+			sendErr = stream.Send(&RunEvent{Event: &RunEvent_Progress{Progress: toProgress(event)}})
+		}
+	}
+	cleanup.SetOptions(opts)
+	defer cleanup.SetOptions(previous)
+
+	log.Printf("Running remote command %s (dry run: %t)", req.Command, req.DryRun)
+	switch req.Command {
+	case Command_MARK_FOR_CLEANUP:
+		if _, _, err := cleanup.MarkForCleanup(mngr, s.Thresholds(), s.Policy(), req.DryRun); err != nil {
+			return grpcstatus.Error(codes.FailedPrecondition, err.Error())
+		}
+	case Command_CLEANUP:
+		if _, frozen := cleanup.ActiveFreeze(time.Now()); frozen {
+			cleanup.PostponeFrozenMarks(mngr, req.DryRun)
+			break
+		}
+		if req.DryRun {
+			return grpcstatus.Error(codes.InvalidArgument, "cleanup can't be run as a dry run")
+		}
+		cleanup.PerformCleanup(mngr)
+	case Command_RESET:
+		if req.DryRun {
+			return grpcstatus.Error(codes.InvalidArgument, "reset can't be run as a dry run")
+		}
+		cleanup.ResetCloudsweeper(mngr)
+	default:
+		return grpcstatus.Error(codes.InvalidArgument, fmt.Sprintf("unknown command %s", req.Command))
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	log.Printf("Finished remote command %s (%s)", req.Command, status.Summary())
+	return stream.Send(&RunEvent{Event: &RunEvent_Summary{Summary: &RunSummary{
+		DiscoveryFailures: int32(status.Count(status.DiscoveryFailure)),
+		ActionFailures:    int32(status.Count(status.ActionFailure)),
+		Warnings:          int32(status.Count(status.Warning)),
+		ExitCode:          int32(status.ExitCode(s.FailOn)),
+		Summary:           status.Summary(),
+	}}})
+}
+
+func toResource(res cloud.Resource) *Resource {
+	result := &Resource{
+		Csp:         string(res.CSP()),
+		Owner:       res.Owner(),
+		AccountName: cloud.AccountName(res.Owner()),
+		Id:          res.ID(),
+		Type:        resourceType(res),
+		Location:    res.Location(),
+		Public:      res.Public(),
+		Tags:        res.Tags(),
+	}
+	if created, err := ptypes.TimestampProto(res.CreationTime()); err == nil {
+		result.CreationTime = created
+	}
+	return result
+}
+
+func toProgress(event cleanup.ProgressEvent) *ResourceProgress {
+	progress := &ResourceProgress{
+		Resource: toResource(event.Resource),
+		DryRun:   event.DryRun,
+		Time:     ptypes.TimestampNow(),
+	}
+	switch event.Action {
+	case cleanup.ActionMark:
+		progress.Action = Action_MARK
+	case cleanup.ActionDelete:
+		progress.Action = Action_DELETE
+	case cleanup.ActionUnmark:
+		progress.Action = Action_UNMARK
+	}
+	if event.Err != nil {
+		progress.Error = event.Err.Error()
+	}
+	return progress
+}
+
+func resourceType(res cloud.Resource) ResourceType {
+	switch res.(type) {
+	case cloud.Instance:
+		return ResourceType_INSTANCE
+	case cloud.Image:
+		return ResourceType_IMAGE
+	case cloud.Volume:
+		return ResourceType_VOLUME
+	case cloud.Snapshot:
+		return ResourceType_SNAPSHOT
+	case cloud.Bucket:
+		return ResourceType_BUCKET
+	}
+	return ResourceType_RESOURCE_TYPE_UNSPECIFIED
+}
+
+// sortedOwners returns the accounts of the collections in order, so the
+// results are the same every time
+func sortedOwners(collections map[string]*cloud.AllResourceCollection) []string {
+	owners := []string{}
+	for owner := range collections {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	return owners
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package replies
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Mailbox holds received replies, which are removed once processed
+type Mailbox interface {
+	// Keys returns the keys of every message in the mailbox
+	Keys() ([]string, error)
+	// Read returns the raw message with the specified key
+	Read(key string) (io.ReadCloser, error)
+	// Remove removes the message with the specified key
+	Remove(key string) error
+}
+
+// s3Mailbox reads the replies that SES stores in an S3 bucket, using an
+// SES receipt rule with an S3 action
+type s3Mailbox struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3Mailbox returns a mailbox with the messages in the specified S3
+// bucket whose keys start with the prefix
+func NewS3Mailbox(bucket, prefix, region string) Mailbox {
+	sess := session.Must(session.NewSession())
+	client := s3.New(sess, &aws.Config{Region: aws.String(region)})
+	return &s3Mailbox{client, bucket, prefix}
+}
+
+func (m *s3Mailbox) Keys() ([]string, error) {
+	keys := []string{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(m.bucket),
+		Prefix: aws.String(m.prefix),
+	}
+	err := m.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			// SES writes an empty object to check that it has access
+			if aws.Int64Value(object.Size) > 0 {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+		}
+		return true
+	})
+	return keys, err
+}
+
+func (m *s3Mailbox) Read(key string) (io.ReadCloser, error) {
+	output, err := m.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(m.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (m *s3Mailbox) Remove(key string) error {
+	_, err := m.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(m.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package replies processes replies to notification emails. Owners can
+// reply with commands to postpone the deletion of their resources, to
+// protect them from cleanup, or to dispute that they own them, instead of
+// tagging the resources themselves.
+package replies
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The commands which can be sent in a reply
+const (
+	ActionExtend  = "EXTEND"
+	ActionProtect = "PROTECT"
+	ActionDispute = "DISPUTE"
+)
+
+// commandPattern matches a command on a line of its own, e.g.
+// "EXTEND vol-123 14d", "PROTECT i-456 reason: perf test" or
+// "DISPUTE snap-789 reason: not mine"
+var commandPattern = regexp.MustCompile(`(?i)^\s*(EXTEND|PROTECT|DISPUTE)\s+(\S+)(?:\s+(\d+)d)?(?:\s+reason:\s*(.*?))?\s*$`)
+
+// Command is a single command in a reply
+type Command struct {
+	Action     string
+	ResourceID string
+	// Days is how long to extend by, or zero for the default
+	Days   int
+	Reason string
+	// Line is the command as written in the reply
+	Line string
+}
+
+func (c Command) String() string {
+	return c.Line
+}
+
+// Message is a parsed reply
+type Message struct {
+	From string
+	// Authenticated is true if the receiving mail server verified that
+	// the message was sent by the domain of the sender, with DMARC, or
+	// with DKIM or SPF aligned to the domain of the sender
+	Authenticated bool
+	Commands      []Command
+}
+
+// ParseMessage parses a raw email, as stored by the receiving mail server,
+// and returns the sender and the commands in the text of the reply. The
+// authserv-id identifies the Authentication-Results added by the
+// receiving mail server, e.g. amazonses.com.
+func ParseMessage(r io.Reader, authServID string) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sender: %s", err)
+	}
+	body, err := textBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		From:          strings.ToLower(from.Address),
+		Authenticated: authenticated(msg.Header, from.Address, authServID),
+		Commands:      ParseCommands(body),
+	}, nil
+}
+
+// ParseCommands returns the commands in the text of a reply. Quoted
+// lines, such as the notification being replied to, are ignored.
+func ParseCommands(text string) []Command {
+	commands := []Command{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		match := commandPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		days := 0
+		if match[3] != "" {
+			days, _ = strconv.Atoi(match[3])
+		}
+		commands = append(commands, Command{
+			Action:     strings.ToUpper(match[1]),
+			ResourceID: match[2],
+			Days:       days,
+			Reason:     match[4],
+			Line:       line,
+		})
+	}
+	return commands
+}
+
+// authenticated checks the verdicts of the receiving mail server. SES
+// adds the spam and virus verdicts, and the results of the DMARC, SPF and
+// DKIM checks in Authentication-Results. Only the topmost results are
+// looked at, and only if they carry the authserv-id of the receiving
+// server, since the sender can add results of its own further down. The
+// message is authenticated if DMARC passed, or DKIM or SPF passed for the
+// domain of the sender.
+func authenticated(header mail.Header, from, authServID string) bool {
+	for _, verdict := range []string{"X-SES-Spam-Verdict", "X-SES-Virus-Verdict"} {
+		if value := header.Get(verdict); value != "" && !strings.EqualFold(value, "PASS") {
+			return false
+		}
+	}
+	results := header["Authentication-Results"]
+	if len(results) == 0 || authServID == "" {
+		return false
+	}
+	resinfos := strings.Split(strings.ToLower(resultComment.ReplaceAllString(results[0], " ")), ";")
+	if id := strings.Fields(resinfos[0]); len(id) == 0 || id[0] != strings.ToLower(authServID) {
+		return false
+	}
+	fromDomain := domainOf(from)
+	for _, resinfo := range resinfos[1:] {
+		fields := strings.Fields(resinfo)
+		if len(fields) == 0 {
+			continue
+		}
+		properties := make(map[string]string)
+		for _, field := range fields[1:] {
+			if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+				properties[parts[0]] = strings.Trim(parts[1], `"`)
+			}
+		}
+		switch fields[0] {
+		case "dmarc=pass":
+			return true
+		case "dkim=pass":
+			if alignedDomain(properties["header.d"], fromDomain) {
+				return true
+			}
+		case "spf=pass":
+			if alignedDomain(domainOf(properties["smtp.mailfrom"]), fromDomain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resultComment matches a comment in Authentication-Results, such as
+// "(spfCheck: domain of example.com designates 192.0.2.1 as permitted sender)"
+var resultComment = regexp.MustCompile(`\([^)]*\)`)
+
+// alignedDomain checks if a domain verified by DKIM or SPF is the domain
+// of the sender, or a parent or subdomain of it
+func alignedDomain(domain, fromDomain string) bool {
+	if domain == "" || fromDomain == "" {
+		return false
+	}
+	return domain == fromDomain || strings.HasSuffix(fromDomain, "."+domain) || strings.HasSuffix(domain, "."+fromDomain)
+}
+
+// domainOf returns the domain of an email address, or the value itself
+// if it's only a domain
+func domainOf(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// textBody returns the plain text of a message body, which can be a
+// multipart message with a plain text part
+func textBody(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if contentType == "" || err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return "", errors.New("No plain text in message")
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := textBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("Unsupported content type %s", mediaType)
+	}
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
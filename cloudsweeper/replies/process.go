@@ -0,0 +1,186 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package replies
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/disputes"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/selfservice"
+)
+
+// Result is the outcome of a single command
+type Result struct {
+	Command Command
+	Applied bool
+	Message string
+}
+
+// Processor applies the commands in replies to the resources of a
+// resource manager
+type Processor struct {
+	mngr         cloud.ResourceManager
+	org          *cs.Organization
+	accountUsers map[string]string
+	senders      map[string]*cs.Employee
+	defaultDays  int
+	maxDays      int
+	disputes     *disputes.Queue
+	dryRun       bool
+
+	// resources is every resource of the manager by ID, listed the first
+	// time a command needs it
+	resources map[string]cloud.Resource
+}
+
+// NewProcessor returns a processor for the resources of the manager. The
+// email address of an employee is the one in the organization, or else
+// their username at the email domain. Resources are extended by the
+// default number of days, unless the command says otherwise, and by at
+// most the maximum number of days. Disputed
+// resources are put in the queue. In a dry run commands are validated,
+// but nothing is tagged or queued.
+func NewProcessor(mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, emailDomain string, defaultDays, maxDays int, queue *disputes.Queue, dryRun bool) *Processor {
+	senders := make(map[string]*cs.Employee)
+	for _, employee := range org.Employees {
+		address := employee.Email
+		if address == "" {
+			address = fmt.Sprintf("%s@%s", employee.Username, emailDomain)
+		}
+		senders[strings.ToLower(address)] = employee
+	}
+	return &Processor{
+		mngr:         mngr,
+		org:          org,
+		accountUsers: org.AccountToUserMapping(csp),
+		senders:      senders,
+		defaultDays:  defaultDays,
+		maxDays:      maxDays,
+		disputes:     queue,
+		dryRun:       dryRun,
+	}
+}
+
+// Sender returns the active employee who sent the message. Messages which
+// weren't authenticated by the receiving mail server are rejected, since
+// the sender could be forged.
+func (p *Processor) Sender(msg *Message) (*cs.Employee, error) {
+	if !msg.Authenticated {
+		return nil, fmt.Errorf("Message from %s was not authenticated by the mail server", msg.From)
+	}
+	employee, exist := p.senders[msg.From]
+	if !exist {
+		return nil, fmt.Errorf("%s is not an employee in the organization", msg.From)
+	}
+	if employee.Disabled {
+		return nil, fmt.Errorf("%s has left the organization", employee.Username)
+	}
+	return employee, nil
+}
+
+// Process applies the commands in a message from the specified sender.
+// Only resources in accounts owned by the sender, or by employees they
+// manage, can be changed.
+func (p *Processor) Process(sender *cs.Employee, msg *Message) []Result {
+	results := []Result{}
+	for _, command := range msg.Commands {
+		results = append(results, p.apply(sender, command))
+	}
+	return results
+}
+
+func (p *Processor) apply(sender *cs.Employee, command Command) Result {
+	result := Result{Command: command}
+	res, exist := p.resource(command.ResourceID)
+	if !exist || !p.mayChange(sender, res) {
+		result.Message = fmt.Sprintf("Could not find %s in your accounts", command.ResourceID)
+		return result
+	}
+	switch command.Action {
+	case ActionExtend:
+		days := command.Days
+		if days == 0 {
+			days = p.defaultDays
+		}
+		if days > p.maxDays {
+			// Owners can't postpone deletion past what the policy allows
+			result.Message = fmt.Sprintf("Could not postpone the deletion of %s by %d days, it can be postponed by at most %d days at a time", res.ID(), days, p.maxDays)
+			return result
+		}
+		if p.dryRun {
+			result.Message = fmt.Sprintf("Would postpone the deletion of %s by %d days", res.ID(), days)
+			return result
+		}
+		deleteAt, err := selfservice.ExtendResource(res, days)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		result.Applied = true
+		result.Message = fmt.Sprintf("%s will now be deleted at %s", res.ID(), deleteAt.Format(time.RFC3339))
+	case ActionProtect:
+		if p.dryRun {
+			result.Message = fmt.Sprintf("Would protect %s from cleanup", res.ID())
+			return result
+		}
+		if err := selfservice.ProtectResource(res, command.Reason); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		result.Applied = true
+		result.Message = fmt.Sprintf("%s is now protected from cleanup", res.ID())
+	case ActionDispute:
+		if p.dryRun {
+			result.Message = fmt.Sprintf("Would put %s in the review queue of disputed resources", res.ID())
+			return result
+		}
+		added := p.disputes.Add(&disputes.Dispute{
+			ResourceID: res.ID(),
+			Account:    res.Owner(),
+			DisputedBy: sender.Username,
+			Reason:     command.Reason,
+			DisputedAt: time.Now(),
+		})
+		if !added {
+			result.Message = fmt.Sprintf("%s is already in the review queue of disputed resources", res.ID())
+			return result
+		}
+		result.Applied = true
+		result.Message = fmt.Sprintf("%s will not be cleaned up until an operator assigns it to its owner", res.ID())
+	default:
+		result.Message = fmt.Sprintf("Unknown command %s", command.Action)
+	}
+	return result
+}
+
+// mayChange checks if the sender owns the account of the resource, or
+// manages its owner
+func (p *Processor) mayChange(sender *cs.Employee, res cloud.Resource) bool {
+	owner, exist := p.org.UsernameToEmployeeMapping()[p.accountUsers[res.Owner()]]
+	if !exist {
+		return false
+	}
+	return owner.Username == sender.Username || (owner.Manager != nil && owner.Manager.Username == sender.Username)
+}
+
+func (p *Processor) resource(id string) (cloud.Resource, bool) {
+	if p.resources == nil {
+		p.resources = make(map[string]cloud.Resource)
+		var resourcesMutex sync.Mutex
+		p.mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+			resourcesMutex.Lock()
+			defer resourcesMutex.Unlock()
+			for _, r := range res.Resources() {
+				p.resources[r.ID()] = r
+			}
+		})
+	}
+	res, exist := p.resources[id]
+	return res, exist
+}
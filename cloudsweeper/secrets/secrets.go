@@ -0,0 +1,148 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package secrets resolves config values which refer to secrets stored
+// in AWS Secrets Manager or the SSM Parameter Store, so that secrets such
+// as the SMTP password never have to be written to the config file:
+//
+//	CS_SMTP_PASSWORD: secretsmanager://cloudsweeper/smtp#password
+//	CS_TAG_SIGNING_KEY: ssm:///cloudsweeper/tag-signing-key
+//
+// A Secrets Manager secret is referred to by name or ARN, optionally
+// followed by # and a key to read from a secret holding a JSON object.
+// An SSM parameter is referred to by name or ARN, and SecureString
+// parameters are decrypted. Secrets are read with the credentials
+// Cloudsweeper itself runs with, never with the ones of the accounts.
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const (
+	secretsManagerScheme = "secretsmanager://"
+	ssmScheme            = "ssm://"
+
+	// cacheDuration is how long a resolved secret is kept, so that
+	// rotated secrets are picked up by a long running serve
+	cacheDuration = time.Hour
+	// defaultRegion is used for secrets referred to by name, if no
+	// region is configured for the AWS SDK
+	defaultRegion = "us-west-2"
+)
+
+type cachedSecret struct {
+	value    string
+	resolved time.Time
+}
+
+var (
+	cache      = make(map[string]*cachedSecret)
+	cacheMutex sync.Mutex
+)
+
+// IsReference returns true if the value refers to a secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, secretsManagerScheme) || strings.HasPrefix(value, ssmScheme)
+}
+
+// Resolve returns the secret the value refers to. Values which don't
+// refer to a secret are returned as they are.
+func Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if cached, exist := cache[value]; exist && time.Since(cached.resolved) < cacheDuration {
+		return cached.value, nil
+	}
+
+	var secret string
+	var err error
+	if strings.HasPrefix(value, secretsManagerScheme) {
+		secret, err = resolveSecretsManager(strings.TrimPrefix(value, secretsManagerScheme))
+	} else {
+		secret, err = resolveSSM(strings.TrimPrefix(value, ssmScheme))
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %s", value, err)
+	}
+	cache[value] = &cachedSecret{value: secret, resolved: time.Now()}
+	return secret, nil
+}
+
+// ClearCache forgets all resolved secrets, so they are read again
+func ClearCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cache = make(map[string]*cachedSecret)
+}
+
+func resolveSecretsManager(ref string) (string, error) {
+	id, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		id, key = ref[:i], ref[i+1:]
+	}
+	sess := session.Must(session.NewSession())
+	client := secretsmanager.New(sess, &aws.Config{Region: aws.String(region(sess, id))})
+	output, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s is binary", id)
+	}
+	if key == "" {
+		return *output.SecretString, nil
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(*output.SecretString), &values); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %s", id, err)
+	}
+	value, exist := values[key]
+	if !exist {
+		return "", fmt.Errorf("secret %s has no key %s", id, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func resolveSSM(name string) (string, error) {
+	sess := session.Must(session.NewSession())
+	client := ssm.New(sess, &aws.Config{Region: aws.String(region(sess, name))})
+	output, err := client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+// region returns the region of the secret if it's referred to by ARN, or
+// else the region configured for the AWS SDK
+func region(sess *session.Session, id string) string {
+	if parsed, err := arn.Parse(id); err == nil && parsed.Region != "" {
+		return parsed.Region
+	}
+	if configured := aws.StringValue(sess.Config.Region); configured != "" {
+		return configured
+	}
+	return defaultRegion
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package security
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+var (
+	// EncryptedCopyTagKey is set on an unencrypted resource with the ID
+	// of its encrypted copy, so that it is only copied once
+	EncryptedCopyTagKey = "cloudsweeper-encrypted-copy"
+	// EncryptedFromTagKey is set on an encrypted copy with the ID of the
+	// resource it was copied from
+	EncryptedFromTagKey = "cloudsweeper-encrypted-from"
+)
+
+// Unencrypted holds all unencrypted volumes and snapshots in one account
+type Unencrypted struct {
+	Owner     string
+	Volumes   []cloud.Volume
+	Snapshots []cloud.Snapshot
+}
+
+// Count returns the number of unencrypted volumes and snapshots
+func (u *Unencrypted) Count() int {
+	return len(u.Volumes) + len(u.Snapshots)
+}
+
+// EncryptedCopy is an encrypted snapshot made of an unencrypted
+// volume or snapshot
+type EncryptedCopy struct {
+	Source cloud.Resource
+	CopyID string
+}
+
+// FindUnencrypted will find all unencrypted volumes and snapshots,
+// grouped per account. Whitelisted resources are included as well,
+// since this is a compliance report and not a cleanup.
+func FindUnencrypted(mngr cloud.ResourceManager) map[string]*Unencrypted {
+	result := make(map[string]*Unencrypted)
+	var resultMutex sync.Mutex
+	unencryptedFor := func(owner string) *Unencrypted {
+		if _, exist := result[owner]; !exist {
+			result[owner] = &Unencrypted{Owner: owner}
+		}
+		return result[owner]
+	}
+
+	unencryptedFilter := filter.New()
+	unencryptedFilter.AddGeneralRule(filter.IsUnencrypted())
+	unencryptedFilter.OverrideWhitelist = true
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		for _, vol := range res.Volumes {
+			if filter.Match(vol, unencryptedFilter) {
+				unencrypted := unencryptedFor(res.Owner)
+				unencrypted.Volumes = append(unencrypted.Volumes, vol)
+			}
+		}
+		for _, snap := range res.Snapshots {
+			if filter.Match(snap, unencryptedFilter) {
+				unencrypted := unencryptedFor(res.Owner)
+				unencrypted.Snapshots = append(unencrypted.Snapshots, snap)
+			}
+		}
+	})
+	return result
+}
+
+// RemediateUnencrypted will create an encrypted snapshot of every
+// unencrypted volume and snapshot which supports it. The unencrypted
+// resources are left untouched apart from a tag pointing to the copy,
+// and resources which already have that tag are not copied again.
+func RemediateUnencrypted(found map[string]*Unencrypted, dryRun bool) []EncryptedCopy {
+	copies := []EncryptedCopy{}
+	for _, unencrypted := range found {
+		sources := []cloud.Resource{}
+		for _, vol := range unencrypted.Volumes {
+			sources = append(sources, vol)
+		}
+		for _, snap := range unencrypted.Snapshots {
+			sources = append(sources, snap)
+		}
+		for _, source := range sources {
+			if cloud.Tags(source.Tags()).Has(EncryptedCopyTagKey) {
+				continue
+			}
+			copier, ok := source.(cloud.EncryptedCopier)
+			if !ok {
+				log.Printf("Encrypted copies are not supported for %s in %s", source.ID(), unencrypted.Owner)
+				continue
+			}
+			if dryRun {
+				log.Printf("Would create an encrypted copy of %s in %s", source.ID(), unencrypted.Owner)
+				continue
+			}
+			copyID, err := copier.CopyEncrypted(encryptedCopyTags(source))
+			if err != nil {
+				status.ActionFailedf("Could not create an encrypted copy of %s in %s: %s", source.ID(), unencrypted.Owner, err)
+				continue
+			}
+			if err := source.SetTag(EncryptedCopyTagKey, copyID, true); err != nil {
+				status.ActionFailedf("Could not tag %s in %s with its encrypted copy: %s", source.ID(), unencrypted.Owner, err)
+			}
+			copies = append(copies, EncryptedCopy{source, copyID})
+		}
+	}
+	return copies
+}
+
+// encryptedCopyTags returns the tags of the source, without any
+// delete marker, so the copy is treated the same as the original
+func encryptedCopyTags(source cloud.Resource) map[string]string {
+	tags := make(map[string]string)
+	for key, value := range source.Tags() {
+		if key == filter.DeleteTagKey || key == EncryptedCopyTagKey {
+			continue
+		}
+		tags[key] = value
+	}
+	tags[EncryptedFromTagKey] = source.ID()
+	return tags
+}
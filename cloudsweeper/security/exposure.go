@@ -0,0 +1,137 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package security finds resources with risky configurations, such
+// as instances exposed to the internet, so their owners can be told.
+package security
+
+import (
+	"log"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// DefaultSensitivePorts are ports which should never be open to the
+// whole internet, such as SSH, RDP and common databases
+var DefaultSensitivePorts = []int64{21, 22, 23, 445, 1433, 2375, 3306, 3389, 5432, 5601, 6379, 9200, 11211, 27017}
+
+// OpenGroup is a security group with rules allowing traffic from the
+// whole internet on sensitive ports
+type OpenGroup struct {
+	Group cloud.SecurityGroup
+	Rules []cloud.IngressRule
+}
+
+// Exposure holds everything exposed to the internet in one account
+type Exposure struct {
+	Owner           string
+	PublicInstances []cloud.Instance
+	OpenGroups      []OpenGroup
+}
+
+// Count returns the number of exposed instances and security groups
+func (e *Exposure) Count() int {
+	return len(e.PublicInstances) + len(e.OpenGroups)
+}
+
+// FindExposure will find all instances with a public IP, and all
+// security groups open to the internet on any of the sensitive ports,
+// grouped per account. Security groups are only checked if the resource
+// manager supports them.
+func FindExposure(mngr cloud.ResourceManager, sensitivePorts []int64) map[string]*Exposure {
+	result := make(map[string]*Exposure)
+	var resultMutex sync.Mutex
+	exposureFor := func(owner string) *Exposure {
+		if _, exist := result[owner]; !exist {
+			result[owner] = &Exposure{Owner: owner}
+		}
+		return result[owner]
+	}
+
+	publicFilter := filter.New()
+	publicFilter.AddGeneralRule(filter.IsPublic())
+	publicFilter.OverrideWhitelist = true
+	mngr.ForEachInstance(func(inst cloud.Instance) {
+		if filter.Match(inst, publicFilter) {
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			exposure := exposureFor(inst.Owner())
+			exposure.PublicInstances = append(exposure.PublicInstances, inst)
+		}
+	})
+
+	groupManager, ok := mngr.(cloud.SecurityGroupManager)
+	if !ok {
+		log.Println("Security groups are not supported, only checking instances")
+		return result
+	}
+	groupManager.ForEachAccountSecurityGroups(func(account string, groups []cloud.SecurityGroup) {
+		log.Printf("Checking %d security groups in %s", len(groups), cloud.AccountDisplayName(account))
+		for _, group := range groups {
+			rules := OpenRules(group, sensitivePorts)
+			if len(rules) == 0 {
+				continue
+			}
+			resultMutex.Lock()
+			exposure := exposureFor(account)
+			exposure.OpenGroups = append(exposure.OpenGroups, OpenGroup{group, rules})
+			resultMutex.Unlock()
+		}
+	})
+	return result
+}
+
+// OpenRules returns the rules of a security group which allow traffic
+// from the whole internet on any of the sensitive ports
+func OpenRules(group cloud.SecurityGroup, sensitivePorts []int64) []cloud.IngressRule {
+	result := []cloud.IngressRule{}
+	for _, rule := range group.IngressRules() {
+		if !rule.OpenToInternet() {
+			continue
+		}
+		for _, port := range sensitivePorts {
+			if rule.CoversPort(port) {
+				result = append(result, rule)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// RemediateTemporary will revoke the open rules of security groups
+// tagged as temporary with the specified tag key. Groups without the
+// tag are never modified. The revoked groups are removed from the
+// exposures, and a list of them is returned.
+func RemediateTemporary(exposures map[string]*Exposure, temporaryTagKey string, dryRun bool) []OpenGroup {
+	temporaryFilter := filter.New()
+	temporaryFilter.AddGeneralRule(filter.HasTag(temporaryTagKey))
+	temporaryFilter.OverrideWhitelist = true
+
+	revoked := []OpenGroup{}
+	for _, exposure := range exposures {
+		remaining := []OpenGroup{}
+		for _, open := range exposure.OpenGroups {
+			if !filter.Match(open.Group, temporaryFilter) {
+				remaining = append(remaining, open)
+				continue
+			}
+			if dryRun {
+				log.Printf("Would revoke %d open rules on temporary security group %s in %s", len(open.Rules), open.Group.ID(), exposure.Owner)
+				remaining = append(remaining, open)
+				continue
+			}
+			if err := open.Group.RevokeIngressRules(open.Rules); err != nil {
+				status.ActionFailedf("Could not revoke open rules on %s in %s: %s", open.Group.ID(), exposure.Owner, err)
+				remaining = append(remaining, open)
+				continue
+			}
+			revoked = append(revoked, open)
+		}
+		exposure.OpenGroups = remaining
+	}
+	return revoked
+}
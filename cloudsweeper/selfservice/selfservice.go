@@ -0,0 +1,174 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package selfservice lets the owner of an account see the status of
+// their own resources, and protect them from cleanup or postpone their
+// deletion, using their own credentials.
+package selfservice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// ResourceStatus is the status of a single resource
+type ResourceStatus struct {
+	Category string
+	Resource cloud.Resource
+	// DeleteAt is when the resource will be deleted, or the zero time if
+	// it's not marked for deletion
+	DeleteAt    time.Time
+	Whitelisted bool
+}
+
+// ListResources returns the status of every resource of the resource
+// manager. Resources marked for deletion come first, the soonest first.
+func ListResources(mngr cloud.ResourceManager) []ResourceStatus {
+	statuses := []ResourceStatus{}
+	mngr.ForEachResource(func(res cloud.Resource) {
+		statuses = append(statuses, ResourceStatus{
+			Category:    policy.CategoryOf(res),
+			Resource:    res,
+			DeleteAt:    deleteAt(res),
+			Whitelisted: filter.IsWhitelisted(res),
+		})
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.DeleteAt.IsZero() != b.DeleteAt.IsZero() {
+			return !a.DeleteAt.IsZero()
+		}
+		if !a.DeleteAt.Equal(b.DeleteAt) {
+			return a.DeleteAt.Before(b.DeleteAt)
+		}
+		return a.Resource.ID() < b.Resource.ID()
+	})
+	return statuses
+}
+
+// FormatResources returns the statuses as a table
+func FormatResources(statuses []ResourceStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-10s %-40s %-15s %-9s %s\n", "TYPE", "ID", "LOCATION", "AGE", "STATUS")
+	for _, s := range statuses {
+		age := int(time.Since(s.Resource.CreationTime()).Hours() / 24)
+		fmt.Fprintf(&b, "%-10s %-40s %-15s %-9s %s\n", s.Category, s.Resource.ID(), s.Resource.Location(), fmt.Sprintf("%d days", age), s.describe())
+	}
+	return b.String()
+}
+
+func (s ResourceStatus) describe() string {
+	switch {
+	case !s.DeleteAt.IsZero():
+		return fmt.Sprintf("Will be deleted at %s", s.DeleteAt.Format(time.RFC3339))
+	case s.Whitelisted:
+		return "Protected"
+	default:
+		return "-"
+	}
+}
+
+// Protect whitelists the resource with the specified ID, so it's never
+// cleaned up, and removes any mark for deletion from it
+func Protect(mngr cloud.ResourceManager, id string) (cloud.Resource, error) {
+	res, err := FindResource(mngr, id)
+	if err != nil {
+		return nil, err
+	}
+	return res, ProtectResource(res, "")
+}
+
+// ProtectResource whitelists a resource and removes any mark for deletion
+// from it. The reason, if any, is set as the value of the whitelist tag.
+func ProtectResource(res cloud.Resource, reason string) error {
+	if err := res.SetTag(filter.WhitelistTagKey, reason, true); err != nil {
+		return fmt.Errorf("Could not protect %s: %s", res.ID(), err)
+	}
+	if cloud.Tags(res.Tags()).Has(filter.DeleteTagKey) {
+		if err := res.RemoveTag(filter.DeleteTagKey); err != nil {
+			return fmt.Errorf("Protected %s, but could not remove its deletion mark: %s", res.ID(), err)
+		}
+	}
+	return nil
+}
+
+// AssignResource claims a resource for an employee with the claimed-by
+// tag, and removes any mark for deletion from it, since the resource was
+// marked while it was attributed to someone else
+func AssignResource(res cloud.Resource, username string) error {
+	if err := res.SetTag(cleanup.ClaimedByTagKey, username, true); err != nil {
+		return fmt.Errorf("Could not assign %s: %s", res.ID(), err)
+	}
+	if cloud.Tags(res.Tags()).Has(filter.DeleteTagKey) {
+		if err := res.RemoveTag(filter.DeleteTagKey); err != nil {
+			return fmt.Errorf("Assigned %s, but could not remove its deletion mark: %s", res.ID(), err)
+		}
+	}
+	return nil
+}
+
+// Extend postpones the deletion of the resource with the specified ID by
+// the specified number of days, and returns the new deletion time. Only
+// resources marked for deletion can be extended.
+func Extend(mngr cloud.ResourceManager, id string, days int) (time.Time, error) {
+	if days <= 0 {
+		return time.Time{}, fmt.Errorf("Can only extend by a positive number of days, not %d", days)
+	}
+	res, err := FindResource(mngr, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ExtendResource(res, days)
+}
+
+// ExtendResource postpones the deletion of a resource marked for deletion
+// by the specified number of days, and returns the new deletion time
+func ExtendResource(res cloud.Resource, days int) (time.Time, error) {
+	if days <= 0 {
+		return time.Time{}, fmt.Errorf("Can only extend by a positive number of days, not %d", days)
+	}
+	current := deleteAt(res)
+	if current.IsZero() {
+		return time.Time{}, fmt.Errorf("%s is not marked for deletion", res.ID())
+	}
+	extended := current.AddDate(0, 0, days)
+	value := filter.SignTagValue(res, filter.DeleteTagKey, extended.Format(time.RFC3339))
+	if err := res.SetTag(filter.DeleteTagKey, value, true); err != nil {
+		return time.Time{}, fmt.Errorf("Could not extend %s: %s", res.ID(), err)
+	}
+	return extended, nil
+}
+
+// deleteAt returns when a resource will be deleted, or the zero time
+func deleteAt(res cloud.Resource) time.Time {
+	value, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey)
+	if !exist {
+		return time.Time{}
+	}
+	t, err := cloud.ParseTagTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// FindResource returns the resource with the specified ID
+func FindResource(mngr cloud.ResourceManager, id string) (cloud.Resource, error) {
+	var found cloud.Resource
+	mngr.ForEachResource(func(res cloud.Resource) {
+		if res.ID() == id {
+			found = res
+		}
+	})
+	if found == nil {
+		return nil, fmt.Errorf("Could not find %s", id)
+	}
+	return found, nil
+}
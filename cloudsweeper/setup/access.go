@@ -0,0 +1,109 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package setup
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PolicyVersion is the version of the policy template created by setup.
+// Increase it whenever actions are added to the template, so that roles
+// set up with an older template are reported by check-access.
+const PolicyVersion = 2
+
+// policyStatementPrefix is the start of the ID of the statement in the
+// policy template, which ends with its version
+const policyStatementPrefix = "CloudsweeperV"
+
+// checkIAM are the actions check-access needs to read the policies of
+// the role and simulate what it's allowed to do
+var checkIAM = []string{"iam:ListAttachedRolePolicies", "iam:GetPolicy", "iam:GetPolicyVersion", "iam:SimulatePrincipalPolicy"}
+
+// awsCommandActions are the actions every command needs in the accounts,
+// apart from the ones needed to discover resources, which every command
+// needs
+var awsCommandActions = map[string][]string{
+	"mark-for-cleanup":       append([]string{"ec2:CreateTags", "s3:PutBucketTagging"}, deleteProtection...),
+	"departed-owners-review": {"ec2:CreateTags", "s3:PutBucketTagging"},
+	"process-replies":        {"ec2:CreateTags", "s3:PutBucketTagging"},
+	"reset":                  {"ec2:DeleteTags", "s3:PutBucketTagging"},
+	"cleanup":                append(append(append([]string{}, cleanupEC2...), cleanupS3...), deleteProtection...),
+	"delete":                 append(append([]string{}, cleanupEC2...), cleanupS3...),
+	"tag":                    {"ec2:CreateTags", "s3:PutBucketTagging"},
+	"tui":                    append(append([]string{"ec2:CreateTags", "ec2:DeleteTags", "s3:PutBucketTagging"}, cleanupEC2...), cleanupS3...),
+	"security-review":        {"ec2:DescribeSecurityGroups", "ec2:RevokeSecurityGroupIngress"},
+	"encryption-review":      {"ec2:CreateSnapshot", "ec2:CopySnapshot", "ec2:CreateTags"},
+	"archive-review":         {"ec2:ModifySnapshotTier"},
+	"multipart-review":       {"s3:ListBucketMultipartUploads", "s3:ListMultipartUploadParts", "s3:AbortMultipartUpload"},
+	"file-system-review":     {"elasticfilesystem:DescribeFileSystems", "elasticfilesystem:DescribeMountTargets", "fsx:DescribeFileSystems", "elasticfilesystem:DeleteFileSystem", "elasticfilesystem:DeleteMountTarget", "elasticfilesystem:TagResource", "fsx:DeleteFileSystem", "fsx:CreateBackup", "fsx:TagResource"},
+	"vpn-review":             {"ec2:DescribeClientVpnEndpoints", "ec2:DescribeClientVpnTargetNetworks", "ec2:DescribeVpnConnections", "ec2:CreateTags", "ec2:DisassociateClientVpnTargetNetwork", "ec2:DeleteClientVpnEndpoint", "ec2:DeleteVpnConnection"},
+	"transit-gateway-review": {"ec2:DescribeTransitGateways", "ec2:DescribeTransitGatewayAttachments", "ec2:DescribeTransitGatewayRouteTables", "ec2:SearchTransitGatewayRoutes", "ec2:DescribeVpcs", "ec2:DescribeNetworkInterfaces", "ec2:DeleteTransitGatewayVpcAttachment", "ec2:DeleteTransitGatewayRoute"},
+	"cluster-review":         {"elasticmapreduce:ListClusters", "elasticmapreduce:DescribeCluster", "elasticmapreduce:ListInstances", "elasticmapreduce:ListSteps", "cloudwatch:GetMetricStatistics", "elasticmapreduce:AddTags", "elasticmapreduce:RemoveTags", "elasticmapreduce:TerminateJobFlows"},
+	"gpu-review":             {"cloudwatch:ListMetrics", "ec2:CreateTags", "ec2:TerminateInstances"},
+	"ml-review":              {"sagemaker:ListNotebookInstances", "sagemaker:ListEndpoints", "sagemaker:DescribeEndpoint", "sagemaker:DescribeEndpointConfig", "sagemaker:ListApps", "sagemaker:DescribeApp", "sagemaker:ListTags", "cloudtrail:LookupEvents", "cloudwatch:GetMetricStatistics", "sagemaker:AddTags", "sagemaker:DeleteTags", "sagemaker:StopNotebookInstance", "sagemaker:DescribeNotebookInstance", "sagemaker:DeleteEndpoint", "sagemaker:DeleteApp"},
+	"monitoring-review":      {"cloudwatch:DescribeAlarms", "cloudwatch:ListDashboards", "cloudwatch:DeleteAlarms", "cloudwatch:DeleteDashboards"},
+	"network-review":         {"ec2:DescribeVpcs", "cloudtrail:LookupEvents", "ec2:DescribeNetworkInterfaces", "ec2:DescribeInternetGateways", "ec2:DescribeSubnets", "ec2:DescribeRouteTables", "ec2:DescribeNetworkAcls", "ec2:DescribeSecurityGroups", "ec2:DetachInternetGateway", "ec2:DeleteInternetGateway", "ec2:DeleteSubnet", "ec2:DeleteRouteTable", "ec2:DeleteNetworkAcl", "ec2:RevokeSecurityGroupEgress", "ec2:DeleteSecurityGroup", "ec2:DeleteVpc"},
+	"image-copy-review":      {"ec2:DeregisterImage", "ec2:DeleteSnapshot"},
+	"spot-review":            {"ec2:DescribeSpotPriceHistory", "pricing:GetProducts"},
+	"review":                 {"cloudwatch:ListMetrics"},
+	"quota-review":           {"ec2:DescribeVpcs", "servicequotas:GetServiceQuota", "servicequotas:GetAWSDefaultServiceQuota"},
+	"lifecycle-review":       {"dlm:GetLifecyclePolicies", "dlm:GetLifecyclePolicy"},
+	"check-access":           checkIAM,
+}
+
+// deleteProtection are the actions needed to check if buckets and
+// snapshots are protected from deletion
+var deleteProtection = []string{"s3:GetBucketObjectLockConfiguration", "s3:GetBucketPolicy", "ec2:DescribeLockedSnapshots"}
+
+// awsDiscoveryActions are the actions needed to discover resources
+var awsDiscoveryActions = []string{"ec2:DescribeRegions", "ec2:DescribeInstances", "ec2:DescribeImages", "ec2:DescribeVolumes", "ec2:DescribeSnapshots", "ec2:DescribeTags", "s3:ListAllMyBuckets", "s3:GetBucketLocation", "s3:GetBucketTagging", "s3:ListBucket", "cloudwatch:GetMetricStatistics", "iam:ListAccountAliases"}
+
+// RequiredAWSActions returns the actions the role in every account must
+// be allowed for the specified commands to work, sorted
+func RequiredAWSActions(commands []string) []string {
+	actionSet := make(map[string]struct{})
+	for _, action := range awsDiscoveryActions {
+		actionSet[action] = struct{}{}
+	}
+	for _, command := range commands {
+		for _, action := range awsCommandActions[command] {
+			actionSet[action] = struct{}{}
+		}
+	}
+	actions := []string{}
+	for action := range actionSet {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// PolicyStatementID returns the ID of the statement in the policy
+// template, which holds its version
+func PolicyStatementID() string {
+	return fmt.Sprintf("%s%d", policyStatementPrefix, PolicyVersion)
+}
+
+// DeployedPolicyVersion returns the newest version of the policy template
+// among the IDs of the statements of a role's policies, or false if none
+// of them is from the template, e.g. because it was set up by hand
+func DeployedPolicyVersion(statementIDs []string) (int, bool) {
+	newest, found := 0, false
+	for _, id := range statementIDs {
+		if !strings.HasPrefix(id, policyStatementPrefix) {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimPrefix(id, policyStatementPrefix))
+		if err != nil {
+			continue
+		}
+		if !found || version > newest {
+			newest, found = version, true
+		}
+	}
+	return newest, found
+}
@@ -54,11 +54,11 @@ const (
 )
 
 var (
-	monitorEC2 = []string{"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:DescribeSnapshots", "ec2:DescribeVolumeStatus", "ec2:DescribeVolumes", "ec2:DescribeInstanceStatus", "ec2:DescribeTags", "ec2:DescribeVolumeAttribute", "ec2:DescribeImages", "ec2:DescribeSnapshotAttribute"}
-	monitorS3  = []string{"s3:GetBucketTagging", "s3:ListBucket", "s3:GetObject", "s3:ListAllMyBuckets", "s3:GetBucketLocation", "cloudwatch:GetMetricStatistics"}
+	monitorEC2 = []string{"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:DescribeSnapshots", "ec2:DescribeVolumeStatus", "ec2:DescribeVolumes", "ec2:DescribeInstanceStatus", "ec2:DescribeTags", "ec2:DescribeVolumeAttribute", "ec2:DescribeImages", "ec2:DescribeSnapshotAttribute", "ec2:DescribeSecurityGroups", "ec2:DescribeRegions", "iam:ListAccountAliases", "cloudtrail:LookupEvents", "elasticfilesystem:DescribeFileSystems", "elasticfilesystem:DescribeMountTargets", "fsx:DescribeFileSystems", "cloudwatch:GetMetricStatistics", "ec2:DescribeAddresses", "ec2:DescribeSpotPriceHistory", "cloudwatch:DescribeAlarms", "cloudwatch:ListDashboards", "ec2:DescribeVpcs", "servicequotas:GetServiceQuota", "servicequotas:GetAWSDefaultServiceQuota", "ec2:DescribeNetworkInterfaces", "ec2:DescribeInternetGateways", "ec2:DescribeSubnets", "ec2:DescribeRouteTables", "ec2:DescribeNetworkAcls", "ec2:DescribeClientVpnEndpoints", "ec2:DescribeClientVpnTargetNetworks", "ec2:DescribeVpnConnections", "ec2:DescribeTransitGateways", "ec2:DescribeTransitGatewayAttachments", "ec2:DescribeTransitGatewayRouteTables", "ec2:SearchTransitGatewayRoutes", "sagemaker:ListNotebookInstances", "sagemaker:ListEndpoints", "sagemaker:DescribeEndpoint", "sagemaker:DescribeEndpointConfig", "sagemaker:ListApps", "sagemaker:DescribeApp", "sagemaker:ListTags", "elasticmapreduce:ListClusters", "elasticmapreduce:DescribeCluster", "elasticmapreduce:ListInstances", "elasticmapreduce:ListSteps", "imagebuilder:ListImages", "imagebuilder:ListImageBuildVersions", "dlm:GetLifecyclePolicies", "dlm:GetLifecyclePolicy", "ec2:DescribeLockedSnapshots"}
+	monitorS3  = []string{"s3:GetBucketTagging", "s3:ListBucket", "s3:GetObject", "s3:ListAllMyBuckets", "s3:GetBucketLocation", "s3:GetBucketLogging", "s3:ListBucketMultipartUploads", "s3:ListBucketVersions", "s3:ListMultipartUploadParts", "cloudwatch:GetMetricStatistics", "s3:GetBucketObjectLockConfiguration", "s3:GetBucketPolicy"}
 
-	cleanupEC2 = []string{"ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:DeleteTags", "ec2:ModifyImageAttribute", "ec2:DeleteVolume", "ec2:TerminateInstances", "ec2:CreateTags", "ec2:StopInstances"}
-	cleanupS3  = []string{"s3:PutBucketTagging", "s3:DeleteObject", "s3:DeleteBucket"}
+	cleanupEC2 = []string{"ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:DeleteTags", "ec2:ModifyImageAttribute", "ec2:DeleteVolume", "ec2:TerminateInstances", "ec2:CreateTags", "ec2:StopInstances", "ec2:RevokeSecurityGroupIngress", "ec2:CreateSnapshot", "ec2:CopySnapshot", "ec2:ModifySnapshotTier", "ec2:DeleteNetworkInterface", "elasticfilesystem:DeleteFileSystem", "elasticfilesystem:DeleteMountTarget", "elasticfilesystem:TagResource", "elasticfilesystem:UntagResource", "fsx:DeleteFileSystem", "fsx:CreateBackup", "fsx:TagResource", "fsx:UntagResource", "ec2:DisassociateAddress", "ec2:ReleaseAddress", "cloudwatch:DeleteAlarms", "cloudwatch:DeleteDashboards", "ec2:DetachInternetGateway", "ec2:DeleteInternetGateway", "ec2:DeleteSubnet", "ec2:DeleteRouteTable", "ec2:DeleteNetworkAcl", "ec2:RevokeSecurityGroupEgress", "ec2:DeleteSecurityGroup", "ec2:DeleteVpc", "ec2:DisassociateClientVpnTargetNetwork", "ec2:DeleteClientVpnEndpoint", "ec2:DeleteVpnConnection", "ec2:DeleteTransitGatewayVpcAttachment", "ec2:DeleteTransitGatewayRoute", "sagemaker:AddTags", "sagemaker:DeleteTags", "sagemaker:StopNotebookInstance", "sagemaker:DescribeNotebookInstance", "sagemaker:DeleteNotebookInstance", "sagemaker:DeleteEndpoint", "sagemaker:DeleteApp", "elasticmapreduce:AddTags", "elasticmapreduce:RemoveTags", "elasticmapreduce:TerminateJobFlows"}
+	cleanupS3  = []string{"s3:PutBucketTagging", "s3:DeleteObject", "s3:DeleteBucket", "s3:AbortMultipartUpload", "s3:DeleteObjectVersion"}
 
 	errPolicyExist = errors.New("A policy with the same name already exist")
 	errRoleExist   = errors.New("A role with the same name already exist")
@@ -73,7 +73,7 @@ func awsSetup(masterARN string) error {
 	if !idExist || !secretExist {
 		return errors.New("No AWS credentials exist")
 	}
-	fmt.Println(awsInfo)
+	fmt.Print(awsInfo)
 
 	// Get user preferences
 	conf := getAWSConf()
@@ -279,6 +279,10 @@ func (c config) Policy() policyDocument {
 		}
 	}
 
+	for i := range checkIAM {
+		actionSet[checkIAM[i]] = struct{}{}
+	}
+
 	doc := policyDocument{}
 	statement := policyStatement{}
 	statement.Action = []string{}
@@ -289,7 +293,7 @@ func (c config) Policy() policyDocument {
 
 	statement.Effect = "Allow"
 	statement.Resource = "*"
-	statement.Sid = "VisualEditor0"
+	statement.Sid = PolicyStatementID()
 
 	doc.Version = "2012-10-17"
 	doc.Statement = []policyStatement{statement}
@@ -0,0 +1,193 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// What marking would do with a resource
+const (
+	// FlagMark means marking would tag the resource for deletion
+	FlagMark = "mark"
+	// FlagNotify means marking would only notify the owner about it
+	FlagNotify = "notify"
+)
+
+// The columns items can be sorted by
+const (
+	SortID      = "id"
+	SortType    = "type"
+	SortAccount = "account"
+	SortAge     = "age"
+	SortCost    = "cost"
+	SortStatus  = "status"
+)
+
+// sortColumns lists every column items can be sorted by
+var sortColumns = []string{SortID, SortType, SortAccount, SortAge, SortCost, SortStatus}
+
+// Item is a discovered resource, and what Cloudsweeper does with it
+type Item struct {
+	Category string
+	Resource cloud.Resource
+	// Flag is what marking would do with the resource, or empty if it
+	// doesn't match the marking rules
+	Flag string
+	// Reason is the rule the resource was flagged or marked by
+	Reason string
+	// DeleteAt is when the resource is deleted, or the zero time if it
+	// isn't marked for deletion
+	DeleteAt     time.Time
+	Whitelisted  bool
+	CostPerMonth float64
+}
+
+// NewItems returns an item for every resource of the accounts, flagged
+// with what marking, run as a dry run, would do with them
+func NewItems(accounts []*cloud.AllResourceCollection, marked, notifyOnly map[string]*cloud.AllResourceCollection) []*Item {
+	flags := map[string]string{}
+	flag := func(collections map[string]*cloud.AllResourceCollection, value string) {
+		for _, collection := range collections {
+			for _, res := range collection.Resources() {
+				flags[res.Owner()+"/"+res.ID()] = value
+			}
+		}
+	}
+	flag(notifyOnly, FlagNotify)
+	flag(marked, FlagMark)
+
+	items := []*Item{}
+	for _, collection := range accounts {
+		for _, res := range collection.Resources() {
+			item := &Item{
+				Category:     policy.CategoryOf(res),
+				Resource:     res,
+				Flag:         flags[res.Owner()+"/"+res.ID()],
+				DeleteAt:     deleteAt(res),
+				Whitelisted:  filter.IsWhitelisted(res),
+				CostPerMonth: costPerMonth(res),
+			}
+			if item.Flag != "" || !item.DeleteAt.IsZero() {
+				item.Reason = cleanup.DeleteReason(res)
+			}
+			items = append(items, item)
+		}
+	}
+	sortItems(items, SortStatus)
+	return items
+}
+
+// Status describes what happens to the resource
+func (item *Item) Status() string {
+	reason := ""
+	if item.Reason != "" {
+		reason = " (" + item.Reason + ")"
+	}
+	switch {
+	case !item.DeleteAt.IsZero():
+		return fmt.Sprintf("deleted %s%s", item.DeleteAt.Format("2006-01-02 15:04"), reason)
+	case item.Whitelisted:
+		return "protected"
+	case item.Flag == FlagMark:
+		return "would be marked" + reason
+	case item.Flag == FlagNotify:
+		return "owner notified" + reason
+	}
+	return "-"
+}
+
+// AgeDays returns how many days ago the resource was created
+func (item *Item) AgeDays() int {
+	return int(time.Since(item.Resource.CreationTime()).Hours() / 24)
+}
+
+// matches checks if any of the columns of the item, its name or its
+// reason contains the query, ignoring case
+func (item *Item) matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, value := range []string{item.Category, item.Resource.ID(), item.Resource.Owner(), cloud.AccountDisplayName(item.Resource.Owner()), item.Resource.Location(), item.Resource.Tags()["Name"], item.Status()} {
+		if strings.Contains(strings.ToLower(value), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusOrder puts resources marked for deletion first, then the ones
+// which would be marked, and protected resources last
+func (item *Item) statusOrder() int {
+	switch {
+	case !item.DeleteAt.IsZero():
+		return 0
+	case item.Flag == FlagMark:
+		return 1
+	case item.Flag == FlagNotify:
+		return 2
+	case item.Whitelisted:
+		return 4
+	}
+	return 3
+}
+
+func sortItems(items []*Item, column string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch column {
+		case SortType:
+			if a.Category != b.Category {
+				return a.Category < b.Category
+			}
+		case SortAccount:
+			if a.Resource.Owner() != b.Resource.Owner() {
+				return a.Resource.Owner() < b.Resource.Owner()
+			}
+		case SortAge:
+			if !a.Resource.CreationTime().Equal(b.Resource.CreationTime()) {
+				return a.Resource.CreationTime().Before(b.Resource.CreationTime())
+			}
+		case SortCost:
+			if a.CostPerMonth != b.CostPerMonth {
+				return a.CostPerMonth > b.CostPerMonth
+			}
+		case SortStatus:
+			if a.statusOrder() != b.statusOrder() {
+				return a.statusOrder() < b.statusOrder()
+			}
+			if !a.DeleteAt.Equal(b.DeleteAt) {
+				return a.DeleteAt.Before(b.DeleteAt)
+			}
+		}
+		return a.Resource.ID() < b.Resource.ID()
+	})
+}
+
+// deleteAt returns when a resource will be deleted, or the zero time
+func deleteAt(res cloud.Resource) time.Time {
+	value, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey)
+	if !exist {
+		return time.Time{}
+	}
+	t, err := cloud.ParseTagTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func costPerMonth(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	return 30 * billing.ResourceCostPerDay(res)
+}
@@ -0,0 +1,441 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package tui is an interactive terminal UI to browse the resources
+// Cloudsweeper discovered. Resources can be filtered and sorted, it shows
+// why a resource is flagged, and selected resources can be marked for
+// deletion, protected or deleted right away. Every action is recorded in
+// the audit trail.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/selfservice"
+)
+
+// AuditSource is the source of audit trail entries of actions taken in
+// the terminal UI
+const AuditSource = "tui"
+
+// The actions recorded in the audit trail
+const (
+	ActionMark    = "mark"
+	ActionProtect = "protect"
+	ActionDelete  = "delete"
+)
+
+// actionDone describes each action once taken
+var actionDone = map[string]string{
+	ActionMark:    "Marked",
+	ActionProtect: "Protected",
+	ActionDelete:  "Deleted",
+}
+
+const defaultPageSize = 25
+
+const helpText = `Commands:
+  list, l                  List the resources on the current page
+  next, n / prev, p        Go to the next or previous page
+  filter <text>, f <text>  Only list resources containing the text, or list all without text
+  flagged                  Toggle only listing resources which are marked or would be marked
+  sort <column>            Sort by id, type, account, age, cost or status
+  why <n>                  Show why a resource is flagged, and its tags
+  mark <n...>              Mark resources for deletion
+  protect <n...>           Whitelist resources, and remove their deletion mark
+  delete <n...>            Delete resources right away, after confirming
+  help, ?                  Show this help
+  quit, q                  Quit
+Resources are selected by their numbers in the list, e.g. "3 5-7", or "all" for every listed resource.
+`
+
+// Options configure a session
+type Options struct {
+	// MarkDays is in how many days resources marked in the session are
+	// deleted
+	MarkDays int
+	// DryRun only logs actions in the session, and records them in the
+	// audit trail as dry runs
+	DryRun   bool
+	Trail    *audit.Trail
+	Actor    string
+	PageSize int
+}
+
+// Session is an interactive session browsing resources
+type Session struct {
+	items       []*Item
+	view        []*Item
+	opts        Options
+	query       string
+	flaggedOnly bool
+	sortBy      string
+	page        int
+	in          *bufio.Scanner
+	out         io.Writer
+}
+
+// NewSession returns a session browsing the items, reading commands from
+// in and writing to out
+func NewSession(items []*Item, in io.Reader, out io.Writer, opts Options) *Session {
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaultPageSize
+	}
+	s := &Session{
+		items:  items,
+		opts:   opts,
+		sortBy: SortStatus,
+		in:     bufio.NewScanner(in),
+		out:    out,
+	}
+	s.refresh()
+	return s
+}
+
+// Run reads and runs commands until the input ends or the session is quit
+func (s *Session) Run() error {
+	mode := ""
+	if s.opts.DryRun {
+		mode = " (dry run, actions are only logged)"
+	}
+	fmt.Fprintf(s.out, "Cloudsweeper: %d resources discovered%s. Type \"help\" for commands.\n", len(s.items), mode)
+	s.list()
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return s.in.Err()
+		}
+		fields := strings.Fields(s.in.Text())
+		if len(fields) == 0 {
+			s.list()
+			continue
+		}
+		command, args := strings.ToLower(fields[0]), fields[1:]
+		switch command {
+		case "help", "?":
+			fmt.Fprint(s.out, helpText)
+		case "list", "l", "ls":
+			s.list()
+		case "next", "n":
+			s.turnPage(1)
+		case "prev", "p":
+			s.turnPage(-1)
+		case "filter", "f", "/":
+			s.query = strings.Join(args, " ")
+			s.refresh()
+			s.list()
+		case "flagged":
+			s.flaggedOnly = !s.flaggedOnly
+			s.refresh()
+			s.list()
+		case "sort":
+			s.sort(args)
+		case "why", "w":
+			s.why(args)
+		case "mark", "m":
+			s.act(ActionMark, args)
+		case "protect":
+			s.act(ActionProtect, args)
+		case "delete":
+			s.act(ActionDelete, args)
+		case "quit", "q", "exit":
+			return nil
+		default:
+			fmt.Fprintf(s.out, "Unknown command '%s', type \"help\" for commands\n", command)
+		}
+	}
+}
+
+// refresh filters and sorts the listed items, and goes back to the first
+// page
+func (s *Session) refresh() {
+	s.view = []*Item{}
+	for _, item := range s.items {
+		if s.flaggedOnly && item.Flag == "" && item.DeleteAt.IsZero() {
+			continue
+		}
+		if s.query != "" && !item.matches(s.query) {
+			continue
+		}
+		s.view = append(s.view, item)
+	}
+	sortItems(s.view, s.sortBy)
+	s.page = 0
+}
+
+func (s *Session) pages() int {
+	return (len(s.view) + s.opts.PageSize - 1) / s.opts.PageSize
+}
+
+func (s *Session) turnPage(delta int) {
+	page := s.page + delta
+	if page < 0 || page >= s.pages() {
+		fmt.Fprintln(s.out, "No more pages")
+		return
+	}
+	s.page = page
+	s.list()
+}
+
+func (s *Session) list() {
+	if len(s.view) == 0 {
+		fmt.Fprintln(s.out, "No resources listed")
+		return
+	}
+	start := s.page * s.opts.PageSize
+	end := start + s.opts.PageSize
+	if end > len(s.view) {
+		end = len(s.view)
+	}
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTYPE\tACCOUNT\tID\tLOCATION\tAGE\tCOST/MONTH\tSTATUS")
+	for i := start; i < end; i++ {
+		item := s.view[i]
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%dd\t$%.2f\t%s\n", i+1, item.Category,
+			cloud.AccountDisplayName(item.Resource.Owner()), item.Resource.ID(), item.Resource.Location(),
+			item.AgeDays(), item.CostPerMonth, item.Status())
+	}
+	w.Flush()
+	details := []string{fmt.Sprintf("sorted by %s", s.sortBy)}
+	if s.query != "" {
+		details = append(details, fmt.Sprintf("filtered by '%s'", s.query))
+	}
+	if s.flaggedOnly {
+		details = append(details, "flagged only")
+	}
+	fmt.Fprintf(s.out, "Page %d of %d, %d of %d resources, %s\n", s.page+1, s.pages(), len(s.view), len(s.items), strings.Join(details, ", "))
+}
+
+func (s *Session) sort(args []string) {
+	if len(args) != 1 || !contains(sortColumns, strings.ToLower(args[0])) {
+		fmt.Fprintf(s.out, "Sort by one of: %s\n", strings.Join(sortColumns, ", "))
+		return
+	}
+	s.sortBy = strings.ToLower(args[0])
+	s.refresh()
+	s.list()
+}
+
+func (s *Session) why(args []string) {
+	selected, err := s.selection(args)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	for _, item := range selected {
+		res := item.Resource
+		fmt.Fprintf(s.out, "%s %s in %s (%s), created %s\n", item.Category, res.ID(),
+			cloud.AccountDisplayName(res.Owner()), res.Location(), res.CreationTime().Format("2006-01-02"))
+		switch {
+		case !item.DeleteAt.IsZero():
+			fmt.Fprintf(s.out, "  Marked for deletion at %s, because: %s\n", item.DeleteAt.Format(time.RFC1123), reasonOrUnknown(item.Reason))
+		case item.Flag == FlagMark:
+			fmt.Fprintf(s.out, "  Would be marked for deletion, because: %s\n", reasonOrUnknown(item.Reason))
+		case item.Flag == FlagNotify:
+			fmt.Fprintf(s.out, "  Its owner would be notified, because: %s\n", reasonOrUnknown(item.Reason))
+		default:
+			fmt.Fprintln(s.out, "  Not flagged by any rule")
+		}
+		if item.Whitelisted {
+			fmt.Fprintf(s.out, "  Protected: %s\n", reasonOrUnknown(res.Tags()[filter.WhitelistTagKey]))
+		}
+		keys := []string{}
+		for key := range res.Tags() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(s.out, "  %s = %s\n", key, res.Tags()[key])
+		}
+	}
+}
+
+// act takes an action on the selected items, and records each one in the
+// audit trail
+func (s *Session) act(action string, args []string) {
+	selected, err := s.selection(args)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	if action == ActionDelete {
+		deletable := []*Item{}
+		for _, item := range selected {
+			if item.Whitelisted {
+				fmt.Fprintf(s.out, "Not deleting %s, it's protected\n", item.Resource.ID())
+				continue
+			}
+			deletable = append(deletable, item)
+		}
+		selected = deletable
+		if len(selected) == 0 {
+			return
+		}
+		if !s.opts.DryRun && !s.confirm(fmt.Sprintf("Delete %d resources right away? This can't be undone.", len(selected))) {
+			fmt.Fprintln(s.out, "Nothing deleted")
+			return
+		}
+	}
+
+	deleted := map[*Item]bool{}
+	timeToDelete := time.Now().UTC().AddDate(0, 0, s.opts.MarkDays)
+	for _, item := range selected {
+		res := item.Resource
+		detail := ""
+		var err error
+		switch action {
+		case ActionMark:
+			detail = fmt.Sprintf("deleted at %s", timeToDelete.Format(time.RFC3339))
+			if !s.opts.DryRun {
+				err = cleanup.MarkResource(res, timeToDelete, cleanup.ManualReason)
+			}
+			if err == nil && !s.opts.DryRun {
+				item.DeleteAt, item.Reason, item.Whitelisted = timeToDelete, cleanup.ManualReason, false
+			}
+		case ActionProtect:
+			detail = "protected by " + s.opts.Actor
+			if !s.opts.DryRun {
+				err = selfservice.ProtectResource(res, detail)
+			}
+			if err == nil && !s.opts.DryRun {
+				item.Whitelisted, item.DeleteAt = true, time.Time{}
+			}
+		case ActionDelete:
+			if !s.opts.DryRun {
+				err = cleanup.DeleteResource(res)
+			}
+			if err == nil && !s.opts.DryRun {
+				deleted[item] = true
+			}
+		}
+		s.record(action, item, detail, err)
+	}
+
+	if len(deleted) > 0 {
+		remaining := []*Item{}
+		for _, item := range s.items {
+			if !deleted[item] {
+				remaining = append(remaining, item)
+			}
+		}
+		s.items = remaining
+		s.refresh()
+	}
+}
+
+// record reports the outcome of an action, and appends it to the audit
+// trail
+func (s *Session) record(action string, item *Item, detail string, actionErr error) {
+	res := item.Resource
+	entry := audit.Entry{
+		Actor:      s.opts.Actor,
+		Source:     AuditSource,
+		Action:     action,
+		Account:    res.Owner(),
+		ResourceID: res.ID(),
+		Location:   res.Location(),
+		Detail:     detail,
+		DryRun:     s.opts.DryRun,
+	}
+	if action == ActionDelete {
+		// The resource still has the tags and metadata it was discovered
+		// with, even if it was deleted
+		entry.Resource = audit.Snapshot(res)
+	}
+	switch {
+	case actionErr != nil:
+		entry.Error = actionErr.Error()
+		fmt.Fprintf(s.out, "Failed to %s %s: %s\n", action, res.ID(), actionErr)
+	case s.opts.DryRun:
+		fmt.Fprintf(s.out, "Would %s %s\n", action, res.ID())
+	default:
+		if detail != "" {
+			detail = " (" + detail + ")"
+		}
+		fmt.Fprintf(s.out, "%s %s%s\n", actionDone[action], res.ID(), detail)
+	}
+	if s.opts.Trail == nil {
+		return
+	}
+	if err := s.opts.Trail.Record(entry); err != nil {
+		fmt.Fprintf(s.out, "Could not record the %s of %s in the audit trail: %s\n", action, res.ID(), err)
+	}
+}
+
+// selection parses resource numbers and ranges of the listed resources,
+// such as "3 5-7", or "all"
+func (s *Session) selection(args []string) ([]*Item, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Select resources by their numbers in the list, e.g. \"3 5-7\", or \"all\"")
+	}
+	if len(args) == 1 && strings.ToLower(args[0]) == "all" {
+		return append([]*Item{}, s.view...), nil
+	}
+	selected := []*Item{}
+	seen := map[int]bool{}
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			if part == "" {
+				continue
+			}
+			first, last := part, part
+			if i := strings.Index(part, "-"); i > 0 {
+				first, last = part[:i], part[i+1:]
+			}
+			from, err := strconv.Atoi(first)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid resource number '%s'", part)
+			}
+			to, err := strconv.Atoi(last)
+			if err != nil || to < from {
+				return nil, fmt.Errorf("Invalid resource number '%s'", part)
+			}
+			if from < 1 || to > len(s.view) {
+				return nil, fmt.Errorf("There is no resource %s, %d resources are listed", part, len(s.view))
+			}
+			for n := from; n <= to; n++ {
+				if !seen[n] {
+					seen[n] = true
+					selected = append(selected, s.view[n-1])
+				}
+			}
+		}
+	}
+	return selected, nil
+}
+
+func (s *Session) confirm(question string) bool {
+	fmt.Fprintf(s.out, "%s Type \"yes\" to continue: ", question)
+	if !s.in.Scan() {
+		return false
+	}
+	return strings.TrimSpace(strings.ToLower(s.in.Text())) == "yes"
+}
+
+func reasonOrUnknown(reason string) string {
+	if reason == "" {
+		return "unknown"
+	}
+	return reason
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package unsubscribe
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var pageTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Cloudsweeper</title></head>
+<body>
+{{ if .Done }}
+<p>{{ .Username }}, you are unsubscribed from {{ .Description }}.</p>
+{{ else }}
+<form method="post">
+<p>Unsubscribe {{ .Username }} from {{ .Description }}?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+{{ end }}
+<p>Emails about your resources being marked or deleted are always sent.</p>
+</body>
+</html>
+`))
+
+type page struct {
+	Username    string
+	Description string
+	Done        bool
+}
+
+// Handler serves the signed unsubscribe links. Opening a link asks for
+// confirmation, since email scanners open links too, and confirming it
+// posts to the same link, as does one-click unsubscribe of mail clients,
+// which calls unsubscribe to record it.
+func Handler(key []byte, unsubscribe func(username, report string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		username, report := r.Form.Get("user"), r.Form.Get("report")
+		description, known := Reports[report]
+		if !known || !Verify(key, username, report, r.Form.Get("sig")) {
+			http.Error(w, "invalid unsubscribe link", http.StatusForbidden)
+			return
+		}
+		data := page{Username: username, Description: description}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := unsubscribe(username, report); err != nil {
+				log.Printf("Could not save that %s unsubscribed from %s: %s", username, report, err)
+				http.Error(w, "could not unsubscribe, please try again later", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s unsubscribed from %s", username, report)
+			data.Done = true
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := pageTemplate.Execute(w, data); err != nil {
+			log.Printf("Could not render unsubscribe page: %s", err)
+		}
+	})
+}
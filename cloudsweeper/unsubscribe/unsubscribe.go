@@ -0,0 +1,152 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package unsubscribe keeps track of the owners who unsubscribed from
+// informational emails, such as the review of old resources, through a
+// signed link in the emails. Emails about resources being marked or
+// deleted can't be unsubscribed from, so they aren't on the list.
+package unsubscribe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// All unsubscribes from every informational email at once
+const All = "all"
+
+// signatureBytes is how much of the HMAC is kept in links, which is
+// still plenty to make forging impractical
+const signatureBytes = 16
+
+// Reports are the informational emails which can be unsubscribed from,
+// and how they are described to owners
+var Reports = map[string]string{
+	"review":        "reviews of your old resources",
+	"untagged":      "notifications about untagged resources",
+	"notify-only":   "resources to review",
+	"archive":       "snapshot archive recommendations",
+	"multipart":     "incomplete multipart uploads",
+	"quota":         "service quotas nearly reached",
+	"spot":          "spot instance and savings plan recommendations",
+	"lifecycle":     "snapshot lifecycle policies compared with Cloudsweeper",
+	"bucket-growth": "fast growing buckets",
+	"missing-tags":  "warnings about new resources missing tags",
+	"digest":        "monthly digests of resources costing too little for their own email",
+	All:             "all informational emails",
+}
+
+// Subscription is an informational email an owner unsubscribed from
+type Subscription struct {
+	Username     string    `json:"username"`
+	Report       string    `json:"report"`
+	Unsubscribed time.Time `json:"unsubscribed"`
+}
+
+// List is the format of the unsubscribe file. It's safe to use from
+// several goroutines.
+type List struct {
+	Unsubscribed []*Subscription `json:"unsubscribed"`
+
+	mutex sync.Mutex
+}
+
+// ReadList reads a list written by Write
+func ReadList(r io.Reader) (*List, error) {
+	l := &List{}
+	if err := json.NewDecoder(r).Decode(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write writes the list as JSON, sorted by username and report
+func (l *List) Write(w io.Writer) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sort.Slice(l.Unsubscribed, func(i, j int) bool {
+		a, b := l.Unsubscribed[i], l.Unsubscribed[j]
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.Report < b.Report
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(l)
+}
+
+// IsUnsubscribed returns true if the user unsubscribed from the report,
+// or from all informational emails
+func (l *List) IsUnsubscribed(username, report string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, sub := range l.Unsubscribed {
+		if sub.Username == username && (sub.Report == report || sub.Report == All) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsubscribe records that the user unsubscribed from the report
+func (l *List) Unsubscribe(username, report string, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, sub := range l.Unsubscribed {
+		if sub.Username == username && sub.Report == report {
+			return
+		}
+	}
+	l.Unsubscribed = append(l.Unsubscribed, &Subscription{username, report, now.UTC()})
+}
+
+// Resubscribe removes the user from the list for the report, or from
+// the list altogether if the report is All. It returns false if the user
+// wasn't unsubscribed.
+func (l *List) Resubscribe(username, report string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	kept := []*Subscription{}
+	for _, sub := range l.Unsubscribed {
+		if sub.Username != username || (report != All && sub.Report != report) {
+			kept = append(kept, sub)
+		}
+	}
+	removed := len(kept) < len(l.Unsubscribed)
+	l.Unsubscribed = kept
+	return removed
+}
+
+// Sign returns the signature of the unsubscribe link of a user and report
+func Sign(key []byte, username, report string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, part := range []string{username, report} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
+
+// Verify checks the signature of an unsubscribe link
+func Verify(key []byte, username, report, signature string) bool {
+	return len(key) > 0 && hmac.Equal([]byte(signature), []byte(Sign(key, username, report)))
+}
+
+// Link returns the signed link unsubscribing the user from the report,
+// with baseURL being where Handler is served, e.g.
+// https://cloudsweeper.example.com/unsubscribe
+func Link(baseURL string, key []byte, username, report string) string {
+	query := url.Values{}
+	query.Set("user", username)
+	query.Set("report", report)
+	query.Set("sig", Sign(key, username, report))
+	return baseURL + "?" + query.Encode()
+}
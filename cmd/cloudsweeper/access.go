@@ -0,0 +1,60 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/setup"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// checkAccess checks that the Cloudsweeper role in every enabled account
+// is allowed everything the commands run by serve need, and that its
+// policy was made from the current policy template. Every problem is
+// recorded as a warning, so the check can gate a pipeline with
+// --fail-on=warnings.
+func checkAccess(csp cloud.CSP, org *cs.Organization) {
+	if csp != cloud.AWS {
+		fatalf("check-access only supports AWS, not %s", csp)
+	}
+	loadAccountNames(csp, org)
+	commands := listFromConfig(findConfig("serve-commands"))
+	actions := setup.RequiredAWSActions(append(commands, "check-access"))
+	log.Printf("Checking %d actions needed by %s", len(actions), strings.Join(commands, ", "))
+	found := cloud.AWSRoleAccess(org.EnabledAccounts(csp), actions, findConfigInt("account-parallelism"))
+	accounts := []string{}
+	for account := range found {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		access := found[account]
+		name := cloud.AccountDisplayName(account)
+		if access.Err != nil {
+			status.Warnf("%s: Could not check the Cloudsweeper role: %s", name, access.Err)
+			continue
+		}
+		ok := true
+		version, known := setup.DeployedPolicyVersion(access.StatementIDs)
+		if !known {
+			status.Warnf("%s: The Cloudsweeper policy is not from the policy template, expected version %d", name, setup.PolicyVersion)
+			ok = false
+		} else if version < setup.PolicyVersion {
+			status.Warnf("%s: The Cloudsweeper policy is from version %d of the policy template, expected version %d", name, version, setup.PolicyVersion)
+			ok = false
+		}
+		if len(access.Denied) > 0 {
+			status.Warnf("%s: The Cloudsweeper role is missing permissions: %s", name, strings.Join(access.Denied, ", "))
+			ok = false
+		}
+		if ok {
+			log.Printf("%s: The Cloudsweeper role is up to date", name)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+)
+
+// auditShow prints every action in the audit trail taken on a resource,
+// oldest first, and the tags, metadata and size it had when it was
+// deleted
+func auditShow(args []string) {
+	if len(args) < 2 || args[0] != "show" {
+		fatalln("Usage: cloudsweeper audit show <resource ID>")
+	}
+	id := args[1]
+	path := findConfig("audit-file")
+	f, err := os.Open(path)
+	if err != nil {
+		fatalf("Could not open audit trail %s: %s", path, err)
+	}
+	defer f.Close()
+	entries, err := audit.Read(f)
+	if err != nil {
+		fatalf("Could not read audit trail %s: %s", path, err)
+	}
+	found := audit.ForResource(entries, id)
+	if len(found) == 0 {
+		fmt.Printf("No actions on %s in %s\n", id, path)
+		return
+	}
+	for _, entry := range found {
+		fmt.Print(formatAuditEntry(entry))
+	}
+}
+
+func formatAuditEntry(entry audit.Entry) string {
+	var b strings.Builder
+	outcome := ""
+	switch {
+	case entry.Error != "":
+		outcome = " (failed: " + entry.Error + ")"
+	case entry.DryRun:
+		outcome = " (dry run)"
+	}
+	fmt.Fprintf(&b, "%s %s by %s from %s%s\n", entry.Time.Format(time.RFC3339), entry.Action, entry.Actor, entry.Source, outcome)
+	fmt.Fprintf(&b, "  Account:  %s\n", cloud.AccountDisplayName(entry.Account))
+	if entry.Location != "" {
+		fmt.Fprintf(&b, "  Location: %s\n", entry.Location)
+	}
+	if entry.Detail != "" {
+		fmt.Fprintf(&b, "  Detail:   %s\n", entry.Detail)
+	}
+	if res := entry.Resource; res != nil {
+		if !res.CreationTime.IsZero() {
+			fmt.Fprintf(&b, "  Created:  %s\n", res.CreationTime.Format(time.RFC3339))
+		}
+		if res.Name != "" {
+			fmt.Fprintf(&b, "  Name:     %s\n", res.Name)
+		}
+		if res.InstanceType != "" {
+			fmt.Fprintf(&b, "  Type:     %s\n", res.InstanceType)
+		}
+		if res.VolumeType != "" {
+			fmt.Fprintf(&b, "  Type:     %s\n", res.VolumeType)
+		}
+		if res.SizeGB > 0 {
+			fmt.Fprintf(&b, "  Size:     %d GB\n", res.SizeGB)
+		}
+		if res.TotalSizeGB > 0 || res.ObjectCount > 0 {
+			fmt.Fprintf(&b, "  Size:     %.2f GB in %d objects\n", res.TotalSizeGB, res.ObjectCount)
+		}
+		if res.Public {
+			fmt.Fprintf(&b, "  Public:   yes\n")
+		}
+		keys := make([]string, 0, len(res.Tags))
+		for key := range res.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) == 0 {
+			fmt.Fprintf(&b, "  Tags:     none\n")
+		} else {
+			fmt.Fprintf(&b, "  Tags:\n")
+		}
+		for _, key := range keys {
+			fmt.Fprintf(&b, "    %s=%s\n", key, res.Tags[key])
+		}
+	}
+	return b.String()
+}
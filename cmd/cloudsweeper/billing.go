@@ -0,0 +1,87 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+)
+
+// billingDateFormat is the format of --billing-start and --billing-end
+const billingDateFormat = "2006-01-02"
+
+// billingPeriodFromConfig returns the period of the billing report as of
+// now. --billing-start and --billing-end, which default to today, take
+// precedence over the preset of --billing-period.
+func billingPeriodFromConfig(period, start, end string, now time.Time) (billing.Period, error) {
+	if start == "" && end == "" {
+		return billing.PresetPeriod(period, now)
+	}
+	if start == "" {
+		return billing.Period{}, fmt.Errorf("billing-start must be set when billing-end is")
+	}
+	first, err := time.ParseInLocation(billingDateFormat, start, time.Local)
+	if err != nil {
+		return billing.Period{}, fmt.Errorf("Invalid billing-start '%s', must be on the form YYYY-MM-DD", start)
+	}
+	last := now
+	if end != "" {
+		if last, err = time.ParseInLocation(billingDateFormat, end, time.Local); err != nil {
+			return billing.Period{}, fmt.Errorf("Invalid billing-end '%s', must be on the form YYYY-MM-DD", end)
+		}
+	}
+	return billing.DateRangePeriod(first, last)
+}
+
+// billingPeriodReport returns the billing report of a period, with
+// credits and commitments counted as configured, in the currency of the
+// addressee
+func billingPeriodReport(reporter billing.Reporter, period billing.Period, org *cs.Organization) billing.Report {
+	report, err := billing.GenerateReportWithOptions(reporter, period, billingReportOptions())
+	if err != nil {
+		fatal(err)
+	}
+	if currency := org.CurrencyFor(findConfig("billing-report-addressee")); currency != "" && currency != billing.DefaultCurrency {
+		if err := report.InCurrency(currency, currencyRatesFromConfig(findConfig("currency-rates"))); err != nil {
+			fatalf("Could not convert report to %s: %s", currency, err)
+		}
+	}
+	return report
+}
+
+// billingReport logs and emails the billing report of the configured
+// period, compared with the previous equivalent period if configured
+func billingReport(csp cloud.CSP, org *cs.Organization) {
+	period, err := billingPeriodFromConfig(findConfig("billing-period"), findConfig("billing-start"), findConfig("billing-end"), time.Now())
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Reporting the costs from %s (%s)", period.Dates(), period.Name)
+	reporter := initBillingReporter(csp)
+	loadAccountNames(csp, org)
+	report := billingPeriodReport(reporter, period, org)
+	var previous *billing.Report
+	if findConfigBool("billing-compare") {
+		previousPeriod := period.Previous()
+		log.Printf("Comparing with the costs from %s", previousPeriod.Dates())
+		previousReport := billingPeriodReport(reporter, previousPeriod, org)
+		previous = &previousReport
+	}
+	mapping := org.AccountToUserMapping(csp)
+	sortTagKey := findConfig("billing-sort-tag")
+	log.Println(report.FormatReport(mapping, sortTagKey != ""))
+	attributions := org.AccountAttributions(csp)
+	log.Println(report.FormatAccountGroupReport("Cost center", attributions.CostCenters()))
+	log.Println(report.FormatAccountGroupReport("Project", attributions.Projects()))
+	if previous != nil {
+		log.Printf("Total cost %s, %s compared with %s", report.FormatCost(report.TotalCost()), report.FormatChange(report.TotalCost(), previous.TotalCost()), previous.Period.Dates())
+	}
+	client := initNotifyClient()
+	client.MonthToDateReport(report, previous, mapping, sortTagKey != "")
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/bulk"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/find"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// bulkAuditSource is the source of audit trail entries of bulk operations
+const bulkAuditSource = "bulk"
+
+// bulkOperation deletes or tags every resource in a file of IDs, e.g.
+// "delete --from-file ids.txt" or "tag --from-file ids.txt --key team
+// --value data". The flags of the operation follow it.
+func bulkOperation(csp cloud.CSP, org *cs.Organization, operation string, args []string) {
+	flags := flag.NewFlagSet(operation, flag.ExitOnError)
+	fromFile := flags.String("from-file", "", "File with one resource ID per line, lines starting with # are ignored")
+	key := flags.String("key", "", "Key of the tag set by tag")
+	value := flags.String("value", "", "Value of the tag set by tag")
+	dryRunFlag := flags.Bool("dry-run", false, "Only resolve the IDs and report what would be done")
+	reportFile := flags.String("report", "", "JSON file the result of every ID is written to")
+	force := flags.Bool("force", false, "Delete resources cleanup never deletes, such as disputed or backup-managed ones, unless whitelisted")
+	flags.Parse(args)
+	if *fromFile == "" {
+		fatalf("Usage: cloudsweeper %s --from-file <file with IDs> [flags]", operation)
+	}
+	if operation == "tag" && *key == "" {
+		fatalln("Please specify the tag to set with --key and --value")
+	}
+	dry := *dryRun || *dryRunFlag
+
+	f, err := os.Open(*fromFile)
+	if err != nil {
+		fatalf("Could not read IDs: %s", err)
+	}
+	ids, err := bulk.ReadIDs(f)
+	f.Close()
+	if err != nil {
+		fatalf("Could not read IDs from %s: %s", *fromFile, err)
+	}
+	if len(ids) == 0 {
+		fatalf("No IDs in %s", *fromFile)
+	}
+
+	var action bulk.Action
+	switch operation {
+	case "delete":
+		pol := parsePolicy(findConfig("policy-file"))
+		loadDisputed()
+		setCleanupOptions(func(opts *cleanup.Options) {
+			opts.EarlyDeletionFeeLimit = float64(findConfigInt("early-deletion-fee-limit"))
+			opts.ConfirmEarlyDeletionFees = *confirmEarlyDeletionFees
+			opts.HookPolicy = pol
+		})
+		action = func(res cloud.Resource, dryRun bool) error {
+			if filter.IsWhitelisted(res) {
+				return &bulk.SkipError{Reason: "Protected by the whitelist tag"}
+			}
+			if !*force {
+				// The same resources cleanup would never delete
+				if reason := cleanup.DeleteExclusion(res); reason != "" {
+					return &bulk.SkipError{Reason: reason}
+				}
+			}
+			if dryRun {
+				return nil
+			}
+			return cleanup.DeleteResource(res)
+		}
+	case "tag":
+		action = func(res cloud.Resource, dryRun bool) error {
+			if dryRun {
+				return nil
+			}
+			tagValue := *value
+			if *key == filter.DeleteTagKey {
+				// Unsigned delete tags are ignored if tags are signed
+				tagValue = filter.SignTagValue(res, *key, tagValue)
+			}
+			return res.SetTag(*key, tagValue, true)
+		}
+	}
+	trail := audit.NewTrail(findConfig("audit-file"))
+	detail := ""
+	if operation == "tag" {
+		detail = fmt.Sprintf("%s=%s", *key, *value)
+	}
+	audited := func(res cloud.Resource, dryRun bool) error {
+		var snapshot *cloud.InventoryRecord
+		if operation == "delete" {
+			// Taken before deleting, so what was deleted is known
+			snapshot = audit.Snapshot(res)
+		}
+		err := action(res, dryRun)
+		entry := audit.Entry{
+			Actor:      audit.CurrentActor(),
+			Source:     bulkAuditSource,
+			Action:     operation,
+			Account:    res.Owner(),
+			ResourceID: res.ID(),
+			Location:   res.Location(),
+			Detail:     detail,
+			DryRun:     dryRun,
+			Resource:   snapshot,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if auditErr := trail.Record(entry); auditErr != nil {
+			status.Warnf("Could not record the %s of %s in the audit trail: %s", operation, res.ID(), auditErr)
+		}
+		return err
+	}
+
+	log.Printf("Resolving %d IDs", len(ids))
+	mngr := initBulkManager(csp, org, ids)
+	if operation == "delete" {
+		loadRetainedImages(mngr)
+	}
+	resolved, unresolved := bulk.Resolve(mngr, ids)
+	if dry {
+		log.Printf("Dry run, not going to %s any of the %d resources found", operation, len(resolved))
+	}
+	results := bulk.Run(ids, resolved, unresolved, audited, findConfigInt("bulk-parallelism"), dry)
+	fmt.Print(bulk.FormatResults(results))
+	for _, result := range results {
+		if result.Outcome == bulk.OutcomeFailed {
+			status.ActionFailedf("Could not %s %s: %s", operation, result.ID, result.Detail)
+		}
+	}
+	if *reportFile != "" {
+		out, err := os.Create(*reportFile)
+		if err != nil {
+			fatalf("Could not create report file: %s", err)
+		}
+		defer out.Close()
+		if err := bulk.WriteReport(out, operation, dry, results); err != nil {
+			fatalf("Could not write report file: %s", err)
+		}
+		log.Printf("Wrote the result of every ID to %s", *reportFile)
+	}
+}
+
+// initBulkManager returns a manager of every account. If every ID is an
+// AWS resource ID with a known type, only those types are discovered.
+func initBulkManager(csp cloud.CSP, org *cs.Organization, ids []string) cloud.ResourceManager {
+	loadAccountNames(csp, org)
+	config := managerConfig(csp, org)
+	if csp == cloud.AWS {
+		types := []string{}
+		for _, id := range ids {
+			resourceType, isID := find.ResourceTypeOfID(id)
+			if !isID {
+				types = nil
+				break
+			}
+			if !contains(types, resourceType) {
+				types = append(types, resourceType)
+			}
+		}
+		for _, resourceType := range cloud.ResourceTypes {
+			if types != nil && !contains(types, resourceType) {
+				config.DisabledResourceTypes = append(config.DisabledResourceTypes, resourceType)
+			}
+		}
+	}
+	mngr, err := cloud.NewManagerWithConfig(csp, config, managedAccounts(org.EnabledAccounts(csp))...)
+	if err != nil {
+		fatal(err)
+	}
+	return mngr
+}
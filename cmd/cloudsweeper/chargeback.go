@@ -0,0 +1,99 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/chargeback"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// chargebackMonthFormat is the format of --chargeback-month
+const chargebackMonthFormat = "2006-01"
+
+// chargebackReport emails the chargeback statement of the month to the
+// lead of every team, with the PDF version attached, and archives both
+// versions in the chargeback bucket, if there is one. Costs are in the
+// currency of the recipient. In a dry run the statements are only logged.
+func chargebackReport(csp cloud.CSP, org *cs.Organization) {
+	month := chargebackMonthFromConfig(findConfig("chargeback-month"))
+	log.Printf("Generating the chargeback statements of %s", month.Format(chargebackMonthFormat))
+	report, err := billing.GenerateReportWithOptions(initBillingReporter(csp), billing.MonthPeriod(month), billingReportOptions())
+	if err != nil {
+		fatal(err)
+	}
+	loadAccountNames(csp, org)
+	statements := chargeback.Generate(report, org, csp, month)
+	if len(statements) == 0 {
+		log.Println("No costs to charge back")
+		return
+	}
+
+	var archive chargeback.Archive
+	if bucket := findConfig("chargeback-bucket"); bucket != "" {
+		archive = chargeback.NewS3Archive(bucket, findConfig("chargeback-prefix"), awsBucketRegion(bucket, findConfig("chargeback-bucket-region")))
+	}
+	client := initNotifyClient()
+	var rates billing.CurrencyRates
+	for _, statement := range statements {
+		recipient := findConfig("total-sum-addressee")
+		if statement.Lead != nil {
+			recipient = statement.Lead.Username
+		}
+		if currency := org.CurrencyFor(recipient); currency != "" && currency != billing.DefaultCurrency {
+			if rates == nil {
+				rates = currencyRatesFromConfig(findConfig("currency-rates"))
+			}
+			if err := statement.Report.InCurrency(currency, rates); err != nil {
+				fatalf("Could not convert the statement of %s to %s: %s", statement.TeamName(), currency, err)
+			}
+		}
+		log.Printf("%s: %d accounts, %s to %s", statement.TeamName(), len(statement.Lines), statement.Report.FormatCost(statement.Total), recipient)
+		if *dryRun {
+			continue
+		}
+
+		html, err := client.ChargebackHTML(statement)
+		if err != nil {
+			fatalln("Could not generate chargeback statement:", err)
+		}
+		var pdf bytes.Buffer
+		if err := statement.WritePDF(&pdf); err != nil {
+			fatalln("Could not generate chargeback statement:", err)
+		}
+		client.ChargebackStatement(statement, html, pdf.Bytes())
+		if archive == nil {
+			continue
+		}
+		if err := archive.Store(statement, statement.FileName("html"), "text/html", []byte(html)); err != nil {
+			status.ActionFailedf("Could not archive the chargeback statement of %s: %s", statement.TeamName(), err)
+		}
+		if err := archive.Store(statement, statement.FileName("pdf"), "application/pdf", pdf.Bytes()); err != nil {
+			status.ActionFailedf("Could not archive the chargeback statement of %s: %s", statement.TeamName(), err)
+		}
+	}
+	if *dryRun {
+		log.Println("Not sending or archiving the chargeback statements since this was a dry run")
+	}
+}
+
+// chargebackMonthFromConfig returns the first day of the configured
+// month, or of last month if none is configured
+func chargebackMonthFromConfig(raw string) time.Time {
+	if raw == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local)
+	}
+	month, err := time.ParseInLocation(chargebackMonthFormat, raw, time.Local)
+	if err != nil {
+		fatalf("Invalid chargeback month '%s', must be on the form YYYY-MM", raw)
+	}
+	return month
+}
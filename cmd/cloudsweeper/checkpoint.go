@@ -0,0 +1,80 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/distribute"
+)
+
+// checkpointStore returns the store the checkpoints of cleanup runs are
+// saved in. It's the work bucket if there is one, so workers resume the
+// items of each other, and the checkpoint directory otherwise.
+func checkpointStore() distribute.Store {
+	if findConfig("work-bucket") != "" {
+		return initWorkStore()
+	}
+	return distribute.NewFileStore(findConfig("checkpoint-dir"))
+}
+
+// initCleanupManager starts a new cleanup run, or resumes the run of
+// --resume, and returns the manager of the accounts the run isn't
+// finished in. The resource types already cleaned up in an account
+// aren't discovered again. Nil is returned if the run is finished in
+// every account.
+func initCleanupManager(csp cloud.CSP, org *cs.Organization) cloud.ResourceManager {
+	run := *resumeRun
+	if run == "" {
+		run = distribute.NewRun("cleanup", time.Now())
+	}
+	progress, err := distribute.LoadProgress(checkpointStore(), run)
+	if err != nil {
+		fatalf("Could not load the checkpoints of run %s: %s", run, err)
+	}
+	setCleanupOptions(func(opts *cleanup.Options) { opts.Checkpoints = progress })
+	if *resumeRun != "" {
+		log.Printf("Resuming cleanup run %s", run)
+	} else {
+		log.Printf("Starting cleanup run %s, resume it with --resume=%s if it's interrupted", run, run)
+	}
+
+	loadAccountNames(csp, org)
+	config := managerConfig(csp, org)
+	steps := cleanup.Steps(*deleteEmptyBuckets)
+	disabled := make(map[string][]string)
+	accounts := []string{}
+	for _, account := range managedAccounts(org.EnabledAccounts(csp)) {
+		if progress.Finished(account, steps) {
+			log.Printf("Run %s already cleaned up %s, skipping", run, cloud.AccountDisplayName(account))
+			continue
+		}
+		accounts = append(accounts, account)
+		disabled[account] = append([]string{}, config.OwnerDisabledResourceTypes[account]...)
+		for _, resourceType := range cloud.ResourceTypes {
+			if !progress.Done(account, resourceType) {
+				continue
+			}
+			if resourceType == cloud.ResourceTypeBuckets && *deleteEmptyBuckets && !progress.Done(account, cleanup.StepEmptyBuckets) {
+				// Still needed to delete the empty buckets
+				continue
+			}
+			disabled[account] = append(disabled[account], resourceType)
+		}
+	}
+	if len(accounts) == 0 {
+		log.Printf("Run %s already cleaned up every account", run)
+		return nil
+	}
+	config.OwnerDisabledResourceTypes = disabled
+	manager, err := cloud.NewManagerWithConfig(csp, config, accounts...)
+	if err != nil {
+		fatal(err)
+	}
+	return manager
+}
@@ -5,99 +5,364 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/graph"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/notify"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/secrets"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/security"
 	"github.com/joho/godotenv"
 )
 
-const optionalDefault = "<optional>"
+const (
+	optionalDefault  = "<optional>"
+	currencyRatesECB = "ecb"
+)
 
 type lookup struct {
 	confKey      string
 	defaultValue string
+	// secret options, such as passwords and keys, are never printed by
+	// config effective
+	secret bool
 }
 
 var configMapping = map[string]lookup{
 	// General variables
-	"csp":      {"CS_CSP", "aws"},
-	"org-file": {"CS_ORG_FILE", "organization.json"},
+	"csp":         {"CS_CSP", "aws", false},
+	"org-file":    {"CS_ORG_FILE", "organization.json", false},
+	"policy-file": {"CS_POLICY_FILE", optionalDefault, false},
+	"fail-on":     {"CS_FAIL_ON", "errors", false},
+
+	// Shadow policy
+	"shadow-policy-file": {"CS_SHADOW_POLICY_FILE", optionalDefault, false},
+
+	// Recorded inventory
+	"inventory-file":          {"CS_INVENTORY_FILE", "inventory.json", false},
+	"previous-inventory-file": {"CS_PREVIOUS_INVENTORY_FILE", "previous-inventory.json", false},
+
+	// Resource graphs
+	"graph-dir":    {"CS_GRAPH_DIR", "graphs", false},
+	"graph-format": {"CS_GRAPH_FORMAT", graph.FormatDOT, false},
+
+	// Terminal UI
+	"audit-file":    {"CS_AUDIT_FILE", "audit.jsonl", false},
+	"tui-mark-days": {"CS_TUI_MARK_DAYS", "4", false},
+
+	// Bulk operations
+	"bulk-parallelism": {"CS_BULK_PARALLELISM", "5", false},
+
+	// Policy tests
+	"policy-test-file": {"CS_POLICY_TEST_FILE", "policy-tests.yaml", false},
+
+	// Directory sync
+	"directory":                      {"CS_DIRECTORY", optionalDefault, false},
+	"directory-url":                  {"CS_DIRECTORY_URL", optionalDefault, false},
+	"directory-token":                {"CS_DIRECTORY_TOKEN", optionalDefault, true},
+	"directory-max-disabled-percent": {"CS_DIRECTORY_MAX_DISABLED_PERCENT", "10", false},
+
+	// Serve mode
+	"serve-commands":       {"CS_SERVE_COMMANDS", "review,mark-for-cleanup,warn,cleanup", false},
+	"serve-interval":       {"CS_SERVE_INTERVAL", "24h", false},
+	"serve-watch-interval": {"CS_SERVE_WATCH_INTERVAL", "1m", false},
+	"grpc-address":         {"CS_GRPC_ADDRESS", optionalDefault, false},
+	"grpc-token":           {"CS_GRPC_TOKEN", optionalDefault, true},
+	"grpc-tls-cert":        {"CS_GRPC_TLS_CERT", optionalDefault, false},
+	"grpc-tls-key":         {"CS_GRPC_TLS_KEY", optionalDefault, false},
+	"grpc-client-ca":       {"CS_GRPC_CLIENT_CA", optionalDefault, false},
+	"health-address":       {"CS_HEALTH_ADDRESS", optionalDefault, false},
+
+	"account-parallelism": {"CS_ACCOUNT_PARALLELISM", "10", false},
+	"account-timeout":     {"CS_ACCOUNT_TIMEOUT", "1h", false},
+	"region-timeout":      {"CS_REGION_TIMEOUT", "20m", false},
+	"metrics-file":        {"CS_METRICS_FILE", optionalDefault, false},
+
+	// Resource types
+	"enable-instances": {"CS_ENABLE_INSTANCES", "true", false},
+	"enable-images":    {"CS_ENABLE_IMAGES", "true", false},
+	"enable-volumes":   {"CS_ENABLE_VOLUMES", "true", false},
+	"enable-snapshots": {"CS_ENABLE_SNAPSHOTS", "true", false},
+	"enable-buckets":   {"CS_ENABLE_BUCKETS", "true", false},
+
+	// AWS discovery
+	"aws-config-aggregator":        {"CS_AWS_CONFIG_AGGREGATOR", optionalDefault, false},
+	"aws-config-aggregator-region": {"CS_AWS_CONFIG_AGGREGATOR_REGION", "us-west-2", false},
+	"aws-last-used-days":           {"CS_AWS_LAST_USED_DAYS", "0", false},
+	"aws-last-tagged-days":         {"CS_AWS_LAST_TAGGED_DAYS", "0", false},
+	"aws-bucket-read-days":         {"CS_AWS_BUCKET_READ_DAYS", "0", false},
+	"aws-region-parallelism":       {"CS_AWS_REGION_PARALLELISM", "0", false},
+	"aws-account-aliases":          {"CS_AWS_ACCOUNT_ALIASES", "true", false},
+	"aws-console-sso-start-url":    {"CS_AWS_CONSOLE_SSO_START_URL", optionalDefault, false},
+	"aws-console-sso-role":         {"CS_AWS_CONSOLE_SSO_ROLE", optionalDefault, false},
+
+	// GCP access
+	"gcp-impersonate":   {"CS_GCP_IMPERSONATE", optionalDefault, false},
+	"gcp-quota-project": {"CS_GCP_QUOTA_PROJECT", optionalDefault, false},
+
+	// Other CSPs
+	"provider-plugins":         {"CS_PROVIDER_PLUGINS", optionalDefault, false},
+	"kubernetes-clusters-file": {"CS_KUBERNETES_CLUSTERS_FILE", optionalDefault, false},
+	"kubernetes-idle-days":     {"CS_KUBERNETES_IDLE_DAYS", "14", false},
+	"kubernetes-owner-label":   {"CS_KUBERNETES_OWNER_LABEL", "owner", false},
+	"vsphere-servers-file":     {"CS_VSPHERE_SERVERS_FILE", optionalDefault, false},
+
+	// Tag keys
+	"whitelist-tag-key":      {"CS_WHITELIST_TAG_KEY", "cloudsweeper-whitelisted", false},
+	"lifetime-tag-key":       {"CS_LIFETIME_TAG_KEY", "cloudsweeper-lifetime", false},
+	"expiry-tag-key":         {"CS_EXPIRY_TAG_KEY", "cloudsweeper-expiry", false},
+	"delete-tag-key":         {"CS_DELETE_TAG_KEY", "cloudsweeper-delete-at", false},
+	"delete-reason-tag-key":  {"CS_DELETE_REASON_TAG_KEY", "cloudsweeper-delete-reason", false},
+	"delete-policy-tag-key":  {"CS_DELETE_POLICY_TAG_KEY", "cloudsweeper-delete-policy", false},
+	"encrypted-copy-tag-key": {"CS_ENCRYPTED_COPY_TAG_KEY", "cloudsweeper-encrypted-copy", false},
+	"encrypted-from-tag-key": {"CS_ENCRYPTED_FROM_TAG_KEY", "cloudsweeper-encrypted-from", false},
+	"archived-tag-key":       {"CS_ARCHIVED_TAG_KEY", "cloudsweeper-archived", false},
+	"needs-owner-tag-key":    {"CS_NEEDS_OWNER_TAG_KEY", "cloudsweeper-needs-owner", false},
+	"claimed-by-tag-key":     {"CS_CLAIMED_BY_TAG_KEY", "cloudsweeper-claimed-by", false},
+	"tag-signing-key":        {"CS_TAG_SIGNING_KEY", optionalDefault, true},
+
+	// Cost attribution
+	"cost-center-tag-key": {"CS_COST_CENTER_TAG_KEY", "cost-center", false},
+	"project-tag-key":     {"CS_PROJECT_TAG_KEY", "project", false},
 
 	// Billing related
-	"billing-account":       {"CS_BILLING_ACCOUNT", ""},
-	"billing-bucket-region": {"CS_BILLING_BUCKET_REGION", ""},
-	"billing-csv-prefix":    {"CS_BILLING_CSV_PREFIX", ""},
-	"billing-bucket":        {"CS_BILLING_BUCKET_NAME", ""},
-	"billing-sort-tag":      {"CS_BILLING_SORT_TAG", optionalDefault},
+	"billing-account":       {"CS_BILLING_ACCOUNT", "", false},
+	"billing-bucket-region": {"CS_BILLING_BUCKET_REGION", optionalDefault, false},
+	"billing-csv-prefix":    {"CS_BILLING_CSV_PREFIX", "", false},
+	"billing-bucket":        {"CS_BILLING_BUCKET_NAME", "", false},
+	"billing-sort-tag":      {"CS_BILLING_SORT_TAG", optionalDefault, false},
+
+	"billing-include-credits":        {"CS_BILLING_INCLUDE_CREDITS", "true", false},
+	"billing-amortize-commitments":   {"CS_BILLING_AMORTIZE_COMMITMENTS", "false", false},
+	"billing-commitment-term-months": {"CS_BILLING_COMMITMENT_TERM_MONTHS", "12", false},
+	"billing-period":                 {"CS_BILLING_PERIOD", billing.PeriodMonth, false},
+	"billing-start":                  {"CS_BILLING_START", optionalDefault, false},
+	"billing-end":                    {"CS_BILLING_END", optionalDefault, false},
+	"billing-compare":                {"CS_BILLING_COMPARE", "false", false},
+	"currency-rates":                 {"CS_CURRENCY_RATES", optionalDefault, false},
+
+	// Chargeback statements
+	"chargeback-month":         {"CS_CHARGEBACK_MONTH", optionalDefault, false},
+	"chargeback-bucket":        {"CS_CHARGEBACK_BUCKET", optionalDefault, false},
+	"chargeback-prefix":        {"CS_CHARGEBACK_PREFIX", optionalDefault, false},
+	"chargeback-bucket-region": {"CS_CHARGEBACK_BUCKET_REGION", optionalDefault, false},
 
 	// Email variables
-	"smtp-username": {"CS_SMTP_USER", ""},
-	"smtp-password": {"CS_SMTP_PASSWORD", ""},
-	"smtp-server":   {"CS_SMTP_SERVER", ""},
-	"smtp-port":     {"CS_SMTP_PORT", "587"},
+	"smtp-username": {"CS_SMTP_USER", "", false},
+	"smtp-password": {"CS_SMTP_PASSWORD", "", true},
+	"smtp-server":   {"CS_SMTP_SERVER", "", false},
+	"smtp-port":     {"CS_SMTP_PORT", "587", false},
 
 	// Notifying specific variables
-	"warning-hours":            {"CS_WARNING_HOURS", "48"},
-	"display-name":             {"CS_DISPLAY_NAME", "Cloudsweeper"},
-	"mail-from":                {"CS_MAIL_FROM", ""},
-	"billing-report-addressee": {"CS_BILLING_REPORT_ADDRESSEE", ""},
-	"total-sum-addressee":      {"CS_TOTAL_SUM_ADDRESSEE", ""},
-	"mail-domain":              {"CS_EMAIL_DOMAIN", ""},
+	"warning-hours":            {"CS_WARNING_HOURS", "48", false},
+	"display-name":             {"CS_DISPLAY_NAME", "Cloudsweeper", false},
+	"mail-from":                {"CS_MAIL_FROM", "", false},
+	"billing-report-addressee": {"CS_BILLING_REPORT_ADDRESSEE", "", false},
+	"total-sum-addressee":      {"CS_TOTAL_SUM_ADDRESSEE", "", false},
+	"mail-domain":              {"CS_EMAIL_DOMAIN", "", false},
+	"mail-time-zone":           {"CS_MAIL_TIME_ZONE", notify.DefaultTimeZone, false},
+
+	// Disputed resources
+	"dispute-file": {"CS_DISPUTE_FILE", "disputes.json", false},
+
+	// Unsubscribing from informational emails
+	"unsubscribe-file": {"CS_UNSUBSCRIBE_FILE", "unsubscribes.json", false},
+	"unsubscribe-url":  {"CS_UNSUBSCRIBE_URL", optionalDefault, false},
+	"unsubscribe-key":  {"CS_UNSUBSCRIBE_KEY", optionalDefault, true},
+
+	// Delivery tracking
+	"delivery-log-file":       {"CS_DELIVERY_LOG_FILE", optionalDefault, false},
+	"bounce-queue-url":        {"CS_BOUNCE_QUEUE_URL", optionalDefault, false},
+	"event-queue-url":         {"CS_EVENT_QUEUE_URL", optionalDefault, false},
+	"bounce-escalation-count": {"CS_BOUNCE_ESCALATION_COUNT", "3", false},
+
+	// Distributed runs
+	"work-queue-url":     {"CS_WORK_QUEUE_URL", optionalDefault, false},
+	"work-bucket":        {"CS_WORK_BUCKET", optionalDefault, false},
+	"work-prefix":        {"CS_WORK_PREFIX", optionalDefault, false},
+	"work-bucket-region": {"CS_WORK_BUCKET_REGION", optionalDefault, false},
+	"distribute-timeout": {"CS_DISTRIBUTE_TIMEOUT", "2h", false},
 
 	// Setup variables
-	"aws-master-arn": {"CS_MASTER_ARN", ""},
+	"aws-master-arn": {"CS_MASTER_ARN", "", false},
 
 	// Clean thresholds
-	"clean-untagged-older-than-days":   {"CLEAN_UNTAGGED_OLDER_THAN_DAYS", "30"},
-	"clean-instances-older-than-days":  {"CLEAN_INSTANCES_OLDER_THAN_DAYS", "182"},
-	"clean-images-older-than-days":     {"CLEAN_IMAGES_OLDER_THAN_DAYS", "182"},
-	"clean-snapshots-older-than-days":  {"CLEAN_SNAPSHOTS_OLDER_THAN_DAYS", "182"},
-	"clean-unattached-older-than-days": {"CLEAN_UNATTACHED_OLDER_THAN_DAYS", "30"},
-	"clean-bucket-not-modified-days":   {"CLEAN_BUCKET_NOT_MODIFIED_DAYS", "182"},
-	"clean-bucket-older-than-days":     {"CLEAN_BUCKET_OLDER_THAN_DAYS", "7"},
-	"clean-keep-n-component-images":    {"CLEAN_KEEP_N_COMPONENT_IMAGES", "2"},
+	"clean-untagged-older-than-days":   {"CLEAN_UNTAGGED_OLDER_THAN_DAYS", "30", false},
+	"clean-instances-older-than-days":  {"CLEAN_INSTANCES_OLDER_THAN_DAYS", "182", false},
+	"clean-images-older-than-days":     {"CLEAN_IMAGES_OLDER_THAN_DAYS", "182", false},
+	"clean-snapshots-older-than-days":  {"CLEAN_SNAPSHOTS_OLDER_THAN_DAYS", "182", false},
+	"clean-unattached-older-than-days": {"CLEAN_UNATTACHED_OLDER_THAN_DAYS", "30", false},
+	"clean-bucket-not-modified-days":   {"CLEAN_BUCKET_NOT_MODIFIED_DAYS", "182", false},
+	"clean-bucket-older-than-days":     {"CLEAN_BUCKET_OLDER_THAN_DAYS", "7", false},
+	"clean-keep-n-component-images":    {"CLEAN_KEEP_N_COMPONENT_IMAGES", "2", false},
+
+	// Images kept for image pipelines
+	"image-pipeline-sources": {"CS_IMAGE_PIPELINE_SOURCES", optionalDefault, false},
+	"image-pipeline-keep-n":  {"CS_IMAGE_PIPELINE_KEEP_N", "3", false},
+
+	// Resources managed by AWS Backup
+	"exclude-backup-managed": {"CS_EXCLUDE_BACKUP_MANAGED", "true", false},
+	"exclude-dlm-managed":    {"CS_EXCLUDE_DLM_MANAGED", "true", false},
+
+	// Cost thresholds of marking
+	"mark-cost-threshold":          {"CS_MARK_COST_THRESHOLD", "10", false},
+	"mark-resource-cost-threshold": {"CS_MARK_RESOURCE_COST_THRESHOLD", "0", false},
+	"mark-owner-cost-thresholds":   {"CS_MARK_OWNER_COST_THRESHOLDS", optionalDefault, false},
+
+	// Cost thresholds of notifications
+	"notify-cost-threshold":        {"CS_NOTIFY_COST_THRESHOLD", "0", false},
+	"notify-owner-cost-thresholds": {"CS_NOTIFY_OWNER_COST_THRESHOLDS", optionalDefault, false},
+	"notify-digest-file":           {"CS_NOTIFY_DIGEST_FILE", "notify-digest.json", false},
+
+	// Resources marked again and again
+	"remark-file":             {"CS_REMARK_FILE", "remarks.json", false},
+	"remark-escalation-count": {"CS_REMARK_ESCALATION_COUNT", "3", false},
+
+	// Resources marked under outdated policies
+	"outdated-marks": {"CS_OUTDATED_MARKS", "delete", false},
+
+	// Quota review
+	"quota-usage-percent": {"CS_QUOTA_USAGE_PERCENT", "80", false},
+
+	// Spot review
+	"spot-review-accounts":              {"CS_SPOT_REVIEW_ACCOUNTS", optionalDefault, false},
+	"spot-review-running-days":          {"CS_SPOT_REVIEW_RUNNING_DAYS", "30", false},
+	"spot-review-savings-plan-discount": {"CS_SPOT_REVIEW_SAVINGS_PLAN_DISCOUNT", "28", false},
+
+	// Right-sizing recommendations in review emails
+	"review-rightsizing":         {"CS_REVIEW_RIGHTSIZING", "false", false},
+	"rightsizing-days":           {"CS_RIGHTSIZING_DAYS", "14", false},
+	"rightsizing-cpu-percent":    {"CS_RIGHTSIZING_CPU_PERCENT", "40", false},
+	"rightsizing-memory-percent": {"CS_RIGHTSIZING_MEMORY_PERCENT", "40", false},
+
+	// Change freezes
+	"freeze-windows": {"CS_FREEZE_WINDOWS", optionalDefault, false},
 
 	//  Notify thresholds
-	"notify-untagged-older-than-days":   {"NOTIFY_UNTAGGED_OLDER_THAN_DAYS", "14"},
-	"notify-instances-older-than-days":  {"NOTIFY_INSTANCES_OLDER_THAN_DAYS", "30"},
-	"notify-images-older-than-days":     {"NOTIFY_IMAGES_OLDER_THAN_DAYS", "30"},
-	"notify-unattached-older-than-days": {"NOTIFY_UNATTACHED_OLDER_THAN_DAYS", "30"},
-	"notify-snapshots-older-than-days":  {"NOTIFY_SNAPSHOTS_OLDER_THAN_DAYS", "30"},
-	"notify-buckets-older-than-days":    {"NOTIFY_BUCKETS_OLDER_THAN_DAYS", "30"},
-	"notify-whitelist-older-than-days":  {"NOTIFY_WHITELIST_OLDER_THAN_DAYS", "182"},
-	"notify-dnd-older-than-days":        {"NOTIFY_DND_OLDER_THAN_DAYS", "7"},
+	"notify-untagged-older-than-days":   {"NOTIFY_UNTAGGED_OLDER_THAN_DAYS", "14", false},
+	"notify-instances-older-than-days":  {"NOTIFY_INSTANCES_OLDER_THAN_DAYS", "30", false},
+	"notify-images-older-than-days":     {"NOTIFY_IMAGES_OLDER_THAN_DAYS", "30", false},
+	"notify-unattached-older-than-days": {"NOTIFY_UNATTACHED_OLDER_THAN_DAYS", "30", false},
+	"notify-snapshots-older-than-days":  {"NOTIFY_SNAPSHOTS_OLDER_THAN_DAYS", "30", false},
+	"notify-buckets-older-than-days":    {"NOTIFY_BUCKETS_OLDER_THAN_DAYS", "30", false},
+	"notify-whitelist-older-than-days":  {"NOTIFY_WHITELIST_OLDER_THAN_DAYS", "182", false},
+	"notify-dnd-older-than-days":        {"NOTIFY_DND_OLDER_THAN_DAYS", "7", false},
+
+	"required-tags": {"REQUIRED_TAGS", optionalDefault, false},
+
+	// Self-service
+	"me-account":        {"CS_ME_ACCOUNT", optionalDefault, false},
+	"extend-days":       {"CS_EXTEND_DAYS", "7", false},
+	"max-extend-days":   {"CS_MAX_EXTEND_DAYS", "30", false},
+	"owner-signing-key": {"CS_OWNER_SIGNING_KEY", optionalDefault, true},
+
+	// Replies to emails
+	"replies-bucket":        {"CS_REPLIES_BUCKET", optionalDefault, false},
+	"replies-prefix":        {"CS_REPLIES_PREFIX", optionalDefault, false},
+	"replies-bucket-region": {"CS_REPLIES_BUCKET_REGION", optionalDefault, false},
+	"replies-authserv-id":   {"CS_REPLIES_AUTHSERV_ID", "amazonses.com", false},
+
+	// Departed owners review
+	"needs-owner-days": {"CS_NEEDS_OWNER_DAYS", "14", false},
 
-	"required-tags": {"REQUIRED_TAGS", optionalDefault},
+	// Security review
+	"sensitive-ports":   {"CS_SENSITIVE_PORTS", optionalDefault, false},
+	"temporary-tag-key": {"CS_TEMPORARY_TAG_KEY", "cloudsweeper-temporary", false},
+
+	// Snapshot archive review
+	"archive-snapshots-older-than-days": {"CS_ARCHIVE_SNAPSHOTS_OLDER_THAN_DAYS", "90", false},
+
+	// Cleanup of buckets
+	"early-deletion-fee-limit": {"CS_EARLY_DELETION_FEE_LIMIT", "10", false},
+
+	// Resumable cleanup
+	"cleanup-deletes-per-minute": {"CS_CLEANUP_DELETES_PER_MINUTE", "0", false},
+	"checkpoint-dir":             {"CS_CHECKPOINT_DIR", "checkpoints", false},
+
+	// Multipart upload review
+	"multipart-uploads-older-than-days": {"CS_MULTIPART_UPLOADS_OLDER_THAN_DAYS", "7", false},
+
+	// File system review
+	"file-system-idle-days":         {"CS_FILE_SYSTEM_IDLE_DAYS", "30", false},
+	"file-system-delete-after-days": {"CS_FILE_SYSTEM_DELETE_AFTER_DAYS", "7", false},
+
+	// VPN review
+	"vpn-idle-days":         {"CS_VPN_IDLE_DAYS", "30", false},
+	"vpn-delete-after-days": {"CS_VPN_DELETE_AFTER_DAYS", "7", false},
+
+	// Cluster review
+	"cluster-idle-hours":            {"CS_CLUSTER_IDLE_HOURS", "6", false},
+	"cluster-terminate-after-hours": {"CS_CLUSTER_TERMINATE_AFTER_HOURS", "24", false},
+
+	// GPU review
+	"gpu-idle-hours":         {"CS_GPU_IDLE_HOURS", "8", false},
+	"gpu-idle-percent":       {"CS_GPU_IDLE_PERCENT", "5", false},
+	"gpu-delete-after-hours": {"CS_GPU_DELETE_AFTER_HOURS", "24", false},
+
+	// Machine learning review
+	"ml-idle-days":         {"CS_ML_IDLE_DAYS", "3", false},
+	"ml-delete-after-days": {"CS_ML_DELETE_AFTER_DAYS", "7", false},
+	"ml-owner-tag":         {"CS_ML_OWNER_TAG", "owner", false},
+
+	// Monitoring review
+	"monitoring-unused-days": {"CS_MONITORING_UNUSED_DAYS", "30", false},
+
+	// Network review
+	"network-created-days":      {"CS_NETWORK_CREATED_DAYS", "7", false},
+	"network-delete-after-days": {"CS_NETWORK_DELETE_AFTER_DAYS", "7", false},
+
+	// Image copy review
+	"image-copy-regions":     {"CS_IMAGE_COPY_REGIONS", optionalDefault, false},
+	"image-copy-unused-days": {"CS_IMAGE_COPY_UNUSED_DAYS", "30", false},
+
+	// Bucket growth review
+	"bucket-history-file":   {"CS_BUCKET_HISTORY_FILE", "bucket-history.json", false},
+	"bucket-growth-percent": {"CS_BUCKET_GROWTH_PERCENT", "20", false},
 }
 
 func loadFile(fileName string) {
 	var err error
-	config, err = godotenv.Read(fileName)
+	config, err = readConfigFile(fileName)
 	if err != nil {
-		log.Fatalf("Could not load config file '%s': %s", fileName, err)
+		fatalf("Could not load config file '%s': %s", fileName, err)
 	}
 }
 
-func loadDoNotDelete() {
-	if doNotDelete == nil {
-		doNotDelete = make(map[string]bool)
+// readConfigFile reads the config file. Without a config file, all the
+// config comes from environment variables and flags, e.g. in a container.
+func readConfigFile(fileName string) (map[string]string, error) {
+	values, err := godotenv.Read(fileName)
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil
 	}
-	dndFile, err := os.Open(doNotDeleteFileName)
+	return values, err
+}
+
+func loadDoNotDelete() {
+	// Start over, so a reloaded list doesn't keep removed entries
+	doNotDelete = make(map[string]bool)
+	raw, err := readInputFile(doNotDeleteFileName)
 	if err != nil {
 		fmt.Println(err)
 	}
-	defer dndFile.Close()
-	scanner := bufio.NewScanner(dndFile)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
 	for scanner.Scan() {
 		doNotDelete[strings.Trim(scanner.Text(), " ")] = true
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 }
 
@@ -107,29 +372,128 @@ func loadThresholds() {
 	}
 }
 
+// setCleanupOptions changes some of the options marking and cleanup run
+// with, keeping the others
+func setCleanupOptions(change func(*cleanup.Options)) {
+	opts := cleanup.CurrentOptions()
+	change(&opts)
+	cleanup.SetOptions(opts)
+}
+
+// loadHookPolicy sets the policy whose hooks are run around deletes
+func loadHookPolicy() {
+	pol := parsePolicy(findConfig("policy-file"))
+	setCleanupOptions(func(opts *cleanup.Options) { opts.HookPolicy = pol })
+}
+
+// loadCostThresholds sets the cost thresholds of marking
+func loadCostThresholds() {
+	owners, err := ownerCostThresholdsFromConfig(findConfig("mark-owner-cost-thresholds"))
+	if err != nil {
+		fatalf("Invalid mark-owner-cost-thresholds: %s", err)
+	}
+	setCleanupOptions(func(opts *cleanup.Options) {
+		opts.TotalCostThreshold = float64(findConfigInt("mark-cost-threshold"))
+		opts.ResourceCostThreshold = float64(findConfigInt("mark-resource-cost-threshold"))
+		opts.OwnerCostThresholds = owners
+	})
+}
+
+func loadFreezeWindows() {
+	windows, err := cleanup.ParseFreezeWindows(findConfig("freeze-windows"))
+	if err != nil {
+		fatalf("Invalid freeze-windows: %s", err)
+	}
+	setCleanupOptions(func(opts *cleanup.Options) { opts.FreezeWindows = windows })
+}
+
+// The places a config option can be set, in order of precedence
+const (
+	configSourceFlag    = "flag"
+	configSourceEnv     = "env"
+	configSourceFile    = "file"
+	configSourceDefault = "default"
+)
+
 func findConfig(name string) string {
 	if _, exist := configMapping[name]; !exist {
-		log.Fatalf("Unknown config option: %s", name)
+		fatalf("Unknown config option: %s", name)
+	}
+	val, source := lookupConfig(name)
+	if source == configSourceDefault && configMapping[name].defaultValue == optionalDefault {
+		return ""
+	}
+	if source != configSourceFlag {
+		maybeNoValExit(val, name)
+	}
+	resolved, err := secrets.Resolve(val)
+	if err != nil {
+		fatalf("Value of %s: %s", name, err)
+	}
+	return resolved
+}
+
+// configValue returns the value of a config option the same way as
+// findConfig, but never exits if there is no value. If the value refers
+// to a secret which can't be resolved, the reference is returned.
+func configValue(name string) string {
+	val, _ := lookupConfig(name)
+	if resolved, err := secrets.Resolve(val); err == nil {
+		return resolved
+	}
+	return val
+}
+
+// secretProblems returns a problem for every config option referring to
+// a secret which can't be resolved
+func secretProblems() []string {
+	problems := []string{}
+	for name := range configMapping {
+		val, _ := lookupConfig(name)
+		if _, err := secrets.Resolve(val); err != nil {
+			problems = append(problems, fmt.Sprintf("Value of %s: %s", name, err))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// resolveSecrets resolves every config option referring to a secret at
+// startup, so a missing secret is found before anything is done
+func resolveSecrets() {
+	problems := secretProblems()
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+	if len(problems) > 0 {
+		fatalf("Could not resolve %d secrets", len(problems))
+	}
+}
+
+// lookupConfig returns the value of a config option, and where it was
+// set. Flags take precedence over environment variables, which take
+// precedence over the config file, and the default is used last. The
+// environment variables have the same names as the keys in the file.
+func lookupConfig(name string) (string, string) {
+	flagVal := ""
+	if f := flag.Lookup(name); f != nil {
+		flagVal = f.Value.String()
 	}
-	flagVal := flag.Lookup(name).Value.String()
 	if flagVal != "" {
-		return flagVal
+		return flagVal, configSourceFlag
+	} else if envVal := os.Getenv(configMapping[name].confKey); envVal != "" {
+		return envVal, configSourceEnv
 	} else if confVal, ok := config[configMapping[name].confKey]; ok && confVal != "" {
-		maybeNoValExit(confVal, name)
-		return confVal
-	} else {
-		defaultVal := configMapping[name].defaultValue
-		if defaultVal == optionalDefault {
-			return ""
-		}
-		maybeNoValExit(defaultVal, name)
-		return defaultVal
+		return confVal, configSourceFile
+	} else if configMapping[name].defaultValue == optionalDefault {
+		return "", configSourceDefault
 	}
+	return configMapping[name].defaultValue, configSourceDefault
 }
 
 func maybeNoValExit(val, name string) {
 	if val == "" {
-		log.Fatalf("No value specified for --%s", name)
+		fatalf("No value specified for --%s", name)
 	}
 }
 
@@ -137,22 +501,58 @@ func findConfigInt(name string) int {
 	val := findConfig(name)
 	i, err := strconv.Atoi(val)
 	if err != nil {
-		log.Fatalf("Value specified for %s is not an integer", name)
+		fatalf("Value specified for %s is not an integer", name)
 	}
 	return i
 }
 
+func findConfigDuration(name string) time.Duration {
+	val := findConfig(name)
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		fatalf("Value specified for %s is not a positive duration, e.g. 24h", name)
+	}
+	return d
+}
+
+// findConfigTimeout returns a timeout, where 0 means no limit
+func findConfigTimeout(name string) time.Duration {
+	val := findConfig(name)
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		fatalf("Value specified for %s is not a duration, e.g. 30m, or 0 for no limit", name)
+	}
+	return d
+}
+
+func findConfigBool(name string) bool {
+	val := findConfig(name)
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		fatalf("Value specified for %s is not a boolean", name)
+	}
+	return b
+}
+
 func cspFromConfig(rawFlag string) cloud.CSP {
-	flagVal := strings.ToLower(rawFlag)
-	switch flagVal {
+	csp, valid := parseCSP(rawFlag)
+	if !valid {
+		fmt.Fprintf(os.Stderr, "Invalid CSP flag \"%s\" specified\n", rawFlag)
+		os.Exit(1)
+	}
+	return csp
+}
+
+// parseCSP returns the CSP with the specified name, and false if there
+// is no such CSP
+func parseCSP(name string) (cloud.CSP, bool) {
+	switch strings.ToLower(name) {
 	case cspFlagAWS:
-		return cloud.AWS
+		return cloud.AWS, true
 	case cspFlagGCP:
-		return cloud.GCP
+		return cloud.GCP, true
 	default:
-		fmt.Fprintf(os.Stderr, "Invalid CSP flag \"%s\" specified\n", rawFlag)
-		os.Exit(1)
-		return cloud.AWS
+		return cloud.LookupProvider(name)
 	}
 }
 
@@ -166,3 +566,94 @@ func tagsFromConfig(rawFlag string) []string {
 	}
 	return tags
 }
+
+func listFromConfig(raw string) []string {
+	result := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func kubernetesClustersFromConfig(path string) map[string]cloud.KubernetesCluster {
+	clusters := make(map[string]cloud.KubernetesCluster)
+	if path == "" {
+		return clusters
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatalf("Could not read Kubernetes clusters file: %s", err)
+	}
+	if err := json.Unmarshal(raw, &clusters); err != nil {
+		fatalf("Could not parse Kubernetes clusters file: %s", err)
+	}
+	return clusters
+}
+
+func vsphereServersFromConfig(path string) map[string]cloud.VSphereServer {
+	servers := make(map[string]cloud.VSphereServer)
+	if path == "" {
+		return servers
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatalf("Could not read vSphere servers file: %s", err)
+	}
+	if err := json.Unmarshal(raw, &servers); err != nil {
+		fatalf("Could not parse vSphere servers file: %s", err)
+	}
+	return servers
+}
+
+func currencyRatesFromConfig(raw string) billing.CurrencyRates {
+	if raw == "" {
+		fatalln("No currency rates configured, set --currency-rates to a JSON file or \"ecb\"")
+	}
+	var rates billing.CurrencyRates
+	var err error
+	if strings.ToLower(raw) == currencyRatesECB {
+		rates, err = billing.FetchECBRates()
+	} else {
+		rates, err = billing.LoadCurrencyRates(raw)
+	}
+	if err != nil {
+		fatalf("Could not load currency rates: %s", err)
+	}
+	return rates
+}
+
+// ownerCostThresholdsFromConfig parses the cost thresholds of accounts,
+// e.g. 123456789012=50,my-project=0
+func ownerCostThresholdsFromConfig(raw string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	for _, item := range listFromConfig(raw) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("'%s' is not on the form <owner>=<USD>", item)
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("threshold of %s is not a positive number", strings.TrimSpace(parts[0]))
+		}
+		result[strings.TrimSpace(parts[0])] = threshold
+	}
+	return result, nil
+}
+
+func portsFromConfig(raw string) []int64 {
+	ports := listFromConfig(raw)
+	if len(ports) == 0 {
+		return security.DefaultSensitivePorts
+	}
+	result := []int64{}
+	for _, port := range ports {
+		p, err := strconv.ParseInt(port, 10, 64)
+		if err != nil {
+			fatalf("Invalid port %s in --sensitive-ports", port)
+		}
+		result = append(result, p)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/delivery"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+var (
+	// deliveryLog is read once, and written after every command which
+	// sent emails
+	deliveryLog      *delivery.Log
+	deliveryLogMutex sync.Mutex
+)
+
+// loadDeliveryLog returns the delivery log, or nil if deliveries aren't
+// tracked since there is no delivery log file configured
+func loadDeliveryLog() *delivery.Log {
+	path := findConfig("delivery-log-file")
+	if path == "" {
+		return nil
+	}
+	deliveryLogMutex.Lock()
+	defer deliveryLogMutex.Unlock()
+	if deliveryLog != nil {
+		return deliveryLog
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No delivery log in %s, starting a new one", path)
+		deliveryLog = &delivery.Log{}
+		return deliveryLog
+	} else if err != nil {
+		fatalf("Could not read delivery log file: %s\n", err)
+	}
+	defer f.Close()
+	deliveryLog, err = delivery.ReadLog(f)
+	if err != nil {
+		fatalf("Could not parse delivery log file %s: %s\n", path, err)
+	}
+	return deliveryLog
+}
+
+// saveDeliveryLog writes the delivery log, if it was loaded. It's written
+// to a temporary file first, so that it isn't lost if writing fails
+// halfway.
+func saveDeliveryLog() {
+	deliveryLogMutex.Lock()
+	defer deliveryLogMutex.Unlock()
+	if deliveryLog == nil {
+		return
+	}
+	path := findConfig("delivery-log-file")
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		status.ActionFailedf("Could not create delivery log file: %s", err)
+		return
+	}
+	if err := deliveryLog.Write(f); err != nil {
+		f.Close()
+		status.ActionFailedf("Could not write delivery log file: %s", err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		status.ActionFailedf("Could not write delivery log file: %s", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		status.ActionFailedf("Could not replace delivery log file: %s", err)
+	}
+}
+
+// processBounces records the delivery and bounce notifications from SES
+// in the delivery log, and removes them from the queue. In a dry run the
+// notifications are only logged, and kept in the queue.
+func processBounces() {
+	queueURL := findConfig("bounce-queue-url")
+	if queueURL == "" {
+		fatalln("No queue configured, set CS_BOUNCE_QUEUE_URL to process bounces")
+	}
+	deliveries := loadDeliveryLog()
+	if deliveries == nil {
+		fatalln("No delivery log configured, set CS_DELIVERY_LOG_FILE to process bounces")
+	}
+	queue := delivery.NewSQSQueue(queueURL)
+	processed := 0
+	for {
+		messages, err := queue.Receive()
+		if err != nil {
+			status.ActionFailedf("Could not receive notifications from %s: %s", queueURL, err)
+			break
+		}
+		if len(messages) == 0 {
+			break
+		}
+		for _, message := range messages {
+			notification, err := delivery.ParseNotification([]byte(message.Body))
+			if err != nil {
+				status.Warnf("Ignoring a message in %s: %s", queueURL, err)
+			} else {
+				for _, recipient := range notification.Recipients {
+					log.Printf("%s: %s %s", notification.Type, recipient, notification.Reason)
+				}
+				if !*dryRun {
+					deliveries.Apply(notification)
+				}
+			}
+			processed++
+			if *dryRun {
+				continue
+			}
+			if err := queue.Remove(message); err != nil {
+				status.ActionFailedf("Could not remove a processed notification from %s: %s", queueURL, err)
+			}
+		}
+	}
+	log.Printf("Processed %d notifications", processed)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/digest"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+var (
+	// notifyDigest is read once, and written after every command which
+	// could have added resources to it, or sent it
+	notifyDigest      *digest.Digest
+	notifyDigestMutex sync.Mutex
+)
+
+// notifyCostThresholds returns the notification cost threshold, and the
+// thresholds of the owners which have their own
+func notifyCostThresholds() (float64, map[string]float64) {
+	owners, err := ownerCostThresholdsFromConfig(findConfig("notify-owner-cost-thresholds"))
+	if err != nil {
+		fatalf("Invalid notify-owner-cost-thresholds: %s", err)
+	}
+	return float64(findConfigInt("notify-cost-threshold")), owners
+}
+
+// loadDigest returns the digest of resources left out of emails since
+// they cost too little
+func loadDigest() *digest.Digest {
+	notifyDigestMutex.Lock()
+	defer notifyDigestMutex.Unlock()
+	if notifyDigest != nil {
+		return notifyDigest
+	}
+	path := findConfig("notify-digest-file")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No digest in %s, starting a new one", path)
+		notifyDigest = &digest.Digest{}
+		return notifyDigest
+	} else if err != nil {
+		fatalf("Could not read digest file: %s\n", err)
+	}
+	defer f.Close()
+	notifyDigest, err = digest.Read(f)
+	if err != nil {
+		fatalf("Could not parse digest file %s: %s\n", path, err)
+	}
+	return notifyDigest
+}
+
+// digestLoaded returns true if the digest has been loaded, e.g. to be sent
+// even though there no longer are any cost thresholds
+func digestLoaded() bool {
+	notifyDigestMutex.Lock()
+	defer notifyDigestMutex.Unlock()
+	return notifyDigest != nil
+}
+
+// saveDigest writes the digest, if it was loaded. It's written to a
+// temporary file first, so that it isn't lost if writing fails halfway.
+func saveDigest() {
+	notifyDigestMutex.Lock()
+	defer notifyDigestMutex.Unlock()
+	if notifyDigest == nil {
+		return
+	}
+	path := findConfig("notify-digest-file")
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		status.ActionFailedf("Could not create digest file: %s", err)
+		return
+	}
+	if err := notifyDigest.Write(f); err != nil {
+		f.Close()
+		status.ActionFailedf("Could not write digest file: %s", err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		status.ActionFailedf("Could not write digest file: %s", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		status.ActionFailedf("Could not replace digest file: %s", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/directory"
+)
+
+// syncDirectory refreshes the organization file from the configured
+// directory, and writes it back if anything changed
+func syncDirectory() {
+	kind := findConfig("directory")
+	if kind == "" {
+		fatalln("No directory configured, set CS_DIRECTORY to sync the organization")
+	}
+	dir, err := directory.New(kind, findConfig("directory-url"), findConfig("directory-token"))
+	if err != nil {
+		fatal(err)
+	}
+	users, err := dir.Users()
+	if err != nil {
+		fatalf("Could not read users from the directory: %s", err)
+	}
+	orgFile := findConfig("org-file")
+	org := parseOrganization(orgFile)
+	result, err := directory.Sync(org, users, findConfigInt("directory-max-disabled-percent"))
+	if err != nil {
+		fatal(err)
+	}
+	for _, change := range result.Changes {
+		log.Println(change)
+	}
+	for _, employee := range result.Departed {
+		log.Printf("%s has left, or is not in the directory", employee.Username)
+	}
+	if len(result.Changes) == 0 {
+		log.Println("Organization is up to date with the directory")
+		return
+	}
+	writeOrganization(orgFile, org)
+	log.Printf("Wrote %d changes to %s", len(result.Changes), orgFile)
+}
+
+func writeOrganization(path string, org *cs.Organization) {
+	raw, err := json.MarshalIndent(org, "", "\t")
+	if err != nil {
+		fatalf("Could not encode organization: %s", err)
+	}
+	if err := ioutil.WriteFile(path, append(raw, '\n'), 0644); err != nil {
+		fatalf("Could not write organization file: %s", err)
+	}
+}
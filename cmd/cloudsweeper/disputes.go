@@ -0,0 +1,117 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/disputes"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/selfservice"
+)
+
+// loadDisputed excludes the resources in the dispute file from marking
+// and cleanup
+func loadDisputed() {
+	disputed := readDisputes(findConfig("dispute-file")).IDs()
+	if len(disputed) > 0 {
+		log.Printf("Not cleaning up %d disputed resources", len(disputed))
+	}
+	setCleanupOptions(func(opts *cleanup.Options) { opts.Disputed = disputed })
+}
+
+// listDisputes prints the review queue of disputed resources
+func listDisputes() {
+	queue := readDisputes(findConfig("dispute-file"))
+	list := queue.List()
+	if len(list) == 0 {
+		log.Println("No disputed resources")
+		return
+	}
+	for _, d := range list {
+		fmt.Printf("%s\t%s\tdisputed by %s at %s", d.ResourceID, cloud.AccountDisplayName(d.Account), d.DisputedBy, d.DisputedAt.Format("2006-01-02"))
+		if d.Reason != "" {
+			fmt.Printf(": %s", d.Reason)
+		}
+		fmt.Println()
+	}
+}
+
+// assignResource assigns a resource to an active employee, and removes
+// it from the review queue of disputed resources. In a dry run nothing
+// is tagged and the queue isn't changed.
+func assignResource(csp cloud.CSP, org *cs.Organization, args []string) {
+	if len(args) != 2 {
+		fatalln("Usage: cloudsweeper assign <resource ID> <owner username>")
+	}
+	id, username := args[0], args[1]
+	owner, exist := org.UsernameToEmployeeMapping()[username]
+	if !exist {
+		fatalf("%s is not an employee in the organization", username)
+	}
+	if owner.Disabled {
+		fatalf("%s has left the organization", username)
+	}
+	path := findConfig("dispute-file")
+	queue := readDisputes(path)
+	if _, disputed := queue.IDs()[id]; !disputed {
+		log.Printf("%s is not disputed, assigning it anyway", id)
+	}
+	mngr := initManager(csp, org)
+	res, err := selfservice.FindResource(mngr, id)
+	if err != nil {
+		fatal(err)
+	}
+	if *dryRun {
+		log.Printf("Would assign %s in %s to %s", id, cloud.AccountDisplayName(res.Owner()), username)
+		return
+	}
+	if err := selfservice.AssignResource(res, username); err != nil {
+		fatal(err)
+	}
+	queue.Remove(id)
+	writeDisputes(path, queue)
+	log.Printf("%s is now assigned to %s", id, username)
+}
+
+// readDisputes reads the dispute file, or returns an empty queue if there
+// is no such file yet
+func readDisputes(path string) *disputes.Queue {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &disputes.Queue{}
+	} else if err != nil {
+		fatalf("Could not read dispute file: %s\n", err)
+	}
+	defer f.Close()
+	queue, err := disputes.ReadQueue(f)
+	if err != nil {
+		fatalf("Could not parse dispute file %s: %s\n", path, err)
+	}
+	return queue
+}
+
+// writeDisputes writes the queue to a temporary file first, so that the
+// queue isn't lost if writing fails halfway
+func writeDisputes(path string, queue *disputes.Queue) {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		fatalf("Could not create dispute file: %s\n", err)
+	}
+	if err := queue.Write(f); err != nil {
+		f.Close()
+		fatalf("Could not write dispute file: %s\n", err)
+	}
+	if err := f.Close(); err != nil {
+		fatalf("Could not write dispute file: %s\n", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		fatalf("Could not replace dispute file: %s\n", err)
+	}
+}
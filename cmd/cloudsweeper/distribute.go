@@ -0,0 +1,228 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/distribute"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// distributableCommands are the commands which can be split into one
+// work item per account. Commands summarizing all accounts for the
+// managers, such as review, can't be.
+var distributableCommands = []string{"mark-for-cleanup", "cleanup", "reset", "warn", "find-untagged"}
+
+const (
+	// workHeartbeat is how often a worker hides the item it's processing
+	// from other workers for another workVisibility
+	workHeartbeat  = 2 * time.Minute
+	workVisibility = 5 * time.Minute
+	// resultPollInterval is how often the coordinator checks for results
+	resultPollInterval = time.Minute
+)
+
+// workAccount is the only account or project managed while a worker
+// processes a work item, empty means all enabled accounts
+var workAccount string
+
+// managedAccounts returns the accounts the resource manager of a command
+// lists resources in
+func managedAccounts(enabled []string) []string {
+	if workAccount != "" {
+		return []string{workAccount}
+	}
+	return enabled
+}
+
+func initWorkQueue() distribute.Queue {
+	queueURL := findConfig("work-queue-url")
+	if queueURL == "" {
+		fatalln("No work queue configured, set CS_WORK_QUEUE_URL to distribute commands")
+	}
+	return distribute.NewSQSQueue(queueURL)
+}
+
+func initWorkStore() distribute.Store {
+	bucket := findConfig("work-bucket")
+	if bucket == "" {
+		fatalln("No work bucket configured, set CS_WORK_BUCKET to distribute commands")
+	}
+	region := awsBucketRegion(bucket, findConfig("work-bucket-region"))
+	return distribute.NewS3Store(bucket, findConfig("work-prefix"), region)
+}
+
+// coordinate sends a work item for every enabled account to the work
+// queue, and waits for the workers to store their results. Accounts
+// without a result by --distribute-timeout are discovery failures, and
+// the problems of the workers are recorded as problems of this run, so
+// the exit code reflects the whole run.
+func coordinate(csp cloud.CSP, args []string) {
+	if len(args) != 1 || !contains(distributableCommands, args[0]) {
+		fatalf("Please supply a command to distribute, one of %v", distributableCommands)
+	}
+	command := args[0]
+	org := parseOrganization(findConfig("org-file"))
+	loadAccountNames(csp, org)
+	accounts := org.EnabledAccounts(csp)
+	queue := initWorkQueue()
+	store := initWorkStore()
+	run := distribute.NewRun(command, time.Now())
+	log.Printf("Distributing %s over %d accounts as run %s (dry run: %t)", command, len(accounts), run, *dryRun)
+	if err := distribute.Enqueue(queue, run, command, string(csp), accounts, *dryRun); err != nil {
+		fatalf("Could not queue run %s: %s", run, err)
+	}
+	results, missing, err := distribute.Collect(store, run, accounts, findConfigDuration("distribute-timeout"), resultPollInterval)
+	if err != nil {
+		fatalf("Could not collect the results of run %s: %s", run, err)
+	}
+	for _, result := range results {
+		log.Printf("%s: %s (worker %s, %s)", cloud.AccountDisplayName(result.Account), result.Summary, result.Worker, result.Finished.Sub(result.Started).Round(time.Second))
+		recordResult(result)
+	}
+	for _, account := range missing {
+		status.DiscoveryFailedf("No result for %s of run %s", cloud.AccountDisplayName(account), run)
+	}
+}
+
+func recordResult(result *distribute.Result) {
+	counts := map[status.Kind]int{
+		status.DiscoveryFailure: result.DiscoveryFailures,
+		status.ActionFailure:    result.ActionFailures,
+		status.Warning:          result.Warnings,
+	}
+	for kind, count := range counts {
+		for i := 0; i < count; i++ {
+			status.Record(kind)
+		}
+	}
+}
+
+// work processes the items of the work queue, one at a time, until the
+// program exits. An item is only removed once its result is stored, so
+// the items of a worker which exits while processing them are processed
+// by another worker.
+func work() {
+	queue := initWorkQueue()
+	store := initWorkStore()
+	worker, err := os.Hostname()
+	if err != nil {
+		worker = "unknown"
+	}
+	log.Printf("Working on %s as %s", findConfig("work-queue-url"), worker)
+	for {
+		message, err := queue.Receive()
+		if err != nil {
+			status.ActionFailedf("Could not receive work: %s", err)
+			time.Sleep(resultPollInterval)
+			continue
+		}
+		if message == nil {
+			continue
+		}
+		item, err := distribute.ParseWorkItem(message.Body)
+		if err != nil {
+			status.Warnf("Removing a work item which can't be processed: %s", err)
+			if err := queue.Remove(message); err != nil {
+				status.ActionFailedf("Could not remove a work item: %s", err)
+			}
+			continue
+		}
+		result := processWorkItem(queue, message, item, worker)
+		if err := store.Save(result); err != nil {
+			status.ActionFailedf("Could not store the result of %s for run %s: %s", item.Account, item.Run, err)
+			continue
+		}
+		if err := queue.Remove(message); err != nil {
+			status.ActionFailedf("Could not remove the work item of %s for run %s: %s", item.Account, item.Run, err)
+		}
+	}
+}
+
+// processWorkItem runs the command of a work item against its account,
+// hiding the item from other workers until it's done
+func processWorkItem(queue distribute.Queue, message *distribute.Message, item *distribute.WorkItem, worker string) *distribute.Result {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(workHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := queue.Extend(message, workVisibility); err != nil {
+					log.Printf("Could not extend the work item of %s: %s", item.Account, err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("Running %s against %s for run %s", item.Command, item.Account, item.Run)
+	return runResult(item.Run, item.Account, worker, item.Command, func() { runWorkItem(item) })
+}
+
+// runResult runs a command from scratch, and returns its result. If the
+// command fails with a fatal error, while runs are aborted on fatal
+// errors, or panics, that's recorded as a discovery failure of the result.
+func runResult(run, account, worker, command string, runner func()) *distribute.Result {
+	started := time.Now().UTC()
+	status.Reset()
+	cloud.ResetMetrics()
+	if err := abortable(runner); err != nil {
+		status.Record(status.DiscoveryFailure)
+		log.Printf("Aborted '%s': %s", command, err)
+	}
+	reportMetrics(command)
+	return &distribute.Result{
+		SchemaVersion:     distribute.ResultSchemaVersion,
+		Run:               run,
+		Account:           account,
+		Worker:            worker,
+		Started:           started,
+		Finished:          time.Now().UTC(),
+		DiscoveryFailures: status.Count(status.DiscoveryFailure),
+		ActionFailures:    status.Count(status.ActionFailure),
+		Warnings:          status.Count(status.Warning),
+		Summary:           status.Summary(),
+	}
+}
+
+// runWorkItem runs the command of a work item the same way as on the
+// command line, with the CSP, account and dry run of the item
+func runWorkItem(item *distribute.WorkItem) {
+	csp, valid := parseCSP(item.CSP)
+	if !valid {
+		status.ActionFailedf("Invalid CSP '%s' in the work item of %s", item.CSP, item.Account)
+		return
+	}
+	if !contains(distributableCommands, item.Command) {
+		status.ActionFailedf("Command '%s' of the work item of %s can't be distributed", item.Command, item.Account)
+		return
+	}
+	if !contains(parseOrganization(findConfig("org-file")).EnabledAccounts(csp), item.Account) {
+		status.ActionFailedf("Account '%s' is not an enabled %s account of the organization", item.Account, csp)
+		return
+	}
+	previousCSP, previousDryRun, previousResumeRun := flag.Lookup("csp").Value.String(), *dryRun, *resumeRun
+	flag.Set("csp", string(csp))
+	*dryRun = item.DryRun
+	// Cleanup resumes the run of the item, so a worker processing an item
+	// of a worker which exited skips what that worker cleaned up
+	*resumeRun = item.Run
+	workAccount = item.Account
+	defer func() {
+		flag.Set("csp", previousCSP)
+		*dryRun = previousDryRun
+		*resumeRun = previousResumeRun
+		workAccount = ""
+	}()
+	runCommand(item.Command)
+}
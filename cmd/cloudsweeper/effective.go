@@ -0,0 +1,144 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+const (
+	formatJSON = "json"
+	formatText = "text"
+
+	redactedValue = "<redacted>"
+)
+
+// effectiveOption is the resolved value of a config option, and where
+// it was set
+type effectiveOption struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// effectiveConfig is everything which decides how Cloudsweeper behaves
+type effectiveConfig struct {
+	ConfigFile string             `json:"config_file"`
+	Options    []*effectiveOption `json:"options"`
+	// Flags are the command line flags which aren't config options
+	Flags map[string]string `json:"flags"`
+	// Policy and ShadowPolicy are the action of every category
+	Policy       map[string]policy.Action `json:"policy"`
+	ShadowPolicy map[string]policy.Action `json:"shadow_policy,omitempty"`
+}
+
+// configEffective prints the fully resolved configuration, so that the
+// configuration of different environments can be compared. Flags after
+// the command are parsed as well, e.g. config effective --format=text.
+// Nothing else is printed to stdout, so the output can be diffed.
+func configEffective(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return status.ExitConfigError
+	}
+	effective := resolveEffectiveConfig()
+
+	var err error
+	switch *outputFormat {
+	case "", formatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(effective)
+	case formatText:
+		err = writeEffectiveText(os.Stdout, effective)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid format '%s', must be '%s' or '%s'\n", *outputFormat, formatJSON, formatText)
+		return status.ExitConfigError
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not print the configuration:", err)
+		return status.ExitConfigError
+	}
+	return status.ExitSuccess
+}
+
+func resolveEffectiveConfig() *effectiveConfig {
+	effective := &effectiveConfig{
+		ConfigFile: configFileName,
+		Options:    []*effectiveOption{},
+		Flags:      make(map[string]string),
+		Policy:     effectivePolicy(configValue("policy-file")),
+	}
+	if shadowFile := configValue("shadow-policy-file"); shadowFile != "" {
+		effective.ShadowPolicy = effectivePolicy(shadowFile)
+	}
+	for name, mapping := range configMapping {
+		value, source := lookupConfig(name)
+		if value != "" && mapping.secret {
+			value = redactedValue
+		}
+		effective.Options = append(effective.Options, &effectiveOption{
+			Name:   name,
+			Key:    mapping.confKey,
+			Value:  value,
+			Source: source,
+		})
+	}
+	sort.Slice(effective.Options, func(i, j int) bool {
+		return effective.Options[i].Name < effective.Options[j].Name
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, isOption := configMapping[f.Name]; !isOption && f.Name != "format" {
+			effective.Flags[f.Name] = f.Value.String()
+		}
+	})
+	return effective
+}
+
+// effectiveCategories are the categories whose action is printed, which
+// include the GPU instances of gpu-review
+var effectiveCategories = append(append([]string{}, policy.Categories...), policy.GPUInstances)
+
+// effectivePolicy returns the action of every category in the policy
+// file, which is the default action for every category if there is none
+func effectivePolicy(path string) map[string]policy.Action {
+	pol := parsePolicy(path)
+	actions := make(map[string]policy.Action)
+	for _, category := range effectiveCategories {
+		actions[category] = pol.Action(category)
+	}
+	return actions
+}
+
+func writeEffectiveText(w io.Writer, effective *effectiveConfig) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Config file:\t%s\n\n", effective.ConfigFile)
+	fmt.Fprintln(tw, "OPTION\tVALUE\tSOURCE")
+	for _, option := range effective.Options {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", option.Name, option.Value, option.Source)
+	}
+	fmt.Fprintln(tw, "\nFLAG\tVALUE\t")
+	flags := []string{}
+	for name := range effective.Flags {
+		flags = append(flags, name)
+	}
+	sort.Strings(flags)
+	for _, name := range flags {
+		fmt.Fprintf(tw, "%s\t%s\t\n", name, effective.Flags[name])
+	}
+	fmt.Fprintln(tw, "\nCATEGORY\tACTION\tSHADOW ACTION")
+	for _, category := range effectiveCategories {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", category, effective.Policy[category], effective.ShadowPolicy[category])
+	}
+	return tw.Flush()
+}
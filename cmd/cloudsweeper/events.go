@@ -0,0 +1,106 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/delivery"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/events"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/notify"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// eventPollInterval is how long to wait before receiving again from an
+// empty event queue
+const eventPollInterval = 20 * time.Second
+
+// watchEvents checks resources for the required tags as soon as they are
+// created, by reading their creation events from the event queue, and
+// warns their creators about missing tags. It runs until the program
+// exits. In a dry run the warnings are only logged, and the events are
+// kept in the queue.
+func watchEvents() {
+	queueURL := findConfig("event-queue-url")
+	if queueURL == "" {
+		log.Fatalln("No queue configured, set CS_EVENT_QUEUE_URL to watch events")
+	}
+	if len(tagsFromConfig(findConfig("required-tags"))) == 0 {
+		log.Fatalln("No required tags configured, set REQUIRED_TAGS to watch events")
+	}
+	loadAccountNames(cloud.AWS, parseOrganization(findConfig("org-file")))
+	queue := delivery.NewSQSQueue(queueURL)
+	log.Printf("Watching %s for created resources", queueURL)
+	for {
+		messages, err := queue.Receive()
+		if err != nil {
+			status.ActionFailedf("Could not receive events from %s: %s", queueURL, err)
+		}
+		if len(messages) == 0 {
+			time.Sleep(eventPollInterval)
+			continue
+		}
+		// Scheduled runs in serve mode share the config and delivery log
+		runMutex.Lock()
+		handleEvents(queue, queueURL, messages)
+		runMutex.Unlock()
+	}
+}
+
+func handleEvents(queue delivery.Queue, queueURL string, messages []delivery.Message) {
+	org := parseOrganization(findConfig("org-file"))
+	required := tagsFromConfig(findConfig("required-tags"))
+	client := initNotifyClient()
+	for _, message := range messages {
+		// Not everything the rule matches creates a resource, such as
+		// failed calls, which are removed without a warning
+		creation, err := events.ParseCreation([]byte(message.Body))
+		if err != nil && err != events.ErrNotCreation {
+			status.Warnf("Ignoring an event in %s: %s", queueURL, err)
+		}
+		if err == nil {
+			warnMissingTags(client, org, creation, required)
+		}
+		if *dryRun {
+			continue
+		}
+		if err := queue.Remove(message); err != nil {
+			status.ActionFailedf("Could not remove a processed event from %s: %s", queueURL, err)
+		}
+	}
+	saveDeliveryLog()
+}
+
+// warnMissingTags warns the creator of resources created without some
+// of the required tags
+func warnMissingTags(client *notify.Client, org *cs.Organization, creation *events.Creation, required []string) {
+	missing := creation.MissingTags(required)
+	if len(missing) == 0 {
+		return
+	}
+	ids := strings.Join(creation.IDs, ", ")
+	log.Printf("%s created %s in %s without %s", creation.CreatorARN, ids, cloud.AccountDisplayName(creation.Account), strings.Join(missing, ", "))
+	recipient := creationRecipient(org, creation)
+	switch {
+	case recipient == "":
+		status.Warnf("Nobody to warn about %s, since %s is not in the organization", ids, cloud.AccountDisplayName(creation.Account))
+	case *dryRun:
+		log.Printf("Would warn %s about the missing tags", recipient)
+	default:
+		client.MissingTagsWarning(recipient, creation, missing)
+	}
+}
+
+// creationRecipient returns the username of the employee who created a
+// resource, or else of the owner of its account
+func creationRecipient(org *cs.Organization, creation *events.Creation) string {
+	if employee, exist := org.UsernameToEmployeeMapping()[creation.Creator]; exist && !employee.Disabled {
+		return employee.Username
+	}
+	return org.AccountToUserMapping(cloud.AWS)[creation.Account]
+}
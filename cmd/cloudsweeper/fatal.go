@@ -0,0 +1,69 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// abortRunsOnFatal makes fatal errors abort the run in progress instead
+// of exiting, so that serve keeps running after a failed scheduled run
+var abortRunsOnFatal bool
+
+// runAborted is the panic with which fatal errors abort a run
+type runAborted string
+
+// fatalf logs the error and exits, or aborts the run in progress if runs
+// are aborted on fatal errors. Use it instead of log.Fatalf in anything
+// a run may call.
+func fatalf(format string, v ...interface{}) {
+	abortRun(fmt.Sprintf(format, v...))
+}
+
+// fatal is fatalf with the arguments formatted like log.Fatal
+func fatal(v ...interface{}) {
+	abortRun(fmt.Sprint(v...))
+}
+
+// fatalln is fatalf with the arguments formatted like log.Fatalln
+func fatalln(v ...interface{}) {
+	abortRun(fmt.Sprintln(v...))
+}
+
+func abortRun(message string) {
+	if !abortRunsOnFatal {
+		log.Output(3, message)
+		os.Exit(1)
+	}
+	panic(runAborted(message))
+}
+
+// runAbortable runs a command, and returns an error instead of exiting
+// or crashing if it's aborted by a fatal error or panics
+func runAbortable(command string) error {
+	return abortable(func() { runCommand(command) })
+}
+
+// abortable runs the function, and returns an error instead of exiting
+// or crashing if it's aborted by a fatal error or panics
+func abortable(runner func()) (err error) {
+	defer recoverAborted(&err)
+	runner()
+	return nil
+}
+
+// recoverAborted sets the error to why the run was aborted, if it was.
+// Call it deferred.
+func recoverAborted(err *error) {
+	if r := recover(); r != nil {
+		if message, ok := r.(runAborted); ok {
+			*err = fmt.Errorf("%s", message)
+			return
+		}
+		*err = fmt.Errorf("%v\n%s", r, debug.Stack())
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/find"
+)
+
+// findResources searches every account for resources matching the query,
+// and prints where they live, who owns them, their age, cost and what
+// Cloudsweeper does with them. The recorded inventory is searched if
+// there is one, unless --find-live is set.
+func findResources(csp cloud.CSP, org *cs.Organization, args []string) {
+	query := strings.Join(args, " ")
+	if query == "" {
+		fatalln("Usage: cloudsweeper find <resource ID, name or tag key=value>")
+	}
+	pol := parsePolicy(findConfig("policy-file"))
+	loadCostThresholds()
+	loadDisputed()
+
+	var matches []*find.Match
+	var evaluated cloud.ResourceManager
+	path := findConfig("inventory-file")
+	if info, err := os.Stat(path); err == nil && !info.IsDir() && !*findLive {
+		inv := readInventoryFile(path)
+		cloud.SetAccountNames(org.AccountNames(csp))
+		log.Printf("Searching the inventory recorded %s, ages and states are as of then", inv.Recorded.Format(time.RFC3339))
+		evaluated = inv.Manager()
+		matches = find.Search(evaluated, org, csp, query)
+	} else if resourceType, isID := find.ResourceTypeOfID(query); isID && csp == cloud.AWS {
+		// Only the type of the ID is discovered to find its account, and
+		// then every resource of that account to evaluate it
+		log.Printf("Looking up %s in every account", resourceType)
+		loadAccountNames(csp, org)
+		lookupConfig := managerConfig(csp, org)
+		for _, other := range cloud.ResourceTypes {
+			if other != resourceType {
+				lookupConfig.DisabledResourceTypes = append(lookupConfig.DisabledResourceTypes, other)
+			}
+		}
+		lookup, err := cloud.NewManagerWithConfig(csp, lookupConfig, managedAccounts(org.EnabledAccounts(csp))...)
+		if err != nil {
+			fatal(err)
+		}
+		matches = find.Search(lookup, org, csp, query)
+		owners := []string{}
+		for _, match := range matches {
+			if !contains(owners, match.Resource.Owner()) {
+				owners = append(owners, match.Resource.Owner())
+			}
+		}
+		if len(owners) > 0 {
+			evaluated, err = cloud.NewManagerWithConfig(csp, managerConfig(csp, org), owners...)
+			if err != nil {
+				fatal(err)
+			}
+		}
+	} else {
+		log.Println("Searching every account")
+		mngr := initManager(csp, org)
+		evaluated = cloud.NewCollectedManager(collectResources(mngr))
+		matches = find.Search(evaluated, org, csp, query)
+	}
+	if len(matches) == 0 {
+		fatalf("Found no resources matching '%s'", query)
+	}
+	if err := find.Evaluate(evaluated, matches, thresholds, pol); err != nil {
+		log.Printf("Could not evaluate what the next marking does with them: %s", err)
+	}
+	fmt.Print(find.FormatMatches(matches))
+	log.Printf("Found %d resources matching '%s'", len(matches), query)
+}
+
+// collectResources discovers the resources of every account once, so
+// they can be evaluated several times
+func collectResources(mngr cloud.ResourceManager) []*cloud.AllResourceCollection {
+	accounts := []*cloud.AllResourceCollection{}
+	var mutex sync.Mutex
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		accounts = append(accounts, res)
+	})
+	return accounts
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/graph"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// exportGraphs writes the resource graph of every account to a file
+// named after the account in the directory, in the specified format
+func exportGraphs(mngr cloud.ResourceManager, dir, format string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatalf("Could not create graph directory: %s\n", err)
+	}
+	mngr.ForEachAccountResources(func(res *cloud.AllResourceCollection) {
+		g := graph.New(res)
+		path := filepath.Join(dir, res.Owner+"."+format)
+		f, err := os.Create(path)
+		if err != nil {
+			status.ActionFailedf("Could not create graph file: %s\n", err)
+			return
+		}
+		defer f.Close()
+		if err := g.Write(f, format); err != nil {
+			status.ActionFailedf("Could not write graph of %s: %s\n", cloud.AccountDisplayName(res.Owner), err)
+			return
+		}
+		log.Printf("Wrote graph of %d resources in %s to %s", len(g.Nodes), cloud.AccountDisplayName(res.Owner), path)
+	})
+}
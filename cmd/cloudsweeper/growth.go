@@ -0,0 +1,83 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/growth"
+)
+
+// bucketGrowthReview records the size and object count of every bucket in
+// the bucket history file, and emails the owners of buckets which grew by
+// more than the threshold in the last month. In a dry run the history is
+// not updated and no emails are sent.
+func bucketGrowthReview(mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	path := findConfig("bucket-history-file")
+	history := readBucketHistory(path)
+	history.Record(mngr, time.Now())
+	threshold := float64(findConfigInt("bucket-growth-percent"))
+	trends := history.Trends(threshold)
+
+	if *dryRun {
+		accounts := []string{}
+		for account := range trends {
+			accounts = append(accounts, account)
+		}
+		sort.Strings(accounts)
+		for _, account := range accounts {
+			for _, trend := range growth.Runaways(trends[account]) {
+				log.Printf("%s in %s grew by %.1f%% in size and %.1f%% in objects", trend.ID, cloud.AccountDisplayName(account), trend.SizeGrowth, trend.ObjectGrowth)
+			}
+		}
+		log.Println("Not updating the bucket history or sending the bucket growth review since this was a dry run")
+		return
+	}
+	writeBucketHistory(path, history)
+	client := initNotifyClient()
+	client.BucketGrowthReview(trends, threshold, accountUserMapping)
+}
+
+// readBucketHistory reads the bucket history file, or returns an empty
+// history if there is no such file yet
+func readBucketHistory(path string) *growth.History {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No bucket history in %s, starting a new one", path)
+		return &growth.History{}
+	} else if err != nil {
+		fatalf("Could not read bucket history file: %s\n", err)
+	}
+	defer f.Close()
+	history, err := growth.ReadHistory(f)
+	if err != nil {
+		fatalf("Could not parse bucket history file %s: %s\n", path, err)
+	}
+	return history
+}
+
+// writeBucketHistory writes the history to a temporary file first, so
+// that the history isn't lost if writing fails halfway
+func writeBucketHistory(path string, history *growth.History) {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		fatalf("Could not create bucket history file: %s\n", err)
+	}
+	if err := history.Write(f); err != nil {
+		f.Close()
+		fatalf("Could not write bucket history file: %s\n", err)
+	}
+	if err := f.Close(); err != nil {
+		fatalf("Could not write bucket history file: %s\n", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		fatalf("Could not replace bucket history file: %s\n", err)
+	}
+	log.Printf("Wrote bucket history to %s", path)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	// serveReady is set once serve has loaded its config and files, and
+	// serveStopping once it's shutting down
+	serveReady    int32
+	serveStopping int32
+)
+
+// serveHealth serves the liveness and readiness endpoints of serve mode
+// on the address, e.g. for the probes of Kubernetes. /healthz succeeds as
+// long as the program responds, and /readyz once serve is ready, until
+// it starts shutting down. The unsubscribe links are served on the same
+// address, if owners can unsubscribe. Their path and key are looked up
+// per request, so that reloading the config changes them.
+func serveHealth(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&serveStopping) == 1:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		case atomic.LoadInt32(&serveReady) == 0:
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ready")
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		path, served := unsubscribePath()
+		if !served || r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		unsubscribeHandler().ServeHTTP(w, r)
+	})
+	log.Printf("Serving health checks on %s", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Fatalf("Could not serve health checks on %s: %s", address, err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// imageBuilderSource is the image pipeline source which lists the images
+// built by EC2 Image Builder in every account
+const imageBuilderSource = "image-builder"
+
+// loadRetainedImages keeps the images produced by the latest builds of
+// the image pipelines in image-pipeline-sources from being marked or
+// cleaned up. If a source can't be read, nothing is done, since its
+// images could be marked otherwise.
+func loadRetainedImages(mngr cloud.ResourceManager) {
+	keep := findConfigInt("image-pipeline-keep-n")
+	retained := map[string]bool{}
+	for _, source := range listFromConfig(findConfig("image-pipeline-sources")) {
+		var keepList map[string]bool
+		if source == imageBuilderSource {
+			keepList = cleanup.ImageBuilderKeepList(mngr, keep)
+		} else {
+			raw, err := readPackerManifest(source)
+			if err != nil {
+				fatalf("Could not read Packer manifest %s: %s", source, err)
+			}
+			keepList, err = cleanup.PackerKeepList(bytes.NewReader(raw), keep)
+			if err != nil {
+				fatalf("Could not read Packer manifest %s: %s", source, err)
+			}
+		}
+		log.Printf("Retaining %d images built by %s", len(keepList), source)
+		for id := range keepList {
+			retained[id] = true
+		}
+	}
+	setCleanupOptions(func(opts *cleanup.Options) { opts.RetainedImages = retained })
+}
+
+// readPackerManifest reads a Packer manifest from a file, or from S3 if
+// the location is an s3://<bucket>/<key> URL
+func readPackerManifest(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return readInputFile(location)
+	}
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return nil, err
+	}
+	client, err := cloud.NewAWSBucketClient(bucket, nil)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return ioutil.ReadAll(output.Body)
+}
+
+func parseS3URL(location string) (string, string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return "", "", fmt.Errorf("'%s' is not on the form s3://<bucket>/<key>", location)
+	}
+	return parsed.Host, strings.TrimPrefix(parsed.Path, "/"), nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/distribute"
+	"github.com/agaridata/cloudsweeper/status"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// lambdaEvent is the input of the Lambda function, either the constant
+// input of an EventBridge schedule, or a batch of work items from the
+// work queue
+type lambdaEvent struct {
+	// Command is the command the schedule runs
+	Command string `json:"command"`
+	// Split sends a work item per account to the work queue instead of
+	// running the command, for commands which take too long to run
+	// against all accounts in one invocation
+	Split  bool `json:"split"`
+	DryRun bool `json:"dry_run"`
+	// Records are the messages received from the work queue
+	Records []struct {
+		MessageID string `json:"messageId"`
+		Body      string `json:"body"`
+	} `json:"Records"`
+}
+
+// lambdaBatchResponse is the response to a batch of work items, listing
+// the messages which failed, so that only those are received again. The
+// event source needs the ReportBatchItemFailures response type for it.
+type lambdaBatchResponse struct {
+	BatchItemFailures []lambdaBatchItemFailure `json:"batchItemFailures"`
+}
+
+// lambdaBatchItemFailure is a message of the batch which failed
+type lambdaBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// runningInLambda returns true if the program is run by AWS Lambda
+func runningInLambda() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" || os.Getenv("_LAMBDA_SERVER_PORT") != ""
+}
+
+// runLambda handles the invocations of the Lambda function until the
+// function is shut down. Fatal discovery failures and fatal errors are
+// recorded in the result of the invocation, rather than exiting.
+func runLambda() {
+	status.ExitOnFatal = false
+	abortRunsOnFatal = true
+	lambda.Start(handleLambda)
+}
+
+// handleLambda handles an invocation. It returns the result of the run
+// of a schedule, or the work items which failed of a batch.
+func handleLambda(ctx context.Context, event lambdaEvent) (response interface{}, err error) {
+	// Fatal errors outside of runs, e.g. while splitting a command, fail
+	// the invocation
+	defer recoverAborted(&err)
+	worker := lambdacontext.FunctionName
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		worker = fmt.Sprintf("%s/%s", lambdacontext.FunctionName, lc.AwsRequestID)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		log.Printf("Invoked as %s, %s left", worker, time.Until(deadline).Round(time.Second))
+	}
+	if len(event.Records) > 0 {
+		return handleWorkItems(event, worker), nil
+	}
+	if !contains(servableCommands, event.Command) {
+		return nil, fmt.Errorf("Command '%s' can't be run by Lambda", event.Command)
+	}
+	previousDryRun := *dryRun
+	*dryRun = event.DryRun
+	defer func() { *dryRun = previousDryRun }()
+	if event.Split {
+		return nil, splitCommand(event.Command)
+	}
+
+	run := distribute.NewRun(event.Command, time.Now())
+	result := runResult(run, distribute.AllAccounts, worker, event.Command, func() { runCommand(event.Command) })
+	log.Printf("Finished '%s' (%s)", event.Command, result.Summary)
+	if findConfig("work-bucket") == "" {
+		return []*distribute.Result{result}, nil
+	}
+	if err := initWorkStore().Save(result); err != nil {
+		return nil, fmt.Errorf("Could not store the result of run %s: %s", run, err)
+	}
+	return []*distribute.Result{result}, nil
+}
+
+// handleWorkItems processes the work items received from the work queue.
+// Items which can't be parsed are dropped. Items whose result can't be
+// stored are reported as failed, so that only they are received again,
+// and the other items of the batch aren't processed twice.
+func handleWorkItems(event lambdaEvent, worker string) *lambdaBatchResponse {
+	store := initWorkStore()
+	response := &lambdaBatchResponse{BatchItemFailures: []lambdaBatchItemFailure{}}
+	for _, record := range event.Records {
+		item, err := distribute.ParseWorkItem(record.Body)
+		if err != nil {
+			log.Printf("Dropping a work item which can't be processed: %s", err)
+			continue
+		}
+		log.Printf("Running %s against %s for run %s", item.Command, item.Account, item.Run)
+		result := runResult(item.Run, item.Account, worker, item.Command, func() { runWorkItem(item) })
+		log.Printf("Finished %s against %s (%s)", item.Command, item.Account, result.Summary)
+		if err := store.Save(result); err != nil {
+			log.Printf("Could not store the result of %s for run %s: %s", item.Account, item.Run, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, lambdaBatchItemFailure{ItemIdentifier: record.MessageID})
+		}
+	}
+	return response
+}
+
+// splitCommand sends a work item for every enabled account to the work
+// queue, without waiting for the results, which the function stores as
+// it processes the items
+func splitCommand(command string) error {
+	if !contains(distributableCommands, command) {
+		return fmt.Errorf("Command '%s' can't be split, it must be one of %v", command, distributableCommands)
+	}
+	csp := cspFromConfig(findConfig("csp"))
+	accounts := parseOrganization(findConfig("org-file")).EnabledAccounts(csp)
+	run := distribute.NewRun(command, time.Now())
+	if err := distribute.Enqueue(initWorkQueue(), run, command, string(csp), accounts, *dryRun); err != nil {
+		return fmt.Errorf("Could not queue run %s: %s", run, err)
+	}
+	log.Printf("Split %s into %d work items as run %s", command, len(accounts), run)
+	return nil
+}
@@ -6,17 +6,24 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/agaridata/cloudsweeper/cloud"
 	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
 	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
 	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
 	"github.com/agaridata/cloudsweeper/cloudsweeper/find"
 	"github.com/agaridata/cloudsweeper/cloudsweeper/notify"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/security"
 	"github.com/agaridata/cloudsweeper/cloudsweeper/setup"
+	"github.com/agaridata/cloudsweeper/status"
 )
 
 const (
@@ -30,14 +37,50 @@ var (
 	config      map[string]string
 	doNotDelete map[string]bool
 
-	cspToUse = flag.String("csp", "", "Which CSP to run against")
-	orgFile  = flag.String("org-file", "", "Specify where to find the JSON with organization information")
+	cspToUse   = flag.String("csp", "", "Which CSP to run against")
+	orgFile    = flag.String("org-file", "", "Specify where to find the JSON with organization information")
+	policyFile = flag.String("policy-file", "", "Specify where to find the JSON with the action of every resource category")
+	shadowFile = flag.String("shadow-policy-file", "", "Upcoming policy file compared with the active one by shadow-policy-review")
+	failOn     = flag.String("fail-on", "", "Exit with a non-zero code on 'errors' or also on 'warnings' (default: errors)")
+
+	inventoryFile     = flag.String("inventory-file", "", "File written by export-inventory and read by simulate (default: inventory.json)")
+	previousInventory = flag.String("previous-inventory-file", "", "Inventory compared with --inventory-file by diff (default: previous-inventory.json)")
+	graphDir          = flag.String("graph-dir", "", "Directory export-graph writes the resource graph of every account to (default: graphs)")
+	graphFormat       = flag.String("graph-format", "", "Format of the graphs written by export-graph, 'dot' or 'graphml' (default: dot)")
+	auditFile         = flag.String("audit-file", "", "File the actions taken in tui, delete and tag, and the resources deleted by cleanup, are appended to (default: audit.jsonl)")
+	tuiMarkDays       = flag.String("tui-mark-days", "", "Days until resources marked in tui are deleted (default: 4)")
+	bulkParallelism   = flag.String("bulk-parallelism", "", "How many resources delete and tag act on at a time (default: 5)")
+	policyTestFile    = flag.String("policy-test-file", "", "YAML file with the fixtures used by 'policy test' (default: policy-tests.yaml)")
+
+	directoryKind        = flag.String("directory", "", "Directory to sync the organization with, 'scim' or 'okta'")
+	directoryURL         = flag.String("directory-url", "", "Base URL of the SCIM server or Okta organization")
+	directoryToken       = flag.String("directory-token", "", "API token used to read users from the directory")
+	needsOwnerDays       = flag.String("needs-owner-days", "", "Days resources of departed owners can go unclaimed before being marked for cleanup (default: 14)")
+	directoryMaxDisabled = flag.String("directory-max-disabled-percent", "", "Percent of the employees above which directory-sync refuses to disable them (default: 10)")
+
+	serveCommands      = flag.String("serve-commands", "", "Commands run by serve, separated by commas (default: review,mark-for-cleanup,warn,cleanup)")
+	serveInterval      = flag.String("serve-interval", "", "How often serve runs its commands (default: 24h)")
+	serveWatchInterval = flag.String("serve-watch-interval", "", "How often serve checks the config files for changes (default: 1m)")
+	grpcAddress        = flag.String("grpc-address", "", "Address serve listens on for the gRPC API, e.g. :50051, empty means it isn't served")
+	grpcToken          = flag.String("grpc-token", "", "Bearer token clients of the gRPC API must send, empty means none is required")
+	grpcTLSCert        = flag.String("grpc-tls-cert", "", "Certificate file the gRPC API is served over TLS with, empty means it's served in clear text")
+	grpcTLSKey         = flag.String("grpc-tls-key", "", "Key file of --grpc-tls-cert")
+	grpcClientCA       = flag.String("grpc-client-ca", "", "CA file the certificates clients of the gRPC API must be signed by, empty means no certificate is required")
+	healthAddress      = flag.String("health-address", "", "Address serve listens on for /healthz and /readyz, e.g. :8080, empty means they aren't served")
 
 	awsBillingAccount      = flag.String("billing-account", "", "Specify AWS billing account id (e.g. 1234661312)")
-	awsBillingBucketRegion = flag.String("billing-bucket-region", "", "Specify AWS region where --billing-bucket is location")
+	awsBillingBucketRegion = flag.String("billing-bucket-region", "", "Specify AWS region where --billing-bucket is location (default: the region of the bucket)")
 	gcpBillingCSVPrefix    = flag.String("billing-csv-prefix", "", "Specify name prefix of GCP billing CSV files")
 	billingBucket          = flag.String("billing-bucket", "", "Specify bucket with billing CSVs")
 	awsBillingSortTag      = flag.String("billing-sort-tag", "", "Specify a tag to sort on when creating report")
+	billingCredits         = flag.String("billing-include-credits", "", "Whether credits and refunds are counted in the billing report (default: true)")
+	billingAmortize        = flag.String("billing-amortize-commitments", "", "Whether upfront commitment fees are spread over the commitment term in the billing report (default: false)")
+	billingCommitmentTerm  = flag.String("billing-commitment-term-months", "", "Months to spread upfront commitment fees over (default: 12)")
+	billingPeriod          = flag.String("billing-period", "", "Period of the billing report: month, last-month, week, last-week, quarter or last-quarter (default: month)")
+	billingStart           = flag.String("billing-start", "", "First day of the billing report, e.g. 2026-09-01, instead of --billing-period")
+	billingEnd             = flag.String("billing-end", "", "Last day of the billing report, e.g. 2026-09-30 (default: today)")
+	billingCompare         = flag.String("billing-compare", "", "Whether the billing report compares costs with the previous equivalent period (default: false)")
+	currencyRates          = flag.String("currency-rates", "", "JSON file with exchange rates from USD, or \"ecb\" to use the daily ECB rates")
 
 	mailUser     = flag.String("smtp-username", "", "SMTP username used to send email")
 	mailPassword = flag.String("smtp-password", "", "SMTP password used to send email")
@@ -50,14 +93,180 @@ var (
 	billingReportReceiver = flag.String("billing-report-addressee", "", "Receiver of month to date billing report")
 	summaryManager        = flag.String("total-sum-addressee", "", "Receiver of total cost sums")
 	mailDomain            = flag.String("mail-domain", "", "The mail domain appended to usernames specified in the organization")
+	mailTimeZone          = flag.String("mail-time-zone", "", "Time zone of dates in emails to users without a time_zone in the organization (default: America/New_York)")
+
+	unsubscribeFile       = flag.String("unsubscribe-file", "", "JSON file with the informational emails owners unsubscribed from (default: unsubscribes.json)")
+	unsubscribeURL        = flag.String("unsubscribe-url", "", "Public URL of the unsubscribe links served by serve, e.g. https://cloudsweeper.example.com/unsubscribe, empty means owners can't unsubscribe")
+	unsubscribeKeyFlag    = flag.String("unsubscribe-key", "", "Secret used to sign the unsubscribe links")
+	deliveryLogFile       = flag.String("delivery-log-file", "", "JSON file where the delivery of every email is recorded, empty means deliveries aren't tracked")
+	bounceQueueURL        = flag.String("bounce-queue-url", "", "URL of the SQS queue receiving the delivery and bounce notifications of SES")
+	eventQueueURL         = flag.String("event-queue-url", "", "URL of the SQS queue receiving the CloudTrail events of created resources from EventBridge")
+	bounceEscalationCount = flag.String("bounce-escalation-count", "", "Email the manager instead once an address bounced X times in a row, 0 means never (default: 3)")
+
+	accountParallelism = flag.String("account-parallelism", "", "Maximum number of accounts/projects processed at the same time, 0 means no limit")
+	accountTimeout     = flag.String("account-timeout", "", "Continue without an account/project not processed within this time, 0 means no limit (default: 1h)")
+	regionTimeout      = flag.String("region-timeout", "", "Continue without an AWS region or GCP zone not processed within this time, 0 means no limit (default: 20m)")
+	metricsFile        = flag.String("metrics-file", "", "File where the API calls made and resources listed are appended as a JSON line after every command")
+	enableInstances    = flag.String("enable-instances", "", "Discover, mark and clean up instances (default: true)")
+	enableImages       = flag.String("enable-images", "", "Discover, mark and clean up images (default: true)")
+	enableVolumes      = flag.String("enable-volumes", "", "Discover, mark and clean up volumes (default: true)")
+	enableSnapshots    = flag.String("enable-snapshots", "", "Discover, mark and clean up snapshots (default: true)")
+	enableBuckets      = flag.String("enable-buckets", "", "Discover, mark and clean up buckets (default: true)")
+	awsAggregator      = flag.String("aws-config-aggregator", "", "AWS Config aggregator in the master account to read instances and volumes from")
+	aggregatorRegion   = flag.String("aws-config-aggregator-region", "", "Region of the AWS Config aggregator (default: us-west-2)")
+	awsBucketReadDays  = flag.String("aws-bucket-read-days", "", "Days of S3 access logs to search for the last read of buckets, 0 means disabled")
+	awsLastUsedDays    = flag.String("aws-last-used-days", "", "Days of CloudTrail events to search for the last use of AMIs and snapshots, 0 means disabled")
+	awsLastTaggedDays  = flag.String("aws-last-tagged-days", "", "Days of CloudTrail events to search for the last tag change of resources, 0 means disabled")
+	awsRegionParallel  = flag.String("aws-region-parallelism", "", "Maximum number of regions of an AWS account processed at the same time, 0 means no limit")
+	awsConsoleSSOURL   = flag.String("aws-console-sso-start-url", "", "Start URL of AWS IAM Identity Center, links to the AWS console in emails sign in to the resource's account through it")
+	awsConsoleSSORole  = flag.String("aws-console-sso-role", "", "Permission set used to sign in to the AWS console with --aws-console-sso-start-url")
+	awsAccountAliases  = flag.String("aws-account-aliases", "", "Whether AWS account aliases are shown for accounts without a name in the organization (default: true)")
+	gcpImpersonate     = flag.String("gcp-impersonate", "", "GCP service accounts to impersonate separated by commas, the last one is used to access projects")
+	gcpQuotaProject    = flag.String("gcp-quota-project", "", "GCP project used for billing and quota of API calls")
+	kubernetesClusters = flag.String("kubernetes-clusters-file", "", "JSON file describing how to access every Kubernetes cluster")
+	kubernetesIdleDays = flag.String("kubernetes-idle-days", "", "Days without new pods, jobs or replica sets before a namespace is idle (default: 14)")
+	kubernetesOwner    = flag.String("kubernetes-owner-label", "", "Namespace label with the username of the namespace's owner (default: owner)")
+	vsphereServers     = flag.String("vsphere-servers-file", "", "JSON file describing how to access every vCenter")
+	whitelistTagKey    = flag.String("whitelist-tag-key", "", "Tag key which protects a resource from cleanup (default: cloudsweeper-whitelisted)")
+	lifetimeTagKey     = flag.String("lifetime-tag-key", "", "Tag key with the lifetime of a resource (default: cloudsweeper-lifetime)")
+	expiryTagKey       = flag.String("expiry-tag-key", "", "Tag key with the expiry date of a resource (default: cloudsweeper-expiry)")
+	deleteTagKey       = flag.String("delete-tag-key", "", "Tag key set by Cloudsweeper when marking a resource for deletion (default: cloudsweeper-delete-at)")
+	deleteReasonTagKey = flag.String("delete-reason-tag-key", "", "Tag key set by Cloudsweeper with the rule a resource was marked for deletion by (default: cloudsweeper-delete-reason)")
+	deletePolicyTagKey = flag.String("delete-policy-tag-key", "", "Tag key set by Cloudsweeper with the version of the policy a resource was marked for deletion under (default: cloudsweeper-delete-policy)")
+	tagSigningKey      = flag.String("tag-signing-key", "", "Secret used to sign the delete tag, unsigned delete tags are ignored if set")
+	costCenterTagKey   = flag.String("cost-center-tag-key", "", "Tag key with the cost center of a resource, overriding that of its account (default: cost-center)")
+	projectTagKey      = flag.String("project-tag-key", "", "Tag key with the project of a resource, overriding that of its account (default: project)")
+	providerPlugins    = flag.String("provider-plugins", "", "Go plugins adding support for other CSPs, separated by commas")
+
+	encryptedCopyTagKey = flag.String("encrypted-copy-tag-key", "", "Tag key set by Cloudsweeper on an unencrypted resource with the ID of its encrypted copy (default: cloudsweeper-encrypted-copy)")
+	encryptedFromTagKey = flag.String("encrypted-from-tag-key", "", "Tag key set by Cloudsweeper on an encrypted copy with the ID of the resource it was copied from (default: cloudsweeper-encrypted-from)")
+	archivedTagKey      = flag.String("archived-tag-key", "", "Tag key set by Cloudsweeper on a snapshot moved to the archive tier, with the time it was archived (default: cloudsweeper-archived)")
+	needsOwnerTagKey    = flag.String("needs-owner-tag-key", "", "Tag key set by Cloudsweeper on a resource of a departed employee, with the time it was found without an owner (default: cloudsweeper-needs-owner)")
+	claimedByTagKey     = flag.String("claimed-by-tag-key", "", "Tag key with the username of the active employee who took over a resource of a departed employee (default: cloudsweeper-claimed-by)")
+
+	workQueueURL      = flag.String("work-queue-url", "", "URL of the SQS queue coordinate sends a work item per account to, and work receives them from")
+	workBucket        = flag.String("work-bucket", "", "S3 bucket where workers store the results of work items for the coordinator")
+	workPrefix        = flag.String("work-prefix", "", "Prefix of the keys of the results in the work bucket")
+	workBucketRegion  = flag.String("work-bucket-region", "", "Region of the work bucket (default: the region of the bucket)")
+	distributeTimeout = flag.String("distribute-timeout", "", "How long coordinate waits for the results of all accounts (default: 2h)")
 
 	setupARN = flag.String("aws-master-arn", "", "AWS ARN of role in account used by Cloudsweeper to assume roles")
 
-	findResourceID = flag.String("resource-id", "", "ID of resource to find with find-resource command")
+	disputeFile = flag.String("dispute-file", "", "JSON file with the review queue of resources whose owners replied that they aren't theirs (default: disputes.json)")
+
+	chargebackMonth        = flag.String("chargeback-month", "", "Month of the chargeback statements, e.g. 2026-09 (default: last month)")
+	chargebackBucket       = flag.String("chargeback-bucket", "", "S3 bucket where chargeback statements are archived, empty means they aren't archived")
+	chargebackPrefix       = flag.String("chargeback-prefix", "", "Prefix of the keys of the chargeback statements in the chargeback bucket")
+	chargebackBucketRegion = flag.String("chargeback-bucket-region", "", "Region of the chargeback bucket (default: the region of the bucket)")
+
+	findLive       = flag.Bool("find-live", false, "Whether find searches the accounts rather than --inventory-file, which is also done if there is no inventory")
+	findResourceID = flag.String("resource-id", "", "ID of resource to find with find-resource command, or to protect or extend with me")
+
+	meAccount     = flag.String("me-account", "", "Your own account or project used by me (default: the account of your AWS credentials)")
+	extendDays    = flag.String("extend-days", "", "Days to postpone the deletion of a resource with 'me extend' or a reply (default: 7)")
+	maxExtendDays = flag.String("max-extend-days", "", "Most days a reply can postpone the deletion of a resource by (default: 30)")
+
+	ownerSigningKey = flag.String("owner-signing-key", "", "Key signing the delete tags of your own resources with 'me extend', printed by owner-signing-key")
+
+	repliesBucket       = flag.String("replies-bucket", "", "S3 bucket where SES stores the replies to notification emails")
+	repliesPrefix       = flag.String("replies-prefix", "", "Prefix of the keys of the replies in the replies bucket")
+	repliesBucketRegion = flag.String("replies-bucket-region", "", "Region of the replies bucket (default: the region of the bucket)")
+	repliesAuthServID   = flag.String("replies-authserv-id", "", "Authserv-id of the Authentication-Results the receiving mail server adds to replies (default: amazonses.com)")
+
+	confirmEarlyDeletionFees = flag.Bool("confirm-early-deletion-fees", false, "Whether cleanup deletes buckets with early deletion fees above --early-deletion-fee-limit")
+	earlyDeletionFeeLimit    = flag.String("early-deletion-fee-limit", "", "Largest early deletion fee in USD of a bucket deleted without --confirm-early-deletion-fees (default: 10)")
+	deleteEmptyBuckets       = flag.Bool("delete-empty-buckets", false, "Whether cleanup deletes empty buckets right away, without marking them first")
+	releaseElasticIPs        = flag.Bool("release-elastic-ips", false, "Whether cleanup releases the Elastic IPs of the instances it terminates")
+
+	resumeRun               = flag.String("resume", "", "ID of an interrupted cleanup run to resume where it left off")
+	cleanupDeletesPerMinute = flag.String("cleanup-deletes-per-minute", "", "Most resources cleanup deletes per minute, 0 for no limit (default: 0)")
+	checkpointDir           = flag.String("checkpoint-dir", "", "Directory the checkpoints of cleanup runs are saved in, if there is no work bucket (default: checkpoints)")
+
+	outputFormat = flag.String("format", "", "Output format of config effective, json or text (default: json)")
+
+	testChannelFlag = flag.Bool("test-channel", false, "Whether notify sends a test email with diagnostics of the SMTP settings")
 
 	dryRun       = flag.Bool("marking-dry-run", false, "Whether to perform a dry run for mark and delete (nothing will actually be marked)")
 	requiredTags = flag.String("required-tags", "", "Required tags separated by commas")
 
+	sensitivePorts     = flag.String("sensitive-ports", "", "Ports which should not be open to the internet, separated by commas (default: SSH, RDP, databases etc.)")
+	temporaryTagKey    = flag.String("temporary-tag-key", "", "Tag key marking security groups whose open rules may be revoked (default: cloudsweeper-temporary)")
+	remediateTemporary = flag.Bool("remediate-temporary", false, "Whether to revoke open rules of security groups tagged as temporary in security-review")
+
+	remediateUnencrypted = flag.Bool("remediate-unencrypted", false, "Whether to create encrypted snapshots of unencrypted volumes and snapshots in encryption-review")
+
+	archiveOlderThanDays = flag.String("archive-snapshots-older-than-days", "", "Recommend archiving snapshots older than X days and not restored in that time (default: 90)")
+	archiveSnapshots     = flag.Bool("archive-snapshots", false, "Whether to move the recommended snapshots to the archive tier in archive-review")
+
+	multipartOlderThanDays = flag.String("multipart-uploads-older-than-days", "", "Find incomplete multipart uploads started more than X days ago (default: 7)")
+	abortMultipartUploads  = flag.Bool("abort-multipart-uploads", false, "Whether to abort the incomplete multipart uploads found by multipart-review")
+
+	fileSystemIdleDays        = flag.String("file-system-idle-days", "", "File systems without IO in X days are idle (default: 30)")
+	fileSystemDeleteAfterDays = flag.String("file-system-delete-after-days", "", "Days after being marked that idle file systems are deleted by --cleanup-file-systems (default: 7)")
+	cleanupFileSystems        = flag.Bool("cleanup-file-systems", false, "Whether file-system-review marks idle file systems for deletion, and deletes the ones marked before")
+
+	monitoringUnusedDays   = flag.String("monitoring-unused-days", "", "Dashboards not viewed or modified in X days are unused (default: 30)")
+	vpnIdleDays            = flag.String("vpn-idle-days", "", "VPNs without connections or traffic in X days are idle (default: 30)")
+	vpnDeleteAfterDays     = flag.String("vpn-delete-after-days", "", "Idle VPNs are deleted X days after being marked (default: 7)")
+	cleanupVPNs            = flag.Bool("cleanup-vpns", false, "Whether vpn-review marks and deletes the idle VPNs it finds")
+	cleanupTGWs            = flag.Bool("cleanup-transit-gateways", false, "Whether transit-gateway-review detaches unused attachments and deletes blackhole routes")
+	cleanupMonitoring      = flag.Bool("cleanup-monitoring", false, "Whether monitoring-review deletes the dead alarms and unused dashboards it finds")
+	networkCreatedDays     = flag.String("network-created-days", "", "Networks created in the last X days are not reviewed (default: 7)")
+	networkDeleteAfterDays = flag.String("network-delete-after-days", "", "Days after being marked that empty networks are deleted by --cleanup-networks (default: 7)")
+	cleanupNetworks        = flag.Bool("cleanup-networks", false, "Whether network-review marks empty networks for deletion, and deletes the ones marked before")
+
+	clusterIdleHours           = flag.String("cluster-idle-hours", "", "Clusters which didn't run any work in X hours are idle (default: 6)")
+	clusterTerminateAfterHours = flag.String("cluster-terminate-after-hours", "", "Idle clusters are terminated X hours after being marked (default: 24)")
+	terminateIdleClusters      = flag.Bool("terminate-idle-clusters", false, "Whether cluster-review marks idle clusters for termination, and terminates the ones marked before")
+
+	gpuIdleHours        = flag.String("gpu-idle-hours", "", "GPU instances which weren't busy in X hours are idle (default: 8)")
+	gpuIdlePercent      = flag.String("gpu-idle-percent", "", "GPU instances whose GPUs, or CPUs if GPU utilization isn't reported, were never more than X percent busy are idle (default: 5)")
+	gpuDeleteAfterHours = flag.String("gpu-delete-after-hours", "", "Idle GPU instances are deleted X hours after being marked (default: 24)")
+	cleanupGPUInstances = flag.Bool("cleanup-gpu-instances", false, "Whether gpu-review marks idle GPU instances for deletion, and deletes the ones marked before, unless the policy only notifies about them")
+
+	mlIdleDays        = flag.String("ml-idle-days", "", "Machine learning resources not used in X days are idle (default: 3)")
+	mlDeleteAfterDays = flag.String("ml-delete-after-days", "", "Idle endpoints and Studio apps are deleted X days after being marked (default: 7)")
+	mlOwnerTag        = flag.String("ml-owner-tag", "", "Tag with the username of the owner of a machine learning resource (default: owner)")
+	cleanupML         = flag.Bool("cleanup-ml", false, "Whether ml-review stops idle notebook instances, and marks and deletes idle endpoints and Studio apps")
+
+	imageCopyRegions    = flag.String("image-copy-regions", "", "Regions where copies of images are always kept, separated by commas")
+	imageCopyUnusedDays = flag.String("image-copy-unused-days", "", "Copies of images not used in X days are unused (default: 30)")
+	removeImageCopies   = flag.Bool("remove-image-copies", false, "Whether to remove the unused image copies, and their snapshots, found by image-copy-review")
+
+	quotaUsagePercent = flag.String("quota-usage-percent", "", "Report service quotas of which at least X percent is used (default: 80)")
+
+	spotReviewAccounts            = flag.String("spot-review-accounts", "", "IDs or names of the development accounts whose instances spot-review looks at, separated by commas, all accounts if not set")
+	spotReviewRunningDays         = flag.String("spot-review-running-days", "", "Report on-demand instances running for more than X days (default: 30)")
+	spotReviewSavingsPlanDiscount = flag.String("spot-review-savings-plan-discount", "", "Percent a savings plan is estimated to take off the on-demand price (default: 28)")
+
+	reviewRightSizing        = flag.String("review-rightsizing", "", "Whether to recommend smaller types for underused AWS instances in review emails (default: false)")
+	rightSizingDays          = flag.String("rightsizing-days", "", "Look at the utilization of instances over the last X days, and only recommend instances running for as long (default: 14)")
+	rightSizingCPUPercent    = flag.String("rightsizing-cpu-percent", "", "Recommend a smaller type if the p95 CPU utilization is below X percent (default: 40)")
+	rightSizingMemoryPercent = flag.String("rightsizing-memory-percent", "", "Recommend a smaller type if the p95 memory utilization is below X percent (default: 40)")
+
+	bucketHistoryFile   = flag.String("bucket-history-file", "", "File with the size and object count of buckets over time, updated by bucket-growth-review (default: bucket-history.json)")
+	bucketGrowthPercent = flag.String("bucket-growth-percent", "", "Flag buckets which grew by more than X percent in a month (default: 20)")
+
+	markCostThreshold         = flag.String("mark-cost-threshold", "", "Only mark resources if those matching the rules in an account cost at least X USD in total (default: 10)")
+	markResourceCostThreshold = flag.String("mark-resource-cost-threshold", "", "Mark resources costing at least X USD even if their account is below --mark-cost-threshold, 0 means disabled")
+	markOwnerCostThresholds   = flag.String("mark-owner-cost-thresholds", "", "Accounts with their own --mark-cost-threshold, e.g. 123456789012=50, separated by commas")
+
+	notifyCostThreshold       = flag.String("notify-cost-threshold", "", "Only email owners about resources if they cost at least X USD per month in total, 0 means always (default: 0)")
+	notifyOwnerCostThresholds = flag.String("notify-owner-cost-thresholds", "", "Owners with their own --notify-cost-threshold, e.g. jdoe=25, separated by commas")
+	notifyDigestFile          = flag.String("notify-digest-file", "", "JSON file with the resources left out of emails, sent in a monthly digest by notify-digest (default: notify-digest.json)")
+
+	imagePipelineSources = flag.String("image-pipeline-sources", "", "Where the builds of image pipelines are read from, 'image-builder' or Packer manifests, separated by commas")
+	imagePipelineKeepN   = flag.String("image-pipeline-keep-n", "", "Never mark the AMIs of the X latest builds of every image pipeline (default: 3)")
+	excludeBackupManaged = flag.String("exclude-backup-managed", "", "Whether snapshots and AMIs created by AWS Backup are left to their backup plan (default: true)")
+	excludeDLMManaged    = flag.String("exclude-dlm-managed", "", "Whether snapshots created by Data Lifecycle Manager are left to their policy (default: true)")
+
+	remarkFile            = flag.String("remark-file", "", "JSON file with how many times every resource has been marked for cleanup again (default: remarks.json)")
+	remarkEscalationCount = flag.String("remark-escalation-count", "", "Report resources marked again X times after their delete tag was removed, 0 means never (default: 3)")
+
+	outdatedMarks = flag.String("outdated-marks", "", "What cleanup does with resources marked under an outdated policy: delete, keep or reevaluate (default: delete)")
+
+	freezeWindows = flag.String("freeze-windows", "", "Change freezes without cleanup or deletion emails, e.g. '2026-12-20..2027-01-04; * * sat,sun', separated by semicolons")
+
 	// Thresholds
 	thresholds = make(map[string]int)
 	thnames    = []string{
@@ -110,18 +319,132 @@ const banner = `
 `
 
 func main() {
-	fmt.Println(banner)
+	// Unexpected errors when listing resources end the run, unless a
+	// command running for longer, such as serve, turns it off
+	status.ExitOnFatal = true
 	loadFile(configFileName)
 	flag.Parse()
+	if args := flag.Args(); len(args) >= 2 && args[0] == "config" && args[1] == "effective" {
+		// Checked before printing the banner, since the configuration
+		// must be the only output
+		os.Exit(configEffective(args[2:]))
+	}
+	fmt.Print(banner)
+	command := getPositionalCmd()
+	if command == "" && runningInLambda() {
+		command = "lambda"
+	}
+	if command == "validate" {
+		// Validate before anything else, as loading the config exits on
+		// the first problem
+		os.Exit(validate())
+	}
+	resolveSecrets()
 	loadThresholds()
+	loadTagKeys()
+	loadFreezeWindows()
+	loadProviderPlugins()
+	failOnSetting := findConfig("fail-on")
+	if !status.ValidFailOn(failOnSetting) {
+		fatalf("Invalid value '%s' for --fail-on, must be '%s' or '%s'", failOnSetting, status.FailOnErrors, status.FailOnWarnings)
+	}
+	if command == "policy test" {
+		os.Exit(policyTest())
+	}
+	if command == "notify" || command == "notify --test-channel" {
+		// Flags after the command aren't parsed, so accept both orders
+		if !*testChannelFlag && command == "notify" {
+			fatalln("Please specify what to notify, e.g. --test-channel")
+		}
+		os.Exit(testChannel())
+	}
+	if command == "serve" {
+		serve()
+		return
+	}
+	if command == "lambda" {
+		runLambda()
+		return
+	}
+	runCommand(command)
+	reportMetrics(command)
+	log.Printf("Finished running (%s)", status.Summary())
+	os.Exit(status.ExitCode(failOnSetting))
+}
+
+// runCommand runs a single command, such as mark-for-cleanup
+func runCommand(command string) {
 	csp := cspFromConfig(findConfig("csp"))
 	log.Printf("Running against %s...\n", csp)
-	switch getPositionalCmd() {
+	if args := flag.Args(); len(args) > 0 && args[0] == "assign" {
+		// The resource and owner are arguments of the command
+		log.Println("Entering 'assign' mode")
+		assignResource(csp, parseOrganization(findConfig("org-file")), args[1:])
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "find" {
+		// The query is an argument of the command
+		log.Println("Entering 'find' mode")
+		findResources(csp, parseOrganization(findConfig("org-file")), args[1:])
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && (args[0] == "delete" || args[0] == "tag") {
+		// The file of IDs and the tag are flags of the command
+		log.Printf("Entering '%s' mode", args[0])
+		bulkOperation(csp, parseOrganization(findConfig("org-file")), args[0], args[1:])
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && (args[0] == "unsubscribe" || args[0] == "resubscribe") {
+		// The username and email are arguments of the command
+		log.Printf("Entering '%s' mode", args[0])
+		manageSubscription(args[0], args[1:])
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "audit" {
+		// The resource ID is an argument of the command
+		log.Println("Entering 'audit' mode")
+		auditShow(args[1:])
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "coordinate" {
+		// The distributed command is an argument of the command
+		log.Println("Entering 'coordinate' mode")
+		coordinate(csp, args[1:])
+		return
+	}
+	switch command {
 	case "cleanup":
 		log.Println("Entering cleanup mode")
 		org := parseOrganization(findConfig("org-file"))
-		mngr := initManager(csp, org)
-		cleanup.PerformCleanup(mngr)
+		mngr := initCleanupManager(csp, org)
+		if mngr == nil {
+			break
+		}
+		loadDisputed()
+		loadRetainedImages(mngr)
+		if _, frozen := cleanup.ActiveFreeze(time.Now()); frozen {
+			// Nothing is deleted during a freeze, so postpone what would
+			// have been until after it instead
+			cleanup.PostponeFrozenMarks(mngr, *dryRun)
+			break
+		}
+		pol := parsePolicy(findConfig("policy-file"))
+		activePolicy := cleanup.NewPolicyVersion(pol, thresholds)
+		setCleanupOptions(func(opts *cleanup.Options) {
+			opts.EarlyDeletionFeeLimit = float64(findConfigInt("early-deletion-fee-limit"))
+			opts.ConfirmEarlyDeletionFees = *confirmEarlyDeletionFees
+			opts.HookPolicy = pol
+			opts.ActivePolicy = &activePolicy
+			opts.OutdatedMarks = findConfig("outdated-marks")
+			opts.AuditTrail = audit.NewTrail(findConfig("audit-file"))
+			opts.DeletesPerMinute = findConfigInt("cleanup-deletes-per-minute")
+		})
+		terminated := cleanup.PerformCleanup(mngr)
+		initNotifyClient().CleanupReport(terminated, org.AccountToUserMapping(csp))
+		if *deleteEmptyBuckets {
+			loadDoNotDelete()
+			cleanup.CleanupEmptyBuckets(mngr, thresholds["clean-bucket-older-than-days"], doNotDelete, *dryRun)
+		}
 	case "reset":
 		log.Println("Entering reset mode")
 		org := parseOrganization(findConfig("org-file"))
@@ -131,50 +454,81 @@ func main() {
 		log.Println("Entering 'mark-for-cleanup' mode")
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
-		taggedResources := cleanup.MarkForCleanup(mngr, thresholds, *dryRun)
+		pol := parsePolicy(findConfig("policy-file"))
+		loadCostThresholds()
+		loadDisputed()
+		loadRetainedImages(mngr)
+		loadRemarks()
+		taggedResources, notifyOnly, err := cleanup.MarkForCleanup(mngr, thresholds, pol, *dryRun)
+		if err != nil {
+			fatalf("Could not mark resources for cleanup: %s", err)
+		}
 		if *dryRun {
 			client := initNotifyClient()
 			client.MarkingDryRunReport(taggedResources, org.AccountToUserMapping(csp))
+			log.Println("Not notifying about notify-only resources since this was a dry run")
 		} else {
 			log.Println("Not sending marking report since this was not a dry run")
+			client := initNotifyClient()
+			client.NotifyOnlyReview(notifyOnly, org.AccountToUserMapping(csp))
+			saveRemarks()
+			limit := findConfigInt("remark-escalation-count")
+			client.RemarkReview(cleanup.CurrentOptions().Remarks.Escalated(limit), limit)
+		}
+	case "shadow-policy-review":
+		log.Println("Entering 'shadow-policy-review' mode")
+		shadowPolicyFile := findConfig("shadow-policy-file")
+		if shadowPolicyFile == "" {
+			fatalln("Please supply the upcoming policy with --shadow-policy-file")
+		}
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		delta, err := cleanup.ShadowMarking(mngr, thresholds, parsePolicy(findConfig("policy-file")), parsePolicy(shadowPolicyFile))
+		if err != nil {
+			fatalf("Could not evaluate the upcoming policy: %s", err)
+		}
+		log.Print(formatSimulation("Additionally marked under the upcoming policy", delta))
+		if *dryRun {
+			log.Println("Not notifying owners since this was a dry run")
+			break
 		}
+		client := initNotifyClient()
+		client.ShadowPolicyReview(delta, org.AccountToUserMapping(csp))
 	case "review":
 		log.Println("Entering 'review' mode")
+		if skipDuringFreeze("review emails") {
+			break
+		}
 		loadDoNotDelete()
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
 		client := initNotifyClient()
-		client.OldResourceReview(mngr, org, csp, thresholds, doNotDelete)
+		if err := client.OldResourceReview(mngr, org, csp, thresholds, doNotDelete); err != nil {
+			fatalf("Could not review old resources: %s", err)
+		}
+	case "notify-digest":
+		log.Println("Entering 'notify-digest' mode")
+		if skipDuringFreeze("digest emails") {
+			break
+		}
+		loadDigest()
+		client := initNotifyClient()
+		client.MonthlyDigest()
 	case "warn":
 		log.Println("Entering 'warn' mode")
+		if skipDuringFreeze("deletion warnings") {
+			break
+		}
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
 		client := initNotifyClient()
 		client.DeletionWarning(findConfigInt("warning-hours"), mngr, org.AccountToUserMapping(csp))
 	case "billing-report":
 		log.Println("Entering 'billing-report' mode", csp)
-		var reporter billing.Reporter
-		if csp == cloud.AWS {
-			billingAccount := findConfig("billing-account")
-			bucket := findConfig("billing-bucket")
-			region := findConfig("billing-bucket-region")
-			sortTag := findConfig("billing-sort-tag")
-			reporter = billing.NewReporterAWS(billingAccount, bucket, region, sortTag)
-		} else if csp == cloud.GCP {
-			bucket := findConfig("billing-bucket")
-			prefix := findConfig("billing-csv-prefix")
-			reporter = billing.NewReporterGCP(bucket, prefix)
-		} else {
-			log.Fatalf("Invalid CSP specified")
-			return
-		}
-		report := billing.GenerateReport(reporter)
-		org := parseOrganization(findConfig("org-file"))
-		mapping := org.AccountToUserMapping(csp)
-		sortTagKey := findConfig("billing-sort-tag")
-		log.Println(report.FormatReport(mapping, sortTagKey != ""))
-		client := initNotifyClient()
-		client.MonthToDateReport(report, mapping, sortTagKey != "")
+		billingReport(csp, parseOrganization(findConfig("org-file")))
+	case "chargeback-report":
+		log.Println("Entering 'chargeback-report' mode", csp)
+		chargebackReport(csp, parseOrganization(findConfig("org-file")))
 	case "find-untagged":
 		log.Println("Entering 'find-untagged' mode")
 		org := parseOrganization(findConfig("org-file"))
@@ -183,40 +537,520 @@ func main() {
 		client := initNotifyClient()
 		tags := tagsFromConfig(findConfig("required-tags"))
 		client.UntaggedResourcesReview(mngr, mapping, tags)
+	case "security-review":
+		log.Println("Entering 'security-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		exposures := security.FindExposure(mngr, portsFromConfig(findConfig("sensitive-ports")))
+		tagKey := findConfig("temporary-tag-key")
+		revoked := []security.OpenGroup{}
+		if *remediateTemporary {
+			revoked = security.RemediateTemporary(exposures, tagKey, false)
+		}
+		client := initNotifyClient()
+		client.ExposureReview(exposures, revoked, tagKey, org.AccountToUserMapping(csp))
+	case "encryption-review":
+		log.Println("Entering 'encryption-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		found := security.FindUnencrypted(mngr)
+		copies := []security.EncryptedCopy{}
+		if *remediateUnencrypted {
+			copies = security.RemediateUnencrypted(found, *dryRun)
+		}
+		client := initNotifyClient()
+		client.UnencryptedReview(found, copies, org.AccountToUserMapping(csp))
+	case "archive-review":
+		log.Println("Entering 'archive-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("archive-snapshots-older-than-days")
+		found := cleanup.FindArchiveCandidates(mngr, days)
+		archived := []cloud.Snapshot{}
+		if *archiveSnapshots {
+			archived = cleanup.ArchiveSnapshots(found, *dryRun)
+		}
+		client := initNotifyClient()
+		client.ArchiveReview(found, archived, days, org.AccountToUserMapping(csp))
+	case "multipart-review":
+		log.Println("Entering 'multipart-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("multipart-uploads-older-than-days")
+		found := cleanup.FindStaleMultipartUploads(mngr, days)
+		if *abortMultipartUploads {
+			reclaimed := cleanup.AbortMultipartUploads(found, *dryRun)
+			log.Printf("Reclaimed %.2f GB by aborting multipart uploads", float64(reclaimed)/(1<<30))
+		}
+		if *dryRun {
+			log.Println("Not sending multipart upload review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.MultipartUploadReview(found, days, org.AccountToUserMapping(csp))
+	case "file-system-review":
+		log.Println("Entering 'file-system-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("file-system-idle-days")
+		found := cleanup.FindIdleFileSystems(mngr, days)
+		if *cleanupFileSystems {
+			loadHookPolicy()
+			cleanup.CleanupIdleFileSystems(found, findConfigInt("file-system-delete-after-days"), *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending file system review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.FileSystemReview(found, days, org.AccountToUserMapping(csp))
+	case "vpn-review":
+		log.Println("Entering 'vpn-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("vpn-idle-days")
+		found := cleanup.FindIdleVPNs(mngr, days)
+		if *cleanupVPNs {
+			loadHookPolicy()
+			cleanup.CleanupIdleVPNs(found, findConfigInt("vpn-delete-after-days"), *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending VPN review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.VPNReview(found, days, org.AccountToUserMapping(csp))
+	case "transit-gateway-review":
+		log.Println("Entering 'transit-gateway-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		found := cleanup.FindUnusedTransitGateways(mngr)
+		if *cleanupTGWs {
+			cleanup.CleanupUnusedTransitGateways(found, *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending transit gateway review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.TransitGatewayReview(found, org.NetworkOwnersOf, org.AccountToUserMapping(csp))
+	case "cluster-review":
+		log.Println("Entering 'cluster-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		hours := findConfigInt("cluster-idle-hours")
+		found := cleanup.FindIdleDataClusters(mngr, hours)
+		if *terminateIdleClusters {
+			loadHookPolicy()
+			cleanup.CleanupIdleDataClusters(found, findConfigInt("cluster-terminate-after-hours"), *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending cluster review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.DataClusterReview(found, hours, org.AccountToUserMapping(csp))
+	case "gpu-review":
+		log.Println("Entering 'gpu-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		pol := parsePolicy(findConfig("policy-file"))
+		setCleanupOptions(func(opts *cleanup.Options) { opts.HookPolicy = pol })
+		hours, percent := findConfigInt("gpu-idle-hours"), findConfigInt("gpu-idle-percent")
+		found := cleanup.FindIdleGPUInstances(mngr, hours, percent, pol)
+		marking := *cleanupGPUInstances && !pol.NotifyOnly(policy.GPUInstances)
+		if *cleanupGPUInstances {
+			cleanup.CleanupIdleGPUInstances(found, findConfigInt("gpu-delete-after-hours"), pol, *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending GPU review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.GPUReview(found, hours, percent, marking, org.AccountToUserMapping(csp))
+	case "ml-review":
+		log.Println("Entering 'ml-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("ml-idle-days")
+		found := cleanup.FindIdleMLResources(mngr, days)
+		if *cleanupML {
+			loadHookPolicy()
+			cleanup.CleanupIdleMLResources(found, findConfigInt("ml-delete-after-days"), *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending machine learning review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.MLReview(found, days, findConfig("ml-owner-tag"), org.UsernameToEmployeeMapping(), org.AccountToUserMapping(csp))
+	case "monitoring-review":
+		log.Println("Entering 'monitoring-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("monitoring-unused-days")
+		found := cleanup.FindDeadMonitoring(mngr, days)
+		if *cleanupMonitoring {
+			cleanup.CleanupDeadMonitoring(found, *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending monitoring review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.MonitoringReview(found, days, org.AccountToUserMapping(csp))
+	case "network-review":
+		log.Println("Entering 'network-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("network-created-days")
+		found := cleanup.FindEmptyNetworks(mngr, days)
+		if *cleanupNetworks {
+			loadHookPolicy()
+			cleanup.CleanupEmptyNetworks(found, findConfigInt("network-delete-after-days"), *dryRun)
+		}
+		if *dryRun {
+			log.Println("Not sending network review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.NetworkReview(found, days, org.AccountToUserMapping(csp))
+	case "image-copy-review":
+		log.Println("Entering 'image-copy-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("image-copy-unused-days")
+		found := cleanup.FindImageCopies(mngr, listFromConfig(findConfig("image-copy-regions")), days)
+		if *removeImageCopies {
+			removed := cleanup.RemoveUnusedImageCopies(found, *dryRun)
+			var sizeGB int64
+			for _, img := range removed {
+				sizeGB += img.SizeGB()
+			}
+			log.Printf("Removed %d image copies with %d GB of snapshots", len(removed), sizeGB)
+		}
+		if *dryRun {
+			log.Println("Not sending image copy review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.ImageCopyReview(found, days, org.AccountToUserMapping(csp))
+	case "spot-review":
+		log.Println("Entering 'spot-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		days := findConfigInt("spot-review-running-days")
+		found := cleanup.FindSpotCandidates(mngr, listFromConfig(findConfig("spot-review-accounts")), days, findConfigInt("spot-review-savings-plan-discount"))
+		if *dryRun {
+			accounts := []string{}
+			for account := range found {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+			for _, account := range accounts {
+				for _, candidate := range found[account] {
+					log.Printf("%s: %s (%s) in %s has run for %d days, costs $%.2f/month, spot would save $%.2f/month and a savings plan $%.2f/month", cloud.AccountDisplayName(account), candidate.Instance.ID(), candidate.Instance.InstanceType(), candidate.Instance.Location(), candidate.RunningDays(), candidate.OnDemandPerMonth, candidate.SpotSavingsPerMonth(), candidate.SavingsPlanSavingsPerMonth())
+				}
+			}
+			log.Println("Not sending spot review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.SpotReview(found, days, org.AccountToUserMapping(csp))
+	case "quota-review":
+		log.Println("Entering 'quota-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		percent := findConfigInt("quota-usage-percent")
+		found := cleanup.FindQuotaPressure(mngr, percent)
+		if *dryRun {
+			accounts := []string{}
+			for account := range found {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+			for _, account := range accounts {
+				for _, quota := range found[account] {
+					log.Printf("%s uses %.0f of %.0f %s in %s", cloud.AccountDisplayName(account), quota.Usage, quota.Limit, quota.Name, quota.Location)
+				}
+			}
+			log.Println("Not sending quota review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.QuotaReview(found, percent, org.AccountToUserMapping(csp))
+	case "lifecycle-review":
+		log.Println("Entering 'lifecycle-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		pol := parsePolicy(findConfig("policy-file"))
+		found := cleanup.CompareLifecyclePolicies(mngr, thresholds["clean-snapshots-older-than-days"], pol)
+		if *dryRun {
+			accounts := []string{}
+			for account := range found {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+			for _, account := range accounts {
+				for _, comparison := range found[account] {
+					log.Printf("%s: Schedule '%s' of %s in %s retains snapshots for ~%d days, marked after %d days: %s", cloud.AccountDisplayName(account), comparison.Schedule.Name, comparison.Policy.ID, comparison.Policy.Location, comparison.Schedule.RetentionDays(), comparison.CleanupDays, comparison.Verdict)
+				}
+			}
+			log.Println("Not sending lifecycle policy review since this was a dry run")
+			break
+		}
+		client := initNotifyClient()
+		client.LifecycleReview(found, org.AccountToUserMapping(csp))
+	case "bucket-growth-review":
+		log.Println("Entering 'bucket-growth-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		bucketGrowthReview(mngr, org.AccountToUserMapping(csp))
 	case "find-resource":
 		id := *findResourceID
 		if id == "" {
-			log.Fatalln("Must specify a resource ID to find using --resource-id=<ID>")
+			fatalln("Must specify a resource ID to find using --resource-id=<ID>")
 		}
 		log.Printf("Entering 'find-resource' mode (Resource ID: %s)", id)
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
 		client, err := find.Init(mngr, org, csp)
 		if err != nil {
-			log.Fatalf("Could not initalize find client: %s", err)
+			fatalf("Could not initalize find client: %s", err)
 		}
 		err = client.FindResource(id)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+	case "outdated-marks":
+		log.Println("Entering 'outdated-marks' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		listOutdatedMarks(mngr, parsePolicy(findConfig("policy-file")))
+	case "export-inventory":
+		log.Println("Entering 'export-inventory' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		exportInventory(mngr, findConfig("inventory-file"))
+	case "export-graph":
+		log.Println("Entering 'export-graph' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		exportGraphs(mngr, findConfig("graph-dir"), findConfig("graph-format"))
+	case "tui":
+		log.Println("Entering 'tui' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		pol := parsePolicy(findConfig("policy-file"))
+		setCleanupOptions(func(opts *cleanup.Options) { opts.HookPolicy = pol })
+		loadCostThresholds()
+		loadDisputed()
+		loadRetainedImages(mngr)
+		runTUI(mngr, pol, *dryRun)
+	case "simulate":
+		log.Println("Entering 'simulate' mode")
+		simulate(findConfig("inventory-file"))
+	case "diff":
+		log.Println("Entering 'diff' mode")
+		diffInventories(findConfig("previous-inventory-file"), findConfig("inventory-file"))
+	case "me", "me protect", "me extend":
+		runMe(command, csp)
+	case "owner-signing-key":
+		printOwnerSigningKey()
+	case "directory-sync":
+		log.Println("Entering 'directory-sync' mode")
+		syncDirectory()
+	case "departed-owners-review":
+		log.Println("Entering 'departed-owners-review' mode")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		orphaned := cleanup.HandleOrphanedResources(mngr, org, csp, findConfigInt("needs-owner-days"), *dryRun)
+		if *dryRun {
+			for _, owner := range orphaned {
+				log.Printf("%s has %d unclaimed resources", owner.Employee.Username, len(owner.Resources))
+			}
+			log.Println("Not sending departed owners review since this was a dry run")
+			break
 		}
+		client := initNotifyClient()
+		client.DepartedOwnersReview(orphaned)
+	case "process-replies":
+		log.Println("Entering 'process-replies' mode")
+		org := parseOrganization(findConfig("org-file"))
+		processReplies(csp, org)
+	case "unsubscribes":
+		log.Println("Entering 'unsubscribes' mode")
+		listUnsubscribes()
+	case "disputes":
+		log.Println("Entering 'disputes' mode")
+		listDisputes()
+	case "process-bounces":
+		log.Println("Entering 'process-bounces' mode")
+		processBounces()
+	case "watch-events":
+		log.Println("Entering 'watch-events' mode")
+		watchEvents()
+	case "work":
+		log.Println("Entering 'work' mode")
+		work()
+	case "check-access":
+		log.Println("Entering 'check-access' mode")
+		checkAccess(csp, parseOrganization(findConfig("org-file")))
 	case "setup":
 		log.Println("Running Cloudsweeper setup")
 		setup.PerformSetup(findConfig("aws-master-arn"))
 	default:
-		log.Fatalln("Please supply a command")
+		fatalln("Please supply a command")
+	}
+	saveDeliveryLog()
+	saveDigest()
+}
+
+// skipDuringFreeze returns true if there is a change freeze, during
+// which owners aren't emailed about their resources, and notes that the
+// specified emails weren't sent
+func skipDuringFreeze(what string) bool {
+	window, frozen := cleanup.ActiveFreeze(time.Now())
+	if frozen {
+		status.Notef("Change freeze '%s' until %s, not sending %s", window.Spec, cleanup.FreezeEnd(time.Now()).Format("2006-01-02"), what)
+	}
+	return frozen
+}
+
+// awsBucketRegion returns the configured region of a bucket, or else the
+// region the bucket is found in
+func awsBucketRegion(bucket, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	region, err := cloud.AWSBucketRegion(bucket)
+	if err != nil {
+		fatalf("Could not find the region of bucket %s: %s", bucket, err)
+	}
+	return region
+}
+
+func loadTagKeys() {
+	filter.WhitelistTagKey = findConfig("whitelist-tag-key")
+	filter.LifetimeTagKey = findConfig("lifetime-tag-key")
+	filter.ExpiryTagKey = findConfig("expiry-tag-key")
+	filter.DeleteTagKey = findConfig("delete-tag-key")
+	filter.DeleteReasonTagKey = findConfig("delete-reason-tag-key")
+	filter.DeletePolicyTagKey = findConfig("delete-policy-tag-key")
+	security.EncryptedCopyTagKey = findConfig("encrypted-copy-tag-key")
+	security.EncryptedFromTagKey = findConfig("encrypted-from-tag-key")
+	cleanup.ArchivedTagKey = findConfig("archived-tag-key")
+	cleanup.NeedsOwnerTagKey = findConfig("needs-owner-tag-key")
+	cleanup.ClaimedByTagKey = findConfig("claimed-by-tag-key")
+	filter.TagSigningKey = []byte(findConfig("tag-signing-key"))
+	filter.OwnerSigningKey = []byte(findConfig("owner-signing-key"))
+	cs.CostCenterTagKey = findConfig("cost-center-tag-key")
+	cs.ProjectTagKey = findConfig("project-tag-key")
+	setCleanupOptions(func(opts *cleanup.Options) {
+		opts.ExcludeBackupManaged = findConfigBool("exclude-backup-managed")
+		opts.ExcludeDLMManaged = findConfigBool("exclude-dlm-managed")
+	})
+}
+
+func loadProviderPlugins() {
+	for _, path := range listFromConfig(findConfig("provider-plugins")) {
+		if err := cloud.LoadProviderPlugin(path); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// disabledResourceTypesFromConfig returns the resource types which are
+// switched off with their enable option
+func disabledResourceTypesFromConfig() []string {
+	disabled := []string{}
+	for _, resourceType := range cloud.ResourceTypes {
+		if !findConfigBool("enable-" + resourceType) {
+			disabled = append(disabled, resourceType)
+		}
+	}
+	return disabled
+}
+
+// loadAccountNames sets the friendly names of accounts shown in logs,
+// reports and emails. Names in the organization take precedence over
+// AWS account aliases.
+func loadAccountNames(csp cloud.CSP, org *cs.Organization) {
+	names := org.AccountNames(csp)
+	if csp == cloud.AWS && findConfigBool("aws-account-aliases") {
+		unnamed := []string{}
+		for _, account := range managedAccounts(org.EnabledAccounts(csp)) {
+			if _, exist := names[account]; !exist {
+				unnamed = append(unnamed, account)
+			}
+		}
+		cloud.SetAccountNames(cloud.AWSAccountAliases(unnamed, findConfigInt("account-parallelism")))
 	}
-	log.Println("Finished running")
+	cloud.SetAccountNames(names)
 }
 
 func initManager(csp cloud.CSP, org *cs.Organization) cloud.ResourceManager {
-	manager, err := cloud.NewManager(csp, org.EnabledAccounts(csp)...)
+	loadAccountNames(csp, org)
+	manager, err := cloud.NewManagerWithConfig(csp, managerConfig(csp, org), managedAccounts(org.EnabledAccounts(csp))...)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 		return nil
 	}
 	return manager
 }
 
+// managerConfig returns the settings of resource managers from the config
+func managerConfig(csp cloud.CSP, org *cs.Organization) *cloud.ManagerConfig {
+	return &cloud.ManagerConfig{
+		AccountParallelism:         findConfigInt("account-parallelism"),
+		DisabledResourceTypes:      disabledResourceTypesFromConfig(),
+		OwnerDisabledResourceTypes: org.DisabledResourceTypes(csp),
+		AccountTimeout:             findConfigTimeout("account-timeout"),
+		RegionTimeout:              findConfigTimeout("region-timeout"),
+		AWSConfigAggregator:        findConfig("aws-config-aggregator"),
+		AWSConfigAggregatorRegion:  findConfig("aws-config-aggregator-region"),
+		AWSLastUsedDays:            findConfigInt("aws-last-used-days"),
+		AWSLastTaggedDays:          findConfigInt("aws-last-tagged-days"),
+		AWSBucketReadDays:          findConfigInt("aws-bucket-read-days"),
+		AWSRegionParallelism:       findConfigInt("aws-region-parallelism"),
+		AWSReleaseElasticIPs:       *releaseElasticIPs,
+		GCPImpersonationChain:      listFromConfig(findConfig("gcp-impersonate")),
+		GCPQuotaProject:            findConfig("gcp-quota-project"),
+		KubernetesClusters:         kubernetesClustersFromConfig(findConfig("kubernetes-clusters-file")),
+		KubernetesIdleDays:         findConfigInt("kubernetes-idle-days"),
+		KubernetesOwnerLabel:       findConfig("kubernetes-owner-label"),
+		VSphereServers:             vsphereServersFromConfig(findConfig("vsphere-servers-file")),
+	}
+}
+
+// initBillingReporter returns the reporter reading the billing CSVs of
+// the CSP
+func initBillingReporter(csp cloud.CSP) billing.Reporter {
+	switch csp {
+	case cloud.AWS:
+		billingAccount := findConfig("billing-account")
+		bucket := findConfig("billing-bucket")
+		region := awsBucketRegion(bucket, findConfig("billing-bucket-region"))
+		sortTag := findConfig("billing-sort-tag")
+		return billing.NewReporterAWS(billingAccount, bucket, region, sortTag)
+	case cloud.GCP:
+		bucket := findConfig("billing-bucket")
+		prefix := findConfig("billing-csv-prefix")
+		return billing.NewReporterGCP(bucket, prefix)
+	}
+	fatalf("Invalid CSP specified")
+	return nil
+}
+
+// billingReportOptions returns how costs are counted in billing reports
+func billingReportOptions() billing.ReportOptions {
+	return billing.ReportOptions{
+		ExcludeCredits:       !findConfigBool("billing-include-credits"),
+		AmortizeCommitments:  findConfigBool("billing-amortize-commitments"),
+		CommitmentTermMonths: findConfigInt("billing-commitment-term-months"),
+	}
+}
+
 func initNotifyClient() *notify.Client {
 	config := &notify.Config{
 		SMTPUsername:           findConfig("smtp-username"),
@@ -228,26 +1062,66 @@ func initNotifyClient() *notify.Client {
 		EmailDomain:            findConfig("mail-domain"),
 		BillingReportAddressee: findConfig("billing-report-addressee"),
 		TotalSumAddresse:       findConfig("total-sum-addressee"),
+		ReplyCommands:          findConfig("replies-bucket") != "",
+		Deliveries:             loadDeliveryLog(),
+		BounceLimit:            findConfigInt("bounce-escalation-count"),
+		TimeZone:               findConfig("mail-time-zone"),
+		Unsubscribes:           loadUnsubscribes(),
+		UnsubscribeURL:         findConfig("unsubscribe-url"),
+		UnsubscribeKey:         unsubscribeKey(),
+	}
+	config.CostThreshold, config.OwnerCostThresholds = notifyCostThresholds()
+	if findConfigBool("review-rightsizing") {
+		config.RightSizing = &cleanup.RightSizingThresholds{
+			Days:          findConfigInt("rightsizing-days"),
+			CPUPercent:    findConfigInt("rightsizing-cpu-percent"),
+			MemoryPercent: findConfigInt("rightsizing-memory-percent"),
+		}
 	}
+	if config.CostThreshold > 0 || len(config.OwnerCostThresholds) > 0 || digestLoaded() {
+		config.Digest = loadDigest()
+	}
+	org := parseOrganization(findConfig("org-file"))
+	config.Emails = org.EmailMapping()
+	config.Managers = org.ManagerMapping()
+	config.TimeZones = org.TimeZoneMapping()
+	config.Attributions = org.AccountAttributions(cspFromConfig(findConfig("csp")))
+	cloud.AWSConsoleSSOStartURL = findConfig("aws-console-sso-start-url")
+	cloud.AWSConsoleSSORole = findConfig("aws-console-sso-role")
 	return notify.Init(config)
 }
 
 func parseOrganization(inputFile string) *cs.Organization {
-	raw, err := ioutil.ReadFile(inputFile)
+	raw, err := readInputFile(inputFile)
 	if err != nil {
-		log.Fatalf("Could not read organization file: %s\n", err)
+		fatalf("Could not read organization file: %s\n", err)
 	}
 	org, err := cs.InitOrganization(raw)
 	if err != nil {
-		log.Fatalf("Failed to initalize organization: %s\n", err)
+		fatalf("Failed to initalize organization: %s\n", err)
 	}
 	return org
 }
 
-func getPositionalCmd() string {
-	n := len(os.Args)
-	if n <= 1 {
-		return ""
+// parsePolicy reads the policy file, if one is configured. Without a
+// policy file every category uses the default actions.
+func parsePolicy(inputFile string) *policy.Policy {
+	if inputFile == "" {
+		return nil
 	}
-	return os.Args[n-1]
+	raw, err := readInputFile(inputFile)
+	if err != nil {
+		fatalf("Could not read policy file: %s\n", err)
+	}
+	pol, err := policy.InitPolicy(raw)
+	if err != nil {
+		fatalf("Failed to initalize policy: %s\n", err)
+	}
+	return pol
+}
+
+// getPositionalCmd returns the command, which may be more than one word,
+// such as "policy test"
+func getPositionalCmd() string {
+	return strings.Join(flag.Args(), " ")
 }
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/selfservice"
+)
+
+// initOwnManager builds a resource manager for the account of the user
+// running Cloudsweeper, using the user's own credentials instead of the
+// organization wide ones
+func initOwnManager(csp cloud.CSP) cloud.ResourceManager {
+	account := findConfig("me-account")
+	if account == "" && csp == cloud.AWS {
+		var err error
+		account, err = cloud.AWSCallerAccount()
+		if err != nil {
+			fatalf("Could not find the account of your AWS credentials: %s", err)
+		}
+	}
+	if account == "" {
+		fatalln("Must specify your account using --me-account=<account>")
+	}
+	log.Printf("Using your own credentials for %s", cloud.AccountDisplayName(account))
+	conf := &cloud.ManagerConfig{
+		AWSOwnCredentials: true,
+		AWSLastUsedDays:   findConfigInt("aws-last-used-days"),
+		AWSLastTaggedDays: findConfigInt("aws-last-tagged-days"),
+		AWSBucketReadDays: findConfigInt("aws-bucket-read-days"),
+		GCPQuotaProject:   findConfig("gcp-quota-project"),
+	}
+	manager, err := cloud.NewManagerWithConfig(csp, conf, account)
+	if err != nil {
+		fatal(err)
+	}
+	return manager
+}
+
+// runMe runs the self-service commands: "me" lists the resources in the
+// user's account, "me protect" whitelists a resource and "me extend"
+// postpones its deletion
+func runMe(command string, csp cloud.CSP) {
+	mngr := initOwnManager(csp)
+	switch command {
+	case "me":
+		fmt.Print(selfservice.FormatResources(selfservice.ListResources(mngr)))
+	case "me protect":
+		res, err := selfservice.Protect(mngr, resourceIDFromFlag())
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("%s is now protected from cleanup", res.ID())
+	case "me extend":
+		id := resourceIDFromFlag()
+		deleteAt, err := selfservice.Extend(mngr, id, findConfigInt("extend-days"))
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("%s will now be deleted at %s", id, deleteAt.Format(time.RFC3339))
+	}
+}
+
+// printOwnerSigningKey prints the key with which the owner of the account
+// in --me-account can sign the delete tags of their own resources,
+// without knowing the tag signing key of the organization
+func printOwnerSigningKey() {
+	account := findConfig("me-account")
+	if account == "" {
+		fatalln("Must specify the account using --me-account=<account>")
+	}
+	if len(filter.TagSigningKey) == 0 {
+		fatalln("No tag signing key configured, set CS_TAG_SIGNING_KEY to derive owner signing keys")
+	}
+	fmt.Println(filter.OwnerSigningKeyFor(account))
+}
+
+func resourceIDFromFlag() string {
+	if *findResourceID == "" {
+		fatalln("Must specify a resource ID using --resource-id=<ID>")
+	}
+	return *findResourceID
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// metricsSchemaVersion is the version of the format of the lines of the
+// metrics file. Version 1 is the same format without the version.
+const metricsSchemaVersion = 2
+
+// runMetrics is the line appended to the metrics file after every command
+type runMetrics struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	Command       string                `json:"command"`
+	Time          time.Time             `json:"time"`
+	APICalls      []cloud.APICallCount  `json:"api_calls"`
+	Resources     []cloud.ResourceCount `json:"resources"`
+}
+
+// reportMetrics logs the API calls made and the resources listed by the
+// command, and appends them to the metrics file if there is one, so that
+// the call volume can be compared between runs
+func reportMetrics(command string) {
+	metrics := runMetrics{
+		SchemaVersion: metricsSchemaVersion,
+		Command:       command,
+		Time:          time.Now(),
+		APICalls:      cloud.APICalls(),
+		Resources:     cloud.ResourceCounts(),
+	}
+	total := 0
+	for _, count := range metrics.APICalls {
+		total += count.Calls
+	}
+	log.Printf("Made %d API calls", total)
+	for _, count := range metrics.APICalls {
+		log.Printf("  %s %s %s: %d calls", count.CSP, count.Service, count.Operation, count.Calls)
+	}
+	for _, count := range metrics.Resources {
+		log.Printf("Listed %d %s in %s", count.Count, count.Type, count.CSP)
+	}
+
+	path := findConfig("metrics-file")
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		status.Warnf("Could not encode metrics: %s", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		status.Warnf("Could not open metrics file: %s", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		status.Warnf("Could not write metrics file: %s", err)
+	}
+}
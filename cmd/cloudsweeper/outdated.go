@@ -0,0 +1,58 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/filter"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+)
+
+// listOutdatedMarks prints the resources of every account marked under
+// another version of the policy, or other thresholds, than the current
+// ones, with the version they were marked under and when they're deleted
+func listOutdatedMarks(mngr cloud.ResourceManager, pol *policy.Policy) {
+	active := cleanup.NewPolicyVersion(pol, thresholds)
+	outdated := cleanup.FindOutdatedMarks(mngr, active)
+	fmt.Printf("Current policy: %s\n", active)
+	if len(outdated) == 0 {
+		fmt.Println("No resources are marked under an outdated policy")
+		return
+	}
+	accounts := []string{}
+	for account := range outdated {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	total := 0
+	for _, account := range accounts {
+		fmt.Printf("\n%s\n", cloud.AccountDisplayName(account))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tLOCATION\tMARKED UNDER\tREASON\tDELETE AT")
+		for _, mark := range outdated[account] {
+			res := mark.Resource
+			reason := cleanup.DeleteReason(res)
+			if reason == "" {
+				reason = "-"
+			}
+			deleteAt := "-"
+			if value, exist := filter.VerifiedTagValue(res, filter.DeleteTagKey); exist {
+				if t, err := cloud.ParseTagTime(value); err == nil {
+					deleteAt = t.Format(time.RFC3339)
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", res.ID(), res.Location(), mark.MarkedUnder, reason, deleteAt)
+		}
+		w.Flush()
+		total += len(outdated[account])
+	}
+	fmt.Printf("\n%d resources in %d accounts are marked under an outdated policy. Cleanup handles them as set by outdated-marks, currently '%s'.\n", total, len(accounts), findConfig("outdated-marks"))
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policytest"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// policyTest runs the policy file and thresholds against the fixtures in
+// the policy test file, and logs every failed expectation. It returns the
+// exit code of the tests.
+func policyTest() int {
+	path := findConfig("policy-test-file")
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Could not read policy test file: %s\n", err)
+		return status.ExitConfigError
+	}
+	fixtures, err := policytest.LoadFixtures(raw)
+	if err != nil {
+		log.Printf("Invalid policy test file %s: %s\n", path, err)
+		return status.ExitConfigError
+	}
+	results, err := fixtures.Run(parsePolicy(findConfig("policy-file")), thresholds)
+	if err != nil {
+		log.Println(err)
+		return status.ExitConfigError
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			log.Printf("PASS: %s", result.Name)
+			continue
+		}
+		failed++
+		log.Printf("FAIL: %s", result.Name)
+		for _, failure := range result.Failures {
+			log.Printf("    %s", failure)
+		}
+	}
+	log.Printf("%d of %d policy tests passed", len(results)-failed, len(results))
+	if failed > 0 {
+		return status.ExitConfigError
+	}
+	return status.ExitSuccess
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/remarks"
+)
+
+// loadRemarks reads the history of marked resources from the remark file,
+// so that the resources marked again are counted while marking
+func loadRemarks() {
+	path := findConfig("remark-file")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No remark history in %s, starting a new one", path)
+		setCleanupOptions(func(opts *cleanup.Options) { opts.Remarks = &remarks.History{} })
+		return
+	} else if err != nil {
+		fatalf("Could not read remark file: %s\n", err)
+	}
+	defer f.Close()
+	history, err := remarks.ReadHistory(f)
+	if err != nil {
+		fatalf("Could not parse remark file %s: %s\n", path, err)
+	}
+	setCleanupOptions(func(opts *cleanup.Options) { opts.Remarks = history })
+}
+
+// saveRemarks writes the history to a temporary file first, so that the
+// history isn't lost if writing fails halfway
+func saveRemarks() {
+	path := findConfig("remark-file")
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		fatalf("Could not create remark file: %s\n", err)
+	}
+	if err := cleanup.CurrentOptions().Remarks.Write(f); err != nil {
+		f.Close()
+		fatalf("Could not write remark file: %s\n", err)
+	}
+	if err := f.Close(); err != nil {
+		fatalf("Could not write remark file: %s\n", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		fatalf("Could not replace remark file: %s\n", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/remote"
+)
+
+// serveRemote serves the gRPC API on the configured address, sharing
+// the run lock with the commands run on schedule
+func serveRemote(address string) {
+	srv := &remote.Server{
+		NewManager: remoteManager,
+		Thresholds: func() map[string]int { return thresholds },
+		Policy:     func() *policy.Policy { return parsePolicy(findConfig("policy-file")) },
+		Prepare: func() {
+			loadCostThresholds()
+			loadDisputed()
+			setCleanupOptions(func(opts *cleanup.Options) {
+				opts.EarlyDeletionFeeLimit = float64(findConfigInt("early-deletion-fee-limit"))
+				opts.ConfirmEarlyDeletionFees = *confirmEarlyDeletionFees
+			})
+		},
+		Lock:   &runMutex,
+		FailOn: findConfig("fail-on"),
+		TLS:    remoteTLSConfig(),
+		Token:  findConfig("grpc-token"),
+	}
+	if err := remote.ListenAndServe(address, srv); err != nil {
+		log.Fatalf("Could not serve gRPC on %s: %s", address, err)
+	}
+}
+
+// remoteTLSConfig returns the TLS config the gRPC API is served with, or
+// nil if it's served in clear text. With a client CA, clients must have
+// a certificate signed by it.
+func remoteTLSConfig() *tls.Config {
+	certFile := findConfig("grpc-tls-cert")
+	if certFile == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, findConfig("grpc-tls-key"))
+	if err != nil {
+		fatalf("Could not load the gRPC certificate: %s", err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if caFile := findConfig("grpc-client-ca"); caFile != "" {
+		raw, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			fatalf("Could not read the gRPC client CA: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			fatalf("No certificates found in the gRPC client CA %s", caFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf
+}
+
+// remoteManager returns the resource manager of a remote request, which
+// stops listing resources once the request is canceled
+func remoteManager(ctx context.Context, cspName string, accounts []string) (mngr cloud.ResourceManager, err error) {
+	defer recoverAborted(&err)
+	if cspName == "" {
+		cspName = findConfig("csp")
+	}
+	csp, valid := parseCSP(cspName)
+	if !valid {
+		return nil, fmt.Errorf("Invalid CSP '%s'", cspName)
+	}
+	org := parseOrganization(findConfig("org-file"))
+	enabled := org.EnabledAccounts(csp)
+	if len(accounts) == 0 {
+		accounts = enabled
+	}
+	for _, account := range accounts {
+		if !contains(enabled, account) {
+			return nil, fmt.Errorf("Account '%s' is not an enabled %s account of the organization", account, csp)
+		}
+	}
+	loadAccountNames(csp, org)
+	conf := managerConfig(csp, org)
+	conf.Context = ctx
+	return cloud.NewManagerWithConfig(csp, conf, accounts...)
+}
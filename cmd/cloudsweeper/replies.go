@@ -0,0 +1,90 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"log"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/notify"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/replies"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// processReplies applies the commands in the replies to notification
+// emails, sends the results back to every sender, and removes the
+// processed replies. Disputed resources are added to the dispute file. In
+// a dry run nothing is tagged, no emails are sent and the replies are
+// kept.
+func processReplies(csp cloud.CSP, org *cs.Organization) {
+	bucket := findConfig("replies-bucket")
+	if bucket == "" {
+		fatalln("No mailbox configured, set CS_REPLIES_BUCKET to process replies")
+	}
+	mailbox := replies.NewS3Mailbox(bucket, findConfig("replies-prefix"), awsBucketRegion(bucket, findConfig("replies-bucket-region")))
+	keys, err := mailbox.Keys()
+	if err != nil {
+		fatalf("Could not list the replies in %s: %s", bucket, err)
+	}
+	if len(keys) == 0 {
+		log.Println("No replies to process")
+		return
+	}
+	log.Printf("Processing %d replies", len(keys))
+	mngr := initManager(csp, org)
+	disputePath := findConfig("dispute-file")
+	queue := readDisputes(disputePath)
+	processor := replies.NewProcessor(mngr, org, csp, findConfig("mail-domain"), findConfigInt("extend-days"), findConfigInt("max-extend-days"), queue, *dryRun)
+	client := initNotifyClient()
+	for _, key := range keys {
+		if !processReply(mailbox, key, processor, client) {
+			continue
+		}
+		if *dryRun {
+			continue
+		}
+		if err := mailbox.Remove(key); err != nil {
+			status.ActionFailedf("Could not remove the processed reply %s: %s", key, err)
+		}
+	}
+	if !*dryRun {
+		writeDisputes(disputePath, queue)
+	}
+}
+
+// processReply processes a single reply, and returns whether it's done
+// with. Replies which can't be read are kept, to be tried again.
+func processReply(mailbox replies.Mailbox, key string, processor *replies.Processor, client *notify.Client) bool {
+	raw, err := mailbox.Read(key)
+	if err != nil {
+		status.ActionFailedf("Could not read the reply %s: %s", key, err)
+		return false
+	}
+	defer raw.Close()
+	msg, err := replies.ParseMessage(raw, findConfig("replies-authserv-id"))
+	if err != nil {
+		status.Warnf("Ignoring the reply %s: %s", key, err)
+		return true
+	}
+	sender, err := processor.Sender(msg)
+	if err != nil {
+		status.Warnf("Ignoring the reply %s: %s", key, err)
+		return true
+	}
+	if len(msg.Commands) == 0 {
+		log.Printf("No commands in the reply from %s", sender.Username)
+		return true
+	}
+	results := processor.Process(sender, msg)
+	for _, result := range results {
+		log.Printf("%s: %s: %s", sender.Username, result.Command, result.Message)
+	}
+	if *dryRun {
+		log.Printf("Not emailing the results to %s since this is a dry run", msg.From)
+		return true
+	}
+	client.ReplyResults(sender, msg.From, results)
+	return true
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/secrets"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+var (
+	// inputFiles holds the last good contents of the organization file,
+	// policy file and do-not-delete list when running in serve mode, so
+	// that a bad reload doesn't affect the following runs
+	inputFiles      map[string][]byte
+	inputFilesMutex sync.Mutex
+
+	// runMutex is held during every run and reload in serve mode, since
+	// runs started over gRPC share the config and state of the scheduled
+	// ones
+	runMutex sync.Mutex
+)
+
+// readInputFile reads a file the config points to. In serve mode, the
+// contents from the last successful reload are returned instead.
+func readInputFile(path string) ([]byte, error) {
+	inputFilesMutex.Lock()
+	defer inputFilesMutex.Unlock()
+	if raw, exist := inputFiles[path]; exist {
+		return raw, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// servableCommands are the commands which can be run by serve
+var servableCommands = []string{
+	"cleanup", "reset", "mark-for-cleanup", "outdated-marks", "review", "warn", "billing-report",
+	"find-untagged", "security-review", "encryption-review", "archive-review",
+	"multipart-review", "image-copy-review", "file-system-review", "vpn-review", "transit-gateway-review", "cluster-review", "gpu-review", "ml-review", "monitoring-review",
+	"network-review", "lifecycle-review", "bucket-growth-review", "spot-review", "directory-sync", "departed-owners-review", "process-replies",
+	"process-bounces",
+}
+
+// serveCommandProblems returns a problem for every command which serve
+// can't run
+func serveCommandProblems(commands []string) []string {
+	problems := []string{}
+	for _, command := range commands {
+		if !contains(servableCommands, command) {
+			problems = append(problems, fmt.Sprintf("Command '%s' in serve-commands can't be run by serve", command))
+		}
+	}
+	return problems
+}
+
+// inputFilePaths returns the files, apart from the config file, which are
+// read during runs
+func inputFilePaths() []string {
+	files := []string{doNotDeleteFileName, configValue("org-file")}
+	if policyPath := configValue("policy-file"); policyPath != "" {
+		files = append(files, policyPath)
+	}
+	return files
+}
+
+// watchedFiles returns the files which trigger a reload when changed
+func watchedFiles() []string {
+	return append([]string{configFileName}, inputFilePaths()...)
+}
+
+// cacheInputFiles stores the current contents of the files read during
+// runs, so they are used until the next successful reload
+func cacheInputFiles() {
+	cache := make(map[string][]byte)
+	for _, path := range inputFilePaths() {
+		if raw, err := ioutil.ReadFile(path); err == nil {
+			cache[path] = raw
+		}
+	}
+	inputFilesMutex.Lock()
+	defer inputFilesMutex.Unlock()
+	inputFiles = cache
+}
+
+func modificationTimes() map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, path := range watchedFiles() {
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		}
+	}
+	return times
+}
+
+func changedSince(before, after map[string]time.Time) bool {
+	if len(before) != len(after) {
+		return true
+	}
+	for path, t := range after {
+		if !before[path].Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload reads the config file again, and validates it together with
+// the organization file, policy file and do-not-delete list. If there
+// are any problems, such as commands serve can't run, the previous config
+// is kept and false is returned.
+func reload(reason string) bool {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+	log.Printf("Reloading config (%s)", reason)
+	newConfig, err := readConfigFile(configFileName)
+	if err != nil {
+		log.Printf("Could not load config file '%s', keeping the previous config: %s", configFileName, err)
+		return false
+	}
+	previousConfig := config
+	config = newConfig
+	secrets.ClearCache()
+	problems := append(validationProblems(), serveCommandProblems(listFromConfig(findConfig("serve-commands")))...)
+	if len(problems) > 0 {
+		config = previousConfig
+		for _, problem := range problems {
+			log.Println(problem)
+		}
+		log.Printf("Found %d problems, keeping the previous config", len(problems))
+		return false
+	}
+	loadThresholds()
+	loadTagKeys()
+	loadFreezeWindows()
+	cacheInputFiles()
+	log.Println("Config reloaded")
+	return true
+}
+
+// serve will keep running the configured commands at the configured
+// interval. The config file, organization file, policy file and the
+// do-not-delete list are reloaded on SIGHUP, or when any of them change.
+// Provider plugins are not reloaded, as plugins can't be unloaded. If
+// --grpc-address is set, the gRPC API is served as well, and if
+// --event-queue-url is set, created resources are checked for tags. On
+// SIGTERM or SIGINT, the deletes in flight are finished before exiting.
+func serve() {
+	commands := listFromConfig(findConfig("serve-commands"))
+	interval := findConfigDuration("serve-interval")
+	watchInterval := findConfigDuration("serve-watch-interval")
+	for _, problem := range serveCommandProblems(commands) {
+		log.Fatal(problem)
+	}
+	cacheInputFiles()
+	log.Printf("Serving, running %v every %s", commands, interval)
+	go shutdownOnSignal()
+	if address := findConfig("health-address"); address != "" {
+		go serveHealth(address)
+	} else if findConfig("unsubscribe-url") != "" {
+		log.Println("Not serving the unsubscribe links of --unsubscribe-url, since --health-address isn't set")
+	}
+	if address := findConfig("grpc-address"); address != "" {
+		go serveRemote(address)
+	}
+	if findConfig("event-queue-url") != "" {
+		go watchEvents()
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	runTicker := time.NewTicker(interval)
+	defer func() { runTicker.Stop() }()
+	watchTicker := time.NewTicker(watchInterval)
+	defer watchTicker.Stop()
+
+	// Scheduled runs which fail are logged, rather than ending serve
+	status.ExitOnFatal = false
+	abortRunsOnFatal = true
+	lastModified := modificationTimes()
+	reloaded := func() {
+		// The files of the new config are watched from now on
+		lastModified = modificationTimes()
+		commands = listFromConfig(findConfig("serve-commands"))
+		if newInterval := findConfigDuration("serve-interval"); newInterval != interval {
+			interval = newInterval
+			runTicker.Stop()
+			runTicker = time.NewTicker(interval)
+			log.Printf("Running commands every %s", interval)
+		}
+	}
+	atomic.StoreInt32(&serveReady, 1)
+	runScheduled(commands)
+	for {
+		select {
+		case <-hangup:
+			lastModified = modificationTimes()
+			if reload("SIGHUP") {
+				reloaded()
+			}
+		case <-watchTicker.C:
+			if modified := modificationTimes(); changedSince(lastModified, modified) {
+				// A failed reload is retried once the files change again
+				lastModified = modified
+				if reload("files changed") {
+					reloaded()
+				}
+			}
+		case <-runTicker.C:
+			// Only the commands of a config which passed validation
+			runScheduled(commands)
+		}
+	}
+}
+
+// runScheduled runs the commands one after the other. A command which
+// fails with a fatal error or panics is logged and recorded as a
+// discovery failure, and the following commands are still run.
+func runScheduled(commands []string) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+	for _, command := range commands {
+		if cleanup.Stopped() {
+			log.Printf("Shutting down, not running '%s'", command)
+			break
+		}
+		log.Printf("Running scheduled command '%s'", command)
+		status.Reset()
+		cloud.ResetMetrics()
+		if err := runAbortable(command); err != nil {
+			status.Record(status.DiscoveryFailure)
+			log.Printf("Aborted '%s': %s", command, err)
+		}
+		reportMetrics(command)
+		log.Printf("Finished '%s' (%s)", command, status.Summary())
+	}
+}
+
+// shutdownOnSignal waits for SIGTERM or SIGINT, and then stops starting
+// new deletes, waits for the run in progress to finish the deletes in
+// flight, and exits
+func shutdownOnSignal() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-stop
+	log.Printf("Received %s, finishing the deletes in flight before shutting down", sig)
+	atomic.StoreInt32(&serveStopping, 1)
+	cleanup.Stop()
+	runMutex.Lock()
+	log.Println("Shut down")
+	os.Exit(status.ExitSuccess)
+}
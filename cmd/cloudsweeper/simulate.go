@@ -0,0 +1,122 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/diff"
+)
+
+// exportInventory discovers all resources and writes them to the
+// inventory file, to be used by simulate later
+func exportInventory(mngr cloud.ResourceManager, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		fatalf("Could not create inventory file: %s\n", err)
+	}
+	defer f.Close()
+	if err := cloud.WriteInventory(f, mngr, billing.InstancePricePerHour); err != nil {
+		fatalf("Could not write inventory file: %s\n", err)
+	}
+	log.Printf("Wrote inventory to %s", path)
+}
+
+// simulate evaluates the thresholds and policy against a recorded
+// inventory, and prints what marking would have done at the time the
+// inventory was recorded. Nothing is tagged and no emails are sent.
+func simulate(path string) {
+	inv := readInventoryFile(path)
+	log.Printf("Simulating marking against the inventory recorded %s", inv.Recorded.Format(time.RFC3339))
+	pol := parsePolicy(findConfig("policy-file"))
+	marked, notifyOnly, err := cleanup.MarkForCleanup(inv.Manager(), thresholds, pol, true)
+	if err != nil {
+		fatalf("Could not simulate marking: %s", err)
+	}
+	fmt.Print(formatSimulation("Would be marked for cleanup", marked))
+	fmt.Print(formatSimulation("Would only notify the owner about", notifyOnly))
+}
+
+// diffInventories prints the changes between two recorded inventories
+func diffInventories(previousPath, currentPath string) {
+	previous := readInventoryFile(previousPath)
+	current := readInventoryFile(currentPath)
+	pol := parsePolicy(findConfig("policy-file"))
+	changes, err := diff.Compare(previous, current, thresholds, pol)
+	if err != nil {
+		fatalf("Could not compare the inventories: %s", err)
+	}
+	fmt.Print(changes.Format())
+}
+
+func readInventoryFile(path string) *cloud.Inventory {
+	f, err := os.Open(path)
+	if err != nil {
+		fatalf("Could not read inventory file: %s\n", err)
+	}
+	defer f.Close()
+	inv, err := cloud.ReadInventory(f)
+	if err != nil {
+		fatalf("Could not parse inventory file %s: %s\n", path, err)
+	}
+	loadInventoryAccountNames(inv)
+	return inv
+}
+
+// loadInventoryAccountNames sets the names recorded in an inventory for
+// the accounts which have no name yet, so the names in the organization
+// take precedence
+func loadInventoryAccountNames(inv *cloud.Inventory) {
+	names := make(map[string]string)
+	for account, name := range inv.AccountNames() {
+		if cloud.AccountName(account) == "" {
+			names[account] = name
+		}
+	}
+	cloud.SetAccountNames(names)
+}
+
+func formatSimulation(title string, found map[string]*cloud.AllResourceCollection) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s:\n", title)
+	owners := []string{}
+	for owner, res := range found {
+		if len(res.Instances)+len(res.Images)+len(res.Volumes)+len(res.Snapshots)+len(res.Buckets) > 0 {
+			owners = append(owners, owner)
+		}
+	}
+	if len(owners) == 0 {
+		b.WriteString("  Nothing\n")
+		return b.String()
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		res := found[owner]
+		fmt.Fprintf(&b, "  %s\n", cloud.AccountDisplayName(owner))
+		for _, inst := range res.Instances {
+			fmt.Fprintf(&b, "    instance %s (%s)\n", inst.ID(), inst.Location())
+		}
+		for _, img := range res.Images {
+			fmt.Fprintf(&b, "    image %s (%s)\n", img.ID(), img.Location())
+		}
+		for _, vol := range res.Volumes {
+			fmt.Fprintf(&b, "    volume %s (%s)\n", vol.ID(), vol.Location())
+		}
+		for _, snap := range res.Snapshots {
+			fmt.Fprintf(&b, "    snapshot %s (%s)\n", snap.ID(), snap.Location())
+		}
+		for _, buck := range res.Buckets {
+			fmt.Fprintf(&b, "    bucket %s (%s)\n", buck.ID(), buck.Location())
+		}
+	}
+	return b.String()
+}
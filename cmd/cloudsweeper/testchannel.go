@@ -0,0 +1,50 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/agaridata/cloudsweeper/mailer"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+const testChannelMail = `<p>This is a test email sent by <code>cloudsweeper --test-channel notify</code>.</p>
+<p>If you received it, Cloudsweeper is able to send notifications.</p>`
+
+// testChannel checks the SMTP settings step by step, and then sends a
+// test email to the total sum addressee, or to the from address if there
+// is none. Every step is logged, so a misconfigured server is found
+// before a run instead of failing when the first email is sent.
+func testChannel() int {
+	username := findConfig("smtp-username")
+	password := findConfig("smtp-password")
+	server := findConfig("smtp-server")
+	port := findConfigInt("smtp-port")
+	if server == "" {
+		log.Println("FAIL: No SMTP server configured, please supply --smtp-server")
+		return status.ExitConfigError
+	}
+
+	for _, diagnostic := range mailer.Diagnose(username, password, server, port) {
+		if diagnostic.Err != nil {
+			log.Printf("FAIL: %s: %s", diagnostic.Step, diagnostic.Err)
+			return status.ExitConfigError
+		}
+		log.Printf("OK: %s", diagnostic.Step)
+	}
+
+	recipient := findConfig("mail-from")
+	if addressee := findConfig("total-sum-addressee"); addressee != "" {
+		recipient = fmt.Sprintf("%s@%s", addressee, findConfig("mail-domain"))
+	}
+	client := mailer.NewClient(username, password, findConfig("display-name"), findConfig("mail-from"), server, port)
+	if err := client.SendEmail("Cloudsweeper test email", testChannelMail, recipient); err != nil {
+		log.Printf("FAIL: Send test email to %s: %s", recipient, err)
+		return status.ExitConfigError
+	}
+	log.Printf("OK: Send test email to %s", recipient)
+	return status.ExitSuccess
+}
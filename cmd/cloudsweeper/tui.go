@@ -0,0 +1,36 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"os"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/audit"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/tui"
+)
+
+// runTUI discovers the resources of every account once, flags them the
+// way marking would, and browses them interactively on the terminal
+func runTUI(mngr cloud.ResourceManager, pol *policy.Policy, dryRun bool) {
+	accounts := collectResources(mngr)
+	// Marking is run as a dry run on the discovered resources, to find
+	// which resources would be flagged and why
+	collected := cloud.NewCollectedManager(accounts)
+	marked, notifyOnly, err := cleanup.MarkForCleanup(collected, thresholds, pol, true)
+	if err != nil {
+		fatalf("Could not flag resources: %s", err)
+	}
+	session := tui.NewSession(tui.NewItems(accounts, marked, notifyOnly), os.Stdin, os.Stdout, tui.Options{
+		MarkDays: findConfigInt("tui-mark-days"),
+		DryRun:   dryRun,
+		Trail:    audit.NewTrail(findConfig("audit-file")),
+		Actor:    audit.CurrentActor(),
+	})
+	if err := session.Run(); err != nil {
+		fatalf("Could not read commands: %s", err)
+	}
+}
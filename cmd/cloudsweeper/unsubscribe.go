@@ -0,0 +1,160 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloudsweeper/unsubscribe"
+)
+
+// unsubscribeMutex is held while the unsubscribe file is updated, since
+// links are handled concurrently
+var unsubscribeMutex sync.Mutex
+
+// readUnsubscribes reads the unsubscribe file, which is empty until the
+// first owner unsubscribes
+func readUnsubscribes() (*unsubscribe.List, error) {
+	f, err := os.Open(findConfig("unsubscribe-file"))
+	if os.IsNotExist(err) {
+		return &unsubscribe.List{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return unsubscribe.ReadList(f)
+}
+
+func loadUnsubscribes() *unsubscribe.List {
+	list, err := readUnsubscribes()
+	if err != nil {
+		fatalf("Could not read unsubscribe file: %s\n", err)
+	}
+	return list
+}
+
+// writeUnsubscribes writes the list to a temporary file first, so that
+// runs reading it never see it half written
+func writeUnsubscribes(list *unsubscribe.List) error {
+	path := findConfig("unsubscribe-file")
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := list.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// updateUnsubscribes reads the unsubscribe file, changes it and writes it
+// back, so changes made elsewhere in the meantime are kept
+func updateUnsubscribes(change func(list *unsubscribe.List)) error {
+	unsubscribeMutex.Lock()
+	defer unsubscribeMutex.Unlock()
+	list, err := readUnsubscribes()
+	if err != nil {
+		return err
+	}
+	change(list)
+	return writeUnsubscribes(list)
+}
+
+// unsubscribeKey returns the key unsubscribe links are signed with
+func unsubscribeKey() []byte {
+	return []byte(findConfig("unsubscribe-key"))
+}
+
+// unsubscribePath returns the path of --unsubscribe-url, which the
+// unsubscribe links are served on, and false if they aren't served
+func unsubscribePath() (string, bool) {
+	link := findConfig("unsubscribe-url")
+	if link == "" {
+		return "", false
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Path == "" {
+		return "", false
+	}
+	return parsed.Path, true
+}
+
+// unsubscribeHandler returns the handler of the unsubscribe links, which
+// serve mode serves on the path of --unsubscribe-url. It checks the links
+// with the current key, so build it per request.
+func unsubscribeHandler() http.Handler {
+	return unsubscribe.Handler(unsubscribeKey(), func(username, report string) error {
+		return updateUnsubscribes(func(list *unsubscribe.List) {
+			list.Unsubscribe(username, report, time.Now())
+		})
+	})
+}
+
+// manageSubscription unsubscribes or resubscribes an owner on their
+// behalf, e.g. when asked to by email
+func manageSubscription(command string, args []string) {
+	if len(args) != 2 {
+		fatalf("Please supply the username and the email, e.g. '%s jdoe review'", command)
+	}
+	username, report := args[0], args[1]
+	if _, known := unsubscribe.Reports[report]; !known {
+		fatalf("Unknown email '%s', must be one of %v", report, sortedReports())
+	}
+	var changed bool
+	err := updateUnsubscribes(func(list *unsubscribe.List) {
+		if command == "resubscribe" {
+			changed = list.Resubscribe(username, report)
+			return
+		}
+		changed = !list.IsUnsubscribed(username, report)
+		list.Unsubscribe(username, report, time.Now())
+	})
+	if err != nil {
+		fatalf("Could not update unsubscribe file: %s", err)
+	}
+	description := unsubscribe.Reports[report]
+	switch {
+	case command == "resubscribe" && !changed:
+		log.Printf("%s was not unsubscribed from %s", username, description)
+	case command == "resubscribe":
+		log.Printf("%s is subscribed to %s again", username, description)
+	case !changed:
+		log.Printf("%s is already unsubscribed from %s", username, description)
+	default:
+		log.Printf("%s is unsubscribed from %s", username, description)
+	}
+}
+
+// listUnsubscribes prints who unsubscribed from which emails
+func listUnsubscribes() {
+	list := loadUnsubscribes()
+	if len(list.Unsubscribed) == 0 {
+		fmt.Println("Nobody unsubscribed from any emails")
+		return
+	}
+	for _, sub := range list.Unsubscribed {
+		fmt.Printf("%s\t%s\t%s\n", sub.Username, sub.Report, sub.Unsubscribed.Format("2006-01-02"))
+	}
+}
+
+func sortedReports() []string {
+	reports := []string{}
+	for report := range unsubscribe.Reports {
+		reports = append(reports, report)
+	}
+	sort.Strings(reports)
+	return reports
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	cs "github.com/agaridata/cloudsweeper/cloudsweeper"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/directory"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/graph"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// Config options, apart from the thresholds, which must be integers
+var intConfigOptions = []string{
+	"account-parallelism",
+	"aws-last-used-days",
+	"aws-last-tagged-days",
+	"aws-bucket-read-days",
+	"aws-region-parallelism",
+	"kubernetes-idle-days",
+	"billing-commitment-term-months",
+	"smtp-port",
+	"warning-hours",
+	"bounce-escalation-count",
+	"remark-escalation-count",
+	"archive-snapshots-older-than-days",
+	"early-deletion-fee-limit",
+	"cleanup-deletes-per-minute",
+	"mark-cost-threshold",
+	"mark-resource-cost-threshold",
+	"notify-cost-threshold",
+	"image-pipeline-keep-n",
+	"tui-mark-days",
+	"bulk-parallelism",
+	"multipart-uploads-older-than-days",
+	"image-copy-unused-days",
+	"file-system-idle-days",
+	"file-system-delete-after-days",
+	"vpn-idle-days",
+	"vpn-delete-after-days",
+	"cluster-idle-hours",
+	"cluster-terminate-after-hours",
+	"gpu-idle-hours",
+	"gpu-idle-percent",
+	"gpu-delete-after-hours",
+	"ml-idle-days",
+	"ml-delete-after-days",
+	"monitoring-unused-days",
+	"network-created-days",
+	"network-delete-after-days",
+	"bucket-growth-percent",
+	"quota-usage-percent",
+	"spot-review-running-days",
+	"spot-review-savings-plan-discount",
+	"rightsizing-days",
+	"rightsizing-cpu-percent",
+	"rightsizing-memory-percent",
+	"extend-days",
+	"max-extend-days",
+	"needs-owner-days",
+	"directory-max-disabled-percent",
+}
+
+// Config options which must be booleans
+var boolConfigOptions = []string{
+	"billing-include-credits",
+	"billing-amortize-commitments",
+	"billing-compare",
+	"aws-account-aliases",
+	"exclude-backup-managed",
+	"exclude-dlm-managed",
+	"enable-instances",
+	"enable-images",
+	"enable-volumes",
+	"enable-snapshots",
+	"enable-buckets",
+	"review-rightsizing",
+}
+
+// Config options with the tag keys used by Cloudsweeper
+var tagKeyConfigOptions = []string{
+	"whitelist-tag-key",
+	"lifetime-tag-key",
+	"expiry-tag-key",
+	"delete-tag-key",
+	"delete-reason-tag-key",
+	"delete-policy-tag-key",
+	"temporary-tag-key",
+	"cost-center-tag-key",
+	"project-tag-key",
+}
+
+// validate checks the config file, thresholds, policy file, organization
+// file and do-not-delete list, and logs every problem found. It returns
+// the exit code of the validation.
+func validate() int {
+	problems := append(validationProblems(), serveCommandProblems(listFromConfig(configValue("serve-commands")))...)
+	if len(problems) == 0 {
+		log.Println("Configuration is valid")
+		return status.ExitSuccess
+	}
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+	log.Printf("Found %d problems", len(problems))
+	return status.ExitConfigError
+}
+
+// validationProblems returns every problem with the loaded config and
+// the files it points to
+func validationProblems() []string {
+	problems := []string{}
+	problems = append(problems, validateConfig()...)
+	problems = append(problems, secretProblems()...)
+	problems = append(problems, validateOrganizationFile(configValue("org-file"))...)
+	problems = append(problems, validatePolicyFile(configValue("policy-file"))...)
+	problems = append(problems, validatePolicyFile(configValue("shadow-policy-file"))...)
+	problems = append(problems, validateDoNotDelete(doNotDeleteFileName)...)
+	return problems
+}
+
+func validateConfig() []string {
+	problems := []string{}
+	knownKeys := make(map[string]bool)
+	for _, mapping := range configMapping {
+		knownKeys[mapping.confKey] = true
+	}
+	unknownKeys := []string{}
+	for key := range config {
+		if !knownKeys[key] {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	sort.Strings(unknownKeys)
+	for _, key := range unknownKeys {
+		problems = append(problems, fmt.Sprintf("Unknown option %s in %s", key, configFileName))
+	}
+
+	for _, name := range append(intConfigOptions, thnames...) {
+		val := configValue(name)
+		if val == "" {
+			continue
+		}
+		if i, err := strconv.Atoi(val); err != nil {
+			problems = append(problems, fmt.Sprintf("Value '%s' of %s is not an integer", val, name))
+		} else if i < 0 {
+			problems = append(problems, fmt.Sprintf("Value %d of %s is negative", i, name))
+		}
+	}
+	if days, err := strconv.Atoi(configValue("extend-days")); err == nil {
+		if maxDays, err := strconv.Atoi(configValue("max-extend-days")); err == nil && days > maxDays {
+			problems = append(problems, fmt.Sprintf("extend-days %d is above max-extend-days %d", days, maxDays))
+		}
+	}
+	if i, err := strconv.Atoi(configValue("clean-keep-n-component-images")); err == nil && i < 1 {
+		problems = append(problems, "At least one component image must be kept by clean-keep-n-component-images")
+	}
+	for _, name := range boolConfigOptions {
+		if val := configValue(name); val != "" {
+			if _, err := strconv.ParseBool(val); err != nil {
+				problems = append(problems, fmt.Sprintf("Value '%s' of %s is not a boolean", val, name))
+			}
+		}
+	}
+
+	pluginsLoaded := true
+	for _, path := range listFromConfig(configValue("provider-plugins")) {
+		if err := cloud.LoadProviderPlugin(path); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not load provider plugin %s: %s", path, err))
+			pluginsLoaded = false
+		}
+	}
+	csp := configValue("csp")
+	switch strings.ToLower(csp) {
+	case cspFlagAWS, cspFlagGCP:
+	default:
+		if _, exist := cloud.LookupProvider(csp); !exist && pluginsLoaded {
+			problems = append(problems, fmt.Sprintf("Invalid CSP '%s'", csp))
+		}
+	}
+
+	for _, name := range []string{"account-timeout", "region-timeout"} {
+		if d, err := time.ParseDuration(configValue(name)); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("Value '%s' of %s is not a duration, or 0 for no limit", configValue(name), name))
+		}
+	}
+	for _, name := range []string{"serve-interval", "serve-watch-interval", "distribute-timeout"} {
+		if d, err := time.ParseDuration(configValue(name)); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("Value '%s' of %s is not a positive duration", configValue(name), name))
+		}
+	}
+	for _, name := range []string{"grpc-address", "health-address"} {
+		if address := configValue(name); address != "" {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				problems = append(problems, fmt.Sprintf("Value '%s' of %s is not an address, e.g. :8080", address, name))
+			}
+		}
+	}
+	if (configValue("grpc-tls-cert") == "") != (configValue("grpc-tls-key") == "") {
+		problems = append(problems, "grpc-tls-cert and grpc-tls-key must be set together")
+	}
+	if configValue("grpc-client-ca") != "" && configValue("grpc-tls-cert") == "" {
+		problems = append(problems, "grpc-client-ca needs grpc-tls-cert, since client certificates are only sent over TLS")
+	}
+	if link := configValue("unsubscribe-url"); link != "" {
+		if parsed, err := url.Parse(link); err != nil || parsed.Host == "" || parsed.Path == "" {
+			problems = append(problems, fmt.Sprintf("Value '%s' of unsubscribe-url is not a URL with a path, e.g. https://cloudsweeper.example.com/unsubscribe", link))
+		}
+		if configValue("unsubscribe-key") == "" {
+			problems = append(problems, "No unsubscribe-key to sign the links of unsubscribe-url with")
+		}
+		if configValue("health-address") == "" {
+			problems = append(problems, "No health-address to serve the links of unsubscribe-url on")
+		}
+	}
+
+	if kind := configValue("directory"); kind != "" {
+		if _, err := directory.New(kind, configValue("directory-url"), configValue("directory-token")); err != nil {
+			problems = append(problems, err.Error())
+		} else if configValue("directory-url") == "" {
+			problems = append(problems, "directory-url must be set when a directory is configured")
+		}
+	}
+	if format := configValue("graph-format"); !contains(graph.Formats, format) {
+		problems = append(problems, fmt.Sprintf("Invalid graph-format '%s', must be one of %s", format, strings.Join(graph.Formats, ", ")))
+	}
+	if discount, err := strconv.Atoi(configValue("spot-review-savings-plan-discount")); err == nil && (discount < 0 || discount > 100) {
+		problems = append(problems, fmt.Sprintf("Invalid spot-review-savings-plan-discount %d, must be between 0 and 100", discount))
+	}
+	if action := configValue("outdated-marks"); !contains(cleanup.OutdatedMarksActions, action) {
+		problems = append(problems, fmt.Sprintf("Invalid outdated-marks '%s', must be one of %s", action, strings.Join(cleanup.OutdatedMarksActions, ", ")))
+	}
+	if failOnSetting := configValue("fail-on"); !status.ValidFailOn(failOnSetting) {
+		problems = append(problems, fmt.Sprintf("Invalid value '%s' of fail-on, must be '%s' or '%s'", failOnSetting, status.FailOnErrors, status.FailOnWarnings))
+	}
+	for _, port := range listFromConfig(configValue("sensitive-ports")) {
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			problems = append(problems, fmt.Sprintf("Invalid port '%s' in sensitive-ports", port))
+		}
+	}
+	if _, err := time.LoadLocation(configValue("mail-time-zone")); err != nil {
+		problems = append(problems, fmt.Sprintf("Invalid time zone '%s' of mail-time-zone", configValue("mail-time-zone")))
+	}
+	if configValue("aws-console-sso-start-url") != "" && configValue("aws-console-sso-role") == "" {
+		problems = append(problems, "aws-console-sso-role must be set when aws-console-sso-start-url is")
+	}
+	if _, err := cleanup.ParseFreezeWindows(configValue("freeze-windows")); err != nil {
+		problems = append(problems, fmt.Sprintf("Invalid freeze-windows: %s", err))
+	}
+	if _, err := billingPeriodFromConfig(configValue("billing-period"), configValue("billing-start"), configValue("billing-end"), time.Now()); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if month := configValue("chargeback-month"); month != "" {
+		if _, err := time.Parse(chargebackMonthFormat, month); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid chargeback-month '%s', must be on the form YYYY-MM", month))
+		}
+	}
+	if _, err := ownerCostThresholdsFromConfig(configValue("mark-owner-cost-thresholds")); err != nil {
+		problems = append(problems, fmt.Sprintf("Invalid mark-owner-cost-thresholds: %s", err))
+	}
+	if _, err := ownerCostThresholdsFromConfig(configValue("notify-owner-cost-thresholds")); err != nil {
+		problems = append(problems, fmt.Sprintf("Invalid notify-owner-cost-thresholds: %s", err))
+	}
+	for _, source := range listFromConfig(configValue("image-pipeline-sources")) {
+		if strings.HasPrefix(source, "s3://") {
+			if _, _, err := parseS3URL(source); err != nil {
+				problems = append(problems, fmt.Sprintf("Invalid image-pipeline-sources: %s", err))
+			}
+		}
+	}
+	if rates := configValue("currency-rates"); rates != "" && strings.ToLower(rates) != currencyRatesECB {
+		if _, err := billing.LoadCurrencyRates(rates); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not load currency rates: %s", err))
+		}
+	}
+	if path := configValue("kubernetes-clusters-file"); path != "" {
+		clusters := make(map[string]cloud.KubernetesCluster)
+		if raw, err := ioutil.ReadFile(path); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not read Kubernetes clusters file: %s", err))
+		} else if err := json.Unmarshal(raw, &clusters); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not parse Kubernetes clusters file: %s", err))
+		}
+	}
+	if path := configValue("vsphere-servers-file"); path != "" {
+		servers := make(map[string]cloud.VSphereServer)
+		if raw, err := ioutil.ReadFile(path); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not read vSphere servers file: %s", err))
+		} else if err := json.Unmarshal(raw, &servers); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not parse vSphere servers file: %s", err))
+		}
+	}
+
+	tagKeys := make(map[string]string)
+	for _, name := range tagKeyConfigOptions {
+		key := configValue(name)
+		if key == "" {
+			problems = append(problems, fmt.Sprintf("No tag key specified for %s", name))
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			problems = append(problems, fmt.Sprintf("Tag key '%s' of %s uses the reserved aws: prefix", key, name))
+		}
+		if other, exist := tagKeys[key]; exist {
+			problems = append(problems, fmt.Sprintf("%s and %s use the same tag key '%s'", other, name, key))
+		}
+		tagKeys[key] = name
+	}
+	return problems
+}
+
+func validateOrganizationFile(path string) []string {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("Could not read organization file: %s", err)}
+	}
+	problems := []string{}
+	for _, err := range cs.ValidateOrganization(raw) {
+		problems = append(problems, fmt.Sprintf("Organization file %s: %s", path, err))
+	}
+	return problems
+}
+
+func validatePolicyFile(path string) []string {
+	if path == "" {
+		return []string{}
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("Could not read policy file: %s", err)}
+	}
+	problems := []string{}
+	for _, err := range policy.ValidatePolicy(raw) {
+		problems = append(problems, fmt.Sprintf("Policy file %s: %s", path, err))
+	}
+	return problems
+}
+
+// validateDoNotDelete checks that every line of the do-not-delete list
+// is a single resource ID, listed only once. The list is optional.
+func validateDoNotDelete(path string) []string {
+	dndFile, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []string{}
+	} else if err != nil {
+		return []string{fmt.Sprintf("Could not read %s: %s", path, err)}
+	}
+	defer dndFile.Close()
+	problems := []string{}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(dndFile)
+	for line := 1; scanner.Scan(); line++ {
+		id := strings.Trim(scanner.Text(), " ")
+		if id == "" {
+			continue
+		}
+		if strings.ContainsAny(id, " \t,") {
+			problems = append(problems, fmt.Sprintf("%s line %d: '%s' is not a single resource ID", path, line, id))
+		} else if seen[id] {
+			problems = append(problems, fmt.Sprintf("%s line %d: %s is listed more than once", path, line, id))
+		}
+		seen[id] = true
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, fmt.Sprintf("Could not read %s: %s", path, err))
+	}
+	return problems
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Command embed shows how to use Cloudsweeper as a library, e.g. from an
+// operator of your own. It lists the resources in the AWS accounts given
+// as arguments, and prints what would be marked for cleanup and what it
+// costs, without tagging anything. Listing stops when interrupted.
+//
+//	go run ./examples/embed 123456789012 210987654321
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/agaridata/cloudsweeper/cloud"
+	"github.com/agaridata/cloudsweeper/cloud/billing"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/agaridata/cloudsweeper/cloudsweeper/policy"
+	"github.com/agaridata/cloudsweeper/status"
+)
+
+// thresholds are the defaults of the cloudsweeper command, in days
+var thresholds = map[string]int{
+	"clean-untagged-older-than-days":   30,
+	"clean-instances-older-than-days":  182,
+	"clean-images-older-than-days":     182,
+	"clean-snapshots-older-than-days":  182,
+	"clean-unattached-older-than-days": 30,
+	"clean-bucket-not-modified-days":   182,
+	"clean-bucket-older-than-days":     7,
+	"clean-keep-n-component-images":    2,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalln("Usage: embed <AWS account ID>...")
+	}
+
+	// Canceling the context stops the requests still running, and the
+	// accounts not listed yet are left out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	mngr, err := cloud.NewManagerWithConfig(cloud.AWS, &cloud.ManagerConfig{
+		Context:            ctx,
+		AccountParallelism: 4,
+		AccountTimeout:     30 * time.Minute,
+	}, os.Args[1:]...)
+	if err != nil {
+		log.Fatalf("Could not initialize the resource manager: %s", err)
+	}
+
+	// A nil policy marks the resources of every category
+	var pol *policy.Policy
+	marked, _, err := cleanup.MarkForCleanup(mngr, thresholds, pol, true)
+	if err != nil {
+		log.Fatalf("Could not mark resources: %s", err)
+	}
+	for owner, resources := range marked {
+		for _, res := range resources.Instances {
+			fmt.Printf("%s\t%s\t%s\t$%.2f/day\n", owner, res.ID(), cleanup.DeleteReason(res), billing.ResourceCostPerDay(res))
+		}
+		for _, res := range resources.Volumes {
+			fmt.Printf("%s\t%s\t%s\t$%.2f/day\n", owner, res.ID(), cleanup.DeleteReason(res), billing.ResourceCostPerDay(res))
+		}
+		for _, res := range resources.Snapshots {
+			fmt.Printf("%s\t%s\t%s\t$%.2f/day\n", owner, res.ID(), cleanup.DeleteReason(res), billing.ResourceCostPerDay(res))
+		}
+		for _, res := range resources.Images {
+			fmt.Printf("%s\t%s\t%s\t$%.2f/day\n", owner, res.ID(), cleanup.DeleteReason(res), billing.ResourceCostPerDay(res))
+		}
+		for _, res := range resources.Buckets {
+			fmt.Printf("%s\t%s\t%s\t$%.2f/month\n", owner, res.ID(), cleanup.DeleteReason(res), billing.BucketPricePerMonth(res))
+		}
+	}
+
+	// Failures are recorded instead of stopping the program, so check
+	// how it went once done
+	log.Printf("Done (%s)", status.Summary())
+}
@@ -4,8 +4,13 @@ go 1.15
 
 require (
 	cloud.google.com/go/storage v1.12.0
-	github.com/aws/aws-sdk-go v1.34.32
+	github.com/aws/aws-lambda-go v1.19.1
+	github.com/aws/aws-sdk-go v1.55.5
+	github.com/golang/protobuf v1.5.2
 	github.com/joho/godotenv v1.3.0
-	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
-	google.golang.org/api v0.32.0
+	github.com/vmware/govmomi v0.37.3
+	google.golang.org/api v0.46.0
+	google.golang.org/grpc v1.37.0
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const diagnoseTimeout = 30 * time.Second
+
+// Diagnostic is the outcome of one step of talking to an SMTP server
+type Diagnostic struct {
+	Step string
+	Err  error
+}
+
+// Diagnose connects to the SMTP server one step at a time, the same way
+// as sending an email does, and returns the outcome of every step up to
+// and including the first one which failed. This tells apart e.g. a
+// server which can't be reached from a failing TLS handshake or wrong
+// credentials, which SendEmail reports as a single error.
+func Diagnose(username, password, smtpServer string, smtpPort int) []Diagnostic {
+	server := net.JoinHostPort(smtpServer, strconv.Itoa(smtpPort))
+	result := []Diagnostic{}
+	step := func(name string, err error) bool {
+		result = append(result, Diagnostic{Step: name, Err: err})
+		return err == nil
+	}
+
+	conn, err := net.DialTimeout("tcp", server, diagnoseTimeout)
+	if !step(fmt.Sprintf("Connect to %s", server), err) {
+		return result
+	}
+	conn.SetDeadline(time.Now().Add(diagnoseTimeout))
+	client, err := smtp.NewClient(conn, smtpServer)
+	if !step("Read greeting", err) {
+		conn.Close()
+		return result
+	}
+	defer client.Close()
+	if !step("Say hello", client.Hello("localhost")) {
+		return result
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if !step("Start TLS", client.StartTLS(&tls.Config{ServerName: smtpServer})) {
+			return result
+		}
+	} else {
+		step("Start TLS", fmt.Errorf("%s doesn't support STARTTLS, the password would be sent unencrypted", server))
+		return result
+	}
+
+	if ok, _ := client.Extension("AUTH"); !ok {
+		step("Authenticate", fmt.Errorf("%s doesn't support authentication", server))
+		return result
+	}
+	if !step(fmt.Sprintf("Authenticate as %s", username), client.Auth(smtp.PlainAuth("", username, password, smtpServer))) {
+		return result
+	}
+	step("Quit", client.Quit())
+	return result
+}
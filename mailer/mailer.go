@@ -10,8 +10,13 @@ package mailer
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 	"text/template"
 )
@@ -30,6 +35,16 @@ Content-Type: text/html; charset="UTF-8";
 type Client interface {
 	// SendEmail will send a mail to the specified email address
 	SendEmail(subject, content string, recipients ...string) error
+	// SendEmailWithAttachments will send a mail with the specified files
+	// attached to the specified email address
+	SendEmailWithAttachments(subject, content string, attachments []Attachment, recipients ...string) error
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
 }
 
 type mailer struct {
@@ -83,6 +98,63 @@ func (m *mailer) SendEmail(subject, content string, recipients ...string) error
 	return err
 }
 
+// SendEmailWithAttachments will send a mail with the content as the HTML
+// body, and the attachments as files, to the specified address
+func (m *mailer) SendEmailWithAttachments(subject, content string, attachments []Attachment, recipients ...string) error {
+	server := fmt.Sprintf("%s:%d", m.smtpServer, m.smtpPort)
+	var msg bytes.Buffer
+	parts := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s <%s>\r\n", m.displayName, m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "MIME-version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+
+	body, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {`text/html; charset="UTF-8"`}})
+	if err != nil {
+		return err
+	}
+	if _, err := body.Write([]byte(content)); err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		header := textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		}
+		part, err := parts.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if err := writeBase64Lines(part, attachment.Content); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+	return smtp.SendMail(server, m.auth, m.from, recipients, msg.Bytes())
+}
+
+// writeBase64Lines writes base64 encoded data in lines of 76 characters,
+// the maximum line length of MIME
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:n]); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
 type mailContext struct {
 	From        string
 	To          string
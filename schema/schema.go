@@ -0,0 +1,42 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package schema versions the JSON files Cloudsweeper writes for other
+// tools to read, such as inventories, bulk operation reports and run
+// summaries. Every file has a schemaVersion field with the version of its
+// kind of file, which grows whenever its format changes in a way that
+// would break a reader of the previous version. The JSON schemas of the
+// current versions are in the schemas directory of the repository.
+//
+// Readers accept the current version and at least the one before it, and
+// refuse newer versions instead of misreading them. Files written before
+// versions were recorded have no schemaVersion field, and are version 1.
+package schema
+
+import "fmt"
+
+// Unversioned is the version of files without a schemaVersion field,
+// which were written before versions were recorded
+const Unversioned = 1
+
+// Version returns the version of a file from its schemaVersion field,
+// which is zero if the file doesn't have one
+func Version(field int) int {
+	if field == 0 {
+		return Unversioned
+	}
+	return field
+}
+
+// Check returns an error if a file of a kind, e.g. "inventory", has a
+// version which can't be read, since it's older than the oldest version
+// still read or newer than the current one
+func Check(kind string, version, oldest, current int) error {
+	if version > current {
+		return fmt.Errorf("The %s has schema version %d, which is newer than the latest supported version %d. Please upgrade Cloudsweeper", kind, version, current)
+	}
+	if version < oldest {
+		return fmt.Errorf("The %s has schema version %d, which is no longer supported. The oldest supported version is %d", kind, version, oldest)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package status keeps track of warnings and failures during a run of
+// Cloudsweeper, so that the exit code reflects how the run went. This
+// makes it possible to gate CI pipelines on the result of a run.
+//
+// Warnings are problems which make the result less accurate, such as
+// not being able to look up when a bucket was last read. Action failures
+// are operations which did not go through, such as a failed cleanup or
+// email. Discovery failures mean resources in an account or project
+// could not be listed at all, usually because access was denied, or
+// listing them timed out.
+package status
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The exit codes of Cloudsweeper
+const (
+	// ExitSuccess means the run completed without any errors
+	ExitSuccess = 0
+	// ExitConfigError means the configuration was invalid. This is the
+	// same exit code as log.Fatal, which is used for config errors.
+	ExitConfigError = 1
+	// ExitPartialFailure means some actions failed, or there were
+	// warnings and the run fails on warnings
+	ExitPartialFailure = 2
+	// ExitDiscoveryFailure means resources in some accounts or projects
+	// could not be listed
+	ExitDiscoveryFailure = 3
+)
+
+// Kind is the kind of problem recorded
+type Kind int
+
+const (
+	// Warning is a problem which makes the result less accurate
+	Warning Kind = iota
+	// ActionFailure is an operation on a resource, or an email, that failed
+	ActionFailure
+	// DiscoveryFailure is a failure to list resources
+	DiscoveryFailure
+)
+
+// ExitOnFatal makes DiscoveryFatalf exit the program. It's off by
+// default, so that programs embedding Cloudsweeper record such failures
+// as discovery failures and carry on, and the cloudsweeper command turns
+// it on.
+var ExitOnFatal = false
+
+// The values of the fail-on setting
+const (
+	FailOnErrors   = "errors"
+	FailOnWarnings = "warnings"
+)
+
+var (
+	mutex    sync.Mutex
+	counts   = map[Kind]int{}
+	notes    = []string{}
+	timedOut = []string{}
+)
+
+// Record will record that a problem of the specified kind happened
+func Record(kind Kind) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	counts[kind]++
+}
+
+// Reset forgets all problems recorded so far, e.g. before the next run
+// when running as a service
+func Reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	counts = map[Kind]int{}
+	notes = []string{}
+	timedOut = []string{}
+}
+
+// Count returns how many problems of the specified kind were recorded
+func Count(kind Kind) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return counts[kind]
+}
+
+// Warnf logs a warning and records it
+func Warnf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	Record(Warning)
+}
+
+// Notef logs something noteworthy about the run, such as a change freeze,
+// which is not a problem but is included in the summary
+func Notef(format string, v ...interface{}) {
+	note := fmt.Sprintf(format, v...)
+	log.Output(2, note)
+	mutex.Lock()
+	defer mutex.Unlock()
+	notes = append(notes, note)
+}
+
+// ActionFailedf logs a failed action and records it
+func ActionFailedf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	Record(ActionFailure)
+}
+
+// DiscoveryFailedf logs a discovery failure and records it
+func DiscoveryFailedf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	Record(DiscoveryFailure)
+}
+
+// TimedOut logs that listing the resources in a scope, such as an account
+// or a region of one, was given up on after the timeout, and records it as
+// a discovery failure. The scopes which timed out are listed in the summary,
+// so that it's clear which results are incomplete.
+func TimedOut(scope string, timeout time.Duration) {
+	log.Output(2, fmt.Sprintf("%s timed out after %s, continuing without it", scope, timeout))
+	Record(DiscoveryFailure)
+	mutex.Lock()
+	defer mutex.Unlock()
+	timedOut = append(timedOut, scope)
+}
+
+// DiscoveryFatalf logs a discovery failure which the run can not
+// recover from, and exits with ExitDiscoveryFailure, unless ExitOnFatal
+// is turned off
+func DiscoveryFatalf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	if !ExitOnFatal {
+		Record(DiscoveryFailure)
+		return
+	}
+	os.Exit(ExitDiscoveryFailure)
+}
+
+// ValidFailOn returns true if the value is a valid fail-on setting
+func ValidFailOn(failOn string) bool {
+	return failOn == FailOnErrors || failOn == FailOnWarnings
+}
+
+// ExitCode returns the exit code reflecting the problems recorded so
+// far. Discovery failures take precedence over action failures. If
+// failOn is FailOnWarnings, warnings count as a partial failure.
+func ExitCode(failOn string) int {
+	switch {
+	case Count(DiscoveryFailure) > 0:
+		return ExitDiscoveryFailure
+	case Count(ActionFailure) > 0:
+		return ExitPartialFailure
+	case failOn == FailOnWarnings && Count(Warning) > 0:
+		return ExitPartialFailure
+	}
+	return ExitSuccess
+}
+
+// Summary returns a short description of the problems recorded, and of
+// anything noted
+func Summary() string {
+	summary := fmt.Sprintf("%d discovery failures, %d failed actions, %d warnings",
+		Count(DiscoveryFailure), Count(ActionFailure), Count(Warning))
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(timedOut) > 0 {
+		summary += "; timed out: " + strings.Join(timedOut, ", ")
+	}
+	for _, note := range notes {
+		summary += "; " + note
+	}
+	return summary
+}